@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"hash"
+	"io"
 )
 
 func trimAuthValue(value []byte) []byte {
@@ -62,7 +63,7 @@ func newSessionParamForAuth(session SessionContext, resource ResourceContext) (*
 	case s.Session.Params().IsBound:
 		// A bound HMAC session. Include the auth value of the associated
 		// context only if it is not the bind entity.
-		bindName := computeBindName(s.AssociatedResource.Name(), trimAuthValue(s.AssociatedResource.AuthValue()))
+		bindName := BoundEntityValue(s.AssociatedResource.AuthValue(), s.AssociatedResource.Name())
 		s.IncludeAuthValue = !bytes.Equal(bindName, s.Session.Params().BoundEntity)
 	default:
 		// A non-bound HMAC session. Include the auth value of the associated
@@ -86,9 +87,8 @@ func (s *sessionParam) ComputeSessionHMACKey() []byte {
 	return key
 }
 
-func (s *sessionParam) computeHMAC(pHash []byte, nonceNewer, nonceOlder, nonceDecrypt, nonceEncrypt Nonce, attrs SessionAttributes) ([]byte, bool) {
-	key := s.ComputeSessionHMACKey()
-	h := hmac.New(func() hash.Hash { return s.Session.Params().HashAlg.NewHash() }, key)
+func computeSessionHMAC(alg HashAlgorithmId, key, pHash, nonceNewer, nonceOlder, nonceDecrypt, nonceEncrypt []byte, attrs SessionAttributes) []byte {
+	h := hmac.New(func() hash.Hash { return alg.NewHash() }, key)
 
 	h.Write(pHash)
 	h.Write(nonceNewer)
@@ -97,7 +97,35 @@ func (s *sessionParam) computeHMAC(pHash []byte, nonceNewer, nonceOlder, nonceDe
 	h.Write(nonceEncrypt)
 	h.Write([]byte{uint8(attrs)})
 
-	return h.Sum(nil), len(key) > 0
+	return h.Sum(nil)
+}
+
+func (s *sessionParam) computeHMAC(pHash []byte, nonceNewer, nonceOlder, nonceDecrypt, nonceEncrypt Nonce, attrs SessionAttributes) ([]byte, bool) {
+	key := s.ComputeSessionHMACKey()
+	return computeSessionHMAC(s.Session.Params().HashAlg, key, pHash, nonceNewer, nonceOlder, nonceDecrypt, nonceEncrypt, attrs), len(key) > 0
+}
+
+// ComputeCommandHMAC computes the HMAC for a command authorization with the supplied session
+// key, authorization value, command parameter digest and nonces. This uses the same
+// implementation that is used to compute the HMAC for command authorizations created by
+// [TPMContext], and is intended to help with debugging HMAC failures.
+//
+// The authValue argument should be the authorization value of the entity being authorized if it
+// is included in the HMAC key, which is the case for unbound HMAC sessions, HMAC sessions bound to
+// a different entity and policy sessions that include the TPM2_PolicyAuthValue assertion.
+// Otherwise, it should be empty. Trailing zeros are removed from authValue before it is used.
+//
+// The nonceNewer argument is the caller nonce sent with the command, and the nonceOlder argument
+// is the last nonce returned from the TPM for the session. The cpHash argument can be computed
+// using [github.com/canonical/go-tpm2/policyutil.ComputeCpHash].
+//
+// When separate sessions are used for parameter encryption, the HMAC for the first authorization
+// session of a command also includes the nonces of those sessions. This function can't be used
+// to compute the HMAC in that case.
+func ComputeCommandHMAC(sessionKey, authValue []byte, cpHash, nonceNewer, nonceOlder []byte, attrs SessionAttributes, hashAlg HashAlgorithmId) []byte {
+	key := append([]byte{}, sessionKey...)
+	key = append(key, trimAuthValue(authValue)...)
+	return computeSessionHMAC(hashAlg, key, cpHash, nonceNewer, nonceOlder, nil, nil, attrs)
 }
 
 func (s *sessionParam) ComputeCommandHMAC(commandCode CommandCode, commandHandles []Name, cpBytes []byte) []byte {
@@ -149,6 +177,22 @@ func (s *sessionParam) ProcessResponseAuth(resp AuthResponse, commandCode Comman
 	return nil
 }
 
+// BoundEntityValue computes the value that identifies the entity that a HMAC session is bound
+// to, from the supplied authorization value and name of the entity. This is the name of the
+// entity XOR'd with its authorization value (TPM 2.0 Library Specification Part 1, section
+// 19.6.11), and uses the same implementation that is used by [TPMContext.StartAuthSession] to
+// compute the value returned from the BoundEntity field of [SessionContextParams]. Trailing
+// zeros are removed from authValue before it is used.
+//
+// Note that the name of the bind entity doesn't contribute to the session key, which is derived
+// from the authorization value of the bind entity and the salt. This value determines whether the
+// authorization value of an entity is included in the HMAC key for a bound session - it is
+// omitted when the session is used to authorize the entity that it is bound to. This is intended
+// to help with independently verifying HMAC computations.
+func BoundEntityValue(authValue []byte, name Name) []byte {
+	return computeBindName(name, trimAuthValue(authValue))
+}
+
 func computeBindName(name Name, auth Auth) Name {
 	if len(auth) > len(name) {
 		auth = auth[0:len(name)]
@@ -166,6 +210,10 @@ func computeBindName(name Name, auth Auth) Name {
 type sessionParams struct {
 	CommandCode CommandCode
 
+	// Rand is the source of randomness for caller nonces. If this is nil,
+	// crypto/rand.Reader is used.
+	Rand io.Reader
+
 	Sessions            []*sessionParam
 	EncryptSessionIndex int
 	DecryptSessionIndex int
@@ -227,9 +275,10 @@ func (p *sessionParams) ComputeCallerNonces() error {
 			continue
 		}
 		s.NonceCaller = make(Nonce, s.Session.Params().HashAlg.Size())
-		if err := cryptComputeNonce(s.NonceCaller); err != nil {
+		if err := cryptComputeNonce(p.Rand, s.NonceCaller); err != nil {
 			return fmt.Errorf("cannot compute new caller nonce: %v", err)
 		}
+		s.Session.State().NonceCaller = s.NonceCaller
 	}
 	return nil
 }
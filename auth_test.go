@@ -6,6 +6,7 @@ package tpm2_test
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/aes"
 	"encoding/binary"
 	"testing"
@@ -114,6 +115,18 @@ func (s *authSuite) TestNewSessionParamForAuthBoundHMAC2(c *C) {
 	c.Check(p, DeepEquals, newMockSessionParam(session, resource, false, true, nil, nil, nil))
 }
 
+func (s *authSuite) TestBoundEntityValue(c *C) {
+	c.Check(BoundEntityValue([]byte{0x55, 0x55}, []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa}), DeepEquals, []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xff, 0xff})
+}
+
+func (s *authSuite) TestBoundEntityValueTrimsAuthValue(c *C) {
+	c.Check(BoundEntityValue([]byte{0x55, 0x55, 0x00, 0x00}, []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa}), DeepEquals, []byte{0xaa, 0xaa, 0xaa, 0xaa, 0xff, 0xff})
+}
+
+func (s *authSuite) TestBoundEntityValueLongAuthValue(c *C) {
+	c.Check(BoundEntityValue([]byte{0x55, 0x55, 0x55, 0x55}, []byte{0xaa, 0xaa, 0xaa}), DeepEquals, []byte{0xff, 0xff, 0xff})
+}
+
 func (s *authSuite) TestNewSessionParamForAuthPolicy(c *C) {
 	session := &mockSessionContext{
 		handle: 0x03000000}
@@ -463,6 +476,32 @@ func (s *authSuite) TestSessionParamComputeCommandHMACDifferentCommand(c *C) {
 		expected:         internal_testutil.DecodeHexString(c, "b967c04071695d4e3598adb1b033780d795f1dee3c7b2ab02dc46202b2ab7067")})
 }
 
+func (s *authSuite) TestComputeCommandHMAC(c *C) {
+	// This should produce the same HMAC as TestSessionParamComputeCommandHMACUnbound.
+	h := crypto.SHA256.New()
+	binary.Write(h, binary.BigEndian, CommandUnseal)
+	h.Write(internal_testutil.DecodeHexString(c, "000bf80b1fa820d95a87cf48f78eb6c298b427fda46207f7b52eaff6fb8ab1590c64"))
+	cpHash := h.Sum(nil)
+
+	hmac := ComputeCommandHMAC(
+		internal_testutil.DecodeHexString(c, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"),
+		[]byte("foo"),
+		cpHash,
+		internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865"),
+		internal_testutil.DecodeHexString(c, "53c234e5e8472b6ac51c1ae1cab3fe06fad053beb8ebfd8977b010655bfdd3c3"),
+		AttrContinueSession, HashAlgorithmSHA256)
+	c.Check(hmac, DeepEquals, internal_testutil.DecodeHexString(c, "c2ec178c103828144980213df8cb534554551c2662ddecb13d60e23e8b81b5c9"))
+}
+
+func (s *authSuite) TestComputeCommandHMACTrimsAuthValue(c *C) {
+	cpHash := internal_testutil.DecodeHexString(c, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	nonceNewer := internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865")
+	nonceOlder := internal_testutil.DecodeHexString(c, "53c234e5e8472b6ac51c1ae1cab3fe06fad053beb8ebfd8977b010655bfdd3c3")
+
+	c.Check(ComputeCommandHMAC(nil, []byte("foo\x00\x00"), cpHash, nonceNewer, nonceOlder, AttrContinueSession, HashAlgorithmSHA256), DeepEquals,
+		ComputeCommandHMAC(nil, []byte("foo"), cpHash, nonceNewer, nonceOlder, AttrContinueSession, HashAlgorithmSHA256))
+}
+
 type testSessionParamComputeResponseHMACData struct {
 	hashAlg          HashAlgorithmId
 	sessionKey       []byte
@@ -1130,6 +1169,23 @@ func (s *authSuite) TestSessionParamsComputeCallerNonces(c *C) {
 	c.Check(params.Sessions[1].NonceCaller, DeepEquals, Nonce(internal_testutil.DecodeHexString(c, "66666666777777778888888899999999aaaaaaaabbbbbbbbccccccccdddddddd")))
 }
 
+func (s *authSuite) TestSessionParamsComputeCallerNoncesWithRand(c *C) {
+	b := internal_testutil.DecodeHexString(c, "aaaaaaaabbbbbbbbccccccccdddddddd111111112222222233333333444444445555555566666666777777778888888899999999")
+
+	sessions := []*mockSessionContext{
+		&mockSessionContext{data: SessionContextData{Params: SessionContextParams{HashAlg: HashAlgorithmSHA256}}},
+		&mockSessionContext{data: SessionContextData{Params: SessionContextParams{HashAlg: HashAlgorithmSHA1}}}}
+	params := newMockSessionParams(0, []*SessionParam{
+		newMockSessionParam(sessions[0], nil, false, false, nil, nil, nil),
+		newMockSessionParam(sessions[1], nil, false, false, nil, nil, nil),
+	}, -1, -1)
+	params.Rand = bytes.NewReader(b)
+
+	c.Check(params.ComputeCallerNonces(), IsNil)
+	c.Check(params.Sessions[0].NonceCaller, DeepEquals, Nonce(internal_testutil.DecodeHexString(c, "aaaaaaaabbbbbbbbccccccccdddddddd11111111222222223333333344444444")))
+	c.Check(params.Sessions[1].NonceCaller, DeepEquals, Nonce(internal_testutil.DecodeHexString(c, "5555555566666666777777778888888899999999")))
+}
+
 type testSessionParamsBuildCommandAuthAreaData struct {
 	rand []byte
 
@@ -148,6 +148,49 @@ func (s *attestationSuite) TestCertifySignAuthSession(c *C) {
 				RSAPSS: &SigSchemeRSAPSS{HashAlg: HashAlgorithmSHA256}}}})
 }
 
+func (s *attestationSuite) TestCertifyLoadedKeyWithLoadedKey(c *C) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+
+	objectAuth := []byte("1234")
+	objectPriv, objectPub, _, _, _, err := s.TPM.Create(primary, &SensitiveCreate{UserAuth: objectAuth}, testutil.NewRSAKeyTemplate(objectutil.UsageDecrypt, nil), nil, nil, nil)
+	c.Assert(err, IsNil)
+	object, err := s.TPM.Load(primary, objectPriv, objectPub, nil)
+	c.Assert(err, IsNil)
+	object.SetAuthValue(objectAuth)
+
+	signAuth := []byte("5678")
+	signPriv, signPub, _, _, _, err := s.TPM.Create(primary, &SensitiveCreate{UserAuth: signAuth}, testutil.NewECCKeyTemplate(objectutil.UsageSign, nil), nil, nil, nil)
+	c.Assert(err, IsNil)
+	sign, err := s.TPM.Load(primary, signPriv, signPub, nil)
+	c.Assert(err, IsNil)
+	sign.SetAuthValue(signAuth)
+
+	scheme := &SigScheme{
+		Scheme: SigSchemeAlgECDSA,
+		Details: &SigSchemeU{
+			ECDSA: &SigSchemeECDSA{HashAlg: HashAlgorithmSHA256}}}
+
+	objectSession := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	signSession := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	certifyInfo, signature, err := s.TPM.Certify(object, sign, []byte("foo"), scheme, objectSession, signSession)
+	c.Assert(err, IsNil)
+
+	// The object being certified is authorized first, followed by the signing key.
+	_, authArea, _ := s.LastCommand(c).UnmarshalCommand(c)
+	c.Assert(authArea, internal_testutil.LenEquals, 2)
+	c.Check(authArea[0].SessionHandle, Equals, objectSession.Handle())
+	c.Check(authArea[1].SessionHandle, Equals, signSession.Handle())
+
+	s.checkAttestCommon(c, certifyInfo, TagAttestCertify, sign, HandleOwner, []byte("foo"))
+	_, name, qn, err := s.TPM.ReadPublic(object)
+	c.Assert(err, IsNil)
+	c.Check(certifyInfo.Attested.Certify.Name, DeepEquals, name)
+	c.Check(certifyInfo.Attested.Certify.QualifiedName, DeepEquals, qn)
+
+	s.checkAttestSignature(c, signature, sign, certifyInfo, scheme)
+}
+
 type testCertifyCreationData struct {
 	sign            ResourceContext
 	qualifyingData  Data
@@ -286,6 +286,61 @@ func (t *TPMContext) DoesHandleExist(handle Handle, sessions ...SessionContext)
 	return true
 }
 
+// FindFreeHandle returns a handle of the specified type that doesn't correspond to a resource on
+// the TPM. The handle type must be [HandleTypeNVIndex] or [HandleTypePersistent].
+//
+// Any preferred handles are checked in order first, and the first one that is not in use is
+// returned. Each preferred handle must be of the specified type. If all of the preferred handles
+// are in use, the range of handles for the specified type is scanned from the start and the first
+// handle that is not in use is returned. The range of handles is 0x01000000 to 0x01ffffff for NV
+// indices and 0x81000000 to 0x81ffffff for persistent objects. Note that some parts of these
+// ranges are reserved for specific uses by the "Registry of reserved TPM 2.0 handles and
+// localities" specification, and the platform range of persistent handles can't be used by the
+// owner, so callers that care about this should supply preferred handles from the appropriate
+// range.
+//
+// The handle is only guaranteed to be free at the time that this function runs.
+func (t *TPMContext) FindFreeHandle(handleType HandleType, preferred ...Handle) (Handle, error) {
+	switch handleType {
+	case HandleTypeNVIndex, HandleTypePersistent:
+		// ok
+	default:
+		return HandleUnassigned, makeInvalidArgError("handleType", fmt.Sprintf("unsupported handle type %#02x", handleType))
+	}
+
+	for _, handle := range preferred {
+		if handle.Type() != handleType {
+			return HandleUnassigned, makeInvalidArgError("preferred", fmt.Sprintf("handle %v has the wrong type", handle))
+		}
+
+		handles, err := t.GetCapabilityHandles(handle, 1)
+		if err != nil {
+			return HandleUnassigned, err
+		}
+		if len(handles) == 0 || handles[0] != handle {
+			return handle, nil
+		}
+	}
+
+	handles, err := t.GetCapabilityHandles(handleType.BaseHandle(), CapabilityMaxProperties)
+	if err != nil {
+		return HandleUnassigned, err
+	}
+
+	candidate := handleType.BaseHandle()
+	for _, handle := range handles {
+		if handle.Type() != handleType || handle != candidate {
+			break
+		}
+		candidate += 1
+	}
+	if candidate.Type() != handleType {
+		return HandleUnassigned, fmt.Errorf("no free handle of type %#02x", handleType)
+	}
+
+	return candidate, nil
+}
+
 // DoesSavedSessionExist is a convenience function for [TPMContext.GetCapability] that determines
 // if the specified handle corresponds to a saved session. This will indicate that there is no
 // saved session if the TPM returns an error.
@@ -313,6 +368,63 @@ func (t *TPMContext) DoesSavedSessionExist(handle Handle, sessions ...SessionCon
 	return true
 }
 
+// SessionInfo describes a session that is active on the TPM, as returned from
+// [TPMContext.ActiveSessions].
+type SessionInfo struct {
+	// Handle is the handle of the session. The TPM doesn't indicate the type of
+	// saved sessions, so the handle of these is always in the HMAC session range.
+	Handle Handle
+
+	// Loaded indicates whether the session is currently loaded on the TPM. A session
+	// that is not loaded has been saved with TPM2_ContextSave.
+	Loaded bool
+
+	// TypeKnown indicates whether the type of the session could be determined. This is
+	// only true for loaded sessions.
+	TypeKnown bool
+
+	// Type indicates the type of the session if TypeKnown is true. The TPM doesn't
+	// distinguish between policy and trial sessions, so both of these are indicated
+	// as SessionTypePolicy.
+	Type SessionType
+}
+
+// ActiveSessions is a convenience function for [TPMContext.GetCapability] that returns the
+// sessions that are currently active on the TPM, both loaded and saved, regardless of which
+// context created them. This can be useful for diagnosing session leaks.
+//
+// The type of a session can only be determined if it is loaded.
+func (t *TPMContext) ActiveSessions(sessions ...SessionContext) ([]SessionInfo, error) {
+	loaded, err := t.GetCapabilityHandles(HandleTypeLoadedSession.BaseHandle(), CapabilityMaxProperties, sessions...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain loaded sessions: %w", err)
+	}
+	saved, err := t.GetCapabilityHandles(HandleTypeSavedSession.BaseHandle(), CapabilityMaxProperties, sessions...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain saved sessions: %w", err)
+	}
+
+	var infos []SessionInfo
+	for _, handle := range loaded {
+		info := SessionInfo{Handle: handle, Loaded: true, TypeKnown: true}
+		switch handle.Type() {
+		case HandleTypeHMACSession:
+			info.Type = SessionTypeHMAC
+		case HandleTypePolicySession:
+			info.Type = SessionTypePolicy
+		default:
+			return nil, &InvalidResponseError{CommandGetCapability,
+				fmt.Errorf("TPM returned a loaded session with an invalid handle %v", handle)}
+		}
+		infos = append(infos, info)
+	}
+	for _, handle := range saved {
+		infos = append(infos, SessionInfo{Handle: handle})
+	}
+
+	return infos, nil
+}
+
 // GetCapabilityPCRs is a convenience function for [TPMContext.GetCapability], and returns the
 // current allocation of PCRs on the TPM.
 func (t *TPMContext) GetCapabilityPCRs(sessions ...SessionContext) (pcrs PCRSelectionList, err error) {
@@ -323,6 +435,30 @@ func (t *TPMContext) GetCapabilityPCRs(sessions ...SessionContext) (pcrs PCRSele
 	return data.Data.AssignedPCR, nil
 }
 
+// AllocatedPCRBanks returns the current allocation of PCRs on the TPM. This is obtained using
+// [TPMContext.GetCapabilityPCRs] the first time it is called, and is then cached on this context
+// until a TPM2_PCR_Allocate or TPM2_Startup command is executed successfully.
+//
+// Any sessions supplied should have the [AttrContinueSession] attribute set.
+func (t *TPMContext) AllocatedPCRBanks(sessions ...SessionContext) (PCRSelectionList, error) {
+	if t.allocatedPCRs == nil {
+		pcrs, err := t.GetCapabilityPCRs(sessions...)
+		if err != nil {
+			return nil, err
+		}
+		t.allocatedPCRs = pcrs
+	}
+
+	var out PCRSelectionList
+	for _, s := range t.allocatedPCRs {
+		out = append(out, PCRSelection{
+			Hash:         s.Hash,
+			Select:       append(PCRSelect(nil), s.Select...),
+			SizeOfSelect: s.SizeOfSelect})
+	}
+	return out, nil
+}
+
 // GetCapabilityTPMProperties is a convenience function for [TPMContext.GetCapability], and returns
 // the values of properties of the TPM. The first parameter indicates the first property for which
 // to return a value. If the property does not exist, then the value of the next available property
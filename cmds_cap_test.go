@@ -300,6 +300,32 @@ func (s *capabilitiesSuite) TestIsCommandIsNotSupported(c *C) {
 	c.Check(s.TPM.IsCommandSupported(CommandFirst), internal_testutil.IsFalse)
 }
 
+func (s *capabilitiesSuite) TestAllocatedPCRBanks(c *C) {
+	pcrs, err := s.TPM.AllocatedPCRBanks()
+	c.Assert(err, IsNil)
+
+	var found bool
+	for _, selection := range pcrs {
+		if selection.Hash == HashAlgorithmSHA256 {
+			found = true
+			c.Check(selection.Select, internal_testutil.LenGreaterEquals, 24)
+		}
+	}
+	c.Check(found, internal_testutil.IsTrue)
+
+	expected, err := s.TPM.GetCapabilityPCRs()
+	c.Check(err, IsNil)
+	c.Check(pcrs, DeepEquals, expected)
+
+	// Subsequent calls should use the cached value, and the returned value should be a copy.
+	pcrs[0].Select = nil
+	s.ForgetCommands()
+	pcrs, err = s.TPM.AllocatedPCRBanks()
+	c.Check(err, IsNil)
+	c.Check(pcrs, DeepEquals, expected)
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 0)
+}
+
 type testGetCapabilityHandlesData struct {
 	firstHandle   Handle
 	propertyCount uint32
@@ -370,6 +396,76 @@ func (s *capabilitiesSuite) TestDoesHandleNotExistPolicySession(c *C) {
 	c.Check(s.TPM.DoesHandleExist(0x03000010), internal_testutil.IsFalse)
 }
 
+func (s *capabilitiesSuite) TestFindFreeHandleInvalidType(c *C) {
+	_, err := s.TPM.FindFreeHandle(HandleTypeTransient)
+	c.Check(err, ErrorMatches, `invalid handleType argument: unsupported handle type 0x80`)
+}
+
+func (s *capabilitiesSuite) TestFindFreeHandleInvalidPreferred(c *C) {
+	_, err := s.TPM.FindFreeHandle(HandleTypeNVIndex, 0x81000001)
+	c.Check(err, ErrorMatches, `invalid preferred argument: handle 0x81000001 has the wrong type`)
+}
+
+type capabilitiesSuiteNV struct {
+	testutil.TPMTest
+}
+
+func (s *capabilitiesSuiteNV) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy | testutil.TPMFeatureNV | testutil.TPMFeaturePersistent
+}
+
+var _ = Suite(&capabilitiesSuiteNV{})
+
+func (s *capabilitiesSuiteNV) defineNV(c *C, handle Handle) {
+	s.NVDefineSpace(c, HandleOwner, nil, &NVPublic{
+		Index:   handle,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    8})
+}
+
+func (s *capabilitiesSuiteNV) TestFindFreeHandlePreferred(c *C) {
+	handle := s.NextAvailableHandle(c, 0x0180ff00)
+
+	free, err := s.TPM.FindFreeHandle(HandleTypeNVIndex, handle)
+	c.Check(err, IsNil)
+	c.Check(free, Equals, handle)
+}
+
+func (s *capabilitiesSuiteNV) TestFindFreeHandleSkipsOccupiedPreferred(c *C) {
+	handle := s.NextAvailableHandle(c, 0x0180ff00)
+	s.defineNV(c, handle)
+	next := s.NextAvailableHandle(c, handle)
+
+	free, err := s.TPM.FindFreeHandle(HandleTypeNVIndex, handle, next)
+	c.Check(err, IsNil)
+	c.Check(free, Equals, next)
+}
+
+func (s *capabilitiesSuiteNV) TestFindFreeHandleScan(c *C) {
+	base := HandleTypeNVIndex.BaseHandle()
+	handle := s.NextAvailableHandle(c, base)
+	s.defineNV(c, handle)
+
+	free, err := s.TPM.FindFreeHandle(HandleTypeNVIndex, handle)
+	c.Check(err, IsNil)
+	c.Check(free, Equals, s.NextAvailableHandle(c, base))
+	c.Check(free, Not(Equals), handle)
+	c.Check(s.TPM.DoesHandleExist(free), internal_testutil.IsFalse)
+}
+
+func (s *capabilitiesSuiteNV) TestFindFreeHandlePersistent(c *C) {
+	base := HandleTypePersistent.BaseHandle()
+	handle := s.NextAvailableHandle(c, base)
+	s.EvictControl(c, HandleOwner, s.CreateStoragePrimaryKeyRSA(c), handle)
+
+	free, err := s.TPM.FindFreeHandle(HandleTypePersistent, handle)
+	c.Check(err, IsNil)
+	c.Check(free, Equals, s.NextAvailableHandle(c, base))
+	c.Check(free.Type(), Equals, HandleTypePersistent)
+	c.Check(s.TPM.DoesHandleExist(free), internal_testutil.IsFalse)
+}
+
 func (s *capabilitiesSuite) TestDoesSavedSessionExistHMACSession(c *C) {
 	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
 	_, err := s.TPM.ContextSave(session)
@@ -392,6 +488,27 @@ func (s *capabilitiesSuite) TestDoesSavedSessionNotExistPolicySession(c *C) {
 	c.Check(s.TPM.DoesSavedSessionExist(0x03000010), internal_testutil.IsFalse)
 }
 
+func (s *capabilitiesSuite) TestActiveSessions(c *C) {
+	hmacSession := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	policySession := s.StartAuthSession(c, nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	savedSession := s.StartAuthSession(c, nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	_, err := s.TPM.ContextSave(savedSession)
+	c.Check(err, IsNil)
+
+	infos, err := s.TPM.ActiveSessions()
+	c.Check(err, IsNil)
+
+	savedHandle := (savedSession.Handle() & 0x00ffffff) | HandleTypeHMACSession.BaseHandle()
+	c.Check(infos, capsInclude, []SessionInfo{
+		{Handle: hmacSession.Handle(), Loaded: true, TypeKnown: true, Type: SessionTypeHMAC},
+		{Handle: policySession.Handle(), Loaded: true, TypeKnown: true, Type: SessionTypePolicy},
+		{Handle: savedHandle},
+	})
+	for _, info := range infos {
+		c.Check(info.Handle, Not(Equals), savedSession.Handle())
+	}
+}
+
 func (s *capabilitiesSuite) TestGetCapabilityPCRs(c *C) {
 	expected := PCRSelectionList{
 		{Hash: HashAlgorithmSHA1, Select: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}, SizeOfSelect: 3},
@@ -17,6 +17,16 @@ func (t *TPMContext) ReadClock(sessions ...SessionContext) (currentTime *TimeInf
 	return currentTime, nil
 }
 
+// ClockInfo executes the TPM2_ReadClock command and returns just the clock information, which
+// contains the current values of clock, reset and restart counts and the safe flag.
+func (t *TPMContext) ClockInfo(sessions ...SessionContext) (*ClockInfo, error) {
+	currentTime, err := t.ReadClock(sessions...)
+	if err != nil {
+		return nil, err
+	}
+	return &currentTime.ClockInfo, nil
+}
+
 // func (t *TPMContext) ClockSet(auth Handle, newTime uint64, authAuth interface{}) error {
 // }
 
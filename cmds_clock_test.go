@@ -0,0 +1,51 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type clockSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&clockSuite{})
+
+func (s *clockSuite) TestClockInfo(c *C) {
+	time, err := s.TPM.ReadClock()
+	c.Assert(err, IsNil)
+
+	info, err := s.TPM.ClockInfo()
+	c.Assert(err, IsNil)
+	c.Check(info.Clock >= time.ClockInfo.Clock, internal_testutil.IsTrue)
+	c.Check(info.ResetCount, Equals, time.ClockInfo.ResetCount)
+	c.Check(info.RestartCount, Equals, time.ClockInfo.RestartCount)
+	c.Check(info.Safe, Equals, time.ClockInfo.Safe)
+}
+
+func (s *clockSuite) TestPolicyCounterTimerSafe(c *C) {
+	info, err := s.TPM.ClockInfo()
+	c.Assert(err, IsNil)
+	if !info.Safe {
+		c.Skip("clock is not safe")
+	}
+
+	operandB, offset := (&TimeInfo{ClockInfo: ClockInfo{Safe: true}}).PolicyCounterTimerOperand(TimeInfoFieldSafe)
+	c.Check(operandB, DeepEquals, Operand{0x01})
+	c.Check(offset, Equals, uint16(24))
+
+	session := s.StartAuthSession(c, nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	c.Check(s.TPM.PolicyCounterTimer(session, operandB, offset, OpEq), IsNil)
+
+	session2 := s.StartAuthSession(c, nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	operandB, offset = (&TimeInfo{ClockInfo: ClockInfo{Safe: false}}).PolicyCounterTimerOperand(TimeInfoFieldSafe)
+	err = s.TPM.PolicyCounterTimer(session2, operandB, offset, OpEq)
+	c.Check(IsTPMError(err, ErrorPolicy, CommandPolicyCounterTimer), internal_testutil.IsTrue)
+}
@@ -6,6 +6,10 @@ package tpm2
 
 // Section 23 - Enhanced Authorization (EA) Commands
 
+import (
+	"fmt"
+)
+
 // PolicySigned executes the TPM2_PolicySigned command to include a signed authorization in a
 // policy. This is a combined assertion that binds a policy to the signing key associated with
 // authContext.
@@ -192,10 +196,31 @@ func (t *TPMContext) PolicyTicket(policySession SessionContext, timeout Timeout,
 // *[TPMParameterError] error with an error code of [ErrorValue] is returned without making any
 // changes to the session context.
 //
+// The TPM requires pHashList to contain between 2 and 8 digests, each of which must be the size of
+// the session's digest algorithm. This is checked before the command is executed, and an error is
+// returned if pHashList does not meet these constraints.
+//
 // On successful completion, the policy digest of the session context associated with policySession
 // is cleared, and then extended to include a digest of the concatenation of all of the digests
 // contained in pHashList.
 func (t *TPMContext) PolicyOR(policySession SessionContext, pHashList DigestList, sessions ...SessionContext) error {
+	if len(pHashList) < 2 || len(pHashList) > 8 {
+		return makeInvalidArgError("pHashList", fmt.Sprintf("invalid number of digests (got %d, expected between 2 and 8)", len(pHashList)))
+	}
+
+	var alg HashAlgorithmId
+	if policySession != nil {
+		alg = policySession.Params().HashAlg
+	}
+	for i, digest := range pHashList {
+		switch {
+		case alg.IsValid() && len(digest) != alg.Size():
+			return makeInvalidArgError("pHashList", fmt.Sprintf("invalid length for digest %d (got %d, expected %d)", i, len(digest), alg.Size()))
+		case len(digest) != len(pHashList[0]):
+			return makeInvalidArgError("pHashList", fmt.Sprintf("mismatched length for digest %d", i))
+		}
+	}
+
 	return t.StartCommand(CommandPolicyOR).
 		AddHandles(UseHandleContext(policySession)).
 		AddParams(pHashList).
@@ -328,8 +353,22 @@ func (t *TPMContext) PolicyCommandCode(policySession SessionContext, code Comman
 		Run(nil)
 }
 
-// func (t *TPMContext) PolicyPhysicalPresence(policySession HandleContext, sessions ...SessionContext) error {
-// }
+// PolicyPhysicalPresence executes the TPM2_PolicyPhysicalPresence command to bind the policy to
+// an assertion of physical presence on the platform. This is a deferred assertion. On successful
+// completion, the policy digest of the session context associated with policySession will be
+// extended to record that this assertion has been executed, and a flag will be set on the session
+// context to indicate that physical presence must be asserted when the session is used.
+//
+// This command succeeds regardless of whether physical presence is currently asserted. If
+// physical presence is not asserted when policySession is used for a subsequent authorization,
+// a *[TPMSessionError] error with an error code of [ErrorPP] will be returned from the command
+// that uses it.
+func (t *TPMContext) PolicyPhysicalPresence(policySession SessionContext, sessions ...SessionContext) error {
+	return t.StartCommand(CommandPolicyPhysicalPresence).
+		AddHandles(UseHandleContext(policySession)).
+		AddExtraSessions(sessions...).
+		Run(nil)
+}
 
 // PolicyCpHash executes the TPM2_PolicyCpHash command to bind a policy to a specific command and
 // set of command parameters. This is a deferred assertion.
@@ -535,8 +574,68 @@ func (t *TPMContext) PolicyNvWritten(policySession SessionContext, writtenSet bo
 		Run(nil)
 }
 
-// func (t *TPMContext) PolicyTemplate(policySession HandleContext, templateHash Digest, sessions ...SessionContext) error {
-// }
+// PolicyTemplate executes the TPM2_PolicyTemplate command to bind a policy to a specific
+// object template. This is a deferred assertion.
+//
+// This allows the policy to be limited to the creation of objects with a specific template
+// using [TPMContext.Create], [TPMContext.CreatePrimary] or [TPMContext.CreateLoaded]. The
+// template hash is the digest of the marshalled public area template, using the digest
+// algorithm for the session.
+//
+// If the size of templateHash is inconsistent with the digest algorithm for the session, a
+// *[TPMParameterError] error with an error code of [ErrorSize] will be returned.
+//
+// If the session associated with policySession already has a command parameter digest or name
+// digest defined, a *[TPMError] error with an error code of [ErrorCpHash] will be returned. If
+// the session already has a template digest defined, a *[TPMError] error with an error code of
+// [ErrorCpHash] will be returned if templateHash does not match the digest already recorded on
+// the session context.
+//
+// On successful completion, the policy digest of the session context associated with policySession
+// will be extended to include the value of templateHash, and the value of templateHash will be
+// recorded on the session context to limit usage of the session to the creation of objects with
+// the specific template.
+func (t *TPMContext) PolicyTemplate(policySession SessionContext, templateHash Digest, sessions ...SessionContext) error {
+	return t.StartCommand(CommandPolicyTemplate).
+		AddHandles(UseHandleContext(policySession)).
+		AddParams(templateHash).
+		AddExtraSessions(sessions...).
+		Run(nil)
+}
 
 // func (t *TPMContext) PolicyAuthorizeNV(authContext, nvIndex, policySession HandleContext, authContextAuth interface{}, sessions ...SessionContext) error {
 // }
+
+// PolicyParameters executes the TPM2_PolicyParameters command to bind a policy to a specific
+// command and set of command parameters, without being bound to the handles of the command.
+// This is a deferred assertion.
+//
+// [TPMContext.PolicyCpHash] allows the policy to be limited to a specific command, set of
+// command handles and set of command parameters. This command allows the policy to be limited to
+// a specific command and set of command parameters, regardless of the handles that the command
+// is used with.
+//
+// Parameter digests can be computed using [github.com/canonical/go-tpm2/policyutil.ComputeParametersHash],
+// using the digest algorithm for the session.
+//
+// This command was introduced in version 1.83 of the TPM 2.0 Library Specification, and will not
+// be supported by older TPMs.
+//
+// If the size of pHash is inconsistent with the digest algorithm for the session, a
+// *[TPMParameterError] error with an error code of [ErrorSize] will be returned.
+//
+// If the session associated with policySession already has a command parameter digest, name digest
+// or template digest defined, a *[TPMError] error with an error code of [ErrorCpHash] will be
+// returned.
+//
+// On successful completion, the policy digest of the session context associated with policySession
+// will be extended to include the value of pHash, and the value of pHash will be recorded on the
+// session context to limit usage of the session to the specific command and set of command
+// parameters.
+func (t *TPMContext) PolicyParameters(policySession SessionContext, pHash Digest, sessions ...SessionContext) error {
+	return t.StartCommand(CommandPolicyParameters).
+		AddHandles(UseHandleContext(policySession)).
+		AddParams(pHash).
+		AddExtraSessions(sessions...).
+		Run(nil)
+}
@@ -15,6 +15,7 @@ import (
 
 	. "github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
 	"github.com/canonical/go-tpm2/testutil"
 	"github.com/canonical/go-tpm2/util"
 )
@@ -508,6 +509,56 @@ func TestPolicyOR(t *testing.T) {
 	}
 }
 
+func TestPolicyORInvalidDigests(t *testing.T) {
+	tpm, _, closeTPM := testutil.NewTPMContextT(t, 0)
+	defer closeTPM()
+
+	sessionContext, err := tpm.StartAuthSession(nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("StartAuthSession failed: %v", err)
+	}
+	defer flushContext(t, tpm, sessionContext)
+
+	makeDigests := func(alg crypto.Hash, n int) (out DigestList) {
+		for i := 0; i < n; i++ {
+			out = append(out, make(Digest, alg.Size()))
+		}
+		return out
+	}
+
+	for _, data := range []struct {
+		desc      string
+		pHashList DigestList
+		err       string
+	}{
+		{
+			desc:      "TooFew",
+			pHashList: makeDigests(crypto.SHA256, 1),
+			err:       "invalid pHashList argument: invalid number of digests (got 1, expected between 2 and 8)",
+		},
+		{
+			desc:      "TooMany",
+			pHashList: makeDigests(crypto.SHA256, 9),
+			err:       "invalid pHashList argument: invalid number of digests (got 9, expected between 2 and 8)",
+		},
+		{
+			desc:      "WrongLength",
+			pHashList: append(makeDigests(crypto.SHA256, 2), make(Digest, crypto.SHA1.Size())),
+			err:       "invalid pHashList argument: invalid length for digest 2 (got 20, expected 32)",
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			err := tpm.PolicyOR(sessionContext, data.pHashList)
+			if err == nil {
+				t.Fatalf("PolicyOR should have failed")
+			}
+			if err.Error() != data.err {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 func TestPolicyPCR(t *testing.T) {
 	tpm, _, closeTPM := testutil.NewTPMContextT(t, testutil.TPMFeaturePCR|testutil.TPMFeatureNV)
 	defer closeTPM()
@@ -650,6 +701,35 @@ func TestPolicyCommandCode(t *testing.T) {
 	}
 }
 
+func TestPolicyPhysicalPresence(t *testing.T) {
+	tpm, _, closeTPM := testutil.NewTPMContextT(t, 0)
+	defer closeTPM()
+
+	h := crypto.SHA256.New()
+	h.Write(make([]byte, 32))
+	mu.MustMarshalToWriter(h, CommandPolicyPhysicalPresence)
+	expectedDigest := h.Sum(nil)
+
+	sessionContext, err := tpm.StartAuthSession(nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	if err != nil {
+		t.Fatalf("StartAuthSession failed: %v", err)
+	}
+	defer flushContext(t, tpm, sessionContext)
+
+	if err := tpm.PolicyPhysicalPresence(sessionContext); err != nil {
+		t.Fatalf("PolicyPhysicalPresence failed: %v", err)
+	}
+
+	digest, err := tpm.PolicyGetDigest(sessionContext)
+	if err != nil {
+		t.Fatalf("PolicyGetDigest failed: %v", err)
+	}
+
+	if !bytes.Equal(digest, expectedDigest) {
+		t.Errorf("Unexpected session digest")
+	}
+}
+
 func TestPolicyCpHash(t *testing.T) {
 	tpm, _, closeTPM := testutil.NewTPMContextT(t, 0)
 	defer closeTPM()
@@ -744,6 +824,56 @@ func TestPolicyNameHash(t *testing.T) {
 	}
 }
 
+func TestPolicyTemplate(t *testing.T) {
+	tpm, _, closeTPM := testutil.NewTPMContextT(t, 0)
+	defer closeTPM()
+
+	for _, data := range []struct {
+		desc     string
+		template *Public
+	}{
+		{
+			desc:     "Sealed",
+			template: objectutil.NewSealedObjectTemplate(),
+		},
+		{
+			desc:     "RSAStorage",
+			template: objectutil.NewRSAStorageKeyTemplate(),
+		},
+	} {
+		t.Run(data.desc, func(t *testing.T) {
+			h := crypto.SHA256.New()
+			mu.MustMarshalToWriter(h, data.template)
+			templateHash := h.Sum(nil)
+
+			h = crypto.SHA256.New()
+			h.Write(make([]byte, 32))
+			mu.MustMarshalToWriter(h, CommandPolicyTemplate)
+			h.Write(templateHash)
+			expectedDigest := h.Sum(nil)
+
+			sessionContext, err := tpm.StartAuthSession(nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+			if err != nil {
+				t.Fatalf("StartAuthSession failed: %v", err)
+			}
+			defer flushContext(t, tpm, sessionContext)
+
+			if err := tpm.PolicyTemplate(sessionContext, templateHash); err != nil {
+				t.Fatalf("PolicyTemplate failed: %v", err)
+			}
+
+			digest, err := tpm.PolicyGetDigest(sessionContext)
+			if err != nil {
+				t.Fatalf("PolicyGetDigest failed: %v", err)
+			}
+
+			if !bytes.Equal(digest, expectedDigest) {
+				t.Errorf("Unexpected session digest")
+			}
+		})
+	}
+}
+
 func TestPolicyDuplicationSelect(t *testing.T) {
 	tpm, _, closeTPM := testutil.NewTPMContextT(t, 0)
 	defer closeTPM()
@@ -1195,13 +1325,11 @@ func TestPolicyCounterTimer(t *testing.T) {
 		t.Fatalf("ReadClock failed: %v", err)
 	}
 
-	clock := make(Operand, binary.Size(time.ClockInfo.Clock))
-	binary.BigEndian.PutUint64(clock, time.ClockInfo.Clock+20000)
+	future := *time
+	future.ClockInfo.Clock += 20000
+	clock, clockOffset := future.PolicyCounterTimerOperand(TimeInfoFieldClock)
 
-	safe := make(Operand, binary.Size(time.ClockInfo.Safe))
-	if time.ClockInfo.Safe {
-		safe[0] = 0x01
-	}
+	safe, safeOffset := time.PolicyCounterTimerOperand(TimeInfoFieldSafe)
 
 	for _, data := range []struct {
 		desc      string
@@ -1212,13 +1340,13 @@ func TestPolicyCounterTimer(t *testing.T) {
 		{
 			desc:      "ClockLT",
 			operandB:  clock,
-			offset:    8,
+			offset:    clockOffset,
 			operation: OpUnsignedLT,
 		},
 		{
 			desc:      "Safe",
 			operandB:  safe,
-			offset:    24,
+			offset:    safeOffset,
 			operation: OpEq,
 		},
 	} {
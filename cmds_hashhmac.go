@@ -230,7 +230,7 @@ func (t *TPMContext) SequenceExecute(sequenceContext ResourceContext, buffer []b
 		hierarchy:       hierarchy,
 		tpm:             t}
 
-	if err := execMultipleHelper(c, sessionsCopy...); err != nil {
+	if err := execMultipleHelper(c, t.execContext.noAutoContinue, sessionsCopy...); err != nil {
 		return nil, nil, err
 	}
 
@@ -305,7 +305,7 @@ func (t *TPMContext) EventSequenceExecute(pcrContext, sequenceContext ResourceCo
 		buffer:          buffer,
 		tpm:             t}
 
-	if err := execMultipleHelper(c, sessionsCopy...); err != nil {
+	if err := execMultipleHelper(c, t.execContext.noAutoContinue, sessionsCopy...); err != nil {
 		return nil, err
 	}
 
@@ -200,11 +200,17 @@ func (t *TPMContext) CreatePrimary(primaryObject ResourceContext, inSensitive *S
 // If state is true, then authContext must correspond to [HandlePlatform]. Note that the platform
 // hierarchy can't be re-enabled by this command.
 func (t *TPMContext) HierarchyControl(authContext ResourceContext, enable Handle, state bool, authContextAuthSession SessionContext, sessions ...SessionContext) error {
-	return t.StartCommand(CommandHierarchyControl).
+	if err := t.StartCommand(CommandHierarchyControl).
 		AddHandles(UseResourceContextWithAuth(authContext, authContextAuthSession)).
 		AddParams(enable, state).
 		AddExtraSessions(sessions...).
-		Run(nil)
+		Run(nil); err != nil {
+		return err
+	}
+
+	// Disabling a hierarchy makes the NV indices associated with it inaccessible.
+	t.invalidateAllNVPublic()
+	return nil
 }
 
 // Clear executes the TPM2_Clear command to remove all context associated with the current owner.
@@ -232,6 +238,9 @@ func (t *TPMContext) Clear(authContext ResourceContext, authContextAuthSession S
 		return err
 	}
 
+	// The NV indices associated with the owner hierarchy have been removed.
+	t.invalidateAllNVPublic()
+
 	// Clear auth values for the owner, endorsement and lockout hierarchies. If the supplied session is not
 	// bound to authContext, the TPM will response with a HMAC generated with a key derived from the empty
 	// auth value.
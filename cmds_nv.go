@@ -7,9 +7,11 @@ package tpm2
 // Section 31 - Non-volatile Storage
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 
 	"github.com/canonical/go-tpm2/mu"
 )
@@ -96,11 +98,16 @@ import (
 //
 // On successful completion, the NV index will be defined.
 func (t *TPMContext) NVDefineSpaceRaw(authContext ResourceContext, auth Auth, publicInfo *NVPublic, authContextAuthSession SessionContext, sessions ...SessionContext) error {
-	return t.StartCommand(CommandNVDefineSpace).
+	if err := t.StartCommand(CommandNVDefineSpace).
 		AddHandles(UseResourceContextWithAuth(authContext, authContextAuthSession)).
 		AddParams(auth, mu.Sized(publicInfo)).
 		AddExtraSessions(sessions...).
-		Run(nil)
+		Run(nil); err != nil {
+		return err
+	}
+
+	t.invalidateNVPublic(publicInfo.Index)
+	return nil
 }
 
 // NVDefineSpace executes the TPM2_NV_DefineSpace command to reserve space to hold the data
@@ -238,6 +245,7 @@ func (t *TPMContext) NVUndefineSpace(authContext, nvIndex ResourceContext, authC
 		return err
 	}
 
+	t.invalidateNVPublic(nvIndex.Handle())
 	nvIndex.Dispose()
 	return nil
 }
@@ -267,19 +275,92 @@ func (t *TPMContext) NVUndefineSpaceSpecial(nvIndex, platform ResourceContext, n
 	nvIndex.SetAuthValue(nil)
 
 	err = r.Complete()
+	t.invalidateNVPublic(nvIndex.Handle())
 	nvIndex.Dispose()
 	return err
 }
 
+type nvPublicCacheEntry struct {
+	public *NVPublic
+	name   Name
+}
+
+// cachedNVPublic returns a copy of the cached public area for the NV index associated
+// with the supplied context, if there is one and its name matches the name of the
+// context.
+func (t *TPMContext) cachedNVPublic(nvIndex HandleContext) (*NVPublic, Name, bool) {
+	entry, exists := t.nvPublicCache[nvIndex.Handle()]
+	if !exists || !bytes.Equal(entry.name, nvIndex.Name()) {
+		return nil, nil, false
+	}
+
+	var public *NVPublic
+	mu.MustCopyValue(&public, entry.public)
+	return public, append(Name(nil), entry.name...), true
+}
+
+// addCachedNVPublic caches the public area for the NV index associated with the supplied
+// context, if the supplied name is consistent with it and matches the name of the
+// context. If the context has a name that doesn't match, the index has been redefined
+// or modified outside of this TPMContext, and any existing entry is discarded.
+func (t *TPMContext) addCachedNVPublic(nvIndex HandleContext, public *NVPublic, name Name) {
+	if !t.cacheNVPublic {
+		return
+	}
+	if nvIndex.Name().Type() != NameTypeDigest {
+		// Contexts without a digest name will never match a cached entry.
+		return
+	}
+	if !bytes.Equal(nvIndex.Name(), name) || public.Index != nvIndex.Handle() || !public.compareName(name) {
+		t.invalidateNVPublic(nvIndex.Handle())
+		return
+	}
+
+	entry := &nvPublicCacheEntry{name: append(Name(nil), name...)}
+	mu.MustCopyValue(&entry.public, public)
+	if t.nvPublicCache == nil {
+		t.nvPublicCache = make(map[Handle]*nvPublicCacheEntry)
+	}
+	t.nvPublicCache[nvIndex.Handle()] = entry
+}
+
+func (t *TPMContext) invalidateNVPublic(handle Handle) {
+	delete(t.nvPublicCache, handle)
+}
+
+func (t *TPMContext) invalidateAllNVPublic() {
+	t.nvPublicCache = nil
+}
+
 // NVReadPublic executes the TPM2_NV_ReadPublic command to read the public area of the NV index
 // associated with nvIndex.
+//
+// If caching has been enabled with [TPMContext.SetCacheNVPublic], the result is cached for the
+// handle and name of nvIndex. If nvIndex has a name that matches a cached result and no sessions
+// are supplied, the cached result is returned without
+// executing a command. A result is only cached if the returned name matches the name of
+// nvIndex, so a context with a stale name (eg, because the index was redefined) never matches
+// a cached result. Cached results are invalidated by functions on this TPMContext that define,
+// undefine or change the attributes of an index, such as [TPMContext.NVWrite] which sets the
+// [AttrNVWritten] attribute and therefore changes the name. Changes made to an index outside of
+// this TPMContext are not detected unless the name of nvIndex is also updated.
 func (t *TPMContext) NVReadPublic(nvIndex HandleContext, sessions ...SessionContext) (nvPublic *NVPublic, nvName Name, err error) {
+	if len(sessions) == 0 && nvIndex != nil {
+		if nvPublic, nvName, ok := t.cachedNVPublic(nvIndex); ok {
+			return nvPublic, nvName, nil
+		}
+	}
+
 	if err := t.StartCommand(CommandNVReadPublic).
 		AddHandles(UseHandleContext(nvIndex)).
 		AddExtraSessions(sessions...).
 		Run(nil, mu.Sized(&nvPublic), &nvName); err != nil {
 		return nil, nil, err
 	}
+
+	if nvIndex != nil {
+		t.addCachedNVPublic(nvIndex, nvPublic, nvName)
+	}
 	return nvPublic, nvName, nil
 }
 
@@ -329,6 +410,7 @@ func (t *TPMContext) NVWriteRaw(authContext, nvIndex ResourceContext, data MaxNV
 		return err
 	}
 
+	t.invalidateNVPublic(nvIndex.Handle())
 	if nv, isNv := nvIndex.(NVIndexContext); isNv {
 		nv.SetAttr(AttrNVWritten)
 	}
@@ -419,7 +501,136 @@ func (t *TPMContext) NVWrite(authContext, nvIndex ResourceContext, data []byte,
 		offset:      offset,
 		tpm:         t}
 
-	return execMultipleHelper(context, sessionsCopy...)
+	return execMultipleHelper(context, t.execContext.noAutoContinue, sessionsCopy...)
+}
+
+type nvWriteFromHelperContext struct {
+	authContext ResourceContext
+	nvIndex     ResourceContext
+	r           io.Reader
+	offset      uint16
+	tpm         *TPMContext
+
+	space   uint16 // space in the index for data that hasn't been read yet
+	eof     bool
+	current []byte
+	next    []byte
+
+	total uint16
+}
+
+func (c *nvWriteFromHelperContext) read() ([]byte, error) {
+	if c.eof || c.space == 0 {
+		return nil, nil
+	}
+
+	sz := c.space
+	if sz > c.tpm.properties.maxNVBufferSize {
+		sz = c.tpm.properties.maxNVBufferSize
+	}
+
+	data := make([]byte, sz)
+	n, err := io.ReadFull(c.r, data)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		c.eof = true
+	case err != nil:
+		return nil, fmt.Errorf("cannot read data: %w", err)
+	}
+
+	c.space -= uint16(n)
+	return data[:n], nil
+}
+
+func (c *nvWriteFromHelperContext) last() bool {
+	return len(c.next) == 0
+}
+
+func (c *nvWriteFromHelperContext) run(sessions ...SessionContext) error {
+	if err := c.tpm.NVWriteRaw(c.authContext, c.nvIndex, c.current, c.offset+c.total, sessions[0], sessions[1:]...); err != nil {
+		return err
+	}
+	c.total += uint16(len(c.current))
+
+	c.current = c.next
+	if len(c.current) == 0 {
+		return nil
+	}
+
+	var err error
+	c.next, err = c.read()
+	return err
+}
+
+// NVWriteFrom is a version of [TPMContext.NVWrite] that writes data read from the supplied reader
+// to the NV index associated with nvIndex, starting at the specified offset. Data is read in
+// chunks of up to the maximum size supported by a single TPM2_NV_Write command, and no more than
+// two chunks are buffered at any time, so the whole payload doesn't need to be held in memory.
+// Writing stops when the reader returns [io.EOF] or when the end of the index is
+// reached, whichever happens first. Short reads are handled by reading more data until each
+// chunk is full.
+//
+// The public area of the index is read with [TPMContext.NVReadPublic] in order to determine its
+// size, using the supplied sessions. As TPM2_NV_ReadPublic has no command parameters, the
+// [AttrCommandEncrypt] attribute is excluded from these sessions for this command. The
+// [AttrContinueSession] attribute is included for this command so that the sessions remain
+// loaded for the subsequent TPM2_NV_Write commands. See the
+// documentation for [TPMContext.NVWrite] for details about authorization.
+//
+// If more than one TPM2_NV_Write command is required, authContextAuthSession must not be a policy
+// session. If the index has the [AttrNVWriteAll] attribute set, all of the data must be written
+// with a single command.
+//
+// This returns the number of bytes that were written to the index. If an error occurs, either
+// when reading from the supplied reader or when executing a TPM2_NV_Write command, the returned
+// count indicates how many bytes from the start of the supplied offset were successfully written
+// to the index, and the rest of the index is left unmodified.
+func (t *TPMContext) NVWriteFrom(authContext, nvIndex ResourceContext, r io.Reader, offset uint16, authContextAuthSession SessionContext, sessions ...SessionContext) (written uint16, err error) {
+	if err := t.initPropertiesIfNeeded(); err != nil {
+		return 0, err
+	}
+
+	var readPublicSessions []SessionContext
+	for _, session := range sessions {
+		if session != nil {
+			session = session.IncludeAttrs(AttrContinueSession).ExcludeAttrs(AttrCommandEncrypt)
+		}
+		readPublicSessions = append(readPublicSessions, session)
+	}
+
+	pub, _, err := t.NVReadPublic(nvIndex, readPublicSessions...)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read public area of index: %w", err)
+	}
+	if offset > pub.Size {
+		return 0, errors.New("offset is outside of the bounds of the index")
+	}
+
+	context := &nvWriteFromHelperContext{
+		authContext: authContext,
+		nvIndex:     nvIndex,
+		r:           r,
+		offset:      offset,
+		tpm:         t,
+		space:       pub.Size - offset}
+
+	context.current, err = context.read()
+	if err != nil {
+		return 0, err
+	}
+	if len(context.current) == 0 {
+		return 0, nil
+	}
+	context.next, err = context.read()
+	if err != nil {
+		return 0, err
+	}
+
+	sessionsCopy := []SessionContext{authContextAuthSession}
+	sessionsCopy = append(sessionsCopy, sessions...)
+
+	err = execMultipleHelper(context, t.execContext.noAutoContinue, sessionsCopy...)
+	return context.total, err
 }
 
 // NVSetPinCounterParams is a convenience function for [TPMContext.NVWrite] for updating the
@@ -499,6 +710,7 @@ func (t *TPMContext) NVIncrement(authContext, nvIndex ResourceContext, authConte
 		return err
 	}
 
+	t.invalidateNVPublic(nvIndex.Handle())
 	if nv, isNv := nvIndex.(NVIndexContext); isNv {
 		nv.SetAttr(AttrNVWritten)
 	}
@@ -531,10 +743,83 @@ func (t *TPMContext) NVIncrement(authContext, nvIndex ResourceContext, authConte
 // If the type of the index is not [NVTypeExtend], a *TPMHandleError error with an error code of
 // [ErrorAttributes] will be returned for handle index 2.
 //
+// If data is larger than the maximum size of a NV buffer supported by the TPM (see
+// [TPMContext.GetNVMaxBufferSize]), an error is returned without executing any commands. Use
+// [TPMContext.NVExtendChunked] to extend larger data across multiple commands.
+//
 // On successful completion, the [AttrNVWritten] flag will be set if this is the first time that
 // the index has been written to. If nvIndex can be type asserted to [NVIndexContext], the name of
 // nvIndex will be updated accordingly.
 func (t *TPMContext) NVExtend(authContext, nvIndex ResourceContext, data MaxNVBuffer, authContextAuthSession SessionContext, sessions ...SessionContext) error {
+	if err := t.initPropertiesIfNeeded(); err != nil {
+		return err
+	}
+	if len(data) > int(t.properties.maxNVBufferSize) {
+		return makeInvalidArgError("data", fmt.Sprintf("size (%d) is larger than the maximum NV buffer size (%d)", len(data), t.properties.maxNVBufferSize))
+	}
+
+	return t.nvExtend(authContext, nvIndex, data, authContextAuthSession, sessions...)
+}
+
+// NVExtendChunked is a variant of [TPMContext.NVExtend] that splits data that is larger than
+// the maximum size of a NV buffer supported by the TPM (see [TPMContext.GetNVMaxBufferSize])
+// into chunks, and extends each chunk using a separate TPM2_NV_Extend command. Data that fits
+// in to a single command is extended in the same way as NVExtend.
+//
+// WARNING: When more than one command is required, the final value of the index is
+// H(...H(H(value || chunk1) || chunk2)... || chunkN), which is NOT the same as H(value || data),
+// the value that would be obtained by extending all of data in a single operation. Anything that
+// predicts the value of the index, such as a TPM2_PolicyNV assertion, must replay the extend in
+// the same way.
+//
+// If more than one TPM2_NV_Extend command is required, any SessionContext instances provided
+// should have the [AttrContinueSession] attribute defined and authContextAuthSession must not be
+// a policy session.
+func (t *TPMContext) NVExtendChunked(authContext, nvIndex ResourceContext, data []byte, authContextAuthSession SessionContext, sessions ...SessionContext) error {
+	if err := t.initPropertiesIfNeeded(); err != nil {
+		return err
+	}
+
+	sessionsCopy := []SessionContext{authContextAuthSession}
+	sessionsCopy = append(sessionsCopy, sessions...)
+
+	context := &nvExtendHelperContext{
+		authContext: authContext,
+		nvIndex:     nvIndex,
+		data:        data,
+		tpm:         t}
+
+	return execMultipleHelper(context, t.execContext.noAutoContinue, sessionsCopy...)
+}
+
+type nvExtendHelperContext struct {
+	authContext ResourceContext
+	nvIndex     ResourceContext
+	data        []byte
+	tpm         *TPMContext
+
+	total int
+}
+
+func (c *nvExtendHelperContext) last() bool {
+	return len(c.data[c.total:]) <= int(c.tpm.properties.maxNVBufferSize)
+}
+
+func (c *nvExtendHelperContext) run(sessions ...SessionContext) error {
+	d := c.data[c.total:]
+	if len(d) > int(c.tpm.properties.maxNVBufferSize) {
+		d = d[:c.tpm.properties.maxNVBufferSize]
+	}
+
+	if err := c.tpm.nvExtend(c.authContext, c.nvIndex, d, sessions[0], sessions[1:]...); err != nil {
+		return err
+	}
+
+	c.total += len(d)
+	return nil
+}
+
+func (t *TPMContext) nvExtend(authContext, nvIndex ResourceContext, data MaxNVBuffer, authContextAuthSession SessionContext, sessions ...SessionContext) error {
 	if err := t.StartCommand(CommandNVExtend).
 		AddHandles(UseResourceContextWithAuth(authContext, authContextAuthSession), UseHandleContext(nvIndex)).
 		AddParams(data).
@@ -543,6 +828,7 @@ func (t *TPMContext) NVExtend(authContext, nvIndex ResourceContext, data MaxNVBu
 		return err
 	}
 
+	t.invalidateNVPublic(nvIndex.Handle())
 	if nv, isNv := nvIndex.(NVIndexContext); isNv {
 		nv.SetAttr(AttrNVWritten)
 	}
@@ -587,6 +873,7 @@ func (t *TPMContext) NVSetBits(authContext, nvIndex ResourceContext, bits uint64
 		return err
 	}
 
+	t.invalidateNVPublic(nvIndex.Handle())
 	if nv, isNv := nvIndex.(NVIndexContext); isNv {
 		nv.SetAttr(AttrNVWritten)
 	}
@@ -629,6 +916,7 @@ func (t *TPMContext) NVWriteLock(authContext, nvIndex ResourceContext, authConte
 		return err
 	}
 
+	t.invalidateNVPublic(nvIndex.Handle())
 	if nv, isNv := nvIndex.(NVIndexContext); isNv {
 		nv.SetAttr(AttrNVWriteLocked)
 	}
@@ -648,10 +936,15 @@ func (t *TPMContext) NVWriteLock(authContext, nvIndex ResourceContext, authConte
 // ResourceContext instances associated with NV indices that are updated as a consequence of this
 // function will no longer be able to be used because the name will be incorrect.
 func (t *TPMContext) NVGlobalWriteLock(authContext ResourceContext, authContextAuthSession SessionContext, sessions ...SessionContext) error {
-	return t.StartCommand(CommandNVGlobalWriteLock).
+	if err := t.StartCommand(CommandNVGlobalWriteLock).
 		AddHandles(UseResourceContextWithAuth(authContext, authContextAuthSession)).
 		AddExtraSessions(sessions...).
-		Run(nil)
+		Run(nil); err != nil {
+		return err
+	}
+
+	t.invalidateAllNVPublic()
+	return nil
 }
 
 // NVReadRaw executes the TPM2_NV_Read command to read the contents of the NV index associated with
@@ -791,7 +1084,7 @@ func (t *TPMContext) NVRead(authContext, nvIndex ResourceContext, size, offset u
 		offset:      offset,
 		tpm:         t}
 
-	if err := execMultipleHelper(context, sessionsCopy...); err != nil {
+	if err := execMultipleHelper(context, t.execContext.noAutoContinue, sessionsCopy...); err != nil {
 		return nil, err
 	}
 	return context.data, nil
@@ -887,6 +1180,58 @@ func (t *TPMContext) NVReadCounter(authContext, nvIndex ResourceContext, authCon
 	return t.nvReadUint64(authContext, nvIndex, authContextAuthSession, sessions...)
 }
 
+// NVReadExtend is a convenience function for [TPMContext.NVRead] for reading the current digest
+// of the NV extend index associated with nvIndex. The size of the digest is determined by the
+// name algorithm of the index. If the type of nvIndex is not [NVTypeExtend], an error will be
+// returned. This will return an error if nvIndex cannot be type asserted to [NVIndexContext].
+//
+// The command requires authorization, defined by the state of the [AttrNVPPRead],
+// [AttrNVOwnerRead], [AttrNVAuthRead] and [AttrNVPolicyRead] attributes. The handle used for
+// authorization is specified via authContext. If the NV index has the [AttrNVPPRead] attribute,
+// authorization can be satisfied with [HandlePlatform]. If the NV index has the [AttrNVOwnerRead]
+// attribute, authorization can be satisfied with [HandleOwner]. If the NV index has the
+// [AttrNVAuthRead] or [AttrNVPolicyRead] attribute, authorization can be satisfied with nvIndex.
+// The command requires authorization with the user auth role for authContext, with session based
+// authorization provided via authContextAuthSession. If the resource associated with authContext
+// is not permitted to authorize this access, a *[TPMError] error with an error code of
+// [ErrorNVAuthorization] will be returned.
+//
+// If nvIndex is being used for authorization and the [AttrNVAuthRead] attribute is defined, the
+// authorization can be satisfied by demonstrating knowledge of the authorization value, either via
+// cleartext or HMAC authorization. If nvIndex is being used for authorization and the
+// [AttrNVPolicyRead] attribute is defined, the authorization can be satisfied using a policy
+// session with a digest that matches the authorization policy for the index.
+//
+// If the index has the [AttrNVReadLocked] attribute set, a *[TPMError] error with an error code of
+// [ErrorNVLocked] will be returned.
+//
+// If the index has not been initialized (ie, the [AttrNVWritten] attribute is not set), a
+// *[TPMError] error with an error code of [ErrorNVUninitialized] will be returned.
+//
+// On successful completion, the current digest will be returned.
+func (t *TPMContext) NVReadExtend(authContext, nvIndex ResourceContext, authContextAuthSession SessionContext, sessions ...SessionContext) (Digest, error) {
+	context, isNv := nvIndex.(NVIndexContext)
+	if !isNv {
+		return nil, errors.New("nvIndex does not correspond to a NV index")
+	}
+	if context.Type() != NVTypeExtend {
+		return nil, errors.New("nvIndex does not correspond to an extend index")
+	}
+	alg := nvIndex.Name().Algorithm()
+	if !alg.IsValid() {
+		return nil, errors.New("nvIndex has an invalid name algorithm")
+	}
+
+	data, err := t.NVRead(authContext, nvIndex, uint16(alg.Size()), 0, authContextAuthSession, sessions...)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != alg.Size() {
+		return nil, &InvalidResponseError{CommandNVRead, fmt.Errorf("unexpected number of bytes returned (got %d)", len(data))}
+	}
+	return data, nil
+}
+
 // NVReadPinCounterParams is a convenience function for [TPMContext.NVRead] for reading the
 // contents of the NV pin pass or NV pin fail index associated with nvIndex. If the type of nvIndex
 // is not [NVTypePinPass] or [NVTypePinFail], an error will be returned. This will return an error
@@ -969,6 +1314,7 @@ func (t *TPMContext) NVReadLock(authContext, nvIndex ResourceContext, authContex
 		return err
 	}
 
+	t.invalidateNVPublic(nvIndex.Handle())
 	if nv, isNv := nvIndex.(NVIndexContext); isNv {
 		nv.SetAttr(AttrNVReadLocked)
 	}
@@ -5,9 +5,14 @@
 package tpm2_test
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
 	"testing"
+	"testing/iotest"
 
 	. "gopkg.in/check.v1"
 
@@ -256,6 +261,108 @@ func (s *nvSuite) TestWriteZeroSized(c *C) {
 	c.Check(index.Name(), DeepEquals, name)
 }
 
+func (s *nvSuite) TestReadPublicCached(c *C) {
+	s.TPM.SetCacheNVPublic(true)
+	defer s.TPM.SetCacheNVPublic(false)
+
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	pub1, name1, err := s.TPM.NVReadPublic(index)
+	c.Assert(err, IsNil)
+
+	s.ForgetCommands()
+
+	pub2, name2, err := s.TPM.NVReadPublic(index)
+	c.Assert(err, IsNil)
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 0)
+	c.Check(pub2, DeepEquals, pub1)
+	c.Check(name2, DeepEquals, name1)
+
+	// A context without the name of the index doesn't use the cache.
+	_, name3, err := s.TPM.NVReadPublic(NewHandleContext(pub.Index))
+	c.Assert(err, IsNil)
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 1)
+	c.Check(name3, DeepEquals, name1)
+}
+
+func (s *nvSuite) TestReadPublicNotCachedByDefault(c *C) {
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	_, _, err := s.TPM.NVReadPublic(index)
+	c.Assert(err, IsNil)
+
+	s.ForgetCommands()
+
+	_, _, err = s.TPM.NVReadPublic(index)
+	c.Assert(err, IsNil)
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 1)
+}
+
+func (s *nvSuite) TestReadPublicCacheInvalidatedByWrite(c *C) {
+	s.TPM.SetCacheNVPublic(true)
+	defer s.TPM.SetCacheNVPublic(false)
+
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	origPub, origName, err := s.TPM.NVReadPublic(index)
+	c.Assert(err, IsNil)
+	c.Check(origPub.Attrs&AttrNVWritten, Equals, NVAttributes(0))
+
+	c.Check(s.TPM.NVWrite(index, index, []byte("foo"), 0, nil), IsNil)
+
+	s.ForgetCommands()
+
+	updatedPub, name, err := s.TPM.NVReadPublic(index)
+	c.Assert(err, IsNil)
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 1)
+	c.Check(updatedPub.Attrs&AttrNVWritten, Equals, AttrNVWritten)
+	c.Check(name, Not(DeepEquals), origName)
+	c.Check(name, DeepEquals, index.Name())
+}
+
+func (s *nvSuite) TestReadPublicCacheInvalidatedByUndefine(c *C) {
+	s.TPM.SetCacheNVPublic(true)
+	defer s.TPM.SetCacheNVPublic(false)
+
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	_, origName, err := s.TPM.NVReadPublic(index)
+	c.Assert(err, IsNil)
+
+	c.Check(s.TPM.NVUndefineSpace(s.TPM.OwnerHandleContext(), index, nil), IsNil)
+
+	// Redefine the index with the same public area, and read it with a
+	// context that has the same name.
+	index = s.NVDefineSpace(c, HandleOwner, nil, pub)
+	c.Check(index.Name(), DeepEquals, origName)
+
+	s.ForgetCommands()
+
+	_, _, err = s.TPM.NVReadPublic(index)
+	c.Check(err, IsNil)
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 1)
+}
+
 type testNVWriteAndReadData struct {
 	size uint16
 
@@ -356,6 +463,241 @@ func (s *nvSuite) TestWriteAndReadLargerThanNVBufferMax(c *C) {
 		expected:  data})
 }
 
+type testNVWriteFromData struct {
+	size   uint16
+	r      io.Reader
+	offset uint16
+
+	expectedWritten uint16
+	expectedCmds    int
+	expected        []byte
+}
+
+func (s *nvSuite) testWriteFrom(c *C, data *testNVWriteFromData) {
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    data.size}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+	s.ForgetCommands()
+
+	written, err := s.TPM.NVWriteFrom(index, index, data.r, data.offset, nil)
+	c.Check(err, IsNil)
+	c.Check(written, Equals, data.expectedWritten)
+
+	n := 0
+	for _, cmd := range s.CommandLog() {
+		if cmd.GetCommandCode(c) == CommandNVWrite {
+			n++
+		}
+	}
+	c.Check(n, Equals, data.expectedCmds)
+
+	b, err := s.TPM.NVRead(index, index, data.size, 0, nil)
+	c.Check(err, IsNil)
+	c.Check(b, DeepEquals, data.expected)
+}
+
+func (s *nvSuite) TestWriteFrom(c *C) {
+	s.testWriteFrom(c, &testNVWriteFromData{
+		size:            8,
+		r:               bytes.NewReader([]byte("zyxwvuts")),
+		expectedWritten: 8,
+		expectedCmds:    1,
+		expected:        []byte("zyxwvuts")})
+}
+
+func (s *nvSuite) TestWriteFromWithOffset(c *C) {
+	s.testWriteFrom(c, &testNVWriteFromData{
+		size:            8,
+		r:               bytes.NewReader([]byte("abcd")),
+		offset:          2,
+		expectedWritten: 4,
+		expectedCmds:    1,
+		expected:        []byte("\xff\xffabcd\xff\xff")})
+}
+
+func (s *nvSuite) TestWriteFromStopsAtIndexSize(c *C) {
+	s.testWriteFrom(c, &testNVWriteFromData{
+		size:            8,
+		r:               bytes.NewReader([]byte("zyxwvutsrqponm")),
+		offset:          2,
+		expectedWritten: 6,
+		expectedCmds:    1,
+		expected:        []byte("\xff\xffzyxwvu")})
+}
+
+func (s *nvSuite) TestWriteFromLargerThanNVBufferMaxShortReads(c *C) {
+	bufferMax, err := s.TPM.GetNVBufferMax()
+	c.Check(err, IsNil)
+
+	indexMax, err := s.TPM.GetNVIndexMax()
+	c.Check(err, IsNil)
+
+	if indexMax <= bufferMax {
+		c.Skip("TPM_PT_NV_INDEX_MAX not larger than TPM_PT_NV_BUFFER_MAX")
+	}
+
+	data := make([]byte, indexMax)
+	rand.Read(data)
+
+	s.testWriteFrom(c, &testNVWriteFromData{
+		size:            uint16(indexMax),
+		r:               iotest.OneByteReader(bytes.NewReader(data)),
+		expectedWritten: uint16(indexMax),
+		expectedCmds:    (indexMax + bufferMax - 1) / bufferMax,
+		expected:        data})
+}
+
+func (s *nvSuite) TestWriteFromEmpty(c *C) {
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	written, err := s.TPM.NVWriteFrom(index, index, bytes.NewReader(nil), 0, nil)
+	c.Check(err, IsNil)
+	c.Check(written, Equals, uint16(0))
+	c.Check(index.(*NvIndexContextImpl).Public().Attrs&AttrNVWritten, Equals, NVAttributes(0))
+}
+
+func (s *nvSuite) TestWriteFromReaderError(c *C) {
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	r := io.MultiReader(bytes.NewReader([]byte("abcd")), iotest.ErrReader(errors.New("some error")))
+	written, err := s.TPM.NVWriteFrom(index, index, r, 0, nil)
+	c.Check(err, ErrorMatches, `cannot read data: some error`)
+	c.Check(written, Equals, uint16(0))
+
+	// The index should not have been written.
+	_, err = s.TPM.NVRead(index, index, 8, 0, nil)
+	c.Check(IsTPMError(err, ErrorNVUninitialized, CommandNVRead), internal_testutil.IsTrue)
+}
+
+func (s *nvSuite) TestWriteFromReaderErrorPartial(c *C) {
+	bufferMax, err := s.TPM.GetNVBufferMax()
+	c.Check(err, IsNil)
+
+	indexMax, err := s.TPM.GetNVIndexMax()
+	c.Check(err, IsNil)
+
+	if indexMax <= bufferMax*2 {
+		c.Skip("TPM_PT_NV_INDEX_MAX not larger than 2 * TPM_PT_NV_BUFFER_MAX")
+	}
+
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    uint16(indexMax)}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	data := make([]byte, bufferMax*2)
+	rand.Read(data)
+
+	// The first chunk is written before the error is encountered when reading
+	// the third chunk.
+	r := io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errors.New("some error")))
+	written, err := s.TPM.NVWriteFrom(index, index, r, 0, nil)
+	c.Check(err, ErrorMatches, `cannot read data: some error`)
+	c.Check(written, Equals, uint16(bufferMax))
+
+	b, err := s.TPM.NVRead(index, index, uint16(bufferMax), 0, nil)
+	c.Check(err, IsNil)
+	c.Check(b, DeepEquals, data[:bufferMax])
+}
+
+func (s *nvSuite) TestWriteFromUsesSessionsForReadPublic(c *C) {
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	session := s.StartAuthSession(c, primary, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256).WithAttrs(AttrContinueSession | AttrCommandEncrypt)
+	s.ForgetCommands()
+
+	written, err := s.TPM.NVWriteFrom(index, index, bytes.NewReader([]byte("abcd")), 0, nil, session)
+	c.Check(err, IsNil)
+	c.Check(written, Equals, uint16(4))
+
+	var readPublics int
+	for _, cmd := range s.CommandLog() {
+		if cmd.GetCommandCode(c) != CommandNVReadPublic {
+			continue
+		}
+		readPublics++
+
+		_, authArea, _ := cmd.UnmarshalCommand(c)
+		c.Assert(authArea, internal_testutil.LenEquals, 1)
+		c.Check(authArea[0].SessionHandle, Equals, session.Handle())
+		c.Check(authArea[0].SessionAttributes&AttrCommandEncrypt, Equals, SessionAttributes(0))
+	}
+	c.Check(readPublics, Equals, 1)
+
+	b, err := s.TPM.NVRead(index, index, 4, 0, nil)
+	c.Check(err, IsNil)
+	c.Check(b, DeepEquals, []byte("abcd"))
+}
+
+func (s *nvSuite) TestWriteFromWithNonContinueSession(c *C) {
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	c.Assert(session.Attrs()&AttrContinueSession, Equals, SessionAttributes(0))
+	s.ForgetCommands()
+
+	// The session must not be flushed by TPM2_NV_ReadPublic.
+	written, err := s.TPM.NVWriteFrom(index, index, bytes.NewReader([]byte("abcd")), 0, nil, session)
+	c.Check(err, IsNil)
+	c.Check(written, Equals, uint16(4))
+
+	for _, cmd := range s.CommandLog() {
+		if cmd.GetCommandCode(c) != CommandNVReadPublic {
+			continue
+		}
+
+		_, authArea, _ := cmd.UnmarshalCommand(c)
+		c.Assert(authArea, internal_testutil.LenEquals, 1)
+		c.Check(authArea[0].SessionHandle, Equals, session.Handle())
+		c.Check(authArea[0].SessionAttributes&AttrContinueSession, Equals, AttrContinueSession)
+	}
+
+	// The session is flushed after the final TPM2_NV_Write command.
+	c.Check(s.TPM.DoesHandleExist(session.Handle()), internal_testutil.IsFalse)
+
+	b, err := s.TPM.NVRead(index, index, 4, 0, nil)
+	c.Check(err, IsNil)
+	c.Check(b, DeepEquals, []byte("abcd"))
+}
+
+func (s *nvSuite) TestWriteFromOffsetOutOfBounds(c *C) {
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	_, err := s.TPM.NVWriteFrom(index, index, bytes.NewReader([]byte("abcd")), 9, nil)
+	c.Check(err, ErrorMatches, `offset is outside of the bounds of the index`)
+}
+
 func (s *nvSuite) testIncrementAndRead(c *C, authSession SessionContext) {
 	s.RequireCommand(c, CommandNVIncrement)
 
@@ -453,6 +795,168 @@ func (s *nvSuite) TestExtendWithAuthSession(c *C) {
 		authSession: s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)})
 }
 
+type testNVExtendAndReadData struct {
+	nameAlg     HashAlgorithmId
+	data        [][]byte
+	chunked     bool
+	authSession SessionContext
+}
+
+func (s *nvSuite) testExtendAndRead(c *C, data *testNVExtendAndReadData) {
+	s.RequireCommand(c, CommandNVExtend)
+
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: data.nameAlg,
+		Attrs:   NVTypeExtend.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    uint16(data.nameAlg.Size())}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	maxSize, err := s.TPM.GetNVMaxBufferSize()
+	c.Assert(err, IsNil)
+
+	sessionHandle := authSessionHandle(data.authSession)
+
+	expected := make([]byte, data.nameAlg.Size())
+	for _, d := range data.data {
+		if data.chunked {
+			c.Check(s.TPM.NVExtendChunked(index, index, d, data.authSession), IsNil)
+		} else {
+			c.Check(s.TPM.NVExtend(index, index, d, data.authSession), IsNil)
+		}
+
+		// Replay the extend locally. Data that doesn't fit in to a single
+		// command is extended in chunks.
+		for len(d) > 0 {
+			chunk := d
+			if len(chunk) > int(maxSize) {
+				chunk = chunk[:maxSize]
+			}
+			d = d[len(chunk):]
+
+			h := data.nameAlg.NewHash()
+			h.Write(expected)
+			h.Write(chunk)
+			expected = h.Sum(nil)
+		}
+	}
+
+	value, err := s.TPM.NVReadExtend(index, index, data.authSession)
+	c.Check(err, IsNil)
+	c.Check(value, DeepEquals, Digest(expected))
+
+	_, authArea, _ := s.LastCommand(c).UnmarshalCommand(c)
+	c.Assert(authArea, internal_testutil.LenEquals, 1)
+	c.Check(authArea[0].SessionHandle, Equals, sessionHandle)
+}
+
+func (s *nvSuite) TestExtendAndRead(c *C) {
+	s.testExtendAndRead(c, &testNVExtendAndReadData{
+		nameAlg: HashAlgorithmSHA256,
+		data:    [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}})
+}
+
+func (s *nvSuite) TestExtendAndReadSHA1(c *C) {
+	s.testExtendAndRead(c, &testNVExtendAndReadData{
+		nameAlg: HashAlgorithmSHA1,
+		data:    [][]byte{[]byte("foo"), []byte("bar")}})
+}
+
+func (s *nvSuite) TestExtendAndReadLargerThanNVBufferMax(c *C) {
+	s.testExtendAndRead(c, &testNVExtendAndReadData{
+		nameAlg: HashAlgorithmSHA256,
+		data:    [][]byte{[]byte("foo"), bytes.Repeat([]byte{0x5a}, 2000)},
+		chunked: true})
+}
+
+func (s *nvSuite) TestExtendAndReadChunked(c *C) {
+	s.testExtendAndRead(c, &testNVExtendAndReadData{
+		nameAlg: HashAlgorithmSHA256,
+		data:    [][]byte{[]byte("foo"), []byte("bar")},
+		chunked: true})
+}
+
+func (s *nvSuite) TestExtendAndReadWithAuthSession(c *C) {
+	s.testExtendAndRead(c, &testNVExtendAndReadData{
+		nameAlg:     HashAlgorithmSHA256,
+		data:        [][]byte{[]byte("foo"), bytes.Repeat([]byte{0x5a}, 2000)},
+		chunked:     true,
+		authSession: s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256).WithAttrs(AttrContinueSession)})
+}
+
+func (s *nvSuite) TestExtendLargerThanNVBufferMaxDiffersFromSingleExtend(c *C) {
+	s.RequireCommand(c, CommandNVExtend)
+
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeExtend.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    uint16(HashAlgorithmSHA256.Size())}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	maxSize, err := s.TPM.GetNVMaxBufferSize()
+	c.Assert(err, IsNil)
+
+	data := bytes.Repeat([]byte{0x5a}, int(maxSize)+1)
+	c.Check(s.TPM.NVExtendChunked(index, index, data, nil), IsNil)
+
+	value, err := s.TPM.NVReadExtend(index, index, nil)
+	c.Check(err, IsNil)
+
+	// The value of the index is the result of extending each chunk in turn.
+	h := crypto.SHA256.New()
+	h.Write(make([]byte, 32))
+	h.Write(data[:maxSize])
+	chunked := h.Sum(nil)
+	h = crypto.SHA256.New()
+	h.Write(chunked)
+	h.Write(data[maxSize:])
+	chunked = h.Sum(nil)
+	c.Check(value, DeepEquals, Digest(chunked))
+
+	// This is not the same as the result of extending all of the data at once.
+	h = crypto.SHA256.New()
+	h.Write(make([]byte, 32))
+	h.Write(data)
+	single := h.Sum(nil)
+	c.Check(value, Not(DeepEquals), Digest(single))
+}
+
+func (s *nvSuite) TestExtendLargerThanNVBufferMax(c *C) {
+	s.RequireCommand(c, CommandNVExtend)
+
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeExtend.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    uint16(HashAlgorithmSHA256.Size())}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	maxSize, err := s.TPM.GetNVMaxBufferSize()
+	c.Assert(err, IsNil)
+
+	s.ForgetCommands()
+
+	// Data that doesn't fit in to a single command isn't silently chunked.
+	data := bytes.Repeat([]byte{0x5a}, int(maxSize)+1)
+	err = s.TPM.NVExtend(index, index, data, nil)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`invalid data argument: size \(%d\) is larger than the maximum NV buffer size \(%d\)`, maxSize+1, maxSize))
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 0)
+	c.Check(index.(*NvIndexContextImpl).Public().Attrs&AttrNVWritten, Equals, NVAttributes(0))
+}
+
+func (s *nvSuite) TestReadExtendWrongType(c *C) {
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeCounter.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead | AttrNVNoDA),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, nil, pub)
+
+	_, err := s.TPM.NVReadExtend(index, index, nil)
+	c.Check(err, ErrorMatches, `nvIndex does not correspond to an extend index`)
+}
+
 type testNVSetBitsAndReadData struct {
 	bits        []uint64
 	authSession SessionContext
@@ -512,11 +512,16 @@ func (t *TPMContext) Unseal(itemContext ResourceContext, itemContextAuthSession
 
 // ObjectChangeAuth executes the TPM2_ObjectChangeAuth to change the authorization value of the
 // object associated with objectContext. This command requires authorization with the admin role
-// for objectContext, with sessio based authorization provided via objectContextAuthSession.
+// for objectContext, with session based authorization provided via objectContextAuthSession. If
+// the object has the [AttrAdminWithPolicy] attribute set, then objectContextAuthSession must be
+// a policy session that includes a TPM2_PolicyCommandCode assertion for
+// [CommandObjectChangeAuth].
 //
 // The new authorization value is provided via newAuth. The parentContext parameter must
 // correspond to the parent object for objectContext. No authorization is required for
-// parentContext.
+// parentContext. The newAuth parameter is the first command parameter, so it can be protected
+// with session based command parameter encryption by supplying a session with the
+// [AttrCommandEncrypt] attribute set.
 //
 // If the object associated with objectContext is a sequence object, a *[TPMHandleError] error with
 // an error code of ErrorType will be returned for handle index 1.
@@ -5,6 +5,7 @@
 package tpm2_test
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -276,6 +277,73 @@ func (s *objectSuite) TestReadPublic(c *C) {
 	c.Check(qn, DeepEquals, expectedQn)
 }
 
+type testPublicNameMatchesLoadData struct {
+	template  *Public
+	sensitive *SensitiveCreate
+}
+
+func (s *objectSuite) testPublicNameMatchesLoad(c *C, data *testPublicNameMatchesLoadData) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+
+	priv, pub, _, _, _, err := s.TPM.Create(primary, data.sensitive, data.template, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	// Compute the name offline before loading the object.
+	expectedName := pub.Name()
+	c.Check(expectedName.Type(), Equals, NameTypeDigest)
+
+	object, err := s.TPM.Load(primary, priv, pub, nil)
+	c.Assert(err, IsNil)
+
+	// Check against the name returned from the TPM.
+	_, _, rpBytes, _ := s.LastCommand(c).UnmarshalResponse(c)
+	var tpmName Name
+	_, err = mu.UnmarshalFromBytes(rpBytes, &tpmName)
+	c.Check(err, IsNil)
+	c.Check(tpmName, DeepEquals, expectedName)
+	c.Check(object.Name(), DeepEquals, expectedName)
+
+	_, name, _, err := s.TPM.ReadPublic(object)
+	c.Check(err, IsNil)
+	c.Check(name, DeepEquals, expectedName)
+}
+
+func (s *objectSuite) TestPublicNameMatchesLoadRSA(c *C) {
+	s.testPublicNameMatchesLoad(c, &testPublicNameMatchesLoadData{
+		template: objectutil.NewRSAKeyTemplate(objectutil.UsageSign)})
+}
+
+func (s *objectSuite) TestPublicNameMatchesLoadECC(c *C) {
+	s.testPublicNameMatchesLoad(c, &testPublicNameMatchesLoadData{
+		template: objectutil.NewECCKeyTemplate(objectutil.UsageSign)})
+}
+
+func (s *objectSuite) TestPublicNameMatchesLoadSealedObject(c *C) {
+	s.testPublicNameMatchesLoad(c, &testPublicNameMatchesLoadData{
+		template:  objectutil.NewSealedObjectTemplate(),
+		sensitive: &SensitiveCreate{Data: []byte("foo")}})
+}
+
+func (s *objectSuite) TestPublicNameMatchesLoadHMAC(c *C) {
+	s.testPublicNameMatchesLoad(c, &testPublicNameMatchesLoadData{
+		template: objectutil.NewHMACKeyTemplate()})
+}
+
+func (s *objectSuite) TestPublicNameMatchesLoadDerivationParent(c *C) {
+	s.testPublicNameMatchesLoad(c, &testPublicNameMatchesLoadData{
+		template: objectutil.NewDerivationParentTemplate()})
+}
+
+func (s *objectSuite) TestPublicNameMatchesLoadSymCipher(c *C) {
+	s.testPublicNameMatchesLoad(c, &testPublicNameMatchesLoadData{
+		template: objectutil.NewSymmetricKeyTemplate(objectutil.UsageEncrypt | objectutil.UsageDecrypt)})
+}
+
+func (s *objectSuite) TestPublicNameMatchesLoadSHA1(c *C) {
+	s.testPublicNameMatchesLoad(c, &testPublicNameMatchesLoadData{
+		template: objectutil.NewECCKeyTemplate(objectutil.UsageSign, objectutil.WithNameAlg(HashAlgorithmSHA1))})
+}
+
 type testLoadExternalData struct {
 	inPrivate *Sensitive
 	inPublic  *Public
@@ -434,6 +502,35 @@ func (s *objectSuite) TestUnsealWithEncryptSession(c *C) {
 		itemAuthSession: session.WithAttrs(AttrResponseEncrypt)})
 }
 
+func (s *objectSuite) TestUnsealMultipleWithEncryptSession(c *C) {
+	// The session's symmetric algorithm is fixed when it is started, and is
+	// used for every command that the session is subsequently used to encrypt.
+	symmetric := SymDef{
+		Algorithm: SymAlgorithmAES,
+		KeyBits:   &SymKeyBitsU{Sym: 256},
+		Mode:      &SymModeU{Sym: SymModeCFB}}
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, &symmetric, HashAlgorithmSHA256).WithAttrs(AttrContinueSession | AttrResponseEncrypt)
+
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+
+	for _, secret := range [][]byte{[]byte("sensitive data"), []byte("another super secret")} {
+		priv, pub, _, _, _, err := s.TPM.Create(primary, &SensitiveCreate{Data: secret}, testutil.NewSealedObjectTemplate(), nil, nil, nil)
+		c.Assert(err, IsNil)
+
+		object, err := s.TPM.Load(primary, priv, pub, nil)
+		c.Assert(err, IsNil)
+
+		unsealedSecret, err := s.TPM.Unseal(object, session)
+		c.Check(err, IsNil)
+		c.Check(unsealedSecret, DeepEquals, SensitiveData(secret))
+
+		_, _, rpBytes, _ := s.LastCommand(c).UnmarshalResponse(c)
+		c.Check(bytes.Contains(rpBytes, secret), internal_testutil.IsFalse)
+
+		s.TPM.FlushContext(object)
+	}
+}
+
 func (s *objectSuite) testObjectChangeAuth(c *C, objectAuthSession SessionContext) {
 	primary := s.CreateStoragePrimaryKeyRSA(c)
 
@@ -471,6 +568,80 @@ func (s *objectSuite) TestObjectChangeAuthWithObjectAuthSession(c *C) {
 	s.testObjectChangeAuth(c, s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256))
 }
 
+func (s *objectSuite) TestObjectChangeAuthAdminWithPolicy(c *C) {
+	trial := util.ComputeAuthPolicy(HashAlgorithmSHA256)
+	trial.PolicyCommandCode(CommandObjectChangeAuth)
+
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+
+	template := testutil.NewSealedObjectTemplate()
+	template.Attrs |= AttrAdminWithPolicy
+	template.AuthPolicy = trial.GetDigest()
+
+	priv, pub, _, _, _, err := s.TPM.Create(primary, &SensitiveCreate{Data: []byte("foo")}, template, nil, nil, nil)
+	c.Check(err, IsNil)
+
+	object, err := s.TPM.Load(primary, priv, pub, nil)
+	c.Assert(err, IsNil)
+
+	testAuth := []byte("1234")
+
+	_, err = s.TPM.ObjectChangeAuth(object, primary, testAuth, nil)
+	c.Check(IsTPMSessionError(err, ErrorAuthUnavailable, CommandObjectChangeAuth, 1), internal_testutil.IsTrue)
+
+	session := s.StartAuthSession(c, nil, nil, SessionTypePolicy, nil, HashAlgorithmSHA256)
+	c.Check(s.TPM.PolicyCommandCode(session, CommandObjectChangeAuth), IsNil)
+
+	priv, err = s.TPM.ObjectChangeAuth(object, primary, testAuth, session)
+	c.Check(err, IsNil)
+
+	object, err = s.TPM.Load(primary, priv, pub, nil)
+	c.Assert(err, IsNil)
+
+	object.SetAuthValue(testAuth)
+
+	_, err = s.TPM.Unseal(object, nil)
+	c.Check(err, IsNil)
+}
+
+func (s *objectSuite) TestObjectChangeAuthWithEncryptSession(c *C) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+
+	priv, pub, _, _, _, err := s.TPM.Create(primary, &SensitiveCreate{Data: []byte("foo")}, testutil.NewSealedObjectTemplate(), nil, nil, nil)
+	c.Check(err, IsNil)
+
+	object, err := s.TPM.Load(primary, priv, pub, nil)
+	c.Assert(err, IsNil)
+
+	testAuth := []byte("1234")
+
+	symmetric := SymDef{
+		Algorithm: SymAlgorithmAES,
+		KeyBits:   &SymKeyBitsU{Sym: 128},
+		Mode:      &SymModeU{Sym: SymModeCFB}}
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, &symmetric, HashAlgorithmSHA256)
+
+	priv, err = s.TPM.ObjectChangeAuth(object, primary, testAuth, nil, session.WithAttrs(AttrCommandEncrypt))
+	c.Check(err, IsNil)
+
+	_, authArea, cpBytes := s.LastCommand(c).UnmarshalCommand(c)
+	c.Assert(authArea, internal_testutil.LenEquals, 2)
+	c.Check(authArea[1].SessionAttributes&AttrCommandEncrypt, Equals, AttrCommandEncrypt)
+	var encryptedAuth Auth
+	_, err = mu.UnmarshalFromBytes(cpBytes, &encryptedAuth)
+	c.Check(err, IsNil)
+	c.Check(encryptedAuth, internal_testutil.LenEquals, len(testAuth))
+	c.Check(encryptedAuth, Not(DeepEquals), Auth(testAuth))
+
+	object, err = s.TPM.Load(primary, priv, pub, nil)
+	c.Assert(err, IsNil)
+
+	object.SetAuthValue(testAuth)
+
+	_, err = s.TPM.Unseal(object, nil)
+	c.Check(err, IsNil)
+}
+
 func (s *objectSuite) TestMakeCredential(c *C) {
 	key, err := rsa.GenerateKey(rand.Reader, 2048)
 	c.Assert(err, IsNil)
@@ -6,6 +6,12 @@ package tpm2
 
 import "errors"
 
+// pcrReadAllMaxAttempts is the maximum number of times that PCRReadAll will try
+// to read a consistent set of PCR values.
+const pcrReadAllMaxAttempts = 5
+
+var errPCRUpdateCounterChanged = errors.New("PCR update counter changed between commands")
+
 // Section 22 - Integrity Collection (PCR)
 
 // PCRExtend executes the TPM2_PCR_Extend command to extend the PCR associated with the pcrContext
@@ -54,7 +60,12 @@ func (t *TPMContext) PCREvent(pcrContext ResourceContext, eventData Event, pcrCo
 // pcrSelectionIn parameter. The underlying command may not be able to read all of the specified
 // PCRs in a single transaction, so this function will re-execute the TPM2_PCR_Read command until
 // all requested values have been read. As a consequence, any SessionContext instances provided
-// should have the [AttrContinueSession] attribute defined.
+// should have the [AttrContinueSession] attribute defined. The values returned from every command
+// are merged, so the selection may span multiple PCR banks.
+//
+// If the TPM's pcrUpdateCounter changes between commands, the returned values would not be
+// consistent and so a *[InvalidResponseError] error is returned. In this case, the caller can
+// retry the call.
 //
 // This function will call [TPMContext.InitProperties] if it hasn't already been called.
 //
@@ -83,7 +94,7 @@ func (t *TPMContext) PCRRead(pcrSelectionIn PCRSelectionList, sessions ...Sessio
 		if i == 0 {
 			pcrUpdateCounter = updateCounter
 		} else if updateCounter != pcrUpdateCounter {
-			return 0, nil, &InvalidResponseError{CommandPCRRead, errors.New("PCR update counter changed between commands")}
+			return 0, nil, &InvalidResponseError{CommandPCRRead, errPCRUpdateCounterChanged}
 		} else if len(values) == 0 && pcrSelectionOut.IsEmpty() {
 			return 0, nil, makeInvalidArgError("pcrSelectionIn", "unimplemented PCRs specified")
 		}
@@ -103,6 +114,29 @@ func (t *TPMContext) PCRRead(pcrSelectionIn PCRSelectionList, sessions ...Sessio
 	return pcrUpdateCounter, pcrValues, nil
 }
 
+// PCRReadAll is a convenience function for [TPMContext.PCRRead] that returns a consistent set of
+// values for the PCRs defined in the pcrSelectionIn parameter, which may span multiple PCR banks.
+// Like PCRRead, this will execute as many TPM2_PCR_Read commands as are required to read all of the
+// specified PCRs. If the TPM's pcrUpdateCounter changes between commands because a PCR was
+// extended, this function will start again, up to a maximum of 5 attempts. If a consistent set of
+// values cannot be read, a *[InvalidResponseError] error is returned. Any SessionContext instances
+// provided should have the [AttrContinueSession] attribute defined.
+//
+// On success, the value of pcrUpdateCounter that applies to every returned value is returned, as
+// well as the requested PCR values.
+func (t *TPMContext) PCRReadAll(pcrSelectionIn PCRSelectionList, sessions ...SessionContext) (pcrUpdateCounter uint32, pcrValues PCRValues, err error) {
+	for i := 0; i < pcrReadAllMaxAttempts; i++ {
+		pcrUpdateCounter, pcrValues, err = t.PCRRead(pcrSelectionIn, sessions...)
+		if !errors.Is(err, errPCRUpdateCounterChanged) {
+			break
+		}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return pcrUpdateCounter, pcrValues, nil
+}
+
 // PCRReset executes the TPM2_PCR_Reset command to reset the PCR associated with pcrContext in all
 // banks. This command requires authorization with the user auth role for pcrContext, with session
 // based authorization provided via pcrContextAuthSession.
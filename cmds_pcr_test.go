@@ -6,8 +6,11 @@ package tpm2_test
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 
+	. "gopkg.in/check.v1"
+
 	. "github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/testutil"
 )
@@ -272,6 +275,12 @@ func TestPCRRead(t *testing.T) {
 				{Hash: HashAlgorithmSHA1, Select: []int{1, 2, 3, 4, 5}},
 				{Hash: HashAlgorithmSHA256, Select: []int{1, 5, 2, 3, 4}}},
 		},
+		{
+			desc: "AllPCRsMultipleBank",
+			selection: PCRSelectionList{
+				{Hash: HashAlgorithmSHA1, Select: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}},
+				{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}}},
+		},
 	} {
 		t.Run(data.desc, func(t *testing.T) {
 			_, digests, err := tpm.PCRRead(data.selection)
@@ -292,8 +301,19 @@ func TestPCRRead(t *testing.T) {
 					if _, ok := digests[selection.Hash][i]; !ok {
 						t.Fatalf("No digest for PCR%d, algorithm %v", i, selection.Hash)
 					}
-					if !bytes.Equal(expectedDigests[selection.Hash][i], digests[selection.Hash][i]) {
-						t.Errorf("Unexpected digest (got %x, expected %x)", digests[selection.Hash][i], expectedDigests[selection.Hash][i])
+					expectedDigest, ok := expectedDigests[selection.Hash][i]
+					if !ok {
+						// This PCR hasn't been extended since the TPM was reset.
+						expectedDigest = make(Digest, selection.Hash.Size())
+						if i >= 17 && i <= 22 {
+							// These PCRs are reset to all 0xff.
+							for j := range expectedDigest {
+								expectedDigest[j] = 0xff
+							}
+						}
+					}
+					if !bytes.Equal(expectedDigest, digests[selection.Hash][i]) {
+						t.Errorf("Unexpected digest (got %x, expected %x)", digests[selection.Hash][i], expectedDigest)
 					}
 				}
 			}
@@ -380,3 +400,78 @@ func TestPCRReset(t *testing.T) {
 		})
 	}
 }
+
+type pcrSuiteNoTPM struct{}
+
+var _ = Suite(&pcrSuiteNoTPM{})
+
+func (s *pcrSuiteNoTPM) newTransport(counters ...uint32) *mockPropertiesTransport {
+	return &mockPropertiesTransport{
+		properties: map[Property]uint32{
+			PropertyInputBuffer:  1024,
+			PropertyPCRCount:     24,
+			PropertyPCRSelectMin: 3,
+			PropertyNVBufferMax:  2048},
+		pcrsPerRead:       8,
+		pcrUpdateCounters: counters}
+}
+
+func (s *pcrSuiteNoTPM) allPCRsTwoBanks() PCRSelectionList {
+	return PCRSelectionList{
+		{Hash: HashAlgorithmSHA1, Select: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}},
+		{Hash: HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}}}
+}
+
+func (s *pcrSuiteNoTPM) checkValues(c *C, values PCRValues) {
+	c.Check(values, HasLen, 2)
+	for _, alg := range []HashAlgorithmId{HashAlgorithmSHA1, HashAlgorithmSHA256} {
+		c.Check(values[alg], HasLen, 24)
+		for pcr := 0; pcr < 24; pcr++ {
+			c.Check(values[alg][pcr], DeepEquals, make(Digest, alg.Size()))
+		}
+	}
+}
+
+func (s *pcrSuiteNoTPM) TestPCRReadAll(c *C) {
+	transport := s.newTransport(10)
+	tpm := NewTPMContext(transport)
+
+	counter, values, err := tpm.PCRReadAll(s.allPCRsTwoBanks())
+	c.Check(err, IsNil)
+	c.Check(counter, Equals, uint32(10))
+	s.checkValues(c, values)
+	c.Check(transport.pcrReads, Equals, 6)
+}
+
+func (s *pcrSuiteNoTPM) TestPCRReadAllRetriesWhenCounterChanges(c *C) {
+	// The counter changes during the first attempt, after which it is stable.
+	transport := s.newTransport(10, 10, 11)
+	tpm := NewTPMContext(transport)
+
+	_, _, err := tpm.PCRRead(s.allPCRsTwoBanks())
+	c.Check(err, ErrorMatches, `TPM returned an invalid response for command TPM_CC_PCR_Read: PCR update counter changed between commands`)
+	var e *InvalidResponseError
+	c.Check(errors.As(err, &e), Equals, true)
+
+	transport.pcrReads = 0
+	counter, values, err := tpm.PCRReadAll(s.allPCRsTwoBanks())
+	c.Check(err, IsNil)
+	c.Check(counter, Equals, uint32(11))
+	s.checkValues(c, values)
+	// 3 commands for the failed attempt and 6 for the successful one.
+	c.Check(transport.pcrReads, Equals, 9)
+}
+
+func (s *pcrSuiteNoTPM) TestPCRReadAllGivesUp(c *C) {
+	// The counter changes on every command.
+	var counters []uint32
+	for i := uint32(0); i < 100; i++ {
+		counters = append(counters, i)
+	}
+	transport := s.newTransport(counters...)
+	tpm := NewTPMContext(transport)
+
+	_, _, err := tpm.PCRReadAll(s.allPCRsTwoBanks())
+	c.Check(err, ErrorMatches, `TPM returned an invalid response for command TPM_CC_PCR_Read: PCR update counter changed between commands`)
+	c.Check(transport.pcrReads, Equals, 10)
+}
@@ -4,10 +4,25 @@
 
 package tpm2
 
+import (
+	"errors"
+	"math"
+)
+
 // Section 16 - Random Number Generator
 
 // GetRandom executes the TPM2_GetRandom command to return the requested number of bytes from the
 // TPM's random number generator.
+//
+// The TPM will return fewer bytes than requested if bytesRequested is larger than the size of the
+// largest digest supported by the TPM. Use [TPMContext.GetRandomBytes] to obtain more bytes than
+// this.
+//
+// The random bytes are generated by the TPM's DRBG, which is seeded from the TPM's entropy source as
+// described in part 1 of the TPM Library specification. As the response is transmitted over an
+// interface that may not be trusted, a session with the [AttrResponseEncrypt] attribute set should
+// be supplied in order to protect the returned bytes from an adversary that is able to observe
+// communications with the TPM.
 func (t *TPMContext) GetRandom(bytesRequested uint16, sessions ...SessionContext) (randomBytes Digest, err error) {
 	if err := t.StartCommand(CommandGetRandom).
 		AddParams(bytesRequested).
@@ -18,6 +33,32 @@ func (t *TPMContext) GetRandom(bytesRequested uint16, sessions ...SessionContext
 	return randomBytes, nil
 }
 
+// GetRandomBytes is a convenience function that returns the requested number of bytes from the
+// TPM's random number generator, executing the TPM2_GetRandom command as many times as necessary.
+// The supplied sessions are used for every command, see the documentation for
+// [TPMContext.GetRandom] about the use of parameter encryption.
+func (t *TPMContext) GetRandomBytes(n int, sessions ...SessionContext) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		requested := n - len(out)
+		if requested > math.MaxUint16 {
+			requested = math.MaxUint16
+		}
+		randomBytes, err := t.GetRandom(uint16(requested), sessions...)
+		if err != nil {
+			return nil, err
+		}
+		if len(randomBytes) == 0 {
+			return nil, errors.New("TPM returned no random bytes")
+		}
+		if len(randomBytes) > requested {
+			randomBytes = randomBytes[:requested]
+		}
+		out = append(out, randomBytes...)
+	}
+	return out, nil
+}
+
 func (t *TPMContext) StirRandom(inData SensitiveData, sessions ...SessionContext) error {
 	return t.StartCommand(CommandStirRandom).
 		AddParams(inData).
@@ -6,6 +6,7 @@ package tpm2_test
 
 import (
 	"crypto/rand"
+	"io"
 
 	. "gopkg.in/check.v1"
 
@@ -47,6 +48,63 @@ func (s *rngSuite) TestGetRandom20(c *C) {
 	s.testGetRandom(c, 32)
 }
 
+func (s *rngSuite) countCommands(c *C, code CommandCode) (n int) {
+	for _, cmd := range s.CommandLog() {
+		if cmd.GetCommandCode(c) == code {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *rngSuite) TestGetRandomBytes(c *C) {
+	maxDigest, err := s.TPM.GetMaxDigestSize()
+	c.Assert(err, IsNil)
+	s.ForgetCommands()
+
+	n := (int(maxDigest) * 3) + 5
+	data, err := s.TPM.GetRandomBytes(n)
+	c.Check(err, IsNil)
+	c.Check(data, internal_testutil.LenEquals, n)
+	c.Check(s.countCommands(c, CommandGetRandom), Equals, 4)
+}
+
+func (s *rngSuite) TestTPMSeededReader(c *C) {
+	r := NewTPMSeededReader(s.TPM)
+
+	a := make([]byte, 64)
+	_, err := io.ReadFull(r, a)
+	c.Check(err, IsNil)
+	c.Check(s.countCommands(c, CommandGetRandom) > 0, internal_testutil.IsTrue)
+	s.ForgetCommands()
+
+	b := make([]byte, 64)
+	_, err = io.ReadFull(r, b)
+	c.Check(err, IsNil)
+	c.Check(b, Not(DeepEquals), a)
+
+	// The reader shouldn't have been reseeded.
+	c.Check(s.countCommands(c, CommandGetRandom), Equals, 0)
+}
+
+func (s *rngSuite) TestTPMSeededReaderReseed(c *C) {
+	r := NewTPMSeededReaderWithReseedInterval(s.TPM, 64)
+
+	a := make([]byte, 64)
+	_, err := io.ReadFull(r, a)
+	c.Check(err, IsNil)
+	seedCommands := s.countCommands(c, CommandGetRandom)
+	c.Check(seedCommands > 0, internal_testutil.IsTrue)
+	s.ForgetCommands()
+
+	// The next read should reseed the DRBG with fresh entropy from the TPM.
+	b := make([]byte, 32)
+	_, err = io.ReadFull(r, b)
+	c.Check(err, IsNil)
+	c.Check(b, Not(DeepEquals), a[:32])
+	c.Check(s.countCommands(c, CommandGetRandom), Equals, seedCommands)
+}
+
 func (s *rngSuite) TestStirRandom(c *C) {
 	inData := make([]byte, 32)
 	rand.Read(inData)
@@ -71,7 +71,10 @@ import (
 // to TPM2B prefixed types). If symmetric is provided and corresponds to a symmetric block cipher
 // (ie, the Algorithm field is not [SymAlgorithmXOR]) then the symmetric mode must be
 // [SymModeCFB], else a *[TPMParameterError] error with an error code of [ErrorMode] is returned
-// for parameter index 4.
+// for parameter index 4. The symmetric algorithm is fixed for the lifetime of the session and is
+// used by the TPM for every command that the session is used with for parameter encryption, so
+// it can't be changed for an individual command. A separate session must be started in order to
+// use a different algorithm.
 //
 // When the created session is used for parameter encryption, the encryption key is derived from
 // the session key if there is one. If the session is also used for authorization, then the
@@ -94,6 +97,78 @@ import (
 // [WarningSessionMemory] will be returned. If there are no more session handles available, a
 // *[TPMwarning] error with a warning code of [WarningSessionHandles] will be returned.
 func (t *TPMContext) StartAuthSession(tpmKey, bind ResourceContext, sessionType SessionType, symmetric *SymDef, authHash HashAlgorithmId, sessions ...SessionContext) (sessionContext SessionContext, err error) {
+	return t.StartAuthSessionWithOptions(tpmKey, bind, sessionType, symmetric, authHash, nil, sessions...)
+}
+
+// StartAuthSessionOption is an option that can be supplied to
+// [TPMContext.StartAuthSessionWithOptions].
+type StartAuthSessionOption func(*startAuthSessionOptions)
+
+type startAuthSessionOptions struct {
+	saltScheme  AsymSchemeId
+	saltHashAlg HashAlgorithmId
+}
+
+// WithSaltScheme explicitly selects the scheme used to establish the salt for a salted session.
+// For a salt key with the type of [ObjectTypeRSA], the scheme must be [AsymSchemeOAEP]. For a
+// salt key with the type of [ObjectTypeECC], the scheme must be [AsymSchemeECDH]. The scheme
+// must also be permitted by the scheme configured in the salt key's public area, if one is
+// configured.
+//
+// The TPM always uses the name algorithm of the salt key with the selected scheme, so hashAlg
+// must either match the name algorithm of the salt key, or be [HashAlgorithmNull] in which
+// case the name algorithm is used.
+//
+// Without this option, the scheme is selected based on the type of the salt key.
+func WithSaltScheme(scheme AsymSchemeId, hashAlg HashAlgorithmId) StartAuthSessionOption {
+	return func(opts *startAuthSessionOptions) {
+		opts.saltScheme = scheme
+		opts.saltHashAlg = hashAlg
+	}
+}
+
+func checkSaltScheme(public *Public, scheme AsymSchemeId, hashAlg HashAlgorithmId) error {
+	var keyScheme AsymSchemeId
+	switch public.Type {
+	case ObjectTypeRSA:
+		if scheme != AsymSchemeOAEP {
+			return fmt.Errorf("salt scheme %v is not supported for RSA keys", scheme)
+		}
+		keyScheme = AsymSchemeId(public.Params.RSADetail.Scheme.Scheme)
+	case ObjectTypeECC:
+		if scheme != AsymSchemeECDH {
+			return fmt.Errorf("salt scheme %v is not supported for ECC keys", scheme)
+		}
+		keyScheme = AsymSchemeId(public.Params.ECCDetail.Scheme.Scheme)
+	default:
+		return fmt.Errorf("salt scheme %v is not supported for %v keys", scheme, public.Type)
+	}
+
+	if keyScheme != AsymSchemeNull && keyScheme != scheme {
+		return fmt.Errorf("salt scheme %v is not permitted by the key's scheme %v", scheme, keyScheme)
+	}
+	if hashAlg != HashAlgorithmNull && hashAlg != public.NameAlg {
+		return fmt.Errorf("salt scheme digest algorithm %v doesn't match the key's name algorithm %v", hashAlg, public.NameAlg)
+	}
+	return nil
+}
+
+// StartAuthSessionWithOptions executes the TPM2_StartAuthSession command to start an
+// authorization session, in the same way as [TPMContext.StartAuthSession]. The behaviour can be
+// customized with the supplied options.
+//
+// If [WithSaltScheme] is supplied, the specified salt scheme is checked against the public area
+// of tpmKey before any command is executed, and an error is returned if it isn't compatible.
+// An error is also returned if this option is supplied without tpmKey.
+func (t *TPMContext) StartAuthSessionWithOptions(tpmKey, bind ResourceContext, sessionType SessionType, symmetric *SymDef, authHash HashAlgorithmId, options []StartAuthSessionOption, sessions ...SessionContext) (sessionContext SessionContext, err error) {
+	opts := startAuthSessionOptions{
+		saltScheme:  AsymSchemeNull,
+		saltHashAlg: HashAlgorithmNull,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
 	if symmetric == nil {
 		symmetric = &SymDef{Algorithm: SymAlgorithmNull}
 	}
@@ -102,6 +177,10 @@ func (t *TPMContext) StartAuthSession(tpmKey, bind ResourceContext, sessionType
 	}
 	digestSize := authHash.Size()
 
+	if tpmKey == nil && opts.saltScheme != AsymSchemeNull {
+		return nil, makeInvalidArgError("options", "salt scheme supplied without tpmKey")
+	}
+
 	var salt []byte
 	var encryptedSalt EncryptedSecret
 	tpmKeyHandle := HandleNull
@@ -114,10 +193,16 @@ func (t *TPMContext) StartAuthSession(tpmKey, bind ResourceContext, sessionType
 			return nil, makeInvalidArgError("tpmKey", "no public area")
 		}
 
+		if opts.saltScheme != AsymSchemeNull {
+			if err := checkSaltScheme(object.Public(), opts.saltScheme, opts.saltHashAlg); err != nil {
+				return nil, makeInvalidArgError("options", err.Error())
+			}
+		}
+
 		tpmKeyHandle = tpmKey.Handle()
 
 		var err error
-		encryptedSalt, salt, err = cryptSecretEncrypt(object.Public(), []byte(SecretKey))
+		encryptedSalt, salt, err = cryptSecretEncrypt(t.execContext.rand, object.Public(), []byte(SecretKey))
 		if err != nil {
 			return nil, fmt.Errorf("cannot compute encrypted salt: %v", err)
 		}
@@ -133,12 +218,12 @@ func (t *TPMContext) StartAuthSession(tpmKey, bind ResourceContext, sessionType
 	var isBound bool = false
 	var boundEntity Name
 	if bindHandle != HandleNull && sessionType == SessionTypeHMAC {
-		boundEntity = computeBindName(bind.Name(), authValue)
+		boundEntity = BoundEntityValue(authValue, bind.Name())
 		isBound = true
 	}
 
 	nonceCaller := make([]byte, digestSize)
-	if err := cryptComputeNonce(nonceCaller); err != nil {
+	if err := cryptComputeNonce(t.execContext.rand, nonceCaller); err != nil {
 		return nil, fmt.Errorf("cannot compute initial nonceCaller: %v", err)
 	}
 
@@ -169,6 +254,12 @@ func (t *TPMContext) StartAuthSession(tpmKey, bind ResourceContext, sessionType
 		},
 		State: SessionContextState{
 			NonceTPM: nonceTPM,
+		},
+		Initial: &sessionContextInitialState{
+			sessionType: sessionType,
+			isSalted:    tpmKeyHandle != HandleNull,
+			nonceTPM:    append(Nonce(nil), nonceTPM...),
+			nonceCaller: nonceCaller,
 		}}
 
 	if tpmKeyHandle != HandleNull || bindHandle != HandleNull {
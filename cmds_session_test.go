@@ -6,13 +6,347 @@ package tpm2_test
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/sha256"
 	"testing"
 
+	. "gopkg.in/check.v1"
+
 	. "github.com/canonical/go-tpm2"
+	internal_crypt "github.com/canonical/go-tpm2/internal/crypt"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
 	"github.com/canonical/go-tpm2/testutil"
 )
 
+type sessionSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&sessionSuite{})
+
+func (s *sessionSuite) TestSetRandReader(c *C) {
+	b := internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd86553c234e5e8472b6ac51c1ae1cab3fe06fad053beb8ebfd8977b010655bfdd3c3")
+	s.TPM.SetRandReader(bytes.NewReader(b))
+	defer s.TPM.SetRandReader(nil)
+
+	session, err := s.TPM.StartAuthSession(nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	defer s.TPM.FlushContext(session)
+
+	_, _, cpBytes := s.LastCommand(c).UnmarshalCommand(c)
+	var nonceCaller Nonce
+	_, err = mu.UnmarshalFromBytes(cpBytes, &nonceCaller)
+	c.Check(err, IsNil)
+	c.Check(nonceCaller, DeepEquals, Nonce(b[:32]))
+
+	_, err = s.TPM.GetRandom(16, session.WithAttrs(AttrContinueSession|AttrAudit))
+	c.Check(err, IsNil)
+
+	_, authArea, _ := s.LastCommand(c).UnmarshalCommand(c)
+	c.Assert(authArea, internal_testutil.LenEquals, 1)
+	c.Check(authArea[0].Nonce, DeepEquals, Nonce(b[32:]))
+}
+
+func (s *sessionSuite) TestNoncesRollPerCommand(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256).WithAttrs(AttrContinueSession)
+	c.Check(session.(SessionContextNonces).NonceCaller(), IsNil)
+
+	_, err := s.TPM.GetRandom(16, session.IncludeAttrs(AttrAudit))
+	c.Assert(err, IsNil)
+
+	_, authArea, _ := s.LastCommand(c).UnmarshalCommand(c)
+	c.Assert(authArea, internal_testutil.LenEquals, 1)
+	nonceCaller1 := session.(SessionContextNonces).NonceCaller()
+	c.Check(nonceCaller1, DeepEquals, authArea[0].Nonce)
+	_, _, _, respAuthArea := s.LastCommand(c).UnmarshalResponse(c)
+	c.Assert(respAuthArea, internal_testutil.LenEquals, 1)
+	nonceTPM1 := append(Nonce(nil), session.NonceTPM()...)
+	c.Check(nonceTPM1, DeepEquals, respAuthArea[0].Nonce)
+
+	// The returned nonces are copies.
+	nonceCaller1[0] ^= 0xff
+	c.Check(session.(SessionContextNonces).NonceCaller(), Not(DeepEquals), nonceCaller1)
+	nonceCaller1[0] ^= 0xff
+	state, err := session.(SessionContextStateExporter).ExportState()
+	c.Assert(err, IsNil)
+	state.NonceTPM[0] ^= 0xff
+	c.Check(session.NonceTPM(), DeepEquals, nonceTPM1)
+
+	_, err = s.TPM.GetRandom(16, session.IncludeAttrs(AttrAudit))
+	c.Assert(err, IsNil)
+
+	c.Check(session.(SessionContextNonces).NonceCaller(), internal_testutil.LenEquals, 32)
+	c.Check(session.(SessionContextNonces).NonceCaller(), Not(DeepEquals), nonceCaller1)
+	c.Check(session.NonceTPM(), internal_testutil.LenEquals, 32)
+	c.Check(session.NonceTPM(), Not(DeepEquals), nonceTPM1)
+}
+
+func (s *sessionSuite) TestExportStateUnbound(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	_, _, cpBytes := s.LastCommand(c).UnmarshalCommand(c)
+	var initialNonceCaller Nonce
+	_, err := mu.UnmarshalFromBytes(cpBytes, &initialNonceCaller)
+	c.Assert(err, IsNil)
+
+	state, err := session.(SessionContextStateExporter).ExportState()
+	c.Assert(err, IsNil)
+	c.Check(state.Handle, Equals, session.Handle())
+	c.Check(state.Type, Equals, SessionTypeHMAC)
+	c.Check(state.HashAlg, Equals, HashAlgorithmSHA256)
+	c.Check(state.IsBound, internal_testutil.IsFalse)
+	c.Check(state.HasSessionKey, internal_testutil.IsFalse)
+	c.Check(state.IsSalted, internal_testutil.IsFalse)
+	c.Check(state.InitialNonceCaller, DeepEquals, initialNonceCaller)
+	c.Check(state.NonceTPM, DeepEquals, session.NonceTPM())
+	c.Check(state.InitialNonceTPM, DeepEquals, session.NonceTPM())
+	c.Check(state.NonceCaller, IsNil)
+
+	key, err := state.ComputeSessionKey(nil)
+	c.Check(err, IsNil)
+	c.Check(key, IsNil)
+}
+
+func (s *sessionSuite) TestExportStateBound(c *C) {
+	parent := s.CreateStoragePrimaryKeyRSA(c)
+
+	priv, pub, _, _, _, err := s.TPM.Create(parent, &SensitiveCreate{UserAuth: []byte("foo"), Data: []byte("secret")}, testutil.NewSealedObjectTemplate(), nil, nil, nil)
+	c.Assert(err, IsNil)
+	object, err := s.TPM.Load(parent, priv, pub, nil)
+	c.Assert(err, IsNil)
+	object.SetAuthValue([]byte("foo"))
+
+	session := s.StartAuthSession(c, nil, object, SessionTypeHMAC, nil, HashAlgorithmSHA256).WithAttrs(AttrContinueSession)
+	_, err = s.TPM.GetRandom(16, session.IncludeAttrs(AttrAudit))
+	c.Assert(err, IsNil)
+
+	state, err := session.(SessionContextStateExporter).ExportState()
+	c.Assert(err, IsNil)
+	c.Check(state.Type, Equals, SessionTypeHMAC)
+	c.Check(state.IsBound, internal_testutil.IsTrue)
+	c.Check(state.BoundEntity, DeepEquals, session.Params().BoundEntity)
+	c.Check(state.HasSessionKey, internal_testutil.IsTrue)
+	c.Check(state.NonceCaller, DeepEquals, session.(SessionContextNonces).NonceCaller())
+	c.Check(state.NonceTPM, DeepEquals, session.NonceTPM())
+	c.Check(state.InitialNonceTPM, Not(DeepEquals), state.NonceTPM)
+
+	// The session key is never exported.
+	c.Check(bytes.Contains(mu.MustMarshalToBytes(state), session.Params().SessionKey), internal_testutil.IsFalse)
+
+	key, err := state.ComputeSessionKey([]byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(key, DeepEquals, session.Params().SessionKey)
+
+	key, err = state.ComputeSessionKey([]byte("bar"))
+	c.Check(err, IsNil)
+	c.Check(key, Not(DeepEquals), session.Params().SessionKey)
+}
+
+func (s *sessionSuite) TestExportStatePolicyWithBind(c *C) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	primary.SetAuthValue([]byte("foo"))
+
+	session := s.StartAuthSession(c, nil, primary, SessionTypePolicy, nil, HashAlgorithmSHA1)
+
+	state, err := session.(SessionContextStateExporter).ExportState()
+	c.Assert(err, IsNil)
+	c.Check(state.Type, Equals, SessionTypePolicy)
+	c.Check(state.HashAlg, Equals, HashAlgorithmSHA1)
+	c.Check(state.IsBound, internal_testutil.IsFalse)
+	c.Check(state.HasSessionKey, internal_testutil.IsTrue)
+
+	key, err := state.ComputeSessionKey([]byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(key, DeepEquals, session.Params().SessionKey)
+}
+
+func (s *sessionSuite) TestExportStateSalted(c *C) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+
+	session := s.StartAuthSession(c, primary, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	state, err := session.(SessionContextStateExporter).ExportState()
+	c.Assert(err, IsNil)
+	c.Check(state.HasSessionKey, internal_testutil.IsTrue)
+	c.Check(state.IsSalted, internal_testutil.IsTrue)
+
+	_, err = state.ComputeSessionKey(nil)
+	c.Check(err, ErrorMatches, `cannot compute the session key for a salted session`)
+}
+
+func (s *sessionSuite) TestExportStateAfterContextLoad(c *C) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	primary.SetAuthValue([]byte("foo"))
+
+	session := s.StartAuthSession(c, nil, primary, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	context, err := s.TPM.ContextSave(session)
+	c.Assert(err, IsNil)
+	restored, err := s.TPM.ContextLoad(context)
+	c.Assert(err, IsNil)
+	c.Assert(restored, Implements, new(SessionContext))
+
+	state, err := restored.(SessionContextStateExporter).ExportState()
+	c.Assert(err, IsNil)
+	c.Check(state.Type, Equals, SessionTypeHMAC)
+	c.Check(state.HasSessionKey, internal_testutil.IsTrue)
+	c.Check(state.InitialNonceTPM, IsNil)
+	c.Check(state.InitialNonceCaller, IsNil)
+
+	_, err = state.ComputeSessionKey([]byte("foo"))
+	c.Check(err, ErrorMatches, `initial nonces are not available`)
+}
+
+func (s *sessionSuite) TestExportStateDisposed(c *C) {
+	session := s.StartAuthSession(c, nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	c.Check(s.TPM.FlushContext(session), IsNil)
+
+	_, err := session.(SessionContextStateExporter).ExportState()
+	c.Check(err, ErrorMatches, `no session data`)
+}
+
+func (s *sessionSuite) TestComputeCommandHMAC(c *C) {
+	parent := s.CreateStoragePrimaryKeyRSA(c)
+
+	priv, pub, _, _, _, err := s.TPM.Create(parent, &SensitiveCreate{UserAuth: []byte("foo"), Data: []byte("secret")}, testutil.NewSealedObjectTemplate(), nil, nil, nil)
+	c.Assert(err, IsNil)
+	object, err := s.TPM.Load(parent, priv, pub, nil)
+	c.Assert(err, IsNil)
+	object.SetAuthValue([]byte("foo"))
+
+	session := s.StartAuthSession(c, parent, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	nonceTPM := append(Nonce{}, session.State().NonceTPM...)
+
+	_, err = s.TPM.Unseal(object, session.WithAttrs(AttrContinueSession))
+	c.Assert(err, IsNil)
+
+	_, authArea, cpBytes := s.LastCommand(c).UnmarshalCommand(c)
+	c.Assert(authArea, internal_testutil.LenEquals, 1)
+
+	h := sha256.New()
+	mu.MustMarshalToWriter(h, CommandUnseal)
+	h.Write(object.Name())
+	h.Write(cpBytes)
+	cpHash := h.Sum(nil)
+
+	// The TPM accepted the command, so the HMAC that was sent is the one it expects.
+	hmac := ComputeCommandHMAC(session.Params().SessionKey, []byte("foo"), cpHash, authArea[0].Nonce, nonceTPM, authArea[0].SessionAttributes, HashAlgorithmSHA256)
+	c.Check(hmac, DeepEquals, []byte(authArea[0].HMAC))
+}
+
+func (s *sessionSuite) testStartAuthSessionWithSaltScheme(c *C, tpmKey ResourceContext, scheme AsymSchemeId, hashAlg HashAlgorithmId) {
+	symmetric := &SymDef{
+		Algorithm: SymAlgorithmAES,
+		KeyBits:   &SymKeyBitsU{Sym: 128},
+		Mode:      &SymModeU{Sym: SymModeCFB}}
+	session, err := s.TPM.StartAuthSessionWithOptions(tpmKey, nil, SessionTypeHMAC, symmetric, HashAlgorithmSHA256, []StartAuthSessionOption{WithSaltScheme(scheme, hashAlg)})
+	c.Assert(err, IsNil)
+	defer s.TPM.FlushContext(session)
+
+	state, err := session.(SessionContextStateExporter).ExportState()
+	c.Assert(err, IsNil)
+	c.Check(state.IsSalted, internal_testutil.IsTrue)
+	c.Check(state.HasSessionKey, internal_testutil.IsTrue)
+
+	// Parameter encryption only works if the session key derived on the host
+	// matches the one derived by the TPM.
+	session.SetAttrs(AttrContinueSession)
+	c.Check(s.TPM.StirRandom([]byte("foo"), session.WithAttrs(AttrCommandEncrypt)), IsNil)
+	random, err := s.TPM.GetRandom(16, session.WithAttrs(AttrResponseEncrypt))
+	c.Check(err, IsNil)
+	c.Check(random, internal_testutil.LenEquals, 16)
+}
+
+func (s *sessionSuite) TestStartAuthSessionWithSaltSchemeRSA(c *C) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	s.testStartAuthSessionWithSaltScheme(c, primary, AsymSchemeOAEP, HashAlgorithmNull)
+}
+
+func (s *sessionSuite) TestStartAuthSessionWithSaltSchemeRSAExplicitDigest(c *C) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	s.testStartAuthSessionWithSaltScheme(c, primary, AsymSchemeOAEP, HashAlgorithmSHA256)
+}
+
+func (s *sessionSuite) TestStartAuthSessionWithSaltSchemeECC(c *C) {
+	primary := s.CreatePrimary(c, HandleOwner, objectutil.NewECCStorageKeyTemplate())
+	s.testStartAuthSessionWithSaltScheme(c, primary, AsymSchemeECDH, HashAlgorithmNull)
+}
+
+func (s *sessionSuite) TestStartAuthSessionWithSaltSchemeUnsupported(c *C) {
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	_, err := s.TPM.StartAuthSessionWithOptions(primary, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256, []StartAuthSessionOption{WithSaltScheme(AsymSchemeECDH, HashAlgorithmNull)})
+	c.Check(err, ErrorMatches, `invalid options argument: salt scheme TPM_ALG_ECDH is not supported for RSA keys`)
+}
+
+func (s *sessionSuite) TestStartAuthSessionWithSaltSchemeWrongDigest(c *C) {
+	primary := s.CreatePrimary(c, HandleOwner, objectutil.NewECCStorageKeyTemplate())
+	_, err := s.TPM.StartAuthSessionWithOptions(primary, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256, []StartAuthSessionOption{WithSaltScheme(AsymSchemeECDH, HashAlgorithmSHA1)})
+	c.Check(err, ErrorMatches, `invalid options argument: salt scheme digest algorithm TPM_ALG_SHA1 doesn't match the key's name algorithm TPM_ALG_SHA256`)
+}
+
+func (s *sessionSuite) TestStartAuthSessionWithSaltSchemeNotPermitted(c *C) {
+	pub := objectutil.NewRSAKeyTemplate(objectutil.UsageDecrypt, objectutil.WithRSAScheme(RSASchemeRSAES, HashAlgorithmNull))
+	pub.Unique = &PublicIDU{RSA: make(PublicKeyRSA, 256)}
+	key, err := NewObjectResourceContextFromPub(0x80000001, pub)
+	c.Assert(err, IsNil)
+
+	_, err = s.TPM.StartAuthSessionWithOptions(key, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256, []StartAuthSessionOption{WithSaltScheme(AsymSchemeOAEP, HashAlgorithmNull)})
+	c.Check(err, ErrorMatches, `invalid options argument: salt scheme TPM_ALG_OAEP is not permitted by the key's scheme TPM_ALG_RSAES`)
+}
+
+func (s *sessionSuite) TestStartAuthSessionWithSaltSchemeNoTPMKey(c *C) {
+	_, err := s.TPM.StartAuthSessionWithOptions(nil, nil, SessionTypeHMAC, nil, HashAlgorithmSHA256, []StartAuthSessionOption{WithSaltScheme(AsymSchemeOAEP, HashAlgorithmNull)})
+	c.Check(err, ErrorMatches, `invalid options argument: salt scheme supplied without tpmKey`)
+}
+
+type sessionSuiteNV struct {
+	testutil.TPMTest
+}
+
+func (s *sessionSuiteNV) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy | testutil.TPMFeatureNV
+}
+
+var _ = Suite(&sessionSuiteNV{})
+
+func (s *sessionSuiteNV) TestBoundEntityValue(c *C) {
+	pub := &NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthWrite | AttrNVAuthRead),
+		Size:    8}
+	index := s.NVDefineSpace(c, HandleOwner, []byte("foo"), pub)
+	index.SetAuthValue([]byte("foo"))
+	name := index.Name()
+
+	session := s.StartAuthSession(c, nil, index, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+	c.Check(session.Params().IsBound, internal_testutil.IsTrue)
+	c.Check(session.Params().BoundEntity, DeepEquals, Name(BoundEntityValue([]byte("foo"), name)))
+	nonceTPM := append(Nonce{}, session.State().NonceTPM...)
+
+	c.Check(s.TPM.NVWrite(index, index, []byte("bar"), 0, session.WithAttrs(AttrContinueSession)), IsNil)
+
+	_, authArea, cpBytes := s.LastCommand(c).UnmarshalCommand(c)
+	c.Assert(authArea, internal_testutil.LenEquals, 1)
+
+	h := sha256.New()
+	mu.MustMarshalToWriter(h, CommandNVWrite)
+	h.Write(name)
+	h.Write(name)
+	h.Write(cpBytes)
+	cpHash := h.Sum(nil)
+
+	// The session is bound to the index, so its authorization value isn't included in the
+	// HMAC key. The TPM accepted the command, so this is the HMAC that it expects.
+	hmac := ComputeCommandHMAC(session.Params().SessionKey, nil, cpHash, authArea[0].Nonce, nonceTPM, authArea[0].SessionAttributes, HashAlgorithmSHA256)
+	c.Check(hmac, DeepEquals, []byte(authArea[0].HMAC))
+
+	// The index name changed when it was written, so the session is no longer bound to it.
+	c.Check(Name(BoundEntityValue([]byte("foo"), index.Name())), Not(DeepEquals), session.Params().BoundEntity)
+}
+
 func TestStartAuthSession(t *testing.T) {
 	tpm, _, closeTPM := testutil.NewTPMContextT(t, testutil.TPMFeatureOwnerHierarchy)
 	defer closeTPM()
@@ -207,3 +541,33 @@ func TestPolicyRestart(t *testing.T) {
 		t.Errorf("Digest wasn't reset to zero")
 	}
 }
+
+type sessionStateSuite struct{}
+
+var _ = Suite(&sessionStateSuite{})
+
+func (s *sessionStateSuite) TestComputeSessionKey(c *C) {
+	state := &SessionState{
+		HashAlg:            HashAlgorithmSHA256,
+		HasSessionKey:      true,
+		InitialNonceTPM:    internal_testutil.DecodeHexString(c, "4f8b5a9c0a6a6c1a8d7d2c5e1b3f4a6d9e0c2b7a5d8f1e3c6b9a0d2f4e7c1b3a"),
+		InitialNonceCaller: internal_testutil.DecodeHexString(c, "9a3c5e7f1b2d4f6a8c0e2b4d6f8a1c3e5b7d9f0a2c4e6b8d0f1a3c5e7b9d2f4a"),
+	}
+
+	key, err := state.ComputeSessionKey([]byte("foo\x00\x00"))
+	c.Check(err, IsNil)
+	c.Check(key, DeepEquals, internal_crypt.KDFa(crypto.SHA256, []byte("foo"), []byte(SessionKey), state.InitialNonceTPM, state.InitialNonceCaller, 256))
+}
+
+func (s *sessionStateSuite) TestComputeSessionKeyNoKey(c *C) {
+	state := &SessionState{HashAlg: HashAlgorithmSHA256}
+	key, err := state.ComputeSessionKey([]byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(key, IsNil)
+}
+
+func (s *sessionStateSuite) TestComputeSessionKeyMissingNonces(c *C) {
+	state := &SessionState{HashAlg: HashAlgorithmSHA256, HasSessionKey: true}
+	_, err := state.ComputeSessionKey([]byte("foo"))
+	c.Check(err, ErrorMatches, `initial nonces are not available`)
+}
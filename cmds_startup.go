@@ -27,7 +27,13 @@ package tpm2
 // Subsequent use of HandleContext instances corresponding to entities that are evicted as a
 // consequence of this function will no longer work.
 func (t *TPMContext) Startup(startupType StartupType) error {
-	return t.StartCommand(CommandStartup).AddParams(startupType).Run(nil)
+	if err := t.StartCommand(CommandStartup).AddParams(startupType).Run(nil); err != nil {
+		return err
+	}
+
+	// The TPM clears some NV attributes on startup.
+	t.invalidateAllNVPublic()
+	return nil
 }
 
 // Shutdown executes the TPM2_Shutdown command with the specified StartupType, and is used to
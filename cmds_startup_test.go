@@ -6,6 +6,7 @@ package tpm2_test
 
 import (
 	. "github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
 	"github.com/canonical/go-tpm2/testutil"
 
 	. "gopkg.in/check.v1"
@@ -48,3 +49,19 @@ func (s *startupSuite) TestReset(c *C) {
 	c.Check(time2.ClockInfo.ResetCount, Equals, time1.ClockInfo.ResetCount+1)
 	c.Check(time2.ClockInfo.RestartCount, Equals, uint32(0))
 }
+
+func (s *startupSuite) TestAllocatedPCRBanksInvalidatedByStartup(c *C) {
+	expected, err := s.TPM.AllocatedPCRBanks()
+	c.Assert(err, IsNil)
+
+	c.Check(s.TPM.Shutdown(StartupClear), IsNil)
+	c.Check(s.Mssim(c).Reset(), IsNil)
+	c.Check(s.TPM.Startup(StartupClear), IsNil)
+
+	s.ForgetCommands()
+	pcrs, err := s.TPM.AllocatedPCRBanks()
+	c.Check(err, IsNil)
+	c.Check(pcrs, DeepEquals, expected)
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 1)
+	c.Check(s.LastCommand(c).GetCommandCode(c), Equals, CommandGetCapability)
+}
@@ -178,7 +178,11 @@ type ResponseHeader struct {
 func ReadResponsePacket(r io.Reader, handle *Handle) (rc ResponseCode, parameters []byte, authArea []AuthResponse, err error) {
 	var header ResponseHeader
 	if _, err := mu.UnmarshalFromReader(r, &header); err != nil {
-		return 0, nil, nil, fmt.Errorf("cannot unmarshal header: %w", err)
+		err = fmt.Errorf("cannot unmarshal header: %w", err)
+		if isTruncatedReadError(err) {
+			err = &TransportFramingError{err: err}
+		}
+		return 0, nil, nil, err
 	}
 
 	switch header.Tag {
@@ -192,20 +196,33 @@ func ReadResponsePacket(r io.Reader, handle *Handle) (rc ResponseCode, parameter
 		}
 	case TagNoSessions:
 		if header.ResponseCode != ResponseSuccess && header.ResponseSize != uint32(binary.Size(header)) {
-			return 0, nil, nil, fmt.Errorf("invalid response size for unsuccessful response (%d)", header.ResponseSize)
+			return 0, nil, nil, &TransportFramingError{err: fmt.Errorf("invalid response size for unsuccessful response (%d)", header.ResponseSize)}
 		}
 	default:
-		return 0, nil, nil, fmt.Errorf("invalid tag: %v", header.Tag)
+		return 0, nil, nil, &TransportFramingError{err: fmt.Errorf("invalid tag: %v", header.Tag)}
+	}
+
+	if header.ResponseSize < uint32(binary.Size(header)) {
+		return 0, nil, nil, &TransportFramingError{err: fmt.Errorf("invalid response size (%d)", header.ResponseSize)}
 	}
 
 	// TODO: Make mu.UnmarshalFromReader return io.EOF when no bytes are read instead.
 	lr := &io.LimitedReader{R: r, N: int64(header.ResponseSize) - int64(binary.Size(header))}
 
+	// checkTruncated converts errors caused by the packet being shorter than the size
+	// indicated by the header into a TransportFramingError.
+	checkTruncated := func(err error) error {
+		if lr.N > 0 && isTruncatedReadError(err) {
+			return &TransportFramingError{err: err}
+		}
+		return err
+	}
+
 	switch header.Tag {
 	case TagSessions, TagNoSessions:
 		if header.ResponseCode == ResponseSuccess && handle != nil {
 			if _, err := mu.UnmarshalFromReader(lr, handle); err != nil {
-				return 0, nil, nil, fmt.Errorf("cannot unmarshal handle: %w", err)
+				return 0, nil, nil, checkTruncated(fmt.Errorf("cannot unmarshal handle: %w", err))
 			}
 		}
 	default:
@@ -216,18 +233,18 @@ func ReadResponsePacket(r io.Reader, handle *Handle) (rc ResponseCode, parameter
 	case TagSessions:
 		var parameterSize uint32
 		if _, err := mu.UnmarshalFromReader(lr, &parameterSize); err != nil {
-			return 0, nil, nil, fmt.Errorf("cannot unmarshal parameterSize: %w", err)
+			return 0, nil, nil, checkTruncated(fmt.Errorf("cannot unmarshal parameterSize: %w", err))
 		}
 
 		parameters = make([]byte, parameterSize)
 		if _, err := io.ReadFull(lr, parameters); err != nil {
-			return 0, nil, nil, fmt.Errorf("cannot read parameters: %w", err)
+			return 0, nil, nil, checkTruncated(fmt.Errorf("cannot read parameters: %w", err))
 		}
 
 		for lr.N > 0 {
 			var auth AuthResponse
 			if _, err := mu.UnmarshalFromReader(lr, &auth); err != nil {
-				return 0, nil, nil, fmt.Errorf("cannot unmarshal auth at index %d: %w", len(authArea), err)
+				return 0, nil, nil, checkTruncated(fmt.Errorf("cannot unmarshal auth at index %d: %w", len(authArea), err))
 			}
 
 			authArea = append(authArea, auth)
@@ -238,13 +255,17 @@ func ReadResponsePacket(r io.Reader, handle *Handle) (rc ResponseCode, parameter
 			if err == nil {
 				err = io.ErrUnexpectedEOF
 			}
-			return 0, nil, nil, fmt.Errorf("cannot read parameters: %w", err)
+			return 0, nil, nil, checkTruncated(fmt.Errorf("cannot read parameters: %w", err))
 		}
 	}
 
 	return header.ResponseCode, parameters, authArea, nil
 }
 
+func isTruncatedReadError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
 // ResponsePacket corresponds to a complete response packet including header and payload.
 //
 // Deprecated: use [ReadResponsePacket].
@@ -399,6 +420,38 @@ func (c *CommandContext) AddExtraSessions(sessions ...SessionContext) *CommandCo
 	return c
 }
 
+// CpHash computes the command parameter digest for the command defined by this context using
+// the specified digest algorithm. The digest is computed from the command code, the names of the
+// command handles and the marshalled command parameters, and is equivalent to the one computed
+// by [github.com/canonical/go-tpm2/policyutil.ComputeCpHash] for the same inputs.
+//
+// This doesn't execute the command, so it can be used to compute a digest for use with
+// [TPMContext.PolicyCpHash], or as the cpHashA argument of [TPMContext.PolicySigned],
+// [TPMContext.PolicySecret] or [TPMContext.PolicyTicket], in order to bind a policy session
+// to the command before it is dispatched. Note that the digest is computed from the
+// unencrypted parameters.
+func (c *CommandContext) CpHash(alg HashAlgorithmId) (Digest, error) {
+	if !alg.Available() {
+		return nil, fmt.Errorf("digest algorithm %v is not available", alg)
+	}
+
+	var handleNames []Name
+	for i, h := range c.cmd.Handles {
+		name := h.handle.Name()
+		if !name.IsValid() {
+			return nil, fmt.Errorf("invalid name for handle %d", i)
+		}
+		handleNames = append(handleNames, name)
+	}
+
+	cpBytes, err := mu.MarshalToBytes(c.cmd.Params...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal parameters for command %s: %w", c.cmd.CommandCode, err)
+	}
+
+	return cryptComputeCpHash(alg, c.cmd.CommandCode, handleNames, cpBytes), nil
+}
+
 // RunWithoutProcessingResponse executes the command defined by this context using the [TPMContext]
 // that created it. The caller supplies a pointer to the response handle if the command returns
 // one.
@@ -13,6 +13,7 @@ import (
 	. "github.com/canonical/go-tpm2"
 	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
 	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/policyutil"
 )
 
 type commandSuite struct{}
@@ -105,6 +106,9 @@ func (s *commandSuite) TestReadResponsePacketTooSmall(c *C) {
 
 	var e *mu.Error
 	c.Check(err, internal_testutil.ErrorAs, &e)
+
+	var fe *TransportFramingError
+	c.Check(err, internal_testutil.ErrorAs, &fe)
 }
 
 func (s *commandSuite) TestUnmarshalResponsePacketInvalidSize(c *C) {
@@ -117,6 +121,9 @@ func (s *commandSuite) TestReadResponsePacketInvalidSize(c *C) {
 	r := bytes.NewReader(internal_testutil.DecodeHexString(c, "80010000001000000000"))
 	_, _, _, err := ReadResponsePacket(r, nil)
 	c.Check(err, ErrorMatches, "cannot read parameters: unexpected EOF")
+
+	var fe *TransportFramingError
+	c.Check(err, internal_testutil.ErrorAs, &fe)
 }
 
 func (s *commandSuite) TestUnmarshalResponsePacketUnexpectedTPM1(c *C) {
@@ -159,6 +166,9 @@ func (s *commandSuite) TestReadResponsePacketUnsuccessfulWithSessions(c *C) {
 	_, _, _, err := ReadResponsePacket(r, nil)
 	c.Check(err, ErrorMatches, "\\[TPM_ST_SESSIONS\\]: invalid response code 0x0000088e")
 	c.Check(err, internal_testutil.ErrorIs, InvalidResponseCodeError(0x88e))
+
+	var fe *TransportFramingError
+	c.Check(errors.As(err, &fe), internal_testutil.IsFalse)
 }
 
 func (s *commandSuite) TestUnmarshalResponsePacketUnsuccessfulWithExtraBytes(c *C) {
@@ -171,6 +181,9 @@ func (s *commandSuite) TestReadResponsePacketUnsuccessfulWithExtraBytes(c *C) {
 	r := bytes.NewReader(internal_testutil.DecodeHexString(c, "80010000000c0000088ea5a5"))
 	_, _, _, err := ReadResponsePacket(r, nil)
 	c.Check(err, ErrorMatches, "invalid response size for unsuccessful response \\(12\\)")
+
+	var fe *TransportFramingError
+	c.Check(err, internal_testutil.ErrorAs, &fe)
 }
 
 func (s *commandSuite) TestUnmarshalResponsePacketInvalidTag(c *C) {
@@ -183,6 +196,18 @@ func (s *commandSuite) TestReadResponsePacketInvalidTag(c *C) {
 	r := bytes.NewReader(internal_testutil.DecodeHexString(c, "00010000000a00000000"))
 	_, _, _, err := ReadResponsePacket(r, nil)
 	c.Check(err, ErrorMatches, "invalid tag: 1")
+
+	var fe *TransportFramingError
+	c.Check(err, internal_testutil.ErrorAs, &fe)
+}
+
+func (s *commandSuite) TestReadResponsePacketSizeSmallerThanHeader(c *C) {
+	r := bytes.NewReader(internal_testutil.DecodeHexString(c, "80010000000800000000"))
+	_, _, _, err := ReadResponsePacket(r, nil)
+	c.Check(err, ErrorMatches, "invalid response size \\(8\\)")
+
+	var fe *TransportFramingError
+	c.Check(err, internal_testutil.ErrorAs, &fe)
 }
 
 func (s *commandSuite) TestUnmarshalResponseHandleFail(c *C) {
@@ -199,6 +224,10 @@ func (s *commandSuite) TestReadResponseHandleFail(c *C) {
 	var handle Handle
 	_, _, _, err := ReadResponsePacket(r, &handle)
 	c.Check(err, ErrorMatches, "cannot unmarshal handle: cannot unmarshal argument 0 whilst processing element of type tpm2.Handle: unexpected EOF")
+
+	// The packet is consistent with its header, so this isn't a framing error.
+	var fe *TransportFramingError
+	c.Check(errors.As(err, &fe), internal_testutil.IsFalse)
 }
 
 func (s *commandSuite) TestUnmarshalResponseParamSizeFail(c *C) {
@@ -223,6 +252,9 @@ func (s *commandSuite) TestReadResponsePacketInvalidParamSize(c *C) {
 	r := bytes.NewReader(internal_testutil.DecodeHexString(c, "80020000001a00000000000010070005a5a5a5a5a50000010000"))
 	_, _, _, err := ReadResponsePacket(r, nil)
 	c.Check(err, ErrorMatches, "cannot read parameters: unexpected EOF")
+
+	var fe *TransportFramingError
+	c.Check(errors.As(err, &fe), internal_testutil.IsFalse)
 }
 
 func (s *commandSuite) TestUnmarshalResponsePacketInvalidAuthArea(c *C) {
@@ -563,3 +595,39 @@ func (s *commandSuite) TestCommandContextRunWithCompleteError(c *C) {
 
 	c.Check(context.Run(nil), Equals, dispatcher.completeErr)
 }
+
+func (s *commandSuite) TestCommandContextCpHash(c *C) {
+	nv := NewLimitedResourceContext(0x01800000, internal_testutil.DecodeHexString(c, "000bd3a5f7e4a6c6c0d8b10c1f6b5bb21c3fd6ab1a45eefe1deb1e8ac778f44b55f5"))
+
+	tpm := new(TPMContext)
+	cmd := tpm.StartCommand(CommandNVWrite).
+		AddHandles(UseResourceContextWithAuth(nv, nil), UseHandleContext(nv)).
+		AddParams(MaxNVBuffer("foo"), uint16(4))
+
+	cpHash, err := cmd.CpHash(HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+
+	expected, err := policyutil.ComputeCpHash(HashAlgorithmSHA256, CommandNVWrite, []policyutil.Named{nv, nv}, MaxNVBuffer("foo"), uint16(4))
+	c.Check(err, IsNil)
+	c.Check(cpHash, DeepEquals, expected)
+}
+
+func (s *commandSuite) TestCommandContextCpHashNullHandle(c *C) {
+	tpm := new(TPMContext)
+	cmd := tpm.StartCommand(CommandHashSequenceStart).
+		AddHandles(UseHandleContext(nil)).
+		AddParams(Auth("bar"), HashAlgorithmSHA1)
+
+	cpHash, err := cmd.CpHash(HashAlgorithmSHA1)
+	c.Check(err, IsNil)
+
+	expected, err := policyutil.ComputeCpHash(HashAlgorithmSHA1, CommandHashSequenceStart, []policyutil.Named{MakeHandleName(HandleNull)}, Auth("bar"), HashAlgorithmSHA1)
+	c.Check(err, IsNil)
+	c.Check(cpHash, DeepEquals, expected)
+}
+
+func (s *commandSuite) TestCommandContextCpHashUnavailableAlg(c *C) {
+	tpm := new(TPMContext)
+	_, err := tpm.StartCommand(CommandUnseal).CpHash(HashAlgorithmSM3_256)
+	c.Check(err, ErrorMatches, `digest algorithm TPM_ALG_SM3_256 is not available`)
+}
@@ -13,6 +13,7 @@ import (
 	"crypto/rsa"
 	"encoding/binary"
 	"fmt"
+	"io"
 
 	internal_crypt "github.com/canonical/go-tpm2/internal/crypt"
 )
@@ -34,7 +35,12 @@ var (
 
 // RegisterCipher allows a go block cipher implementation to be registered for the
 // specified algorithm, so binaries don't need to link against every implementation.
+// Supplying a nil fn removes any existing registration for the algorithm.
 func RegisterCipher(alg SymAlgorithmId, fn NewCipherFunc) {
+	if fn == nil {
+		delete(symmetricAlgs, alg)
+		return
+	}
 	symmetricAlgs[alg] = fn
 }
 
@@ -60,12 +66,21 @@ func cryptComputeRpHash(hashAlg HashAlgorithmId, responseCode ResponseCode, comm
 	return hash.Sum(nil)
 }
 
-func cryptComputeNonce(nonce []byte) error {
-	_, err := rand.Read(nonce)
+// cryptRandReader returns the supplied source of randomness, or [rand.Reader] if
+// none is supplied.
+func cryptRandReader(r io.Reader) io.Reader {
+	if r == nil {
+		return rand.Reader
+	}
+	return r
+}
+
+func cryptComputeNonce(r io.Reader, nonce []byte) error {
+	_, err := io.ReadFull(cryptRandReader(r), nonce)
 	return err
 }
 
-func cryptSecretEncrypt(public *Public, label []byte) (EncryptedSecret, []byte, error) {
+func cryptSecretEncrypt(r io.Reader, public *Public, label []byte) (EncryptedSecret, []byte, error) {
 	if !public.NameAlg.Available() {
 		return nil, nil, fmt.Errorf("nameAlg %v is not available", public.NameAlg)
 	}
@@ -83,5 +98,5 @@ func cryptSecretEncrypt(public *Public, label []byte) (EncryptedSecret, []byte,
 		}
 	}
 
-	return internal_crypt.SecretEncrypt(rand.Reader, pub, public.NameAlg.GetHash(), label)
+	return internal_crypt.SecretEncrypt(cryptRandReader(r), pub, public.NameAlg.GetHash(), label)
 }
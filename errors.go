@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sync"
 )
 
 const (
@@ -90,6 +91,32 @@ func (e *InvalidResponseError) Error() string {
 	return fmt.Sprintf("TPM returned an invalid response for command %s: %v", e.Command, e.err.Error())
 }
 
+// TransportFramingError is returned from [ReadResponsePacket] if a response packet isn't framed
+// correctly, which indicates a problem with the device or transport rather than with the content
+// of the response. This is the case if:
+//
+//   - The response header is truncated.
+//   - The response tag is invalid.
+//   - The responseSize field in the response header is inconsistent with the response code, or is
+//     smaller than the response header.
+//   - The response packet is shorter than the size indicated by the response header.
+//
+// Any [TPMContext] method that executes a TPM command will return this wrapped in an
+// [InvalidResponseError] in order to preserve the existing behaviour, so callers that want to
+// handle framing errors differently should test for this error with [errors.As] before testing
+// for [InvalidResponseError]. Transport I/O errors are returned as [TransportError].
+type TransportFramingError struct {
+	err error
+}
+
+func (e *TransportFramingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *TransportFramingError) Unwrap() error {
+	return e.err
+}
+
 // InvalidAuthResponseError is returned from any [TPMContext] method that executes a TPM command if
 // one of the response auth HMACs is invalid. If this error occurs, session contexts associated
 // with the command that caused this error should be considered invalid.
@@ -124,11 +151,57 @@ func (e *TransportError) Unwrap() error {
 	return e.err
 }
 
+type vendorErrorKey struct {
+	manufacturer uint32
+	code         ResponseCode
+}
+
+var (
+	vendorErrorsMu sync.RWMutex
+	vendorErrors   = make(map[vendorErrorKey]string)
+)
+
+// RegisterVendorError registers a human-readable description for the vendor-specific
+// response code from the TPM manufacturer with the specified TPM_PT_MANUFACTURER value.
+// The description is included in the string representation of a *[TPMVendorError] with
+// the same manufacturer and response code. This is safe to call from init functions and
+// from multiple goroutines.
+//
+// The manufacturer of a TPM is only known once [TPMContext.InitProperties] has been called,
+// either explicitly or by another function that requires the TPM's properties. Vendor errors
+// returned before this don't have a manufacturer, and so they aren't described.
+func RegisterVendorError(manufacturer uint32, code ResponseCode, description string) {
+	vendorErrorsMu.Lock()
+	defer vendorErrorsMu.Unlock()
+	vendorErrors[vendorErrorKey{manufacturer: manufacturer, code: code}] = description
+}
+
+// UnregisterVendorError removes a description previously registered with
+// [RegisterVendorError] for the specified manufacturer and vendor-specific response code.
+// This is safe to call from multiple goroutines.
+func UnregisterVendorError(manufacturer uint32, code ResponseCode) {
+	vendorErrorsMu.Lock()
+	defer vendorErrorsMu.Unlock()
+	delete(vendorErrors, vendorErrorKey{manufacturer: manufacturer, code: code})
+}
+
+func vendorErrorDescription(manufacturer uint32, code ResponseCode) (description string, ok bool) {
+	vendorErrorsMu.RLock()
+	defer vendorErrorsMu.RUnlock()
+	description, ok = vendorErrors[vendorErrorKey{manufacturer: manufacturer, code: code}]
+	return description, ok
+}
+
 // TPMVendorError represents a TPM response that indicates a vendor-specific error
 // (rc & 0x580 == 0x500).
 type TPMVendorError struct {
 	Command CommandCode  // Command code associated with this error
 	Code    ResponseCode // Response code
+
+	// Manufacturer is the TPM_PT_MANUFACTURER value of the TPM that returned this
+	// error, if it is known. This is set by TPMContext once its properties have been
+	// initialized by TPMContext.InitProperties, and is zero otherwise.
+	Manufacturer uint32
 }
 
 // ResponseCode returns a TPM response code for this error.
@@ -140,7 +213,16 @@ func (e *TPMVendorError) ResponseCode() ResponseCode {
 	return e.Code
 }
 
+func (e *TPMVendorError) commandCode() CommandCode {
+	return e.Command
+}
+
 func (e *TPMVendorError) Error() string {
+	if e.Manufacturer != 0 {
+		if description, ok := vendorErrorDescription(e.Manufacturer, e.Code); ok {
+			return fmt.Sprintf("TPM returned a vendor defined error whilst executing command %s: 0x%08x (%s)", e.Command, e.Code, description)
+		}
+	}
 	return fmt.Sprintf("TPM returned a vendor defined error whilst executing command %s: 0x%08x", e.Command, e.Code)
 }
 
@@ -220,6 +302,10 @@ func (e *TPMWarning) ResponseCode() ResponseCode {
 	return responseCodeS | responseCodeV | ResponseCode(e.Code)
 }
 
+func (e *TPMWarning) commandCode() CommandCode {
+	return e.Command
+}
+
 func (e *TPMWarning) Error() string {
 	var builder bytes.Buffer
 	fmt.Fprintf(&builder, "TPM returned a warning whilst executing command %s: %s", e.Command, e.Code)
@@ -493,6 +579,10 @@ func (TPMErrorBadTag) ResponseCode() ResponseCode {
 	return ResponseBadTag
 }
 
+func (e *TPMErrorBadTag) commandCode() CommandCode {
+	return e.Command
+}
+
 func (e *TPMErrorBadTag) Error() string {
 	return fmt.Sprintf("TPM returned a TPM_RC_BAD_TAG error whilst executing command %s", e.Command)
 }
@@ -517,6 +607,12 @@ func (e *TPMError) ResponseCode() ResponseCode {
 	return responseCodeV | ResponseCode(e.Code)
 }
 
+// commandCode is promoted to *TPMHandleError, *TPMSessionError and
+// *TPMParameterError.
+func (e *TPMError) commandCode() CommandCode {
+	return e.Command
+}
+
 func (e *TPMError) Error() string {
 	var builder bytes.Buffer
 	fmt.Fprintf(&builder, "TPM returned an error whilst executing command %s: %s", e.Command, e.Code)
@@ -709,6 +805,23 @@ func IsTPMWarning(err error, code WarningCode, command CommandCode) bool {
 	return errors.Is(err, &TPMWarning{Command: command, Code: code})
 }
 
+// CommandCodeFromError returns the command code associated with the first TPM error in the
+// chain of the supplied error, if there is one. The TPM errors that are associated with a
+// command code are *[TPMError], *[TPMWarning], *[TPMHandleError], *[TPMSessionError],
+// *[TPMParameterError], *[TPMVendorError] and *[TPMErrorBadTag]. If the supplied error chain
+// doesn't contain one of these, false is returned. The chain is searched in the same
+// way as [errors.As], including errors that wrap multiple errors.
+func CommandCodeFromError(err error) (CommandCode, bool) {
+	var e interface {
+		error
+		commandCode() CommandCode
+	}
+	if !errors.As(err, &e) {
+		return 0, false
+	}
+	return e.commandCode(), true
+}
+
 // InvalidResponseCode is returned from [DecodeResponseCode] and any [TPMContext] method that
 // executes a command on the TPM if the TPM response code is invalid.
 type InvalidResponseCodeError ResponseCode
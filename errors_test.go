@@ -6,6 +6,7 @@ package tpm2_test
 
 import (
 	"errors"
+	"fmt"
 
 	. "gopkg.in/check.v1"
 
@@ -58,6 +59,38 @@ func (s *errorsSuite) TestDecodeVendorError(c *C) {
 	c.Check(err.(*TPMVendorError), DeepEquals, &TPMVendorError{Command: CommandLoad, Code: rc})
 }
 
+func (s *errorsSuite) TestVendorErrorRegistered(c *C) {
+	RegisterVendorError(0x54455354, 0x0000057f, "some vendor error")
+	defer UnregisterVendorError(0x54455354, 0x0000057f)
+
+	err := &TPMVendorError{Command: CommandLoad, Code: 0x0000057f, Manufacturer: 0x54455354}
+	c.Check(err, ErrorMatches, `TPM returned a vendor defined error whilst executing command TPM_CC_Load: 0x0000057f \(some vendor error\)`)
+}
+
+func (s *errorsSuite) TestVendorErrorUnregisteredManufacturer(c *C) {
+	RegisterVendorError(0x54455354, 0x0000057f, "some vendor error")
+	defer UnregisterVendorError(0x54455354, 0x0000057f)
+
+	err := &TPMVendorError{Command: CommandLoad, Code: 0x0000057f, Manufacturer: 0x41424344}
+	c.Check(err, ErrorMatches, `TPM returned a vendor defined error whilst executing command TPM_CC_Load: 0x0000057f`)
+}
+
+func (s *errorsSuite) TestVendorErrorUnknownManufacturer(c *C) {
+	RegisterVendorError(0x54455354, 0x0000057f, "some vendor error")
+	defer UnregisterVendorError(0x54455354, 0x0000057f)
+
+	err := &TPMVendorError{Command: CommandLoad, Code: 0x0000057f}
+	c.Check(err, ErrorMatches, `TPM returned a vendor defined error whilst executing command TPM_CC_Load: 0x0000057f`)
+}
+
+func (s *errorsSuite) TestVendorErrorUnregister(c *C) {
+	RegisterVendorError(0x54455354, 0x0000057f, "some vendor error")
+	UnregisterVendorError(0x54455354, 0x0000057f)
+
+	err := &TPMVendorError{Command: CommandLoad, Code: 0x0000057f, Manufacturer: 0x54455354}
+	c.Check(err, ErrorMatches, `TPM returned a vendor defined error whilst executing command TPM_CC_Load: 0x0000057f`)
+}
+
 func (s *errorsSuite) TestDecodeWarning(c *C) {
 	err := DecodeResponseCode(CommandNVWrite, 0x923)
 	c.Check(err, ErrorMatches, "TPM returned a warning whilst executing command TPM_CC_NV_Write: TPM_RC_NV_UNAVAILABLE \\(the command may require writing of NV and NV is not current accessible\\)")
@@ -348,3 +381,62 @@ func (s *errorsSuite) TestResourceUnavailableErrorIs5(c *C) {
 	err := ResourceUnavailableError{Handle: 0x81000001}
 	c.Check(err.Is(errors.New("error")), internal_testutil.IsFalse)
 }
+
+func (s *errorsSuite) TestCommandCodeFromError(c *C) {
+	for _, data := range []struct {
+		err      error
+		expected CommandCode
+	}{
+		{err: &TPMError{Command: CommandNVWrite, Code: ErrorValue}, expected: CommandNVWrite},
+		{err: &TPMWarning{Command: CommandLoad, Code: WarningObjectMemory}, expected: CommandLoad},
+		{err: &TPMHandleError{TPMError: &TPMError{Command: CommandUnseal, Code: ErrorHandle}, Index: 1}, expected: CommandUnseal},
+		{err: &TPMSessionError{TPMError: &TPMError{Command: CommandPolicySecret, Code: ErrorAuthFail}, Index: 1}, expected: CommandPolicySecret},
+		{err: &TPMParameterError{TPMError: &TPMError{Command: CommandCreate, Code: ErrorSize}, Index: 2}, expected: CommandCreate},
+		{err: &TPMVendorError{Command: CommandGetRandom, Code: 0xa0000001}, expected: CommandGetRandom},
+		{err: &TPMErrorBadTag{Command: CommandStartup}, expected: CommandStartup},
+	} {
+		command, ok := CommandCodeFromError(data.err)
+		c.Check(ok, internal_testutil.IsTrue, Commentf("%v", data.err))
+		c.Check(command, Equals, data.expected, Commentf("%v", data.err))
+	}
+}
+
+func (s *errorsSuite) TestCommandCodeFromErrorWrapped(c *C) {
+	err := &TPMSessionError{TPMError: &TPMError{Command: CommandPolicyNV, Code: ErrorPolicy}, Index: 1}
+	wrapped := fmt.Errorf("cannot run branch: %w", fmt.Errorf("cannot run assertion: %w", err))
+
+	command, ok := CommandCodeFromError(wrapped)
+	c.Check(ok, internal_testutil.IsTrue)
+	c.Check(command, Equals, CommandPolicyNV)
+}
+
+// multiError wraps multiple errors in the same way as the error returned from
+// errors.Join.
+type multiError []error
+
+func (e multiError) Error() string {
+	return "multiple errors"
+}
+
+func (e multiError) Unwrap() []error {
+	return e
+}
+
+func (s *errorsSuite) TestCommandCodeFromErrorMultiple(c *C) {
+	err := &TPMParameterError{TPMError: &TPMError{Command: CommandLoad, Code: ErrorSize}, Index: 2}
+	wrapped := fmt.Errorf("cannot load object: %w", multiError{errors.New("some error"), fmt.Errorf("cannot run command: %w", err)})
+
+	command, ok := CommandCodeFromError(wrapped)
+	c.Check(ok, internal_testutil.IsTrue)
+	c.Check(command, Equals, CommandLoad)
+}
+
+func (s *errorsSuite) TestCommandCodeFromErrorNoTPMError(c *C) {
+	_, ok := CommandCodeFromError(fmt.Errorf("some error: %w", errors.New("another error")))
+	c.Check(ok, internal_testutil.IsFalse)
+}
+
+func (s *errorsSuite) TestCommandCodeFromErrorNil(c *C) {
+	_, ok := CommandCodeFromError(nil)
+	c.Check(ok, internal_testutil.IsFalse)
+}
@@ -0,0 +1,294 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+// Package cbor implements the small subset of CBOR (RFC 8949) that is needed to
+// encode policies. Only unsigned integers, byte strings, text strings, booleans,
+// arrays and maps with unsigned integer keys are supported.
+//
+// Values are always encoded deterministically as described in section 4.2.1 of
+// RFC 8949: integers and lengths use the shortest possible encoding, only definite
+// lengths are used and map entries are sorted by key. Input that is not encoded in
+// this way is rejected by [Unmarshal], so that every value has exactly one valid
+// encoding.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	majorUint       = 0
+	majorByteString = 2
+	majorTextString = 3
+	majorArray      = 4
+	majorMap        = 5
+	majorSimple     = 7
+
+	simpleFalse = 20
+	simpleTrue  = 21
+
+	maxDepth = 64
+)
+
+// Map represents a CBOR map with unsigned integer keys.
+type Map map[uint64]interface{}
+
+// Marshal returns the deterministic encoding of the supplied value, which must be
+// a uint64, []byte, string, bool, []interface{} or [Map]. The elements of arrays and
+// the values of maps must also be one of these types.
+func Marshal(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := encode(buf, v, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func encode(buf *bytes.Buffer, v interface{}, depth int) error {
+	if depth > maxDepth {
+		return errors.New("maximum nesting depth exceeded")
+	}
+
+	switch v := v.(type) {
+	case uint64:
+		encodeHead(buf, majorUint, v)
+	case []byte:
+		encodeHead(buf, majorByteString, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		if !utf8.ValidString(v) {
+			return errors.New("invalid UTF-8 text string")
+		}
+		encodeHead(buf, majorTextString, uint64(len(v)))
+		buf.WriteString(v)
+	case bool:
+		if v {
+			buf.WriteByte(majorSimple<<5 | simpleTrue)
+		} else {
+			buf.WriteByte(majorSimple<<5 | simpleFalse)
+		}
+	case []interface{}:
+		encodeHead(buf, majorArray, uint64(len(v)))
+		for i, e := range v {
+			if err := encode(buf, e, depth+1); err != nil {
+				return fmt.Errorf("cannot encode array element %d: %w", i, err)
+			}
+		}
+	case Map:
+		keys := make([]uint64, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+		encodeHead(buf, majorMap, uint64(len(v)))
+		for _, k := range keys {
+			encodeHead(buf, majorUint, k)
+			if err := encode(buf, v[k], depth+1); err != nil {
+				return fmt.Errorf("cannot encode value for map key %d: %w", k, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+
+	return nil
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) remaining() int {
+	return len(d.data) - d.off
+}
+
+func (d *decoder) decodeHead() (major byte, n uint64, err error) {
+	if d.remaining() < 1 {
+		return 0, 0, errors.New("unexpected end of data")
+	}
+	b := d.data[d.off]
+	d.off++
+
+	major = b >> 5
+	info := b & 0x1f
+	if major == majorSimple {
+		return major, uint64(info), nil
+	}
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31:
+		return 0, 0, errors.New("indefinite lengths are not supported")
+	default:
+		return 0, 0, fmt.Errorf("invalid additional information %d", info)
+	}
+
+	if d.remaining() < size {
+		return 0, 0, errors.New("unexpected end of data")
+	}
+	for _, b := range d.data[d.off : d.off+size] {
+		n = n<<8 | uint64(b)
+	}
+	d.off += size
+
+	// Reject encodings that aren't the shortest possible.
+	var min uint64
+	switch size {
+	case 1:
+		min = 24
+	case 2:
+		min = math.MaxUint8 + 1
+	case 4:
+		min = math.MaxUint16 + 1
+	case 8:
+		min = math.MaxUint32 + 1
+	}
+	if n < min {
+		return 0, 0, errors.New("non-minimal integer or length encoding")
+	}
+
+	return major, n, nil
+}
+
+func (d *decoder) decodeBytes(n uint64) ([]byte, error) {
+	if n > uint64(d.remaining()) {
+		return nil, errors.New("unexpected end of data")
+	}
+	b := make([]byte, n)
+	copy(b, d.data[d.off:])
+	d.off += int(n)
+	return b, nil
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("maximum nesting depth exceeded")
+	}
+
+	major, n, err := d.decodeHead()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		return n, nil
+	case majorByteString:
+		return d.decodeBytes(n)
+	case majorTextString:
+		b, err := d.decodeBytes(n)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.New("invalid UTF-8 text string")
+		}
+		return string(b), nil
+	case majorArray:
+		// Every element is at least 1 byte.
+		if n > uint64(d.remaining()) {
+			return nil, errors.New("unexpected end of data")
+		}
+		out := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			e, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode array element %d: %w", i, err)
+			}
+			out = append(out, e)
+		}
+		return out, nil
+	case majorMap:
+		// Every entry is at least 2 bytes.
+		if n > uint64(d.remaining()/2) {
+			return nil, errors.New("unexpected end of data")
+		}
+		out := make(Map)
+		var last uint64
+		for i := uint64(0); i < n; i++ {
+			keyMajor, k, err := d.decodeHead()
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode map key %d: %w", i, err)
+			}
+			if keyMajor != majorUint {
+				return nil, fmt.Errorf("unsupported map key type %d", keyMajor)
+			}
+			if i > 0 && k <= last {
+				return nil, fmt.Errorf("map key %d is duplicated or not sorted", k)
+			}
+			last = k
+
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode value for map key %d: %w", k, err)
+			}
+			out[k] = v
+		}
+		return out, nil
+	case majorSimple:
+		switch n {
+		case simpleFalse:
+			return false, nil
+		case simpleTrue:
+			return true, nil
+		default:
+			return nil, fmt.Errorf("unsupported simple value or float %d", n)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported major type %d", major)
+	}
+}
+
+// Unmarshal decodes the supplied data, which must contain exactly one value that is
+// deterministically encoded. The returned value is a uint64, []byte, string, bool,
+// []interface{} or [Map].
+func Unmarshal(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.remaining() > 0 {
+		return nil, fmt.Errorf("%d bytes of trailing data", d.remaining())
+	}
+	return v, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package cbor_test
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2/internal/cbor"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type cborSuite struct{}
+
+var _ = Suite(&cborSuite{})
+
+type testMarshalData struct {
+	value    interface{}
+	expected []byte
+}
+
+func (s *cborSuite) testMarshal(c *C, data *testMarshalData) {
+	b, err := Marshal(data.value)
+	c.Assert(err, IsNil)
+	c.Check(b, DeepEquals, data.expected)
+
+	v, err := Unmarshal(b)
+	c.Assert(err, IsNil)
+	c.Check(v, DeepEquals, data.value)
+}
+
+func (s *cborSuite) TestMarshalSmallUint(c *C) {
+	s.testMarshal(c, &testMarshalData{
+		value:    uint64(23),
+		expected: internal_testutil.DecodeHexString(c, "17")})
+}
+
+func (s *cborSuite) TestMarshalUint8(c *C) {
+	s.testMarshal(c, &testMarshalData{
+		value:    uint64(24),
+		expected: internal_testutil.DecodeHexString(c, "1818")})
+}
+
+func (s *cborSuite) TestMarshalUint16(c *C) {
+	s.testMarshal(c, &testMarshalData{
+		value:    uint64(1000),
+		expected: internal_testutil.DecodeHexString(c, "1903e8")})
+}
+
+func (s *cborSuite) TestMarshalUint32(c *C) {
+	s.testMarshal(c, &testMarshalData{
+		value:    uint64(1000000),
+		expected: internal_testutil.DecodeHexString(c, "1a000f4240")})
+}
+
+func (s *cborSuite) TestMarshalUint64(c *C) {
+	s.testMarshal(c, &testMarshalData{
+		value:    uint64(1000000000000),
+		expected: internal_testutil.DecodeHexString(c, "1b000000e8d4a51000")})
+}
+
+func (s *cborSuite) TestMarshalByteString(c *C) {
+	s.testMarshal(c, &testMarshalData{
+		value:    []byte{1, 2, 3, 4},
+		expected: internal_testutil.DecodeHexString(c, "4401020304")})
+}
+
+func (s *cborSuite) TestMarshalTextString(c *C) {
+	s.testMarshal(c, &testMarshalData{
+		value:    "IETF",
+		expected: internal_testutil.DecodeHexString(c, "6449455446")})
+}
+
+func (s *cborSuite) TestMarshalBool(c *C) {
+	s.testMarshal(c, &testMarshalData{
+		value:    []interface{}{false, true},
+		expected: internal_testutil.DecodeHexString(c, "82f4f5")})
+}
+
+func (s *cborSuite) TestMarshalArray(c *C) {
+	s.testMarshal(c, &testMarshalData{
+		value:    []interface{}{uint64(1), []interface{}{uint64(2), uint64(3)}, []interface{}{uint64(4), uint64(5)}},
+		expected: internal_testutil.DecodeHexString(c, "8301820203820405")})
+}
+
+func (s *cborSuite) TestMarshalMap(c *C) {
+	// Keys are sorted in the encoding.
+	s.testMarshal(c, &testMarshalData{
+		value:    Map{1000: "b", 2: []byte{}, 1: uint64(1)},
+		expected: internal_testutil.DecodeHexString(c, "a3010102401903e86162")})
+}
+
+func (s *cborSuite) TestMarshalUnsupportedType(c *C) {
+	_, err := Marshal([]interface{}{uint32(1)})
+	c.Check(err, ErrorMatches, `cannot encode array element 0: unsupported type uint32`)
+}
+
+func (s *cborSuite) TestMarshalInvalidUTF8(c *C) {
+	_, err := Marshal(Map{1: "\xff"})
+	c.Check(err, ErrorMatches, `cannot encode value for map key 1: invalid UTF-8 text string`)
+}
+
+func (s *cborSuite) TestUnmarshalIndefiniteLength(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "9f0102ff"))
+	c.Check(err, ErrorMatches, `indefinite lengths are not supported`)
+}
+
+func (s *cborSuite) TestUnmarshalNonMinimal(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "190017"))
+	c.Check(err, ErrorMatches, `non-minimal integer or length encoding`)
+}
+
+func (s *cborSuite) TestUnmarshalUnsortedMap(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "a202000100"))
+	c.Check(err, ErrorMatches, `map key 1 is duplicated or not sorted`)
+}
+
+func (s *cborSuite) TestUnmarshalDuplicateMapKey(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "a201000101"))
+	c.Check(err, ErrorMatches, `map key 1 is duplicated or not sorted`)
+}
+
+func (s *cborSuite) TestUnmarshalUnsupportedMapKey(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "a1616100"))
+	c.Check(err, ErrorMatches, `unsupported map key type 3`)
+}
+
+func (s *cborSuite) TestUnmarshalNegativeInt(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "20"))
+	c.Check(err, ErrorMatches, `unsupported major type 1`)
+}
+
+func (s *cborSuite) TestUnmarshalFloat(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "f93c00"))
+	c.Check(err, ErrorMatches, `unsupported simple value or float 25`)
+}
+
+func (s *cborSuite) TestUnmarshalTruncated(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "83011901"))
+	c.Check(err, ErrorMatches, `cannot decode array element 1: unexpected end of data`)
+}
+
+func (s *cborSuite) TestUnmarshalTrailingData(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "0102"))
+	c.Check(err, ErrorMatches, `1 bytes of trailing data`)
+}
+
+func (s *cborSuite) TestUnmarshalLengthTooLarge(c *C) {
+	_, err := Unmarshal(internal_testutil.DecodeHexString(c, "5affffffff"))
+	c.Check(err, ErrorMatches, `unexpected end of data`)
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+)
+
+const (
+	ctrDRBGKeyLen  = 32
+	ctrDRBGSeedLen = ctrDRBGKeyLen + aes.BlockSize
+
+	// CTRDRBGSeedLen is the number of bytes of entropy required to
+	// instantiate or reseed a CTRDRBG.
+	CTRDRBGSeedLen = ctrDRBGSeedLen
+
+	// CTRDRBGMaxRequestLen is the maximum number of bytes that can be
+	// returned from a single call to CTRDRBG.Generate.
+	CTRDRBGMaxRequestLen = 1 << 16
+)
+
+// CTRDRBG is an implementation of CTR_DRBG using AES-256 and without a
+// derivation function, as described in NIST SP800-90A.
+type CTRDRBG struct {
+	block cipher.Block
+	v     [aes.BlockSize]byte
+}
+
+// NewCTRDRBG instantiates a new CTRDRBG with the supplied entropy input,
+// which must be CTRDRBGSeedLen bytes long.
+func NewCTRDRBG(entropy []byte) (*CTRDRBG, error) {
+	d := new(CTRDRBG)
+	if err := d.setKey(make([]byte, ctrDRBGKeyLen)); err != nil {
+		return nil, err
+	}
+	if err := d.Reseed(entropy); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *CTRDRBG) setKey(key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	d.block = block
+	return nil
+}
+
+func (d *CTRDRBG) incrementV() {
+	for i := len(d.v) - 1; i >= 0; i-- {
+		d.v[i]++
+		if d.v[i] != 0 {
+			break
+		}
+	}
+}
+
+func (d *CTRDRBG) update(provided []byte) {
+	var temp [ctrDRBGSeedLen]byte
+	for i := 0; i < len(temp); i += aes.BlockSize {
+		d.incrementV()
+		d.block.Encrypt(temp[i:], d.v[:])
+	}
+	for i := range provided {
+		temp[i] ^= provided[i]
+	}
+	if err := d.setKey(temp[:ctrDRBGKeyLen]); err != nil {
+		panic(err)
+	}
+	copy(d.v[:], temp[ctrDRBGKeyLen:])
+}
+
+// Reseed reseeds this CTRDRBG with the supplied entropy input, which must
+// be CTRDRBGSeedLen bytes long.
+func (d *CTRDRBG) Reseed(entropy []byte) error {
+	if len(entropy) != ctrDRBGSeedLen {
+		return errors.New("invalid entropy length")
+	}
+	d.update(entropy)
+	return nil
+}
+
+// Generate fills the supplied buffer with pseudorandom bytes. The buffer
+// must not be longer than CTRDRBGMaxRequestLen bytes.
+func (d *CTRDRBG) Generate(out []byte) error {
+	return d.GenerateWithAdditionalInput(out, nil)
+}
+
+// GenerateWithAdditionalInput fills the supplied buffer with pseudorandom
+// bytes, mixing in the supplied additional input, which must not be longer
+// than CTRDRBGSeedLen bytes. The buffer must not be longer than
+// CTRDRBGMaxRequestLen bytes.
+func (d *CTRDRBG) GenerateWithAdditionalInput(out, additionalInput []byte) error {
+	if len(out) > CTRDRBGMaxRequestLen {
+		return errors.New("request too large")
+	}
+	if len(additionalInput) > ctrDRBGSeedLen {
+		return errors.New("invalid additional input length")
+	}
+	if len(additionalInput) > 0 {
+		d.update(additionalInput)
+	}
+
+	var block [aes.BlockSize]byte
+	for len(out) > 0 {
+		d.incrementV()
+		d.block.Encrypt(block[:], d.v[:])
+		out = out[copy(out, block[:]):]
+	}
+	d.update(additionalInput)
+	return nil
+}
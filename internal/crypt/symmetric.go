@@ -6,6 +6,7 @@ package crypt
 
 import (
 	"crypto/cipher"
+	"errors"
 	"fmt"
 )
 
@@ -20,6 +21,9 @@ func SymmetricEncrypt(alg SymmetricAlgorithm, key, iv, data []byte) error {
 	if err != nil {
 		return fmt.Errorf("cannot create cipher: %w", err)
 	}
+	if len(iv) != c.BlockSize() {
+		return errors.New("IV length does not match cipher block size")
+	}
 	// The TPM uses CFB cipher mode for all secret sharing
 	s := cipher.NewCFBEncrypter(c, iv)
 	s.XORKeyStream(data, data)
@@ -33,6 +37,9 @@ func SymmetricDecrypt(alg SymmetricAlgorithm, key, iv, data []byte) error {
 	if err != nil {
 		return fmt.Errorf("cannot create cipher: %w", err)
 	}
+	if len(iv) != c.BlockSize() {
+		return errors.New("IV length does not match cipher block size")
+	}
 	// The TPM uses CFB cipher mode for all secret sharing
 	s := cipher.NewCFBDecrypter(c, iv)
 	s.XORKeyStream(data, data)
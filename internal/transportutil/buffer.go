@@ -2,6 +2,7 @@ package transportutil
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -18,7 +19,8 @@ type commandBuffer struct {
 
 // BufferCommands buffers command packets written to the returned writer and
 // writes complete packets to the supplied writer in a single write. The
-// maxCommandSize argument defines the maximum size of a command.
+// maxCommandSize argument defines the maximum size of a command. Any partially
+// buffered command is discarded if a command header is invalid.
 func BufferCommands(w io.Writer, maxCommandSize uint32) io.Writer {
 	return &commandBuffer{w: w, maxCommandSize: maxCommandSize}
 }
@@ -36,8 +38,10 @@ func (b *commandBuffer) Write(data []byte) (n int, err error) {
 		b.buf = buf
 		return n, nil
 	case err != nil:
+		b.buf = nil
 		return 0, fmt.Errorf("cannot decode command header: %w", err)
-	case hdr.CommandSize > b.maxCommandSize:
+	case hdr.CommandSize < uint32(binary.Size(hdr)) || hdr.CommandSize > b.maxCommandSize:
+		b.buf = nil
 		return 0, fmt.Errorf("invalid command size (%d bytes)", hdr.CommandSize)
 	}
 
@@ -73,9 +77,12 @@ type responseBuffer struct {
 }
 
 // BufferResponses reads complete response packets from the supplied reader
-// in a single read and makes them available to the returned reader for partial
-// reading. The maxResponseSize argument defines the size of the read on the
-// supplied reader.
+// and makes them available to the returned reader for partial reading. The
+// maxResponseSize argument defines the size of the initial read on the supplied
+// reader, and the maximum size of a response. If the initial read returns fewer
+// bytes than the size indicated by the response header, further reads are
+// performed on the supplied reader until the response is complete. An error is
+// returned if the response header indicates a size larger than maxResponseSize.
 func BufferResponses(r io.Reader, maxResponseSize uint32) io.Reader {
 	return &responseBuffer{r: r, maxResponseSize: maxResponseSize}
 }
@@ -83,10 +90,47 @@ func BufferResponses(r io.Reader, maxResponseSize uint32) io.Reader {
 func (b *responseBuffer) readNextResponse() error {
 	buf := make([]byte, b.maxResponseSize)
 	n, err := b.r.Read(buf)
-	if err != nil {
+	switch {
+	case err == io.EOF && n > 0:
+		// Readers are permitted to return data with io.EOF. If the response
+		// is incomplete, the next read will fail.
+	case err != nil:
 		return err
 	}
 
+	hdrSize := binary.Size(tpm2.ResponseHeader{})
+	for {
+		// Determine how many bytes we need before the response is complete.
+		end := hdrSize
+		if n >= hdrSize {
+			var hdr tpm2.ResponseHeader
+			if _, err := mu.UnmarshalFromBytes(buf[:n], &hdr); err != nil {
+				return fmt.Errorf("cannot decode response header: %w", err)
+			}
+			switch {
+			case hdr.ResponseSize < uint32(hdrSize):
+				// Let the caller deal with this.
+				b.rsp = bytes.NewReader(buf[:n])
+				return nil
+			case hdr.ResponseSize > b.maxResponseSize:
+				return fmt.Errorf("invalid response size (%d bytes)", hdr.ResponseSize)
+			}
+			end = int(hdr.ResponseSize)
+		}
+		if n >= end {
+			break
+		}
+
+		sz, err := b.r.Read(buf[n:end])
+		n += sz
+		switch {
+		case err == io.EOF && sz == 0:
+			return io.ErrUnexpectedEOF
+		case err != nil && err != io.EOF:
+			return err
+		}
+	}
+
 	b.rsp = bytes.NewReader(buf[:n])
 	return nil
 }
@@ -58,6 +58,13 @@ func (s *bufferSuite) TestBufferCommandsTooLarge(c *C) {
 	c.Check(w.n, Equals, 0)
 }
 
+func (s *bufferSuite) TestBufferCommandsTooSmall(c *C) {
+	w := &countingWriter{buf: new(bytes.Buffer)}
+	_, err := BufferCommands(w, 4096).Write(internal_testutil.DecodeHexString(c, "800100000008000001440000"))
+	c.Check(err, ErrorMatches, `invalid command size \(8 bytes\)`)
+	c.Check(w.n, Equals, 0)
+}
+
 type countingReader struct {
 	buf          io.Reader
 	n            int
@@ -93,3 +100,124 @@ func (s *bufferSuite) TestBufferResponsesEOF(c *C) {
 	c.Check(err, IsNil)
 	c.Check(data, DeepEquals, internal_testutil.DecodeHexString(c, "80010000000a00000000"))
 }
+
+type chunkedReader struct {
+	buf       io.Reader
+	chunkSize int
+	n         int
+}
+
+func (r *chunkedReader) Read(data []byte) (int, error) {
+	r.n += 1
+	if len(data) > r.chunkSize {
+		data = data[:r.chunkSize]
+	}
+	return r.buf.Read(data)
+}
+
+func (s *bufferSuite) TestBufferResponsesShortReads(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "80010000001000000000010203040506")
+	r := &chunkedReader{buf: bytes.NewReader(rsp), chunkSize: 4}
+
+	data, err := io.ReadAll(BufferResponses(r, 4096))
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, rsp)
+	c.Check(r.n, Equals, 6)
+}
+
+func (s *bufferSuite) TestBufferResponsesLargeShortReads(c *C) {
+	rsp := make([]byte, 5000)
+	copy(rsp, internal_testutil.DecodeHexString(c, "800100001388000000"))
+	for i := 10; i < len(rsp); i++ {
+		rsp[i] = byte(i)
+	}
+	r := &chunkedReader{buf: bytes.NewReader(rsp), chunkSize: 1000}
+
+	data, err := io.ReadAll(BufferResponses(r, 8192))
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, rsp)
+	c.Check(r.n, Equals, 6)
+}
+
+func (s *bufferSuite) TestBufferResponsesTooLarge(c *C) {
+	rsp := make([]byte, 5000)
+	copy(rsp, internal_testutil.DecodeHexString(c, "800100001388000000"))
+	r := &chunkedReader{buf: bytes.NewReader(rsp), chunkSize: 4096}
+
+	_, err := io.ReadAll(BufferResponses(r, 4096))
+	c.Check(err, ErrorMatches, `invalid response size \(5000 bytes\)`)
+	c.Check(r.n, Equals, 1)
+}
+
+func (s *bufferSuite) TestBufferResponsesTruncated(c *C) {
+	r := &countingReader{buf: bytes.NewReader(internal_testutil.DecodeHexString(c, "8001000000100000000001020304"))}
+
+	_, err := io.ReadAll(BufferResponses(r, 4096))
+	c.Check(err, Equals, io.ErrUnexpectedEOF)
+}
+
+type fragmentReader struct {
+	fragments [][]byte
+	err       error // the error to return with the last fragment
+}
+
+func (r *fragmentReader) Read(data []byte) (int, error) {
+	if len(r.fragments) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(data, r.fragments[0])
+	r.fragments[0] = r.fragments[0][n:]
+	if len(r.fragments[0]) > 0 {
+		return n, nil
+	}
+	r.fragments = r.fragments[1:]
+	if len(r.fragments) == 0 {
+		return n, r.err
+	}
+	return n, nil
+}
+
+func (s *bufferSuite) TestBufferResponsesSplitMidHeader(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "80010000001000000000010203040506")
+	r := &fragmentReader{fragments: [][]byte{rsp[:3], rsp[3:7], rsp[7:]}}
+
+	b := BufferResponses(r, 4096)
+	data := make([]byte, len(rsp))
+	_, err := io.ReadFull(b, data)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, rsp)
+	c.Check(r.fragments, internal_testutil.LenEquals, 0)
+
+	// Make sure that the whole response was returned from a single read.
+	r = &fragmentReader{fragments: [][]byte{rsp[:3], rsp[3:7], rsp[7:]}}
+	n, err := BufferResponses(r, 4096).Read(data)
+	c.Check(err, IsNil)
+	c.Check(n, Equals, len(rsp))
+	c.Check(data, DeepEquals, rsp)
+}
+
+func (s *bufferSuite) TestBufferResponsesDataWithEOF(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "80010000001000000000010203040506")
+	r := &fragmentReader{fragments: [][]byte{rsp}, err: io.EOF}
+
+	data, err := io.ReadAll(BufferResponses(r, 4096))
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, rsp)
+}
+
+func (s *bufferSuite) TestBufferResponsesSplitMidHeaderWithEOF(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "80010000001000000000010203040506")
+	r := &fragmentReader{fragments: [][]byte{rsp[:3], rsp[3:]}, err: io.EOF}
+
+	data, err := io.ReadAll(BufferResponses(r, 4096))
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, rsp)
+}
+
+func (s *bufferSuite) TestBufferResponsesTruncatedWithEOF(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "80010000001000000000010203040506")
+	r := &fragmentReader{fragments: [][]byte{rsp[:12]}, err: io.EOF}
+
+	_, err := io.ReadAll(BufferResponses(r, 4096))
+	c.Check(err, Equals, io.ErrUnexpectedEOF)
+}
@@ -18,6 +18,9 @@ import (
 	"github.com/canonical/go-tpm2/mu"
 )
 
+// ErrInvalidIntegrity is returned from UnwrapOuter if the integrity HMAC is invalid.
+var ErrInvalidIntegrity = errors.New("integrity digest is invalid")
+
 // UnwrapOuter removes an outer wrapper from the supplied sensitive data blob. The
 // supplied name is associated with the data.
 //
@@ -33,6 +36,9 @@ func UnwrapOuter(hashAlg tpm2.HashAlgorithmId, symmetricAlg *tpm2.SymDefObject,
 	if symmetricAlg == nil || !symmetricAlg.Algorithm.IsValidBlockCipher() {
 		return nil, errors.New("symmetric algorithm is not a valid block cipher")
 	}
+	if !symmetricAlg.Algorithm.Available() {
+		return nil, fmt.Errorf("symmetric algorithm %v is not available", symmetricAlg.Algorithm)
+	}
 
 	r := bytes.NewReader(data)
 
@@ -49,7 +55,7 @@ func UnwrapOuter(hashAlg tpm2.HashAlgorithmId, symmetricAlg *tpm2.SymDefObject,
 	h.Write(name)
 
 	if !bytes.Equal(h.Sum(nil), integrity) {
-		return nil, errors.New("integrity digest is invalid")
+		return nil, ErrInvalidIntegrity
 	}
 
 	r = bytes.NewReader(data)
@@ -91,6 +97,9 @@ func ProduceOuterWrap(hashAlg tpm2.HashAlgorithmId, symmetricAlg *tpm2.SymDefObj
 	if symmetricAlg == nil || !symmetricAlg.Algorithm.IsValidBlockCipher() {
 		return nil, errors.New("symmetric algorithm is not a valid block cipher")
 	}
+	if !symmetricAlg.Algorithm.Available() {
+		return nil, fmt.Errorf("symmetric algorithm %v is not available", symmetricAlg.Algorithm)
+	}
 
 	iv := make([]byte, symmetricAlg.Algorithm.BlockSize())
 	if useIV {
@@ -4,6 +4,8 @@
 
 package linux
 
+import "os"
+
 var NewSysfsPpi = newSysfsPpi
 
 func MockSysfsPath(path string) (restore func()) {
@@ -38,3 +40,7 @@ func NewMockRMDevice(path, sysfsPath string, version TPMMajorVersion, raw *RawDe
 func ResetDevices() {
 	devices = tpmDevices{}
 }
+
+func NewMockTransport(f *os.File, partialReadSupported bool, maxResponseSize uint32) *Transport {
+	return newTransport(&tpmFile{file: f}, partialReadSupported, maxResponseSize)
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package linux_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	. "github.com/canonical/go-tpm2/linux"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+type transportSuite struct{}
+
+var _ = Suite(&transportSuite{})
+
+// newMockDevice returns a pair of connected files, where the first is used by
+// the transport and the second is used by the mock device. Each write to the
+// mock device's end is returned by a single read on the transport's end, and
+// like the TPM character device, any part of a write that doesn't fit in the
+// buffer supplied to a read is discarded.
+func (s *transportSuite) newMockDevice(c *C) (transport, device *os.File) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+	c.Assert(err, IsNil)
+	return os.NewFile(uintptr(fds[0]), "transport"), os.NewFile(uintptr(fds[1]), "device")
+}
+
+// runMockDevice reads a single command from the supplied file and responds to
+// it with the supplied response, split into chunks of the specified size in
+// order to simulate a device that returns a response across multiple reads.
+// The file is closed once the response has been written.
+func (s *transportSuite) runMockDevice(f *os.File, rsp []byte, chunkSize int) <-chan error {
+	done := make(chan error, 1)
+
+	go func() {
+		defer f.Close()
+		done <- func() error {
+			cmd := make([]byte, 4096)
+			n, err := f.Read(cmd)
+			if err != nil {
+				return err
+			}
+
+			var hdr tpm2.CommandHeader
+			if _, err := mu.UnmarshalFromBytes(cmd[:n], &hdr); err != nil {
+				return err
+			}
+			if hdr.CommandCode != tpm2.CommandGetCapability {
+				return errors.New("unexpected command")
+			}
+
+			for len(rsp) > 0 {
+				sz := chunkSize
+				if sz > len(rsp) {
+					sz = len(rsp)
+				}
+				if _, err := f.Write(rsp[:sz]); err != nil {
+					return err
+				}
+				rsp = rsp[sz:]
+			}
+			return nil
+		}()
+	}()
+
+	return done
+}
+
+func (s *transportSuite) makeGetCapabilityHandlesResponse(handles tpm2.HandleList) []byte {
+	params := mu.MustMarshalToBytes(false, &tpm2.CapabilityData{
+		Capability: tpm2.CapabilityHandles,
+		Data:       &tpm2.CapabilitiesU{Handles: handles}})
+	return mu.MustMarshalToBytes(tpm2.ResponseHeader{
+		Tag:          tpm2.TagNoSessions,
+		ResponseSize: uint32(binary.Size(tpm2.ResponseHeader{}) + len(params)),
+		ResponseCode: tpm2.ResponseSuccess,
+	}, mu.RawBytes(params))
+}
+
+func (s *transportSuite) TestGetCapabilityLargeResponseMultipleReads(c *C) {
+	var handles tpm2.HandleList
+	for i := 0; i < 1100; i++ {
+		handles = append(handles, tpm2.Handle(0x81000000+i))
+	}
+	rsp := s.makeGetCapabilityHandlesResponse(handles)
+	c.Assert(len(rsp) > 4096, internal_testutil.IsTrue)
+
+	transportFile, deviceFile := s.newMockDevice(c)
+	done := s.runMockDevice(deviceFile, rsp, 1000)
+
+	tpm := tpm2.NewTPMContext(NewMockTransport(transportFile, false, 8192))
+	defer tpm.Close()
+
+	data, err := tpm.GetCapabilityHandles(0x81000000, 1100)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, handles)
+	c.Check(<-done, IsNil)
+}
+
+func (s *transportSuite) TestGetCapabilityResponseTooLarge(c *C) {
+	var handles tpm2.HandleList
+	for i := 0; i < 1100; i++ {
+		handles = append(handles, tpm2.Handle(0x81000000+i))
+	}
+	rsp := s.makeGetCapabilityHandlesResponse(handles)
+
+	transportFile, deviceFile := s.newMockDevice(c)
+	done := s.runMockDevice(deviceFile, rsp, len(rsp))
+
+	// The response is larger than the maximum response size, so the read is
+	// truncated and the rest of the response is discarded.
+	tpm := tpm2.NewTPMContext(NewMockTransport(transportFile, false, 4096))
+	defer tpm.Close()
+
+	_, err := tpm.GetCapabilityHandles(0x81000000, 1100)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot complete read operation on Transport: invalid response size \(%d bytes\)`, len(rsp)))
+	c.Check(<-done, IsNil)
+}
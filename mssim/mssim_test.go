@@ -0,0 +1,175 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package mssim_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	. "github.com/canonical/go-tpm2/mssim"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+const (
+	cmdTPMSendCommand uint32 = 8
+	cmdSessionEnd     uint32 = 20
+)
+
+// mockSimulator implements just enough of the TPM simulator protocol to
+// exercise the transport.
+type mockSimulator struct {
+	tpm      net.Listener
+	platform net.Listener
+
+	// respond is called for each command submitted on the TPM channel.
+	respond func(cmd []byte) []byte
+	// chunkSize is the maximum size of each write of a response.
+	chunkSize int
+
+	wg sync.WaitGroup
+}
+
+func newMockSimulator(c *C) *mockSimulator {
+	for i := 0; i < 10; i++ {
+		tpm, err := net.Listen("tcp", "127.0.0.1:0")
+		c.Assert(err, IsNil)
+
+		port := tpm.Addr().(*net.TCPAddr).Port
+		platform, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port+1)))
+		if err != nil {
+			tpm.Close()
+			continue
+		}
+
+		s := &mockSimulator{tpm: tpm, platform: platform}
+		s.wg.Add(2)
+		go s.serve(tpm, s.handleTPM)
+		go s.serve(platform, s.handlePlatform)
+		return s
+	}
+	c.Fatal("cannot find a pair of free ports")
+	return nil
+}
+
+func (s *mockSimulator) port() uint {
+	return uint(s.tpm.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *mockSimulator) close() {
+	s.tpm.Close()
+	s.platform.Close()
+	s.wg.Wait()
+}
+
+func (s *mockSimulator) serve(l net.Listener, handle func(net.Conn) error) {
+	defer s.wg.Done()
+
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	handle(conn)
+}
+
+func (s *mockSimulator) handlePlatform(conn net.Conn) error {
+	for {
+		var cmd uint32
+		if err := binary.Read(conn, binary.BigEndian, &cmd); err != nil {
+			return err
+		}
+		if cmd == cmdSessionEnd {
+			return nil
+		}
+		if err := binary.Write(conn, binary.BigEndian, uint32(0)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *mockSimulator) handleTPM(conn net.Conn) error {
+	for {
+		var cmd uint32
+		if err := binary.Read(conn, binary.BigEndian, &cmd); err != nil {
+			return err
+		}
+		if cmd != cmdTPMSendCommand {
+			// This includes cmdSessionEnd
+			return nil
+		}
+
+		var locality uint8
+		var size uint32
+		if _, err := mu.UnmarshalFromReader(conn, &locality, &size); err != nil {
+			return err
+		}
+		packet := make([]byte, size)
+		if _, err := io.ReadFull(conn, packet); err != nil {
+			return err
+		}
+
+		rsp := s.respond(packet)
+		rsp = mu.MustMarshalToBytes(uint32(len(rsp)), mu.RawBytes(rsp), uint32(0))
+		for len(rsp) > 0 {
+			sz := len(rsp)
+			if s.chunkSize > 0 && sz > s.chunkSize {
+				sz = s.chunkSize
+			}
+			if _, err := conn.Write(rsp[:sz]); err != nil {
+				return err
+			}
+			rsp = rsp[sz:]
+		}
+	}
+}
+
+type mssimSuite struct{}
+
+var _ = Suite(&mssimSuite{})
+
+func (s *mssimSuite) TestGetCapabilityLargeResponse(c *C) {
+	var handles tpm2.HandleList
+	for i := 0; i < 1100; i++ {
+		handles = append(handles, tpm2.Handle(0x81000000+i))
+	}
+
+	sim := newMockSimulator(c)
+	defer sim.close()
+	sim.chunkSize = 1000
+	sim.respond = func(cmd []byte) []byte {
+		var hdr tpm2.CommandHeader
+		_, err := mu.UnmarshalFromBytes(cmd, &hdr)
+		c.Check(err, IsNil)
+		c.Check(hdr.CommandCode, Equals, tpm2.CommandGetCapability)
+
+		params := mu.MustMarshalToBytes(false, &tpm2.CapabilityData{
+			Capability: tpm2.CapabilityHandles,
+			Data:       &tpm2.CapabilitiesU{Handles: handles}})
+		c.Assert(len(params) > 4096, internal_testutil.IsTrue)
+		return mu.MustMarshalToBytes(tpm2.ResponseHeader{
+			Tag:          tpm2.TagNoSessions,
+			ResponseSize: uint32(binary.Size(tpm2.ResponseHeader{}) + len(params)),
+			ResponseCode: tpm2.ResponseSuccess,
+		}, mu.RawBytes(params))
+	}
+
+	tpm, err := tpm2.OpenTPMDevice(NewLocalDevice(sim.port()))
+	c.Assert(err, IsNil)
+	defer tpm.Close()
+
+	data, err := tpm.GetCapabilityHandles(0x81000000, 1100)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, handles)
+}
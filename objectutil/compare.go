@@ -0,0 +1,58 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package objectutil
+
+import (
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+type publicCompareOptions struct {
+	ignoreAuthPolicy bool
+}
+
+// PublicCompareOption is an option supplied to [PublicTemplateEqual].
+type PublicCompareOption func(*publicCompareOptions)
+
+// IgnoreAuthPolicy indicates that the authorization policy should be excluded
+// from the comparison.
+func IgnoreAuthPolicy() PublicCompareOption {
+	return func(opts *publicCompareOptions) {
+		opts.ignoreAuthPolicy = true
+	}
+}
+
+// PublicTemplateEqual determines whether the supplied public areas are equal,
+// ignoring the unique field. This is useful for determining whether an object
+// was created from a specific template, as the unique field of a created object
+// will generally be different to that of the template. The type specific
+// parameters are compared according to the object type, and public areas with
+// different types are never equal.
+//
+// The authorization policy can also be excluded from the comparison by supplying
+// the [IgnoreAuthPolicy] option.
+//
+// This returns false if either public area is invalid or cannot be serialized.
+func PublicTemplateEqual(a, b *tpm2.Public, options ...PublicCompareOption) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	var opts publicCompareOptions
+	for _, option := range options {
+		option(&opts)
+	}
+
+	normalize := func(pub *tpm2.Public) *tpm2.Public {
+		out := *pub
+		out.Unique = new(tpm2.PublicIDU)
+		if opts.ignoreAuthPolicy {
+			out.AuthPolicy = nil
+		}
+		return &out
+	}
+
+	return mu.DeepEqual(normalize(a), normalize(b))
+}
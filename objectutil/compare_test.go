@@ -0,0 +1,130 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package objectutil_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	. "github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type compareSuite struct{}
+
+var _ = Suite(&compareSuite{})
+
+func (s *compareSuite) TestPublicTemplateEqualRSAKeys(c *C) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	pub1, err := NewRSAPublicKey(&key1.PublicKey)
+	c.Assert(err, IsNil)
+	pub2, err := NewRSAPublicKey(&key2.PublicKey)
+	c.Assert(err, IsNil)
+
+	c.Check(PublicTemplateEqual(pub1, pub2), internal_testutil.IsTrue)
+}
+
+func (s *compareSuite) TestPublicTemplateEqualECCKeys(c *C) {
+	key1, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	key2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	pub1, err := NewECCPublicKey(&key1.PublicKey)
+	c.Assert(err, IsNil)
+	pub2, err := NewECCPublicKey(&key2.PublicKey)
+	c.Assert(err, IsNil)
+
+	c.Check(PublicTemplateEqual(pub1, pub2), internal_testutil.IsTrue)
+}
+
+func (s *compareSuite) TestPublicTemplateEqualTemplate(c *C) {
+	template := NewRSAStorageKeyTemplate()
+	pub := NewRSAStorageKeyTemplate(WithRSAUnique(make(tpm2.PublicKeyRSA, 256)))
+	c.Check(PublicTemplateEqual(template, pub), internal_testutil.IsTrue)
+}
+
+func (s *compareSuite) TestPublicTemplateEqualKeyedHash(c *C) {
+	template := NewSealedObjectTemplate()
+	pub := NewSealedObjectTemplate(WithKeyedHashUnique(make(tpm2.Digest, 32)))
+	c.Check(PublicTemplateEqual(template, pub), internal_testutil.IsTrue)
+}
+
+func (s *compareSuite) TestPublicTemplateEqualDifferentParams(c *C) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	pub1, err := NewRSAPublicKey(&key1.PublicKey)
+	c.Assert(err, IsNil)
+	pub2, err := NewRSAPublicKey(&key2.PublicKey, WithRSAScheme(tpm2.RSASchemeRSAPSS, tpm2.HashAlgorithmSHA256))
+	c.Assert(err, IsNil)
+
+	c.Check(PublicTemplateEqual(pub1, pub2), internal_testutil.IsFalse)
+}
+
+func (s *compareSuite) TestPublicTemplateEqualDifferentTypes(c *C) {
+	c.Check(PublicTemplateEqual(NewRSAStorageKeyTemplate(), NewECCStorageKeyTemplate()), internal_testutil.IsFalse)
+}
+
+func (s *compareSuite) TestPublicTemplateEqualDifferentAttrs(c *C) {
+	c.Check(PublicTemplateEqual(NewRSAKeyTemplate(UsageSign), NewRSAKeyTemplate(UsageSign, WithoutDictionaryAttackProtection())), internal_testutil.IsFalse)
+}
+
+func (s *compareSuite) TestPublicTemplateEqualDifferentAuthPolicy(c *C) {
+	a := NewSealedObjectTemplate(WithAuthPolicy(internal_testutil.DecodeHexString(c, "1111111111111111111111111111111111111111111111111111111111111111")))
+	b := NewSealedObjectTemplate(WithAuthPolicy(internal_testutil.DecodeHexString(c, "2222222222222222222222222222222222222222222222222222222222222222")))
+	c.Check(PublicTemplateEqual(a, b), internal_testutil.IsFalse)
+	c.Check(PublicTemplateEqual(a, b, IgnoreAuthPolicy()), internal_testutil.IsTrue)
+}
+
+func (s *compareSuite) TestPublicTemplateEqualNil(c *C) {
+	c.Check(PublicTemplateEqual(nil, nil), internal_testutil.IsTrue)
+	c.Check(PublicTemplateEqual(NewRSAStorageKeyTemplate(), nil), internal_testutil.IsFalse)
+}
+
+func (s *compareSuite) TestPublicTemplateEqualDoesntModify(c *C) {
+	pub := NewRSAStorageKeyTemplate(WithRSAUnique(make(tpm2.PublicKeyRSA, 256)), WithAuthPolicy(make(tpm2.Digest, 32)))
+	expected := NewRSAStorageKeyTemplate(WithRSAUnique(make(tpm2.PublicKeyRSA, 256)), WithAuthPolicy(make(tpm2.Digest, 32)))
+	PublicTemplateEqual(pub, NewRSAStorageKeyTemplate(), IgnoreAuthPolicy())
+	c.Check(pub, testutil.TPMValueDeepEquals, expected)
+}
+
+type compareSuiteTPM struct {
+	testutil.TPMTest
+}
+
+func (s *compareSuiteTPM) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&compareSuiteTPM{})
+
+func (s *compareSuiteTPM) TestPublicTemplateEqualCreatedKeys(c *C) {
+	parent := s.CreateStoragePrimaryKeyRSA(c)
+
+	template := NewRSAKeyTemplate(UsageSign)
+	_, pub1, _, _, _, err := s.TPM.Create(parent, nil, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+	_, pub2, _, _, _, err := s.TPM.Create(parent, nil, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+	_, pub3, _, _, _, err := s.TPM.Create(parent, nil, NewECCKeyTemplate(UsageSign), nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(PublicTemplateEqual(pub1, pub2), internal_testutil.IsTrue)
+	c.Check(PublicTemplateEqual(pub1, template), internal_testutil.IsTrue)
+	c.Check(PublicTemplateEqual(pub1, pub3), internal_testutil.IsFalse)
+}
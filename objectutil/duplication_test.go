@@ -6,6 +6,7 @@ package objectutil_test
 
 import (
 	"crypto"
+	"crypto/aes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -213,3 +214,72 @@ func (s *duplicationSuite) TestCreateUnwrapDuplicationWithBothWrappers(c *C) {
 		},
 	})
 }
+
+func (s *duplicationSuite) TestCreateUnwrapDuplicationWithOuterWrapperSM4(c *C) {
+	// There is no SM4 implementation in the standard library, so register
+	// a stand-in with the same key and block size in order to exercise the
+	// code paths for storage parents that use it. The registration is global,
+	// so remove it again afterwards so that it isn't visible to other tests.
+	if !tpm2.SymAlgorithmSM4.Available() {
+		tpm2.RegisterCipher(tpm2.SymAlgorithmSM4, aes.NewCipher)
+		defer tpm2.RegisterCipher(tpm2.SymAlgorithmSM4, nil)
+	}
+	c.Check(tpm2.SymObjectAlgorithmSM4.BlockSize(), Equals, 16)
+
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	s.testCreateUnwrapDuplication(c, &testCreateUnwrapDuplicationData{
+		parentPriv: privKey,
+		parentPublic: &tpm2.Public{
+			Type:    tpm2.ObjectTypeRSA,
+			NameAlg: tpm2.HashAlgorithmSHA256,
+			Attrs:   tpm2.AttrUserWithAuth | tpm2.AttrRestricted | tpm2.AttrDecrypt,
+			Params: &tpm2.PublicParamsU{
+				RSADetail: &tpm2.RSAParams{
+					Symmetric: tpm2.SymDefObject{
+						Algorithm: tpm2.SymObjectAlgorithmSM4,
+						KeyBits:   &tpm2.SymKeyBitsU{Sym: 128},
+						Mode:      &tpm2.SymModeU{Sym: tpm2.SymModeCFB},
+					},
+					Scheme:   tpm2.RSAScheme{Scheme: tpm2.RSASchemeNull},
+					KeyBits:  2048,
+					Exponent: uint32(privKey.E),
+				},
+			},
+			Unique: &tpm2.PublicIDU{RSA: privKey.N.Bytes()},
+		},
+	})
+}
+
+func (s *duplicationSuite) TestCreateDuplicationWithOuterWrapperUnavailableCipher(c *C) {
+	c.Check(tpm2.SymObjectAlgorithmCamellia.BlockSize(), Equals, 16)
+
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	parentPublic := &tpm2.Public{
+		Type:    tpm2.ObjectTypeRSA,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.AttrUserWithAuth | tpm2.AttrRestricted | tpm2.AttrDecrypt,
+		Params: &tpm2.PublicParamsU{
+			RSADetail: &tpm2.RSAParams{
+				Symmetric: tpm2.SymDefObject{
+					Algorithm: tpm2.SymObjectAlgorithmCamellia,
+					KeyBits:   &tpm2.SymKeyBitsU{Sym: 128},
+					Mode:      &tpm2.SymModeU{Sym: tpm2.SymModeCFB},
+				},
+				Scheme:   tpm2.RSAScheme{Scheme: tpm2.RSASchemeNull},
+				KeyBits:  2048,
+				Exponent: uint32(privKey.E),
+			},
+		},
+		Unique: &tpm2.PublicIDU{RSA: privKey.N.Bytes()},
+	}
+
+	public, sensitive, err := NewSealedObject(rand.Reader, []byte("super secret data"), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	_, _, _, err = CreateImportable(rand.Reader, sensitive, public, parentPublic, nil, nil)
+	c.Check(err, ErrorMatches, `cannot convert sensitive to duplicate: cannot apply outer wrapper: symmetric algorithm TPM_ALG_CAMELLIA is not available`)
+}
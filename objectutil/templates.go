@@ -5,6 +5,9 @@
 package objectutil
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/canonical/go-tpm2"
 )
 
@@ -26,7 +29,8 @@ const (
 )
 
 // PublicTemplateOption provides a way to customize the parameters of a public area or public
-// template.
+// template. The functions that create templates don't check that the result is consistent,
+// but each has a variant with a WithError suffix that does (see [ValidatePublic]).
 type PublicTemplateOption func(*tpm2.Public)
 
 // WithNameAlg returns an option for the specified name algorithm.
@@ -456,6 +460,14 @@ func applyPublicTemplateOptions(pub *tpm2.Public, options ...PublicTemplateOptio
 	}
 }
 
+// validateTemplate returns the supplied template if it is valid.
+func validateTemplate(template *tpm2.Public) (*tpm2.Public, error) {
+	if err := ValidatePublic(template); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return template, nil
+}
+
 // NewRSAStorageKeyTemplate returns a template for a RSA storage key. The template can be
 // customized by supplying additional options.
 //
@@ -486,6 +498,13 @@ func NewRSAStorageKeyTemplate(options ...PublicTemplateOption) *tpm2.Public {
 	return template
 }
 
+// NewRSAStorageKeyTemplateWithError is like [NewRSAStorageKeyTemplate], but returns an error if
+// the supplied options produce a template with a scheme that is inconsistent with its attributes
+// (see [ValidatePublic]).
+func NewRSAStorageKeyTemplateWithError(options ...PublicTemplateOption) (*tpm2.Public, error) {
+	return validateTemplate(NewRSAStorageKeyTemplate(options...))
+}
+
 // NewRSAAttestationKeyTemplate returns a template for a RSA attestation key. The template can be
 // customized by supplying additional options.
 //
@@ -516,6 +535,13 @@ func NewRSAAttestationKeyTemplate(options ...PublicTemplateOption) *tpm2.Public
 	return template
 }
 
+// NewRSAAttestationKeyTemplateWithError is like [NewRSAAttestationKeyTemplate], but returns an
+// error if the supplied options produce a template with a scheme that is inconsistent with its
+// attributes (see [ValidatePublic]).
+func NewRSAAttestationKeyTemplateWithError(options ...PublicTemplateOption) (*tpm2.Public, error) {
+	return validateTemplate(NewRSAAttestationKeyTemplate(options...))
+}
+
 // NewRSAKeyTemplate returns a template for a RSA key with the specicied usage. The template can be
 // customized by supplying additional options.
 //
@@ -555,6 +581,16 @@ func NewRSAKeyTemplate(usage Usage, options ...PublicTemplateOption) *tpm2.Publi
 	return template
 }
 
+// NewRSAKeyTemplateWithError is like [NewRSAKeyTemplate], but returns an error if the supplied
+// options produce a template with a scheme that is inconsistent with its attributes (see
+// [ValidatePublic]).
+func NewRSAKeyTemplateWithError(usage Usage, options ...PublicTemplateOption) (*tpm2.Public, error) {
+	if usage == 0 {
+		return nil, errors.New("invalid usage")
+	}
+	return validateTemplate(NewRSAKeyTemplate(usage, options...))
+}
+
 // NewECCStorageKeyTemplate returns a template for a ECC storage key. The template can be
 // customized by supplying additional options.
 //
@@ -585,6 +621,13 @@ func NewECCStorageKeyTemplate(options ...PublicTemplateOption) *tpm2.Public {
 	return template
 }
 
+// NewECCStorageKeyTemplateWithError is like [NewECCStorageKeyTemplate], but returns an error if
+// the supplied options produce a template with a scheme that is inconsistent with its attributes
+// (see [ValidatePublic]).
+func NewECCStorageKeyTemplateWithError(options ...PublicTemplateOption) (*tpm2.Public, error) {
+	return validateTemplate(NewECCStorageKeyTemplate(options...))
+}
+
 // NewECCAttestationKeyTemplate returns a template for a ECC attestation key. The template can be
 // customized by supplying additional options.
 //
@@ -615,6 +658,13 @@ func NewECCAttestationKeyTemplate(options ...PublicTemplateOption) *tpm2.Public
 	return template
 }
 
+// NewECCAttestationKeyTemplateWithError is like [NewECCAttestationKeyTemplate], but returns an
+// error if the supplied options produce a template with a scheme that is inconsistent with its
+// attributes (see [ValidatePublic]).
+func NewECCAttestationKeyTemplateWithError(options ...PublicTemplateOption) (*tpm2.Public, error) {
+	return validateTemplate(NewECCAttestationKeyTemplate(options...))
+}
+
 // NewECCKeyTemplate returns a template for a ECC key with the specicied usage. The template can be
 // customized by supplying additional options.
 //
@@ -654,6 +704,16 @@ func NewECCKeyTemplate(usage Usage, options ...PublicTemplateOption) *tpm2.Publi
 	return template
 }
 
+// NewECCKeyTemplateWithError is like [NewECCKeyTemplate], but returns an error if the supplied
+// options produce a template with a scheme that is inconsistent with its attributes (see
+// [ValidatePublic]).
+func NewECCKeyTemplateWithError(usage Usage, options ...PublicTemplateOption) (*tpm2.Public, error) {
+	if usage == 0 {
+		return nil, errors.New("invalid usage")
+	}
+	return validateTemplate(NewECCKeyTemplate(usage, options...))
+}
+
 // NewSymmetricStorageKeyTemplate returns a template for a symmetric storage key. The template can be
 // customized by supplying additional options.
 //
@@ -682,6 +742,13 @@ func NewSymmetricStorageKeyTemplate(options ...PublicTemplateOption) *tpm2.Publi
 	return template
 }
 
+// NewSymmetricStorageKeyTemplateWithError is like [NewSymmetricStorageKeyTemplate], but returns
+// an error if the supplied options produce a template with a scheme that is inconsistent with its
+// attributes (see [ValidatePublic]).
+func NewSymmetricStorageKeyTemplateWithError(options ...PublicTemplateOption) (*tpm2.Public, error) {
+	return validateTemplate(NewSymmetricStorageKeyTemplate(options...))
+}
+
 // NewSymmetricKeyTemplate returns a template for a symmetric key with the specicied usage. The template can be
 // customized by supplying additional options.
 //
@@ -721,6 +788,16 @@ func NewSymmetricKeyTemplate(usage Usage, options ...PublicTemplateOption) *tpm2
 	return template
 }
 
+// NewSymmetricKeyTemplateWithError is like [NewSymmetricKeyTemplate], but returns an error if the
+// supplied options produce a template with a scheme that is inconsistent with its attributes (see
+// [ValidatePublic]).
+func NewSymmetricKeyTemplateWithError(usage Usage, options ...PublicTemplateOption) (*tpm2.Public, error) {
+	if usage == 0 {
+		return nil, errors.New("invalid usage")
+	}
+	return validateTemplate(NewSymmetricKeyTemplate(usage, options...))
+}
+
 // NewHMACKeyTemplate returns a template for a HMAC key. The template can be customized by
 // supplying additional options.
 //
@@ -749,6 +826,13 @@ func NewHMACKeyTemplate(options ...PublicTemplateOption) *tpm2.Public {
 	return template
 }
 
+// NewHMACKeyTemplateWithError is like [NewHMACKeyTemplate], but returns an error if the supplied
+// options produce a template with a scheme that is inconsistent with its attributes (see
+// [ValidatePublic]).
+func NewHMACKeyTemplateWithError(options ...PublicTemplateOption) (*tpm2.Public, error) {
+	return validateTemplate(NewHMACKeyTemplate(options...))
+}
+
 // NewDerivationParentTemplate returns a template for a derivation parent. The template can be
 // customized by supplying additional options.
 //
@@ -779,6 +863,13 @@ func NewDerivationParentTemplate(options ...PublicTemplateOption) *tpm2.Public {
 	return template
 }
 
+// NewDerivationParentTemplateWithError is like [NewDerivationParentTemplate], but returns an
+// error if the supplied options produce a template with a scheme that is inconsistent with its
+// attributes (see [ValidatePublic]).
+func NewDerivationParentTemplateWithError(options ...PublicTemplateOption) (*tpm2.Public, error) {
+	return validateTemplate(NewDerivationParentTemplate(options...))
+}
+
 // NewSealedObjectTemplate returns a template for a sealed object. The template can be customized
 // by supplying additional options.
 //
@@ -800,3 +891,10 @@ func NewSealedObjectTemplate(options ...PublicTemplateOption) *tpm2.Public {
 	applyPublicTemplateOptions(template, options...)
 	return template
 }
+
+// NewSealedObjectTemplateWithError is like [NewSealedObjectTemplate], but returns an error if the
+// supplied options produce a template with a scheme that is inconsistent with its attributes (see
+// [ValidatePublic]).
+func NewSealedObjectTemplateWithError(options ...PublicTemplateOption) (*tpm2.Public, error) {
+	return validateTemplate(NewSealedObjectTemplate(options...))
+}
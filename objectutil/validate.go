@@ -0,0 +1,176 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package objectutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+func isAsymSigningScheme(scheme tpm2.AsymSchemeId) bool {
+	switch scheme {
+	case tpm2.AsymSchemeRSASSA, tpm2.AsymSchemeRSAPSS, tpm2.AsymSchemeECDSA, tpm2.AsymSchemeECDAA, tpm2.AsymSchemeSM2, tpm2.AsymSchemeECSchnorr:
+		return true
+	default:
+		return false
+	}
+}
+
+func isAsymDecryptScheme(scheme tpm2.AsymSchemeId) bool {
+	switch scheme {
+	case tpm2.AsymSchemeRSAES, tpm2.AsymSchemeOAEP, tpm2.AsymSchemeECDH, tpm2.AsymSchemeECMQV:
+		return true
+	default:
+		return false
+	}
+}
+
+func validateAsymScheme(pub *tpm2.Public, scheme tpm2.AsymSchemeId, symmetric *tpm2.SymDefObject) error {
+	switch pub.Type {
+	case tpm2.ObjectTypeRSA:
+		switch scheme {
+		case tpm2.AsymSchemeNull, tpm2.AsymSchemeRSASSA, tpm2.AsymSchemeRSAPSS, tpm2.AsymSchemeRSAES, tpm2.AsymSchemeOAEP:
+		default:
+			return fmt.Errorf("scheme %v is not valid for RSA keys", tpm2.AlgorithmId(scheme))
+		}
+	case tpm2.ObjectTypeECC:
+		switch scheme {
+		case tpm2.AsymSchemeNull, tpm2.AsymSchemeECDSA, tpm2.AsymSchemeECDAA, tpm2.AsymSchemeSM2, tpm2.AsymSchemeECSchnorr, tpm2.AsymSchemeECDH, tpm2.AsymSchemeECMQV:
+		default:
+			return fmt.Errorf("scheme %v is not valid for ECC keys", tpm2.AlgorithmId(scheme))
+		}
+	}
+
+	sign := pub.Attrs&tpm2.AttrSign != 0
+	decrypt := pub.Attrs&tpm2.AttrDecrypt != 0
+	restricted := pub.Attrs&tpm2.AttrRestricted != 0
+
+	if restricted && decrypt {
+		if scheme != tpm2.AsymSchemeNull {
+			return fmt.Errorf("restricted decryption key cannot have scheme %v", tpm2.AlgorithmId(scheme))
+		}
+		if symmetric.Algorithm == tpm2.SymObjectAlgorithmNull {
+			return errors.New("restricted decryption key must have a symmetric algorithm")
+		}
+		if symmetric.Mode == nil || symmetric.Mode.Sym != tpm2.SymModeCFB {
+			return errors.New("restricted decryption key must use CFB mode for its symmetric algorithm")
+		}
+		return nil
+	}
+
+	if symmetric.Algorithm != tpm2.SymObjectAlgorithmNull {
+		return errors.New("only restricted decryption keys can have a symmetric algorithm")
+	}
+
+	switch {
+	case sign && decrypt:
+		if scheme != tpm2.AsymSchemeNull {
+			return fmt.Errorf("key with both the sign and decrypt attributes cannot have scheme %v", tpm2.AlgorithmId(scheme))
+		}
+	case sign:
+		if restricted && scheme == tpm2.AsymSchemeNull {
+			return errors.New("restricted signing key must have a signing scheme")
+		}
+		if scheme != tpm2.AsymSchemeNull && !isAsymSigningScheme(scheme) {
+			return fmt.Errorf("signing key cannot have scheme %v", tpm2.AlgorithmId(scheme))
+		}
+	case decrypt:
+		if scheme != tpm2.AsymSchemeNull && !isAsymDecryptScheme(scheme) {
+			return fmt.Errorf("decryption key cannot have scheme %v", tpm2.AlgorithmId(scheme))
+		}
+	}
+
+	return nil
+}
+
+func validateKeyedHashScheme(pub *tpm2.Public, params *tpm2.KeyedHashParams) error {
+	sign := pub.Attrs&tpm2.AttrSign != 0
+	decrypt := pub.Attrs&tpm2.AttrDecrypt != 0
+	restricted := pub.Attrs&tpm2.AttrRestricted != 0
+
+	scheme := params.Scheme.Scheme
+	switch scheme {
+	case tpm2.KeyedHashSchemeNull:
+		if restricted && sign {
+			return errors.New("restricted signing key must have a HMAC scheme")
+		}
+		if restricted && decrypt {
+			return errors.New("restricted decryption key must have a XOR scheme")
+		}
+	case tpm2.KeyedHashSchemeHMAC:
+		if !sign || decrypt {
+			return errors.New("HMAC scheme is only valid for keys with the sign attribute and without the decrypt attribute")
+		}
+	case tpm2.KeyedHashSchemeXOR:
+		if !decrypt || sign {
+			return errors.New("XOR scheme is only valid for keys with the decrypt attribute and without the sign attribute")
+		}
+	default:
+		return fmt.Errorf("scheme %v is not valid for keyed hash objects", tpm2.AlgorithmId(scheme))
+	}
+
+	return nil
+}
+
+// ValidatePublic checks that the scheme of the supplied public area is consistent with its
+// attributes, according to the rules in part 1 of the TPM 2.0 Library Specification. The
+// following are checked:
+//   - Restricted objects must have exactly one of the sign and decrypt attributes set.
+//   - Restricted decryption keys (storage parents) must not have an asymmetric scheme, and
+//     must have a symmetric algorithm in CFB mode.
+//   - Asymmetric keys that aren't storage parents must not have a symmetric algorithm.
+//   - Asymmetric keys with both the sign and decrypt attributes must not have a scheme.
+//   - Signing keys can only have a signing scheme, and restricted signing keys must have one.
+//   - Decryption keys can only have an encryption or key exchange scheme.
+//   - Keyed hash objects can only have a HMAC scheme if they are signing keys, and can only
+//     have a XOR scheme if they are decryption keys (derivation parents). Restricted keyed hash
+//     objects must have one of these.
+//   - Symmetric cipher objects must have a symmetric algorithm, and restricted symmetric keys
+//     must use CFB mode.
+//
+// This doesn't check that the TPM supports any of the algorithms in the public area.
+func ValidatePublic(pub *tpm2.Public) error {
+	if pub.Attrs&tpm2.AttrRestricted != 0 && (pub.Attrs&(tpm2.AttrSign|tpm2.AttrDecrypt) == 0 || pub.Attrs&(tpm2.AttrSign|tpm2.AttrDecrypt) == tpm2.AttrSign|tpm2.AttrDecrypt) {
+		return errors.New("restricted object must have exactly one of the sign and decrypt attributes set")
+	}
+
+	if pub.Params == nil {
+		return errors.New("no parameters")
+	}
+
+	switch pub.Type {
+	case tpm2.ObjectTypeRSA:
+		if pub.Params.RSADetail == nil {
+			return errors.New("no RSA parameters")
+		}
+		return validateAsymScheme(pub, tpm2.AsymSchemeId(pub.Params.RSADetail.Scheme.Scheme), &pub.Params.RSADetail.Symmetric)
+	case tpm2.ObjectTypeECC:
+		if pub.Params.ECCDetail == nil {
+			return errors.New("no ECC parameters")
+		}
+		return validateAsymScheme(pub, tpm2.AsymSchemeId(pub.Params.ECCDetail.Scheme.Scheme), &pub.Params.ECCDetail.Symmetric)
+	case tpm2.ObjectTypeKeyedHash:
+		if pub.Params.KeyedHashDetail == nil {
+			return errors.New("no keyed hash parameters")
+		}
+		return validateKeyedHashScheme(pub, pub.Params.KeyedHashDetail)
+	case tpm2.ObjectTypeSymCipher:
+		if pub.Params.SymDetail == nil {
+			return errors.New("no symmetric cipher parameters")
+		}
+		sym := pub.Params.SymDetail.Sym
+		if sym.Algorithm == tpm2.SymObjectAlgorithmNull {
+			return errors.New("symmetric cipher object must have a symmetric algorithm")
+		}
+		if pub.Attrs&tpm2.AttrRestricted != 0 && (sym.Mode == nil || sym.Mode.Sym != tpm2.SymModeCFB) {
+			return errors.New("restricted symmetric key must use CFB mode")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid object type %v", tpm2.AlgorithmId(pub.Type))
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package objectutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	. "github.com/canonical/go-tpm2/objectutil"
+)
+
+type validateSuite struct{}
+
+var _ = Suite(&validateSuite{})
+
+func (s *validateSuite) TestValidatePublicTemplates(c *C) {
+	for i, template := range []*tpm2.Public{
+		NewRSAStorageKeyTemplate(),
+		NewRSAStorageKeyTemplate(WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 256, tpm2.SymModeCFB)),
+		NewRSAAttestationKeyTemplate(),
+		NewRSAAttestationKeyTemplate(WithRSAScheme(tpm2.RSASchemeRSASSA, tpm2.HashAlgorithmSHA512)),
+		NewRSAKeyTemplate(UsageSign),
+		NewRSAKeyTemplate(UsageSign, WithRSAScheme(tpm2.RSASchemeRSASSA, tpm2.HashAlgorithmSHA256)),
+		NewRSAKeyTemplate(UsageSign, WithRSAScheme(tpm2.RSASchemeRSAPSS, tpm2.HashAlgorithmSHA256)),
+		NewRSAKeyTemplate(UsageDecrypt),
+		NewRSAKeyTemplate(UsageDecrypt, WithRSAScheme(tpm2.RSASchemeRSAES, tpm2.HashAlgorithmNull)),
+		NewRSAKeyTemplate(UsageDecrypt, WithRSAScheme(tpm2.RSASchemeOAEP, tpm2.HashAlgorithmSHA256)),
+		NewRSAKeyTemplate(UsageSign | UsageDecrypt),
+		NewECCStorageKeyTemplate(),
+		NewECCAttestationKeyTemplate(),
+		NewECCAttestationKeyTemplate(WithECCScheme(tpm2.ECCSchemeECSchnorr, tpm2.HashAlgorithmSHA256)),
+		NewECCKeyTemplate(UsageSign),
+		NewECCKeyTemplate(UsageSign, WithECCScheme(tpm2.ECCSchemeECDSA, tpm2.HashAlgorithmSHA256)),
+		NewECCKeyTemplate(UsageKeyAgreement),
+		NewECCKeyTemplate(UsageKeyAgreement, WithECCScheme(tpm2.ECCSchemeECDH, tpm2.HashAlgorithmSHA256)),
+		NewECCKeyTemplate(UsageSign | UsageKeyAgreement),
+		NewSymmetricStorageKeyTemplate(),
+		NewSymmetricKeyTemplate(UsageEncrypt),
+		NewSymmetricKeyTemplate(UsageDecrypt, WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 128, tpm2.SymModeCTR)),
+		NewSymmetricKeyTemplate(UsageEncrypt | UsageDecrypt),
+		NewHMACKeyTemplate(),
+		NewHMACKeyTemplate(WithHMACDigest(tpm2.HashAlgorithmSHA512)),
+		NewDerivationParentTemplate(),
+		NewSealedObjectTemplate(),
+	} {
+		c.Check(ValidatePublic(template), IsNil, Commentf("template %d", i))
+	}
+}
+
+type testValidatePublicInvalidData struct {
+	pub      *tpm2.Public
+	expected string
+}
+
+func (s *validateSuite) TestValidatePublicInvalid(c *C) {
+	for _, data := range []testValidatePublicInvalidData{
+		{
+			pub: func() *tpm2.Public {
+				pub := NewRSAStorageKeyTemplate()
+				pub.Attrs |= tpm2.AttrSign
+				return pub
+			}(),
+			expected: `restricted object must have exactly one of the sign and decrypt attributes set`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewSealedObjectTemplate()
+				pub.Attrs |= tpm2.AttrRestricted
+				return pub
+			}(),
+			expected: `restricted object must have exactly one of the sign and decrypt attributes set`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewRSAStorageKeyTemplate()
+				WithRSAScheme(tpm2.RSASchemeOAEP, tpm2.HashAlgorithmSHA256)(pub)
+				return pub
+			}(),
+			expected: `restricted decryption key cannot have scheme TPM_ALG_OAEP`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewECCStorageKeyTemplate()
+				WithSymmetricScheme(tpm2.SymObjectAlgorithmNull, 0, tpm2.SymModeNull)(pub)
+				return pub
+			}(),
+			expected: `restricted decryption key must have a symmetric algorithm`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewRSAStorageKeyTemplate()
+				WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 128, tpm2.SymModeCTR)(pub)
+				return pub
+			}(),
+			expected: `restricted decryption key must use CFB mode for its symmetric algorithm`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewRSAKeyTemplate(UsageDecrypt)
+				WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 128, tpm2.SymModeCFB)(pub)
+				return pub
+			}(),
+			expected: `only restricted decryption keys can have a symmetric algorithm`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewRSAAttestationKeyTemplate()
+				WithRSAScheme(tpm2.RSASchemeNull, tpm2.HashAlgorithmNull)(pub)
+				return pub
+			}(),
+			expected: `restricted signing key must have a signing scheme`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewRSAKeyTemplate(UsageDecrypt)
+				WithRSAScheme(tpm2.RSASchemeRSASSA, tpm2.HashAlgorithmSHA256)(pub)
+				return pub
+			}(),
+			expected: `decryption key cannot have scheme TPM_ALG_RSASSA`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewECCKeyTemplate(UsageSign)
+				WithECCScheme(tpm2.ECCSchemeECDH, tpm2.HashAlgorithmSHA256)(pub)
+				return pub
+			}(),
+			expected: `signing key cannot have scheme TPM_ALG_ECDH`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewECCKeyTemplate(UsageSign | UsageKeyAgreement)
+				WithECCScheme(tpm2.ECCSchemeECDSA, tpm2.HashAlgorithmSHA256)(pub)
+				return pub
+			}(),
+			expected: `key with both the sign and decrypt attributes cannot have scheme TPM_ALG_ECDSA`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewRSAKeyTemplate(UsageSign)
+				pub.Params.RSADetail.Scheme = tpm2.RSAScheme{Scheme: tpm2.RSASchemeId(tpm2.AlgorithmECDSA)}
+				return pub
+			}(),
+			expected: `scheme TPM_ALG_ECDSA is not valid for RSA keys`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewSealedObjectTemplate()
+				pub.Params.KeyedHashDetail.Scheme = tpm2.KeyedHashScheme{
+					Scheme:  tpm2.KeyedHashSchemeHMAC,
+					Details: &tpm2.SchemeKeyedHashU{HMAC: &tpm2.SchemeHMAC{HashAlg: tpm2.HashAlgorithmSHA256}}}
+				return pub
+			}(),
+			expected: `HMAC scheme is only valid for keys with the sign attribute and without the decrypt attribute`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewHMACKeyTemplate()
+				pub.Attrs = pub.Attrs&^tpm2.AttrSign | tpm2.AttrDecrypt
+				pub.Params.KeyedHashDetail.Scheme = tpm2.KeyedHashScheme{Scheme: tpm2.KeyedHashSchemeHMAC}
+				return pub
+			}(),
+			expected: `HMAC scheme is only valid for keys with the sign attribute and without the decrypt attribute`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewDerivationParentTemplate()
+				pub.Attrs &^= tpm2.AttrRestricted
+				pub.Attrs |= tpm2.AttrSign
+				return pub
+			}(),
+			expected: `XOR scheme is only valid for keys with the decrypt attribute and without the sign attribute`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewDerivationParentTemplate()
+				pub.Params.KeyedHashDetail.Scheme = tpm2.KeyedHashScheme{Scheme: tpm2.KeyedHashSchemeNull}
+				return pub
+			}(),
+			expected: `restricted decryption key must have a XOR scheme`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewSymmetricKeyTemplate(UsageDecrypt)
+				WithSymmetricScheme(tpm2.SymObjectAlgorithmNull, 0, tpm2.SymModeNull)(pub)
+				return pub
+			}(),
+			expected: `symmetric cipher object must have a symmetric algorithm`,
+		},
+		{
+			pub: func() *tpm2.Public {
+				pub := NewSymmetricStorageKeyTemplate()
+				WithSymmetricScheme(tpm2.SymObjectAlgorithmAES, 128, tpm2.SymModeCBC)(pub)
+				return pub
+			}(),
+			expected: `restricted symmetric key must use CFB mode`,
+		},
+	} {
+		c.Check(ValidatePublic(data.pub), ErrorMatches, data.expected)
+	}
+}
+
+func (s *validateSuite) TestTemplateWithInvalidOptionsWithError(c *C) {
+	_, err := NewRSAKeyTemplateWithError(UsageDecrypt, WithRSAScheme(tpm2.RSASchemeRSASSA, tpm2.HashAlgorithmSHA256))
+	c.Check(err, ErrorMatches, `invalid template: decryption key cannot have scheme TPM_ALG_RSASSA`)
+	_, err = NewRSAStorageKeyTemplateWithError(WithRSAScheme(tpm2.RSASchemeOAEP, tpm2.HashAlgorithmSHA256))
+	c.Check(err, ErrorMatches, `invalid template: restricted decryption key cannot have scheme TPM_ALG_OAEP`)
+	_, err = NewECCAttestationKeyTemplateWithError(WithECCScheme(tpm2.ECCSchemeNull, tpm2.HashAlgorithmNull))
+	c.Check(err, ErrorMatches, `invalid template: restricted signing key must have a signing scheme`)
+	_, err = NewSymmetricKeyTemplateWithError(0)
+	c.Check(err, ErrorMatches, `invalid usage`)
+}
+
+func (s *validateSuite) TestTemplateWithInvalidOptionsDoesNotPanic(c *C) {
+	// The functions without the WithError suffix return the template with the
+	// options applied, as they did before validation was added.
+	template := NewRSAKeyTemplate(UsageDecrypt, WithRSAScheme(tpm2.RSASchemeRSASSA, tpm2.HashAlgorithmSHA256))
+	c.Check(template.Params.RSADetail.Scheme.Scheme, Equals, tpm2.RSASchemeRSASSA)
+	c.Check(ValidatePublic(template), NotNil)
+}
+
+func (s *validateSuite) TestTemplateWithError(c *C) {
+	template, err := NewRSAStorageKeyTemplateWithError(WithRSAKeyBits(3072))
+	c.Check(err, IsNil)
+	c.Check(template, DeepEquals, NewRSAStorageKeyTemplate(WithRSAKeyBits(3072)))
+
+	template, err = NewECCKeyTemplateWithError(UsageSign, WithECCScheme(tpm2.ECCSchemeECDSA, tpm2.HashAlgorithmSHA256))
+	c.Check(err, IsNil)
+	c.Check(template, DeepEquals, NewECCKeyTemplate(UsageSign, WithECCScheme(tpm2.ECCSchemeECDSA, tpm2.HashAlgorithmSHA256)))
+}
@@ -5,7 +5,6 @@
 package tpm2
 
 import (
-	"crypto/aes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -74,17 +73,17 @@ func (p *sessionParams) EncryptCommandParameter(cpBytes []byte) error {
 	symmetric := s.Session.Params().Symmetric
 
 	switch symmetric.Algorithm {
-	case SymAlgorithmAES:
+	case SymAlgorithmAES, SymAlgorithmSM4, SymAlgorithmCamellia:
 		if symmetric.Mode.Sym != SymModeCFB {
 			return errors.New("unsupported cipher mode")
 		}
 		k := internal_crypt.KDFa(hashAlg.GetHash(), sessionValue, []byte(CFBKey), s.NonceCaller, s.Session.State().NonceTPM,
-			int(symmetric.KeyBits.Sym)+(aes.BlockSize*8))
+			int(symmetric.KeyBits.Sym)+(symmetric.Algorithm.BlockSize()*8))
 		offset := (symmetric.KeyBits.Sym + 7) / 8
 		symKey := k[0:offset]
 		iv := k[offset:]
 		if err := internal_crypt.SymmetricEncrypt(symmetric.Algorithm, symKey, iv, data); err != nil {
-			return fmt.Errorf("AES encryption failed: %v", err)
+			return fmt.Errorf("%v encryption failed: %v", symmetric.Algorithm, err)
 		}
 	case SymAlgorithmXOR:
 		internal_crypt.XORObfuscation(hashAlg.GetHash(), sessionValue, s.NonceCaller, s.Session.State().NonceTPM, data)
@@ -115,17 +114,17 @@ func (p *sessionParams) DecryptResponseParameter(rpBytes []byte) error {
 	symmetric := s.Session.Params().Symmetric
 
 	switch symmetric.Algorithm {
-	case SymAlgorithmAES:
+	case SymAlgorithmAES, SymAlgorithmSM4, SymAlgorithmCamellia:
 		if symmetric.Mode.Sym != SymModeCFB {
 			return errors.New("unsupported cipher mode")
 		}
 		k := internal_crypt.KDFa(hashAlg.GetHash(), sessionValue, []byte(CFBKey), s.Session.State().NonceTPM, s.NonceCaller,
-			int(symmetric.KeyBits.Sym)+(aes.BlockSize*8))
+			int(symmetric.KeyBits.Sym)+(symmetric.Algorithm.BlockSize()*8))
 		offset := (symmetric.KeyBits.Sym + 7) / 8
 		symKey := k[0:offset]
 		iv := k[offset:]
 		if err := internal_crypt.SymmetricDecrypt(symmetric.Algorithm, symKey, iv, data); err != nil {
-			return fmt.Errorf("AES encryption failed: %v", err)
+			return fmt.Errorf("%v decryption failed: %v", symmetric.Algorithm, err)
 		}
 	case SymAlgorithmXOR:
 		internal_crypt.XORObfuscation(hashAlg.GetHash(), sessionValue, s.Session.State().NonceTPM, s.NonceCaller, data)
@@ -5,6 +5,7 @@
 package policyutil
 
 import (
+	"bytes"
 	"crypto"
 	"errors"
 	"io"
@@ -26,6 +27,45 @@ func ComputePolicyAuthorizationTBSDigest(alg crypto.Hash, message []byte, policy
 	return h.Sum(nil)
 }
 
+// ComputeAuthorizeApprovedHash computes the digest (aHash) that is signed by the authorizing
+// party in order to approve a policy for a TPM2_PolicyAuthorize assertion with the supplied
+// policy ref. The approvedPolicy argument is the digest of the approved policy for the session
+// algorithm. The supplied algorithm must be the name algorithm of the signing key, as this is
+// what the TPM uses to compute the digest when executing TPM2_PolicyAuthorize.
+//
+// This can be used to sign approved policies with signers that aren't supported by
+// [SignPolicyAuthorization] or [Policy.Authorize], such as signers on another machine. The
+// resulting authorization can be added to a policy with [Policy.AddAuthorization].
+//
+// This will panic if the specified digest algorithm is not available.
+func ComputeAuthorizeApprovedHash(approvedPolicy tpm2.Digest, policyRef tpm2.Nonce, alg tpm2.HashAlgorithmId) tpm2.Digest {
+	return ComputePolicyAuthorizationTBSDigest(alg.GetHash(), approvedPolicy, policyRef)
+}
+
+// VerifyAuthorizeApprovedSignature verifies the supplied signature of an approved policy
+// for a TPM2_PolicyAuthorize assertion with the supplied key and policy ref, in the same
+// way that the TPM would. The digest algorithm of the signature must match the name
+// algorithm of the key.
+func VerifyAuthorizeApprovedSignature(authKey *tpm2.Public, approvedPolicy tpm2.Digest, policyRef tpm2.Nonce, signature *tpm2.Signature) (ok bool, err error) {
+	if authKey == nil || signature == nil {
+		return false, errors.New("invalid authorization")
+	}
+	if !authKey.IsAsymmetric() {
+		return false, errors.New("cannot verify HMAC signature")
+	}
+	if !signature.SigAlg.IsValid() {
+		return false, errors.New("invalid signature algorithm")
+	}
+	if !authKey.NameAlg.Available() {
+		return false, errors.New("digest algorithm is not available")
+	}
+	if signature.HashAlg() != authKey.NameAlg {
+		return false, errors.New("signature digest algorithm does not match the name algorithm of the key")
+	}
+	digest := ComputeAuthorizeApprovedHash(approvedPolicy, policyRef, authKey.NameAlg)
+	return cryptutil.VerifySignature(authKey.Public(), digest, signature)
+}
+
 // PolicyAuthorization corresponds to a signed authorization.
 type PolicyAuthorization struct {
 	AuthKey   *tpm2.Public    // The public key of the signer, associated with the corresponding assertion.
@@ -90,10 +130,32 @@ type PolicySignedAuthorization struct {
 	PolicyAuthorization
 }
 
+// BoundToNonce indicates whether this authorization is bound to the session with the
+// specified TPM nonce. It returns false if this authorization isn't bound to any session.
+func (a *PolicySignedAuthorization) BoundToNonce(nonceTPM tpm2.Nonce) bool {
+	return len(a.NonceTPM) > 0 && bytes.Equal(a.NonceTPM, nonceTPM)
+}
+
+// policySignedMessage returns the message that is signed for a TPM2_PolicySigned
+// authorization.
+func policySignedMessage(nonceTPM tpm2.Nonce, cpHashA tpm2.Digest, expiration int32) []byte {
+	return mu.MustMarshalToBytes(mu.Raw(nonceTPM), expiration, mu.Raw(cpHashA))
+}
+
+// ComputePolicyAuthorizationHash computes the digest (aHash) that is signed by the authorizing
+// party for a TPM2_PolicySigned authorization with the supplied parameters. This is the same
+// digest that is signed by [SignPolicySignedAuthorization], and can be used to create
+// authorizations with signers that aren't supported by that function, or to verify
+// authorizations independently.
+//
+// This will panic if the specified digest algorithm is not available.
+func ComputePolicyAuthorizationHash(alg tpm2.HashAlgorithmId, nonceTPM tpm2.Nonce, cpHashA tpm2.Digest, policyRef tpm2.Nonce, expiration int32) tpm2.Digest {
+	return ComputePolicyAuthorizationTBSDigest(alg.GetHash(), policySignedMessage(nonceTPM, cpHashA, expiration), policyRef)
+}
+
 // Verify verifies the signature of this signed authorization.
 func (a *PolicySignedAuthorization) Verify() (ok bool, err error) {
-	msg := mu.MustMarshalToBytes(mu.Raw(a.NonceTPM), a.Expiration, mu.Raw(a.CpHash))
-	return a.PolicyAuthorization.Verify(msg)
+	return a.PolicyAuthorization.Verify(policySignedMessage(a.NonceTPM, a.CpHash, a.Expiration))
 }
 
 type PolicySignedParams struct {
@@ -133,7 +195,7 @@ func SignPolicySignedAuthorization(rand io.Reader, params *PolicySignedParams, a
 		params = new(PolicySignedParams)
 	}
 
-	msg := mu.MustMarshalToBytes(mu.Raw(params.NonceTPM), params.Expiration, mu.Raw(params.CpHash))
+	msg := policySignedMessage(params.NonceTPM, params.CpHash, params.Expiration)
 	auth, err := SignPolicyAuthorization(rand, msg, authKey, policyRef, signer, opts)
 	if err != nil {
 		return nil, err
@@ -12,11 +12,14 @@ import (
 	"crypto/rsa"
 	_ "crypto/sha1"
 	_ "crypto/sha256"
+	"encoding/binary"
 	"io"
+	"math/big"
 
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/cryptutil"
 	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
 	"github.com/canonical/go-tpm2/objectutil"
 	. "github.com/canonical/go-tpm2/policyutil"
@@ -231,3 +234,200 @@ func (s *authSuite) TestSignPolicySignedAuthorizationWithAllRestrictions(c *C) {
 		expectedScheme:  tpm2.SigSchemeAlgECDSA,
 		expectedHash:    tpm2.HashAlgorithmSHA256})
 }
+
+func (s *authSuite) TestComputePolicyAuthorizationHashWithTPM(c *C) {
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	h := crypto.SHA256.New()
+	io.WriteString(h, "params")
+	cpHash := h.Sum(nil)
+
+	// Sign the aHash directly, as an external signer would.
+	aHash := ComputePolicyAuthorizationHash(tpm2.HashAlgorithmSHA256, session.State().NonceTPM, cpHash, []byte("policy"), -100)
+	r, sigS, err := ecdsa.Sign(rand.Reader, key, aHash)
+	c.Assert(err, IsNil)
+
+	sig := &tpm2.Signature{
+		SigAlg: tpm2.SigSchemeAlgECDSA,
+		Signature: &tpm2.SignatureU{
+			ECDSA: &tpm2.SignatureECDSA{
+				Hash:       tpm2.HashAlgorithmSHA256,
+				SignatureR: r.Bytes(),
+				SignatureS: sigS.Bytes()}}}
+
+	loaded, err := s.TPM.LoadExternal(nil, authKey, tpm2.HandleOwner)
+	c.Assert(err, IsNil)
+
+	_, _, err = s.TPM.PolicySigned(loaded, session, true, cpHash, []byte("policy"), -100, sig)
+	c.Check(err, IsNil)
+}
+
+func (s *authSuite) TestComputeAuthorizeApprovedHashWithTPM(c *C) {
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	c.Check(s.TPM.PolicyAuthValue(session), IsNil)
+	approvedPolicy, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+
+	// Sign the aHash directly, as an external signer would.
+	aHash := ComputeAuthorizeApprovedHash(approvedPolicy, []byte("policy"), authKey.NameAlg)
+	r, sigS, err := ecdsa.Sign(rand.Reader, key, aHash)
+	c.Assert(err, IsNil)
+
+	sig := &tpm2.Signature{
+		SigAlg: tpm2.SigSchemeAlgECDSA,
+		Signature: &tpm2.SignatureU{
+			ECDSA: &tpm2.SignatureECDSA{
+				Hash:       tpm2.HashAlgorithmSHA256,
+				SignatureR: r.Bytes(),
+				SignatureS: sigS.Bytes()}}}
+
+	ok, err := VerifyAuthorizeApprovedSignature(authKey, approvedPolicy, []byte("policy"), sig)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+
+	loaded, err := s.TPM.LoadExternal(nil, authKey, tpm2.HandleOwner)
+	c.Assert(err, IsNil)
+
+	ticket, err := s.TPM.VerifySignature(loaded, aHash, sig)
+	c.Assert(err, IsNil)
+
+	c.Check(s.TPM.PolicyAuthorize(session, approvedPolicy, []byte("policy"), authKey.Name(), ticket), IsNil)
+}
+
+type authSuiteNoTPM struct{}
+
+var _ = Suite(&authSuiteNoTPM{})
+
+type testComputePolicyAuthorizationHashData struct {
+	alg        tpm2.HashAlgorithmId
+	nonceTPM   tpm2.Nonce
+	cpHashA    tpm2.Digest
+	policyRef  tpm2.Nonce
+	expiration int32
+}
+
+func (s *authSuiteNoTPM) testComputePolicyAuthorizationHash(c *C, data *testComputePolicyAuthorizationHashData) {
+	aHash := ComputePolicyAuthorizationHash(data.alg, data.nonceTPM, data.cpHashA, data.policyRef, data.expiration)
+
+	h := data.alg.NewHash()
+	h.Write(data.nonceTPM)
+	binary.Write(h, binary.BigEndian, data.expiration)
+	h.Write(data.cpHashA)
+	h.Write(data.policyRef)
+	c.Check(aHash, DeepEquals, tpm2.Digest(h.Sum(nil)))
+
+	// Check that the digest matches the one signed by SignPolicySignedAuthorization.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	params := &PolicySignedParams{
+		NonceTPM:   data.nonceTPM,
+		CpHash:     data.cpHashA,
+		Expiration: data.expiration,
+	}
+	auth, err := SignPolicySignedAuthorization(rand.Reader, params, authKey, data.policyRef, key, data.alg)
+	c.Assert(err, IsNil)
+
+	ok, err := cryptutil.VerifySignature(&key.PublicKey, aHash, auth.Signature)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+
+	c.Check(ecdsa.Verify(&key.PublicKey, aHash,
+		new(big.Int).SetBytes(auth.Signature.Signature.ECDSA.SignatureR),
+		new(big.Int).SetBytes(auth.Signature.Signature.ECDSA.SignatureS)), internal_testutil.IsTrue)
+}
+
+func (s *authSuiteNoTPM) TestComputePolicyAuthorizationHashNoRestrictions(c *C) {
+	s.testComputePolicyAuthorizationHash(c, &testComputePolicyAuthorizationHashData{
+		alg: tpm2.HashAlgorithmSHA256})
+}
+
+func (s *authSuiteNoTPM) TestComputePolicyAuthorizationHashAllRestrictions(c *C) {
+	s.testComputePolicyAuthorizationHash(c, &testComputePolicyAuthorizationHashData{
+		alg:        tpm2.HashAlgorithmSHA256,
+		nonceTPM:   internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865"),
+		cpHashA:    internal_testutil.DecodeHexString(c, "53c234e5e8472b6ac51c1ae1cab3fe06fad053beb8ebfd8977b010655bfdd3c3"),
+		policyRef:  []byte("policy"),
+		expiration: -100})
+}
+
+func (s *authSuiteNoTPM) TestComputePolicyAuthorizationHashSHA1(c *C) {
+	s.testComputePolicyAuthorizationHash(c, &testComputePolicyAuthorizationHashData{
+		alg:        tpm2.HashAlgorithmSHA1,
+		policyRef:  []byte("foo"),
+		expiration: 60})
+}
+
+func (s *authSuiteNoTPM) TestComputeAuthorizeApprovedHash(c *C) {
+	approvedPolicy := internal_testutil.DecodeHexString(c, "8fcd2169ab92694e0c633f1ab772842b8241bbc20288981fc7ac1eddc1fddb0e")
+	aHash := ComputeAuthorizeApprovedHash(approvedPolicy, []byte("foo"), tpm2.HashAlgorithmSHA256)
+
+	h := crypto.SHA256.New()
+	h.Write(approvedPolicy)
+	io.WriteString(h, "foo")
+	c.Check(aHash, DeepEquals, tpm2.Digest(h.Sum(nil)))
+}
+
+func (s *authSuiteNoTPM) TestVerifyAuthorizeApprovedSignature(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	approvedPolicy := internal_testutil.DecodeHexString(c, "8fcd2169ab92694e0c633f1ab772842b8241bbc20288981fc7ac1eddc1fddb0e")
+
+	// Check that an authorization produced by SignPolicyAuthorization verifies.
+	auth, err := SignPolicyAuthorization(rand.Reader, approvedPolicy, authKey, []byte("foo"), key, crypto.SHA256)
+	c.Assert(err, IsNil)
+
+	ok, err := VerifyAuthorizeApprovedSignature(authKey, approvedPolicy, []byte("foo"), auth.Signature)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+
+	ok, err = VerifyAuthorizeApprovedSignature(authKey, approvedPolicy, []byte("bar"), auth.Signature)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+}
+
+func (s *authSuiteNoTPM) TestVerifyAuthorizeApprovedSignatureMismatchedAlg(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey, objectutil.WithNameAlg(tpm2.HashAlgorithmSHA1))
+	c.Assert(err, IsNil)
+
+	approvedPolicy := internal_testutil.DecodeHexString(c, "8fcd2169ab92694e0c633f1ab772842b8241bbc20288981fc7ac1eddc1fddb0e")
+
+	auth, err := SignPolicyAuthorization(rand.Reader, approvedPolicy, authKey, nil, key, crypto.SHA256)
+	c.Assert(err, IsNil)
+
+	_, err = VerifyAuthorizeApprovedSignature(authKey, approvedPolicy, nil, auth.Signature)
+	c.Check(err, ErrorMatches, `signature digest algorithm does not match the name algorithm of the key`)
+}
+
+func (s *authSuiteNoTPM) TestPolicySignedAuthorizationBoundToNonce(c *C) {
+	auth := &PolicySignedAuthorization{NonceTPM: []byte("nonce1")}
+	c.Check(auth.BoundToNonce([]byte("nonce1")), internal_testutil.IsTrue)
+	c.Check(auth.BoundToNonce([]byte("nonce2")), internal_testutil.IsFalse)
+	c.Check(auth.BoundToNonce(nil), internal_testutil.IsFalse)
+}
+
+func (s *authSuiteNoTPM) TestPolicySignedAuthorizationBoundToNonceUnbound(c *C) {
+	auth := &PolicySignedAuthorization{Expiration: -100}
+	c.Check(auth.BoundToNonce([]byte("nonce1")), internal_testutil.IsFalse)
+	c.Check(auth.BoundToNonce(nil), internal_testutil.IsFalse)
+}
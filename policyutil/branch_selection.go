@@ -0,0 +1,140 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import "fmt"
+
+// PolicyBranchRejectedReason describes why a path was rejected during automatic
+// branch selection.
+type PolicyBranchRejectedReason int
+
+const (
+	// PolicyBranchRejectedInvalid indicates that the path is invalid and would
+	// always fail.
+	PolicyBranchRejectedInvalid PolicyBranchRejectedReason = iota + 1
+
+	// PolicyBranchRejectedIgnoredResource indicates that the path contains an
+	// assertion that PolicyExecuteParams.IgnoreAuthorizations or
+	// PolicyExecuteParams.IgnoreNV requested to be ignored.
+	PolicyBranchRejectedIgnoredResource
+
+	// PolicyBranchRejectedMissingAuthorizedPolicy indicates that the path contains a
+	// TPM2_PolicyAuthorize assertion with no candidate authorized policies.
+	PolicyBranchRejectedMissingAuthorizedPolicy
+
+	// PolicyBranchRejectedUsageMismatch indicates that the path is incompatible with
+	// PolicyExecuteParams.Usage.
+	PolicyBranchRejectedUsageMismatch
+
+	// PolicyBranchRejectedPCRMismatch indicates that the path contains a TPM2_PolicyPCR
+	// assertion that doesn't match the current PCR values.
+	PolicyBranchRejectedPCRMismatch
+
+	// PolicyBranchRejectedCounterTimerMismatch indicates that the path contains a
+	// TPM2_PolicyCounterTimer assertion that will fail.
+	PolicyBranchRejectedCounterTimerMismatch
+
+	// PolicyBranchRejectedNVMismatch indicates that the path contains a TPM2_PolicyNV
+	// assertion that will fail.
+	PolicyBranchRejectedNVMismatch
+
+	// PolicyBranchRejectedNvWrittenMismatch indicates that the path contains a
+	// TPM2_PolicyNvWritten assertion that doesn't match the written state of the
+	// NV index identified by the session usage.
+	PolicyBranchRejectedNvWrittenMismatch
+)
+
+func (r PolicyBranchRejectedReason) String() string {
+	switch r {
+	case PolicyBranchRejectedInvalid:
+		return "invalid"
+	case PolicyBranchRejectedIgnoredResource:
+		return "ignored resource"
+	case PolicyBranchRejectedMissingAuthorizedPolicy:
+		return "missing authorized policy"
+	case PolicyBranchRejectedUsageMismatch:
+		return "usage mismatch"
+	case PolicyBranchRejectedPCRMismatch:
+		return "PCR mismatch"
+	case PolicyBranchRejectedCounterTimerMismatch:
+		return "counter timer mismatch"
+	case PolicyBranchRejectedNVMismatch:
+		return "NV mismatch"
+	case PolicyBranchRejectedNvWrittenMismatch:
+		return "NV written mismatch"
+	default:
+		return fmt.Sprintf("PolicyBranchRejectedReason(%d)", int(r))
+	}
+}
+
+// PolicyBranchSelectionReason describes why a path was selected during automatic
+// branch selection.
+type PolicyBranchSelectionReason int
+
+const (
+	// PolicyBranchSelectionReasonUsageMatch indicates that the selected path contains
+	// assertions that match PolicyExecuteParams.Usage, and doesn't require any other
+	// authorizations.
+	PolicyBranchSelectionReasonUsageMatch PolicyBranchSelectionReason = iota + 1
+
+	// PolicyBranchSelectionReasonPCRMatch indicates that the selected path contains
+	// TPM2_PolicyPCR assertions that match the current PCR values, and doesn't require
+	// any other authorizations.
+	PolicyBranchSelectionReasonPCRMatch
+
+	// PolicyBranchSelectionReasonPreferred indicates that the selected path doesn't
+	// require any other authorizations.
+	PolicyBranchSelectionReasonPreferred
+
+	// PolicyBranchSelectionReasonFirstSatisfiable indicates that no path could be
+	// executed without other authorizations, so the first satisfiable path was
+	// selected.
+	PolicyBranchSelectionReasonFirstSatisfiable
+)
+
+func (r PolicyBranchSelectionReason) String() string {
+	switch r {
+	case PolicyBranchSelectionReasonUsageMatch:
+		return "usage match"
+	case PolicyBranchSelectionReasonPCRMatch:
+		return "PCR match"
+	case PolicyBranchSelectionReasonPreferred:
+		return "preferred"
+	case PolicyBranchSelectionReasonFirstSatisfiable:
+		return "first satisfiable"
+	default:
+		return fmt.Sprintf("PolicyBranchSelectionReason(%d)", int(r))
+	}
+}
+
+// PolicyBranchSelectionRecord describes the automatic selection of a path at a branch
+// node or authorized policy during [Policy.Execute].
+type PolicyBranchSelectionRecord struct {
+	// Path is the path of the branch containing the branch node or authorized
+	// policy.
+	Path string
+
+	// Evaluated contains every path that was evaluated, relative to Path.
+	Evaluated []string
+
+	// Rejected contains the reason that each rejected path was rejected.
+	Rejected map[string]PolicyBranchRejectedReason
+
+	// Satisfiable contains every path that wasn't rejected.
+	Satisfiable []string
+
+	// Selected is the selected path, or empty if no path could be selected.
+	Selected string
+
+	// Reason is the reason that the selected path was selected. This is zero if no
+	// path could be selected.
+	Reason PolicyBranchSelectionReason
+}
+
+// PolicyBranchSelectionLogger is supplied via [PolicyExecuteParams] to obtain records of
+// automatic branch selection decisions made during [Policy.Execute].
+type PolicyBranchSelectionLogger interface {
+	LogBranchSelection(record *PolicyBranchSelectionRecord)
+}
@@ -144,6 +144,7 @@ func newPolicyBuilderBranch(policy *PolicyBuilder, alg tpm2.HashAlgorithmId, nam
 		policyBranch: policyBranch{Name: policyBranchName(name)},
 		runner:       policyBuilderBranchRunner{policySession: newComputePolicySession(alg, digest, false)},
 	}
+	out.runner.policySession.minPcrSelectSize = policy.compat.MinPCRSelectSize
 	if len(digest) == 0 || bytes.Equal(digest, make(tpm2.Digest, alg.Size())) {
 		out.parentIsEmpty = true
 	}
@@ -258,6 +259,71 @@ func (b *PolicyBuilderBranch) PolicyNV(nvIndex *tpm2.NVPublic, operandB tpm2.Ope
 	return digest, nil
 }
 
+// PolicyNVEquals adds a TPM2_PolicyNV assertion to this branch in order to bind the policy to
+// the contents of the specified index being equal to the supplied value, starting at the
+// specified offset from the start of the NV index data. This is equivalent to calling
+// [PolicyBuilderBranch.PolicyNV] with the [tpm2.OpEq] operation.
+func (b *PolicyBuilderBranch) PolicyNVEquals(nvIndex *tpm2.NVPublic, value tpm2.Operand, offset uint16) (tpm2.Digest, error) {
+	return b.PolicyNV(nvIndex, value, offset, tpm2.OpEq)
+}
+
+// PolicyNVGreaterThan adds a TPM2_PolicyNV assertion to this branch in order to bind the
+// policy to the 8 bytes of the specified index, starting at the specified offset from the
+// start of the NV index data, being greater than the supplied value when interpreted as a
+// big-endian unsigned integer. This is useful for counter indices, where offset should be 0.
+// This is equivalent to calling [PolicyBuilderBranch.PolicyNV] with a 8-byte big-endian
+// operand and the [tpm2.OpUnsignedGT] operation.
+func (b *PolicyBuilderBranch) PolicyNVGreaterThan(nvIndex *tpm2.NVPublic, value uint64, offset uint16) (tpm2.Digest, error) {
+	return b.PolicyNV(nvIndex, mu.MustMarshalToBytes(value), offset, tpm2.OpUnsignedGT)
+}
+
+// PolicyNVLessThan adds a TPM2_PolicyNV assertion to this branch in order to bind the policy
+// to the 8 bytes of the specified index, starting at the specified offset from the start of
+// the NV index data, being less than the supplied value when interpreted as a big-endian
+// unsigned integer. This is useful for counter indices, where offset should be 0. This is
+// equivalent to calling [PolicyBuilderBranch.PolicyNV] with a 8-byte big-endian operand and
+// the [tpm2.OpUnsignedLT] operation.
+func (b *PolicyBuilderBranch) PolicyNVLessThan(nvIndex *tpm2.NVPublic, value uint64, offset uint16) (tpm2.Digest, error) {
+	return b.PolicyNV(nvIndex, mu.MustMarshalToBytes(value), offset, tpm2.OpUnsignedLT)
+}
+
+// PolicyNVCounterAtLeast adds a TPM2_PolicyNV assertion to this branch in order to bind the
+// policy to the value of the specified counter index being greater than or equal to the
+// supplied value. This is useful for anti-rollback protection with a monotonic counter. The
+// index must be a counter index. This is equivalent to calling [PolicyBuilderBranch.PolicyNV]
+// with a 8-byte big-endian operand, an offset of 0 and the [tpm2.OpUnsignedGE] operation.
+func (b *PolicyBuilderBranch) PolicyNVCounterAtLeast(nvIndex *tpm2.NVPublic, minValue uint64) (tpm2.Digest, error) {
+	if nvIndex == nil {
+		return nil, b.policy.fail("PolicyNVCounterAtLeast", errors.New("no nvIndex"))
+	}
+	if nvIndex.Attrs.Type() != tpm2.NVTypeCounter {
+		return nil, b.policy.fail("PolicyNVCounterAtLeast", errors.New("nvIndex is not a counter"))
+	}
+	return b.PolicyNV(nvIndex, mu.MustMarshalToBytes(minValue), 0, tpm2.OpUnsignedGE)
+}
+
+// PolicyNVBitsSet adds a TPM2_PolicyNV assertion to this branch in order to bind the policy
+// to all of the bits in the supplied mask being set in the specified index. This is useful for
+// bit field indices. This is equivalent to calling [PolicyBuilderBranch.PolicyNV] with the mask
+// as a 8-byte big-endian operand, an offset of 0 and the [tpm2.OpBitset] operation.
+func (b *PolicyBuilderBranch) PolicyNVBitsSet(nvIndex *tpm2.NVPublic, mask uint64) (tpm2.Digest, error) {
+	if mask == 0 {
+		return nil, b.policy.fail("PolicyNVBitsSet", errors.New("empty mask"))
+	}
+	return b.PolicyNV(nvIndex, mu.MustMarshalToBytes(mask), 0, tpm2.OpBitset)
+}
+
+// PolicyNVBitsClear adds a TPM2_PolicyNV assertion to this branch in order to bind the policy
+// to all of the bits in the supplied mask being clear in the specified index. This is useful
+// for bit field indices. This is equivalent to calling [PolicyBuilderBranch.PolicyNV] with the
+// mask as a 8-byte big-endian operand, an offset of 0 and the [tpm2.OpBitclear] operation.
+func (b *PolicyBuilderBranch) PolicyNVBitsClear(nvIndex *tpm2.NVPublic, mask uint64) (tpm2.Digest, error) {
+	if mask == 0 {
+		return nil, b.policy.fail("PolicyNVBitsClear", errors.New("empty mask"))
+	}
+	return b.PolicyNV(nvIndex, mu.MustMarshalToBytes(mask), 0, tpm2.OpBitclear)
+}
+
 // PolicySecret adds a TPM2_PolicySecret assertion to this branch so that the policy requires
 // knowledge of the authorization value of the object associated with authObject.
 func (b *PolicyBuilderBranch) PolicySecret(authObject Named, policyRef tpm2.Nonce) (tpm2.Digest, error) {
@@ -401,7 +467,7 @@ func (b *PolicyBuilderBranch) PolicyCommandCode(code tpm2.CommandCode) (tpm2.Dig
 		Details: &policyElementDetails{
 			CommandCode: &policyCommandCodeElement{CommandCode: code}}}
 	if err := element.runner().run(&b.runner); err != nil {
-		return nil, b.policy.fail("PolicyAuthValue", fmt.Errorf("internal error: %w", err))
+		return nil, b.policy.fail("PolicyCommandCode", fmt.Errorf("internal error: %w", err))
 	}
 	b.policyBranch.Policy = append(b.policyBranch.Policy, element)
 
@@ -414,6 +480,14 @@ func (b *PolicyBuilderBranch) PolicyCommandCode(code tpm2.CommandCode) (tpm2.Dig
 
 // PolicyCounterTimer adds a TPM2_PolicyCounterTimer assertion to this branch to bind the policy
 // to the contents of the [tpm2.TimeInfo] structure.
+//
+// The offset is relative to the start of the marshalled TPMS_TIME_INFO structure, which
+// contains the time (offset 0, 8 bytes), clock (offset 8, 8 bytes), resetCount (offset 16,
+// 4 bytes), restartCount (offset 20, 4 bytes) and safe (offset 24, 1 byte) fields. Note that
+// the PCR update counter returned from TPM2_PCR_Read is not part of this structure, and there
+// is no policy assertion that can be used to bind a policy to it. Use [PolicyBuilderBranch.PolicyPCR]
+// or [PolicyBuilderBranch.PolicyPCRFromTPM] to bind a policy to a set of PCR values instead, which
+// is invalidated when any of the selected PCRs are extended.
 func (b *PolicyBuilderBranch) PolicyCounterTimer(operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) (tpm2.Digest, error) {
 	if err := b.prepareToModifyBranch(); err != nil {
 		return nil, b.policy.fail("PolicyCounterTimer", err)
@@ -546,6 +620,31 @@ func (b *PolicyBuilderBranch) PolicyPCR(values tpm2.PCRValues) (tpm2.Digest, err
 	return digest, nil
 }
 
+// PolicyPCRFromTPM adds a TPM2_PolicyPCR assertion to this branch in order to bind the policy to
+// the current values of the specified PCRs, which are read from the supplied TPM with
+// [tpm2.TPMContext.PCRReadAll]. This binds the policy to a snapshot of the system state, so that
+// the policy is invalidated if any of the selected PCRs are subsequently extended. Any
+// sessions supplied should have the [tpm2.AttrContinueSession] attribute defined.
+//
+// On success, this returns the value of the TPM's pcrUpdateCounter that applies to the values
+// that were read, in addition to the updated digest.
+func (b *PolicyBuilderBranch) PolicyPCRFromTPM(tpm *tpm2.TPMContext, pcrs tpm2.PCRSelectionList, sessions ...tpm2.SessionContext) (digest tpm2.Digest, pcrUpdateCounter uint32, err error) {
+	if err := b.prepareToModifyBranch(); err != nil {
+		return nil, 0, b.policy.fail("PolicyPCRFromTPM", err)
+	}
+
+	pcrUpdateCounter, values, err := tpm.PCRReadAll(pcrs, sessions...)
+	if err != nil {
+		return nil, 0, b.policy.fail("PolicyPCRFromTPM", fmt.Errorf("cannot read PCR values: %w", err))
+	}
+
+	digest, err = b.PolicyPCR(values)
+	if err != nil {
+		return nil, 0, err
+	}
+	return digest, pcrUpdateCounter, nil
+}
+
 // PolicyDuplicationSelect adds a TPM2_PolicyDuplicationSelect assertion to this branch in order
 // to permit duplication of object to newParent with the [tpm2.TPMContext.Duplicate] function.
 // If includeObject is true, then the assertion is bound to both object and newParent. If
@@ -554,7 +653,9 @@ func (b *PolicyBuilderBranch) PolicyPCR(values tpm2.PCRValues) (tpm2.Digest, err
 // the object name must be supplied because the assertion sets the name hash of the session. If
 // object is supplied here, then it will be included in the policy and used when the assertion is
 // executed. If it isn't supplied here, then it will be obtained from the [PolicySessionUsage]
-// supplied to [Policy.Execute].
+// supplied to [Policy.Execute], which will normally correspond to the object being duplicated.
+// This isn't possible if includeObject is true, as the object name is then part of the policy
+// digest and must be supplied here.
 func (b *PolicyBuilderBranch) PolicyDuplicationSelect(object, newParent Named, includeObject bool) (tpm2.Digest, error) {
 	if err := b.prepareToModifyBranch(); err != nil {
 		return nil, b.policy.fail("PolicyDuplicationSelect", err)
@@ -619,6 +720,30 @@ func (b *PolicyBuilderBranch) PolicyPassword() (tpm2.Digest, error) {
 	return digest, nil
 }
 
+// PolicyPhysicalPresence adds a TPM2_PolicyPhysicalPresence assertion to this branch so that
+// the policy requires physical presence to be asserted on the platform when the policy session
+// is used.
+func (b *PolicyBuilderBranch) PolicyPhysicalPresence() (tpm2.Digest, error) {
+	if err := b.prepareToModifyBranch(); err != nil {
+		return nil, b.policy.fail("PolicyPhysicalPresence", err)
+	}
+
+	element := &policyElement{
+		Type: tpm2.CommandPolicyPhysicalPresence,
+		Details: &policyElementDetails{
+			PhysicalPresence: new(policyPhysicalPresenceElement)}}
+	if err := element.runner().run(&b.runner); err != nil {
+		return nil, b.policy.fail("PolicyPhysicalPresence", fmt.Errorf("internal error: %w", err))
+	}
+	b.policyBranch.Policy = append(b.policyBranch.Policy, element)
+
+	digest, err := b.runner.session().PolicyGetDigest()
+	if err != nil {
+		return nil, b.policy.fail("PolicyPhysicalPresence", fmt.Errorf("internal error: %w", err))
+	}
+	return digest, nil
+}
+
 // PolicyNvWritten adds a TPM2_PolicyNvWritten assertion to this branch in order to bind the
 // policy to the status of the [tpm2.AttrNVWritten] attribute for the NV index on which the
 // session is used.
@@ -643,6 +768,41 @@ func (b *PolicyBuilderBranch) PolicyNvWritten(writtenSet bool) (tpm2.Digest, err
 	return digest, nil
 }
 
+// PolicyParameters adds a TPM2_PolicyParameters assertion to this branch in order to bind the
+// policy to the supplied command parameters. Unlike [PolicyBuilderBranch.PolicyCpHash], the
+// command handles are not included.
+//
+// As a policy has to have the same algorithm as the parameters hash, policies with this
+// assertion can only be computed for a single digest algorithm.
+//
+// Note that TPM2_PolicyParameters was introduced in version 1.83 of the TPM 2.0 Library
+// Specification, and is not supported by older TPMs.
+func (b *PolicyBuilderBranch) PolicyParameters(code tpm2.CommandCode, params ...interface{}) (tpm2.Digest, error) {
+	if err := b.prepareToModifyBranch(); err != nil {
+		return nil, b.policy.fail("PolicyParameters", err)
+	}
+
+	pHash, err := ComputeParametersHash(b.alg(), code, params...)
+	if err != nil {
+		return nil, b.policy.fail("PolicyParameters", fmt.Errorf("cannot compute pHash: %w", err))
+	}
+
+	element := &policyElement{
+		Type: tpm2.CommandPolicyParameters,
+		Details: &policyElementDetails{
+			Parameters: &policyParametersElement{Digest: pHash}}}
+	if err := element.runner().run(&b.runner); err != nil {
+		return nil, b.policy.fail("PolicyParameters", fmt.Errorf("internal error: %w", err))
+	}
+	b.policyBranch.Policy = append(b.policyBranch.Policy, element)
+
+	digest, err := b.runner.session().PolicyGetDigest()
+	if err != nil {
+		return nil, b.policy.fail("PolicyParameters", fmt.Errorf("internal error: %w", err))
+	}
+	return digest, nil
+}
+
 // PolicyOR adds a TPM2_PolicyOR assertion to this branch for low-level control of policies
 // that can be satisfied with different sets of conditions. This is to make it possible to
 // use this API to compute digests of policies with branches without having to use the
@@ -691,6 +851,18 @@ func (b *PolicyBuilderBranch) PolicyOR(pHashList ...tpm2.Digest) (tpm2.Digest, e
 // branch, or any ancestor branches, or by calling [PolicyBuilder.Policy] or
 // [PolicyBuilder.Digest]. This ensures that branches can only append to a policy with
 // the [PolicyBuilder] API.
+//
+// A common use of this is a policy that is normally satisfied by the current PCR values,
+// with a recovery path that is satisfied by a policy signed by an authorizing key:
+//
+//	node := builder.RootBranch().AddBranchNode()
+//	node.AddBranch("pcr").PolicyPCR(values)
+//	node.AddBranch("recovery").PolicyAuthorize(policyRef, authKey)
+//
+// When a path is selected automatically by [Policy.Execute] with the
+// PreferPathsWithoutAuthorize field of [PolicyExecuteParams] set, the "pcr" branch will be
+// selected if the PCR values match. Otherwise, the "recovery" branch will be selected if
+// [PolicyResources.AuthorizedPolicies] returns a suitable policy signed by authKey.
 func (b *PolicyBuilderBranch) AddBranchNode() *PolicyBuilderBranchNode {
 	if err := b.prepareToModifyBranch(); err != nil {
 		b.policy.fail("AddBranchNode", err)
@@ -719,17 +891,47 @@ func (b *PolicyBuilderBranch) AddBranchNode() *PolicyBuilderBranchNode {
 //
 // XXX: Note that the PolicyBuilder API may change.
 type PolicyBuilder struct {
-	root *PolicyBuilderBranch
-	err  error
+	compat PolicyBuilderCompat
+	root   *PolicyBuilderBranch
+	err    error
 }
 
 // NewPolicyBuilder returns a new PolicyBuilder. It will panic if the supplied algorithm
 // is not available.
+//
+// The policy digest for the supplied algorithm is computed incrementally as assertions are
+// added, and each method that adds an assertion returns the updated digest or an error
+// immediately. The error returned from [PolicyBuilder.Policy] and [PolicyBuilder.Digest]
+// identifies the first method that failed. Digests for other algorithms can be added to the
+// resulting policy with [Policy.AddDigest], and these digests are computed in the same
+// way.
 func NewPolicyBuilder(alg tpm2.HashAlgorithmId) *PolicyBuilder {
+	return NewPolicyBuilderWithCompat(alg, PolicyBuilderCompat{})
+}
+
+// NewPolicyBuilderFor returns a new PolicyBuilder that targets only the supplied
+// algorithm. The running digest is computed eagerly as assertions are added, and each
+// method that adds an assertion returns either the updated digest or an error that
+// identifies that assertion. The final digest is the same as the one returned from
+// [Policy.ComputeFor] for the resulting policy. It will panic if the supplied algorithm
+// is not available.
+func NewPolicyBuilderFor(alg tpm2.HashAlgorithmId) *PolicyBuilder {
+	return NewPolicyBuilder(alg)
+}
+
+// NewPolicyBuilderWithCompat returns a new PolicyBuilder that computes digests
+// using the supplied compatibility options, in order to produce a policy that
+// works on TPMs with specific firmware quirks. The compatibility options are
+// retained in the resulting policy. See [PolicyBuilderCompatForFirmware] for
+// obtaining the options for a specific device. It will panic if the supplied
+// algorithm is not available.
+//
+// Using the zero value for compat is equivalent to using [NewPolicyBuilder].
+func NewPolicyBuilderWithCompat(alg tpm2.HashAlgorithmId, compat PolicyBuilderCompat) *PolicyBuilder {
 	if !alg.Available() {
 		panic("invalid algorithm")
 	}
-	b := new(PolicyBuilder)
+	b := &PolicyBuilder{compat: compat}
 	b.root = newPolicyBuilderBranch(b, alg, "", nil)
 	return b
 }
@@ -830,6 +1032,7 @@ func (b *PolicyBuilder) Policy() (tpm2.Digest, *Policy, error) {
 			PolicyDigests: taggedHashList{{HashAlg: b.root.alg(), Digest: digest}},
 			Policy:        b.root.policyBranch.Policy,
 		},
+		compat: b.compat,
 	}
 	if err := mu.CopyValue(&policy, policy); err != nil {
 		return nil, nil, fmt.Errorf("cannot copy policy metadata: %w", err)
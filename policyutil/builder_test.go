@@ -124,6 +124,216 @@ func (s *builderSuite) TestPolicyNVDifferentOperation(c *C) {
 		expectedDigest: internal_testutil.DecodeHexString(c, "f50564e250f80476c988180e87202c01fd52129abfea4f26eae04ac99641f735")})
 }
 
+func (s *builderSuite) testPolicyNVHelper(c *C, fn func(*PolicyBuilderBranch) (tpm2.Digest, error), data *testBuildPolicyNVData) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	digest, err := fn(builder.RootBranch())
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, data.expectedDigest)
+
+	expectedPolicy := NewMockPolicy(
+		TaggedHashList{{HashAlg: tpm2.HashAlgorithmSHA256, Digest: data.expectedDigest}}, nil,
+		NewMockPolicyNVElement(data.nvPub, data.operandB, data.offset, data.operation))
+
+	digest, policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, data.expectedDigest)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+
+	// Check that the raw API produces the same digest
+	s.testPolicyNV(c, data)
+}
+
+func (s *builderSuite) TestPolicyNVEquals(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+	s.testPolicyNVHelper(c, func(b *PolicyBuilderBranch) (tpm2.Digest, error) {
+		return b.PolicyNVEquals(nvPub, []byte{0x00, 0x10}, 6)
+	}, &testBuildPolicyNVData{
+		nvPub:          nvPub,
+		operandB:       []byte{0x00, 0x10},
+		offset:         6,
+		operation:      tpm2.OpEq,
+		expectedDigest: internal_testutil.DecodeHexString(c, "8a036d065fc5111b3f7d38bf94a1be14c9c605abe02b59abf114d5a383382c38")})
+}
+
+func (s *builderSuite) TestPolicyNVGreaterThan(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+	s.testPolicyNVHelper(c, func(b *PolicyBuilderBranch) (tpm2.Digest, error) {
+		return b.PolicyNVGreaterThan(nvPub, 5, 0)
+	}, &testBuildPolicyNVData{
+		nvPub:          nvPub,
+		operandB:       []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05},
+		offset:         0,
+		operation:      tpm2.OpUnsignedGT,
+		expectedDigest: internal_testutil.DecodeHexString(c, "749efb0846329aa2c65e2b13e5a4958dc098edc8d5e7675deac2df0abfeafc29")})
+}
+
+func (s *builderSuite) TestPolicyNVLessThan(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+	s.testPolicyNVHelper(c, func(b *PolicyBuilderBranch) (tpm2.Digest, error) {
+		return b.PolicyNVLessThan(nvPub, 0x10, 0)
+	}, &testBuildPolicyNVData{
+		nvPub:          nvPub,
+		operandB:       []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10},
+		offset:         0,
+		operation:      tpm2.OpUnsignedLT,
+		expectedDigest: internal_testutil.DecodeHexString(c, "aca835ee02ef5c2060c5b833ccee0ae9117321b162b10a9dd69b0cbc5b4b90d1")})
+}
+
+func (s *builderSuite) TestPolicyNVCounterAtLeast(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+	s.testPolicyNVHelper(c, func(b *PolicyBuilderBranch) (tpm2.Digest, error) {
+		return b.PolicyNVCounterAtLeast(nvPub, 0x0102030405060708)
+	}, &testBuildPolicyNVData{
+		nvPub:          nvPub,
+		operandB:       []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		offset:         0,
+		operation:      tpm2.OpUnsignedGE,
+		expectedDigest: internal_testutil.DecodeHexString(c, "8ec5969321a3159c32198623001d3e3e05aadbccfe085d8276213b06bd230479")})
+}
+
+func (s *builderSuite) TestPolicyNVCounterAtLeastNotCounter(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	_, err := builder.RootBranch().PolicyNVCounterAtLeast(nvPub, 5)
+	c.Check(err, ErrorMatches, `nvIndex is not a counter`)
+	_, _, err = builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling PolicyNVCounterAtLeast: nvIndex is not a counter`)
+}
+
+func (s *builderSuite) TestPolicyNVBitsSet(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeBits.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+	s.testPolicyNVHelper(c, func(b *PolicyBuilderBranch) (tpm2.Digest, error) {
+		return b.PolicyNVBitsSet(nvPub, 0x0000000000000601)
+	}, &testBuildPolicyNVData{
+		nvPub:          nvPub,
+		operandB:       []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x06, 0x01},
+		offset:         0,
+		operation:      tpm2.OpBitset,
+		expectedDigest: internal_testutil.DecodeHexString(c, "ea5cbdd7938d1965dd9ab3506a9ced297027accaf2aa28a417ad026916896428")})
+}
+
+func (s *builderSuite) TestPolicyNVBitsClear(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeBits.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+	s.testPolicyNVHelper(c, func(b *PolicyBuilderBranch) (tpm2.Digest, error) {
+		return b.PolicyNVBitsClear(nvPub, 0x8000000000000010)
+	}, &testBuildPolicyNVData{
+		nvPub:          nvPub,
+		operandB:       []byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10},
+		offset:         0,
+		operation:      tpm2.OpBitclear,
+		expectedDigest: internal_testutil.DecodeHexString(c, "eada468fbd6d5f3078855824d803501f1948893a7baf228112015b16a51ba9cb")})
+}
+
+func (s *builderSuite) TestPolicyNVBitsSetEmptyMask(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeBits.WithAttrs(tpm2.AttrNVAuthRead | tpm2.AttrNVAuthWrite | tpm2.AttrNVWritten),
+		Size:    8}
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	_, err := builder.RootBranch().PolicyNVBitsSet(nvPub, 0)
+	c.Check(err, ErrorMatches, `empty mask`)
+	_, _, err = builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling PolicyNVBitsSet: empty mask`)
+}
+
+func (s *builderSuite) TestIncrementalDigestMatchesAddDigest(c *C) {
+	// The digest returned from each method is the running digest for the
+	// builder's algorithm, and the final one matches the digest computed
+	// for the same algorithm with Policy.AddDigest.
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA1)
+	_, err := builder.RootBranch().PolicyAuthValue()
+	c.Check(err, IsNil)
+	digest, err := builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	c.Check(err, IsNil)
+
+	expectedDigest, err := builder.Digest()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+
+	builder = NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	digest, err = policy.AddDigest(tpm2.HashAlgorithmSHA1)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *builderSuite) TestErrorIdentifiesFirstFailingAssertion(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	_, err := builder.RootBranch().PolicyAuthValue()
+	c.Check(err, IsNil)
+	_, err = builder.RootBranch().PolicySecret(new(tpm2.Public), nil)
+	c.Check(err, ErrorMatches, `invalid authObject name`)
+
+	// Subsequent calls return the original error.
+	_, err = builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	c.Check(err, ErrorMatches, `encountered an error when calling PolicySecret: invalid authObject name`)
+
+	_, _, err = builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling PolicySecret: invalid authObject name`)
+}
+
+func (s *builderSuite) TestNewPolicyBuilderForMatchesComputeFor(c *C) {
+	builder := NewPolicyBuilderFor(tpm2.HashAlgorithmSHA256)
+	digest1, err := builder.RootBranch().PolicyAuthValue()
+	c.Check(err, IsNil)
+	digest2, err := builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	c.Check(err, IsNil)
+	c.Check(digest2, Not(DeepEquals), digest1)
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	expectedDigest, err := policy.ComputeFor(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest2, DeepEquals, expectedDigest)
+}
+
+func (s *builderSuite) TestNewPolicyBuilderForError(c *C) {
+	builder := NewPolicyBuilderFor(tpm2.HashAlgorithmSHA256)
+	_, err := builder.RootBranch().PolicyAuthValue()
+	c.Check(err, IsNil)
+	_, err = builder.RootBranch().PolicyNV(new(tpm2.NVPublic), nil, 0, tpm2.OpEq)
+	c.Check(err, ErrorMatches, `invalid nvIndex`)
+
+	_, _, err = builder.Policy()
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling PolicyNV: invalid nvIndex`)
+}
+
 type testBuildPolicySecretData struct {
 	authObjectName tpm2.Name
 	policyRef      tpm2.Nonce
@@ -1038,6 +1248,31 @@ Policy {
 	c.Check(digest, DeepEquals, expectedDigest)
 }
 
+func (s *builderSuite) TestPolicyPhysicalPresence(c *C) {
+	expectedDigest := tpm2.Digest(internal_testutil.DecodeHexString(c, "0d7c6747b1b9facbba03492097aa9d5af792e5efc07346e05f9daa8b3d9e13b5"))
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	digest, err := builder.RootBranch().PolicyPhysicalPresence()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+
+	expectedPolicy := NewMockPolicy(
+		TaggedHashList{{HashAlg: tpm2.HashAlgorithmSHA256, Digest: expectedDigest}}, nil,
+		NewMockPolicyPhysicalPresenceElement())
+
+	digest, policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+	c.Check(policy.String(), Equals, fmt.Sprintf(`
+Policy {
+ # digest TPM_ALG_SHA256:%#x
+ PolicyPhysicalPresence()
+}`, expectedDigest))
+	digest, err = builder.Digest()
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
 type testBuildPolicyNvWrittenData struct {
 	writtenSet     bool
 	expectedDigest tpm2.Digest
@@ -1078,6 +1313,64 @@ func (s *builderSuite) TestPolicyNvWrittenTrue(c *C) {
 		expectedDigest: internal_testutil.DecodeHexString(c, "f7887d158ae8d38be0ac5319f37a9e07618bf54885453c7a54ddb0c6a6193beb")})
 }
 
+type testBuildPolicyParametersData struct {
+	alg            tpm2.HashAlgorithmId
+	code           tpm2.CommandCode
+	params         []interface{}
+	expectedPHash  tpm2.Digest
+	expectedDigest tpm2.Digest
+}
+
+func (s *builderSuite) testPolicyParameters(c *C, data *testBuildPolicyParametersData) {
+	builder := NewPolicyBuilder(data.alg)
+	digest, err := builder.RootBranch().PolicyParameters(data.code, data.params...)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, data.expectedDigest)
+
+	expectedPolicy := NewMockPolicy(
+		TaggedHashList{{HashAlg: data.alg, Digest: data.expectedDigest}}, nil,
+		NewMockPolicyParametersElement(data.expectedPHash))
+
+	digest, policy, err := builder.Policy()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, data.expectedDigest)
+	c.Check(policy, testutil.TPMValueDeepEquals, expectedPolicy)
+	c.Check(policy.String(), Equals, fmt.Sprintf(`
+Policy {
+ # digest %v:%#x
+ PolicyParameters(%#x)
+}`, data.alg, data.expectedDigest, data.expectedPHash))
+	digest, err = builder.Digest()
+	c.Check(digest, DeepEquals, data.expectedDigest)
+}
+
+func (s *builderSuite) TestPolicyParameters(c *C) {
+	s.testPolicyParameters(c, &testBuildPolicyParametersData{
+		alg:            tpm2.HashAlgorithmSHA256,
+		code:           tpm2.CommandNVWrite,
+		params:         []interface{}{tpm2.MaxNVBuffer{1, 2, 3, 4}, uint16(0)},
+		expectedPHash:  internal_testutil.DecodeHexString(c, "67099da5ae37734378cc8d61368bae3fb99a19d69e59f79dc10f254ea357a901"),
+		expectedDigest: internal_testutil.DecodeHexString(c, "313f5ce45106f055bcbc74869c29d9585c23ee23cef82652172d4928a625f07f")})
+}
+
+func (s *builderSuite) TestPolicyParametersDifferentParams(c *C) {
+	s.testPolicyParameters(c, &testBuildPolicyParametersData{
+		alg:            tpm2.HashAlgorithmSHA256,
+		code:           tpm2.CommandNVWrite,
+		params:         []interface{}{tpm2.MaxNVBuffer{1, 2, 3, 4}, uint16(10)},
+		expectedPHash:  internal_testutil.DecodeHexString(c, "a4ca064a71716fdd4c02772c546bde248ba0171f8dd29f0538c650dc063fe82f"),
+		expectedDigest: internal_testutil.DecodeHexString(c, "4bf595e8965198f7bedcbb140165ee5d204ad8c735ba26155b0c0867b2738e83")})
+}
+
+func (s *builderSuite) TestPolicyParametersSHA1(c *C) {
+	s.testPolicyParameters(c, &testBuildPolicyParametersData{
+		alg:            tpm2.HashAlgorithmSHA1,
+		code:           tpm2.CommandNVWrite,
+		params:         []interface{}{tpm2.MaxNVBuffer{1, 2, 3, 4}, uint16(0)},
+		expectedPHash:  internal_testutil.DecodeHexString(c, "9a4bf699246465a37d499e6a8036f17409c6140c"),
+		expectedDigest: internal_testutil.DecodeHexString(c, "d0b76c8a79b73e7049db13ebfa358986939c9b93")})
+}
+
 type testBuildPolicyORData struct {
 	alg            tpm2.HashAlgorithmId
 	pHashList      tpm2.DigestList
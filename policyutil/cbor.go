@@ -0,0 +1,634 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/internal/cbor"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// cborPolicyVersion is the version of the CBOR representation of a policy.
+const cborPolicyVersion = 1
+
+// Keys of the top-level map in the CBOR representation of a policy.
+const (
+	cborKeyVersion        = 1
+	cborKeyCompat         = 2
+	cborKeyDigests        = 3
+	cborKeyAuthorizations = 4
+	cborKeyElements       = 5
+)
+
+// Tags that identify each element type in the CBOR representation of a policy.
+// These are part of the encoding and must not be changed.
+const (
+	cborTagNV                = 1
+	cborTagSecret            = 2
+	cborTagSigned            = 3
+	cborTagAuthorize         = 4
+	cborTagAuthValue         = 5
+	cborTagCommandCode       = 6
+	cborTagCounterTimer      = 7
+	cborTagCpHash            = 8
+	cborTagNameHash          = 9
+	cborTagOR                = 10
+	cborTagPCR               = 11
+	cborTagDuplicationSelect = 12
+	cborTagPassword          = 13
+	cborTagNvWritten         = 14
+	cborTagParameters        = 15
+	cborTagPhysicalPresence  = 16
+	cborTagRawOR             = 17
+
+	// cborTagOpaque is reserved for elements with a type that isn't supported
+	// by this package, which are retained with their type and serialized details.
+	cborTagOpaque = 18
+)
+
+// cborFields is used to decode the fields of a CBOR map. The first error is
+// retained and returned from done, which also checks that there aren't any
+// unknown fields.
+type cborFields struct {
+	m    cbor.Map
+	used map[uint64]struct{}
+	err  error
+}
+
+func newCBORFields(v interface{}) *cborFields {
+	m, ok := v.(cbor.Map)
+	if !ok {
+		return &cborFields{err: fmt.Errorf("expected map, got %T", v)}
+	}
+	return &cborFields{m: m, used: make(map[uint64]struct{})}
+}
+
+func (f *cborFields) get(key uint64) interface{} {
+	if f.err != nil {
+		return nil
+	}
+	v, exists := f.m[key]
+	if !exists {
+		f.err = fmt.Errorf("missing field %d", key)
+		return nil
+	}
+	f.used[key] = struct{}{}
+	return v
+}
+
+func (f *cborFields) has(key uint64) bool {
+	_, exists := f.m[key]
+	return exists
+}
+
+func (f *cborFields) uint(key uint64, max uint64) uint64 {
+	v := f.get(key)
+	if f.err != nil {
+		return 0
+	}
+	n, ok := v.(uint64)
+	switch {
+	case !ok:
+		f.err = fmt.Errorf("field %d: expected unsigned integer, got %T", key, v)
+	case n > max:
+		f.err = fmt.Errorf("field %d: value %d out of range", key, n)
+	}
+	return n
+}
+
+func (f *cborFields) bytes(key uint64) []byte {
+	v := f.get(key)
+	if f.err != nil {
+		return nil
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		f.err = fmt.Errorf("field %d: expected byte string, got %T", key, v)
+	}
+	return b
+}
+
+func (f *cborFields) text(key uint64) string {
+	v := f.get(key)
+	if f.err != nil {
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		f.err = fmt.Errorf("field %d: expected text string, got %T", key, v)
+	}
+	return s
+}
+
+func (f *cborFields) bool(key uint64) bool {
+	v := f.get(key)
+	if f.err != nil {
+		return false
+	}
+	b, ok := v.(bool)
+	if !ok {
+		f.err = fmt.Errorf("field %d: expected boolean, got %T", key, v)
+	}
+	return b
+}
+
+func (f *cborFields) array(key uint64) []interface{} {
+	v := f.get(key)
+	if f.err != nil {
+		return nil
+	}
+	a, ok := v.([]interface{})
+	if !ok {
+		f.err = fmt.Errorf("field %d: expected array, got %T", key, v)
+	}
+	return a
+}
+
+// tpm decodes a field that contains a TPM structure in the TPM wire format.
+func (f *cborFields) tpm(key uint64, v interface{}) {
+	b := f.bytes(key)
+	if f.err != nil {
+		return
+	}
+	if _, err := mu.UnmarshalFromBytes(b, v); err != nil {
+		f.err = fmt.Errorf("field %d: %w", key, err)
+	}
+}
+
+func (f *cborFields) done() error {
+	if f.err != nil {
+		return f.err
+	}
+	for key := range f.m {
+		if _, used := f.used[key]; !used {
+			return fmt.Errorf("unknown field %d", key)
+		}
+	}
+	return nil
+}
+
+func taggedHashesToCBOR(digests taggedHashList) []interface{} {
+	out := make([]interface{}, 0, len(digests))
+	for _, digest := range digests {
+		out = append(out, cbor.Map{
+			1: uint64(digest.HashAlg),
+			2: []byte(digest.Digest)})
+	}
+	return out
+}
+
+func taggedHashFromCBOR(v interface{}) (taggedHash, error) {
+	f := newCBORFields(v)
+	digest := taggedHash{
+		HashAlg: tpm2.HashAlgorithmId(f.uint(1, math.MaxUint16)),
+		Digest:  f.bytes(2)}
+	return digest, f.done()
+}
+
+func taggedHashesFromCBOR(a []interface{}) (out taggedHashList, err error) {
+	for i, v := range a {
+		digest, err := taggedHashFromCBOR(v)
+		if err != nil {
+			return nil, fmt.Errorf("digest %d: %w", i, err)
+		}
+		out = append(out, digest)
+	}
+	return out, nil
+}
+
+func elementsToCBOR(elements policyElements) ([]interface{}, error) {
+	out := make([]interface{}, 0, len(elements))
+	for i, element := range elements {
+		v, err := element.toCBOR()
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func elementsFromCBOR(a []interface{}) (out policyElements, err error) {
+	for i, v := range a {
+		element, err := elementFromCBOR(v)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		out = append(out, element)
+	}
+	return out, nil
+}
+
+func (e *policyElement) toCBOR() (interface{}, error) {
+	var (
+		tag     uint64
+		details = make(cbor.Map)
+	)
+
+	switch e.Type {
+	case tpm2.CommandPolicyNV:
+		d := e.Details.NV
+		nvIndex, err := mu.MarshalToBytes(d.NvIndex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode nvIndex: %w", err)
+		}
+		tag = cborTagNV
+		details[1] = nvIndex
+		details[2] = []byte(d.OperandB)
+		details[3] = uint64(d.Offset)
+		details[4] = uint64(d.Operation)
+	case tpm2.CommandPolicySecret:
+		d := e.Details.Secret
+		tag = cborTagSecret
+		details[1] = []byte(d.AuthObjectName)
+		details[2] = []byte(d.PolicyRef)
+		details[3] = []byte(d.CpHashA)
+		details[4] = uint64(uint32(d.Expiration))
+	case tpm2.CommandPolicySigned:
+		d := e.Details.Signed
+		authKey, err := mu.MarshalToBytes(d.AuthKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode authKey: %w", err)
+		}
+		tag = cborTagSigned
+		details[1] = authKey
+		details[2] = []byte(d.PolicyRef)
+		details[3] = []byte(d.Unused1)
+		details[4] = uint64(uint32(d.Unused2))
+	case tpm2.CommandPolicyAuthorize:
+		d := e.Details.Authorize
+		keySign, err := mu.MarshalToBytes(d.KeySign)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode keySign: %w", err)
+		}
+		tag = cborTagAuthorize
+		details[1] = []byte(d.PolicyRef)
+		details[2] = keySign
+	case tpm2.CommandPolicyAuthValue:
+		tag = cborTagAuthValue
+	case tpm2.CommandPolicyCommandCode:
+		tag = cborTagCommandCode
+		details[1] = uint64(e.Details.CommandCode.CommandCode)
+	case tpm2.CommandPolicyCounterTimer:
+		d := e.Details.CounterTimer
+		tag = cborTagCounterTimer
+		details[1] = []byte(d.OperandB)
+		details[2] = uint64(d.Offset)
+		details[3] = uint64(d.Operation)
+	case tpm2.CommandPolicyCpHash:
+		tag = cborTagCpHash
+		details[1] = []byte(e.Details.CpHash.Digest)
+	case tpm2.CommandPolicyNameHash:
+		tag = cborTagNameHash
+		details[1] = []byte(e.Details.NameHash.Digest)
+	case tpm2.CommandPolicyOR:
+		branches := make([]interface{}, 0, len(e.Details.OR.Branches))
+		for i, branch := range e.Details.OR.Branches {
+			elements, err := elementsToCBOR(branch.Policy)
+			if err != nil {
+				return nil, fmt.Errorf("branch %d: %w", i, err)
+			}
+			branches = append(branches, cbor.Map{
+				1: string(branch.Name),
+				2: taggedHashesToCBOR(branch.PolicyDigests),
+				3: elements})
+		}
+		tag = cborTagOR
+		details[1] = branches
+	case tpm2.CommandPolicyPCR:
+		pcrs := make([]interface{}, 0, len(e.Details.PCR.PCRs))
+		for _, pcr := range e.Details.PCR.PCRs {
+			pcrs = append(pcrs, cbor.Map{
+				1: uint64(pcr.PCR),
+				2: taggedHashesToCBOR(taggedHashList{pcr.Digest})[0]})
+		}
+		tag = cborTagPCR
+		details[1] = pcrs
+	case tpm2.CommandPolicyDuplicationSelect:
+		d := e.Details.DuplicationSelect
+		tag = cborTagDuplicationSelect
+		details[1] = []byte(d.Object)
+		details[2] = []byte(d.NewParent)
+		details[3] = d.IncludeObject
+	case tpm2.CommandPolicyPassword:
+		tag = cborTagPassword
+	case tpm2.CommandPolicyNvWritten:
+		tag = cborTagNvWritten
+		details[1] = e.Details.NvWritten.WrittenSet
+	case tpm2.CommandPolicyParameters:
+		tag = cborTagParameters
+		details[1] = []byte(e.Details.Parameters.Digest)
+	case tpm2.CommandPolicyPhysicalPresence:
+		tag = cborTagPhysicalPresence
+	case commandRawPolicyOR:
+		hashList := make([]interface{}, 0, len(e.Details.RawOR.HashList))
+		for _, digest := range e.Details.RawOR.HashList {
+			hashList = append(hashList, []byte(digest))
+		}
+		tag = cborTagRawOR
+		details[1] = hashList
+	default:
+		if e.Details.Opaque == nil {
+			return nil, fmt.Errorf("unsupported element type %v", e.Type)
+		}
+		tag = cborTagOpaque
+		details[1] = uint64(e.Type)
+		details[2] = e.Details.Opaque.Data
+	}
+
+	return cbor.Map{tag: details}, nil
+}
+
+func elementFromCBOR(v interface{}) (*policyElement, error) {
+	m, ok := v.(cbor.Map)
+	if !ok {
+		return nil, fmt.Errorf("expected map, got %T", v)
+	}
+	if len(m) != 1 {
+		return nil, fmt.Errorf("expected a single entry, got %d", len(m))
+	}
+
+	var (
+		tag    uint64
+		fields *cborFields
+	)
+	for k, v := range m {
+		tag = k
+		fields = newCBORFields(v)
+	}
+
+	element := &policyElement{Details: new(policyElementDetails)}
+	switch tag {
+	case cborTagNV:
+		d := new(policyNVElement)
+		fields.tpm(1, &d.NvIndex)
+		d.OperandB = fields.bytes(2)
+		d.Offset = uint16(fields.uint(3, math.MaxUint16))
+		d.Operation = tpm2.ArithmeticOp(fields.uint(4, math.MaxUint16))
+		element.Type = tpm2.CommandPolicyNV
+		element.Details.NV = d
+	case cborTagSecret:
+		d := new(policySecretElement)
+		d.AuthObjectName = fields.bytes(1)
+		d.PolicyRef = fields.bytes(2)
+		d.CpHashA = fields.bytes(3)
+		d.Expiration = int32(fields.uint(4, math.MaxUint32))
+		element.Type = tpm2.CommandPolicySecret
+		element.Details.Secret = d
+	case cborTagSigned:
+		d := new(policySignedElement)
+		fields.tpm(1, &d.AuthKey)
+		d.PolicyRef = fields.bytes(2)
+		d.Unused1 = fields.bytes(3)
+		d.Unused2 = int32(fields.uint(4, math.MaxUint32))
+		element.Type = tpm2.CommandPolicySigned
+		element.Details.Signed = d
+	case cborTagAuthorize:
+		d := new(policyAuthorizeElement)
+		d.PolicyRef = fields.bytes(1)
+		fields.tpm(2, &d.KeySign)
+		element.Type = tpm2.CommandPolicyAuthorize
+		element.Details.Authorize = d
+	case cborTagAuthValue:
+		element.Type = tpm2.CommandPolicyAuthValue
+		element.Details.AuthValue = new(policyAuthValueElement)
+	case cborTagCommandCode:
+		element.Type = tpm2.CommandPolicyCommandCode
+		element.Details.CommandCode = &policyCommandCodeElement{
+			CommandCode: tpm2.CommandCode(fields.uint(1, math.MaxUint32))}
+	case cborTagCounterTimer:
+		d := new(policyCounterTimerElement)
+		d.OperandB = fields.bytes(1)
+		d.Offset = uint16(fields.uint(2, math.MaxUint16))
+		d.Operation = tpm2.ArithmeticOp(fields.uint(3, math.MaxUint16))
+		element.Type = tpm2.CommandPolicyCounterTimer
+		element.Details.CounterTimer = d
+	case cborTagCpHash:
+		element.Type = tpm2.CommandPolicyCpHash
+		element.Details.CpHash = &policyCpHashElement{Digest: fields.bytes(1)}
+	case cborTagNameHash:
+		element.Type = tpm2.CommandPolicyNameHash
+		element.Details.NameHash = &policyNameHashElement{Digest: fields.bytes(1)}
+	case cborTagOR:
+		d := new(policyORElement)
+		for i, v := range fields.array(1) {
+			branch, err := branchFromCBOR(v)
+			if err != nil {
+				return nil, fmt.Errorf("branch %d: %w", i, err)
+			}
+			d.Branches = append(d.Branches, branch)
+		}
+		element.Type = tpm2.CommandPolicyOR
+		element.Details.OR = d
+	case cborTagPCR:
+		d := new(policyPCRElement)
+		for i, v := range fields.array(1) {
+			f := newCBORFields(v)
+			pcr := pcrValue{PCR: tpm2.Handle(f.uint(1, math.MaxUint32))}
+			digest := f.get(2)
+			if err := f.done(); err != nil {
+				return nil, fmt.Errorf("PCR %d: %w", i, err)
+			}
+			var err error
+			if pcr.Digest, err = taggedHashFromCBOR(digest); err != nil {
+				return nil, fmt.Errorf("PCR %d: %w", i, err)
+			}
+			d.PCRs = append(d.PCRs, pcr)
+		}
+		element.Type = tpm2.CommandPolicyPCR
+		element.Details.PCR = d
+	case cborTagDuplicationSelect:
+		d := new(policyDuplicationSelectElement)
+		d.Object = fields.bytes(1)
+		d.NewParent = fields.bytes(2)
+		d.IncludeObject = fields.bool(3)
+		element.Type = tpm2.CommandPolicyDuplicationSelect
+		element.Details.DuplicationSelect = d
+	case cborTagPassword:
+		element.Type = tpm2.CommandPolicyPassword
+		element.Details.Password = new(policyPasswordElement)
+	case cborTagNvWritten:
+		element.Type = tpm2.CommandPolicyNvWritten
+		element.Details.NvWritten = &policyNvWrittenElement{WrittenSet: fields.bool(1)}
+	case cborTagParameters:
+		element.Type = tpm2.CommandPolicyParameters
+		element.Details.Parameters = &policyParametersElement{Digest: fields.bytes(1)}
+	case cborTagPhysicalPresence:
+		element.Type = tpm2.CommandPolicyPhysicalPresence
+		element.Details.PhysicalPresence = new(policyPhysicalPresenceElement)
+	case cborTagRawOR:
+		d := new(policyRawORElement)
+		for i, v := range fields.array(1) {
+			digest, ok := v.([]byte)
+			if !ok {
+				return nil, fmt.Errorf("digest %d: expected byte string, got %T", i, v)
+			}
+			d.HashList = append(d.HashList, digest)
+		}
+		element.Type = commandRawPolicyOR
+		element.Details.RawOR = d
+	case cborTagOpaque:
+		element.Type = tpm2.CommandCode(fields.uint(1, math.MaxUint32))
+		if _, opaque := element.Details.Select(reflect.ValueOf(element.Type)).(**policyOpaqueElement); !opaque {
+			return nil, fmt.Errorf("opaque element has supported type %v", element.Type)
+		}
+		element.Details.Opaque = &policyOpaqueElement{Data: fields.bytes(2)}
+	default:
+		return nil, fmt.Errorf("unknown element tag %d", tag)
+	}
+
+	if err := fields.done(); err != nil {
+		return nil, fmt.Errorf("%v: %w", element.runner().name(), err)
+	}
+	return element, nil
+}
+
+func branchFromCBOR(v interface{}) (*policyBranch, error) {
+	f := newCBORFields(v)
+	name := f.text(1)
+	digests := f.array(2)
+	elements := f.array(3)
+	if err := f.done(); err != nil {
+		return nil, err
+	}
+
+	branch := &policyBranch{Name: policyBranchName(name)}
+	var err error
+	if branch.PolicyDigests, err = taggedHashesFromCBOR(digests); err != nil {
+		return nil, err
+	}
+	if branch.Policy, err = elementsFromCBOR(elements); err != nil {
+		return nil, err
+	}
+	return branch, nil
+}
+
+// MarshalCBOR returns a CBOR representation of this policy, which is intended for
+// embedding policies in firmware or constrained agents. Unlike the serialization format
+// used with [github.com/canonical/go-tpm2/mu], it is self-describing. The policy is
+// encoded as a map with small integer keys, and each element is encoded as a map with a
+// single entry which is keyed by a small integer tag that identifies the element type.
+// TPM structures such as the public areas of keys and NV indices are encoded as byte
+// strings containing the TPM wire format, and signed integers are encoded as the unsigned
+// integer with the same 32-bit representation. Elements with a type that isn't supported by
+// this package are encoded under a reserved tag with their type and serialized details, so
+// that they are preserved in the same way as with the regular serialization format.
+//
+// The encoding is deterministic as described in section 4.2.1 of RFC 8949, so equal
+// policies always produce identical bytes.
+func (p *Policy) MarshalCBOR() ([]byte, error) {
+	// Make sure that the policy can be serialized in the regular format,
+	// so that it can be decoded by UnmarshalCBOR.
+	if _, err := mu.MarshalToBytes(p); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	var auths []interface{}
+	for i, auth := range p.policy.PolicyAuthorizations {
+		authKey, err := mu.MarshalToBytes(auth.AuthKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode key for authorization %d: %w", i, err)
+		}
+		signature, err := mu.MarshalToBytes(auth.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode signature for authorization %d: %w", i, err)
+		}
+		auths = append(auths, cbor.Map{
+			1: authKey,
+			2: []byte(auth.PolicyRef),
+			3: signature})
+	}
+
+	elements, err := elementsToCBOR(p.policy.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	m := cbor.Map{
+		cborKeyVersion:  uint64(cborPolicyVersion),
+		cborKeyDigests:  taggedHashesToCBOR(p.policy.PolicyDigests),
+		cborKeyElements: elements}
+	if len(auths) > 0 {
+		m[cborKeyAuthorizations] = auths
+	}
+	if !p.compat.isZero() {
+		m[cborKeyCompat] = cbor.Map{1: uint64(p.compat.MinPCRSelectSize)}
+	}
+
+	return cbor.Marshal(m)
+}
+
+// UnmarshalCBOR decodes a CBOR representation of a policy, as created by
+// [Policy.MarshalCBOR], into this policy. This returns an error if the supplied data
+// isn't deterministically encoded, or if it contains an unknown element tag or field,
+// rather than silently discarding data. On error, this policy is not modified.
+func (p *Policy) UnmarshalCBOR(data []byte) error {
+	v, err := cbor.Unmarshal(data)
+	if err != nil {
+		return fmt.Errorf("cannot decode CBOR: %w", err)
+	}
+
+	f := newCBORFields(v)
+	if version := f.uint(cborKeyVersion, math.MaxUint32); f.err == nil && version != cborPolicyVersion {
+		return errors.New("invalid version")
+	}
+
+	var compat PolicyBuilderCompat
+	if f.has(cborKeyCompat) {
+		cf := newCBORFields(f.get(cborKeyCompat))
+		compat.MinPCRSelectSize = uint8(cf.uint(1, math.MaxUint8))
+		if err := cf.done(); err != nil {
+			return fmt.Errorf("invalid compatibility options: %w", err)
+		}
+	}
+
+	var auths []interface{}
+	if f.has(cborKeyAuthorizations) {
+		auths = f.array(cborKeyAuthorizations)
+	}
+	digests := f.array(cborKeyDigests)
+	elements := f.array(cborKeyElements)
+	if err := f.done(); err != nil {
+		return err
+	}
+
+	var policy policy
+	if policy.PolicyDigests, err = taggedHashesFromCBOR(digests); err != nil {
+		return err
+	}
+	for i, v := range auths {
+		var auth PolicyAuthorization
+		af := newCBORFields(v)
+		af.tpm(1, &auth.AuthKey)
+		auth.PolicyRef = af.bytes(2)
+		af.tpm(3, &auth.Signature)
+		if err := af.done(); err != nil {
+			return fmt.Errorf("authorization %d: %w", i, err)
+		}
+		policy.PolicyAuthorizations = append(policy.PolicyAuthorizations, auth)
+	}
+	if policy.Policy, err = elementsFromCBOR(elements); err != nil {
+		return err
+	}
+
+	// Round-trip the decoded policy through the regular serialization format so
+	// that it is validated in the same way as a policy unmarshalled from it.
+	b, err := mu.MarshalToBytes(&Policy{policy: policy, compat: compat})
+	if err != nil {
+		return fmt.Errorf("invalid policy: %w", err)
+	}
+	var decoded *Policy
+	if _, err := mu.UnmarshalFromBytes(b, &decoded); err != nil {
+		return fmt.Errorf("invalid policy: %w", err)
+	}
+
+	*p = *decoded
+	return nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"crypto/rand"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type cborSuite struct{}
+
+var _ = Suite(&cborSuite{})
+
+func (s *cborSuite) newPolicy(c *C, compat PolicyBuilderCompat) (tpm2.Digest, *Policy) {
+	pub, _ := newTestSigningKey(c)
+
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVWritten),
+		Size:    8}
+
+	builder := NewPolicyBuilderWithCompat(tpm2.HashAlgorithmSHA256, compat)
+	node := builder.RootBranch().AddBranchNode()
+
+	b := node.AddBranch("nv")
+	b.PolicyNvWritten(true)
+	b.PolicyNV(nvPub, []byte{0x00, 0x10}, 2, tpm2.OpUnsignedLT)
+	b.PolicyCounterTimer([]byte{0x01}, 4, tpm2.OpUnsignedGE)
+	b.PolicyCommandCode(tpm2.CommandNVRead)
+
+	b = node.AddBranch("secret")
+	b.PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), []byte("foo"))
+	b.PolicySigned(pub, []byte("bar"))
+	b.PolicyPCR(tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {7: make(tpm2.Digest, 32)}})
+
+	b = node.AddBranch("authorize")
+	b.PolicyAuthorize([]byte("baz"), pub)
+	b.PolicyDuplicationSelect(tpm2.Name{0x40, 0x00, 0x00, 0x01}, tpm2.Name{0x40, 0x00, 0x00, 0x0b}, true)
+
+	b = node.AddBranch("")
+	b.PolicyPassword()
+	b.PolicyPhysicalPresence()
+	b.PolicyCpHash(tpm2.CommandLoad, []Named{tpm2.Name{0x40, 0x00, 0x00, 0x01}}, tpm2.Private{1, 2, 3, 4}, mu.Sized(objectutil.NewRSAStorageKeyTemplate()))
+
+	b = node.AddBranch("raw")
+	b.PolicyAuthValue()
+	b.PolicyOR(make(tpm2.Digest, 32), append(make(tpm2.Digest, 31), 1))
+	b.PolicyNameHash(tpm2.Name{0x40, 0x00, 0x00, 0x01})
+
+	digest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	return digest, policy
+}
+
+func (s *cborSuite) TestRoundTrip(c *C) {
+	expectedDigest, policy := s.newPolicy(c, PolicyBuilderCompat{})
+
+	data, err := policy.MarshalCBOR()
+	c.Assert(err, IsNil)
+
+	var decoded Policy
+	c.Check(decoded.UnmarshalCBOR(data), IsNil)
+	c.Check(mu.MustMarshalToBytes(&decoded), DeepEquals, mu.MustMarshalToBytes(policy))
+
+	digest, err := decoded.Digest(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+
+	// The decoded policy can be validated, which recomputes the digest.
+	digest, err = decoded.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *cborSuite) TestRoundTripWithAuthorizations(c *C) {
+	pub, key := newTestSigningKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Assert(policy.Authorize(rand.Reader, pub, []byte("foo"), key, tpm2.HashAlgorithmSHA256), IsNil)
+
+	data, err := policy.MarshalCBOR()
+	c.Assert(err, IsNil)
+
+	var decoded Policy
+	c.Check(decoded.UnmarshalCBOR(data), IsNil)
+	c.Check(mu.MustMarshalToBytes(&decoded), DeepEquals, mu.MustMarshalToBytes(policy))
+}
+
+func (s *cborSuite) TestRoundTripWithCompat(c *C) {
+	_, policy := s.newPolicy(c, PolicyBuilderCompat{MinPCRSelectSize: 4})
+
+	data, err := policy.MarshalCBOR()
+	c.Assert(err, IsNil)
+
+	var decoded Policy
+	c.Check(decoded.UnmarshalCBOR(data), IsNil)
+	c.Check(decoded.Compat(), Equals, PolicyBuilderCompat{MinPCRSelectSize: 4})
+	c.Check(mu.MustMarshalToBytes(&decoded), DeepEquals, mu.MustMarshalToBytes(policy))
+}
+
+func (s *cborSuite) TestDeterministic(c *C) {
+	_, policy1 := s.newPolicy(c, PolicyBuilderCompat{})
+	_, policy2 := s.newPolicy(c, PolicyBuilderCompat{})
+
+	data1, err := policy1.MarshalCBOR()
+	c.Assert(err, IsNil)
+	data2, err := policy2.MarshalCBOR()
+	c.Assert(err, IsNil)
+	c.Check(data1, DeepEquals, data2)
+
+	// Re-encoding a decoded policy produces identical bytes.
+	var decoded Policy
+	c.Assert(decoded.UnmarshalCBOR(data1), IsNil)
+	data3, err := decoded.MarshalCBOR()
+	c.Check(err, IsNil)
+	c.Check(data3, DeepEquals, data1)
+}
+
+func (s *cborSuite) TestMarshalSimple(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	data, err := policy.MarshalCBOR()
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, internal_testutil.DecodeHexString(c,
+		"a3"+ // map(3)
+			"0101"+ // version: 1
+			"03"+"81"+"a2"+"01"+"0b"+"02"+"5820"+"3f230bdefd5946f1eab301b1648dd0bb74873710d3f8c6e24e9ccc2bfb51eb48"+ // digests: [{alg: SHA256, digest}]
+			"05"+"82"+"a1"+"05"+"a0"+"a1"+"06"+"a1"+"01"+"19015e")) // elements: [{AuthValue: {}}, {CommandCode: {code: TPM_CC_Unseal}}]
+}
+
+func (s *cborSuite) TestRoundTripUnsupportedElement(c *C) {
+	b, expectedDigest := unsupportedElementPolicy(c)
+	var policy *Policy
+	_, err := mu.UnmarshalFromBytes(b, &policy)
+	c.Assert(err, IsNil)
+
+	data, err := policy.MarshalCBOR()
+	c.Assert(err, IsNil)
+
+	var decoded Policy
+	c.Check(decoded.UnmarshalCBOR(data), IsNil)
+	c.Check(mu.MustMarshalToBytes(&decoded), DeepEquals, b)
+
+	digest, err := decoded.Digest(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *cborSuite) TestUnmarshalOpaqueElementSupportedType(c *C) {
+	// {version: 1, digests: [], elements: [{Opaque: {type: TPM_CC_PolicyAuthValue, data: h''}}]}
+	var policy Policy
+	err := policy.UnmarshalCBOR(internal_testutil.DecodeHexString(c, "a30101038005"+"81"+"a1"+"12"+"a2"+"0119016b"+"0240"))
+	c.Check(err, ErrorMatches, `element 0: opaque element has supported type TPM_CC_PolicyAuthValue`)
+}
+
+func (s *cborSuite) TestUnmarshalUnknownElementTag(c *C) {
+	// {version: 1, digests: [], elements: [{100: {}}]}
+	var policy Policy
+	err := policy.UnmarshalCBOR(internal_testutil.DecodeHexString(c, "a30101038005"+"81"+"a1"+"1864"+"a0"))
+	c.Check(err, ErrorMatches, `element 0: unknown element tag 100`)
+}
+
+func (s *cborSuite) TestUnmarshalUnknownField(c *C) {
+	// {version: 1, digests: [], elements: [{CommandCode: {code: TPM_CC_Unseal, 2: 0}}]}
+	var policy Policy
+	err := policy.UnmarshalCBOR(internal_testutil.DecodeHexString(c, "a30101038005"+"81"+"a1"+"06"+"a2"+"0119015e"+"0200"))
+	c.Check(err, ErrorMatches, `element 0: TPM2_PolicyCommandCode assertion: unknown field 2`)
+}
+
+func (s *cborSuite) TestUnmarshalUnknownTopLevelField(c *C) {
+	// {version: 1, digests: [], elements: [], 6: 0}
+	var policy Policy
+	err := policy.UnmarshalCBOR(internal_testutil.DecodeHexString(c, "a4010103800580"+"0600"))
+	c.Check(err, ErrorMatches, `unknown field 6`)
+}
+
+func (s *cborSuite) TestUnmarshalMissingField(c *C) {
+	// {version: 1, digests: [], elements: [{CommandCode: {}}]}
+	var policy Policy
+	err := policy.UnmarshalCBOR(internal_testutil.DecodeHexString(c, "a30101038005"+"81"+"a1"+"06"+"a0"))
+	c.Check(err, ErrorMatches, `element 0: TPM2_PolicyCommandCode assertion: missing field 1`)
+}
+
+func (s *cborSuite) TestUnmarshalInvalidVersion(c *C) {
+	// {version: 2, digests: [], elements: []}
+	var policy Policy
+	err := policy.UnmarshalCBOR(internal_testutil.DecodeHexString(c, "a3010203800580"))
+	c.Check(err, ErrorMatches, `invalid version`)
+}
+
+func (s *cborSuite) TestUnmarshalNotDeterministic(c *C) {
+	// {version: 1, elements: [], digests: []} with unsorted keys
+	var policy Policy
+	err := policy.UnmarshalCBOR(internal_testutil.DecodeHexString(c, "a3010105800380"))
+	c.Check(err, ErrorMatches, `cannot decode CBOR: map key 3 is duplicated or not sorted`)
+}
+
+func (s *cborSuite) TestUnmarshalInvalidBranchName(c *C) {
+	// {version: 1, digests: [], elements: [{OR: {branches: [{name: "{0}", digests: [], elements: []}, ...]}}]}
+	branch := "a3" + "01" + "637b307d" + "0280" + "0380"
+	var policy Policy
+	err := policy.UnmarshalCBOR(internal_testutil.DecodeHexString(c, "a30101038005"+"81"+"a1"+"0a"+"a1"+"01"+"82"+branch+branch))
+	c.Check(err, ErrorMatches, `(?s)invalid policy: .*invalid name.*`)
+}
+
+func (s *cborSuite) TestUnmarshalErrorDoesNotModify(c *C) {
+	_, policy := s.newPolicy(c, PolicyBuilderCompat{})
+	orig := mu.MustMarshalToBytes(policy)
+
+	c.Check(policy.UnmarshalCBOR(internal_testutil.DecodeHexString(c, "a30101038005"+"81"+"a1"+"1864"+"a0")), NotNil)
+	c.Check(mu.MustMarshalToBytes(policy), DeepEquals, orig)
+}
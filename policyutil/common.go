@@ -0,0 +1,67 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// commonPolicyAlgorithms are the digest algorithms that policies returned from the
+// convenience constructors in this file have digests computed for.
+var commonPolicyAlgorithms = []tpm2.HashAlgorithmId{
+	tpm2.HashAlgorithmSHA1,
+	tpm2.HashAlgorithmSHA256,
+	tpm2.HashAlgorithmSHA384,
+	tpm2.HashAlgorithmSHA512,
+}
+
+// NewUnsealWithAuthValuePolicy returns a policy that requires knowledge of an object's
+// authorization value and that can only be used for TPM2_Unseal. This is equivalent to
+// using [PolicyBuilder] to construct a policy with a TPM2_PolicyAuthValue assertion
+// followed by a TPM2_PolicyCommandCode assertion for TPM2_Unseal.
+//
+// The returned policy has digests for SHA-1, SHA-256, SHA-384 and SHA-512. It is intended
+// as a starting point for the most common sealing use case - applications with more
+// specific requirements should construct their policies with [PolicyBuilder].
+func NewUnsealWithAuthValuePolicy() *Policy {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+
+	policy, err := newCommonPolicy(builder)
+	if err != nil {
+		panic(err)
+	}
+	return policy
+}
+
+// NewUnsealWithPCRPolicy returns a policy that requires the supplied PCR values and that
+// can only be used for TPM2_Unseal. This is equivalent to using [PolicyBuilder] to construct
+// a policy with a TPM2_PolicyPCR assertion for the supplied values followed by a
+// TPM2_PolicyCommandCode assertion for TPM2_Unseal.
+//
+// The returned policy has digests for SHA-1, SHA-256, SHA-384 and SHA-512. It is intended
+// as a starting point for the most common sealing use case - applications with more
+// specific requirements should construct their policies with [PolicyBuilder].
+func NewUnsealWithPCRPolicy(values tpm2.PCRValues) (*Policy, error) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyPCR(values)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+
+	return newCommonPolicy(builder)
+}
+
+func newCommonPolicy(builder *PolicyBuilder) (*Policy, error) {
+	_, policy, err := builder.Policy()
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.EnsureDigests(commonPolicyAlgorithms...); err != nil {
+		return nil, fmt.Errorf("cannot compute digests: %w", err)
+	}
+	return policy, nil
+}
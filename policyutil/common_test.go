@@ -0,0 +1,87 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type commonPoliciesSuite struct{}
+
+var _ = Suite(&commonPoliciesSuite{})
+
+type testCommonPolicyData struct {
+	policy   *Policy
+	build    func(*PolicyBuilderBranch)
+	expected map[tpm2.HashAlgorithmId]tpm2.Digest
+}
+
+func (s *commonPoliciesSuite) testCommonPolicy(c *C, data *testCommonPolicyData) {
+	for alg, expected := range data.expected {
+		digest, err := data.policy.Digest(alg)
+		c.Check(err, IsNil, Commentf("%v", alg))
+		c.Check(digest, DeepEquals, expected, Commentf("%v", alg))
+
+		builder := NewPolicyBuilder(alg)
+		data.build(builder.RootBranch())
+		digest, err = builder.Digest()
+		c.Check(err, IsNil, Commentf("%v", alg))
+		c.Check(digest, DeepEquals, expected, Commentf("%v", alg))
+	}
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	data.build(builder.RootBranch())
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Check(policy.EnsureDigests(tpm2.HashAlgorithmSHA1, tpm2.HashAlgorithmSHA384, tpm2.HashAlgorithmSHA512), IsNil)
+	c.Check(mu.MustMarshalToBytes(data.policy), DeepEquals, mu.MustMarshalToBytes(policy))
+}
+
+func (s *commonPoliciesSuite) TestNewUnsealWithAuthValuePolicy(c *C) {
+	s.testCommonPolicy(c, &testCommonPolicyData{
+		policy: NewUnsealWithAuthValuePolicy(),
+		build: func(b *PolicyBuilderBranch) {
+			b.PolicyAuthValue()
+			b.PolicyCommandCode(tpm2.CommandUnseal)
+		},
+		expected: map[tpm2.HashAlgorithmId]tpm2.Digest{
+			tpm2.HashAlgorithmSHA1:   internal_testutil.DecodeHexString(c, "72b7c212f4f91ae414901ac940b02e11c43f0cec"),
+			tpm2.HashAlgorithmSHA256: internal_testutil.DecodeHexString(c, "3f230bdefd5946f1eab301b1648dd0bb74873710d3f8c6e24e9ccc2bfb51eb48"),
+			tpm2.HashAlgorithmSHA384: internal_testutil.DecodeHexString(c, "4c759b892178d7c3aeb3342ab22f457690ad025c82d179e9107fb33c4c2ff49388969ce3bff8840c3419f3c5a1bb17da"),
+			tpm2.HashAlgorithmSHA512: internal_testutil.DecodeHexString(c, "b54885db44d49bdc35d387e77ae8e6036b2a1d7bb68064789eef213e867a8ab840fe88396149f6dff4d7906a5965ff35187a942ffabd816ceaaf44f7e15692e7"),
+		},
+	})
+}
+
+func (s *commonPoliciesSuite) TestNewUnsealWithPCRPolicy(c *C) {
+	values := tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {7: make(tpm2.Digest, 32)}}
+
+	policy, err := NewUnsealWithPCRPolicy(values)
+	c.Assert(err, IsNil)
+
+	s.testCommonPolicy(c, &testCommonPolicyData{
+		policy: policy,
+		build: func(b *PolicyBuilderBranch) {
+			b.PolicyPCR(values)
+			b.PolicyCommandCode(tpm2.CommandUnseal)
+		},
+		expected: map[tpm2.HashAlgorithmId]tpm2.Digest{
+			tpm2.HashAlgorithmSHA1:   internal_testutil.DecodeHexString(c, "73edcb077e80d86494df7def6ea78e7bbb557ba9"),
+			tpm2.HashAlgorithmSHA256: internal_testutil.DecodeHexString(c, "02cceaa0300ef7a302857f01fc9dcde949dde9e8715f922058df3d3a5bb0a26e"),
+			tpm2.HashAlgorithmSHA384: internal_testutil.DecodeHexString(c, "f0b61276309beac771811024704687c9b224a09ecf50a82b0e9e1c744dcbf9c4b1a826ba6abd9994d4dc76479d74b3f5"),
+			tpm2.HashAlgorithmSHA512: internal_testutil.DecodeHexString(c, "fe8d384da11023e13f927910b9e8267b0267080d50a526fab99310b0306a3bd6a818b97740fa70daa7feac82e0cded15266290e73db75e63632e27b488863ea0"),
+		},
+	})
+}
+
+func (s *commonPoliciesSuite) TestNewUnsealWithPCRPolicyInvalidValues(c *C) {
+	_, err := NewUnsealWithPCRPolicy(tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {7: make(tpm2.Digest, 20)}})
+	c.Check(err, ErrorMatches, `could not build policy: encountered an error when calling PolicyPCR: invalid digest size for PCR 7, algorithm TPM_ALG_SHA256`)
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"github.com/canonical/go-tpm2"
+)
+
+// PolicyBuilderCompat describes deviations from the default way in which policy
+// digests are computed, in order to produce policies that work correctly on TPMs
+// with specific firmware quirks. The zero value computes digests in the way
+// described by the TPM Library and PC Client platform specifications.
+//
+// A PolicyBuilderCompat is supplied to [NewPolicyBuilderWithCompat], and is
+// retained in the resulting [Policy] so that digests subsequently computed by
+// [Policy.AddDigest] and checked by [Policy.Validate] are consistent with the
+// digest computed by the builder.
+type PolicyBuilderCompat struct {
+	// MinPCRSelectSize is the minimum size in bytes of each PCR selection
+	// that is included in the digest of TPM2_PolicyPCR assertions. If this is
+	// zero, a size of 3 bytes is used, which corresponds to the value of
+	// TPM_PT_PCR_SELECT_MIN for PC Client TPM devices. The TPM pads the
+	// selections it receives to its own TPM_PT_PCR_SELECT_MIN before computing
+	// the new session digest, so this must be set to that value for devices
+	// where it differs.
+	MinPCRSelectSize uint8
+}
+
+func (c PolicyBuilderCompat) isZero() bool {
+	return c == PolicyBuilderCompat{}
+}
+
+// PolicyFirmwareQuirk describes a firmware quirk that affects the computation
+// of policy digests for a range of firmware versions from a specific TPM
+// manufacturer.
+type PolicyFirmwareQuirk struct {
+	Manufacturer tpm2.TPMManufacturer // The manufacturer of affected devices
+
+	// MinFirmwareVersion and MaxFirmwareVersion define the inclusive range of
+	// affected firmware versions. The firmware version is the value of
+	// TPM_PT_FIRMWARE_VERSION_1 in the upper 32-bits and the value of
+	// TPM_PT_FIRMWARE_VERSION_2 in the lower 32-bits, as returned by
+	// tpm2.TPMContext.GetCapabilityTPMProperty.
+	MinFirmwareVersion uint64
+	MaxFirmwareVersion uint64
+
+	Description string              // A human readable description of the quirk
+	Compat      PolicyBuilderCompat // The changes required to work on affected devices
+}
+
+func (q *PolicyFirmwareQuirk) matches(manufacturer tpm2.TPMManufacturer, firmwareVersion uint64) bool {
+	return q.Manufacturer == manufacturer && firmwareVersion >= q.MinFirmwareVersion && firmwareVersion <= q.MaxFirmwareVersion
+}
+
+// policyFirmwareQuirks is the registry of known firmware quirks. Entries should
+// only be added along with a test containing a golden digest that has been
+// obtained from an affected device.
+var policyFirmwareQuirks []PolicyFirmwareQuirk
+
+// PolicyFirmwareQuirks returns a copy of the registry of known firmware quirks
+// that affect the computation of policy digests.
+func PolicyFirmwareQuirks() []PolicyFirmwareQuirk {
+	return append([]PolicyFirmwareQuirk(nil), policyFirmwareQuirks...)
+}
+
+// PolicyBuilderCompatForFirmware returns the PolicyBuilderCompat required to
+// produce policies that work correctly on a TPM from the specified manufacturer
+// and with the specified firmware version, by combining all of the matching
+// entries from the registry of known firmware quirks. The firmware version is
+// encoded in the same way as [PolicyFirmwareQuirk.MinFirmwareVersion]. If
+// there are no matching entries, the zero value is returned.
+func PolicyBuilderCompatForFirmware(manufacturer tpm2.TPMManufacturer, firmwareVersion uint64) PolicyBuilderCompat {
+	var compat PolicyBuilderCompat
+	for _, quirk := range policyFirmwareQuirks {
+		if !quirk.matches(manufacturer, firmwareVersion) {
+			continue
+		}
+		if quirk.Compat.MinPCRSelectSize > compat.MinPCRSelectSize {
+			compat.MinPCRSelectSize = quirk.Compat.MinPCRSelectSize
+		}
+	}
+	return compat
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"io"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type compatSuite struct{}
+
+var _ = Suite(&compatSuite{})
+
+func (s *compatSuite) pcrValues() tpm2.PCRValues {
+	h := crypto.SHA256.New()
+	io.WriteString(h, "foo")
+	foo := h.Sum(nil)
+
+	h = crypto.SHA256.New()
+	io.WriteString(h, "bar")
+	bar := h.Sum(nil)
+
+	return tpm2.PCRValues{
+		tpm2.HashAlgorithmSHA256: {
+			4: foo,
+			7: bar}}
+}
+
+func (s *compatSuite) TestDefaultIsUnchanged(c *C) {
+	builder := NewPolicyBuilderWithCompat(tpm2.HashAlgorithmSHA256, PolicyBuilderCompat{})
+	digest, err := builder.RootBranch().PolicyPCR(s.pcrValues())
+	c.Check(err, IsNil)
+	// This is the same digest as builderSuite.TestPolicyPCR.
+	c.Check(digest, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "5dedc710ee0e797130756bd024372dfa9a9e3fc5b5c60897304fdda88ec2b887")))
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Check(policy.Compat(), Equals, PolicyBuilderCompat{})
+
+	// Policies without compatibility options retain the original format.
+	b, err := mu.MarshalToBytes(policy)
+	c.Check(err, IsNil)
+	c.Check(b[:4], DeepEquals, []byte{0, 0, 0, 0})
+}
+
+func (s *compatSuite) TestMinPCRSelectSize(c *C) {
+	builder := NewPolicyBuilderWithCompat(tpm2.HashAlgorithmSHA256, PolicyBuilderCompat{MinPCRSelectSize: 4})
+	digest, err := builder.RootBranch().PolicyPCR(s.pcrValues())
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "f5c4c4958488a19470299c03515e70eb72715ed71dd6951895985bee04fe06fa")))
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Check(policy.Compat(), Equals, PolicyBuilderCompat{MinPCRSelectSize: 4})
+
+	validated, err := policy.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(validated, DeepEquals, digest)
+
+	sha1Digest, err := policy.AddDigest(tpm2.HashAlgorithmSHA1)
+	c.Check(err, IsNil)
+	c.Check(sha1Digest, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "b23eb270f62b46292309cf4dfde9280446d4ca69")))
+}
+
+func (s *compatSuite) TestMinPCRSelectSizeInBranches(c *C) {
+	build := func(builder *PolicyBuilder) (tpm2.Digest, *Policy) {
+		node := builder.RootBranch().AddBranchNode()
+		node.AddBranch("pcr").PolicyPCR(s.pcrValues())
+		node.AddBranch("auth").PolicyAuthValue()
+		digest, policy, err := builder.Policy()
+		c.Assert(err, IsNil)
+		return digest, policy
+	}
+
+	digest, policy := build(NewPolicyBuilderWithCompat(tpm2.HashAlgorithmSHA256, PolicyBuilderCompat{MinPCRSelectSize: 4}))
+	defaultDigest, _ := build(NewPolicyBuilder(tpm2.HashAlgorithmSHA256))
+	c.Check(digest, Not(DeepEquals), defaultDigest)
+
+	validated, err := policy.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(validated, DeepEquals, digest)
+}
+
+func (s *compatSuite) TestSerialization(c *C) {
+	builder := NewPolicyBuilderWithCompat(tpm2.HashAlgorithmSHA256, PolicyBuilderCompat{MinPCRSelectSize: 4})
+	builder.RootBranch().PolicyPCR(s.pcrValues())
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	b, err := mu.MarshalToBytes(policy)
+	c.Check(err, IsNil)
+	c.Check(b[:5], DeepEquals, []byte{0, 0, 0, 2, 4})
+
+	var recovered *Policy
+	_, err = mu.UnmarshalFromBytes(b, &recovered)
+	c.Assert(err, IsNil)
+	c.Check(recovered.Compat(), Equals, PolicyBuilderCompat{MinPCRSelectSize: 4})
+
+	// Make sure that digests computed from the recovered policy are consistent.
+	_, err = recovered.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+}
+
+func (s *compatSuite) TestSerializationWithDetachedDigests(c *C) {
+	builder := NewPolicyBuilderWithCompat(tpm2.HashAlgorithmSHA256, PolicyBuilderCompat{MinPCRSelectSize: 4})
+	builder.RootBranch().PolicyPCR(s.pcrValues())
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	w := new(bytes.Buffer)
+	digests, err := policy.MarshalWithDetachedDigests(w)
+	c.Assert(err, IsNil)
+
+	recovered, err := UnmarshalPolicyWithDetachedDigests(w, digests)
+	c.Assert(err, IsNil)
+	c.Check(recovered.Compat(), Equals, PolicyBuilderCompat{MinPCRSelectSize: 4})
+
+	_, err = recovered.Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+}
+
+func (s *compatSuite) TestPolicyBuilderCompatForFirmwareNoQuirks(c *C) {
+	restore := MockPolicyFirmwareQuirks(nil)
+	defer restore()
+
+	c.Check(PolicyBuilderCompatForFirmware(tpm2.TPMManufacturerIFX, 0x0007005500000000), Equals, PolicyBuilderCompat{})
+}
+
+func (s *compatSuite) TestPolicyBuilderCompatForFirmware(c *C) {
+	restore := MockPolicyFirmwareQuirks([]PolicyFirmwareQuirk{
+		{
+			Manufacturer:       tpm2.TPMManufacturerIFX,
+			MinFirmwareVersion: 0x0007000000000000,
+			MaxFirmwareVersion: 0x0007ffffffffffff,
+			Compat:             PolicyBuilderCompat{MinPCRSelectSize: 4},
+		},
+		{
+			Manufacturer:       tpm2.TPMManufacturerIFX,
+			MinFirmwareVersion: 0x0007005500000000,
+			MaxFirmwareVersion: 0x0007005500000000,
+			Compat:             PolicyBuilderCompat{MinPCRSelectSize: 5},
+		},
+	})
+	defer restore()
+
+	c.Check(PolicyBuilderCompatForFirmware(tpm2.TPMManufacturerIFX, 0x0007003f00000000), Equals, PolicyBuilderCompat{MinPCRSelectSize: 4})
+	c.Check(PolicyBuilderCompatForFirmware(tpm2.TPMManufacturerIFX, 0x0007005500000000), Equals, PolicyBuilderCompat{MinPCRSelectSize: 5})
+	c.Check(PolicyBuilderCompatForFirmware(tpm2.TPMManufacturerIFX, 0x0006005500000000), Equals, PolicyBuilderCompat{})
+	c.Check(PolicyBuilderCompatForFirmware(tpm2.TPMManufacturerNTC, 0x0007003f00000000), Equals, PolicyBuilderCompat{})
+
+	c.Check(PolicyFirmwareQuirks(), HasLen, 2)
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+type policyCompatibilityPCR struct {
+	alg tpm2.HashAlgorithmId
+	pcr int
+}
+
+// policyCompatibilityCommands maps the type of each policy element to the TPM commands that
+// may be used to execute it, where this is not just the command with the same code.
+var policyCompatibilityCommands = map[tpm2.CommandCode][]tpm2.CommandCode{
+	// TPM2_PolicyNV and TPM2_PolicySecret assertions may start a session to authorize
+	// the NV index or auth object.
+	tpm2.CommandPolicyNV:     {tpm2.CommandPolicyNV, tpm2.CommandStartAuthSession},
+	tpm2.CommandPolicySecret: {tpm2.CommandPolicySecret, tpm2.CommandStartAuthSession},
+
+	// The auth key for a TPM2_PolicySigned assertion is loaded with TPM2_LoadExternal.
+	tpm2.CommandPolicySigned: {tpm2.CommandPolicySigned, tpm2.CommandLoadExternal},
+
+	// The signature of an authorized policy is verified with TPM2_VerifySignature
+	// after loading the key with TPM2_LoadExternal.
+	tpm2.CommandPolicyAuthorize: {tpm2.CommandPolicyAuthorize, tpm2.CommandLoadExternal, tpm2.CommandVerifySignature},
+
+	// TPM2_PolicyPassword assertions are executed with TPM2_PolicyAuthValue if the
+	// session is used for parameter encryption.
+	tpm2.CommandPolicyPassword: {tpm2.CommandPolicyPassword, tpm2.CommandPolicyAuthValue},
+
+	// Branch nodes and raw TPM2_PolicyOR assertions are both executed with
+	// TPM2_PolicyOR.
+	tpm2.CommandPolicyOR: {tpm2.CommandPolicyOR},
+	commandRawPolicyOR:   {tpm2.CommandPolicyOR},
+}
+
+// policyCompatibilityChecker collects the TPM features that are required to execute a
+// policy.
+type policyCompatibilityChecker struct {
+	commands []tpm2.CommandCode
+	hashAlgs []tpm2.HashAlgorithmId
+	pcrs     []policyCompatibilityPCR
+}
+
+func (c *policyCompatibilityChecker) addCommand(code tpm2.CommandCode) {
+	for _, existing := range c.commands {
+		if existing == code {
+			return
+		}
+	}
+	c.commands = append(c.commands, code)
+}
+
+func (c *policyCompatibilityChecker) addHashAlg(alg tpm2.HashAlgorithmId) {
+	for _, existing := range c.hashAlgs {
+		if existing == alg {
+			return
+		}
+	}
+	c.hashAlgs = append(c.hashAlgs, alg)
+}
+
+func (c *policyCompatibilityChecker) addPCR(alg tpm2.HashAlgorithmId, pcr int) {
+	for _, existing := range c.pcrs {
+		if existing.alg == alg && existing.pcr == pcr {
+			return
+		}
+	}
+	c.pcrs = append(c.pcrs, policyCompatibilityPCR{alg: alg, pcr: pcr})
+}
+
+func (c *policyCompatibilityChecker) addDigests(digests taggedHashList) {
+	for _, digest := range digests {
+		c.addHashAlg(digest.HashAlg)
+	}
+}
+
+func (c *policyCompatibilityChecker) addElements(elements policyElements) {
+	for _, element := range elements {
+		commands, ok := policyCompatibilityCommands[element.Type]
+		if !ok {
+			commands = []tpm2.CommandCode{element.Type}
+		}
+		for _, code := range commands {
+			c.addCommand(code)
+		}
+
+		switch element.Type {
+		case tpm2.CommandPolicyOR:
+			for _, branch := range element.Details.OR.Branches {
+				c.addDigests(branch.PolicyDigests)
+				c.addElements(branch.Policy)
+			}
+		case tpm2.CommandPolicyPCR:
+			for _, value := range element.Details.PCR.PCRs {
+				c.addHashAlg(value.Digest.HashAlg)
+				c.addPCR(value.Digest.HashAlg, int(value.PCR))
+			}
+		}
+	}
+}
+
+func (c *policyCompatibilityChecker) check(tpm *tpm2.TPMContext) ([]string, error) {
+	commands, err := tpm.GetCapabilityCommands(tpm2.CommandFirst, tpm2.CapabilityMaxProperties)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain supported commands: %w", err)
+	}
+	supportedCommands := make(map[tpm2.CommandCode]bool)
+	for _, attrs := range commands {
+		supportedCommands[attrs.CommandCode()] = true
+	}
+
+	algs, err := tpm.GetCapabilityAlgs(tpm2.AlgorithmFirst, tpm2.CapabilityMaxProperties)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain supported algorithms: %w", err)
+	}
+	supportedAlgs := make(map[tpm2.AlgorithmId]bool)
+	for _, prop := range algs {
+		supportedAlgs[prop.Alg] = true
+	}
+
+	var pcrs tpm2.PCRSelectionList
+	if len(c.pcrs) > 0 {
+		pcrs, err = tpm.GetCapabilityPCRs()
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain PCR allocation: %w", err)
+		}
+	}
+
+	incompatibilities := []string{}
+
+	for _, code := range c.commands {
+		if !supportedCommands[code] {
+			incompatibilities = append(incompatibilities, fmt.Sprintf("unsupported command %v", code))
+		}
+	}
+	for _, alg := range c.hashAlgs {
+		if !supportedAlgs[tpm2.AlgorithmId(alg)] {
+			incompatibilities = append(incompatibilities, fmt.Sprintf("unsupported digest algorithm %v", alg))
+		}
+	}
+
+	reportedBanks := make(map[tpm2.HashAlgorithmId]bool)
+	for _, pcr := range c.pcrs {
+		var bank *tpm2.PCRSelection
+		for i := range pcrs {
+			if pcrs[i].Hash == pcr.alg {
+				bank = &pcrs[i]
+				break
+			}
+		}
+		if bank == nil {
+			if !reportedBanks[pcr.alg] {
+				incompatibilities = append(incompatibilities, fmt.Sprintf("PCR bank %v is not allocated", pcr.alg))
+				reportedBanks[pcr.alg] = true
+			}
+			continue
+		}
+
+		found := false
+		for _, allocated := range bank.Select {
+			if allocated == pcr.pcr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			incompatibilities = append(incompatibilities, fmt.Sprintf("PCR %d is not allocated in PCR bank %v", pcr.pcr, pcr.alg))
+		}
+	}
+
+	return incompatibilities, nil
+}
+
+// CheckCompatibility determines whether the supplied TPM supports every policy command
+// that this policy uses, every digest algorithm that this policy has digests for, and
+// every PCR that this policy has TPM2_PolicyPCR assertions for. It returns a list of
+// incompatibilities, which will be empty if the policy is fully supported. Branch nodes
+// are executed with TPM2_PolicyOR assertions. Some assertions require other commands in
+// order to be executed - TPM2_PolicyNV and TPM2_PolicySecret require TPM2_StartAuthSession,
+// TPM2_PolicySigned requires TPM2_LoadExternal, TPM2_PolicyAuthorize requires
+// TPM2_LoadExternal and TPM2_VerifySignature, and TPM2_PolicyPassword requires
+// TPM2_PolicyAuthValue.
+//
+// This only queries the TPM's capabilities and doesn't modify any TPM state. It doesn't
+// check any authorized policies, or any resources that are required to execute this
+// policy.
+func (p *Policy) CheckCompatibility(tpm *tpm2.TPMContext) ([]string, error) {
+	var checker policyCompatibilityChecker
+	checker.addDigests(p.policy.PolicyDigests)
+	checker.addElements(p.policy.Policy)
+	return checker.check(tpm)
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type compatibilitySuiteNoTPM struct{}
+
+var _ = Suite(&compatibilitySuiteNoTPM{})
+
+func (s *compatibilitySuiteNoTPM) TestRequirementsMapElementsToCommands(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVWritten),
+		Size:    8}
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyNvWritten(true)
+	node := builder.RootBranch().AddBranchNode()
+
+	b1 := node.AddBranch("")
+	b1.PolicyAuthValue()
+	b1.PolicyCommandCode(tpm2.CommandNVChangeAuth)
+
+	b2 := node.AddBranch("")
+	b2.PolicyNVEquals(nvPub, []byte{0, 0, 0, 0, 0, 0, 0, 1}, 0)
+	b2.PolicyPCR(tpm2.PCRValues{tpm2.HashAlgorithmSHA1: {7: make([]byte, 20)}})
+
+	builder.RootBranch().PolicyOR(make(tpm2.Digest, 32), make(tpm2.Digest, 32))
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	commands, hashAlgs := PolicyCompatibilityRequirements(policy)
+	c.Check(commands, DeepEquals, []tpm2.CommandCode{
+		tpm2.CommandPolicyNvWritten,
+		tpm2.CommandPolicyOR,
+		tpm2.CommandPolicyAuthValue,
+		tpm2.CommandPolicyCommandCode,
+		tpm2.CommandPolicyNV,
+		tpm2.CommandStartAuthSession,
+		tpm2.CommandPolicyPCR,
+	})
+	c.Check(hashAlgs, DeepEquals, []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1})
+}
+
+func (s *compatibilitySuiteNoTPM) TestRequirementsMapEachElementType(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181f000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVWritten),
+		Size:    8}
+	key := objectutil.NewRSAStorageKeyTemplate()
+	key.Unique = &tpm2.PublicIDU{RSA: make(tpm2.PublicKeyRSA, 256)}
+
+	for _, data := range []struct {
+		desc     string
+		build    func(*PolicyBuilderBranch)
+		expected []tpm2.CommandCode
+	}{
+		{"PolicyNV", func(b *PolicyBuilderBranch) { b.PolicyNVEquals(nvPub, []byte{0}, 0) }, []tpm2.CommandCode{tpm2.CommandPolicyNV, tpm2.CommandStartAuthSession}},
+		{"PolicySecret", func(b *PolicyBuilderBranch) { b.PolicySecret(key, nil) }, []tpm2.CommandCode{tpm2.CommandPolicySecret, tpm2.CommandStartAuthSession}},
+		{"PolicySigned", func(b *PolicyBuilderBranch) { b.PolicySigned(key, nil) }, []tpm2.CommandCode{tpm2.CommandPolicySigned, tpm2.CommandLoadExternal}},
+		{"PolicyAuthorize", func(b *PolicyBuilderBranch) { b.PolicyAuthorize(nil, key) }, []tpm2.CommandCode{tpm2.CommandPolicyAuthorize, tpm2.CommandLoadExternal, tpm2.CommandVerifySignature}},
+		{"PolicyAuthValue", func(b *PolicyBuilderBranch) { b.PolicyAuthValue() }, []tpm2.CommandCode{tpm2.CommandPolicyAuthValue}},
+		{"PolicyCommandCode", func(b *PolicyBuilderBranch) { b.PolicyCommandCode(tpm2.CommandUnseal) }, []tpm2.CommandCode{tpm2.CommandPolicyCommandCode}},
+		{"PolicyCounterTimer", func(b *PolicyBuilderBranch) { b.PolicyCounterTimer([]byte{0}, 0, tpm2.OpEq) }, []tpm2.CommandCode{tpm2.CommandPolicyCounterTimer}},
+		{"PolicyCpHash", func(b *PolicyBuilderBranch) { b.PolicyCpHash(tpm2.CommandUnseal, []Named{key}) }, []tpm2.CommandCode{tpm2.CommandPolicyCpHash}},
+		{"PolicyNameHash", func(b *PolicyBuilderBranch) { b.PolicyNameHash(key) }, []tpm2.CommandCode{tpm2.CommandPolicyNameHash}},
+		{"PolicyPCR", func(b *PolicyBuilderBranch) {
+			b.PolicyPCR(tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {7: make([]byte, 32)}})
+		}, []tpm2.CommandCode{tpm2.CommandPolicyPCR}},
+		{"PolicyDuplicationSelect", func(b *PolicyBuilderBranch) { b.PolicyDuplicationSelect(key, key, true) }, []tpm2.CommandCode{tpm2.CommandPolicyDuplicationSelect}},
+		{"PolicyPassword", func(b *PolicyBuilderBranch) { b.PolicyPassword() }, []tpm2.CommandCode{tpm2.CommandPolicyPassword, tpm2.CommandPolicyAuthValue}},
+		{"PolicyPhysicalPresence", func(b *PolicyBuilderBranch) { b.PolicyPhysicalPresence() }, []tpm2.CommandCode{tpm2.CommandPolicyPhysicalPresence}},
+		{"PolicyNvWritten", func(b *PolicyBuilderBranch) { b.PolicyNvWritten(true) }, []tpm2.CommandCode{tpm2.CommandPolicyNvWritten}},
+		{"PolicyParameters", func(b *PolicyBuilderBranch) { b.PolicyParameters(tpm2.CommandUnseal) }, []tpm2.CommandCode{tpm2.CommandPolicyParameters}},
+		{"PolicyOR", func(b *PolicyBuilderBranch) { b.PolicyOR(make(tpm2.Digest, 32), make(tpm2.Digest, 32)) }, []tpm2.CommandCode{tpm2.CommandPolicyOR}},
+		{"BranchNode", func(b *PolicyBuilderBranch) {
+			node := b.AddBranchNode()
+			node.AddBranch("").PolicyAuthValue()
+			node.AddBranch("").PolicyPhysicalPresence()
+		}, []tpm2.CommandCode{tpm2.CommandPolicyOR, tpm2.CommandPolicyAuthValue, tpm2.CommandPolicyPhysicalPresence}},
+	} {
+		builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+		data.build(builder.RootBranch())
+		_, policy, err := builder.Policy()
+		c.Assert(err, IsNil, Commentf(data.desc))
+
+		commands, _ := PolicyCompatibilityRequirements(policy)
+		c.Check(commands, DeepEquals, data.expected, Commentf(data.desc))
+	}
+}
+
+type compatibilitySuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&compatibilitySuite{})
+
+func (s *compatibilitySuite) checkReadOnly(c *C) {
+	for _, cmd := range s.CommandLog() {
+		c.Check(cmd.GetCommandCode(c), Equals, tpm2.CommandGetCapability)
+	}
+}
+
+func (s *compatibilitySuite) TestCheckCompatibilitySupported(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	node := builder.RootBranch().AddBranchNode()
+
+	b1 := node.AddBranch("")
+	b1.PolicyCommandCode(tpm2.CommandUnseal)
+
+	b2 := node.AddBranch("")
+	b2.PolicyPCR(tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {7: make([]byte, 32)}})
+	b2.PolicySigned(objectutil.NewRSAStorageKeyTemplate(), nil)
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	s.ForgetCommands()
+
+	incompatibilities, err := policy.CheckCompatibility(s.TPM)
+	c.Check(err, IsNil)
+	c.Check(incompatibilities, DeepEquals, []string{})
+
+	s.checkReadOnly(c)
+}
+
+func (s *compatibilitySuite) TestCheckCompatibilityUnallocatedPCR(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyPCR(tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {30: make([]byte, 32)}})
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	s.ForgetCommands()
+
+	incompatibilities, err := policy.CheckCompatibility(s.TPM)
+	c.Check(err, IsNil)
+	c.Check(incompatibilities, DeepEquals, []string{"PCR 30 is not allocated in PCR bank TPM_ALG_SHA256"})
+
+	s.checkReadOnly(c)
+}
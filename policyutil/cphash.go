@@ -54,3 +54,19 @@ func ComputeCpHash(alg tpm2.HashAlgorithmId, command tpm2.CommandCode, handles [
 	}
 	return computeCpHash(alg, command, handleNames, cpBytes)
 }
+
+// ComputeParametersHash computes a command parameter digest from the specified command code and
+// parameters using the specified digest algorithm. Unlike [ComputeCpHash], this does not include
+// the names of the command handles.
+//
+// The required parameters is defined in part 3 of the TPM 2.0 Library Specification for the
+// specific command.
+//
+// The result of this is useful for the [tpm2.TPMContext.PolicyParameters] command.
+func ComputeParametersHash(alg tpm2.HashAlgorithmId, command tpm2.CommandCode, params ...interface{}) (tpm2.Digest, error) {
+	cpBytes, err := mu.MarshalToBytes(params...)
+	if err != nil {
+		return nil, err
+	}
+	return computeCpHash(alg, command, nil, cpBytes)
+}
@@ -44,3 +44,21 @@ func (s *cpHashSuite) TestComputeCpHashSHA1(c *C) {
 	c.Check(err, IsNil)
 	c.Check(cpHashA, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "d98ba8350f71c34132f62f50a6b9f21c4fa54f75")))
 }
+
+func (s *cpHashSuite) TestComputeParametersHash(c *C) {
+	pHash, err := ComputeParametersHash(tpm2.HashAlgorithmSHA256, tpm2.CommandNVWrite, tpm2.MaxNVBuffer{1, 2, 3, 4}, uint16(0))
+	c.Check(err, IsNil)
+	c.Check(pHash, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "67099da5ae37734378cc8d61368bae3fb99a19d69e59f79dc10f254ea357a901")))
+}
+
+func (s *cpHashSuite) TestComputeParametersHashDifferentParams(c *C) {
+	pHash, err := ComputeParametersHash(tpm2.HashAlgorithmSHA256, tpm2.CommandNVWrite, tpm2.MaxNVBuffer{1, 2, 3, 4}, uint16(10))
+	c.Check(err, IsNil)
+	c.Check(pHash, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "a4ca064a71716fdd4c02772c546bde248ba0171f8dd29f0538c650dc063fe82f")))
+}
+
+func (s *cpHashSuite) TestComputeParametersHashSHA1(c *C) {
+	pHash, err := ComputeParametersHash(tpm2.HashAlgorithmSHA1, tpm2.CommandNVWrite, tpm2.MaxNVBuffer{1, 2, 3, 4}, uint16(0))
+	c.Check(err, IsNil)
+	c.Check(pHash, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "9a4bf699246465a37d499e6a8036f17409c6140c")))
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+const (
+	policyDetachedDigestsVersion       uint32 = 1
+	policyDetachedDigestsCompatVersion uint32 = 3 // includes PolicyBuilderCompat
+)
+
+// policyDigestRefs contains the IDs of the detached digests for a single list of
+// policy digests.
+type policyDigestRefs []uint32
+
+// forEachPolicyDigestList calls the supplied function for every list of policy
+// digests in the supplied policy, which includes the digests for the policy
+// itself and the digests for every branch. The lists are visited in a stable
+// depth-first order which depends only on the structure of the policy.
+func forEachPolicyDigestList(policy *policy, fn func(digests *taggedHashList) error) error {
+	if err := fn(&policy.PolicyDigests); err != nil {
+		return err
+	}
+	return forEachElementsPolicyDigestList(policy.Policy, fn)
+}
+
+func forEachElementsPolicyDigestList(elements policyElements, fn func(digests *taggedHashList) error) error {
+	for _, element := range elements {
+		if element.Type != tpm2.CommandPolicyOR {
+			continue
+		}
+		for _, branch := range element.Details.OR.Branches {
+			if err := fn(&branch.PolicyDigests); err != nil {
+				return err
+			}
+			if err := forEachElementsPolicyDigestList(branch.Policy, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalWithDetachedDigests serializes this policy to the supplied writer with the
+// policy digests for the policy and each of its branches detached from the policy
+// structure. Each digest in the serialized structure is replaced with a reference to an
+// entry in the returned list of digests, which the caller is responsible for storing
+// separately. The serialized policy can be reassembled with
+// [UnmarshalPolicyWithDetachedDigests].
+//
+// Digests are deduplicated, so a digest that appears more than once in the policy,
+// such as when the same branch appears in more than one place, only appears once
+// in the returned list. Digests are assigned IDs in the order in which they are first
+// encountered in a depth-first traversal of the policy, so the returned list is stable
+// for a given policy.
+func (p *Policy) MarshalWithDetachedDigests(w io.Writer) (tpm2.TaggedHashList, error) {
+	var policy *policy
+	if err := mu.CopyValue(&policy, p.policy); err != nil {
+		return nil, fmt.Errorf("cannot make temporary copy of policy: %w", err)
+	}
+
+	var digests tpm2.TaggedHashList
+	ids := make(map[string]uint32)
+	var refs []policyDigestRefs
+
+	if err := forEachPolicyDigestList(policy, func(list *taggedHashList) error {
+		var r policyDigestRefs
+		for _, digest := range *list {
+			key := string(mu.MustMarshalToBytes(digest.HashAlg, digest.Digest))
+			id, exists := ids[key]
+			if !exists {
+				id = uint32(len(digests))
+				ids[key] = id
+				digests = append(digests, tpm2.MakeTaggedHash(digest.HashAlg, digest.Digest))
+			}
+			r = append(r, id)
+		}
+		refs = append(refs, r)
+		*list = nil
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if p.compat.isZero() {
+		if _, err := mu.MarshalToWriter(w, policyDetachedDigestsVersion, policy, refs); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := mu.MarshalToWriter(w, policyDetachedDigestsCompatVersion, p.compat, policy, refs); err != nil {
+			return nil, err
+		}
+	}
+
+	return digests, nil
+}
+
+// UnmarshalPolicyWithDetachedDigests deserializes a policy from the supplied reader that
+// was serialized with [Policy.MarshalWithDetachedDigests], and reassembles it using the
+// supplied list of digests. An error will be returned if the serialized policy references
+// a digest that isn't present in the supplied list.
+func UnmarshalPolicyWithDetachedDigests(r io.Reader, digests tpm2.TaggedHashList) (*Policy, error) {
+	var version uint32
+	if _, err := mu.UnmarshalFromReader(r, &version); err != nil {
+		return nil, err
+	}
+	var compat PolicyBuilderCompat
+	switch version {
+	case policyDetachedDigestsVersion:
+	case policyDetachedDigestsCompatVersion:
+		if _, err := mu.UnmarshalFromReader(r, &compat); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("invalid version")
+	}
+
+	var policy policy
+	var refs []policyDigestRefs
+	if _, err := mu.UnmarshalFromReader(r, &policy, &refs); err != nil {
+		return nil, err
+	}
+
+	n := 0
+	if err := forEachPolicyDigestList(&policy, func(list *taggedHashList) error {
+		if n >= len(refs) {
+			return errors.New("too few digest references")
+		}
+		if len(*list) > 0 {
+			return errors.New("unexpected inline digests")
+		}
+		for _, id := range refs[n] {
+			if int64(id) >= int64(len(digests)) {
+				return fmt.Errorf("no digest with ID %d", id)
+			}
+			digest := digests[id]
+			if !digest.HashAlg.IsValid() {
+				return fmt.Errorf("invalid digest algorithm for digest with ID %d", id)
+			}
+			*list = append(*list, taggedHash{HashAlg: digest.HashAlg, Digest: digest.Digest()})
+		}
+		n++
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("cannot resolve detached digests: %w", err)
+	}
+	if n != len(refs) {
+		return nil, errors.New("cannot resolve detached digests: too many digest references")
+	}
+
+	return &Policy{policy: policy, compat: compat}, nil
+}
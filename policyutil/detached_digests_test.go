@@ -0,0 +1,135 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type detachedDigestsSuite struct{}
+
+var _ = Suite(&detachedDigestsSuite{})
+
+func (s *detachedDigestsSuite) newPolicy(c *C) *Policy {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyNvWritten(true)
+
+	node := builder.RootBranch().AddBranchNode()
+	b1 := node.AddBranch("branch1")
+	b1.PolicyAuthValue()
+	b2 := node.AddBranch("branch2")
+	b2.PolicySecret(tpm2.MakeHandleName(tpm2.HandleOwner), []byte("foo"))
+	b3 := node.AddBranch("branch3")
+	b3.PolicyAuthValue()
+
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandNVChangeAuth)
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	_, err = policy.AddDigest(tpm2.HashAlgorithmSHA1)
+	c.Assert(err, IsNil)
+	return policy
+}
+
+func (s *detachedDigestsSuite) TestRoundTrip(c *C) {
+	policy := s.newPolicy(c)
+
+	w := new(bytes.Buffer)
+	digests, err := policy.MarshalWithDetachedDigests(w)
+	c.Assert(err, IsNil)
+
+	recovered, err := UnmarshalPolicyWithDetachedDigests(w, digests)
+	c.Assert(err, IsNil)
+	c.Check(mu.MustMarshalToBytes(recovered), DeepEquals, mu.MustMarshalToBytes(policy))
+
+	for _, alg := range []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA1, tpm2.HashAlgorithmSHA256} {
+		expected, err := policy.Digest(alg)
+		c.Check(err, IsNil)
+		digest, err := recovered.Digest(alg)
+		c.Check(err, IsNil)
+		c.Check(digest, DeepEquals, expected)
+
+		digest, err = recovered.AddDigest(alg)
+		c.Check(err, IsNil)
+		c.Check(digest, DeepEquals, expected)
+	}
+}
+
+func (s *detachedDigestsSuite) TestDeduplication(c *C) {
+	policy := s.newPolicy(c)
+
+	digests, err := policy.MarshalWithDetachedDigests(new(bytes.Buffer))
+	c.Assert(err, IsNil)
+
+	// There are 2 digests for the root and 2 digests for each of the 3 branches,
+	// but branch1 and branch3 share the same digests.
+	c.Check(digests, internal_testutil.LenEquals, 6)
+
+	expectedSHA256, err := policy.Digest(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	expectedSHA1, err := policy.Digest(tpm2.HashAlgorithmSHA1)
+	c.Check(err, IsNil)
+	c.Check(digests[0], DeepEquals, tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA256, expectedSHA256))
+	c.Check(digests[1], DeepEquals, tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA1, expectedSHA1))
+
+	seen := make(map[string]bool)
+	for _, digest := range digests {
+		key := string(mu.MustMarshalToBytes(digest))
+		c.Check(seen[key], internal_testutil.IsFalse)
+		seen[key] = true
+	}
+}
+
+func (s *detachedDigestsSuite) TestStable(c *C) {
+	policy := s.newPolicy(c)
+
+	w1 := new(bytes.Buffer)
+	digests1, err := policy.MarshalWithDetachedDigests(w1)
+	c.Assert(err, IsNil)
+
+	w2 := new(bytes.Buffer)
+	digests2, err := policy.MarshalWithDetachedDigests(w2)
+	c.Assert(err, IsNil)
+
+	c.Check(w1.Bytes(), DeepEquals, w2.Bytes())
+	c.Check(digests1, DeepEquals, digests2)
+}
+
+func (s *detachedDigestsSuite) TestUnmarshalMissingDigest(c *C) {
+	policy := s.newPolicy(c)
+
+	w := new(bytes.Buffer)
+	digests, err := policy.MarshalWithDetachedDigests(w)
+	c.Assert(err, IsNil)
+
+	_, err = UnmarshalPolicyWithDetachedDigests(w, digests[:5])
+	c.Check(err, ErrorMatches, `cannot resolve detached digests: no digest with ID 5`)
+}
+
+func (s *detachedDigestsSuite) TestUnmarshalNormalPolicy(c *C) {
+	policy := s.newPolicy(c)
+
+	_, err := UnmarshalPolicyWithDetachedDigests(bytes.NewReader(mu.MustMarshalToBytes(policy)), nil)
+	c.Check(err, ErrorMatches, `invalid version`)
+}
+
+func (s *detachedDigestsSuite) TestUnmarshalDetachedAsNormalPolicy(c *C) {
+	policy := s.newPolicy(c)
+
+	w := new(bytes.Buffer)
+	_, err := policy.MarshalWithDetachedDigests(w)
+	c.Assert(err, IsNil)
+
+	var recovered *Policy
+	_, err = mu.UnmarshalFromBytes(w.Bytes(), &recovered)
+	c.Check(err, ErrorMatches, `cannot unmarshal argument 0 whilst processing element of type policyutil.Policy: invalid version`)
+}
@@ -11,6 +11,7 @@ var (
 	NewComputePolicySession = newComputePolicySession
 )
 
+type ComputePolicySession = computePolicySession
 type PcrValue = pcrValue
 type PcrValueList = pcrValueList
 type PolicyBranchName = policyBranchName
@@ -149,6 +150,12 @@ func NewMockPolicyPasswordElement() *policyElement {
 		Details: &policyElementDetails{Password: new(policyPasswordElement)}}
 }
 
+func NewMockPolicyPhysicalPresenceElement() *policyElement {
+	return &policyElement{
+		Type:    tpm2.CommandPolicyPhysicalPresence,
+		Details: &policyElementDetails{PhysicalPresence: new(policyPhysicalPresenceElement)}}
+}
+
 func NewMockPolicyNvWrittenElement(writtenSet bool) *policyElement {
 	return &policyElement{
 		Type: tpm2.CommandPolicyNvWritten,
@@ -156,6 +163,13 @@ func NewMockPolicyNvWrittenElement(writtenSet bool) *policyElement {
 			NvWritten: &policyNvWrittenElement{WrittenSet: writtenSet}}}
 }
 
+func NewMockPolicyParametersElement(digest tpm2.Digest) *policyElement {
+	return &policyElement{
+		Type: tpm2.CommandPolicyParameters,
+		Details: &policyElementDetails{
+			Parameters: &policyParametersElement{Digest: digest}}}
+}
+
 func NewMockPolicyRawORElement(pHashList tpm2.DigestList) *policyElement {
 	return &policyElement{
 		Type: commandRawPolicyOR,
@@ -172,3 +186,30 @@ func NewMockPolicy(digests taggedHashList, authorizations []PolicyAuthorization,
 		},
 	}
 }
+
+func PolicyCompatibilityRequirements(p *Policy) (commands []tpm2.CommandCode, hashAlgs []tpm2.HashAlgorithmId) {
+	var checker policyCompatibilityChecker
+	checker.addDigests(p.policy.PolicyDigests)
+	checker.addElements(p.policy.Policy)
+	return checker.commands, checker.hashAlgs
+}
+
+func MockPolicyFirmwareQuirks(quirks []PolicyFirmwareQuirk) (restore func()) {
+	orig := policyFirmwareQuirks
+	policyFirmwareQuirks = quirks
+	return func() {
+		policyFirmwareQuirks = orig
+	}
+}
+
+func MockRefreshingSignedAuthorizationClock(a *RefreshingSignedAuthorization, fn func() (*tpm2.TimeInfo, error)) {
+	a.readClock = fn
+}
+
+func (p *Policy) RequiredResources(alg tpm2.HashAlgorithmId, path string) ([]tpm2.Name, error) {
+	return p.requiredResources(alg, path)
+}
+
+func NewPreparedPolicyResources(resources PolicyResources, auths SignedAuthorizations) PolicyResources {
+	return &preparedPolicyResources{PolicyResources: resources, auths: auths}
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// PersistentObjectInfo contains details about a persistent object, as returned from
+// [InventoryPersistent].
+type PersistentObjectInfo struct {
+	Handle tpm2.Handle
+	Name   tpm2.Name
+	Public *tpm2.Public
+
+	// Policy is the policy associated with this object, if it was supplied via the
+	// Persistent field of a PolicyResourcesData. This will be nil if no policy is known.
+	Policy *Policy
+}
+
+// ErrNoObjectPolicy is returned from [CheckObjectPolicy] if the supplied object
+// doesn't have an authorization policy.
+var ErrNoObjectPolicy = errors.New("object has no authorization policy")
+
+// CheckObjectPolicy checks that the supplied policy can be used to authorize the object with
+// the supplied public area with a policy session. It does this by comparing the digest of the
+// policy for the name algorithm of the object with the object's authorization policy. The
+// digest is computed if the policy doesn't already have one for the name algorithm.
+//
+// If the object has no authorization policy, which means it can only be authorized with its
+// authorization value, [ErrNoObjectPolicy] is returned. If the policy digest doesn't match the
+// object's authorization policy, a different error is returned.
+func CheckObjectPolicy(public *tpm2.Public, policy *Policy) error {
+	if public == nil {
+		return errors.New("no public area")
+	}
+	if policy == nil {
+		return errors.New("no policy")
+	}
+	if len(public.AuthPolicy) == 0 {
+		return ErrNoObjectPolicy
+	}
+
+	digest, err := policy.Digest(public.NameAlg)
+	if errors.Is(err, ErrMissingDigest) {
+		digest, err = policy.ComputeFor(public.NameAlg)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot obtain policy digest for %v: %w", public.NameAlg, err)
+	}
+
+	if !bytes.Equal(digest, public.AuthPolicy) {
+		return fmt.Errorf("policy digest %#x doesn't match the object's authorization policy %#x", digest, public.AuthPolicy)
+	}
+	return nil
+}
+
+// VerifySessionSatisfies checks that the supplied policy session can be used to authorize
+// the object with the supplied public area, by reading the session digest with
+// TPM2_PolicyGetDigest and comparing it with the object's authorization policy. This is
+// useful as a final check after executing a policy, to detect cases where the wrong policy
+// was executed for the object.
+//
+// The TPM only compares the session digest with the object's authorization policy if the
+// session's digest algorithm is the object's name algorithm, so an error is returned if
+// these differ without executing any commands. If the object has no authorization policy,
+// [ErrNoObjectPolicy] is returned. If the session digest doesn't match the object's
+// authorization policy, a different error is returned.
+func VerifySessionSatisfies(tpm *tpm2.TPMContext, session tpm2.SessionContext, public *tpm2.Public) error {
+	if tpm == nil {
+		return errors.New("no TPM context")
+	}
+	if session == nil {
+		return errors.New("no session")
+	}
+	if public == nil {
+		return errors.New("no public area")
+	}
+	if len(public.AuthPolicy) == 0 {
+		return ErrNoObjectPolicy
+	}
+
+	alg := session.Params().HashAlg
+	if alg != public.NameAlg {
+		return fmt.Errorf("session digest algorithm %v doesn't match the object's name algorithm %v", alg, public.NameAlg)
+	}
+
+	digest, err := tpm.PolicyGetDigest(session)
+	if err != nil {
+		return fmt.Errorf("cannot obtain session digest: %w", err)
+	}
+
+	if !bytes.Equal(digest, public.AuthPolicy) {
+		return fmt.Errorf("session digest %#x doesn't match the object's authorization policy %#x", digest, public.AuthPolicy)
+	}
+	return nil
+}
+
+// PolicyMatches indicates whether the supplied policy can be used to authorize this object
+// with a policy session, using [CheckObjectPolicy]. If policy is nil, the policy associated
+// with this object is used.
+func (i *PersistentObjectInfo) PolicyMatches(policy *Policy) bool {
+	if policy == nil {
+		policy = i.Policy
+	}
+	return CheckObjectPolicy(i.Public, policy) == nil
+}
+
+// InventoryPersistent returns details about every persistent object on the supplied TPM,
+// in order of handle. The public area of each object is read from the TPM. Objects that
+// cannot be read because the TPM returns an error are omitted - this can happen if an
+// object is evicted whilst this function is running.
+//
+// If data is supplied, the policy associated with each object is obtained by
+// cross-referencing the Persistent field of data using the object's name. This ensures
+// that a stale entry for a handle that now contains a different object is not used.
+//
+// The underlying TPM2_GetCapability command may need to be executed more than once to
+// enumerate all persistent handles, so any sessions supplied should have the
+// [tpm2.AttrContinueSession] attribute defined.
+func InventoryPersistent(tpm *tpm2.TPMContext, data *PolicyResourcesData, sessions ...tpm2.SessionContext) ([]PersistentObjectInfo, error) {
+	if tpm == nil {
+		return nil, errors.New("no TPM context")
+	}
+	if data == nil {
+		data = new(PolicyResourcesData)
+	}
+
+	handles, err := tpm.GetCapabilityHandles(tpm2.HandleTypePersistent.BaseHandle(), tpm2.CapabilityMaxProperties, sessions...)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []PersistentObjectInfo
+	for _, handle := range handles {
+		if handle.Type() != tpm2.HandleTypePersistent {
+			break
+		}
+
+		pub, name, _, err := tpm.ReadPublic(tpm2.NewHandleContext(handle), sessions...)
+		switch {
+		case tpm2.IsTPMError(err, tpm2.AnyErrorCode, tpm2.AnyCommandCode):
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		info := PersistentObjectInfo{
+			Handle: handle,
+			Name:   name,
+			Public: pub}
+		for _, resource := range data.Persistent {
+			if !bytes.Equal(resource.Name, name) {
+				continue
+			}
+			info.Policy = resource.Policy
+			break
+		}
+
+		out = append(out, info)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,249 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type inventorySuiteNoTPM struct{}
+
+var _ = Suite(&inventorySuiteNoTPM{})
+
+func (s *inventorySuiteNoTPM) newPolicy(c *C, code tpm2.CommandCode) (tpm2.Digest, *Policy) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyCommandCode(code)
+	digest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	return digest, policy
+}
+
+func (s *inventorySuiteNoTPM) TestPolicyMatches(c *C) {
+	digest, policy := s.newPolicy(c, tpm2.CommandUnseal)
+
+	template := testutil.NewRSAStorageKeyTemplate()
+	template.AuthPolicy = digest
+	info := &PersistentObjectInfo{Public: template, Policy: policy}
+	c.Check(info.PolicyMatches(nil), internal_testutil.IsTrue)
+	c.Check(info.PolicyMatches(policy), internal_testutil.IsTrue)
+}
+
+func (s *inventorySuiteNoTPM) TestPolicyMatchesDifferentPolicy(c *C) {
+	digest, policy := s.newPolicy(c, tpm2.CommandUnseal)
+	_, other := s.newPolicy(c, tpm2.CommandLoad)
+
+	template := testutil.NewRSAStorageKeyTemplate()
+	template.AuthPolicy = digest
+	info := &PersistentObjectInfo{Public: template, Policy: policy}
+	c.Check(info.PolicyMatches(other), internal_testutil.IsFalse)
+}
+
+func (s *inventorySuiteNoTPM) TestPolicyMatchesNoPolicy(c *C) {
+	digest, _ := s.newPolicy(c, tpm2.CommandUnseal)
+
+	template := testutil.NewRSAStorageKeyTemplate()
+	template.AuthPolicy = digest
+	info := &PersistentObjectInfo{Public: template}
+	c.Check(info.PolicyMatches(nil), internal_testutil.IsFalse)
+}
+
+func (s *inventorySuiteNoTPM) TestPolicyMatchesNoAuthPolicy(c *C) {
+	_, policy := s.newPolicy(c, tpm2.CommandUnseal)
+
+	info := &PersistentObjectInfo{Public: testutil.NewRSAStorageKeyTemplate(), Policy: policy}
+	c.Check(info.PolicyMatches(nil), internal_testutil.IsFalse)
+}
+
+func (s *inventorySuiteNoTPM) TestCheckObjectPolicy(c *C) {
+	digest, policy := s.newPolicy(c, tpm2.CommandUnseal)
+
+	template := testutil.NewSealedObjectTemplate()
+	template.AuthPolicy = digest
+	c.Check(CheckObjectPolicy(template, policy), IsNil)
+}
+
+func (s *inventorySuiteNoTPM) TestCheckObjectPolicyComputesDigest(c *C) {
+	_, policy := s.newPolicy(c, tpm2.CommandUnseal)
+
+	var expected *Policy
+	c.Assert(mu.CopyValue(&expected, policy), IsNil)
+	digest, err := expected.AddDigest(tpm2.HashAlgorithmSHA1)
+	c.Assert(err, IsNil)
+
+	template := testutil.NewSealedObjectTemplate()
+	template.NameAlg = tpm2.HashAlgorithmSHA1
+	template.AuthPolicy = digest
+	c.Check(CheckObjectPolicy(template, policy), IsNil)
+}
+
+func (s *inventorySuiteNoTPM) TestCheckObjectPolicyMismatch(c *C) {
+	digest, _ := s.newPolicy(c, tpm2.CommandUnseal)
+	_, other := s.newPolicy(c, tpm2.CommandLoad)
+
+	template := testutil.NewSealedObjectTemplate()
+	template.AuthPolicy = digest
+	err := CheckObjectPolicy(template, other)
+	c.Check(err, ErrorMatches, `policy digest 0x[[:xdigit:]]{64} doesn't match the object's authorization policy 0x[[:xdigit:]]{64}`)
+	c.Check(errors.Is(err, ErrNoObjectPolicy), internal_testutil.IsFalse)
+}
+
+func (s *inventorySuiteNoTPM) TestCheckObjectPolicyNoObjectPolicy(c *C) {
+	_, policy := s.newPolicy(c, tpm2.CommandUnseal)
+
+	err := CheckObjectPolicy(testutil.NewSealedObjectTemplate(), policy)
+	c.Check(err, Equals, ErrNoObjectPolicy)
+	c.Check(err, ErrorMatches, `object has no authorization policy`)
+}
+
+func (s *inventorySuiteNoTPM) TestCheckObjectPolicyNoPolicy(c *C) {
+	digest, _ := s.newPolicy(c, tpm2.CommandUnseal)
+
+	template := testutil.NewSealedObjectTemplate()
+	template.AuthPolicy = digest
+	c.Check(CheckObjectPolicy(template, nil), ErrorMatches, `no policy`)
+}
+
+type inventorySuite struct {
+	testutil.TPMTest
+}
+
+func (s *inventorySuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&inventorySuite{})
+
+func (s *inventorySuite) TestInventoryPersistent(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandLoad)
+	policyDigest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	template := testutil.NewRSAStorageKeyTemplate()
+	template.AuthPolicy = policyDigest
+
+	object1 := s.CreatePrimary(c, tpm2.HandleOwner, template)
+	handle1 := s.NextAvailableHandle(c, 0x81000008)
+	s.EvictControl(c, tpm2.HandleOwner, object1, handle1)
+
+	object2 := s.CreateStoragePrimaryKeyRSA(c)
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	s.EvictControl(c, tpm2.HandleOwner, object2, handle2)
+
+	data := &PolicyResourcesData{
+		Persistent: []PersistentResource{
+			{Name: object1.Name(), Handle: handle1, Policy: policy},
+			// This entry is stale and should be ignored
+			{Name: object1.Name(), Handle: handle2, Policy: policy},
+		},
+	}
+
+	inventory, err := InventoryPersistent(s.TPM, data)
+	c.Assert(err, IsNil)
+
+	var found1, found2 bool
+	for i, info := range inventory {
+		c.Check(info.Handle.Type(), Equals, tpm2.HandleTypePersistent)
+		if i > 0 {
+			c.Check(info.Handle > inventory[i-1].Handle, internal_testutil.IsTrue)
+		}
+
+		switch info.Handle {
+		case handle1:
+			found1 = true
+			c.Check(info.Name, DeepEquals, object1.Name())
+			c.Check(info.Public, DeepEquals, object1.(tpm2.ObjectContext).Public())
+			c.Check(info.Policy, Equals, policy)
+			c.Check(info.PolicyMatches(nil), internal_testutil.IsTrue)
+		case handle2:
+			found2 = true
+			c.Check(info.Name, DeepEquals, object2.Name())
+			c.Check(info.Policy, IsNil)
+			c.Check(info.PolicyMatches(policy), internal_testutil.IsFalse)
+		}
+	}
+	c.Check(found1, internal_testutil.IsTrue)
+	c.Check(found2, internal_testutil.IsTrue)
+}
+
+func (s *inventorySuite) TestInventoryPersistentNoData(c *C) {
+	object := s.CreateStoragePrimaryKeyRSA(c)
+	handle := s.NextAvailableHandle(c, 0x81000008)
+	s.EvictControl(c, tpm2.HandleOwner, object, handle)
+
+	inventory, err := InventoryPersistent(s.TPM, nil)
+	c.Assert(err, IsNil)
+
+	var found bool
+	for _, info := range inventory {
+		if info.Handle != handle {
+			continue
+		}
+		found = true
+		c.Check(info.Name, DeepEquals, object.Name())
+		c.Check(info.Policy, IsNil)
+	}
+	c.Check(found, internal_testutil.IsTrue)
+}
+
+func (s *inventorySuite) newPolicy(c *C, code tpm2.CommandCode) (tpm2.Digest, *Policy) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyCommandCode(code)
+	digest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	return digest, policy
+}
+
+func (s *inventorySuite) TestVerifySessionSatisfies(c *C) {
+	digest, policy := s.newPolicy(c, tpm2.CommandUnseal)
+
+	template := testutil.NewSealedObjectTemplate()
+	template.AuthPolicy = digest
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	_, err := policy.Execute(NewTPMPolicySession(s.TPM, session), nil, NewTPMHelper(s.TPM, nil), nil)
+	c.Assert(err, IsNil)
+
+	c.Check(VerifySessionSatisfies(s.TPM, session, template), IsNil)
+}
+
+func (s *inventorySuite) TestVerifySessionSatisfiesMismatch(c *C) {
+	digest, _ := s.newPolicy(c, tpm2.CommandUnseal)
+	_, other := s.newPolicy(c, tpm2.CommandLoad)
+
+	template := testutil.NewSealedObjectTemplate()
+	template.AuthPolicy = digest
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	_, err := other.Execute(NewTPMPolicySession(s.TPM, session), nil, NewTPMHelper(s.TPM, nil), nil)
+	c.Assert(err, IsNil)
+
+	err = VerifySessionSatisfies(s.TPM, session, template)
+	c.Check(err, ErrorMatches, `session digest 0x[[:xdigit:]]{64} doesn't match the object's authorization policy 0x[[:xdigit:]]{64}`)
+	c.Check(errors.Is(err, ErrNoObjectPolicy), internal_testutil.IsFalse)
+}
+
+func (s *inventorySuite) TestVerifySessionSatisfiesDifferentAlgorithm(c *C) {
+	digest, _ := s.newPolicy(c, tpm2.CommandUnseal)
+
+	template := testutil.NewSealedObjectTemplate()
+	template.AuthPolicy = digest
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA1)
+	c.Check(VerifySessionSatisfies(s.TPM, session, template), ErrorMatches, `session digest algorithm TPM_ALG_SHA1 doesn't match the object's name algorithm TPM_ALG_SHA256`)
+}
+
+func (s *inventorySuite) TestVerifySessionSatisfiesNoObjectPolicy(c *C) {
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	c.Check(VerifySessionSatisfies(s.TPM, session, testutil.NewSealedObjectTemplate()), Equals, ErrNoObjectPolicy)
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// rotateAuthorizeKey replaces the key in every TPM2_PolicyAuthorize assertion in the
+// supplied elements that references oldKeyName with a copy of newKey, returning the number
+// of assertions that were updated.
+func rotateAuthorizeKey(elements policyElements, oldKeyName tpm2.Name, newKey *tpm2.Public) (int, error) {
+	n := 0
+	for _, element := range elements {
+		switch element.Type {
+		case tpm2.CommandPolicyAuthorize:
+			if !bytes.Equal(element.Details.Authorize.KeySign.Name(), oldKeyName) {
+				continue
+			}
+			var keySign *tpm2.Public
+			if err := mu.CopyValue(&keySign, newKey); err != nil {
+				return 0, fmt.Errorf("cannot copy new key: %w", err)
+			}
+			element.Details.Authorize.KeySign = keySign
+			n += 1
+		case tpm2.CommandPolicyOR:
+			for _, branch := range element.Details.OR.Branches {
+				branchN, err := rotateAuthorizeKey(branch.Policy, oldKeyName, newKey)
+				if err != nil {
+					return 0, err
+				}
+				n += branchN
+			}
+		}
+	}
+	return n, nil
+}
+
+// RotateAuthorizeKey returns copies of the supplied policies with every TPM2_PolicyAuthorize
+// assertion that references oldKey updated to reference newKey instead. This is useful when the
+// key used to sign authorized policies is rotated, in which case the authorization policy of
+// every object that uses these policies must be updated, as it is bound to the name of the key.
+// The supplied policies are not modified.
+//
+// Every supplied policy must contain at least one TPM2_PolicyAuthorize assertion for oldKey,
+// else an error is returned. Each returned policy corresponds to the supplied policy at the
+// same index, and has its digests recomputed for every algorithm that the original policy has
+// a digest for. Any authorizations that the supplied policies contain are not retained, because
+// they are bound to the old digests. Note that the existing authorized policies must still be
+// re-signed with the new key, using [Policy.Authorize].
+func RotateAuthorizeKey(oldKey, newKey *tpm2.Public, policies []*Policy) ([]*Policy, error) {
+	if oldKey == nil || !oldKey.Name().IsValid() {
+		return nil, errors.New("invalid old key")
+	}
+	if newKey == nil || !newKey.Name().IsValid() {
+		return nil, errors.New("invalid new key")
+	}
+	oldKeyName := oldKey.Name()
+
+	var out []*Policy
+	for i, policy := range policies {
+		if policy == nil {
+			return nil, fmt.Errorf("policy %d: no policy", i)
+		}
+
+		rotated := new(Policy)
+		if err := mu.CopyValue(rotated, policy); err != nil {
+			return nil, fmt.Errorf("policy %d: cannot make copy: %w", i, err)
+		}
+
+		n, err := rotateAuthorizeKey(rotated.policy.Policy, oldKeyName, newKey)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("policy %d: %w", i, err)
+		case n == 0:
+			return nil, fmt.Errorf("policy %d: no TPM2_PolicyAuthorize assertion references the old key", i)
+		}
+		rotated.policy.PolicyAuthorizations = nil
+
+		for _, digest := range policy.policy.PolicyDigests {
+			if _, err := rotated.AddDigest(digest.HashAlg); err != nil {
+				return nil, fmt.Errorf("policy %d: cannot compute digest for %v: %w", i, digest.HashAlg, err)
+			}
+		}
+
+		out = append(out, rotated)
+	}
+
+	return out, nil
+}
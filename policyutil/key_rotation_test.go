@@ -0,0 +1,166 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"crypto/rand"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type keyRotationSuite struct{}
+
+var _ = Suite(&keyRotationSuite{})
+
+func (s *keyRotationSuite) keys() (oldKey, newKey *tpm2.Public) {
+	return objectutil.NewECCKeyTemplate(objectutil.UsageSign), objectutil.NewRSAKeyTemplate(objectutil.UsageSign)
+}
+
+func (s *keyRotationSuite) TestRotateAuthorizeKey(c *C) {
+	oldKey, newKey := s.keys()
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthorize([]byte("foo"), oldKey)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Assert(policy.EnsureDigests(tpm2.HashAlgorithmSHA1), IsNil)
+	orig := mu.MustMarshalToBytes(policy)
+
+	rotated, err := RotateAuthorizeKey(oldKey, newKey, []*Policy{policy})
+	c.Assert(err, IsNil)
+	c.Assert(rotated, internal_testutil.LenEquals, 1)
+
+	// The supplied policy should not be modified.
+	c.Check(mu.MustMarshalToBytes(policy), DeepEquals, orig)
+
+	digest, err := rotated[0].Digest(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "255f8fb2c7ff7675fe31fd952f99309059639c84b90297c94deb6f91123af381")))
+	digest, err = rotated[0].Digest(tpm2.HashAlgorithmSHA1)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "c63072d214ac77366520ad997164153d63272420")))
+
+	builder = NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthorize([]byte("foo"), newKey)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	_, expected, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Assert(expected.EnsureDigests(tpm2.HashAlgorithmSHA1), IsNil)
+	c.Check(mu.MustMarshalToBytes(rotated[0]), DeepEquals, mu.MustMarshalToBytes(expected))
+}
+
+func (s *keyRotationSuite) TestRotateAuthorizeKeyInBranches(c *C) {
+	oldKey, newKey := s.keys()
+	otherKey := objectutil.NewECCKeyTemplate(objectutil.UsageSign, objectutil.WithNameAlg(tpm2.HashAlgorithmSHA1))
+
+	build := func(key *tpm2.Public) *Policy {
+		builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+		node := builder.RootBranch().AddBranchNode()
+		node.AddBranch("authorized").PolicyAuthorize(nil, key)
+		node.AddBranch("other").PolicyAuthorize(nil, otherKey)
+		node.AddBranch("pin").PolicyAuthValue()
+		_, policy, err := builder.Policy()
+		c.Assert(err, IsNil)
+		return policy
+	}
+
+	policy1 := build(oldKey)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthorize([]byte("bar"), oldKey)
+	_, policy2, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	rotated, err := RotateAuthorizeKey(oldKey, newKey, []*Policy{policy1, policy2})
+	c.Assert(err, IsNil)
+	c.Assert(rotated, internal_testutil.LenEquals, 2)
+
+	c.Check(mu.MustMarshalToBytes(rotated[0]), DeepEquals, mu.MustMarshalToBytes(build(newKey)))
+
+	expectedDigest, err := rotated[0].Validate(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	digest, err := rotated[0].Digest(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+
+	builder = NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthorize([]byte("bar"), newKey)
+	expectedDigest, err = builder.Digest()
+	c.Assert(err, IsNil)
+	digest, err = rotated[1].Digest(tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *keyRotationSuite) TestRotateAuthorizeKeyDropsAuthorizations(c *C) {
+	oldKey, newKey := s.keys()
+
+	pub, key := newTestSigningKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthorize(nil, oldKey)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Assert(policy.Authorize(rand.Reader, pub, nil, key, tpm2.HashAlgorithmSHA256), IsNil)
+
+	rotated, err := RotateAuthorizeKey(oldKey, newKey, []*Policy{policy})
+	c.Assert(err, IsNil)
+	c.Assert(rotated, internal_testutil.LenEquals, 1)
+
+	builder = NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthorize(nil, newKey)
+	_, expected, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Check(mu.MustMarshalToBytes(rotated[0]), DeepEquals, mu.MustMarshalToBytes(expected))
+}
+
+func (s *keyRotationSuite) TestRotateAuthorizeKeyNotReferenced(c *C) {
+	oldKey, newKey := s.keys()
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthorize(nil, oldKey)
+	_, policy1, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	builder = NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthorize(nil, newKey)
+	_, policy2, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	_, err = RotateAuthorizeKey(oldKey, newKey, []*Policy{policy1, policy2})
+	c.Check(err, ErrorMatches, `policy 1: no TPM2_PolicyAuthorize assertion references the old key`)
+}
+
+func (s *keyRotationSuite) TestRotateAuthorizeKeyInvalidKey(c *C) {
+	oldKey, _ := s.keys()
+	_, err := RotateAuthorizeKey(oldKey, new(tpm2.Public), nil)
+	c.Check(err, ErrorMatches, `invalid new key`)
+}
+
+func (s *keyRotationSuite) TestRotateAuthorizeKeyCopiesNewKey(c *C) {
+	oldKey, newKey := s.keys()
+
+	// Use a policy without digests so that it isn't copied again when they are
+	// recomputed.
+	policy := NewMockPolicy(nil, nil,
+		NewMockPolicyAuthorizeElement([]byte("foo"), oldKey),
+		NewMockPolicyAuthorizeElement([]byte("bar"), oldKey))
+
+	rotated, err := RotateAuthorizeKey(oldKey, newKey, []*Policy{policy})
+	c.Assert(err, IsNil)
+	c.Assert(rotated, internal_testutil.LenEquals, 1)
+	expected := mu.MustMarshalToBytes(rotated[0])
+
+	// Modifying the supplied key must not modify the returned policy.
+	newKey.Attrs ^= tpm2.AttrNoDA
+	c.Check(mu.MustMarshalToBytes(rotated[0]), DeepEquals, expected)
+}
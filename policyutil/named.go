@@ -18,3 +18,30 @@ type NamedHandle interface {
 	Handle() tpm2.Handle
 	Named
 }
+
+type handleNamed tpm2.Handle
+
+func (h handleNamed) Handle() tpm2.Handle {
+	return tpm2.Handle(h)
+}
+
+func (h handleNamed) Name() tpm2.Name {
+	return tpm2.MakeHandleName(tpm2.Handle(h))
+}
+
+// HandleNamed returns a NamedHandle for the specified handle, with a name that is the same as
+// the one returned from [tpm2.MakeHandleName]. This is useful for passing a permanent or PCR
+// handle to functions that expect a [Named] or [NamedHandle] argument, such as
+// [PolicyBuilderBranch.PolicyCpHash] or [ComputeCpHash], without having to create a
+// [tpm2.ResourceContext].
+//
+// This will panic if the specified handle doesn't correspond to a PCR, session or permanent
+// resource, as the name of other resources can't be determined from their handle.
+func HandleNamed(handle tpm2.Handle) NamedHandle {
+	switch handle.Type() {
+	case tpm2.HandleTypePCR, tpm2.HandleTypeHMACSession, tpm2.HandleTypePolicySession, tpm2.HandleTypePermanent:
+		return handleNamed(handle)
+	default:
+		panic("invalid handle type")
+	}
+}
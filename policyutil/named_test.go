@@ -0,0 +1,51 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type namedSuite struct{}
+
+var _ = Suite(&namedSuite{})
+
+func (s *namedSuite) TestHandleNamedOwner(c *C) {
+	named := HandleNamed(tpm2.HandleOwner)
+	c.Check(named.Handle(), Equals, tpm2.HandleOwner)
+	c.Check(named.Name(), DeepEquals, tpm2.Name(internal_testutil.DecodeHexString(c, "40000001")))
+	c.Check(named.Name(), DeepEquals, tpm2.MakeHandleName(tpm2.HandleOwner))
+}
+
+func (s *namedSuite) TestHandleNamedEndorsement(c *C) {
+	named := HandleNamed(tpm2.HandleEndorsement)
+	c.Check(named.Handle(), Equals, tpm2.HandleEndorsement)
+	c.Check(named.Name(), DeepEquals, tpm2.Name(internal_testutil.DecodeHexString(c, "4000000b")))
+}
+
+func (s *namedSuite) TestHandleNamedPCR(c *C) {
+	named := HandleNamed(7)
+	c.Check(named.Handle(), Equals, tpm2.Handle(7))
+	c.Check(named.Name(), DeepEquals, tpm2.Name(internal_testutil.DecodeHexString(c, "00000007")))
+}
+
+func (s *namedSuite) TestHandleNamedInvalid(c *C) {
+	c.Check(func() { HandleNamed(0x81000001) }, PanicMatches, `invalid handle type`)
+}
+
+func (s *namedSuite) TestHandleNamedComputeCpHash(c *C) {
+	expected, err := ComputeCpHash(tpm2.HashAlgorithmSHA256, tpm2.CommandLoad, []Named{tpm2.Name{0x40, 0x00, 0x00, 0x01}}, tpm2.Private{1, 2, 3, 4}, mu.Sized(objectutil.NewRSAStorageKeyTemplate()))
+	c.Assert(err, IsNil)
+
+	cpHash, err := ComputeCpHash(tpm2.HashAlgorithmSHA256, tpm2.CommandLoad, []Named{HandleNamed(tpm2.HandleOwner)}, tpm2.Private{1, 2, 3, 4}, mu.Sized(objectutil.NewRSAStorageKeyTemplate()))
+	c.Check(err, IsNil)
+	c.Check(cpHash, DeepEquals, expected)
+}
@@ -6,6 +6,7 @@ package policyutil
 
 import (
 	"errors"
+	"hash"
 
 	"github.com/canonical/go-tpm2"
 )
@@ -37,7 +38,10 @@ type policyOrTree struct {
 	leafNodes []*policyOrNode
 }
 
-func newPolicyOrTree(alg tpm2.HashAlgorithmId, digests tpm2.DigestList) (out *policyOrTree, err error) {
+func newPolicyOrTree(alg tpm2.HashAlgorithmId, newHash func() hash.Hash, digests tpm2.DigestList) (out *policyOrTree, err error) {
+	if newHash == nil {
+		return nil, errors.New("no hash constructor")
+	}
 	if len(digests) == 0 {
 		return nil, errors.New("no digests")
 	}
@@ -71,7 +75,10 @@ func newPolicyOrTree(alg tpm2.HashAlgorithmId, digests tpm2.DigestList) (out *po
 			// Consume the next n digests to fit in to this node and produce a single digest
 			// that will go in to the parent node.
 			trial := newComputePolicySession(alg, nil, true)
-			trial.PolicyOR(node.digests)
+			trial.newHash = newHash
+			if err := trial.PolicyOR(node.digests); err != nil {
+				return nil, err
+			}
 			nextDigest, err := trial.PolicyGetDigest()
 			if err != nil {
 				return nil, err
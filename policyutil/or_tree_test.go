@@ -90,7 +90,7 @@ type testNewPolicyOrTreeData struct {
 }
 
 func (s *orTreeSuite) testNewPolicyOrTree(c *C, data *testNewPolicyOrTreeData) {
-	tree, err := NewPolicyOrTree(data.alg, data.digests)
+	tree, err := NewPolicyOrTree(data.alg, data.alg.NewHash, data.digests)
 	c.Assert(err, IsNil)
 
 	policy, depth := s.checkPolicyOrTree(c, data.alg, data.digests, tree)
@@ -168,15 +168,20 @@ func (s *orTreeSuite) TestNewPolicyOrTreeDepth4(c *C) {
 }
 
 func (s *orTreeSuite) TestNewPolicyOrTreeNoDigests(c *C) {
-	_, err := NewPolicyOrTree(tpm2.HashAlgorithmSHA256, nil)
+	_, err := NewPolicyOrTree(tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA256.NewHash, nil)
 	c.Check(err, ErrorMatches, "no digests")
 }
 
 func (s *orTreeSuite) TestNewPolicyOrTreeTooManyDigests(c *C) {
-	_, err := NewPolicyOrTree(tpm2.HashAlgorithmSHA256, make(tpm2.DigestList, 5000))
+	_, err := NewPolicyOrTree(tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA256.NewHash, make(tpm2.DigestList, 5000))
 	c.Check(err, ErrorMatches, "too many digests")
 }
 
+func (s *orTreeSuite) TestNewPolicyOrTreeNoHashConstructor(c *C) {
+	_, err := NewPolicyOrTree(tpm2.HashAlgorithmSM3_256, nil, make(tpm2.DigestList, 10))
+	c.Check(err, ErrorMatches, "no hash constructor")
+}
+
 type testPolicyOrTreeSelectBranchData struct {
 	alg      tpm2.HashAlgorithmId
 	digests  tpm2.DigestList
@@ -184,7 +189,7 @@ type testPolicyOrTreeSelectBranchData struct {
 }
 
 func (s *orTreeSuite) testPolicyOrTreeSelectBranch(c *C, data *testPolicyOrTreeSelectBranchData) {
-	tree, err := NewPolicyOrTree(data.alg, data.digests)
+	tree, err := NewPolicyOrTree(data.alg, data.alg.NewHash, data.digests)
 	c.Assert(err, IsNil)
 
 	policy, depth := s.checkPolicyOrTree(c, data.alg, data.digests, tree)
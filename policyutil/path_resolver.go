@@ -23,15 +23,18 @@ type policyPathWildcardResolver struct {
 	usage                *PolicySessionUsage
 	ignoreAuthorizations []PolicyAuthorizationID
 	ignoreNV             []Named
+	preferNoAuthorize    bool
+	logger               PolicyBranchSelectionLogger
 
 	// These fields are reset on each call to resolve.
-	paths             []policyBranchPath                       // ordered collection of paths
-	details           map[policyBranchPath]PolicyBranchDetails // map of details collected for each path
-	missingAuthorized map[policyBranchPath]struct{}            // map of each collected path with missing authorized policies
-	nvCheckedOk       map[nvAssertionMapKey]struct{}           // map of PolicyNV assertions that would succeed
+	paths             []policyBranchPath                              // ordered collection of paths
+	details           map[policyBranchPath]PolicyBranchDetails        // map of details collected for each path
+	missingAuthorized map[policyBranchPath]struct{}                   // map of each collected path with missing authorized policies
+	nvCheckedOk       map[nvAssertionMapKey]struct{}                  // map of PolicyNV assertions that would succeed
+	rejected          map[policyBranchPath]PolicyBranchRejectedReason // map of rejected paths, only populated if there is a logger
 }
 
-func newPolicyPathWildcardResolver(sessionAlg tpm2.HashAlgorithmId, resources *executePolicyResources, tpm TPMHelper, usage *PolicySessionUsage, ignoreAuthorizations []PolicyAuthorizationID, ignoreNV []Named) *policyPathWildcardResolver {
+func newPolicyPathWildcardResolver(sessionAlg tpm2.HashAlgorithmId, resources *executePolicyResources, tpm TPMHelper, usage *PolicySessionUsage, ignoreAuthorizations []PolicyAuthorizationID, ignoreNV []Named, preferNoAuthorize bool, logger PolicyBranchSelectionLogger) *policyPathWildcardResolver {
 	return &policyPathWildcardResolver{
 		sessionAlg:           sessionAlg,
 		resources:            resources,
@@ -39,6 +42,17 @@ func newPolicyPathWildcardResolver(sessionAlg tpm2.HashAlgorithmId, resources *e
 		usage:                usage,
 		ignoreAuthorizations: ignoreAuthorizations,
 		ignoreNV:             ignoreNV,
+		preferNoAuthorize:    preferNoAuthorize,
+		logger:               logger,
+	}
+}
+
+// reject removes the specified path from the set of candidate paths, recording
+// the reason if there is a logger.
+func (s *policyPathWildcardResolver) reject(path policyBranchPath, reason PolicyBranchRejectedReason) {
+	delete(s.details, path)
+	if s.logger != nil {
+		s.rejected[path] = reason
 	}
 }
 
@@ -49,7 +63,7 @@ func (s *policyPathWildcardResolver) filterInvalidBranches() {
 		if d.IsValid() {
 			continue
 		}
-		delete(s.details, p)
+		s.reject(p, PolicyBranchRejectedInvalid)
 	}
 }
 
@@ -68,7 +82,7 @@ func (s *policyPathWildcardResolver) filterIgnoredResources() {
 			for _, auth := range auths {
 				if bytes.Equal(auth.AuthName, ignore.AuthName) && bytes.Equal(auth.PolicyRef, ignore.PolicyRef) {
 					// this path contains an authorization to ignore, so drop it
-					delete(s.details, p)
+					s.reject(p, PolicyBranchRejectedIgnoredResource)
 					break
 				}
 			}
@@ -82,7 +96,7 @@ func (s *policyPathWildcardResolver) filterIgnoredResources() {
 			for _, nv := range d.NV {
 				if bytes.Equal(nv.Name, ignore.Name()) {
 					// this path contains a PolicyNV assertion to ignore, so drop it
-					delete(s.details, p)
+					s.reject(p, PolicyBranchRejectedIgnoredResource)
 					break
 				}
 			}
@@ -97,7 +111,7 @@ func (s *policyPathWildcardResolver) filterMissingAuthorizedBranches() {
 	// iterate over each execution path
 	for p := range s.details {
 		if _, missing := s.missingAuthorized[p]; missing {
-			delete(s.details, p)
+			s.reject(p, PolicyBranchRejectedMissingAuthorizedPolicy)
 		}
 	}
 }
@@ -114,7 +128,7 @@ func (s *policyPathWildcardResolver) filterUsageIncompatibleBranches() error {
 		code, set := d.CommandCode()
 		if set && code != s.usage.CommandCode() {
 			// this path doesn't match the command code, so drop it
-			delete(s.details, p)
+			s.reject(p, PolicyBranchRejectedUsageMismatch)
 			continue
 		}
 
@@ -126,7 +140,7 @@ func (s *policyPathWildcardResolver) filterUsageIncompatibleBranches() error {
 			}
 			if !bytes.Equal(usageCpHash, cpHash) {
 				// this path doesn't match the command parameters, so drop it
-				delete(s.details, p)
+				s.reject(p, PolicyBranchRejectedUsageMismatch)
 				continue
 			}
 		}
@@ -139,38 +153,83 @@ func (s *policyPathWildcardResolver) filterUsageIncompatibleBranches() error {
 			}
 			if !bytes.Equal(usageNameHash, nameHash) {
 				// this path doesn't match the command handles, so drop it
-				delete(s.details, p)
+				s.reject(p, PolicyBranchRejectedUsageMismatch)
+				continue
+			}
+		}
+
+		pHash, set := d.ParametersHash()
+		if set {
+			usagePHash, err := s.usage.ParametersHash(s.sessionAlg)
+			if err != nil {
+				return fmt.Errorf("cannot obtain parameters hash from usage parameters: %w", err)
+			}
+			if !bytes.Equal(usagePHash, pHash) {
+				// this path doesn't match the command parameters, so drop it
+				s.reject(p, PolicyBranchRejectedUsageMismatch)
 				continue
 			}
 		}
 
 		if d.AuthValueNeeded && !s.usage.AllowAuthValue() {
 			// this path requires an auth value which the usage indicates is not possible, so drop it
-			delete(s.details, p)
+			s.reject(p, PolicyBranchRejectedUsageMismatch)
+			continue
+		}
+
+		if _, set := d.NvWritten(); set && s.usage.AuthHandle().Handle().Type() != tpm2.HandleTypeNVIndex {
+			// this path uses TPM2_PolicyNvWritten but the auth handle is not a
+			// NV index, so drop this path
+			s.reject(p, PolicyBranchRejectedUsageMismatch)
 			continue
 		}
+	}
 
+	return nil
+}
+
+// filterNvWrittenIncompatibleBranches removes branches that contain TPM2_PolicyNvWritten
+// assertions with a value that doesn't match the written state of the NV index that the
+// session will be used to authorize. This is only attempted if the session usage is
+// supplied and identifies a NV index as the authorization handle, and the written state
+// is read using TPM2_NV_ReadPublic.
+func (s *policyPathWildcardResolver) filterNvWrittenIncompatibleBranches() error {
+	if s.usage == nil {
+		return nil
+	}
+	authHandle := s.usage.AuthHandle()
+	if authHandle.Handle().Type() != tpm2.HandleTypeNVIndex {
+		// Paths that use TPM2_PolicyNvWritten have already been dropped by
+		// filterUsageIncompatibleBranches.
+		return nil
+	}
+
+	var pub *tpm2.NVPublic
+
+	// iterate over each execution path
+	for p, d := range s.details {
 		nvWritten, set := d.NvWritten()
-		if set {
-			authHandle := s.usage.AuthHandle()
-			if authHandle.Handle().Type() != tpm2.HandleTypeNVIndex {
-				// this path uses TPM2_PolicyNvWritten but the auth handle is not a
-				// NV index, so drop this path
-				delete(s.details, p)
-				continue
-			}
-			pub, err := s.tpm.NVReadPublic(tpm2.NewHandleContext(authHandle.Handle()))
+		if !set {
+			continue
+		}
+
+		if pub == nil {
+			var err error
+			pub, err = s.tpm.NVReadPublic(tpm2.NewHandleContext(authHandle.Handle()))
 			if err != nil {
 				return fmt.Errorf("cannot obtain NV index public area: %w", err)
 			}
-			written := pub.Attrs&tpm2.AttrNVWritten != 0
-			if nvWritten != written {
-				// this path uses TPM2_PolicyNvWritten but the auth handle attributes
-				// are incompatible, so drop this path.
-				delete(s.details, p)
-				continue
+			if authHandle.Name().Type() == tpm2.NameTypeDigest && !bytes.Equal(pub.Name(), authHandle.Name()) {
+				return fmt.Errorf("NV index with handle %v has an unexpected name", authHandle.Handle())
 			}
 		}
+
+		written := pub.Attrs&tpm2.AttrNVWritten != 0
+		if nvWritten != written {
+			// this path uses TPM2_PolicyNvWritten but the index written state
+			// is incompatible, so drop this path.
+			s.reject(p, PolicyBranchRejectedNvWrittenMismatch)
+		}
 	}
 
 	return nil
@@ -189,7 +248,7 @@ func (s *policyPathWildcardResolver) filterPcrIncompatibleBranches() error {
 			tmpPcrs, err := pcrs.Merge(item.PCRs)
 			if err != nil {
 				// this assertion is invalid, so drop this path
-				delete(s.details, p)
+				s.reject(p, PolicyBranchRejectedInvalid)
 				break
 			}
 			pcrs = tmpPcrs
@@ -218,7 +277,7 @@ func (s *policyPathWildcardResolver) filterPcrIncompatibleBranches() error {
 			}
 			if !bytes.Equal(pcrDigest, item.PCRDigest) {
 				// the assertion doesn't match the current PCR values, so drop this path
-				delete(s.details, p)
+				s.reject(p, PolicyBranchRejectedPCRMismatch)
 				break
 			}
 		}
@@ -329,6 +388,9 @@ func (s *policyPathWildcardResolver) canAuthNV(pub *tpm2.NVPublic, policy *Polic
 		if d.AuthValueNeeded {
 			continue
 		}
+		if d.PhysicalPresenceNeeded {
+			continue
+		}
 		code, set := d.CommandCode()
 		if set && code != command {
 			continue
@@ -342,6 +404,9 @@ func (s *policyPathWildcardResolver) canAuthNV(pub *tpm2.NVPublic, policy *Polic
 		if _, set := d.NameHash(); set {
 			continue
 		}
+		if _, set := d.ParametersHash(); set {
+			continue
+		}
 		if len(d.PCR) > 0 {
 			continue
 		}
@@ -376,8 +441,9 @@ const (
 )
 
 // filterNVIncompatibleBranches removes branches that contain TPM2_PolicyNV assertions
-// that will fail. This ignores assertions where it's not possible to determine the current
-// NV index contents because it requires authorization to read. It populates the nvCheckedOk
+// that will fail. The NV index contents are obtained from the session usage if it supplies
+// them. This ignores assertions where it's not possible to determine the current NV index
+// contents because it requires authorization to read. It populates the nvCheckedOk
 // map for assertions that were checked to be good.
 func (s *policyPathWildcardResolver) filterNVIncompatibleBranches() error {
 	nvResult := make(map[nvAssertionMapKey]nvAssertionStatus) // a map of assertion IDs to status
@@ -407,6 +473,20 @@ func (s *policyPathWildcardResolver) filterNVIncompatibleBranches() error {
 			// add preliminary result
 			nvResult[key] = nvAssertionStatusIndeterminate
 
+			// check if the usage tells us the contents of the index
+			if s.usage != nil {
+				if data, ok := s.usage.NVIndexContents(nv.Name, nv.Offset, uint16(len(nv.OperandB))); ok {
+					if !s.bufferMatch(tpm2.Operand(data), nv.OperandB, nv.Operation) {
+						nvResult[key] = nvAssertionStatusIncompatible
+						incompatible = true
+						break
+					}
+					nvResult[key] = nvAssertionStatusOK
+					s.nvCheckedOk[key] = struct{}{}
+					continue
+				}
+			}
+
 			// obtain NV index info
 			info, exists := nvInfo[nv.Index]
 			if !exists {
@@ -476,7 +556,7 @@ func (s *policyPathWildcardResolver) filterNVIncompatibleBranches() error {
 				runner := newPolicyExecuteRunner(
 					policySession,
 					tickets,
-					newExecutePolicyResources(session, resources, tickets, nil, nil),
+					newExecutePolicyResources(session, resources, tickets, nil, nil, newResourceUsage(s.tpm, false, false)),
 					resources,
 					s.tpm,
 					params,
@@ -520,7 +600,7 @@ func (s *policyPathWildcardResolver) filterNVIncompatibleBranches() error {
 		if incompatible {
 			// the last checked PolicyNV assertion for this path is bad, so
 			// drop the whole path
-			delete(s.details, p)
+			s.reject(p, PolicyBranchRejectedNVMismatch)
 		}
 	}
 
@@ -588,7 +668,7 @@ func (s *policyPathWildcardResolver) filterCounterTimerIncompatibleBranches() er
 		if incompatible {
 			// the last checked PolicyCounterTimer assertion for this path is bad, so
 			// drop the whole path
-			delete(s.details, p)
+			s.reject(p, PolicyBranchRejectedCounterTimerMismatch)
 		}
 	}
 
@@ -609,12 +689,15 @@ func (e *policyPathWildcardResolverTreeWalkError) Unwrap() error {
 
 func (*policyPathWildcardResolverTreeWalkError) isPolicyDelimiterError() {}
 
-func (s *policyPathWildcardResolver) resolve(branches policyBranches) (policyBranchPath, error) {
+// resolve selects a path for the supplied branches. The supplied node path is the
+// path of the branch that contains the branch node, and is only used for logging.
+func (s *policyPathWildcardResolver) resolve(nodePath policyBranchPath, branches policyBranches) (policyBranchPath, error) {
 	// reset state
 	s.paths = nil
 	s.details = make(map[policyBranchPath]PolicyBranchDetails)
 	s.missingAuthorized = make(map[policyBranchPath]struct{})
 	s.nvCheckedOk = make(map[nvAssertionMapKey]struct{})
+	s.rejected = make(map[policyBranchPath]PolicyBranchRejectedReason)
 
 	// Walk every path from the supplied branches
 	var makeBeginBranchFn func(policyBranchPath, *PolicyBranchDetails, bool) treeWalkerBeginBranchFn
@@ -682,6 +765,9 @@ func (s *policyPathWildcardResolver) resolve(branches policyBranches) (policyBra
 	if err := s.filterUsageIncompatibleBranches(); err != nil {
 		return "", fmt.Errorf("cannot filter branches incompatible with usage: %w", err)
 	}
+	if err := s.filterNvWrittenIncompatibleBranches(); err != nil {
+		return "", fmt.Errorf("cannot filter branches with TPM2_PolicyNvWritten assertions that will fail: %w", err)
+	}
 	if err := s.filterPcrIncompatibleBranches(); err != nil {
 		return "", fmt.Errorf("cannot filter branches with TPM2_PolicyPCR assertions that will fail: %w", err)
 	}
@@ -701,11 +787,13 @@ func (s *policyPathWildcardResolver) resolve(branches policyBranches) (policyBra
 	}
 
 	if len(candidates) == 0 {
+		s.log(nodePath, candidates, "", 0)
 		return "", errors.New("no appropriate paths found")
 	}
 
 	// Provisionally select the first path
 	path := candidates[0]
+	reason := PolicyBranchSelectionReasonFirstSatisfiable
 
 	// Try to find a better path
 	for _, candidate := range candidates {
@@ -715,6 +803,11 @@ func (s *policyPathWildcardResolver) resolve(branches policyBranches) (policyBra
 			continue
 		}
 
+		// prefer paths without TPM2_PolicyPhysicalPresence
+		if details.PhysicalPresenceNeeded {
+			continue
+		}
+
 		// prefer paths without TPM2_PolicySecret
 		if len(details.Secret) > 0 {
 			continue
@@ -725,6 +818,12 @@ func (s *policyPathWildcardResolver) resolve(branches policyBranches) (policyBra
 			continue
 		}
 
+		// prefer paths without TPM2_PolicyAuthorize if requested, so that a recovery
+		// path is only selected if no other path is suitable.
+		if s.preferNoAuthorize && len(details.Authorize) > 0 {
+			continue
+		}
+
 		// prefer paths without unchecked TPM2_PolicyNV
 		nvOK := true
 		for _, nv := range details.NV {
@@ -752,10 +851,49 @@ func (s *policyPathWildcardResolver) resolve(branches policyBranches) (policyBra
 			continue
 		}
 
+		// prefer paths without TPM2_PolicyParameters if we don't know the usage
+		if _, set := details.ParametersHash(); set && s.usage == nil {
+			continue
+		}
+
 		// we've found the perfect path!
 		path = candidate
+		switch {
+		case s.usage != nil && details.hasUsageContext():
+			reason = PolicyBranchSelectionReasonUsageMatch
+		case len(details.PCR) > 0:
+			reason = PolicyBranchSelectionReasonPCRMatch
+		default:
+			reason = PolicyBranchSelectionReasonPreferred
+		}
 		break
 	}
 
+	s.log(nodePath, candidates, path, reason)
 	return path, nil
 }
+
+// log emits a record of the branch selection if there is a logger.
+func (s *policyPathWildcardResolver) log(nodePath policyBranchPath, candidates []policyBranchPath, selected policyBranchPath, reason PolicyBranchSelectionReason) {
+	if s.logger == nil {
+		return
+	}
+
+	record := &PolicyBranchSelectionRecord{
+		Path:     string(nodePath),
+		Rejected: make(map[string]PolicyBranchRejectedReason),
+		Selected: string(selected),
+		Reason:   reason,
+	}
+	for _, path := range s.paths {
+		record.Evaluated = append(record.Evaluated, string(path))
+		if reason, rejected := s.rejected[path]; rejected {
+			record.Rejected[string(path)] = reason
+		}
+	}
+	for _, path := range candidates {
+		record.Satisfiable = append(record.Satisfiable, string(path))
+	}
+
+	s.logger.LogBranchSelection(record)
+}
@@ -7,6 +7,7 @@ package policyutil
 import (
 	"errors"
 	"fmt"
+	"hash"
 	"math"
 
 	"github.com/canonical/go-tpm2"
@@ -20,7 +21,13 @@ func ComputePCRDigest(alg tpm2.HashAlgorithmId, pcrs tpm2.PCRSelectionList, valu
 	if !alg.Available() {
 		return nil, errors.New("algorithm is not available")
 	}
-	h := alg.NewHash()
+	return computePCRDigest(alg.NewHash, pcrs, values)
+}
+
+// computePCRDigest is the same as ComputePCRDigest, but uses the supplied hash
+// constructor.
+func computePCRDigest(newHash func() hash.Hash, pcrs tpm2.PCRSelectionList, values tpm2.PCRValues) (tpm2.Digest, error) {
+	h := newHash()
 
 	for _, s := range pcrs {
 		if _, ok := values[s.Hash]; !ok {
@@ -53,11 +60,17 @@ func ComputePCRDigestFromAllValues(alg tpm2.HashAlgorithmId, values tpm2.PCRValu
 	if !alg.Available() {
 		return nil, nil, errors.New("algorithm is not available")
 	}
+	return computePCRDigestFromAllValues(alg.NewHash, values)
+}
+
+// computePCRDigestFromAllValues is the same as ComputePCRDigestFromAllValues, but
+// uses the supplied hash constructor.
+func computePCRDigestFromAllValues(newHash func() hash.Hash, values tpm2.PCRValues) (tpm2.PCRSelectionList, tpm2.Digest, error) {
 	pcrs, err := values.SelectionList()
 	if err != nil {
 		return nil, nil, err
 	}
-	digest, err := ComputePCRDigest(alg, pcrs, values)
+	digest, err := computePCRDigest(newHash, pcrs, values)
 	if err != nil {
 		return nil, nil, err
 	}
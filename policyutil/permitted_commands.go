@@ -0,0 +1,56 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// PermittedCommands returns the set of command codes that the supplied policy can be used to
+// authorize for the specified algorithm, in ascending order. This is useful for checking that
+// an object will permit the admin or duplication role actions that are intended, as these
+// require a policy that contains a matching TPM2_PolicyCommandCode or
+// TPM2_PolicyDuplicationSelect assertion. If the specified algorithm is
+// [tpm2.HashAlgorithmNull], then the first algorithm the policy is computed for is used.
+//
+// The result is the union of the command codes of every valid branch. If any valid branch is
+// not constrained to a single command, the result will contain [tpm2.AnyCommandCode]. Branches
+// that can never be satisfied because they contain conflicting assertions are ignored. The
+// contents of authorized policies are not known, so a branch that contains a
+// TPM2_PolicyAuthorize assertion but no TPM2_PolicyCommandCode assertion is treated as
+// unconstrained.
+func PermittedCommands(policy *Policy, alg tpm2.HashAlgorithmId) ([]tpm2.CommandCode, error) {
+	if policy == nil {
+		return nil, errors.New("no policy")
+	}
+
+	details, err := policy.Details(alg, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain policy details: %w", err)
+	}
+
+	codes := make(map[tpm2.CommandCode]struct{})
+	for _, branch := range details {
+		if !branch.IsValid() {
+			continue
+		}
+		code, set := branch.CommandCode()
+		if !set {
+			code = tpm2.AnyCommandCode
+		}
+		codes[code] = struct{}{}
+	}
+
+	var out []tpm2.CommandCode
+	for code := range codes {
+		out = append(out, code)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
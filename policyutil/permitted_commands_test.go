@@ -0,0 +1,134 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+)
+
+type permittedCommandsSuite struct{}
+
+var _ = Suite(&permittedCommandsSuite{})
+
+func (s *permittedCommandsSuite) TestSingleCommand(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	codes, err := PermittedCommands(policy, tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(codes, DeepEquals, []tpm2.CommandCode{tpm2.CommandUnseal})
+}
+
+func (s *permittedCommandsSuite) TestUnconstrained(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	codes, err := PermittedCommands(policy, tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(codes, DeepEquals, []tpm2.CommandCode{tpm2.AnyCommandCode})
+}
+
+func (s *permittedCommandsSuite) TestBranches(c *C) {
+	object := tpm2.Name(append([]byte{0x00, 0x0b}, make([]byte, 32)...))
+	newParent := tpm2.Name(append([]byte{0x00, 0x0b}, make([]byte, 32)...))
+	newParent[2] = 0x01
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+
+	admin := node.AddBranch("admin")
+	admin.PolicyAuthValue()
+	adminNode := admin.AddBranchNode()
+	adminNode.AddBranch("changeauth").PolicyCommandCode(tpm2.CommandObjectChangeAuth)
+	adminNode.AddBranch("certify").PolicyCommandCode(tpm2.CommandCertify)
+
+	node.AddBranch("duplicate").PolicyDuplicationSelect(object, newParent, true)
+
+	unseal := node.AddBranch("unseal")
+	unseal.PolicyCommandCode(tpm2.CommandUnseal)
+	unseal.PolicyAuthValue()
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	codes, err := PermittedCommands(policy, tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(codes, DeepEquals, []tpm2.CommandCode{
+		tpm2.CommandCertify,
+		tpm2.CommandDuplicate,
+		tpm2.CommandObjectChangeAuth,
+		tpm2.CommandUnseal})
+}
+
+func (s *permittedCommandsSuite) TestBranchesWithUnconstrainedBranch(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+	node.AddBranch("admin").PolicyCommandCode(tpm2.CommandObjectChangeAuth)
+	node.AddBranch("user").PolicyAuthValue()
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	codes, err := PermittedCommands(policy, tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(codes, DeepEquals, []tpm2.CommandCode{tpm2.CommandObjectChangeAuth, tpm2.AnyCommandCode})
+}
+
+func (s *permittedCommandsSuite) TestIgnoresInvalidBranches(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+	node.AddBranch("unseal").PolicyCommandCode(tpm2.CommandUnseal)
+
+	invalid := node.AddBranch("invalid")
+	invalid.PolicyCommandCode(tpm2.CommandObjectChangeAuth)
+	invalid.PolicyCommandCode(tpm2.CommandCertify)
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	codes, err := PermittedCommands(policy, tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(codes, DeepEquals, []tpm2.CommandCode{tpm2.CommandUnseal})
+}
+
+func (s *permittedCommandsSuite) TestAuthorize(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+	node.AddBranch("signed").PolicyAuthorize(nil, authKey)
+
+	unseal := node.AddBranch("signed-unseal")
+	unseal.PolicyAuthorize(nil, authKey)
+	unseal.PolicyCommandCode(tpm2.CommandUnseal)
+
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	codes, err := PermittedCommands(policy, tpm2.HashAlgorithmSHA256)
+	c.Check(err, IsNil)
+	c.Check(codes, DeepEquals, []tpm2.CommandCode{tpm2.CommandUnseal, tpm2.AnyCommandCode})
+}
+
+func (s *permittedCommandsSuite) TestNoPolicy(c *C) {
+	_, err := PermittedCommands(nil, tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `no policy`)
+}
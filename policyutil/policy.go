@@ -9,10 +9,15 @@ import (
 	"crypto"
 	"errors"
 	"fmt"
+	"hash"
 	"hash/fnv"
 	"io"
+	"math"
 	"reflect"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"unicode/utf8"
 
 	"github.com/canonical/go-tpm2"
@@ -160,6 +165,23 @@ func (e *PolicyAuthorizationError) Unwrap() error {
 	return e.err
 }
 
+// PolicyStepDigestMismatchError is returned wrapped in [PolicyError] from [Policy.Execute]
+// if [PolicyExecuteParams.VerifyEachStep] is set and the digest of the policy session
+// after executing an element of the policy doesn't match the digest computed offline.
+// This indicates a TPM bug, an incorrect parameter or tampering.
+type PolicyStepDigestMismatchError struct {
+	Path     string      // the path of the branch containing the element
+	Index    int         // the index of the element within the branch
+	Expected tpm2.Digest // the digest computed offline
+	Actual   tpm2.Digest // the digest of the policy session
+
+	task string
+}
+
+func (e *PolicyStepDigestMismatchError) Error() string {
+	return fmt.Sprintf("session digest %#x after %s at index %d doesn't match the expected digest %#x", e.Actual, e.task, e.Index, e.Expected)
+}
+
 // ResourceLoadError is returned from [Policy.Execute] if the policy uses TPM2_PolicySecret
 // and the associated resource could not be loaded. If loading the resource required
 // authorization with a policy session and that failed, this will wrap another *[PolicyError].
@@ -312,6 +334,15 @@ func (h *taggedHash) Unmarshal(r io.Reader) error {
 
 type taggedHashList []taggedHash
 
+func (l taggedHashList) digest(alg tpm2.HashAlgorithmId) (tpm2.Digest, bool) {
+	for _, digest := range l {
+		if digest.HashAlg == alg {
+			return digest.Digest, true
+		}
+	}
+	return nil, false
+}
+
 type policyNVElement struct {
 	NvIndex   *tpm2.NVPublic
 	OperandB  tpm2.Operand
@@ -497,6 +528,7 @@ func (e *policySignedElement) run(runner policyRunner) error {
 	if err != nil {
 		return &PolicyAuthorizationError{AuthName: authKeyName, PolicyRef: e.PolicyRef, err: err}
 	}
+	runner.resources().signedAuthorizationTimeout(authKeyName, e.PolicyRef, auth, timeout)
 
 	runner.tickets().addTicket(&PolicyTicket{
 		AuthName:  authKeyName,
@@ -641,6 +673,16 @@ func (e *policyNameHashElement) run(runner policyRunner) error {
 	return runner.session().PolicyNameHash(e.Digest)
 }
 
+type policyParametersElement struct {
+	Digest tpm2.Digest
+}
+
+func (*policyParametersElement) name() string { return "TPM2_PolicyParameters assertion" }
+
+func (e *policyParametersElement) run(runner policyRunner) error {
+	return runner.session().PolicyParameters(e.Digest)
+}
+
 type policyBranch struct {
 	Name          policyBranchName
 	PolicyDigests taggedHashList
@@ -717,7 +759,7 @@ func (e *policyORElement) run(runner policyRunner) error {
 		}
 	}
 
-	tree, err := newPolicyOrTree(runner.session().HashAlg(), digests)
+	tree, err := newPolicyOrTree(runner.session().HashAlg(), policySessionHashConstructor(runner.session()), digests)
 	if err != nil {
 		return fmt.Errorf("cannot compute PolicyOR tree: %w", err)
 	}
@@ -759,7 +801,11 @@ func (e *policyPCRElement) run(runner policyRunner) error {
 	if err != nil {
 		return err
 	}
-	pcrs, pcrDigest, err := ComputePCRDigestFromAllValues(runner.session().HashAlg(), values)
+	newHash := policySessionHashConstructor(runner.session())
+	if newHash == nil {
+		return errors.New("cannot compute PCR digest: algorithm is not available")
+	}
+	pcrs, pcrDigest, err := computePCRDigestFromAllValues(newHash, values)
 	if err != nil {
 		return fmt.Errorf("cannot compute PCR digest: %w", err)
 	}
@@ -800,9 +846,24 @@ type policyPasswordElement struct{}
 func (*policyPasswordElement) name() string { return "TPM2_PolicyPassword assertion" }
 
 func (*policyPasswordElement) run(runner policyRunner) error {
+	if r, ok := runner.(interface{ sessionUsesParameterEncryption() bool }); ok && r.sessionUsesParameterEncryption() {
+		// TPM2_PolicyPassword and TPM2_PolicyAuthValue have the same digest. If the
+		// session is used for parameter encryption, it needs a HMAC key that includes
+		// the auth value rather than sending the auth value in the clear, so use
+		// TPM2_PolicyAuthValue instead.
+		return runner.session().PolicyAuthValue()
+	}
 	return runner.session().PolicyPassword()
 }
 
+type policyPhysicalPresenceElement struct{}
+
+func (*policyPhysicalPresenceElement) name() string { return "TPM2_PolicyPhysicalPresence assertion" }
+
+func (*policyPhysicalPresenceElement) run(runner policyRunner) error {
+	return policyPhysicalPresence(runner.session())
+}
+
 type policyNvWrittenElement struct {
 	WrittenSet bool
 }
@@ -813,6 +874,66 @@ func (e *policyNvWrittenElement) run(runner policyRunner) error {
 	return runner.session().PolicyNvWritten(e.WrittenSet)
 }
 
+// policyOpaqueElement retains the serialized details of a policy element with a type that
+// isn't supported by this package, so that a policy created by a newer version can be
+// unmarshalled and marshalled again without losing these elements. The details of element
+// types that aren't supported are serialized with a 32-bit size field.
+type policyOpaqueElement struct {
+	Data []byte
+}
+
+func (e policyOpaqueElement) Marshal(w io.Writer) error {
+	if int64(len(e.Data)) > math.MaxUint32 {
+		return errors.New("data too large")
+	}
+	_, err := mu.MarshalToWriter(w, uint32(len(e.Data)), mu.RawBytes(e.Data))
+	return err
+}
+
+func (e *policyOpaqueElement) Unmarshal(r io.Reader) error {
+	var size uint32
+	if _, err := mu.UnmarshalFromReader(r, &size); err != nil {
+		return err
+	}
+
+	// Copy the data rather than allocating it based on the size field, so that a
+	// bogus size doesn't result in a large allocation.
+	buf := new(bytes.Buffer)
+	if _, err := io.CopyN(buf, r, int64(size)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	e.Data = buf.Bytes()
+	return nil
+}
+
+// policyUnsupportedElement is the runner for a policy element with a type that
+// isn't supported by this package.
+type policyUnsupportedElement struct {
+	typ tpm2.CommandCode
+}
+
+func (e *policyUnsupportedElement) name() string {
+	return fmt.Sprintf("unsupported element (type %v)", e.typ)
+}
+
+// policyUnsupportedElementSession is implemented by sessions that don't need to
+// execute each element, so that policies containing unsupported elements can still be
+// walked, inspected and printed. Sessions that don't implement this fail when they
+// encounter an unsupported element.
+type policyUnsupportedElementSession interface {
+	unsupportedElement(typ tpm2.CommandCode) error
+}
+
+func (e *policyUnsupportedElement) run(runner policyRunner) error {
+	if session, ok := runner.session().(policyUnsupportedElementSession); ok {
+		return session.unsupportedElement(e.typ)
+	}
+	return fmt.Errorf("unsupported policy element with type %v", e.typ)
+}
+
 type policyElementDetails struct {
 	NV                *policyNVElement
 	Secret            *policySecretElement
@@ -828,8 +949,12 @@ type policyElementDetails struct {
 	DuplicationSelect *policyDuplicationSelectElement
 	Password          *policyPasswordElement
 	NvWritten         *policyNvWrittenElement
+	Parameters        *policyParametersElement
+	PhysicalPresence  *policyPhysicalPresenceElement
 
 	RawOR *policyRawORElement
+
+	Opaque *policyOpaqueElement
 }
 
 func (d *policyElementDetails) Select(selector reflect.Value) interface{} {
@@ -862,10 +987,14 @@ func (d *policyElementDetails) Select(selector reflect.Value) interface{} {
 		return &d.Password
 	case tpm2.CommandPolicyNvWritten:
 		return &d.NvWritten
+	case tpm2.CommandPolicyParameters:
+		return &d.Parameters
+	case tpm2.CommandPolicyPhysicalPresence:
+		return &d.PhysicalPresence
 	case commandRawPolicyOR:
 		return &d.RawOR
 	default:
-		return nil
+		return &d.Opaque
 	}
 }
 
@@ -909,15 +1038,30 @@ func (e *policyElement) runner() policyElementRunner {
 		return e.Details.Password
 	case tpm2.CommandPolicyNvWritten:
 		return e.Details.NvWritten
+	case tpm2.CommandPolicyParameters:
+		return e.Details.Parameters
+	case tpm2.CommandPolicyPhysicalPresence:
+		return e.Details.PhysicalPresence
 	case commandRawPolicyOR:
 		return e.Details.RawOR
 	default:
-		panic("invalid type")
+		return &policyUnsupportedElement{typ: e.Type}
 	}
 }
 
 type policyElements []*policyElement
 
+// hasUnsupported indicates whether any of these elements has a type that isn't
+// supported by this package. Elements in sub-branches aren't checked.
+func (e policyElements) hasUnsupported() bool {
+	for _, element := range e {
+		if _, unsupported := element.runner().(*policyUnsupportedElement); unsupported {
+			return true
+		}
+	}
+	return false
+}
+
 type policy struct {
 	PolicyDigests        taggedHashList
 	PolicyAuthorizations policyAuthorizations
@@ -926,27 +1070,59 @@ type policy struct {
 
 // Policy corresponds to an authorization policy. It can be serialized with
 // [github.com/canonical/go-tpm2/mu].
+//
+// The serialized form is versioned, and a policy with an unrecognized version can not be
+// unmarshalled. The details of element types that aren't supported by this package are
+// serialized with a 32-bit size field, so that these elements can be retained as opaque data
+// when a policy created by a newer version is unmarshalled. They are marshalled again
+// unmodified, so a policy can be round-tripped through this version without being corrupted.
+// The stored digests of branches that contain these elements are used when computing the
+// digest of a policy, but an error is returned if an attempt is made to compute a digest that
+// isn't stored for one of these branches, or to execute one of these branches.
 type Policy struct {
 	policy policy
+	compat PolicyBuilderCompat
 }
 
 // Marshal implements [mu.CustomMarshaller.Marshal].
 func (p Policy) Marshal(w io.Writer) error {
-	_, err := mu.MarshalToWriter(w, uint32(0), p.policy)
+	if p.compat.isZero() {
+		// Policies without any compatibility options are serialized in
+		// the original format so that they remain readable by older
+		// versions of this package.
+		_, err := mu.MarshalToWriter(w, uint32(0), p.policy)
+		return err
+	}
+	// Version 1 is used by the detached digests format.
+	_, err := mu.MarshalToWriter(w, uint32(2), p.compat, p.policy)
 	return err
 }
 
 // Unmarshal implements [mu.CustomMarshaller.Unarshal].
 func (p *Policy) Unmarshal(r io.Reader) error {
+	// Check the version before decoding the rest of the policy, which
+	// may be in a different format.
 	var version uint32
-	_, err := mu.UnmarshalFromReader(r, &version, &p.policy)
-	if err != nil {
+	if _, err := mu.UnmarshalFromReader(r, &version); err != nil {
 		return err
 	}
-	if version != 0 {
+	switch version {
+	case 0:
+		p.compat = PolicyBuilderCompat{}
+		_, err := mu.UnmarshalFromReader(r, &p.policy)
+		return err
+	case 2:
+		_, err := mu.UnmarshalFromReader(r, &p.compat, &p.policy)
+		return err
+	default:
 		return errors.New("invalid version")
 	}
-	return nil
+}
+
+// Compat returns the compatibility options that were supplied to the
+// [PolicyBuilder] that created this policy.
+func (p *Policy) Compat() PolicyBuilderCompat {
+	return p.compat
 }
 
 type executePolicyTickets struct {
@@ -1071,12 +1247,18 @@ type policyExecuteRunner struct {
 	authorizer Authorizer
 	tpm        TPMHelper
 
-	usage                *PolicySessionUsage
-	ignoreAuthorizations []PolicyAuthorizationID
-	ignoreNV             []Named
+	usage                 *PolicySessionUsage
+	ignoreAuthorizations  []PolicyAuthorizationID
+	ignoreNV              []Named
+	preferNoAuthorize     bool
+	branchSelectionLogger PolicyBranchSelectionLogger
 
 	wildcardResolver *policyPathWildcardResolver
 
+	// verifier mirrors the assertions executed on the policy session if
+	// PolicyExecuteParams.VerifyEachStep is set.
+	verifier *verifyPolicySession
+
 	remaining   policyBranchPath
 	currentPath policyBranchPath
 }
@@ -1088,15 +1270,17 @@ func newPolicyExecuteRunner(session PolicySession, tickets *executePolicyTickets
 			session,
 			newRecorderPolicySession(session.HashAlg(), details),
 		),
-		policyTickets:        tickets,
-		policyResources:      resources,
-		authorizer:           authorizer,
-		tpm:                  tpm,
-		usage:                params.Usage,
-		ignoreAuthorizations: params.IgnoreAuthorizations,
-		ignoreNV:             params.IgnoreNV,
-		wildcardResolver:     newPolicyPathWildcardResolver(session.HashAlg(), resources, tpm, params.Usage, params.IgnoreAuthorizations, params.IgnoreNV),
-		remaining:            policyBranchPath(params.Path),
+		policyTickets:         tickets,
+		policyResources:       resources,
+		authorizer:            authorizer,
+		tpm:                   tpm,
+		usage:                 params.Usage,
+		ignoreAuthorizations:  params.IgnoreAuthorizations,
+		ignoreNV:              params.IgnoreNV,
+		preferNoAuthorize:     params.PreferPathsWithoutAuthorize,
+		branchSelectionLogger: params.BranchSelectionLogger,
+		wildcardResolver:      newPolicyPathWildcardResolver(session.HashAlg(), resources, tpm, params.Usage, params.IgnoreAuthorizations, params.IgnoreNV, params.PreferPathsWithoutAuthorize, params.BranchSelectionLogger),
+		remaining:             policyBranchPath(params.Path),
 	}
 }
 
@@ -1104,6 +1288,48 @@ func (r *policyExecuteRunner) session() policySession {
 	return r.policySession
 }
 
+// enableStepVerification causes the digest of the policy session to be checked
+// against a digest computed offline after each element is run.
+func (r *policyExecuteRunner) enableStepVerification(minPcrSelectSize uint8) error {
+	digest, err := r.policySession.PolicyGetDigest()
+	if err != nil {
+		return fmt.Errorf("cannot obtain initial session digest: %w", err)
+	}
+	r.verifier = newVerifyPolicySession(r.policySession.HashAlg(), digest, minPcrSelectSize)
+	r.policySession.outputs = append(r.policySession.outputs, r.verifier)
+	return nil
+}
+
+func (r *policyExecuteRunner) verifyStep(path policyBranchPath, index int, task string) error {
+	actual, err := r.policySession.PolicyGetDigest()
+	if err != nil {
+		return fmt.Errorf("cannot obtain session digest: %w", err)
+	}
+	expected, err := r.verifier.PolicyGetDigest()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(actual, expected) {
+		return &PolicyStepDigestMismatchError{
+			Path:     string(path),
+			Index:    index,
+			Expected: expected,
+			Actual:   actual,
+			task:     task,
+		}
+	}
+	return nil
+}
+
+// sessionUsesParameterEncryption indicates whether the policy session being executed
+// is configured for command or response parameter encryption.
+func (r *policyExecuteRunner) sessionUsesParameterEncryption() bool {
+	if r.policySessionContext == nil || r.policySessionContext.Session() == nil {
+		return false
+	}
+	return r.policySessionContext.Session().Attrs()&(tpm2.AttrCommandEncrypt|tpm2.AttrResponseEncrypt) != 0
+}
+
 func (r *policyExecuteRunner) tickets() policyTickets {
 	return r.policyTickets
 }
@@ -1119,9 +1345,18 @@ func (r *policyExecuteRunner) authResourceName() tpm2.Name {
 	return r.usage.handles[r.usage.authIndex].Name()
 }
 
+func (r *policyExecuteRunner) loadExternalObject(inPrivate *tpm2.Sensitive, inPublic *tpm2.Public, hierarchy tpm2.Handle) (ResourceContext, error) {
+	r.policyResources.usage.makeSpaceForTransient(1)
+	resource, err := r.tpm.LoadExternal(inPrivate, inPublic, hierarchy)
+	if err != nil {
+		return nil, err
+	}
+	return r.policyResources.usage.trackTransient(r.policyResources.resources, resource), nil
+}
+
 func (r *policyExecuteRunner) loadExternal(public *tpm2.Public) (ResourceContext, error) {
 	if public.IsAsymmetric() {
-		return r.tpm.LoadExternal(nil, public, tpm2.HandleOwner)
+		return r.loadExternalObject(nil, public, tpm2.HandleOwner)
 	}
 
 	if !public.Name().IsValid() {
@@ -1132,7 +1367,7 @@ func (r *policyExecuteRunner) loadExternal(public *tpm2.Public) (ResourceContext
 		return nil, fmt.Errorf("cannot obtain external sensitive area: %w", err)
 	}
 
-	return r.tpm.LoadExternal(sensitive, public, tpm2.HandleNull)
+	return r.loadExternalObject(sensitive, public, tpm2.HandleNull)
 }
 
 func (r *policyExecuteRunner) authorize(auth ResourceContext, askForPolicy bool, usage *PolicySessionUsage, prefer tpm2.SessionType) (sessionOut SessionContext, err error) {
@@ -1230,10 +1465,15 @@ func (r *policyExecuteRunner) authorize(auth ResourceContext, askForPolicy bool,
 		}
 	}()
 
+	if err := r.policyResources.usage.startSession(); err != nil {
+		return nil, fmt.Errorf("cannot create session to authorize auth object: %w", err)
+	}
 	session, policySession, err := r.tpm.StartAuthSession(sessionType, alg)
 	if err != nil {
+		r.policyResources.usage.sessions--
 		return nil, fmt.Errorf("cannot create session to authorize auth object: %w", err)
 	}
+	session = r.policyResources.usage.trackSession(session)
 	defer func() {
 		if err == nil {
 			return
@@ -1244,13 +1484,20 @@ func (r *policyExecuteRunner) authorize(auth ResourceContext, askForPolicy bool,
 	var authValueNeeded bool
 	if sessionType == tpm2.SessionTypePolicy {
 		params := &PolicyExecuteParams{
-			Usage:                usage,
-			IgnoreAuthorizations: r.ignoreAuthorizations,
-			IgnoreNV:             r.ignoreNV,
+			Usage:                       usage,
+			IgnoreAuthorizations:        r.ignoreAuthorizations,
+			IgnoreNV:                    r.ignoreNV,
+			PreferPathsWithoutAuthorize: r.preferNoAuthorize,
+			BranchSelectionLogger:       r.branchSelectionLogger,
 		}
 
 		var details PolicyBranchDetails
 		runner := newPolicyExecuteRunner(policySession, r.policyTickets, r.policyResources.forSession(session), r.authorizer, r.tpm, params, &details)
+		if r.verifier != nil {
+			if err := runner.enableStepVerification(policy.compat.MinPCRSelectSize); err != nil {
+				return nil, err
+			}
+		}
 		if err := runner.run(policy.policy.Policy); err != nil {
 			return nil, err
 		}
@@ -1312,7 +1559,7 @@ func (r *policyExecuteRunner) runAuthorizedPolicy(keySign *tpm2.Public, policyRe
 	auth := policy.authorization
 
 	// Verify the signature
-	authKey, err := r.tpm.LoadExternal(nil, keySign, tpm2.HandleOwner)
+	authKey, err := r.loadExternalObject(nil, keySign, tpm2.HandleOwner)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -1338,7 +1585,7 @@ func (r *policyExecuteRunner) selectBranch(branches policyBranches) (int, string
 	if len(next) == 0 || next[0] == '*' {
 		// There are no more components or the next component is a wildcard match - build a
 		// list of candidate paths for this subtree
-		path, err := r.wildcardResolver.resolve(branches)
+		path, err := r.wildcardResolver.resolve(r.currentPath, branches)
 		if err != nil {
 			return 0, "", fmt.Errorf("cannot automatically select branch: %w", err)
 		}
@@ -1378,12 +1625,18 @@ func (r *policyExecuteRunner) selectBranch(branches policyBranches) (int, string
 }
 
 func (r *policyExecuteRunner) run(elements policyElements) error {
-	for len(elements) > 0 {
-		element := elements[0].runner()
-		elements = elements[1:]
+	path := r.currentPath
+	for i, e := range elements {
+		element := e.runner()
 		if err := element.run(r); err != nil {
 			return makePolicyError(err, r.currentPath, element.name())
 		}
+		if r.verifier == nil {
+			continue
+		}
+		if err := r.verifyStep(path, i, element.name()); err != nil {
+			return makePolicyError(err, r.currentPath, element.name())
+		}
 	}
 
 	return nil
@@ -1397,6 +1650,13 @@ type PolicySessionUsage struct {
 	params      []interface{}
 	authIndex   uint8
 	noAuthValue bool
+	nvContents  []policySessionUsageNVContents
+}
+
+type policySessionUsageNVContents struct {
+	name   tpm2.Name
+	offset uint16
+	data   []byte
 }
 
 // NewPolicySessionUsage creates a new PolicySessionUsage. The returned usage
@@ -1414,6 +1674,52 @@ func NewPolicySessionUsage(command tpm2.CommandCode, handles []NamedHandle, para
 	}
 }
 
+// namedHandle adapts a [Named] to a [NamedHandle].
+type namedHandle struct {
+	Named
+}
+
+func (h namedHandle) Handle() tpm2.Handle {
+	name := h.Name()
+	if name.Type() != tpm2.NameTypeHandle {
+		return tpm2.HandleUnassigned
+	}
+	return name.Handle()
+}
+
+// UsageFromCommand creates a new PolicySessionUsage from the command code, handles and
+// parameters of a command that is about to be executed. The command parameter hash is
+// computed from the supplied arguments for the session algorithm when the policy is
+// executed, so that branches containing TPM2_PolicyCpHash assertions can be selected
+// automatically by comparing them against the actual command. The required parameters
+// are defined in part 3 of the TPM 2.0 Library Specification for the specific command,
+// in the same way as for [ComputeCpHash].
+//
+// If any of the supplied handles don't implement [NamedHandle], the handle is derived
+// from the name where this is possible (for permanent resources, sessions and PCRs),
+// otherwise it is [tpm2.HandleUnassigned], in which case paths containing
+// TPM2_PolicyNvWritten assertions can't be selected if the session authorizes that
+// handle.
+//
+// As with [NewPolicySessionUsage], the returned usage will assume that the session is
+// being used for authorization of the first handle.
+func UsageFromCommand(code tpm2.CommandCode, handles []Named, params ...interface{}) *PolicySessionUsage {
+	var namedHandles []NamedHandle
+	for _, handle := range handles {
+		switch h := handle.(type) {
+		case tpm2.Name:
+			// tpm2.Name implements NamedHandle, but Handle panics if
+			// the name isn't a handle.
+			namedHandles = append(namedHandles, namedHandle{Named: h})
+		case NamedHandle:
+			namedHandles = append(namedHandles, h)
+		default:
+			namedHandles = append(namedHandles, namedHandle{Named: h})
+		}
+	}
+	return NewPolicySessionUsage(code, namedHandles, params...)
+}
+
 // WithAuthIndex indicates that the policy session is being used for authorization
 // of the handle at the specified index (zero indexed). This is zero for most commands,
 // where most commands only have a single handle that requires authorization. There are
@@ -1436,6 +1742,21 @@ func (u *PolicySessionUsage) WithoutAuthValue() *PolicySessionUsage {
 	return u
 }
 
+// WithNVIndexContents indicates that the NV index with the specified name is known to
+// contain the supplied data at the specified offset. This is used when automatically
+// selecting branches, so that TPM2_PolicyNV assertions that reference the index can be
+// evaluated without having to read the index. It is useful where the index can't be read
+// without authorization, such as where it is the resource being authorized. It can be
+// called more than once to supply the contents of other indices or ranges.
+func (u *PolicySessionUsage) WithNVIndexContents(index Named, offset uint16, data []byte) *PolicySessionUsage {
+	u.nvContents = append(u.nvContents, policySessionUsageNVContents{
+		name:   index.Name(),
+		offset: offset,
+		data:   data,
+	})
+	return u
+}
+
 // CommandCode returns the command code for this usage.
 func (u PolicySessionUsage) CommandCode() tpm2.CommandCode {
 	return u.commandCode
@@ -1460,12 +1781,34 @@ func (u PolicySessionUsage) NameHash(alg tpm2.HashAlgorithmId) (tpm2.Digest, err
 	return ComputeNameHash(alg, handleNames...)
 }
 
+// ParametersHash returns the command parameter hash without the command handles for
+// this usage for the specified session algorithm.
+func (u PolicySessionUsage) ParametersHash(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
+	return ComputeParametersHash(alg, u.commandCode, u.params...)
+}
+
 // AllowAuthValue indicates whether this usage permits use of the auth value for the
 // resource being authorized.
 func (u PolicySessionUsage) AllowAuthValue() bool {
 	return !u.noAuthValue
 }
 
+// NVIndexContents returns the known contents of the specified range of the NV index
+// with the specified name, if they were supplied via [PolicySessionUsage.WithNVIndexContents].
+func (u PolicySessionUsage) NVIndexContents(name tpm2.Name, offset, size uint16) (data []byte, ok bool) {
+	for _, contents := range u.nvContents {
+		if !bytes.Equal(contents.name, name) {
+			continue
+		}
+		if offset < contents.offset || int(offset)+int(size) > int(contents.offset)+len(contents.data) {
+			continue
+		}
+		start := int(offset - contents.offset)
+		return contents.data[start : start+int(size)], true
+	}
+	return nil, false
+}
+
 // AuthHandle returns the handle for the resource being authorized.
 func (u PolicySessionUsage) AuthHandle() NamedHandle {
 	return u.handles[u.authIndex]
@@ -1529,9 +1872,114 @@ type PolicyExecuteParams struct {
 	// these assertions have failed due to an authorization issue on previous runs. This
 	// propagates to sub-policies.
 	IgnoreNV []Named
-}
 
-// PolicyExecuteResult is returned from [Policy.Execute].
+	// PreferPathsWithoutAuthorize indicates that when a path is selected automatically,
+	// paths without TPM2_PolicyAuthorize assertions should be preferred. This is useful
+	// for policies where TPM2_PolicyAuthorize is used for a recovery path that should
+	// only be selected if no other path is suitable. This propagates to sub-policies.
+	PreferPathsWithoutAuthorize bool
+
+	// LimitResourceUsage indicates that Policy.Execute should limit the number of
+	// transient objects and sessions that it loads concurrently, based on the
+	// TPM_PT_HR_TRANSIENT_MIN and TPM_PT_ACTIVE_SESSIONS_MAX properties. When loading a
+	// new transient object would exceed the limit, the least recently used transient
+	// object is saved and flushed, and then reloaded again when it is next used. The
+	// limits are read using the TPMHelper supplied to Policy.Execute, and are only
+	// applied if it implements the optional TPMPropertyReader interface.
+	LimitResourceUsage bool
+
+	// FailOnSessionLimit indicates that Policy.Execute should return an error rather
+	// than start a new session when LimitResourceUsage is set and the number of
+	// sessions has reached the TPM_PT_ACTIVE_SESSIONS_MAX limit.
+	FailOnSessionLimit bool
+
+	// PreloadResources indicates that Policy.Execute should load the resources that are
+	// required by the selected path before any policy commands are issued, so that loads
+	// aren't interleaved with policy commands and so that execution fails early if a
+	// resource can't be loaded. If the path doesn't select a single branch, only those
+	// resources that are required by every candidate branch are preloaded. Preloaded
+	// resources are reused by the assertions that require them, and are flushed before
+	// Policy.Execute returns.
+	PreloadResources bool
+
+	// SignedAuthorizationRand is the source of randomness used to sign authorizations for
+	// TPM2_PolicySigned assertions. It is passed to the supplied PolicyResources if it
+	// implements the optional RandSignedAuthorizer interface, and is otherwise ignored. If
+	// not supplied, the PolicyResources implementation uses its own source of randomness,
+	// which is normally crypto/rand.
+	//
+	// This is the only randomness consumed by Policy.Execute itself. Caller nonces and
+	// salts for sessions are generated by the associated tpm2.TPMContext, and the source
+	// of randomness for these can be changed with tpm2.TPMContext.SetRandReader.
+	SignedAuthorizationRand io.Reader
+
+	// CheckSignedAuthorizationNonces indicates that Policy.Execute should check that
+	// signed authorizations for TPM2_PolicySigned assertions that are bound to a session
+	// are bound to the session that the policy is being executed in, before using them.
+	// An authorization that is bound to a different session is rejected with an error
+	// without being submitted to the TPM. This catches the accidental reuse of a stale
+	// authorization. Authorizations that aren't bound to a session are not affected.
+	CheckSignedAuthorizationNonces bool
+
+	// ResourceResolver provides a way to choose the concrete resource that is used
+	// for an assertion at execution time. If supplied, it is called with the name of
+	// each resource that the policy requires before that resource is loaded. If it
+	// returns true, the returned name is passed to PolicyResources.LoadedResource
+	// instead of the name referenced by the policy. The returned resource must still
+	// have the name referenced by the policy, else an error is returned. Loaded
+	// resources are cached for the duration of Policy.Execute, so this is only called
+	// once for each resource that needs to be loaded.
+	ResourceResolver func(name tpm2.Name) (tpm2.Name, bool)
+
+	// ResourcesCache can be used to persist the non-secret parts of the resource
+	// cache between executions. If supplied, Policy.Execute starts with the entries
+	// in the cache, and replaces the contents of the cache with its own cache on
+	// return. It must not be supplied to executions that run concurrently. See the
+	// documentation for PolicyResourcesCache.
+	ResourcesCache *PolicyResourcesCache
+
+	// VerifyEachStep indicates that Policy.Execute should check the digest of the
+	// policy session with TPM2_PolicyGetDigest after executing each element of the
+	// policy, and compare it with a digest computed offline from the same sequence of
+	// assertions. Execution is aborted on the first mismatch with a
+	// *PolicyStepDigestMismatchError, which identifies the element and contains both
+	// digests. This is intended for high-assurance use, and is disabled by default
+	// because it requires an additional TPM command for each element. This propagates
+	// to sub-policies.
+	VerifyEachStep bool
+
+	// BranchSelectionLogger, if supplied, receives a record each time that a path is
+	// selected automatically at a branch node or authorized policy. This propagates to
+	// sub-policies. Supplying this doesn't result in any additional TPM commands.
+	BranchSelectionLogger PolicyBranchSelectionLogger
+
+	// AuditSession, if supplied, is attached as an additional session to every
+	// command that is issued to the policy session during execution, so that the
+	// execution of the policy can be attested to later on with
+	// TPM2_GetSessionAuditDigest. It should be a HMAC session with the
+	// AttrAudit and AttrContinueSession attributes set. It doesn't affect the
+	// policy session's digest. This is only supported for policy sessions created
+	// with NewTPMPolicySession.
+	//
+	// Only commands issued to the policy session are audited. Other commands that
+	// are executed via the supplied TPMHelper and PolicyResources, such as those
+	// used to load and authorize resources, start other sessions, or verify
+	// signatures for TPM2_PolicyAuthorize assertions, are not included in the
+	// audit digest. Attach the audit session to these by supplying it to
+	// NewTPMHelper and NewTPMPolicyResources if this is required.
+	AuditSession tpm2.SessionContext
+
+	// Result, if supplied, receives a copy of the result of executing the policy on
+	// success. This is intended for use with [WithPolicySession], which doesn't
+	// otherwise return the result.
+	Result *PolicyExecuteResult
+}
+
+// PolicyExecuteResult is returned from [Policy.Execute]. It can be serialized with
+// [github.com/canonical/go-tpm2/mu] so that it can be logged or passed to another
+// process. Tickets that are unmarshalled from the serialized form can be supplied
+// to [Policy.Execute] again via [PolicyExecuteParams]. Tickets don't contain any
+// secret values, so the serialized form doesn't either.
 type PolicyExecuteResult struct {
 	// NewTickets contains tickets that were created as a result of executing this policy.
 	NewTickets []*PolicyTicket
@@ -1545,13 +1993,31 @@ type PolicyExecuteResult struct {
 	// TPM2_PolicyPassword assertion.
 	AuthValueNeeded bool
 
+	// PhysicalPresenceNeeded indicates that the policy executed the
+	// TPM2_PolicyPhysicalPresence assertion. Physical presence must be asserted on the
+	// platform when the session is used, else the command that uses it will fail with
+	// a *[tpm2.TPMSessionError] with an error code of [tpm2.ErrorPP].
+	PhysicalPresenceNeeded bool
+
 	// Path indicates the executed path.
 	Path string
 
-	policyCommandCode *tpm2.CommandCode
-	policyCpHash      tpm2.Digest
-	policyNameHash    tpm2.Digest
-	policyNvWritten   *bool
+	// PeakTransientHandles indicates the maximum number of transient objects that
+	// were loaded concurrently whilst executing this policy. This doesn't include
+	// objects loaded by the supplied PolicyResources in order to load other objects.
+	PeakTransientHandles int
+
+	// PeakSessions indicates the maximum number of sessions that were loaded
+	// concurrently whilst executing this policy, including the session that the
+	// policy was executed in. This doesn't include sessions started by the supplied
+	// PolicyResources in order to load objects.
+	PeakSessions int
+
+	policyCommandCode    *tpm2.CommandCode
+	policyCpHash         tpm2.Digest
+	policyNameHash       tpm2.Digest
+	policyNvWritten      *bool
+	policyParametersHash tpm2.Digest
 }
 
 // CommandCode returns the command code if a TPM2_PolicyCommandCode or
@@ -1591,6 +2057,186 @@ func (r *PolicyExecuteResult) NvWritten() (nvWrittenSet bool, set bool) {
 	return *r.policyNvWritten, true
 }
 
+// ParametersHash returns the command parameter hash if a TPM2_PolicyParameters
+// assertion was executed.
+func (r *PolicyExecuteResult) ParametersHash() (pHash tpm2.Digest, set bool) {
+	if len(r.policyParametersHash) == 0 {
+		return nil, false
+	}
+	return r.policyParametersHash, true
+}
+
+type policyExecuteResultTicket struct {
+	AuthName  tpm2.Name
+	PolicyRef tpm2.Nonce
+	CpHash    tpm2.Digest
+	Timeout   tpm2.Timeout
+	Ticket    tpm2.TkAuth
+}
+
+type policyExecuteResultTickets []policyExecuteResultTicket
+
+func newPolicyExecuteResultTickets(tickets []*PolicyTicket) (policyExecuteResultTickets, error) {
+	var out policyExecuteResultTickets
+	for i, ticket := range tickets {
+		if ticket == nil || ticket.Ticket == nil {
+			return nil, fmt.Errorf("missing ticket at index %d", i)
+		}
+		out = append(out, policyExecuteResultTicket{
+			AuthName:  ticket.AuthName,
+			PolicyRef: ticket.PolicyRef,
+			CpHash:    ticket.CpHash,
+			Timeout:   ticket.Timeout,
+			Ticket:    *ticket.Ticket})
+	}
+	return out, nil
+}
+
+func (t policyExecuteResultTickets) tickets() ([]*PolicyTicket, error) {
+	var out []*PolicyTicket
+	for i, ticket := range t {
+		switch ticket.Ticket.Tag {
+		case tpm2.TagAuthSecret, tpm2.TagAuthSigned:
+		default:
+			return nil, fmt.Errorf("invalid ticket tag %#x at index %d", ticket.Ticket.Tag, i)
+		}
+		tk := ticket.Ticket
+		out = append(out, &PolicyTicket{
+			AuthName:  ticket.AuthName,
+			PolicyRef: ticket.PolicyRef,
+			CpHash:    ticket.CpHash,
+			Timeout:   ticket.Timeout,
+			Ticket:    &tk})
+	}
+	return out, nil
+}
+
+type policyExecuteResultData struct {
+	NewTickets             policyExecuteResultTickets
+	InvalidTickets         policyExecuteResultTickets
+	AuthValueNeeded        bool
+	PhysicalPresenceNeeded bool
+	Path                   []byte
+	PeakTransientHandles   uint32
+	PeakSessions           uint32
+
+	CommandCodeSet bool
+	CommandCode    tpm2.CommandCode
+	CpHash         tpm2.Digest
+	NameHash       tpm2.Digest
+	NvWrittenSet   bool
+	NvWritten      bool
+	ParametersHash tpm2.Digest
+}
+
+// Marshal implements [mu.CustomMarshaller.Marshal].
+func (r PolicyExecuteResult) Marshal(w io.Writer) error {
+	newTickets, err := newPolicyExecuteResultTickets(r.NewTickets)
+	if err != nil {
+		return fmt.Errorf("cannot process new tickets: %w", err)
+	}
+	invalidTickets, err := newPolicyExecuteResultTickets(r.InvalidTickets)
+	if err != nil {
+		return fmt.Errorf("cannot process invalid tickets: %w", err)
+	}
+
+	data := policyExecuteResultData{
+		NewTickets:             newTickets,
+		InvalidTickets:         invalidTickets,
+		AuthValueNeeded:        r.AuthValueNeeded,
+		PhysicalPresenceNeeded: r.PhysicalPresenceNeeded,
+		Path:                   []byte(r.Path),
+		PeakTransientHandles:   uint32(r.PeakTransientHandles),
+		PeakSessions:           uint32(r.PeakSessions),
+		CpHash:                 r.policyCpHash,
+		NameHash:               r.policyNameHash,
+		ParametersHash:         r.policyParametersHash}
+	if r.policyCommandCode != nil {
+		data.CommandCodeSet = true
+		data.CommandCode = *r.policyCommandCode
+	}
+	if r.policyNvWritten != nil {
+		data.NvWrittenSet = true
+		data.NvWritten = *r.policyNvWritten
+	}
+
+	_, err = mu.MarshalToWriter(w, uint32(0), data)
+	return err
+}
+
+// Unmarshal implements [mu.CustomMarshaller.Unarshal].
+func (r *PolicyExecuteResult) Unmarshal(rd io.Reader) error {
+	var version uint32
+	if _, err := mu.UnmarshalFromReader(rd, &version); err != nil {
+		return err
+	}
+	if version != 0 {
+		return errors.New("invalid version")
+	}
+
+	var data policyExecuteResultData
+	if _, err := mu.UnmarshalFromReader(rd, &data); err != nil {
+		return err
+	}
+
+	if !utf8.Valid(data.Path) {
+		return errors.New("invalid path")
+	}
+	newTickets, err := data.NewTickets.tickets()
+	if err != nil {
+		return fmt.Errorf("invalid tickets in NewTickets: %w", err)
+	}
+	invalidTickets, err := data.InvalidTickets.tickets()
+	if err != nil {
+		return fmt.Errorf("invalid tickets in InvalidTickets: %w", err)
+	}
+
+	*r = PolicyExecuteResult{
+		NewTickets:             newTickets,
+		InvalidTickets:         invalidTickets,
+		AuthValueNeeded:        data.AuthValueNeeded,
+		PhysicalPresenceNeeded: data.PhysicalPresenceNeeded,
+		Path:                   string(data.Path),
+		PeakTransientHandles:   int(data.PeakTransientHandles),
+		PeakSessions:           int(data.PeakSessions),
+		policyCpHash:           data.CpHash,
+		policyNameHash:         data.NameHash,
+		policyParametersHash:   data.ParametersHash}
+	if data.CommandCodeSet {
+		code := data.CommandCode
+		r.policyCommandCode = &code
+	}
+	if data.NvWrittenSet {
+		nvWritten := data.NvWritten
+		r.policyNvWritten = &nvWritten
+	}
+	return nil
+}
+
+// checkSessionAlg checks that this policy can be executed with a session with the
+// specified algorithm. A policy that contains branch nodes can only be executed if
+// it has digests for the session algorithm, as the TPM2_PolicyOR assertions depend
+// on the digests of every branch. On failure, a *PolicyError is returned for the
+// supplied path.
+func (p *Policy) checkSessionAlg(alg tpm2.HashAlgorithmId, path string) error {
+	var algs []tpm2.HashAlgorithmId
+	for _, digest := range p.policy.PolicyDigests {
+		if digest.HashAlg == alg {
+			return nil
+		}
+		algs = append(algs, digest.HashAlg)
+	}
+
+	for _, element := range p.policy.Policy {
+		if element.Type == tpm2.CommandPolicyOR {
+			err := fmt.Errorf("policy has no digests for session algorithm %v (available algorithms: %v): %w", alg, algs, ErrMissingDigest)
+			return makePolicyError(err, policyBranchPath(path), element.runner().name())
+		}
+	}
+
+	return nil
+}
+
 // Execute runs this policy using the supplied policy session.
 //
 // The caller may supply additional parameters via the PolicyExecuteParams struct, which is an
@@ -1620,10 +2266,12 @@ func (r *PolicyExecuteResult) NvWritten() (nvWrittenSet bool, set bool) {
 // or a component contains a wildcard match, an appropriate execution path is selected
 // automatically where possible. This works by selecting the first suitable path, with a
 // preference for paths that don't include TPM2_PolicySecret, TPM2_PolicySigned,
-// TPM2_PolicyAuthValue, and TPM2_PolicyPassword assertions. It also has a preference for paths
-// that don't include TPM2_PolicyNV assertions that require authorization to use or read, and for
-// paths without TPM2_PolicyCommandCode, TPM2_PolicyCpHash, TPM2_PolicyNameHash and
-// TPM2_PolicyDuplicatiionSelect assertions where no [PolicySessionUsage] is supplied. A path
+// TPM2_PolicyAuthValue, TPM2_PolicyPassword and TPM2_PolicyPhysicalPresence assertions, and
+// for paths that don't include TPM2_PolicyAuthorize assertions if the
+// PreferPathsWithoutAuthorize field of [PolicyExecuteParams] is set. It also has a preference
+// for paths that don't include TPM2_PolicyNV assertions that require authorization to use or
+// read, and for paths without TPM2_PolicyCommandCode, TPM2_PolicyCpHash, TPM2_PolicyNameHash
+// and TPM2_PolicyDuplicatiionSelect assertions where no [PolicySessionUsage] is supplied. A path
 // is omitted from the set of suitable paths if any of the following conditions are true:
 //   - It contains a command code, command parameter hash, or name hash that doesn't match
 //     the supplied [PolicySessionUsage].
@@ -1656,6 +2304,25 @@ func (r *PolicyExecuteResult) NvWritten() (nvWrittenSet bool, set bool) {
 //     succeed. Where these are known to not suceed, add the assertion details to the IgnoreNV
 //     field of [PolicyExecuteParams].
 //
+// If the supplied session has the [tpm2.AttrCommandEncrypt] or [tpm2.AttrResponseEncrypt]
+// attribute, TPM2_PolicyPassword assertions are executed with the TPM2_PolicyAuthValue command
+// instead, so that the auth value is included in the HMAC key rather than being sent in the clear.
+// Both commands produce the same policy digest.
+//
+// This function doesn't generate any random values itself. Caller nonces for the sessions that
+// it uses and starts, and salts for salted sessions, are generated by the [tpm2.TPMContext]
+// associated with the supplied session and TPMHelper, and the source of randomness for these
+// can be changed with [tpm2.TPMContext.SetRandReader]. Signed authorizations for
+// TPM2_PolicySigned assertions are created by the supplied PolicyResources, using the source of
+// randomness supplied via the SignedAuthorizationRand field of [PolicyExecuteParams] if it implements
+// [RandSignedAuthorizer].
+//
+// If the policy contains branch nodes and doesn't have a digest for the session's algorithm, an
+// *[PolicyError] that wraps [ErrMissingDigest] and identifies the algorithms that the policy does
+// have digests for is returned before any commands are executed. Policies without branch nodes are
+// still executed in this case, because every assertion is computed for the session's algorithm
+// as it is executed.
+//
 // On success, the supplied policy session may be used for authorization in a context that requires
 // that this policy is satisfied. Information about the result of executing the session is also
 // returned.
@@ -1673,28 +2340,72 @@ func (p *Policy) Execute(session PolicySession, resources PolicyResources, tpm T
 		params = new(PolicyExecuteParams)
 	}
 
+	if err := p.checkSessionAlg(session.HashAlg(), params.Path); err != nil {
+		return nil, err
+	}
+
+	if params.AuditSession != nil {
+		s, ok := session.(interface {
+			withAdditionalSessions(...tpm2.SessionContext) PolicySession
+		})
+		if !ok {
+			return nil, errors.New("AuditSession is only supported for sessions created with NewTPMPolicySession")
+		}
+		session = s.withAdditionalSessions(params.AuditSession)
+	}
+
 	tickets, err := newExecutePolicyTickets(session.HashAlg(), params.Tickets, params.Usage)
 	if err != nil {
 		return nil, err
 	}
 
+	usage := newResourceUsage(tpm, params.LimitResourceUsage, params.FailOnSessionLimit)
+	executeResources := newExecutePolicyResources(session.Context(), resources, tickets, params.IgnoreAuthorizations, params.IgnoreNV, usage)
+	executeResources.checkSignedAuthorizationNonces = params.CheckSignedAuthorizationNonces
+	executeResources.rand = params.SignedAuthorizationRand
+	executeResources.resourceResolver = params.ResourceResolver
+	if params.ResourcesCache != nil {
+		executeResources.tpm = tpm
+		params.ResourcesCache.importCache(executeResources)
+		defer params.ResourcesCache.exportCache(executeResources)
+	}
+	defer executeResources.flushPreloaded()
+
+	if params.PreloadResources {
+		names, err := p.requiredResources(session.HashAlg(), params.Path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine required resources: %w", err)
+		}
+		if err := executeResources.preload(names); err != nil {
+			return nil, fmt.Errorf("cannot preload resources: %w", err)
+		}
+	}
+
 	var details PolicyBranchDetails
 	runner := newPolicyExecuteRunner(
 		session,
 		tickets,
-		newExecutePolicyResources(session.Context(), resources, tickets, params.IgnoreAuthorizations, params.IgnoreNV),
+		executeResources,
 		resources,
 		tpm,
 		params,
 		&details,
 	)
+	if params.VerifyEachStep {
+		if err := runner.enableStepVerification(p.compat.MinPCRSelectSize); err != nil {
+			return nil, err
+		}
+	}
 	if err := runner.run(p.policy.Policy); err != nil {
 		return nil, err
 	}
 
 	result = &PolicyExecuteResult{
-		AuthValueNeeded: details.AuthValueNeeded,
-		Path:            string(runner.currentPath),
+		AuthValueNeeded:        details.AuthValueNeeded,
+		PhysicalPresenceNeeded: details.PhysicalPresenceNeeded,
+		Path:                   string(runner.currentPath),
+		PeakTransientHandles:   usage.peakTransient,
+		PeakSessions:           usage.peakSessions,
 	}
 	if commandCode, set := details.CommandCode(); set {
 		result.policyCommandCode = &commandCode
@@ -1708,6 +2419,9 @@ func (p *Policy) Execute(session PolicySession, resources PolicyResources, tpm T
 	if nvWritten, set := details.NvWritten(); set {
 		result.policyNvWritten = &nvWritten
 	}
+	if pHash, set := details.ParametersHash(); set {
+		result.policyParametersHash = pHash
+	}
 
 	for ticket := range tickets.newTickets {
 		result.NewTickets = append(result.NewTickets, ticket)
@@ -1716,9 +2430,96 @@ func (p *Policy) Execute(session PolicySession, resources PolicyResources, tpm T
 		result.InvalidTickets = append(result.InvalidTickets, ticket)
 	}
 
+	if params.Result != nil {
+		*params.Result = *result
+	}
+
 	return result, nil
 }
 
+// requiredResources returns the names of the resources that are loaded by TPM2_PolicySecret
+// assertions in every branch that matches the supplied path, excluding permanent resources.
+func (p *Policy) requiredResources(alg tpm2.HashAlgorithmId, path string) ([]tpm2.Name, error) {
+	details, err := p.Details(alg, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []tpm2.Name
+	first := true
+	for _, branch := range details {
+		found := make(map[nameMapKey]struct{})
+		var branchNames []tpm2.Name
+		for _, secret := range branch.Secret {
+			if secret.AuthName.Type() == tpm2.NameTypeHandle {
+				continue
+			}
+			key := makeNameMapKey(secret.AuthName)
+			if _, exists := found[key]; exists {
+				continue
+			}
+			found[key] = struct{}{}
+			branchNames = append(branchNames, secret.AuthName)
+		}
+
+		if first {
+			names = branchNames
+			first = false
+			continue
+		}
+
+		var common []tpm2.Name
+		for _, name := range names {
+			if _, exists := found[makeNameMapKey(name)]; exists {
+				common = append(common, name)
+			}
+		}
+		names = common
+	}
+
+	// Branch details are returned in a map, so sort the result for predictability.
+	sort.Slice(names, func(i, j int) bool {
+		return bytes.Compare(names[i], names[j]) < 0
+	})
+	return names, nil
+}
+
+// WithPolicySession starts a new policy session with the specified digest algorithm,
+// executes the supplied policy with it using the supplied resources and parameters, and
+// then calls fn with the satisfied session so that it can be used to authorize a command.
+// The session is flushed before this function returns, regardless of whether executing
+// the policy or fn succeeds, unless it has already been flushed by the TPM because fn
+// used it without the [tpm2.AttrContinueSession] attribute.
+//
+// If resources is nil, then the policy won't be able to load any resources, as with
+// [Policy.Execute]. If the result of executing the policy is required, such as to obtain
+// any new tickets, the Result field of params can be set.
+func WithPolicySession(tpm *tpm2.TPMContext, policy *Policy, alg tpm2.HashAlgorithmId, params *PolicyExecuteParams, resources PolicyResources, fn func(session tpm2.SessionContext) error) (err error) {
+	if policy == nil {
+		return errors.New("no policy")
+	}
+
+	session, err := tpm.StartAuthSession(nil, nil, tpm2.SessionTypePolicy, nil, alg)
+	if err != nil {
+		return fmt.Errorf("cannot start policy session: %w", err)
+	}
+	defer func() {
+		if session.Handle() == tpm2.HandleUnassigned {
+			// The session has already been flushed.
+			return
+		}
+		if flushErr := tpm.FlushContext(session); flushErr != nil && err == nil {
+			err = fmt.Errorf("cannot flush policy session: %w", flushErr)
+		}
+	}()
+
+	if _, err := policy.Execute(NewTPMPolicySession(tpm, session), resources, NewTPMHelper(tpm, nil), params); err != nil {
+		return fmt.Errorf("cannot execute policy: %w", err)
+	}
+
+	return fn(session)
+}
+
 type nullTickets struct{}
 
 func (*nullTickets) ticket(authName tpm2.Name, policyRef tpm2.Nonce) *PolicyTicket {
@@ -1734,6 +2535,15 @@ type policyComputeRunner struct {
 	policyResources mockPolicyResources
 
 	currentPath policyBranchPath
+
+	// workers is used to bound the number of goroutines used to compute
+	// branch digests concurrently. If this is nil, branch digests are
+	// computed sequentially.
+	workers chan struct{}
+
+	// preserveDigests indicates that branches which already have a digest
+	// for the current algorithm should not be recomputed.
+	preserveDigests bool
 }
 
 func newPolicyComputeRunner(alg tpm2.HashAlgorithmId) *policyComputeRunner {
@@ -1742,6 +2552,13 @@ func newPolicyComputeRunner(alg tpm2.HashAlgorithmId) *policyComputeRunner {
 	}
 }
 
+func newParallelPolicyComputeRunner(alg tpm2.HashAlgorithmId, parallelism int) *policyComputeRunner {
+	runner := newPolicyComputeRunner(alg)
+	// The current goroutine is also used for computing branch digests.
+	runner.workers = make(chan struct{}, parallelism-1)
+	return runner
+}
+
 func (r *policyComputeRunner) session() policySession {
 	return r.policySession
 }
@@ -1774,31 +2591,83 @@ func (r *policyComputeRunner) runBranch(branches policyBranches) (selected int,
 		return 0, err
 	}
 
-	for i, branch := range branches {
-		name := string(branch.Name)
-		if len(name) == 0 {
+	computedDigests := make(tpm2.DigestList, len(branches))
+	errs := make([]error, len(branches))
+
+	computeBranch := func(i int, runner *policyComputeRunner, branch *policyBranch) {
+		if (runner.preserveDigests || branch.Policy.hasUnsupported()) && branch.hasDigests(runner.session().HashAlg()) {
+			// The digest of a branch containing unsupported elements can't be
+			// computed, so use the stored digest if there is one.
+			computedDigests[i], _ = branch.PolicyDigests.digest(runner.session().HashAlg())
+			return
+		}
+		if err := runner.run(branch.Policy); err != nil {
+			errs[i] = err
+			return
+		}
+		computedDigests[i], errs[i] = runner.session().PolicyGetDigest()
+		if runner.preserveDigests {
+			if digest, ok := branch.PolicyDigests.digest(runner.session().HashAlg()); ok {
+				// The branch was only run to compute the digests of its
+				// sub-branches.
+				computedDigests[i] = digest
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	failed := false
+	for i, branch := range branches {
+		name := string(branch.Name)
+		if len(name) == 0 {
 			name = fmt.Sprintf("{%d}", i)
 		}
 
-		computedDigest, err := func() (tpm2.Digest, error) {
-			origPolicySession := r.policySession
-			origPath := r.currentPath
-			r.policySession = newComputePolicySession(r.session().HashAlg(), currentDigest, true)
-			r.currentPath = r.currentPath.Concat(name)
-			defer func() {
-				r.policySession = origPolicySession
-				r.currentPath = origPath
-			}()
+		runner := &policyComputeRunner{
+			policySession:   r.policySession.newBranchSession(currentDigest),
+			currentPath:     r.currentPath.Concat(name),
+			workers:         r.workers,
+			preserveDigests: r.preserveDigests,
+		}
 
-			if err := r.run(branch.Policy); err != nil {
-				return nil, err
-			}
+		// Compute the branch on another goroutine if there is one available,
+		// else compute it on this goroutine. Sending to a nil channel never
+		// proceeds, so branches are always computed on this goroutine for a
+		// sequential runner.
+		select {
+		case r.workers <- struct{}{}:
+			wg.Add(1)
+			go func(i int, runner *policyComputeRunner, branch *policyBranch) {
+				defer func() {
+					<-r.workers
+					wg.Done()
+				}()
+				computeBranch(i, runner, branch)
+			}(i, runner, branch)
+		default:
+			computeBranch(i, runner, branch)
+			failed = errs[i] != nil
+		}
 
-			return r.session().PolicyGetDigest()
-		}()
+		if failed {
+			// Don't compute any more branches. Any branches with a lower index
+			// that are being computed on other goroutines will still complete.
+			break
+		}
+	}
+	wg.Wait()
+
+	// Return the error for the branch with the lowest index, so that the error is
+	// the same as if the branches were computed sequentially.
+	for _, err := range errs {
 		if err != nil {
 			return 0, err
 		}
+	}
+
+	// Update the branch digests in order.
+	for i, branch := range branches {
+		computedDigest := computedDigests[i]
 
 		added := false
 		for j, digest := range branch.PolicyDigests {
@@ -1844,21 +2713,39 @@ func (r *policyComputeRunner) run(elements policyElements) error {
 // assertions, These can only be computed for a single digest algorithm, because they
 // are bound to a name.
 func (p *Policy) AddDigest(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
-	if !alg.Available() {
-		return nil, errors.New("unavailable algorithm")
-	}
+	return p.addDigest(alg, newPolicyComputeRunner(alg))
+}
 
-	var policy *policy
-	if err := mu.CopyValue(&policy, p.policy); err != nil {
-		return nil, fmt.Errorf("cannot make temporary copy of policy: %w", err)
+// PolicyComputeParams provides parameters to [Policy.AddDigestWithParams].
+type PolicyComputeParams struct {
+	// Parallelism is the maximum number of goroutines that will be used to
+	// compute the digests of branches concurrently. The default is the value
+	// returned from runtime.GOMAXPROCS. Setting this to 1 results in branches
+	// being computed sequentially.
+	Parallelism int
+}
+
+// AddDigestWithParams is the same as [Policy.AddDigest], but permits the digests of
+// branches to be computed concurrently. This is useful for policies with a large number
+// of branches. The result is identical to that of [Policy.AddDigest].
+func (p *Policy) AddDigestWithParams(alg tpm2.HashAlgorithmId, params *PolicyComputeParams) (tpm2.Digest, error) {
+	if params == nil {
+		params = new(PolicyComputeParams)
+	}
+	parallelism := params.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
 	}
 
-	runner := newPolicyComputeRunner(alg)
-	if err := runner.run(policy.Policy); err != nil {
-		return nil, err
+	return p.addDigest(alg, newParallelPolicyComputeRunner(alg, parallelism))
+}
+
+func (p *Policy) addDigest(alg tpm2.HashAlgorithmId, runner *policyComputeRunner) (tpm2.Digest, error) {
+	if !alg.Available() {
+		return nil, errors.New("unavailable algorithm")
 	}
 
-	computedDigest, err := runner.session().PolicyGetDigest()
+	computedDigest, policy, err := p.computeDigest(runner)
 	if err != nil {
 		return nil, err
 	}
@@ -1880,6 +2767,239 @@ func (p *Policy) AddDigest(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
 	return computedDigest, nil
 }
 
+// computeDigest computes the digest of a temporary copy of this policy with the
+// supplied runner, returning the digest and the temporary copy.
+func (p *Policy) computeDigest(runner *policyComputeRunner) (tpm2.Digest, *policy, error) {
+	var policy *policy
+	if err := mu.CopyValue(&policy, p.policy); err != nil {
+		return nil, nil, fmt.Errorf("cannot make temporary copy of policy: %w", err)
+	}
+
+	if policy.Policy.hasUnsupported() {
+		// The digest of a policy containing unsupported elements can't be computed,
+		// so use the stored digest if there is one.
+		if digest, ok := policy.PolicyDigests.digest(runner.session().HashAlg()); ok {
+			return digest, policy, nil
+		}
+	}
+
+	runner.policySession.minPcrSelectSize = p.compat.MinPCRSelectSize
+	if err := runner.run(policy.Policy); err != nil {
+		return nil, nil, err
+	}
+
+	computedDigest, err := runner.session().PolicyGetDigest()
+	if err != nil {
+		return nil, nil, err
+	}
+	return computedDigest, policy, nil
+}
+
+// ComputeFor computes the digest of this policy for the specified algorithm without
+// adding it to the policy. Use [Policy.AddDigest] to add the digest to the policy.
+//
+// This will fail for policies that contain TPM2_PolicyCpHash or TPM2_PolicyNameHash
+// assertions, for the same reason as [Policy.AddDigest].
+func (p *Policy) ComputeFor(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
+	if !alg.Available() {
+		return nil, errors.New("unavailable algorithm")
+	}
+	return p.ComputeForWith(alg, alg.NewHash)
+}
+
+// ComputeForWith is the same as [Policy.ComputeFor], but uses the supplied hash
+// constructor rather than the one associated with the specified algorithm. This is
+// useful for algorithms that aren't linked into the current binary. The algorithm
+// must be valid, and the supplied constructor must produce digests of the size
+// defined for the algorithm.
+func (p *Policy) ComputeForWith(alg tpm2.HashAlgorithmId, newHash func() hash.Hash) (tpm2.Digest, error) {
+	if !alg.IsValid() {
+		return nil, errors.New("invalid algorithm")
+	}
+	if newHash == nil {
+		return nil, errors.New("no hash constructor")
+	}
+	if size := newHash().Size(); size != alg.Size() {
+		return nil, fmt.Errorf("hash constructor produces digests of %d bytes, but %v digests are %d bytes", size, alg, alg.Size())
+	}
+
+	runner := newPolicyComputeRunner(alg)
+	runner.policySession.newHash = newHash
+	digest, _, err := p.computeDigest(runner)
+	return digest, err
+}
+
+// PolicyDigestsError is returned from [Policy.DigestsForBanks] if the digest of a policy
+// couldn't be computed for one or more of the requested algorithms.
+type PolicyDigestsError struct {
+	// Errors contains the error for each algorithm that the digest couldn't be
+	// computed for.
+	Errors map[tpm2.HashAlgorithmId]error
+}
+
+func (e *PolicyDigestsError) Error() string {
+	var algs []tpm2.HashAlgorithmId
+	for alg := range e.Errors {
+		algs = append(algs, alg)
+	}
+	sort.Slice(algs, func(i, j int) bool { return algs[i] < algs[j] })
+
+	var errs []string
+	for _, alg := range algs {
+		errs = append(errs, fmt.Sprintf("%v: %v", alg, e.Errors[alg]))
+	}
+	return "cannot compute policy digest for some algorithms: " + strings.Join(errs, ", ")
+}
+
+// DigestsForBanks returns the digest of this policy for each of the specified
+// algorithms. Digests that the policy already has are returned directly, and the
+// others are computed using [Policy.ComputeFor] without adding them to the policy. This
+// is useful for determining which name algorithms an object that uses this policy can
+// be created with.
+//
+// This succeeds partially if the digest can't be computed for some algorithms, such as
+// for algorithms that aren't available or policies that contain TPM2_PolicyCpHash or
+// TPM2_PolicyNameHash assertions. In this case, the returned map contains the digests
+// that could be computed and a *[PolicyDigestsError] is returned containing the error
+// for each of the other algorithms.
+func (p *Policy) DigestsForBanks(algs ...tpm2.HashAlgorithmId) (map[tpm2.HashAlgorithmId]tpm2.Digest, error) {
+	if len(algs) == 0 {
+		return nil, errors.New("no algorithms")
+	}
+
+	digests := make(map[tpm2.HashAlgorithmId]tpm2.Digest)
+	errs := make(map[tpm2.HashAlgorithmId]error)
+	for _, alg := range algs {
+		if _, exists := digests[alg]; exists {
+			continue
+		}
+		if _, exists := errs[alg]; exists {
+			continue
+		}
+
+		digest, err := p.Digest(alg)
+		if errors.Is(err, ErrMissingDigest) {
+			digest, err = p.ComputeFor(alg)
+		}
+		if err != nil {
+			errs[alg] = err
+			continue
+		}
+		digests[alg] = digest
+	}
+
+	if len(errs) > 0 {
+		return digests, &PolicyDigestsError{Errors: errs}
+	}
+	return digests, nil
+}
+
+// hasDigests indicates whether the supplied elements have a digest for the specified
+// algorithm for every branch.
+func (e policyElements) hasDigests(alg tpm2.HashAlgorithmId) bool {
+	for _, element := range e {
+		if element.Type != tpm2.CommandPolicyOR {
+			continue
+		}
+		for _, branch := range element.Details.OR.Branches {
+			if !branch.hasDigests(alg) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasDigests indicates whether this branch and all of its sub-branches have a digest
+// for the specified algorithm.
+func (b *policyBranch) hasDigests(alg tpm2.HashAlgorithmId) bool {
+	if _, ok := b.PolicyDigests.digest(alg); !ok {
+		return false
+	}
+	return b.Policy.hasDigests(alg)
+}
+
+// opaqueElements returns a description of every element in the supplied elements that
+// only retains a digest rather than the inputs used to compute it, and which therefore
+// can't be computed for a different algorithm. Branches that already have all of their
+// digests for the specified algorithm are skipped, as they don't need to be computed.
+func (e policyElements) opaqueElements(alg tpm2.HashAlgorithmId, path policyBranchPath) (out []string) {
+	for _, element := range e {
+		switch element.Type {
+		case tpm2.CommandPolicyCpHash, tpm2.CommandPolicyNameHash, tpm2.CommandPolicyParameters, commandRawPolicyOR:
+			branch := "root branch"
+			if len(path) > 0 {
+				branch = "branch '" + string(path) + "'"
+			}
+			out = append(out, fmt.Sprintf("%s in %s", element.runner().name(), branch))
+		case tpm2.CommandPolicyOR:
+			for i, branch := range element.Details.OR.Branches {
+				if branch.hasDigests(alg) {
+					continue
+				}
+				name := string(branch.Name)
+				if len(name) == 0 {
+					name = fmt.Sprintf("{%d}", i)
+				}
+				out = append(out, branch.Policy.opaqueElements(alg, path.Concat(name))...)
+			}
+		}
+	}
+	return out
+}
+
+// EnsureDigests ensures that this policy has a digest for each of the specified
+// algorithms, for the policy and for every branch, so that it can be executed with
+// sessions that use any of these algorithms. This is useful for a policy that was
+// created for one algorithm but which now needs to be used with another. Missing
+// digests are computed and added to the policy in place. Digests that already exist
+// are not recomputed. The policy should be persisted after calling this.
+//
+// This will fail if a digest needs to be computed for a policy that contains elements
+// that only retain a digest that was computed for a single algorithm rather than the
+// inputs for computing it, such as TPM2_PolicyCpHash, TPM2_PolicyNameHash and
+// TPM2_PolicyParameters assertions or TPM2_PolicyOR assertions with explicit digests.
+// In this case, the returned error lists these elements and the policy is not modified.
+func (p *Policy) EnsureDigests(algs ...tpm2.HashAlgorithmId) error {
+	var policy *policy
+	if err := mu.CopyValue(&policy, p.policy); err != nil {
+		return fmt.Errorf("cannot make temporary copy of policy: %w", err)
+	}
+
+	for _, alg := range algs {
+		_, hasDigest := policy.PolicyDigests.digest(alg)
+		if hasDigest && policy.Policy.hasDigests(alg) {
+			continue
+		}
+
+		if !alg.Available() {
+			return fmt.Errorf("cannot compute digests for %v: unavailable algorithm", alg)
+		}
+		if opaque := policy.Policy.opaqueElements(alg, ""); len(opaque) > 0 {
+			return fmt.Errorf("cannot compute digests for %v: policy contains elements without the inputs required to compute them: %s", alg, strings.Join(opaque, ", "))
+		}
+
+		runner := newPolicyComputeRunner(alg)
+		runner.preserveDigests = true
+		runner.policySession.minPcrSelectSize = p.compat.MinPCRSelectSize
+		if err := runner.run(policy.Policy); err != nil {
+			return fmt.Errorf("cannot compute digests for %v: %w", alg, err)
+		}
+		if hasDigest {
+			continue
+		}
+
+		computedDigest, err := runner.session().PolicyGetDigest()
+		if err != nil {
+			return fmt.Errorf("cannot compute digests for %v: %w", alg, err)
+		}
+		policy.PolicyDigests = append(policy.PolicyDigests, taggedHash{HashAlg: alg, Digest: computedDigest})
+	}
+
+	p.policy = *policy
+	return nil
+}
+
 // Digest returns the digest for this policy for the specified algorithm, if it
 // has been computed. If it hasn't been computed, ErrMissingDigest is returned.
 func (p *Policy) Digest(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
@@ -1936,6 +3056,52 @@ func (p *Policy) Authorize(rand io.Reader, authKey *tpm2.Public, policyRef tpm2.
 	return nil
 }
 
+// AddAuthorization adds the supplied authorization to this policy so that it can be used
+// as an authorized policy for a TPM2_PolicyAuthorize assertion with the authorization's
+// key and policy ref. This is an alternative to [Policy.Authorize] for authorizations that
+// are signed elsewhere, using a digest computed with [ComputeAuthorizeApprovedHash]. Calling
+// this updates the policy, so it should be persisted afterwards.
+//
+// The signature must be valid for one of the digests that the policy has been computed
+// for, else an error is returned. An existing authorization for the same key, policy ref
+// and digest is replaced.
+func (p *Policy) AddAuthorization(auth *PolicyAuthorization) error {
+	if auth == nil || auth.AuthKey == nil || auth.Signature == nil {
+		return errors.New("invalid authorization")
+	}
+
+	var approvedPolicy tpm2.Digest
+	for _, digest := range p.policy.PolicyDigests {
+		ok, err := VerifyAuthorizeApprovedSignature(auth.AuthKey, digest.Digest, auth.PolicyRef, auth.Signature)
+		if err != nil {
+			return fmt.Errorf("cannot verify signature: %w", err)
+		}
+		if ok {
+			approvedPolicy = digest.Digest
+			break
+		}
+	}
+	if approvedPolicy == nil {
+		return errors.New("signature is not valid for any of the policy digests")
+	}
+
+	authName := auth.AuthKey.Name()
+
+	var authorizations policyAuthorizations
+	for _, a := range p.policy.PolicyAuthorizations {
+		if bytes.Equal(a.AuthKey.Name(), authName) && bytes.Equal(a.PolicyRef, auth.PolicyRef) {
+			if ok, _ := a.Verify(approvedPolicy); ok {
+				continue
+			}
+		}
+		authorizations = append(authorizations, a)
+	}
+	authorizations = append(authorizations, *auth)
+
+	p.policy.PolicyAuthorizations = authorizations
+	return nil
+}
+
 type policyValidateRunner struct {
 	policySession   *computePolicySession
 	policyTickets   nullTickets
@@ -1991,7 +3157,7 @@ func (r *policyValidateRunner) runBranch(branches policyBranches) (selected int,
 		computedDigest, err := func() (tpm2.Digest, error) {
 			origPolicySession := r.policySession
 			origPath := r.currentPath
-			r.policySession = newComputePolicySession(r.session().HashAlg(), currentDigest, false)
+			r.policySession = origPolicySession.newBranchSession(currentDigest)
 			r.currentPath = r.currentPath.Concat(name)
 			defer func() {
 				r.policySession = origPolicySession
@@ -2055,6 +3221,7 @@ func (p *Policy) Validate(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
 	}
 
 	runner := newPolicyValidateRunner(alg)
+	runner.policySession.minPcrSelectSize = p.compat.MinPCRSelectSize
 	if err := runner.run(p.policy.Policy); err != nil {
 		return nil, err
 	}
@@ -2085,6 +3252,550 @@ func (p *Policy) Validate(alg tpm2.HashAlgorithmId) (tpm2.Digest, error) {
 	return expectedDigest, nil
 }
 
+type policyCanExecuteRunner struct {
+	policySession   *computePolicySession
+	policyTickets   nullTickets
+	policyResources mockPolicyResources
+
+	currentPath policyBranchPath
+	remaining   policyBranchPath
+}
+
+func newPolicyCanExecuteRunner(alg tpm2.HashAlgorithmId, path policyBranchPath) *policyCanExecuteRunner {
+	return &policyCanExecuteRunner{
+		policySession: newComputePolicySession(alg, nil, false),
+		remaining:     path,
+	}
+}
+
+func (r *policyCanExecuteRunner) session() policySession {
+	return r.policySession
+}
+
+func (r *policyCanExecuteRunner) tickets() policyTickets {
+	return &r.policyTickets
+}
+
+func (r *policyCanExecuteRunner) resources() policyResources {
+	return &r.policyResources
+}
+
+func (r *policyCanExecuteRunner) authResourceName() tpm2.Name {
+	return nil
+}
+
+func (r *policyCanExecuteRunner) loadExternal(public *tpm2.Public) (ResourceContext, error) {
+	// the handle is not relevant here
+	resource := tpm2.NewResourceContext(0x80000000, public.Name())
+	return newResourceContext(resource, nil), nil
+}
+
+func (r *policyCanExecuteRunner) authorize(auth ResourceContext, askForPolicy bool, usage *PolicySessionUsage, prefer tpm2.SessionType) (session SessionContext, err error) {
+	return new(mockSessionContext), nil
+}
+
+func (r *policyCanExecuteRunner) runBranch(branches policyBranches) (selected int, err error) {
+	if len(branches) == 0 {
+		return 0, errors.New("no branches")
+	}
+
+	currentDigest, err := r.session().PolicyGetDigest()
+	if err != nil {
+		return 0, err
+	}
+
+	runOne := func(branch *policyBranch, name string, remaining policyBranchPath) error {
+		origPolicySession := r.policySession
+		origPath := r.currentPath
+		origRemaining := r.remaining
+		r.policySession = origPolicySession.newBranchSession(currentDigest)
+		r.currentPath = r.currentPath.Concat(name)
+		r.remaining = remaining
+		defer func() {
+			r.policySession = origPolicySession
+			r.currentPath = origPath
+			r.remaining = origRemaining
+		}()
+
+		return r.run(branch.Policy)
+	}
+
+	next, remaining := r.remaining.PopNextComponent()
+	if len(next) > 0 && next[0] != '*' {
+		// We have a branch selector, so just check the selected branch.
+		selected, err := branches.selectBranch(next)
+		if err != nil {
+			return 0, err
+		}
+
+		name := string(branches[selected].Name)
+		if len(name) == 0 {
+			name = next
+		}
+
+		if err := runOne(branches[selected], name, remaining); err != nil {
+			return 0, err
+		}
+		r.currentPath = r.currentPath.Concat(name)
+		r.remaining = remaining
+		return selected, nil
+	}
+
+	// The branch will be selected automatically during execution, so check
+	// every candidate branch.
+	switch next {
+	case "", "**":
+		remaining = ""
+	}
+	for i, branch := range branches {
+		name := string(branch.Name)
+		if len(name) == 0 {
+			name = fmt.Sprintf("{%d}", i)
+		}
+		if err := runOne(branch, name, remaining); err != nil {
+			return 0, err
+		}
+	}
+
+	r.currentPath = r.currentPath.Concat("**")
+	r.remaining = ""
+	return -1, nil
+}
+
+func (r *policyCanExecuteRunner) runAuthorizedPolicy(keySign *tpm2.Public, policyRef tpm2.Nonce, policies []*authorizedPolicy) (approvedPolicy tpm2.Digest, checkTicket *tpm2.TkVerified, err error) {
+	return nil, nil, nil
+}
+
+func (r *policyCanExecuteRunner) run(elements policyElements) error {
+	for len(elements) > 0 {
+		element := elements[0].runner()
+		elements = elements[1:]
+		if err := element.run(r); err != nil {
+			return makePolicyError(err, r.currentPath, element.name())
+		}
+	}
+
+	return nil
+}
+
+// CanExecute performs a check of whether this policy can be executed with a session
+// for the specified digest algorithm and the specified path, without requiring a TPM.
+// This is intended to be a cheap pre-flight check for [Policy.Execute].
+//
+// As with [Policy.Execute], an error wrapping [ErrMissingDigest] is returned if the policy
+// contains branches but has no digest for the specified algorithm.
+//
+// It returns nil if every assertion on the path has what it needs for the specified
+// algorithm. In particular, this checks that every branch node on the path has a digest
+// for every one of its branches, and that assertions bound to a digest that can only be
+// computed for a single algorithm (TPM2_PolicyCpHash, TPM2_PolicyNameHash and
+// TPM2_PolicyParameters) are consistent with the specified algorithm. Where the path
+// doesn't explicitly select a branch, every candidate branch is checked.
+//
+// On failure, a *[PolicyError] is returned that identifies the first problematic element.
+// If a branch digest is missing, the error will wrap [ErrMissingDigest].
+//
+// This doesn't check that authorized policies, resources, or any state on the TPM that
+// is required to execute the policy are available.
+func (p *Policy) CanExecute(alg tpm2.HashAlgorithmId, path string) error {
+	if !alg.Available() {
+		return errors.New("unavailable algorithm")
+	}
+
+	if err := p.checkSessionAlg(alg, path); err != nil {
+		return err
+	}
+
+	runner := newPolicyCanExecuteRunner(alg, policyBranchPath(path))
+	runner.policySession.minPcrSelectSize = p.compat.MinPCRSelectSize
+	return runner.run(p.policy.Policy)
+}
+
+// PolicyCost is an estimate of the work required to execute a policy for a single path,
+// as returned by [Policy.EstimateCost].
+type PolicyCost struct {
+	// Commands contains the number of times that each policy command is executed. This
+	// includes every TPM2_PolicyOR command that is required for each branch node.
+	Commands map[tpm2.CommandCode]int
+
+	// Resources is the number of resources that must be loaded into the TPM. This
+	// includes the keys associated with TPM2_PolicySigned and TPM2_PolicyAuthorize
+	// assertions, and the authorization objects associated with TPM2_PolicySecret
+	// assertions other than permanent resources.
+	Resources int
+
+	// SignedAuthorizationRequired indicates that a signed authorization must be
+	// created by the caller for at least one TPM2_PolicySigned assertion.
+	SignedAuthorizationRequired bool
+
+	// SignatureVerificationRequired indicates that the TPM must verify the signature
+	// of an authorized policy for at least one TPM2_PolicyAuthorize assertion.
+	SignatureVerificationRequired bool
+
+	// Estimate indicates that the cost couldn't be determined exactly. This is the
+	// case where the path doesn't explicitly select a branch for a branch node with
+	// more than one branch, in which case the cost of the most expensive branch is
+	// used, or where a TPM2_PolicyAuthorize assertion is encountered, in which case
+	// the cost of the most expensive of the supplied authorized policies is used if
+	// there are any.
+	Estimate bool
+}
+
+func newPolicyCost() *PolicyCost {
+	return &PolicyCost{Commands: make(map[tpm2.CommandCode]int)}
+}
+
+// NumCommands returns the total number of policy commands that are executed.
+func (c *PolicyCost) NumCommands() (n int) {
+	for _, count := range c.Commands {
+		n += count
+	}
+	return n
+}
+
+func (c *PolicyCost) add(other *PolicyCost) {
+	for code, count := range other.Commands {
+		c.Commands[code] += count
+	}
+	c.Resources += other.Resources
+	c.SignedAuthorizationRequired = c.SignedAuthorizationRequired || other.SignedAuthorizationRequired
+	c.SignatureVerificationRequired = c.SignatureVerificationRequired || other.SignatureVerificationRequired
+	c.Estimate = c.Estimate || other.Estimate
+}
+
+func (c *PolicyCost) exceeds(other *PolicyCost) bool {
+	switch {
+	case c.NumCommands() != other.NumCommands():
+		return c.NumCommands() > other.NumCommands()
+	default:
+		return c.Resources > other.Resources
+	}
+}
+
+// policyCostSession is a policySession that counts the commands that are executed
+// on the current cost of the associated runner.
+type policyCostSession struct {
+	*computePolicySession
+	runner *policyCostRunner
+}
+
+func (s *policyCostSession) count(code tpm2.CommandCode) {
+	s.runner.cost.Commands[code] += 1
+}
+
+func (s *policyCostSession) PolicySigned(authKey tpm2.ResourceContext, includeNonceTPM bool, cpHashA tpm2.Digest, policyRef tpm2.Nonce, expiration int32, auth *tpm2.Signature) (tpm2.Timeout, *tpm2.TkAuth, error) {
+	s.count(tpm2.CommandPolicySigned)
+	s.runner.cost.SignedAuthorizationRequired = true
+	return s.computePolicySession.PolicySigned(authKey, includeNonceTPM, cpHashA, policyRef, expiration, auth)
+}
+
+func (s *policyCostSession) PolicySecret(authObject tpm2.ResourceContext, cpHashA tpm2.Digest, policyRef tpm2.Nonce, expiration int32, authObjectAuthSession tpm2.SessionContext) (tpm2.Timeout, *tpm2.TkAuth, error) {
+	s.count(tpm2.CommandPolicySecret)
+	return s.computePolicySession.PolicySecret(authObject, cpHashA, policyRef, expiration, authObjectAuthSession)
+}
+
+func (s *policyCostSession) PolicyOR(pHashList tpm2.DigestList) error {
+	s.count(tpm2.CommandPolicyOR)
+	return s.computePolicySession.PolicyOR(pHashList)
+}
+
+func (s *policyCostSession) PolicyPCR(pcrDigest tpm2.Digest, pcrs tpm2.PCRSelectionList) error {
+	s.count(tpm2.CommandPolicyPCR)
+	return s.computePolicySession.PolicyPCR(pcrDigest, pcrs)
+}
+
+func (s *policyCostSession) PolicyNV(auth, index tpm2.ResourceContext, operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp, authAuthSession tpm2.SessionContext) error {
+	s.count(tpm2.CommandPolicyNV)
+	return s.computePolicySession.PolicyNV(auth, index, operandB, offset, operation, authAuthSession)
+}
+
+func (s *policyCostSession) PolicyCounterTimer(operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) error {
+	s.count(tpm2.CommandPolicyCounterTimer)
+	return s.computePolicySession.PolicyCounterTimer(operandB, offset, operation)
+}
+
+func (s *policyCostSession) PolicyCommandCode(code tpm2.CommandCode) error {
+	s.count(tpm2.CommandPolicyCommandCode)
+	return s.computePolicySession.PolicyCommandCode(code)
+}
+
+func (s *policyCostSession) PolicyCpHash(cpHashA tpm2.Digest) error {
+	s.count(tpm2.CommandPolicyCpHash)
+	return s.computePolicySession.PolicyCpHash(cpHashA)
+}
+
+func (s *policyCostSession) PolicyNameHash(nameHash tpm2.Digest) error {
+	s.count(tpm2.CommandPolicyNameHash)
+	return s.computePolicySession.PolicyNameHash(nameHash)
+}
+
+func (s *policyCostSession) PolicyDuplicationSelect(objectName, newParentName tpm2.Name, includeObject bool) error {
+	s.count(tpm2.CommandPolicyDuplicationSelect)
+	return s.computePolicySession.PolicyDuplicationSelect(objectName, newParentName, includeObject)
+}
+
+func (s *policyCostSession) PolicyAuthorize(approvedPolicy tpm2.Digest, policyRef tpm2.Nonce, keySign tpm2.Name, verified *tpm2.TkVerified) error {
+	s.count(tpm2.CommandPolicyAuthorize)
+	return s.computePolicySession.PolicyAuthorize(approvedPolicy, policyRef, keySign, verified)
+}
+
+func (s *policyCostSession) PolicyAuthValue() error {
+	s.count(tpm2.CommandPolicyAuthValue)
+	return s.computePolicySession.PolicyAuthValue()
+}
+
+func (s *policyCostSession) PolicyPassword() error {
+	s.count(tpm2.CommandPolicyPassword)
+	return s.computePolicySession.PolicyPassword()
+}
+
+func (s *policyCostSession) PolicyPhysicalPresence() error {
+	s.count(tpm2.CommandPolicyPhysicalPresence)
+	return s.computePolicySession.PolicyPhysicalPresence()
+}
+
+func (s *policyCostSession) PolicyNvWritten(writtenSet bool) error {
+	s.count(tpm2.CommandPolicyNvWritten)
+	return s.computePolicySession.PolicyNvWritten(writtenSet)
+}
+
+func (s *policyCostSession) PolicyParameters(pHash tpm2.Digest) error {
+	s.count(tpm2.CommandPolicyParameters)
+	return s.computePolicySession.PolicyParameters(pHash)
+}
+
+// policyCostResources is a policyResources that counts the resources that need to
+// be loaded on the current cost of the associated runner.
+type policyCostResources struct {
+	*mockPolicyResources
+	runner *policyCostRunner
+}
+
+func (r *policyCostResources) loadedResource(name tpm2.Name) (ResourceContext, error) {
+	if name.Type() != tpm2.NameTypeHandle {
+		r.runner.cost.Resources += 1
+	}
+	return r.mockPolicyResources.loadedResource(name)
+}
+
+type policyCostRunner struct {
+	policySession   *policyCostSession
+	policyTickets   nullTickets
+	policyResources *policyCostResources
+
+	cost        *PolicyCost
+	currentPath policyBranchPath
+	remaining   policyBranchPath
+}
+
+func newPolicyCostRunner(alg tpm2.HashAlgorithmId, path policyBranchPath, authorizedPolicies PolicyAuthorizedPolicies) *policyCostRunner {
+	runner := &policyCostRunner{
+		cost:      newPolicyCost(),
+		remaining: path,
+	}
+	runner.policySession = &policyCostSession{
+		computePolicySession: newComputePolicySession(alg, nil, false),
+		runner:               runner,
+	}
+	runner.policyResources = &policyCostResources{
+		mockPolicyResources: newMockPolicyResources(authorizedPolicies),
+		runner:              runner,
+	}
+	return runner
+}
+
+func (r *policyCostRunner) session() policySession {
+	return r.policySession
+}
+
+func (r *policyCostRunner) tickets() policyTickets {
+	return &r.policyTickets
+}
+
+func (r *policyCostRunner) resources() policyResources {
+	return r.policyResources
+}
+
+func (r *policyCostRunner) authResourceName() tpm2.Name {
+	return nil
+}
+
+func (r *policyCostRunner) loadExternal(public *tpm2.Public) (ResourceContext, error) {
+	r.cost.Resources += 1
+
+	// the handle is not relevant here
+	resource := tpm2.NewResourceContext(0x80000000, public.Name())
+	return newResourceContext(resource, nil), nil
+}
+
+func (r *policyCostRunner) authorize(auth ResourceContext, askForPolicy bool, usage *PolicySessionUsage, prefer tpm2.SessionType) (session SessionContext, err error) {
+	return new(mockSessionContext), nil
+}
+
+func (r *policyCostRunner) runBranch(branches policyBranches) (selected int, err error) {
+	if len(branches) == 0 {
+		return 0, errors.New("no branches")
+	}
+
+	currentDigest, err := r.session().PolicyGetDigest()
+	if err != nil {
+		return 0, err
+	}
+
+	runOne := func(branch *policyBranch, name string, remaining policyBranchPath) (*PolicyCost, error) {
+		origPolicySession := r.policySession
+		origCost := r.cost
+		origPath := r.currentPath
+		origRemaining := r.remaining
+		r.policySession = &policyCostSession{
+			computePolicySession: origPolicySession.computePolicySession.newBranchSession(currentDigest),
+			runner:               r,
+		}
+		r.cost = newPolicyCost()
+		r.currentPath = r.currentPath.Concat(name)
+		r.remaining = remaining
+		defer func() {
+			r.policySession = origPolicySession
+			r.cost = origCost
+			r.currentPath = origPath
+			r.remaining = origRemaining
+		}()
+
+		if err := r.run(branch.Policy); err != nil {
+			return nil, err
+		}
+		return r.cost, nil
+	}
+
+	next, remaining := r.remaining.PopNextComponent()
+	if len(next) > 0 && next[0] != '*' {
+		// We have a branch selector, so just use the cost of the selected branch.
+		selected, err := branches.selectBranch(next)
+		if err != nil {
+			return 0, err
+		}
+
+		name := string(branches[selected].Name)
+		if len(name) == 0 {
+			name = next
+		}
+
+		cost, err := runOne(branches[selected], name, remaining)
+		if err != nil {
+			return 0, err
+		}
+		r.cost.add(cost)
+		r.currentPath = r.currentPath.Concat(name)
+		r.remaining = remaining
+		return selected, nil
+	}
+
+	// The branch will be selected automatically during execution, so use the
+	// cost of the most expensive candidate branch.
+	switch next {
+	case "", "**":
+		remaining = ""
+	}
+	var worst *PolicyCost
+	for i, branch := range branches {
+		name := string(branch.Name)
+		if len(name) == 0 {
+			name = fmt.Sprintf("{%d}", i)
+		}
+		cost, err := runOne(branch, name, remaining)
+		if err != nil {
+			return 0, err
+		}
+		if worst == nil || cost.exceeds(worst) {
+			worst = cost
+			selected = i
+		}
+	}
+	if len(branches) > 1 {
+		worst.Estimate = true
+	}
+	r.cost.add(worst)
+
+	r.currentPath = r.currentPath.Concat("**")
+	r.remaining = ""
+
+	// Return the selected branch so that the PolicyOR commands are counted
+	// for the most expensive branch.
+	return selected, nil
+}
+
+func (r *policyCostRunner) runAuthorizedPolicy(keySign *tpm2.Public, policyRef tpm2.Nonce, policies []*authorizedPolicy) (approvedPolicy tpm2.Digest, checkTicket *tpm2.TkVerified, err error) {
+	// The signature of the selected policy has to be verified by the TPM, which
+	// requires the key to be loaded.
+	r.cost.SignatureVerificationRequired = true
+	r.cost.Resources += 1
+
+	// The cost of an authorized policy can only be estimated, because the policy
+	// that is used depends on the authorized policies available during execution.
+	r.cost.Estimate = true
+
+	if len(policies) == 0 {
+		return nil, nil, nil
+	}
+
+	var branches policyBranches
+	for _, policy := range policies {
+		branches = append(branches, &policy.policyBranch)
+	}
+
+	selected, err := r.runBranch(branches)
+	if err != nil {
+		return nil, nil, err
+	}
+	return policies[selected].PolicyDigests[0].Digest, nil, nil
+}
+
+func (r *policyCostRunner) run(elements policyElements) error {
+	for len(elements) > 0 {
+		element := elements[0].runner()
+		elements = elements[1:]
+		if err := element.run(r); err != nil {
+			return makePolicyError(err, r.currentPath, element.name())
+		}
+	}
+
+	return nil
+}
+
+// EstimateCost returns an estimate of the work required to execute this policy with a
+// session for the specified digest algorithm and the specified path, without requiring a
+// TPM. If the specified algorithm is [tpm2.HashAlgorithmNull], then the first algorithm
+// the policy is computed for is used.
+//
+// The returned cost contains the number of times that each policy command is executed,
+// including the TPM2_PolicyOR commands required for each branch node, the number of
+// resources that must be loaded, and whether any signing or signature verification is
+// required. Where the path doesn't explicitly select a branch, the cost of the most
+// expensive candidate branch is used.
+//
+// If the authorizedPolicies argument is supplied, the cost of the most expensive
+// associated authorized policy is included for each TPM2_PolicyAuthorize assertion.
+// As the set of authorized policies may change, the cost of a policy containing
+// TPM2_PolicyAuthorize assertions is always flagged as an estimate.
+func (p *Policy) EstimateCost(alg tpm2.HashAlgorithmId, path string, authorizedPolicies PolicyAuthorizedPolicies) (*PolicyCost, error) {
+	if alg == tpm2.HashAlgorithmNull {
+		if len(p.policy.PolicyDigests) == 0 {
+			return nil, ErrMissingDigest
+		}
+		alg = p.policy.PolicyDigests[0].HashAlg
+	}
+	if !alg.Available() {
+		return nil, errors.New("unavailable algorithm")
+	}
+
+	runner := newPolicyCostRunner(alg, policyBranchPath(path), authorizedPolicies)
+	runner.policySession.minPcrSelectSize = p.compat.MinPCRSelectSize
+	if err := runner.run(p.policy.Policy); err != nil {
+		return nil, err
+	}
+	return runner.cost, nil
+}
+
 // Branches returns the path of every branch in this policy.
 //
 // If the authorizedPolicies argument is supplied, associated authorized policies will be
@@ -2172,21 +3883,29 @@ type PolicyPCRDetails struct {
 
 // PolicyBranchDetails contains the properties of a single policy branch.
 type PolicyBranchDetails struct {
-	NV                []PolicyNVDetails            // TPM2_PolicyNV assertions
-	Secret            []PolicyAuthorizationDetails // TPM2_PolicySecret assertions
-	Signed            []PolicyAuthorizationDetails // TPM2_PolicySigned assertions
-	Authorize         []PolicyAuthorizationDetails // TPM2_PolicyAuthorize assertions
-	AuthValueNeeded   bool                         // The branch contains a TPM2_PolicyAuthValue or TPM2_PolicyPassword assertion
-	policyCommandCode tpm2.CommandCodeList
-	CounterTimer      []PolicyCounterTimerDetails // TPM2_PolicyCounterTimer assertions
-	policyCpHash      tpm2.DigestList
-	policyNameHash    tpm2.DigestList
-	PCR               []PolicyPCRDetails // TPM2_PolicyPCR assertions
-	policyNvWritten   []bool
+	NV                     []PolicyNVDetails            // TPM2_PolicyNV assertions
+	Secret                 []PolicyAuthorizationDetails // TPM2_PolicySecret assertions
+	Signed                 []PolicyAuthorizationDetails // TPM2_PolicySigned assertions
+	Authorize              []PolicyAuthorizationDetails // TPM2_PolicyAuthorize assertions
+	AuthValueNeeded        bool                         // The branch contains a TPM2_PolicyAuthValue or TPM2_PolicyPassword assertion
+	PhysicalPresenceNeeded bool                         // The branch contains a TPM2_PolicyPhysicalPresence assertion
+	policyCommandCode      tpm2.CommandCodeList
+	CounterTimer           []PolicyCounterTimerDetails // TPM2_PolicyCounterTimer assertions
+	policyCpHash           tpm2.DigestList
+	policyNameHash         tpm2.DigestList
+	PCR                    []PolicyPCRDetails // TPM2_PolicyPCR assertions
+	policyNvWritten        []bool
+	policyParametersHash   tpm2.DigestList
+	unsupported            []tpm2.CommandCode
 }
 
 // IsValid indicates whether the corresponding policy branch is valid.
 func (r *PolicyBranchDetails) IsValid() bool {
+	if len(r.unsupported) > 0 {
+		// The branch contains elements that can't be executed.
+		return false
+	}
+
 	if len(r.policyCommandCode) > 1 {
 		for _, code := range r.policyCommandCode[1:] {
 			if code != r.policyCommandCode[0] {
@@ -2212,6 +3931,12 @@ func (r *PolicyBranchDetails) IsValid() bool {
 		}
 		cpHashNum += 1
 	}
+	if len(r.policyParametersHash) > 0 {
+		if len(r.policyParametersHash) > 1 {
+			return false
+		}
+		cpHashNum += 1
+	}
 	if cpHashNum > 1 {
 		return false
 	}
@@ -2261,6 +3986,22 @@ func (r *PolicyBranchDetails) NvWritten() (nvWrittenSet bool, set bool) {
 	return r.policyNvWritten[0], true
 }
 
+// The parameters hash associated with a branch if set by the TPM2_PolicyParameters
+// assertion.
+func (r *PolicyBranchDetails) ParametersHash() (pHash tpm2.Digest, set bool) {
+	if len(r.policyParametersHash) == 0 {
+		return nil, false
+	}
+	return r.policyParametersHash[0], true
+}
+
+// hasUsageContext indicates whether a branch contains assertions that are checked
+// against the session usage.
+func (r *PolicyBranchDetails) hasUsageContext() bool {
+	return len(r.policyCommandCode) > 0 || len(r.policyCpHash) > 0 || len(r.policyNameHash) > 0 ||
+		len(r.policyNvWritten) > 0 || len(r.policyParametersHash) > 0
+}
+
 // Details returns details of all branches with the supplied path prefix, for
 // the specified algorithm. If the specified algorithm is [tpm2.HashAlgorithmNull],
 // then the first algorithm the policy is computed for is used.
@@ -2430,7 +4171,7 @@ func (r *policyStringifierRunner) runBranch(branches policyBranches) (selected i
 		digests = append(digests, digest)
 	}
 
-	tree, err := newPolicyOrTree(r.session().HashAlg(), digests)
+	tree, err := newPolicyOrTree(r.session().HashAlg(), policySessionHashConstructor(r.session()), digests)
 	if err != nil {
 		return 0, fmt.Errorf("cannot compute PolicyOR tree: %w", err)
 	}
@@ -0,0 +1,274 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// NoExpiration is returned from [RefreshingSignedAuthorization.RemainingValidity]
+// for authorizations that do not expire.
+const NoExpiration = time.Duration(math.MaxInt64)
+
+// refreshingSignedAuthorizationExpiryMargin is the margin in milliseconds that is
+// subtracted from the estimated expiration time of authorizations with a positive
+// expiration, to account for the time taken to obtain the authorization and to
+// submit it to the TPM.
+const refreshingSignedAuthorizationExpiryMargin = 1000
+
+type refreshingSignedAuthorizationEntry struct {
+	authKey   tpm2.Name
+	policyRef tpm2.Nonce
+	auth      *PolicySignedAuthorization
+
+	resetCount     uint32
+	restartCount   uint32
+	issued         uint64 // TPM time in milliseconds at which the authorization was obtained
+	expiry         uint64 // TPM time in milliseconds at which the authorization expires, or 0.
+	timeoutPending bool   // the expiry is not known until the TPM returns a timeout
+}
+
+func (e *refreshingSignedAuthorizationEntry) expired(now *tpm2.TimeInfo) bool {
+	switch {
+	case now.ClockInfo.ResetCount != e.resetCount || now.ClockInfo.RestartCount != e.restartCount:
+		// The TPM has been restarted or reset since the authorization was obtained,
+		// which resets the time value.
+		return true
+	case now.Time < e.issued:
+		return true
+	case e.timeoutPending:
+		return true
+	case e.expiry == 0:
+		return false
+	default:
+		return now.Time >= e.expiry
+	}
+}
+
+func (e *refreshingSignedAuthorizationEntry) setTimeout(timeout tpm2.Timeout) {
+	// The reference implementation uses the most significant bit to indicate
+	// that the authorization expires on reset.
+	e.expiry = timeout.Value() &^ (1 << 63)
+	e.timeoutPending = false
+}
+
+func (e *refreshingSignedAuthorizationEntry) usableWith(sessionNonce tpm2.Nonce) bool {
+	return len(e.auth.NonceTPM) == 0 || bytes.Equal(e.auth.NonceTPM, sessionNonce)
+}
+
+// RefreshingSignedAuthorization is an implementation of [SignedAuthorizer] that wraps
+// another SignedAuthorizer and caches the authorizations that it returns, tracking their
+// remaining validity using the TPM's clock. Cached authorizations are reused by subsequent
+// executions of TPM2_PolicySigned assertions with the same auth key and policy ref until
+// they expire, at which point the wrapped SignedAuthorizer is invoked again with the
+// session nonce of the current session in order to obtain a fresh authorization. This is
+// useful for long-running loops of policy executions, where obtaining a new authorization
+// for every execution would be expensive.
+//
+// A cached authorization is only reused if it is not bound to a session, or if it is bound
+// to the session that it is being requested for.
+//
+// The expiration time of an authorization with a negative expiration is the timeout
+// returned from the TPM when the corresponding TPM2_PolicySigned assertion is executed,
+// which is supplied automatically via [SignedAuthorizationTimeoutReceiver] when this is
+// used with [NewTPMPolicyResources], or can be supplied with the tickets produced by the
+// assertion using [RefreshingSignedAuthorization.AddTickets]. Until the timeout is known,
+// the authorization is not reused. This assumes that the timeout is encoded as it is in the
+// reference implementation, which is the TPM time in milliseconds.
+//
+// The TPM doesn't return a timeout for authorizations with a positive expiration, so their
+// expiration time is estimated conservatively from the TPM time that is read before the
+// authorization is requested from the wrapped SignedAuthorizer, minus a margin of 1 second.
+// For authorizations that are bound to a session, the TPM measures the expiration time from
+// when the session was started or last restarted, so this estimate is only conservative if
+// the session was started or restarted after the authorization was requested.
+//
+// It is safe to call methods of RefreshingSignedAuthorization from multiple goroutines,
+// although it is the responsibility of the caller to ensure that the underlying
+// [tpm2.TPMContext] can be used safely in this way.
+type RefreshingSignedAuthorization struct {
+	authorizer SignedAuthorizer
+	readClock  func() (*tpm2.TimeInfo, error)
+
+	mu      sync.Mutex
+	entries map[authMapKey][]*refreshingSignedAuthorizationEntry
+}
+
+// NewRefreshingSignedAuthorization returns a new RefreshingSignedAuthorization that wraps
+// the supplied SignedAuthorizer and uses the supplied TPM context to read the TPM's clock.
+// The supplied sessions are used for the TPM2_ReadClock commands.
+func NewRefreshingSignedAuthorization(tpm *tpm2.TPMContext, authorizer SignedAuthorizer, sessions ...tpm2.SessionContext) *RefreshingSignedAuthorization {
+	return &RefreshingSignedAuthorization{
+		authorizer: authorizer,
+		readClock: func() (*tpm2.TimeInfo, error) {
+			return tpm.ReadClock(sessions...)
+		},
+		entries: make(map[authMapKey][]*refreshingSignedAuthorizationEntry),
+	}
+}
+
+func (a *RefreshingSignedAuthorization) now() (*tpm2.TimeInfo, error) {
+	now, err := a.readClock()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read TPM clock: %w", err)
+	}
+	return now, nil
+}
+
+func (a *RefreshingSignedAuthorization) entry(authKey tpm2.Name, policyRef tpm2.Nonce) *refreshingSignedAuthorizationEntry {
+	for _, e := range a.entries[makeAuthMapKey(authKey, policyRef)] {
+		if bytes.Equal(e.authKey, authKey) && bytes.Equal(e.policyRef, policyRef) {
+			return e
+		}
+	}
+	return nil
+}
+
+func (a *RefreshingSignedAuthorization) setEntry(entry *refreshingSignedAuthorizationEntry) {
+	key := makeAuthMapKey(entry.authKey, entry.policyRef)
+	for i, e := range a.entries[key] {
+		if bytes.Equal(e.authKey, entry.authKey) && bytes.Equal(e.policyRef, entry.policyRef) {
+			a.entries[key][i] = entry
+			return
+		}
+	}
+	a.entries[key] = append(a.entries[key], entry)
+}
+
+// SignedAuthorization implements [SignedAuthorizer.SignedAuthorization]. If there is a
+// cached authorization for the specified auth key and policy ref that has not expired and
+// that can be used with the specified session nonce, it is returned. Otherwise, a new
+// authorization is obtained from the wrapped SignedAuthorizer and cached.
+func (a *RefreshingSignedAuthorization) SignedAuthorization(sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now, err := a.now()
+	if err != nil {
+		return nil, err
+	}
+
+	if e := a.entry(authKey, policyRef); e != nil && !e.expired(now) && e.usableWith(sessionNonce) {
+		return e.auth, nil
+	}
+
+	auth, err := a.authorizer.SignedAuthorization(sessionAlg, sessionNonce, authKey, policyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &refreshingSignedAuthorizationEntry{
+		authKey:      authKey,
+		policyRef:    policyRef,
+		auth:         auth,
+		resetCount:   now.ClockInfo.ResetCount,
+		restartCount: now.ClockInfo.RestartCount,
+		issued:       now.Time,
+	}
+	switch {
+	case auth.Expiration < 0:
+		entry.timeoutPending = true
+	case auth.Expiration > 0:
+		entry.expiry = now.Time + uint64(auth.Expiration)*1000
+		if entry.expiry-now.Time > refreshingSignedAuthorizationExpiryMargin {
+			entry.expiry -= refreshingSignedAuthorizationExpiryMargin
+		} else {
+			// The authorization may have expired by the time that it is used,
+			// so it is never reused.
+			entry.expiry = now.Time
+		}
+	}
+	a.setEntry(entry)
+
+	return auth, nil
+}
+
+// SignedAuthorizationTimeout implements
+// [SignedAuthorizationTimeoutReceiver.SignedAuthorizationTimeout]. If the supplied
+// authorization is cached and the TPM returned a timeout, its expiration time is
+// updated to this timeout.
+func (a *RefreshingSignedAuthorization) SignedAuthorizationTimeout(authKey tpm2.Name, policyRef tpm2.Nonce, auth *PolicySignedAuthorization, timeout tpm2.Timeout) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(timeout) == 0 {
+		return
+	}
+	e := a.entry(authKey, policyRef)
+	if e == nil || e.auth != auth {
+		return
+	}
+	e.setTimeout(timeout)
+}
+
+// AddTickets updates the expiration times of cached authorizations using the timeouts
+// returned from the TPM in the supplied tickets, which are normally obtained from
+// [PolicyExecuteResult.NewTickets]. Tickets that don't correspond to a cached
+// authorization, or that have no timeout, are ignored.
+func (a *RefreshingSignedAuthorization) AddTickets(tickets ...*PolicyTicket) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, ticket := range tickets {
+		if ticket == nil || ticket.Ticket == nil || ticket.Ticket.Tag != tpm2.TagAuthSigned || len(ticket.Timeout) == 0 {
+			continue
+		}
+		e := a.entry(ticket.AuthName, ticket.PolicyRef)
+		if e == nil || !bytes.Equal(e.auth.CpHash, ticket.CpHash) {
+			continue
+		}
+		e.setTimeout(ticket.Timeout)
+	}
+}
+
+// RemainingValidity returns the remaining validity of the cached authorization for the
+// specified auth key and policy ref, according to the TPM's clock. If there is no cached
+// authorization or it has expired, this returns zero. If the cached authorization doesn't
+// expire, this returns [NoExpiration].
+func (a *RefreshingSignedAuthorization) RemainingValidity(authKey tpm2.Name, policyRef tpm2.Nonce) (time.Duration, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e := a.entry(authKey, policyRef)
+	if e == nil {
+		return 0, nil
+	}
+
+	now, err := a.now()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case e.expired(now):
+		return 0, nil
+	case e.expiry == 0:
+		return NoExpiration, nil
+	default:
+		return time.Duration(e.expiry-now.Time) * time.Millisecond, nil
+	}
+}
+
+// Invalidate removes the cached authorization for the specified auth key and policy ref,
+// so that a new one is obtained from the wrapped SignedAuthorizer the next time that one
+// is required. This is useful if the TPM rejects a cached authorization.
+func (a *RefreshingSignedAuthorization) Invalidate(authKey tpm2.Name, policyRef tpm2.Nonce) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := makeAuthMapKey(authKey, policyRef)
+	for i, e := range a.entries[key] {
+		if bytes.Equal(e.authKey, authKey) && bytes.Equal(e.policyRef, policyRef) {
+			a.entries[key] = append(a.entries[key][:i], a.entries[key][i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,480 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type refreshingSignedAuthorizationSuiteNoTPM struct {
+	key    *ecdsa.PrivateKey
+	pubKey *tpm2.Public
+
+	now    tpm2.TimeInfo
+	signed int
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) SetUpTest(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	s.key = key
+
+	s.pubKey, err = objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	s.now = tpm2.TimeInfo{Time: 10000}
+	s.signed = 0
+}
+
+var _ = Suite(&refreshingSignedAuthorizationSuiteNoTPM{})
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) newAuthorization(c *C, includeNonce bool, expiration int32) *RefreshingSignedAuthorization {
+	authorizer := &mockSignedAuthorizer{
+		signAuthorization: func(sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+			c.Check(authKey, DeepEquals, s.pubKey.Name())
+			s.signed++
+
+			params := &PolicySignedParams{Expiration: expiration}
+			if includeNonce {
+				params.NonceTPM = sessionNonce
+			}
+			return SignPolicySignedAuthorization(rand.Reader, params, s.pubKey, policyRef, s.key, tpm2.HashAlgorithmSHA256)
+		},
+	}
+
+	auth := NewRefreshingSignedAuthorization(nil, authorizer)
+	MockRefreshingSignedAuthorizationClock(auth, func() (*tpm2.TimeInfo, error) {
+		now := s.now
+		return &now, nil
+	})
+	return auth
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestReuse(c *C) {
+	auth := s.newAuthorization(c, true, 60)
+
+	a1, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a1.NonceTPM, DeepEquals, tpm2.Nonce("nonce"))
+
+	s.now.Time += 30000
+
+	a2, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a2, Equals, a1)
+	c.Check(s.signed, Equals, 1)
+
+	// The expiration time is estimated conservatively, with a margin of 1 second.
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, 29*time.Second)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestRefreshWithinMargin(c *C) {
+	auth := s.newAuthorization(c, true, 60)
+
+	a1, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	// The TPM would still accept the authorization, but it could expire before
+	// it is used.
+	s.now.Time += 59000
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, time.Duration(0))
+
+	a2, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a2, Not(Equals), a1)
+	c.Check(s.signed, Equals, 2)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestNoReuseShorterThanMargin(c *C) {
+	auth := s.newAuthorization(c, true, 1)
+
+	a1, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, time.Duration(0))
+
+	a2, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a2, Not(Equals), a1)
+	c.Check(s.signed, Equals, 2)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestRefreshAfterExpiry(c *C) {
+	auth := s.newAuthorization(c, true, 60)
+
+	a1, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce1"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	s.now.Time += 60000
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, time.Duration(0))
+
+	a2, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce2"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a2, Not(Equals), a1)
+	c.Check(a2.NonceTPM, DeepEquals, tpm2.Nonce("nonce2"))
+	c.Check(s.signed, Equals, 2)
+
+	ok, err := a2.Verify()
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+
+	remaining, err = auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, 59*time.Second)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestRefreshDifferentNonce(c *C) {
+	auth := s.newAuthorization(c, true, 60)
+
+	a1, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce1"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	a2, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce2"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a2, Not(Equals), a1)
+	c.Check(s.signed, Equals, 2)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestReuseUnboundDifferentNonce(c *C) {
+	auth := s.newAuthorization(c, false, 60)
+
+	a1, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce1"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	a2, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce2"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a2, Equals, a1)
+	c.Check(s.signed, Equals, 1)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestNoExpiration(c *C) {
+	auth := s.newAuthorization(c, true, 0)
+
+	a1, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	s.now.Time += 1000000
+
+	a2, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a2, Equals, a1)
+	c.Check(s.signed, Equals, 1)
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, NoExpiration)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestRefreshAfterReset(c *C) {
+	auth := s.newAuthorization(c, false, 60)
+
+	a1, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, nil, s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	s.now.Time = 10
+	s.now.ClockInfo.ResetCount++
+
+	a2, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, nil, s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a2, Not(Equals), a1)
+	c.Check(s.signed, Equals, 2)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestAddTickets(c *C) {
+	auth := s.newAuthorization(c, true, -60)
+
+	_, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	// The authorization isn't reused until the TPM returns a timeout.
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, time.Duration(0))
+
+	// The session was started 15 seconds before the authorization was obtained.
+	auth.AddTickets(&PolicyTicket{
+		AuthName:  s.pubKey.Name(),
+		PolicyRef: []byte("foo"),
+		Timeout:   mu.MustMarshalToBytes(uint64(55000)),
+		Ticket:    &tpm2.TkAuth{Tag: tpm2.TagAuthSigned, Hierarchy: tpm2.HandleOwner}})
+
+	remaining, err = auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, 45*time.Second)
+
+	s.now.Time += 45000
+
+	_, err = auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(s.signed, Equals, 2)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestAddTicketsIgnoresUnrelated(c *C) {
+	auth := s.newAuthorization(c, true, -60)
+
+	_, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	auth.AddTickets(&PolicyTicket{
+		AuthName:  s.pubKey.Name(),
+		PolicyRef: []byte("bar"),
+		Timeout:   mu.MustMarshalToBytes(uint64(11000)),
+		Ticket:    &tpm2.TkAuth{Tag: tpm2.TagAuthSigned, Hierarchy: tpm2.HandleOwner}})
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, time.Duration(0))
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestRefreshAfterTimeoutWithFixedNonce(c *C) {
+	auth := s.newAuthorization(c, true, -60)
+
+	a1, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	// The session was started 15 seconds before the authorization was obtained,
+	// so the TPM returns a timeout that is earlier than the requested expiration.
+	auth.SignedAuthorizationTimeout(s.pubKey.Name(), []byte("foo"), a1, mu.MustMarshalToBytes(uint64(55000)))
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, 45*time.Second)
+
+	s.now.Time += 30000
+
+	a2, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a2, Equals, a1)
+	c.Check(s.signed, Equals, 1)
+
+	// The session nonce hasn't changed, so the authorization is only refreshed
+	// because the TPM timeout has passed.
+	s.now.Time += 15000
+
+	a3, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(a3, Not(Equals), a1)
+	c.Check(a3.NonceTPM, DeepEquals, tpm2.Nonce("nonce"))
+	c.Check(s.signed, Equals, 2)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestSignedAuthorizationTimeoutViaTPMPolicyResources(c *C) {
+	auth := s.newAuthorization(c, true, -60)
+	resources := NewTPMPolicyResources(nil, nil, &TPMPolicyResourcesParams{SignedAuthorizer: auth})
+
+	a, err := resources.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	receiver, ok := resources.(SignedAuthorizationTimeoutReceiver)
+	c.Assert(ok, internal_testutil.IsTrue)
+	receiver.SignedAuthorizationTimeout(s.pubKey.Name(), []byte("foo"), a, mu.MustMarshalToBytes(uint64(40000)))
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, 30*time.Second)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestSignedAuthorizationTimeoutViaCallbackPolicyResources(c *C) {
+	auth := s.newAuthorization(c, true, -60)
+	resources := NewCallbackPolicyResources(func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+		return nil, nil
+	}, NewTPMPolicyResources(nil, nil, &TPMPolicyResourcesParams{SignedAuthorizer: auth}))
+
+	a, err := resources.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	receiver, ok := resources.(SignedAuthorizationTimeoutReceiver)
+	c.Assert(ok, internal_testutil.IsTrue)
+	receiver.SignedAuthorizationTimeout(s.pubKey.Name(), []byte("foo"), a, mu.MustMarshalToBytes(uint64(40000)))
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, 30*time.Second)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestSignedAuthorizationTimeoutIgnoresOtherAuthorizations(c *C) {
+	auth := s.newAuthorization(c, true, -60)
+
+	_, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	auth.SignedAuthorizationTimeout(s.pubKey.Name(), []byte("foo"), new(PolicySignedAuthorization), mu.MustMarshalToBytes(uint64(40000)))
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, time.Duration(0))
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestInvalidate(c *C) {
+	auth := s.newAuthorization(c, true, 60)
+
+	_, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+
+	auth.Invalidate(s.pubKey.Name(), []byte("foo"))
+
+	remaining, err := auth.RemainingValidity(s.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, time.Duration(0))
+
+	_, err = auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Assert(err, IsNil)
+	c.Check(s.signed, Equals, 2)
+}
+
+func (s *refreshingSignedAuthorizationSuiteNoTPM) TestClockError(c *C) {
+	auth := s.newAuthorization(c, true, 60)
+	MockRefreshingSignedAuthorizationClock(auth, func() (*tpm2.TimeInfo, error) {
+		return nil, errors.New("some error")
+	})
+
+	_, err := auth.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), s.pubKey.Name(), []byte("foo"))
+	c.Check(err, ErrorMatches, `cannot read TPM clock: some error`)
+	c.Check(s.signed, Equals, 0)
+}
+
+type refreshingSignedAuthorizationSuite struct {
+	testutil.TPMTest
+}
+
+func (s *refreshingSignedAuthorizationSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&refreshingSignedAuthorizationSuite{})
+
+func (s *refreshingSignedAuthorizationSuite) TestRefreshAfterExpiry(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	pubKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(pubKey, []byte("foo"))
+	expectedDigest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	var signed int
+	authorizer := &mockSignedAuthorizer{
+		signAuthorization: func(sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+			signed++
+			return SignPolicySignedAuthorization(rand.Reader, &PolicySignedParams{
+				NonceTPM:   sessionNonce,
+				Expiration: 100,
+			}, pubKey, policyRef, key, tpm2.HashAlgorithmSHA256)
+		},
+	}
+
+	auth := NewRefreshingSignedAuthorization(s.TPM, authorizer)
+	var offset uint64
+	MockRefreshingSignedAuthorizationClock(auth, func() (*tpm2.TimeInfo, error) {
+		now, err := s.TPM.ReadClock()
+		if err != nil {
+			return nil, err
+		}
+		now.Time += offset
+		return now, nil
+	})
+
+	resources := NewTPMPolicyResources(s.TPM, nil, &TPMPolicyResourcesParams{SignedAuthorizer: auth})
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	for i := 0; i < 2; i++ {
+		c.Check(s.TPM.PolicyRestart(session), IsNil)
+		_, err = policy.Execute(NewTPMPolicySession(s.TPM, session), resources, NewTPMHelper(s.TPM, nil), nil)
+		c.Check(err, IsNil)
+
+		digest, err := s.TPM.PolicyGetDigest(session)
+		c.Check(err, IsNil)
+		c.Check(digest, DeepEquals, expectedDigest)
+	}
+	c.Check(signed, Equals, 1)
+
+	remaining, err := auth.RemainingValidity(pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining > 0, internal_testutil.IsTrue)
+	c.Check(remaining <= 100*time.Second, internal_testutil.IsTrue)
+
+	// Force the cached authorization to expire.
+	offset = 100 * 1000
+
+	remaining, err = auth.RemainingValidity(pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining, Equals, time.Duration(0))
+
+	session = s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	_, err = policy.Execute(NewTPMPolicySession(s.TPM, session), resources, NewTPMHelper(s.TPM, nil), nil)
+	c.Check(err, IsNil)
+	c.Check(signed, Equals, 2)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *refreshingSignedAuthorizationSuite) TestUsesTimeoutFromTPM(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	pubKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(pubKey, []byte("foo"))
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	authorizer := &mockSignedAuthorizer{
+		signAuthorization: func(sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+			return SignPolicySignedAuthorization(rand.Reader, &PolicySignedParams{
+				NonceTPM:   sessionNonce,
+				Expiration: -100,
+			}, pubKey, policyRef, key, tpm2.HashAlgorithmSHA256)
+		},
+	}
+
+	auth := NewRefreshingSignedAuthorization(s.TPM, authorizer)
+	resources := NewTPMPolicyResources(s.TPM, nil, &TPMPolicyResourcesParams{SignedAuthorizer: auth})
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	result, err := policy.Execute(NewTPMPolicySession(s.TPM, session), resources, NewTPMHelper(s.TPM, nil), nil)
+	c.Assert(err, IsNil)
+	c.Assert(result.NewTickets, internal_testutil.LenEquals, 1)
+
+	// The expiration time comes from the timeout returned by the TPM, without
+	// having to supply the ticket.
+	now, err := s.TPM.ReadClock()
+	c.Assert(err, IsNil)
+	expected := time.Duration(result.NewTickets[0].Timeout.Value()-now.Time) * time.Millisecond
+
+	remaining, err := auth.RemainingValidity(pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(remaining > 0, internal_testutil.IsTrue)
+	c.Check(remaining <= expected, internal_testutil.IsTrue)
+}
@@ -0,0 +1,228 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// resourceUsage tracks the transient objects and sessions that are loaded on the TPM
+// by a single call to [Policy.Execute], including those that are loaded whilst
+// authorizing other resources. It records the peak usage and, if limits are enabled,
+// evicts loaded transient objects that aren't being used in order to make space for
+// new ones.
+type resourceUsage struct {
+	tpm                TPMHelper
+	limitsEnabled      bool
+	failOnSessionLimit bool
+	limitsRead         bool
+	maxTransient       int
+	maxSessions        int
+
+	// loaded contains the transient objects that are currently loaded,
+	// with the least recently used one first.
+	loaded []*trackedResourceContext
+
+	transient     int
+	peakTransient int
+	sessions      int
+	peakSessions  int
+}
+
+func newResourceUsage(tpm TPMHelper, limitsEnabled, failOnSessionLimit bool) *resourceUsage {
+	// The session used to execute the policy is already loaded.
+	return &resourceUsage{
+		tpm:                tpm,
+		limitsEnabled:      limitsEnabled,
+		failOnSessionLimit: failOnSessionLimit,
+		sessions:           1,
+		peakSessions:       1,
+	}
+}
+
+func (u *resourceUsage) readLimits() {
+	if !u.limitsEnabled || u.limitsRead {
+		return
+	}
+	u.limitsRead = true
+
+	// The limits can only be read if the TPMHelper implements the optional
+	// TPMPropertyReader interface. A zero limit means that there is no limit,
+	// so errors are ignored here.
+	props, ok := u.tpm.(TPMPropertyReader)
+	if !ok {
+		return
+	}
+	if n, err := props.GetCapabilityTPMProperty(tpm2.PropertyHRTransientMin); err == nil {
+		u.maxTransient = int(n)
+	}
+	if n, err := props.GetCapabilityTPMProperty(tpm2.PropertyActiveSessionsMax); err == nil {
+		u.maxSessions = int(n)
+	}
+}
+
+func (u *resourceUsage) touch(r *trackedResourceContext) {
+	for i, loaded := range u.loaded {
+		if loaded != r {
+			continue
+		}
+		copy(u.loaded[i:], u.loaded[i+1:])
+		u.loaded[len(u.loaded)-1] = r
+		return
+	}
+}
+
+func (u *resourceUsage) remove(r *trackedResourceContext) {
+	for i, loaded := range u.loaded {
+		if loaded != r {
+			continue
+		}
+		u.loaded = append(u.loaded[:i], u.loaded[i+1:]...)
+		return
+	}
+}
+
+// makeSpaceForTransient evicts the least recently used transient objects until there
+// is space to load the specified number of new transient objects, or until there is
+// nothing left to evict.
+func (u *resourceUsage) makeSpaceForTransient(n int) {
+	u.readLimits()
+	if u.maxTransient == 0 {
+		return
+	}
+	for i := 0; i < len(u.loaded) && u.transient+n > u.maxTransient; {
+		if !u.loaded[i].evict() {
+			// This object can't be evicted, so try the next one.
+			i++
+		}
+	}
+}
+
+// trackTransient returns a wrapper for the supplied transient object, which is used
+// to track its usage.
+func (u *resourceUsage) trackTransient(resources PolicyResources, resource ResourceContext) ResourceContext {
+	r := &trackedResourceContext{
+		usage:     u,
+		resources: resources,
+		resource:  resource,
+		last:      resource.Resource(),
+		policy:    resource.Policy(),
+	}
+	u.loaded = append(u.loaded, r)
+	u.transientLoaded()
+	return r
+}
+
+func (u *resourceUsage) transientLoaded() {
+	u.transient++
+	if u.transient > u.peakTransient {
+		u.peakTransient = u.transient
+	}
+}
+
+// startSession indicates that a new session is about to be started. If failOnSessionLimit
+// is set, it returns an error if this would exceed the maximum number of active sessions.
+// Otherwise, the session is started regardless and the TPM is left to decide whether there
+// is space for it, as the policy session is already context saved whilst loading resources.
+func (u *resourceUsage) startSession() error {
+	u.readLimits()
+	if u.failOnSessionLimit && u.maxSessions > 0 && u.sessions >= u.maxSessions {
+		return fmt.Errorf("the maximum number of active sessions (%d) has been reached", u.maxSessions)
+	}
+	u.sessions++
+	if u.sessions > u.peakSessions {
+		u.peakSessions = u.sessions
+	}
+	return nil
+}
+
+// trackSession returns a wrapper for the supplied session, which must have been
+// started after a call to startSession.
+func (u *resourceUsage) trackSession(session SessionContext) SessionContext {
+	return &trackedSessionContext{SessionContext: session, usage: u}
+}
+
+// trackedResourceContext is a transient object that can be evicted from the TPM
+// whilst it isn't being used, and which is reloaded on demand.
+type trackedResourceContext struct {
+	usage     *resourceUsage
+	resources PolicyResources
+
+	resource ResourceContext      // the loaded resource, or nil if it has been evicted
+	context  *tpm2.Context        // the saved context if the resource has been evicted
+	last     tpm2.ResourceContext // the last loaded resource
+	policy   *Policy
+	flushed  bool
+}
+
+func (r *trackedResourceContext) evict() bool {
+	context := r.resources.ContextSave(r.resource.Resource())
+	if context == nil {
+		return false
+	}
+	r.resource.Flush()
+	r.resource = nil
+	r.context = context
+	r.usage.remove(r)
+	r.usage.transient--
+	return true
+}
+
+func (r *trackedResourceContext) Resource() tpm2.ResourceContext {
+	switch {
+	case r.flushed:
+	case r.resource != nil:
+		r.usage.touch(r)
+	default:
+		r.usage.makeSpaceForTransient(1)
+		resource, err := contextLoad(r.resources, r.context, r.policy)
+		if err != nil {
+			// Return the previous context. This will fail when it is used.
+			break
+		}
+		r.resource = resource
+		r.context = nil
+		r.last = resource.Resource()
+		r.usage.loaded = append(r.usage.loaded, r)
+		r.usage.transientLoaded()
+	}
+	return r.last
+}
+
+func (r *trackedResourceContext) Policy() *Policy {
+	return r.policy
+}
+
+func (r *trackedResourceContext) Flush() {
+	if r.flushed {
+		return
+	}
+	r.flushed = true
+	r.context = nil
+	if r.resource == nil {
+		return
+	}
+	r.resource.Flush()
+	r.resource = nil
+	r.usage.remove(r)
+	r.usage.transient--
+}
+
+type trackedSessionContext struct {
+	SessionContext
+	usage   *resourceUsage
+	flushed bool
+}
+
+func (s *trackedSessionContext) Flush() {
+	if s.flushed {
+		return
+	}
+	s.flushed = true
+	s.SessionContext.Flush()
+	s.usage.sessions--
+}
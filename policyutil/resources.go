@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 
 	"github.com/canonical/go-tpm2"
@@ -61,7 +62,8 @@ type PolicyResources interface {
 	ContextSave(resource tpm2.ResourceContext) *tpm2.Context
 
 	// ContextLoad loads the supplied context and returns a transient handle. This will return
-	// nil if the context can't be loaded or isn't a transient resource.
+	// nil if the context can't be loaded or isn't a transient resource. Implementations can
+	// implement [ErrorContextLoader] to return more detailed errors.
 	ContextLoad(context *tpm2.Context, policy *Policy) ResourceContext
 
 	// ExternalSensitive returns the sensitive area associated with the supplied name, to be
@@ -84,6 +86,79 @@ type SignedAuthorizer interface {
 	SignedAuthorization(sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error)
 }
 
+// RandSignedAuthorizer is an optional interface that can be implemented by a
+// [SignedAuthorizer] or a [PolicyResources] implementation in order to use the
+// source of randomness supplied via PolicyExecuteParams.SignedAuthorizationRand when signing
+// authorizations for TPM2_PolicySigned assertions.
+type RandSignedAuthorizer interface {
+	// SignedAuthorizationWithRand signs a TPM2_PolicySigned authorization for the
+	// specified key, policy ref and session nonce, using the supplied source of
+	// randomness.
+	SignedAuthorizationWithRand(rand io.Reader, sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error)
+}
+
+// signedAuthorizationWithRand obtains a signed authorization from the supplied
+// authorizer, using the supplied source of randomness if the authorizer implements
+// [RandSignedAuthorizer].
+func signedAuthorizationWithRand(authorizer SignedAuthorizer, rand io.Reader, sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+	if r, ok := authorizer.(RandSignedAuthorizer); ok && rand != nil {
+		return r.SignedAuthorizationWithRand(rand, sessionAlg, sessionNonce, authKey, policyRef)
+	}
+	return authorizer.SignedAuthorization(sessionAlg, sessionNonce, authKey, policyRef)
+}
+
+// ErrorContextLoader is an optional interface that can be implemented by a
+// [PolicyResources] implementation in order to return an error when a saved
+// context can't be loaded.
+type ErrorContextLoader interface {
+	// ContextLoadWithError loads the supplied context and returns a transient handle.
+	// This should return an error if the context can't be loaded or isn't a transient
+	// resource. If the TPM rejects the context because it is no longer valid (eg,
+	// because the TPM has been reset since the context was saved), the returned error
+	// should wrap the *[tpm2.TPMError] so that the caller can detect this and reload
+	// the resource from its source instead.
+	ContextLoadWithError(context *tpm2.Context, policy *Policy) (ResourceContext, error)
+}
+
+// errContextNotLoaded is returned from contextLoad when a [PolicyResources]
+// implementation that doesn't implement [ErrorContextLoader] fails to load a
+// context.
+var errContextNotLoaded = errors.New("context could not be loaded")
+
+// contextLoad loads the supplied context using the supplied resources, using
+// [ErrorContextLoader] if it is implemented.
+func contextLoad(resources PolicyResources, context *tpm2.Context, policy *Policy) (ResourceContext, error) {
+	if l, ok := resources.(ErrorContextLoader); ok {
+		return l.ContextLoadWithError(context, policy)
+	}
+	resource := resources.ContextLoad(context, policy)
+	if resource == nil {
+		return nil, errContextNotLoaded
+	}
+	return resource, nil
+}
+
+// SignedAuthorizationTimeoutReceiver is an optional interface that can be implemented
+// by a [SignedAuthorizer] or a [PolicyResources] implementation in order to receive
+// the timeout returned from the TPM when a TPM2_PolicySigned assertion is executed
+// with an authorization that it supplied.
+type SignedAuthorizationTimeoutReceiver interface {
+	// SignedAuthorizationTimeout is called after a TPM2_PolicySigned assertion for
+	// the specified key and policy ref has been executed successfully with the
+	// supplied authorization. The timeout is the one returned from the TPM, and is
+	// empty if the TPM didn't return one.
+	SignedAuthorizationTimeout(authKey tpm2.Name, policyRef tpm2.Nonce, auth *PolicySignedAuthorization, timeout tpm2.Timeout)
+}
+
+// signedAuthorizationTimeout supplies the timeout returned from the TPM for the
+// supplied authorization to the supplied authorizer if it implements
+// [SignedAuthorizationTimeoutReceiver].
+func signedAuthorizationTimeout(authorizer interface{}, authKey tpm2.Name, policyRef tpm2.Nonce, auth *PolicySignedAuthorization, timeout tpm2.Timeout) {
+	if r, ok := authorizer.(SignedAuthorizationTimeoutReceiver); ok {
+		r.SignedAuthorizationTimeout(authKey, policyRef, auth, timeout)
+	}
+}
+
 type ExternalSensitiveResources interface {
 	ExternalSensitive(name tpm2.Name) (*tpm2.Sensitive, error)
 }
@@ -95,6 +170,11 @@ type NVAuthorizedPolicy struct {
 
 // PersistentResource contains details associated with a persistent object or
 // NV index.
+//
+// The handle can also be the handle of a transient object that is already loaded
+// and that can't be loaded again from a [TransientResource], such as a primary
+// object in the NULL hierarchy, which can't be made persistent either. Note that
+// such an object can't be used once it has been flushed from the TPM.
 type PersistentResource struct {
 	Name   tpm2.Name
 	Handle tpm2.Handle
@@ -253,8 +333,12 @@ func NewTPMPolicyResources(tpm *tpm2.TPMContext, data *PolicyResourcesData, para
 }
 
 func (r *tpmPolicyResources) LoadedResource(name tpm2.Name, policyParams *LoadPolicyParams) (ResourceContext, []*PolicyTicket, []*PolicyTicket, error) {
-	if name.Type() == tpm2.NameTypeHandle && (name.Handle().Type() == tpm2.HandleTypePCR || name.Handle().Type() == tpm2.HandleTypePermanent) {
-		return newResourceContext(r.tpm.GetPermanentContext(name.Handle()), nil), nil, nil, nil
+	if name.Type() == tpm2.NameTypeHandle {
+		switch name.Handle().Type() {
+		case tpm2.HandleTypePCR, tpm2.HandleTypePermanent:
+			// This includes the NULL hierarchy (TPM_RH_NULL).
+			return newResourceContext(r.tpm.GetPermanentContext(name.Handle()), nil), nil, nil, nil
+		}
 	}
 
 	// Search persistent resources
@@ -264,10 +348,16 @@ func (r *tpmPolicyResources) LoadedResource(name tpm2.Name, policyParams *LoadPo
 		}
 
 		rc, err := r.tpm.NewResourceContext(resource.Handle, r.sessions...)
-		if err != nil {
+		switch {
+		case resource.Handle.Type() == tpm2.HandleTypeTransient && tpm2.IsResourceUnavailableError(err, resource.Handle):
+			return nil, nil, nil, fmt.Errorf("transient object with handle %v has been flushed and cannot be reloaded", resource.Handle)
+		case err != nil:
 			return nil, nil, nil, err
 		}
 		if !bytes.Equal(rc.Name(), name) {
+			if resource.Handle.Type() == tpm2.HandleTypeTransient {
+				return nil, nil, nil, fmt.Errorf("transient object with handle %v has the wrong name (%#x) - the original object may have been flushed", resource.Handle, rc.Name())
+			}
 			return nil, nil, nil, fmt.Errorf("persistent TPM resource has the wrong name (%#x)", rc.Name())
 		}
 
@@ -282,6 +372,12 @@ func (r *tpmPolicyResources) LoadedResource(name tpm2.Name, policyParams *LoadPo
 
 		// After this point, the loop always exits and we return.
 
+		if object.ParentName.Type() == tpm2.NameTypeHandle {
+			// Objects that are children of a hierarchy, including the NULL
+			// hierarchy, are primary objects which can't be loaded with TPM2_Load.
+			return nil, nil, nil, fmt.Errorf("cannot load object with name %#x: the parent is a hierarchy", name)
+		}
+
 		parent, newTickets, invalidTickets, err := r.LoadedResource(object.ParentName, policyParams)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("cannot load parent with name %#x: %w", object.ParentName, err)
@@ -453,21 +549,38 @@ func (r *tpmPolicyResources) SignedAuthorization(sessionAlg tpm2.HashAlgorithmId
 	return r.signedAuthorizer.SignedAuthorization(sessionAlg, sessionNonce, authKey, policyRef)
 }
 
+func (r *tpmPolicyResources) SignedAuthorizationWithRand(rand io.Reader, sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+	if r.signedAuthorizer == nil {
+		return nil, errors.New("no SignedAuthorizer")
+	}
+	return signedAuthorizationWithRand(r.signedAuthorizer, rand, sessionAlg, sessionNonce, authKey, policyRef)
+}
+
+func (r *tpmPolicyResources) SignedAuthorizationTimeout(authKey tpm2.Name, policyRef tpm2.Nonce, auth *PolicySignedAuthorization, timeout tpm2.Timeout) {
+	signedAuthorizationTimeout(r.signedAuthorizer, authKey, policyRef, auth, timeout)
+}
+
 func (r *tpmPolicyResources) ContextSave(resource tpm2.ResourceContext) *tpm2.Context {
 	context, _ := r.tpm.ContextSave(resource)
 	return context
 }
 
 func (r *tpmPolicyResources) ContextLoad(context *tpm2.Context, policy *Policy) ResourceContext {
+	resource, _ := r.ContextLoadWithError(context, policy)
+	return resource
+}
+
+func (r *tpmPolicyResources) ContextLoadWithError(context *tpm2.Context, policy *Policy) (ResourceContext, error) {
 	hc, err := r.tpm.ContextLoad(context)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	rc, ok := hc.(tpm2.ResourceContext)
 	if !ok {
-		return nil
+		r.tpm.FlushContext(hc)
+		return nil, errors.New("context is not a transient resource")
 	}
-	return newTpmResourceContextFlushable(r.tpm, rc, policy)
+	return newTpmResourceContextFlushable(r.tpm, rc, policy), nil
 }
 
 func (r *tpmPolicyResources) ExternalSensitive(name tpm2.Name) (*tpm2.Sensitive, error) {
@@ -511,10 +624,80 @@ func (*nullPolicyResources) ExternalSensitive(name tpm2.Name) (*tpm2.Sensitive,
 	return nil, errors.New("no PolicyResources")
 }
 
+// AuthorizedPoliciesFn is a callback used by [NewCallbackPolicyResources] to obtain
+// the policies that are signed by the key with the specified name, appropriate for a
+// TPM2_PolicyAuthorize assertion with the specified reference. Returning no policies
+// isn't an error.
+type AuthorizedPoliciesFn func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error)
+
+type callbackPolicyResources struct {
+	PolicyResources
+	authorizedPolicies AuthorizedPoliciesFn
+	cache              map[authMapKey][]*Policy
+}
+
+// NewCallbackPolicyResources returns a PolicyResources implementation that obtains
+// authorized policies on demand using the supplied callback, rather than from a static
+// list. The result of the callback is cached for each combination of signing key and
+// policy reference, including when it returns no policies, so that the callback is only
+// called once for each combination. Errors returned from the callback aren't cached.
+//
+// All other methods are delegated to the supplied resources. If this is nil, then
+// these methods behave as if no resources were supplied to [Policy.Execute].
+func NewCallbackPolicyResources(authorizedPolicies AuthorizedPoliciesFn, resources PolicyResources) PolicyResources {
+	if resources == nil {
+		resources = new(nullPolicyResources)
+	}
+	return &callbackPolicyResources{
+		PolicyResources:    resources,
+		authorizedPolicies: authorizedPolicies,
+		cache:              make(map[authMapKey][]*Policy),
+	}
+}
+
+func (r *callbackPolicyResources) AuthorizedPolicies(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+	key := makeAuthMapKey(keySign, policyRef)
+	if policies, exists := r.cache[key]; exists {
+		return policies, nil
+	}
+
+	policies, err := r.authorizedPolicies(keySign, policyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache[key] = policies
+	return policies, nil
+}
+
+func (r *callbackPolicyResources) SignedAuthorizationWithRand(rand io.Reader, sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+	return signedAuthorizationWithRand(r.PolicyResources, rand, sessionAlg, sessionNonce, authKey, policyRef)
+}
+
+func (r *callbackPolicyResources) ContextLoadWithError(context *tpm2.Context, policy *Policy) (ResourceContext, error) {
+	return contextLoad(r.PolicyResources, context, policy)
+}
+
+func (r *callbackPolicyResources) SignedAuthorizationTimeout(authKey tpm2.Name, policyRef tpm2.Nonce, auth *PolicySignedAuthorization, timeout tpm2.Timeout) {
+	signedAuthorizationTimeout(r.PolicyResources, authKey, policyRef, auth, timeout)
+}
+
 type policyResources interface {
 	loadedResource(name tpm2.Name) (ResourceContext, error)
 	authorizedPolicies(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error)
 	signedAuthorization(authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error)
+	signedAuthorizationTimeout(authKey tpm2.Name, policyRef tpm2.Nonce, auth *PolicySignedAuthorization, timeout tpm2.Timeout)
+}
+
+// isStaleContextError indicates whether the supplied error was returned from
+// TPM2_ContextLoad because the saved context is no longer valid, either because
+// its integrity check failed (eg, because the TPM has been reset since it was
+// saved), it refers to a session that no longer exists, or the context gap has
+// been exceeded.
+func isStaleContextError(err error) bool {
+	return tpm2.IsTPMError(err, tpm2.ErrorIntegrity, tpm2.CommandContextLoad) ||
+		tpm2.IsTPMError(err, tpm2.ErrorHandle, tpm2.CommandContextLoad) ||
+		tpm2.IsTPMWarning(err, tpm2.WarningContextGap, tpm2.CommandContextLoad)
 }
 
 type cachedResourceType int
@@ -527,8 +710,19 @@ const (
 
 type cachedResource struct {
 	typ    cachedResourceType
+	name   tpm2.Name
 	data   []byte
 	policy *Policy
+
+	// unverified indicates that this entry was restored from a
+	// PolicyResourcesCache and hasn't been checked against the TPM yet.
+	unverified bool
+}
+
+type cachedAuthorizedPolicies struct {
+	keySign   tpm2.Name
+	policyRef tpm2.Nonce
+	policies  []*Policy
 }
 
 type nameMapKey uint32
@@ -546,19 +740,63 @@ type executePolicyResources struct {
 	ignoreAuthorizations []PolicyAuthorizationID
 	ignoreNV             []Named
 
+	checkSignedAuthorizationNonces bool
+	rand                           io.Reader // used to sign authorizations for TPM2_PolicySigned assertions
+	resourceResolver               func(tpm2.Name) (tpm2.Name, bool)
+	tpm                            TPMHelper // used to verify entries restored from a PolicyResourcesCache
+
 	cachedResources          map[nameMapKey]cachedResource
-	cachedAuthorizedPolicies map[authMapKey][]*Policy
+	cachedAuthorizedPolicies map[authMapKey]cachedAuthorizedPolicies
+	preloaded                map[nameMapKey]ResourceContext
+
+	usage *resourceUsage
 }
 
-func newExecutePolicyResources(session SessionContext, resources PolicyResources, tickets *executePolicyTickets, ignoreAuthorizations []PolicyAuthorizationID, ignoreNV []Named) *executePolicyResources {
+func newExecutePolicyResources(session SessionContext, resources PolicyResources, tickets *executePolicyTickets, ignoreAuthorizations []PolicyAuthorizationID, ignoreNV []Named, usage *resourceUsage) *executePolicyResources {
 	return &executePolicyResources{
 		session:                  session,
 		resources:                resources,
 		tickets:                  tickets,
 		ignoreAuthorizations:     ignoreAuthorizations,
 		ignoreNV:                 ignoreNV,
+		usage:                    usage,
 		cachedResources:          make(map[nameMapKey]cachedResource),
-		cachedAuthorizedPolicies: make(map[authMapKey][]*Policy),
+		cachedAuthorizedPolicies: make(map[authMapKey]cachedAuthorizedPolicies),
+		preloaded:                make(map[nameMapKey]ResourceContext),
+	}
+}
+
+// preloadedResourceContext is returned from executePolicyResources.loadedResource
+// for preloaded resources. These are flushed by executePolicyResources.flushPreloaded
+// rather than by the assertions that use them.
+type preloadedResourceContext struct {
+	ResourceContext
+}
+
+func (*preloadedResourceContext) Flush() {}
+
+// preload loads the resources with the supplied names, so that they can be reused by
+// the assertions that require them.
+func (r *executePolicyResources) preload(names []tpm2.Name) error {
+	for _, name := range names {
+		key := makeNameMapKey(name)
+		if _, exists := r.preloaded[key]; exists {
+			continue
+		}
+		resource, err := r.loadedResource(name)
+		if err != nil {
+			return &ResourceLoadError{Name: name, err: err}
+		}
+		r.preloaded[key] = resource
+	}
+	return nil
+}
+
+// flushPreloaded flushes any resources that were loaded by preload.
+func (r *executePolicyResources) flushPreloaded() {
+	for key, resource := range r.preloaded {
+		resource.Flush()
+		delete(r.preloaded, key)
 	}
 }
 
@@ -584,30 +822,57 @@ func (r *executePolicyResources) policy(name tpm2.Name) (*Policy, error) {
 
 	r.cachedResources[makeNameMapKey(name)] = cachedResource{
 		typ:    cachedResourceTypePolicy,
+		name:   name,
 		policy: policy,
 	}
 	return policy, nil
 }
 
 func (r *executePolicyResources) loadedResource(name tpm2.Name) (ResourceContext, error) {
+	if resource, exists := r.preloaded[makeNameMapKey(name)]; exists {
+		return &preloadedResourceContext{ResourceContext: resource}, nil
+	}
+
 	if cached, exists := r.cachedResources[makeNameMapKey(name)]; exists {
 		switch cached.typ {
 		case cachedResourceTypeResource:
 			if hc, _, err := tpm2.NewHandleContextFromBytes(cached.data); err == nil {
 				if resource, ok := hc.(tpm2.ResourceContext); ok {
-					return newResourceContext(resource, cached.policy), nil
+					if !cached.unverified {
+						return newResourceContext(resource, cached.policy), nil
+					}
+					if err := r.verifyCachedResource(name, resource); err == nil {
+						cached.unverified = false
+						r.cachedResources[makeNameMapKey(name)] = cached
+						return newResourceContext(resource, cached.policy), nil
+					}
+					// The cached entry is stale, so discard it and load the
+					// resource from its source again.
+					delete(r.cachedResources, makeNameMapKey(name))
 				}
 			}
 		case cachedResourceTypeContext:
 			var context *tpm2.Context
 			if _, err := mu.UnmarshalFromBytes(cached.data, &context); err == nil {
-				if resource := r.resources.ContextLoad(context, cached.policy); resource != nil {
-					return resource, nil
+				r.usage.makeSpaceForTransient(1)
+				resource, err := contextLoad(r.resources, context, cached.policy)
+				switch {
+				case err == errContextNotLoaded || isStaleContextError(err):
+					// The saved context is no longer valid, so discard it and
+					// load the resource from its source again.
+					delete(r.cachedResources, makeNameMapKey(name))
+				case err != nil:
+					return nil, fmt.Errorf("cannot load saved context: %w", err)
+				default:
+					return r.usage.trackTransient(r.resources, resource), nil
 				}
 			}
 		}
 	}
 
+	// Loading a transient object might require its parent to be loaded as well.
+	r.usage.makeSpaceForTransient(2)
+
 	// Save the current policy session to make space for others that might be loaded
 	restore, err := r.session.Save()
 	if err != nil {
@@ -624,10 +889,23 @@ func (r *executePolicyResources) loadedResource(name tpm2.Name) (ResourceContext
 		IgnoreAuthorizations: r.ignoreAuthorizations,
 		IgnoreNV:             r.ignoreNV,
 	}
-	resource, newTickets, invalidTickets, err := r.resources.LoadedResource(name, params)
+	loadName := name
+	resolved := false
+	if r.resourceResolver != nil {
+		loadName, resolved = r.resourceResolver(name)
+		if !resolved {
+			loadName = name
+		}
+	}
+
+	resource, newTickets, invalidTickets, err := r.resources.LoadedResource(loadName, params)
 	if err != nil {
 		return nil, err
 	}
+	if resolved && !bytes.Equal(resource.Resource().Name(), name) {
+		resource.Flush()
+		return nil, fmt.Errorf("resource resolved for name %#x has the wrong name (%#x)", name, resource.Resource().Name())
+	}
 
 	switch resource.Resource().Handle().Type() {
 	case tpm2.HandleTypeTransient:
@@ -635,13 +913,16 @@ func (r *executePolicyResources) loadedResource(name tpm2.Name) (ResourceContext
 		if context := r.resources.ContextSave(resource.Resource()); context != nil {
 			r.cachedResources[makeNameMapKey(name)] = cachedResource{
 				typ:    cachedResourceTypeContext,
+				name:   name,
 				data:   mu.MustMarshalToBytes(context),
 				policy: policy,
 			}
 		}
+		resource = r.usage.trackTransient(r.resources, resource)
 	default:
 		r.cachedResources[makeNameMapKey(name)] = cachedResource{
 			typ:    cachedResourceTypeResource,
+			name:   name,
 			data:   resource.Resource().SerializeToBytes(),
 			policy: resource.Policy(),
 		}
@@ -658,8 +939,8 @@ func (r *executePolicyResources) loadedResource(name tpm2.Name) (ResourceContext
 }
 
 func (r *executePolicyResources) authorizedPolicies(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
-	if policies, exists := r.cachedAuthorizedPolicies[makeAuthMapKey(keySign, policyRef)]; exists {
-		return policies, nil
+	if cached, exists := r.cachedAuthorizedPolicies[makeAuthMapKey(keySign, policyRef)]; exists {
+		return cached.policies, nil
 	}
 
 	policies, err := r.resources.AuthorizedPolicies(keySign, policyRef)
@@ -667,12 +948,28 @@ func (r *executePolicyResources) authorizedPolicies(keySign tpm2.Name, policyRef
 		return nil, err
 	}
 
-	r.cachedAuthorizedPolicies[makeAuthMapKey(keySign, policyRef)] = policies
+	r.cachedAuthorizedPolicies[makeAuthMapKey(keySign, policyRef)] = cachedAuthorizedPolicies{
+		keySign:   keySign,
+		policyRef: policyRef,
+		policies:  policies,
+	}
 	return policies, nil
 }
 
 func (r *executePolicyResources) signedAuthorization(authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
-	return r.resources.SignedAuthorization(r.session.Session().Params().HashAlg, r.session.Session().State().NonceTPM, authKey, policyRef)
+	nonceTPM := r.session.Session().State().NonceTPM
+	auth, err := signedAuthorizationWithRand(r.resources, r.rand, r.session.Session().Params().HashAlg, nonceTPM, authKey, policyRef)
+	if err != nil {
+		return nil, err
+	}
+	if r.checkSignedAuthorizationNonces && len(auth.NonceTPM) > 0 && !auth.BoundToNonce(nonceTPM) {
+		return nil, errors.New("authorization is bound to a different session")
+	}
+	return auth, nil
+}
+
+func (r *executePolicyResources) signedAuthorizationTimeout(authKey tpm2.Name, policyRef tpm2.Nonce, auth *PolicySignedAuthorization, timeout tpm2.Timeout) {
+	signedAuthorizationTimeout(r.resources, authKey, policyRef, auth, timeout)
 }
 
 type mockPolicyResources struct {
@@ -705,6 +1002,9 @@ func (*mockPolicyResources) signedAuthorization(authKey tpm2.Name, policyRef tpm
 	return new(PolicySignedAuthorization), nil
 }
 
+func (*mockPolicyResources) signedAuthorizationTimeout(authKey tpm2.Name, policyRef tpm2.Nonce, auth *PolicySignedAuthorization, timeout tpm2.Timeout) {
+}
+
 // PolicyAuthorizedPolicies provides a way for [Policy.Branches], [Policy.Details] and
 // [Policy.Stringer] to access authorized policies that are required by a policy.
 type PolicyAuthorizedPolicies interface {
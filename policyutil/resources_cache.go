@@ -0,0 +1,323 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// PolicyResourcesCache contains the parts of the resource cache that [Policy.Execute]
+// builds up during execution which are safe to persist between executions. It can be
+// supplied via [PolicyExecuteParams.ResourcesCache] in order to avoid repeating the work
+// required to locate resources when executing the same policies repeatedly.
+//
+// The cache contains the names and handles of persistent objects and NV indices, the
+// policies associated with resources and authorized policies. It does not contain saved
+// contexts for transient objects or any authorization values. It can be serialized with
+// [github.com/canonical/go-tpm2/mu].
+//
+// Cached persistent objects and NV indices are revalidated before they are first used by
+// each execution, by reading the public area from the TPM and checking that the name still
+// matches. Entries that fail this check are discarded and the resource is loaded normally.
+// NV indices are revalidated in a way that isn't satisfied by results cached by a
+// [tpm2.TPMContext] that has [tpm2.TPMContext.SetCacheNVPublic] enabled.
+//
+// A cache is read at the start of [Policy.Execute] and its contents are replaced when it
+// returns, so it must not be shared between executions that run concurrently.
+type PolicyResourcesCache struct {
+	resources          []policyResourcesCacheResource
+	authorizedPolicies []policyResourcesCacheAuthorizedPolicies
+}
+
+type policyResourcesCacheResource struct {
+	name    tpm2.Name
+	context []byte // serialized HandleContext, or empty if only the policy is cached
+	policy  *Policy
+}
+
+type policyResourcesCacheAuthorizedPolicies struct {
+	keySign   tpm2.Name
+	policyRef tpm2.Nonce
+	policies  []*Policy
+}
+
+// policyResourcesCachePolicy is a serialized policy. This is serialized with a 32-bit
+// size field, because a policy may be larger than a sized buffer permits.
+type policyResourcesCachePolicy []byte
+
+func (p policyResourcesCachePolicy) Marshal(w io.Writer) error {
+	if int64(len(p)) > math.MaxUint32 {
+		return errors.New("policy too large")
+	}
+	_, err := mu.MarshalToWriter(w, uint32(len(p)), mu.RawBytes(p))
+	return err
+}
+
+func (p *policyResourcesCachePolicy) Unmarshal(r io.Reader) error {
+	var size uint32
+	if _, err := mu.UnmarshalFromReader(r, &size); err != nil {
+		return err
+	}
+
+	// Copy the data rather than allocating it based on the size field, so that a
+	// bogus size doesn't result in a large allocation.
+	buf := new(bytes.Buffer)
+	if _, err := io.CopyN(buf, r, int64(size)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	*p = buf.Bytes()
+	return nil
+}
+
+type policyResourcesCacheResourceRaw struct {
+	Name    tpm2.Name
+	Context []byte
+	Policy  policyResourcesCachePolicy
+}
+
+type policyResourcesCacheAuthorizedPoliciesRaw struct {
+	KeySign   tpm2.Name
+	PolicyRef tpm2.Nonce
+	Policies  []policyResourcesCachePolicy
+}
+
+// NewPolicyResourcesCache returns a new empty cache.
+func NewPolicyResourcesCache() *PolicyResourcesCache {
+	return new(PolicyResourcesCache)
+}
+
+// Marshal implements [mu.CustomMarshaller.Marshal].
+func (c PolicyResourcesCache) Marshal(w io.Writer) error {
+	var resources []policyResourcesCacheResourceRaw
+	for _, resource := range c.resources {
+		raw := policyResourcesCacheResourceRaw{
+			Name:    resource.name,
+			Context: resource.context,
+		}
+		if resource.policy != nil {
+			raw.Policy = mu.MustMarshalToBytes(resource.policy)
+		}
+		resources = append(resources, raw)
+	}
+
+	var authorizedPolicies []policyResourcesCacheAuthorizedPoliciesRaw
+	for _, entry := range c.authorizedPolicies {
+		raw := policyResourcesCacheAuthorizedPoliciesRaw{
+			KeySign:   entry.keySign,
+			PolicyRef: entry.policyRef,
+		}
+		for _, policy := range entry.policies {
+			raw.Policies = append(raw.Policies, mu.MustMarshalToBytes(policy))
+		}
+		authorizedPolicies = append(authorizedPolicies, raw)
+	}
+
+	_, err := mu.MarshalToWriter(w, uint32(0), resources, authorizedPolicies)
+	return err
+}
+
+// Unmarshal implements [mu.CustomMarshaller.Unmarshal].
+func (c *PolicyResourcesCache) Unmarshal(r io.Reader) error {
+	var version uint32
+	if _, err := mu.UnmarshalFromReader(r, &version); err != nil {
+		return err
+	}
+	if version != 0 {
+		return fmt.Errorf("unexpected version %d", version)
+	}
+
+	var rawResources []policyResourcesCacheResourceRaw
+	var rawAuthorizedPolicies []policyResourcesCacheAuthorizedPoliciesRaw
+	if _, err := mu.UnmarshalFromReader(r, &rawResources, &rawAuthorizedPolicies); err != nil {
+		return err
+	}
+
+	var resources []policyResourcesCacheResource
+	for i, raw := range rawResources {
+		resource := policyResourcesCacheResource{name: raw.Name}
+		if len(raw.Context) > 0 {
+			hc, _, err := tpm2.NewHandleContextFromBytes(raw.Context)
+			if err != nil {
+				return fmt.Errorf("invalid context for resource %d: %w", i, err)
+			}
+			switch hc.Handle().Type() {
+			case tpm2.HandleTypeNVIndex, tpm2.HandleTypePersistent:
+				// ok
+			default:
+				return fmt.Errorf("invalid context for resource %d: unexpected handle type", i)
+			}
+			if !bytes.Equal(hc.Name(), raw.Name) {
+				return fmt.Errorf("invalid context for resource %d: name mismatch", i)
+			}
+			resource.context = raw.Context
+		}
+		if len(raw.Policy) > 0 {
+			resource.policy = new(Policy)
+			if _, err := mu.UnmarshalFromBytes(raw.Policy, resource.policy); err != nil {
+				return fmt.Errorf("invalid policy for resource %d: %w", i, err)
+			}
+		}
+		resources = append(resources, resource)
+	}
+
+	var authorizedPolicies []policyResourcesCacheAuthorizedPolicies
+	for i, raw := range rawAuthorizedPolicies {
+		entry := policyResourcesCacheAuthorizedPolicies{
+			keySign:   raw.KeySign,
+			policyRef: raw.PolicyRef,
+		}
+		for j, data := range raw.Policies {
+			policy := new(Policy)
+			if _, err := mu.UnmarshalFromBytes(data, policy); err != nil {
+				return fmt.Errorf("invalid authorized policy %d for entry %d: %w", j, i, err)
+			}
+			entry.policies = append(entry.policies, policy)
+		}
+		authorizedPolicies = append(authorizedPolicies, entry)
+	}
+
+	c.resources = resources
+	c.authorizedPolicies = authorizedPolicies
+	return nil
+}
+
+// Len returns the number of resources and sets of authorized policies in this cache.
+func (c *PolicyResourcesCache) Len() int {
+	return len(c.resources) + len(c.authorizedPolicies)
+}
+
+// importCache populates the cache of the supplied executePolicyResources from this cache.
+// Persistent and NV index resources are marked as unverified so that they are checked
+// before they are used.
+func (c *PolicyResourcesCache) importCache(r *executePolicyResources) {
+	for _, resource := range c.resources {
+		if len(resource.context) == 0 {
+			r.cachedResources[makeNameMapKey(resource.name)] = cachedResource{
+				typ:    cachedResourceTypePolicy,
+				name:   resource.name,
+				policy: resource.policy,
+			}
+			continue
+		}
+		r.cachedResources[makeNameMapKey(resource.name)] = cachedResource{
+			typ:        cachedResourceTypeResource,
+			name:       resource.name,
+			data:       resource.context,
+			policy:     resource.policy,
+			unverified: true,
+		}
+	}
+	for _, entry := range c.authorizedPolicies {
+		r.cachedAuthorizedPolicies[makeAuthMapKey(entry.keySign, entry.policyRef)] = cachedAuthorizedPolicies{
+			keySign:   entry.keySign,
+			policyRef: entry.policyRef,
+			policies:  entry.policies,
+		}
+	}
+}
+
+// exportCache replaces the contents of this cache with the safe portions of the
+// cache of the supplied executePolicyResources.
+func (c *PolicyResourcesCache) exportCache(r *executePolicyResources) {
+	var resources []policyResourcesCacheResource
+	for _, cached := range r.cachedResources {
+		switch cached.typ {
+		case cachedResourceTypeResource:
+			hc, _, err := tpm2.NewHandleContextFromBytes(cached.data)
+			if err != nil {
+				continue
+			}
+			switch hc.Handle().Type() {
+			case tpm2.HandleTypeNVIndex, tpm2.HandleTypePersistent:
+				resources = append(resources, policyResourcesCacheResource{
+					name:    cached.name,
+					context: cached.data,
+					policy:  cached.policy,
+				})
+			default:
+				// Permanent resources are cheap to obtain.
+				if cached.policy != nil {
+					resources = append(resources, policyResourcesCacheResource{name: cached.name, policy: cached.policy})
+				}
+			}
+		case cachedResourceTypeContext, cachedResourceTypePolicy:
+			// Don't persist saved contexts, but do retain the policy.
+			if cached.policy != nil {
+				resources = append(resources, policyResourcesCacheResource{name: cached.name, policy: cached.policy})
+			}
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return bytes.Compare(resources[i].name, resources[j].name) < 0
+	})
+
+	var authorizedPolicies []policyResourcesCacheAuthorizedPolicies
+	for _, cached := range r.cachedAuthorizedPolicies {
+		authorizedPolicies = append(authorizedPolicies, policyResourcesCacheAuthorizedPolicies{
+			keySign:   cached.keySign,
+			policyRef: cached.policyRef,
+			policies:  cached.policies,
+		})
+	}
+	sort.Slice(authorizedPolicies, func(i, j int) bool {
+		if c := bytes.Compare(authorizedPolicies[i].keySign, authorizedPolicies[j].keySign); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(authorizedPolicies[i].policyRef, authorizedPolicies[j].policyRef) < 0
+	})
+
+	c.resources = resources
+	c.authorizedPolicies = authorizedPolicies
+}
+
+// verifyCachedResource checks that the supplied resource that was restored from a
+// [PolicyResourcesCache] still has the expected name.
+func (r *executePolicyResources) verifyCachedResource(name tpm2.Name, resource tpm2.ResourceContext) error {
+	if r.tpm == nil {
+		return errors.New("no TPMHelper")
+	}
+
+	var actual tpm2.Name
+	switch resource.Handle().Type() {
+	case tpm2.HandleTypeNVIndex:
+		// Use a context without the cached name so that this isn't satisfied by a
+		// public area cached by the TPMContext.
+		pub, err := r.tpm.NVReadPublic(tpm2.NewLimitedHandleContext(resource.Handle()))
+		if err != nil {
+			return err
+		}
+		actual, err = pub.ComputeName()
+		if err != nil {
+			return err
+		}
+	case tpm2.HandleTypePersistent:
+		pub, err := r.tpm.ReadPublic(resource)
+		if err != nil {
+			return err
+		}
+		actual, err = pub.ComputeName()
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("unexpected handle type")
+	}
+
+	if !bytes.Equal(actual, name) {
+		return fmt.Errorf("resource has the wrong name (%#x)", actual)
+	}
+	return nil
+}
@@ -0,0 +1,506 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type callbackPolicyResourcesSuiteNoTPM struct{}
+
+var _ = Suite(&callbackPolicyResourcesSuiteNoTPM{})
+
+type authorizedPoliciesCall struct {
+	keySign   tpm2.Name
+	policyRef tpm2.Nonce
+}
+
+func (s *callbackPolicyResourcesSuiteNoTPM) TestAuthorizedPoliciesCached(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	var calls []authorizedPoliciesCall
+	resources := NewCallbackPolicyResources(func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+		calls = append(calls, authorizedPoliciesCall{keySign: keySign, policyRef: policyRef})
+		return []*Policy{policy}, nil
+	}, nil)
+
+	keySign := tpm2.Name(internal_testutil.DecodeHexString(c, "000b0ed644f8e1f47f31ae2aa7e2c643ba2eb2c9da2b5bb0ce7b2d6416e181085ddb"))
+
+	for i := 0; i < 2; i++ {
+		policies, err := resources.AuthorizedPolicies(keySign, []byte("foo"))
+		c.Check(err, IsNil)
+		c.Check(policies, DeepEquals, []*Policy{policy})
+	}
+	c.Check(calls, DeepEquals, []authorizedPoliciesCall{{keySign: keySign, policyRef: []byte("foo")}})
+
+	_, err = resources.AuthorizedPolicies(keySign, []byte("bar"))
+	c.Check(err, IsNil)
+	c.Check(calls, DeepEquals, []authorizedPoliciesCall{
+		{keySign: keySign, policyRef: []byte("foo")},
+		{keySign: keySign, policyRef: []byte("bar")},
+	})
+}
+
+func (s *callbackPolicyResourcesSuiteNoTPM) TestAuthorizedPoliciesEmptyResultCached(c *C) {
+	n := 0
+	resources := NewCallbackPolicyResources(func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+		n++
+		return nil, nil
+	}, nil)
+
+	for i := 0; i < 2; i++ {
+		policies, err := resources.AuthorizedPolicies(tpm2.MakeHandleName(tpm2.HandleOwner), nil)
+		c.Check(err, IsNil)
+		c.Check(policies, internal_testutil.LenEquals, 0)
+	}
+	c.Check(n, Equals, 1)
+}
+
+func (s *callbackPolicyResourcesSuiteNoTPM) TestAuthorizedPoliciesErrorNotCached(c *C) {
+	n := 0
+	resources := NewCallbackPolicyResources(func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+		n++
+		return nil, errors.New("some error")
+	}, nil)
+
+	for i := 0; i < 2; i++ {
+		_, err := resources.AuthorizedPolicies(tpm2.MakeHandleName(tpm2.HandleOwner), nil)
+		c.Check(err, ErrorMatches, `some error`)
+	}
+	c.Check(n, Equals, 2)
+}
+
+func (s *callbackPolicyResourcesSuiteNoTPM) TestDelegatesOtherMethods(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	name := tpm2.Name(internal_testutil.DecodeHexString(c, "000b0ed644f8e1f47f31ae2aa7e2c643ba2eb2c9da2b5bb0ce7b2d6416e181085ddb"))
+	data := &PolicyResourcesData{
+		Persistent: []PersistentResource{{Name: name, Handle: 0x81000001, Policy: policy}},
+	}
+
+	resources := NewCallbackPolicyResources(func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+		return nil, nil
+	}, NewTPMPolicyResources(nil, data, nil))
+
+	p, err := resources.Policy(name)
+	c.Check(err, IsNil)
+	c.Check(p, Equals, policy)
+}
+
+func (s *callbackPolicyResourcesSuiteNoTPM) TestSignedAuthorizationWithRand(c *C) {
+	randReader := bytes.NewReader(nil)
+	authKey := tpm2.Name(internal_testutil.DecodeHexString(c, "000b0ed644f8e1f47f31ae2aa7e2c643ba2eb2c9da2b5bb0ce7b2d6416e181085ddb"))
+	expected := new(PolicySignedAuthorization)
+
+	authorizer := &mockRandSignedAuthorizer{
+		signAuthorization: func(rand io.Reader, sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKeyName tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+			c.Check(rand, Equals, randReader)
+			c.Check(sessionAlg, Equals, tpm2.HashAlgorithmSHA256)
+			c.Check(sessionNonce, DeepEquals, tpm2.Nonce("nonce"))
+			c.Check(authKeyName, DeepEquals, authKey)
+			c.Check(policyRef, DeepEquals, tpm2.Nonce("foo"))
+			return expected, nil
+		},
+	}
+	resources := NewCallbackPolicyResources(func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+		return nil, nil
+	}, NewTPMPolicyResources(nil, nil, &TPMPolicyResourcesParams{SignedAuthorizer: authorizer}))
+
+	// The optional RandSignedAuthorizer interface of the underlying resources
+	// is forwarded.
+	randResources, ok := resources.(RandSignedAuthorizer)
+	c.Assert(ok, internal_testutil.IsTrue)
+
+	auth, err := randResources.SignedAuthorizationWithRand(randReader, tpm2.HashAlgorithmSHA256, []byte("nonce"), authKey, []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(auth, Equals, expected)
+}
+
+func (s *callbackPolicyResourcesSuiteNoTPM) TestContextLoadWithError(c *C) {
+	resources := NewCallbackPolicyResources(func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+		return nil, nil
+	}, &contextLoadPolicyResources{
+		contextLoadFn: func(context *tpm2.Context, policy *Policy) (ResourceContext, error) {
+			return nil, errors.New("some error")
+		},
+	})
+
+	// The optional ErrorContextLoader interface of the underlying resources
+	// is forwarded.
+	loader, ok := resources.(ErrorContextLoader)
+	c.Assert(ok, internal_testutil.IsTrue)
+
+	_, err := loader.ContextLoadWithError(new(tpm2.Context), nil)
+	c.Check(err, ErrorMatches, `some error`)
+}
+
+func (s *callbackPolicyResourcesSuiteNoTPM) TestContextLoadWithErrorLegacy(c *C) {
+	legacy := new(legacyContextLoadPolicyResources)
+	resources := NewCallbackPolicyResources(func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+		return nil, nil
+	}, legacy)
+
+	loader, ok := resources.(ErrorContextLoader)
+	c.Assert(ok, internal_testutil.IsTrue)
+
+	_, err := loader.ContextLoadWithError(new(tpm2.Context), nil)
+	c.Check(err, ErrorMatches, `context could not be loaded`)
+	c.Check(legacy.contextLoads, Equals, 1)
+}
+
+type callbackPolicyResourcesSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&callbackPolicyResourcesSuite{})
+
+func (s *callbackPolicyResourcesSuite) TestExecutePolicyAuthorize(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	pubKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	approvedPolicy, authorizedPolicy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	c.Check(authorizedPolicy.Authorize(rand.Reader, pubKey, []byte("foo"), key, crypto.SHA256), IsNil)
+
+	builder = NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthorize([]byte("foo"), pubKey)
+	expectedDigest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	var calls []authorizedPoliciesCall
+	resources := NewCallbackPolicyResources(func(keySign tpm2.Name, policyRef tpm2.Nonce) ([]*Policy, error) {
+		calls = append(calls, authorizedPoliciesCall{keySign: keySign, policyRef: policyRef})
+		return []*Policy{authorizedPolicy}, nil
+	}, NewTPMPolicyResources(s.TPM, nil, &TPMPolicyResourcesParams{Authorizer: new(mockAuthorizer)}))
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	result, err := policy.Execute(NewTPMPolicySession(s.TPM, session), resources, NewTPMHelper(s.TPM, nil), nil)
+	c.Assert(err, IsNil)
+	c.Check(result.AuthValueNeeded, internal_testutil.IsTrue)
+	c.Check(result.Path, Equals, fmt.Sprintf("%x", approvedPolicy))
+	c.Check(calls, DeepEquals, []authorizedPoliciesCall{{keySign: pubKey.Name(), policyRef: []byte("foo")}})
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+type contextLoadPolicyResources struct {
+	PolicyResources
+	contextLoadFn func(context *tpm2.Context, policy *Policy) (ResourceContext, error)
+}
+
+func (r *contextLoadPolicyResources) ContextLoadWithError(context *tpm2.Context, policy *Policy) (ResourceContext, error) {
+	return r.contextLoadFn(context, policy)
+}
+
+type legacyContextLoadPolicyResources struct {
+	PolicyResources
+	contextLoads int
+}
+
+func (r *legacyContextLoadPolicyResources) ContextLoad(context *tpm2.Context, policy *Policy) ResourceContext {
+	r.contextLoads++
+	return nil
+}
+
+type executePolicyResourcesSuite struct {
+	testutil.TPMTest
+}
+
+func (s *executePolicyResourcesSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&executePolicyResourcesSuite{})
+
+func (s *executePolicyResourcesSuite) newPolicyResources(c *C, contextLoadFn func(PolicyResources, *tpm2.Context, *Policy) (ResourceContext, error)) (tpm2.Name, PolicyResources) {
+	parent := s.CreatePrimary(c, tpm2.HandleOwner, testutil.NewRSAStorageKeyTemplate())
+	persistent := s.NextAvailableHandle(c, 0x81000008)
+	s.EvictControl(c, tpm2.HandleOwner, parent, persistent)
+
+	priv, pub, _, _, _, err := s.TPM.Create(parent, nil, testutil.NewRSAStorageKeyTemplate(), nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	resources := NewTPMPolicyResources(s.TPM, &PolicyResourcesData{
+		Persistent: []PersistentResource{
+			{
+				Name:   parent.Name(),
+				Handle: persistent,
+			},
+		},
+		Transient: []TransientResource{
+			{
+				ParentName: parent.Name(),
+				Private:    priv,
+				Public:     pub,
+			},
+		},
+	}, &TPMPolicyResourcesParams{Authorizer: new(mockAuthorizer)})
+
+	return pub.Name(), &contextLoadPolicyResources{
+		PolicyResources: resources,
+		contextLoadFn: func(context *tpm2.Context, policy *Policy) (ResourceContext, error) {
+			return contextLoadFn(resources, context, policy)
+		},
+	}
+}
+
+func (s *executePolicyResourcesSuite) TestLoadedResourceStaleContext(c *C) {
+	contextLoads := 0
+	name, resources := s.newPolicyResources(c, func(resources PolicyResources, context *tpm2.Context, policy *Policy) (ResourceContext, error) {
+		contextLoads++
+
+		// Corrupt the saved context so that the TPM rejects it, as it would
+		// do if it had been reset since the context was saved.
+		context.Blob[len(context.Blob)-1] ^= 0xff
+		return resources.(ErrorContextLoader).ContextLoadWithError(context, policy)
+	})
+
+	// Both assertions use the same transient object, so the second one
+	// tries to load it from the saved context.
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySecret(name, []byte("foo"))
+	builder.RootBranch().PolicySecret(name, []byte("bar"))
+	expectedDigest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	s.ForgetCommands()
+
+	_, err = policy.Execute(NewTPMPolicySession(s.TPM, session), resources, NewTPMHelper(s.TPM, nil), nil)
+	c.Check(err, IsNil)
+	c.Check(contextLoads, Equals, 1)
+
+	// The object should have been loaded from its source again.
+	var loads int
+	var policySecrets int
+	for _, cmd := range s.CommandLog() {
+		switch cmd.GetCommandCode(c) {
+		case tpm2.CommandLoad:
+			loads++
+		case tpm2.CommandPolicySecret:
+			policySecrets++
+		}
+	}
+	c.Check(loads, Equals, 2)
+	c.Check(policySecrets, Equals, 2)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *executePolicyResourcesSuite) TestLoadedResourceLegacyContextLoadFailure(c *C) {
+	name, resources := s.newPolicyResources(c, nil)
+	legacy := &legacyContextLoadPolicyResources{PolicyResources: resources.(*contextLoadPolicyResources).PolicyResources}
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySecret(name, []byte("foo"))
+	builder.RootBranch().PolicySecret(name, []byte("bar"))
+	expectedDigest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	s.ForgetCommands()
+
+	// An implementation without ContextLoadWithError that fails to load the
+	// saved context should result in the object being loaded from its source again.
+	_, err = policy.Execute(NewTPMPolicySession(s.TPM, session), legacy, NewTPMHelper(s.TPM, nil), nil)
+	c.Check(err, IsNil)
+	c.Check(legacy.contextLoads, Equals, 1)
+
+	var loads int
+	for _, cmd := range s.CommandLog() {
+		if cmd.GetCommandCode(c) == tpm2.CommandLoad {
+			loads++
+		}
+	}
+	c.Check(loads, Equals, 2)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *executePolicyResourcesSuite) TestLoadedResourceContextLoadError(c *C) {
+	name, resources := s.newPolicyResources(c, func(PolicyResources, *tpm2.Context, *Policy) (ResourceContext, error) {
+		return nil, errors.New("some error")
+	})
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySecret(name, []byte("foo"))
+	builder.RootBranch().PolicySecret(name, []byte("bar"))
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	_, err = policy.Execute(NewTPMPolicySession(s.TPM, session), resources, NewTPMHelper(s.TPM, nil), nil)
+	c.Check(err, ErrorMatches, `cannot run 'TPM2_PolicySecret assertion' task in root branch: cannot complete authorization with authName=.*, policyRef=0x626172: `+
+		`cannot load resource with name .*: cannot load saved context: some error`)
+}
+
+func (s *executePolicyResourcesSuite) executeWithCache(c *C, policy *Policy, resources PolicyResources, cache *PolicyResourcesCache) (commands map[tpm2.CommandCode]int, err error) {
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	s.ForgetCommands()
+	_, err = policy.Execute(NewTPMPolicySession(s.TPM, session), resources, NewTPMHelper(s.TPM, nil), &PolicyExecuteParams{ResourcesCache: cache})
+
+	commands = make(map[tpm2.CommandCode]int)
+	for _, cmd := range s.CommandLog() {
+		commands[cmd.GetCommandCode(c)]++
+	}
+	return commands, err
+}
+
+func (s *executePolicyResourcesSuite) newPersistentObjectPolicy(c *C) (tpm2.ResourceContext, tpm2.Handle, *Policy) {
+	object := s.CreatePrimary(c, tpm2.HandleOwner, testutil.NewRSAStorageKeyTemplate())
+	persistent := s.NextAvailableHandle(c, 0x81000008)
+	s.EvictControl(c, tpm2.HandleOwner, object, persistent)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySecret(object, nil)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	return object, persistent, policy
+}
+
+func (s *executePolicyResourcesSuite) TestResourcesCacheWarm(c *C) {
+	_, _, policy := s.newPersistentObjectPolicy(c)
+
+	// The object isn't supplied in the resource data, so it has to be found
+	// by scanning persistent handles.
+	resources := NewTPMPolicyResources(s.TPM, nil, &TPMPolicyResourcesParams{Authorizer: new(mockAuthorizer)})
+
+	cache := NewPolicyResourcesCache()
+	commands, err := s.executeWithCache(c, policy, resources, cache)
+	c.Assert(err, IsNil)
+	c.Check(commands[tpm2.CommandGetCapability] > 0, internal_testutil.IsTrue)
+	c.Check(commands[tpm2.CommandPolicySecret], Equals, 1)
+
+	// Persist the cache and restore it.
+	var restored *PolicyResourcesCache
+	_, err = mu.UnmarshalFromBytes(mu.MustMarshalToBytes(cache), &restored)
+	c.Assert(err, IsNil)
+	c.Check(restored.Len(), Equals, 1)
+
+	commands, err = s.executeWithCache(c, policy, resources, restored)
+	c.Check(err, IsNil)
+	c.Check(commands[tpm2.CommandGetCapability], Equals, 0)
+	c.Check(commands[tpm2.CommandReadPublic] > 0, internal_testutil.IsTrue)
+	c.Check(commands[tpm2.CommandPolicySecret], Equals, 1)
+}
+
+func (s *executePolicyResourcesSuite) TestResourcesCacheStale(c *C) {
+	object, persistent, policy := s.newPersistentObjectPolicy(c)
+	resources := NewTPMPolicyResources(s.TPM, nil, &TPMPolicyResourcesParams{Authorizer: new(mockAuthorizer)})
+
+	cache := NewPolicyResourcesCache()
+	_, err := s.executeWithCache(c, policy, resources, cache)
+	c.Assert(err, IsNil)
+
+	// Move the object to a different handle, so that the cached entry is stale.
+	persistentContext, err := s.TPM.NewResourceContext(persistent)
+	c.Assert(err, IsNil)
+	s.EvictControl(c, tpm2.HandleOwner, persistentContext, persistent)
+	transient := s.CreatePrimary(c, tpm2.HandleOwner, testutil.NewRSAStorageKeyTemplate())
+	c.Assert(transient.Name(), DeepEquals, object.Name())
+	s.EvictControl(c, tpm2.HandleOwner, transient, s.NextAvailableHandle(c, persistent+1))
+
+	commands, err := s.executeWithCache(c, policy, resources, cache)
+	c.Check(err, IsNil)
+
+	// The stale entry is discarded and the handles are scanned again.
+	c.Check(commands[tpm2.CommandGetCapability] > 0, internal_testutil.IsTrue)
+	c.Check(commands[tpm2.CommandPolicySecret], Equals, 1)
+}
+
+type policyResourcesCacheSuite struct{}
+
+var _ = Suite(&policyResourcesCacheSuite{})
+
+func (s *policyResourcesCacheSuite) TestMarshalEmpty(c *C) {
+	cache := NewPolicyResourcesCache()
+	b, err := mu.MarshalToBytes(cache)
+	c.Check(err, IsNil)
+	c.Check(b, DeepEquals, internal_testutil.DecodeHexString(c, "000000000000000000000000"))
+
+	var restored *PolicyResourcesCache
+	_, err = mu.UnmarshalFromBytes(b, &restored)
+	c.Check(err, IsNil)
+	c.Check(restored.Len(), Equals, 0)
+}
+
+func (s *policyResourcesCacheSuite) TestUnmarshalInvalidVersion(c *C) {
+	var cache *PolicyResourcesCache
+	_, err := mu.UnmarshalFromBytes(internal_testutil.DecodeHexString(c, "000000010000000000000000"), &cache)
+	c.Check(err, ErrorMatches, `cannot unmarshal argument 0 whilst processing element of type policyutil.PolicyResourcesCache: unexpected version 1`)
+}
+
+func (s *policyResourcesCacheSuite) TestUnmarshalInvalidContext(c *C) {
+	// A single resource with a context for a transient object.
+	resource, err := tpm2.NewObjectResourceContextFromPub(0x80000001, testutil.NewRSAStorageKeyTemplate())
+	c.Assert(err, IsNil)
+	data := mu.MustMarshalToBytes(uint32(0), uint32(1), resource.Name(), resource.SerializeToBytes(), uint32(0), uint32(0))
+
+	var cache *PolicyResourcesCache
+	_, err = mu.UnmarshalFromBytes(data, &cache)
+	c.Check(err, ErrorMatches, `cannot unmarshal argument 0 whilst processing element of type policyutil.PolicyResourcesCache: invalid context for resource 0: unexpected handle type`)
+}
+
+func (s *policyResourcesCacheSuite) TestMarshalLargeAuthorizedPolicy(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	for i := 0; i < 2000; i++ {
+		builder.RootBranch().PolicyCounterTimer(make(tpm2.Operand, 32), 0, tpm2.OpEq)
+	}
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	policyBytes := mu.MustMarshalToBytes(policy)
+	c.Assert(len(policyBytes) > math.MaxUint16, internal_testutil.IsTrue)
+
+	// A single set of authorized policies containing the large policy.
+	data := mu.MustMarshalToBytes(uint32(0), uint32(0), uint32(1), tpm2.Name{0, 0x0b, 1, 2, 3, 4}, tpm2.Nonce("foo"), uint32(1), uint32(len(policyBytes)), mu.RawBytes(policyBytes))
+
+	var cache *PolicyResourcesCache
+	_, err = mu.UnmarshalFromBytes(data, &cache)
+	c.Assert(err, IsNil)
+	c.Check(cache.Len(), Equals, 1)
+
+	b, err := mu.MarshalToBytes(cache)
+	c.Check(err, IsNil)
+	c.Check(b, DeepEquals, data)
+}
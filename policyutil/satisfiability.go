@@ -0,0 +1,187 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// PolicyUnsatisfiableReason describes an assertion that prevents a policy branch from
+// being satisfied, and is returned from [Policy.IsSatisfiable].
+type PolicyUnsatisfiableReason struct {
+	// Permanent indicates that the assertion can never be satisfied on the TPM, eg,
+	// because it references a command that the TPM doesn't support or a NV index
+	// that doesn't exist. If this is false, the assertion can't be satisfied with the
+	// current TPM state but might be in the future, eg, because the current PCR values
+	// don't match.
+	Permanent bool
+
+	Description string
+}
+
+func (r PolicyUnsatisfiableReason) String() string {
+	if r.Permanent {
+		return "permanently unsatisfiable: " + r.Description
+	}
+	return "currently unsatisfiable: " + r.Description
+}
+
+type policySatisfiabilityChecker struct {
+	tpm     *tpm2.TPMContext
+	alg     tpm2.HashAlgorithmId
+	reasons []PolicyUnsatisfiableReason
+}
+
+func (c *policySatisfiabilityChecker) addReason(permanent bool, format string, args ...interface{}) {
+	c.reasons = append(c.reasons, PolicyUnsatisfiableReason{
+		Permanent:   permanent,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *policySatisfiabilityChecker) checkCommandCode(details *PolicyBranchDetails) {
+	code, set := details.CommandCode()
+	if !set {
+		return
+	}
+	if !c.tpm.IsCommandSupported(code) {
+		c.addReason(true, "TPM2_PolicyCommandCode assertion for unsupported command %v", code)
+	}
+}
+
+func (c *policySatisfiabilityChecker) checkNV(details *PolicyBranchDetails) error {
+	for _, nv := range details.NV {
+		pub, name, err := c.tpm.NVReadPublic(tpm2.NewHandleContext(nv.Index))
+		switch {
+		case tpm2.IsTPMHandleError(err, tpm2.ErrorHandle, tpm2.AnyCommandCode, tpm2.AnyHandleIndex):
+			c.addReason(true, "TPM2_PolicyNV assertion for NV index %v which doesn't exist", nv.Index)
+			continue
+		case err != nil:
+			return fmt.Errorf("cannot obtain public area for NV index %v: %w", nv.Index, err)
+		}
+		if !bytes.Equal(name, nv.Name) {
+			c.addReason(true, "TPM2_PolicyNV assertion for NV index %v which has the wrong name (%#x)", nv.Index, name)
+			continue
+		}
+		if int(nv.Offset)+len(nv.OperandB) > int(pub.Size) {
+			c.addReason(true, "TPM2_PolicyNV assertion for NV index %v with an operand that exceeds the size of the index", nv.Index)
+		}
+	}
+
+	return nil
+}
+
+func (c *policySatisfiabilityChecker) checkPCR(details *PolicyBranchDetails) error {
+	if len(details.PCR) == 0 {
+		return nil
+	}
+
+	allocated, err := c.tpm.GetCapabilityPCRs()
+	if err != nil {
+		return fmt.Errorf("cannot obtain PCR allocation: %w", err)
+	}
+
+	for _, item := range details.PCR {
+		unallocated := false
+		for _, selection := range item.PCRs {
+			var bank *tpm2.PCRSelection
+			for i := range allocated {
+				if allocated[i].Hash == selection.Hash {
+					bank = &allocated[i]
+					break
+				}
+			}
+			for _, pcr := range selection.Select {
+				found := false
+				if bank != nil {
+					for _, s := range bank.Select {
+						if s == pcr {
+							found = true
+							break
+						}
+					}
+				}
+				if !found {
+					c.addReason(true, "TPM2_PolicyPCR assertion for PCR %d which is not allocated in PCR bank %v", pcr, selection.Hash)
+					unallocated = true
+				}
+			}
+		}
+		if unallocated {
+			continue
+		}
+
+		_, values, err := c.tpm.PCRRead(item.PCRs)
+		if err != nil {
+			return fmt.Errorf("cannot obtain PCR values: %w", err)
+		}
+		pcrDigest, err := ComputePCRDigest(c.alg, item.PCRs, values)
+		if err != nil {
+			return fmt.Errorf("cannot compute PCR digest: %w", err)
+		}
+		if !bytes.Equal(pcrDigest, item.PCRDigest) {
+			c.addReason(false, "TPM2_PolicyPCR assertion with digest %#x which doesn't match the current PCR values (%#x)", item.PCRDigest, pcrDigest)
+		}
+	}
+
+	return nil
+}
+
+// IsSatisfiable determines whether the branch of this policy selected by the supplied path
+// could be satisfied on the supplied TPM. The path must select a single branch. It returns
+// true if no problems were found, else it returns false along with a list of reasons that
+// describe each assertion that can't be satisfied. Each reason indicates whether the
+// assertion is permanently unsatisfiable on this TPM, or whether it is only unsatisfiable
+// with the current TPM state.
+//
+// The following assertions are checked:
+//   - TPM2_PolicyCommandCode assertions are permanently unsatisfiable if the TPM doesn't
+//     support the command.
+//   - TPM2_PolicyNV assertions are permanently unsatisfiable if the NV index doesn't exist,
+//     has a different name or is too small for the assertion. The contents of the index are
+//     not checked.
+//   - TPM2_PolicyPCR assertions are permanently unsatisfiable if any of the PCRs are not
+//     allocated, and are currently unsatisfiable if the current PCR values don't match. The
+//     PCR digest is checked for the first algorithm that this policy has a digest for.
+//
+// Policies authorized by TPM2_PolicyAuthorize assertions aren't checked. Use
+// [Policy.CheckCompatibility] to check that the TPM supports the commands used to execute this
+// policy.
+//
+// This only reads TPM state with TPM2_GetCapability, TPM2_PCR_Read and TPM2_NV_ReadPublic.
+// No sessions are started or modified.
+func (p *Policy) IsSatisfiable(tpm *tpm2.TPMContext, path string) (bool, []PolicyUnsatisfiableReason, error) {
+	if len(p.policy.PolicyDigests) == 0 {
+		return false, nil, ErrMissingDigest
+	}
+	alg := p.policy.PolicyDigests[0].HashAlg
+
+	details, err := p.Details(alg, path, nil)
+	if err != nil {
+		return false, nil, fmt.Errorf("cannot obtain policy details: %w", err)
+	}
+	if len(details) != 1 {
+		return false, nil, fmt.Errorf("path %q selects %d branches", path, len(details))
+	}
+
+	checker := &policySatisfiabilityChecker{tpm: tpm, alg: alg}
+	for _, branch := range details {
+		if !branch.IsValid() {
+			checker.addReason(true, "branch contains conflicting assertions")
+		}
+		checker.checkCommandCode(&branch)
+		if err := checker.checkNV(&branch); err != nil {
+			return false, nil, err
+		}
+		if err := checker.checkPCR(&branch); err != nil {
+			return false, nil, err
+		}
+	}
+
+	return len(checker.reasons) == 0, checker.reasons, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type satisfiabilitySuiteNoTPM struct{}
+
+var _ = Suite(&satisfiabilitySuiteNoTPM{})
+
+func (s *satisfiabilitySuiteNoTPM) TestIsSatisfiableMultipleBranches(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+	node.AddBranch("a").PolicyAuthValue()
+	node.AddBranch("b").PolicyPassword()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	_, _, err = policy.IsSatisfiable(nil, "")
+	c.Check(err, ErrorMatches, `path "" selects 2 branches`)
+}
+
+func (s *satisfiabilitySuiteNoTPM) TestIsSatisfiableNoDigest(c *C) {
+	var policy Policy
+	_, _, err := policy.IsSatisfiable(nil, "")
+	c.Check(err, Equals, ErrMissingDigest)
+}
+
+type satisfiabilitySuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&satisfiabilitySuite{})
+
+func (s *satisfiabilitySuite) checkReadOnly(c *C) {
+	for _, cmd := range s.CommandLog() {
+		switch cmd.GetCommandCode(c) {
+		case tpm2.CommandGetCapability, tpm2.CommandPCRRead, tpm2.CommandNVReadPublic:
+		default:
+			c.Errorf("unexpected command %v", cmd.GetCommandCode(c))
+		}
+	}
+}
+
+func (s *satisfiabilitySuite) TestIsSatisfiable(c *C) {
+	_, values, err := s.TPM.PCRRead(tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{7}}})
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+	b := node.AddBranch("pcr")
+	b.PolicyPCR(values)
+	b.PolicyCommandCode(tpm2.CommandUnseal)
+	node.AddBranch("other").PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	s.ForgetCommands()
+
+	ok, reasons, err := policy.IsSatisfiable(s.TPM, "pcr")
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+	c.Check(reasons, HasLen, 0)
+
+	s.checkReadOnly(c)
+}
+
+func (s *satisfiabilitySuite) TestIsSatisfiablePCRMismatch(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyPCR(tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {7: bytes.Repeat([]byte{0xff}, 32)}})
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	s.ForgetCommands()
+
+	ok, reasons, err := policy.IsSatisfiable(s.TPM, "")
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+	c.Assert(reasons, HasLen, 1)
+	c.Check(reasons[0].Permanent, internal_testutil.IsFalse)
+	c.Check(reasons[0].String(), Matches, `currently unsatisfiable: TPM2_PolicyPCR assertion with digest 0x[[:xdigit:]]{64} which doesn't match the current PCR values \(0x[[:xdigit:]]{64}\)`)
+
+	s.checkReadOnly(c)
+}
+
+func (s *satisfiabilitySuite) TestIsSatisfiableUnallocatedPCR(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyPCR(tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {30: make([]byte, 32)}})
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	ok, reasons, err := policy.IsSatisfiable(s.TPM, "")
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+	c.Check(reasons, DeepEquals, []PolicyUnsatisfiableReason{
+		{Permanent: true, Description: "TPM2_PolicyPCR assertion for PCR 30 which is not allocated in PCR bank TPM_ALG_SHA256"},
+	})
+}
+
+func (s *satisfiabilitySuite) TestIsSatisfiableMissingNVIndex(c *C) {
+	nvPub := &tpm2.NVPublic{
+		Index:   0x0181ffff,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVWritten),
+		Size:    8}
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyNV(nvPub, []byte{0x00, 0x10}, 0, tpm2.OpEq)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	s.ForgetCommands()
+
+	ok, reasons, err := policy.IsSatisfiable(s.TPM, "")
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+	c.Check(reasons, DeepEquals, []PolicyUnsatisfiableReason{
+		{Permanent: true, Description: "TPM2_PolicyNV assertion for NV index 0x0181ffff which doesn't exist"},
+	})
+
+	s.checkReadOnly(c)
+}
+
+func (s *satisfiabilitySuite) TestIsSatisfiableUnsupportedCommand(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandCode(0x000001ff))
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	ok, reasons, err := policy.IsSatisfiable(s.TPM, "")
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+	c.Check(reasons, DeepEquals, []PolicyUnsatisfiableReason{
+		{Permanent: true, Description: "TPM2_PolicyCommandCode assertion for unsupported command 0x000001ff"},
+	})
+}
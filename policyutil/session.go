@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 
 	"github.com/canonical/go-tpm2"
@@ -36,6 +37,7 @@ type policySession interface {
 	PolicyPassword() error
 	PolicyGetDigest() (tpm2.Digest, error)
 	PolicyNvWritten(writtenSet bool) error
+	PolicyParameters(pHash tpm2.Digest) error
 }
 
 // SessionContext corresponds to a session on the TPM
@@ -68,6 +70,35 @@ type PolicySession interface {
 	PolicyPassword() error
 	PolicyGetDigest() (tpm2.Digest, error)
 	PolicyNvWritten(writtenSet bool) error
+	PolicyParameters(pHash tpm2.Digest) error
+}
+
+// PolicyPhysicalPresenceSession is an optional interface that can be implemented by a
+// [PolicySession] implementation in order to support TPM2_PolicyPhysicalPresence
+// assertions. Executing a policy that contains this assertion with a session that doesn't
+// implement this fails.
+type PolicyPhysicalPresenceSession interface {
+	PolicyPhysicalPresence() error
+}
+
+// policyPhysicalPresence executes a TPM2_PolicyPhysicalPresence assertion on the supplied
+// session if it implements PolicyPhysicalPresenceSession.
+func policyPhysicalPresence(session policySession) error {
+	s, ok := session.(PolicyPhysicalPresenceSession)
+	if !ok {
+		return errors.New("session does not support TPM2_PolicyPhysicalPresence")
+	}
+	return s.PolicyPhysicalPresence()
+}
+
+// PolicySessionRestarter is an optional interface that can be implemented by a
+// [PolicySession] implementation in order to support restarting the session.
+type PolicySessionRestarter interface {
+	// Restart executes TPM2_PolicyRestart on this session, which resets the
+	// session digest to the zero digest and clears any other state that has
+	// been accumulated by previous assertions, so that a policy can be executed
+	// again in the same session.
+	Restart() error
 }
 
 type tpmSessionContext struct {
@@ -134,6 +165,17 @@ func NewTPMPolicySession(tpm *tpm2.TPMContext, policySession tpm2.SessionContext
 	}
 }
 
+// withAdditionalSessions returns a copy of this session that attaches the supplied
+// sessions to every command in addition to the ones supplied to NewTPMPolicySession.
+// The returned session shares the same underlying policy session.
+func (s *tpmPolicySession) withAdditionalSessions(sessions ...tpm2.SessionContext) PolicySession {
+	return &tpmPolicySession{
+		tpm:           s.tpm,
+		policySession: s.policySession,
+		sessions:      append(append([]tpm2.SessionContext(nil), s.sessions...), sessions...),
+	}
+}
+
 func (s *tpmPolicySession) Context() SessionContext {
 	return s.policySession
 }
@@ -202,6 +244,10 @@ func (s *tpmPolicySession) PolicyPassword() error {
 	return s.tpm.PolicyPassword(s.policySession.Session(), s.sessions...)
 }
 
+func (s *tpmPolicySession) PolicyPhysicalPresence() error {
+	return s.tpm.PolicyPhysicalPresence(s.policySession.Session(), s.sessions...)
+}
+
 func (s *tpmPolicySession) PolicyGetDigest() (tpm2.Digest, error) {
 	return s.tpm.PolicyGetDigest(s.policySession.Session(), s.sessions...)
 }
@@ -210,17 +256,43 @@ func (s *tpmPolicySession) PolicyNvWritten(writtenSet bool) error {
 	return s.tpm.PolicyNvWritten(s.policySession.Session(), writtenSet, s.sessions...)
 }
 
+func (s *tpmPolicySession) PolicyParameters(pHash tpm2.Digest) error {
+	return s.tpm.PolicyParameters(s.policySession.Session(), pHash, s.sessions...)
+}
+
+func (s *tpmPolicySession) Restart() error {
+	return s.tpm.PolicyRestart(s.policySession.Session(), s.sessions...)
+}
+
+// policySessionHashConstructor returns the hash constructor for computing digests
+// that are associated with the supplied session, such as the PCR digest supplied
+// to TPM2_PolicyPCR. This returns nil if the session's digest algorithm is not
+// available.
+func policySessionHashConstructor(session policySession) func() hash.Hash {
+	if s, ok := session.(interface{ hashConstructor() func() hash.Hash }); ok {
+		return s.hashConstructor()
+	}
+	alg := session.HashAlg()
+	if !alg.Available() {
+		return nil
+	}
+	return alg.NewHash
+}
+
 // computePolicySession is an implementation of Session that computes a
 // digest from a sequence of assertions.
 type computePolicySession struct {
-	alg          tpm2.HashAlgorithmId
-	digest       tpm2.Digest
-	noCpNameHash bool
+	alg              tpm2.HashAlgorithmId
+	newHash          func() hash.Hash
+	digest           tpm2.Digest
+	noCpNameHash     bool
+	minPcrSelectSize uint8
 }
 
 func newComputePolicySession(alg tpm2.HashAlgorithmId, digest tpm2.Digest, noCpNameHash bool) *computePolicySession {
 	out := &computePolicySession{
 		alg:          alg,
+		newHash:      alg.NewHash,
 		digest:       make(tpm2.Digest, alg.Size()),
 		noCpNameHash: noCpNameHash,
 	}
@@ -228,12 +300,26 @@ func newComputePolicySession(alg tpm2.HashAlgorithmId, digest tpm2.Digest, noCpN
 	return out
 }
 
+// newBranchSession returns a new session for computing the digest of a branch
+// that starts from the supplied digest, with the same configuration as this
+// session.
+func (s *computePolicySession) newBranchSession(digest tpm2.Digest) *computePolicySession {
+	out := newComputePolicySession(s.alg, digest, s.noCpNameHash)
+	out.newHash = s.newHash
+	out.minPcrSelectSize = s.minPcrSelectSize
+	return out
+}
+
+func (s *computePolicySession) hashConstructor() func() hash.Hash {
+	return s.newHash
+}
+
 func (s *computePolicySession) reset() {
 	s.digest = make(tpm2.Digest, s.alg.Size())
 }
 
 func (s *computePolicySession) updateForCommand(command tpm2.CommandCode, params ...interface{}) error {
-	h := s.alg.NewHash()
+	h := s.newHash()
 	h.Write(s.digest)
 	mu.MustMarshalToWriter(h, command)
 	if _, err := mu.MarshalToWriter(h, params...); err != nil {
@@ -252,7 +338,7 @@ func (s *computePolicySession) mustUpdateForCommand(command tpm2.CommandCode, pa
 func (s *computePolicySession) policyUpdate(command tpm2.CommandCode, name tpm2.Name, policyRef tpm2.Nonce) {
 	s.mustUpdateForCommand(command, mu.Raw(name))
 
-	h := s.alg.NewHash()
+	h := s.newHash()
 	h.Write(s.digest)
 	mu.MustMarshalToWriter(h, mu.Raw(policyRef))
 	s.digest = h.Sum(nil)
@@ -291,8 +377,8 @@ func (s *computePolicySession) PolicyOR(pHashList tpm2.DigestList) error {
 		return errors.New("invalid number of branches")
 	}
 
-	s.reset()
-
+	// Validate the digests before resetting the session so that it is
+	// unmodified on error, in the same way as the TPM.
 	digests := new(bytes.Buffer)
 	for i, digest := range pHashList {
 		if len(digest) != s.alg.Size() {
@@ -300,6 +386,8 @@ func (s *computePolicySession) PolicyOR(pHashList tpm2.DigestList) error {
 		}
 		digests.Write(digest)
 	}
+
+	s.reset()
 	s.mustUpdateForCommand(tpm2.CommandPolicyOR, mu.Raw(digests.Bytes()))
 	return nil
 }
@@ -308,6 +396,9 @@ func (s *computePolicySession) PolicyPCR(pcrDigest tpm2.Digest, pcrs tpm2.PCRSel
 	if len(pcrDigest) != s.alg.Size() {
 		return errors.New("invalid pcrDigest size")
 	}
+	if s.minPcrSelectSize > 0 {
+		pcrs = pcrs.WithMinSelectSize(s.minPcrSelectSize)
+	}
 	return s.updateForCommand(tpm2.CommandPolicyPCR, pcrs, mu.Raw(pcrDigest))
 }
 
@@ -316,7 +407,7 @@ func (s *computePolicySession) PolicyNV(auth, index tpm2.ResourceContext, operan
 		return errors.New("invalid index name")
 	}
 
-	h := s.alg.NewHash()
+	h := s.newHash()
 	mu.MustMarshalToWriter(h, mu.Raw(operandB), offset, operation)
 
 	s.mustUpdateForCommand(tpm2.CommandPolicyNV, mu.Raw(h.Sum(nil)), mu.Raw(index.Name()))
@@ -324,7 +415,7 @@ func (s *computePolicySession) PolicyNV(auth, index tpm2.ResourceContext, operan
 }
 
 func (s *computePolicySession) PolicyCounterTimer(operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) error {
-	h := s.alg.NewHash()
+	h := s.newHash()
 	mu.MustMarshalToWriter(h, mu.Raw(operandB), offset, operation)
 
 	s.mustUpdateForCommand(tpm2.CommandPolicyCounterTimer, mu.Raw(h.Sum(nil)))
@@ -391,6 +482,11 @@ func (s *computePolicySession) PolicyPassword() error {
 	return nil
 }
 
+func (s *computePolicySession) PolicyPhysicalPresence() error {
+	s.mustUpdateForCommand(tpm2.CommandPolicyPhysicalPresence)
+	return nil
+}
+
 func (s *computePolicySession) PolicyGetDigest() (tpm2.Digest, error) {
 	digest := make(tpm2.Digest, len(s.digest))
 	copy(digest, s.digest)
@@ -402,6 +498,57 @@ func (s *computePolicySession) PolicyNvWritten(writtenSet bool) error {
 	return nil
 }
 
+func (s *computePolicySession) PolicyParameters(pHash tpm2.Digest) error {
+	if s.noCpNameHash {
+		return fmt.Errorf("cannot compute digest for policies with TPM2_PolicyParameters assertion")
+	}
+	if len(pHash) != s.alg.Size() {
+		return errors.New("invalid digest size")
+	}
+	s.mustUpdateForCommand(tpm2.CommandPolicyParameters, mu.Raw(pHash))
+	return nil
+}
+
+// verifyPolicySession is an implementation of policySession that mirrors the
+// assertions executed on a real policy session in order to compute the digest
+// that the real session is expected to have after each assertion. It differs
+// from computePolicySession in that it handles the assertions that are only
+// issued during execution.
+type verifyPolicySession struct {
+	*computePolicySession
+}
+
+func newVerifyPolicySession(alg tpm2.HashAlgorithmId, digest tpm2.Digest, minPcrSelectSize uint8) *verifyPolicySession {
+	session := newComputePolicySession(alg, digest, false)
+	session.minPcrSelectSize = minPcrSelectSize
+	return &verifyPolicySession{computePolicySession: session}
+}
+
+func (s *verifyPolicySession) PolicyTicket(timeout tpm2.Timeout, cpHashA tpm2.Digest, policyRef tpm2.Nonce, authName tpm2.Name, ticket *tpm2.TkAuth) error {
+	if ticket == nil {
+		return errors.New("no ticket")
+	}
+
+	var command tpm2.CommandCode
+	switch ticket.Tag {
+	case tpm2.TagAuthSigned:
+		command = tpm2.CommandPolicySigned
+	case tpm2.TagAuthSecret:
+		command = tpm2.CommandPolicySecret
+	default:
+		return fmt.Errorf("invalid ticket tag %v", ticket.Tag)
+	}
+	s.policyUpdate(command, authName, policyRef)
+	return nil
+}
+
+func (s *verifyPolicySession) PolicyAuthorize(approvedPolicy tpm2.Digest, policyRef tpm2.Nonce, keySign tpm2.Name, verified *tpm2.TkVerified) error {
+	// During execution, the session digest is the approved policy at this point. The
+	// TPM resets it before updating it, so do the same here.
+	s.reset()
+	return s.computePolicySession.PolicyAuthorize(approvedPolicy, policyRef, keySign, verified)
+}
+
 type nullPolicySession struct {
 	alg tpm2.HashAlgorithmId
 }
@@ -474,6 +621,10 @@ func (*nullPolicySession) PolicyPassword() error {
 	return nil
 }
 
+func (*nullPolicySession) PolicyPhysicalPresence() error {
+	return nil
+}
+
 func (s *nullPolicySession) PolicyGetDigest() (tpm2.Digest, error) {
 	return make(tpm2.Digest, s.alg.Size()), nil
 }
@@ -482,6 +633,14 @@ func (*nullPolicySession) PolicyNvWritten(writtenSet bool) error {
 	return nil
 }
 
+func (*nullPolicySession) PolicyParameters(pHash tpm2.Digest) error {
+	return nil
+}
+
+func (*nullPolicySession) unsupportedElement(typ tpm2.CommandCode) error {
+	return nil
+}
+
 type teePolicySession struct {
 	outputs []policySession
 }
@@ -620,6 +779,10 @@ func (s *teePolicySession) PolicyPassword() error {
 	})
 }
 
+func (s *teePolicySession) PolicyPhysicalPresence() error {
+	return s.forEach(policyPhysicalPresence)
+}
+
 func (s *teePolicySession) PolicyGetDigest() (tpm2.Digest, error) {
 	return s.head().PolicyGetDigest()
 }
@@ -630,6 +793,12 @@ func (s *teePolicySession) PolicyNvWritten(writtenSet bool) error {
 	})
 }
 
+func (s *teePolicySession) PolicyParameters(pHash tpm2.Digest) error {
+	return s.forEach(func(session policySession) error {
+		return session.PolicyParameters(pHash)
+	})
+}
+
 type recorderPolicySession struct {
 	alg     tpm2.HashAlgorithmId
 	details *PolicyBranchDetails
@@ -769,6 +938,11 @@ func (s *recorderPolicySession) PolicyPassword() error {
 	return nil
 }
 
+func (s *recorderPolicySession) PolicyPhysicalPresence() error {
+	s.details.PhysicalPresenceNeeded = true
+	return nil
+}
+
 func (s *recorderPolicySession) PolicyGetDigest() (tpm2.Digest, error) {
 	return nil, errors.New("not supported")
 }
@@ -778,6 +952,16 @@ func (s *recorderPolicySession) PolicyNvWritten(writtenSet bool) error {
 	return nil
 }
 
+func (s *recorderPolicySession) PolicyParameters(pHash tpm2.Digest) error {
+	s.details.policyParametersHash = append(s.details.policyParametersHash, pHash)
+	return nil
+}
+
+func (s *recorderPolicySession) unsupportedElement(typ tpm2.CommandCode) error {
+	s.details.unsupported = append(s.details.unsupported, typ)
+	return nil
+}
+
 type stringifierPolicySession struct {
 	alg   tpm2.HashAlgorithmId
 	w     io.Writer
@@ -880,6 +1064,11 @@ func (s *stringifierPolicySession) PolicyPassword() error {
 	return err
 }
 
+func (s *stringifierPolicySession) PolicyPhysicalPresence() error {
+	_, err := fmt.Fprintf(s.w, "\n%*s PolicyPhysicalPresence()", s.depth*3, "")
+	return err
+}
+
 func (s *stringifierPolicySession) PolicyGetDigest() (tpm2.Digest, error) {
 	return nil, errors.New("not supported")
 }
@@ -889,6 +1078,11 @@ func (s *stringifierPolicySession) PolicyNvWritten(writtenSet bool) error {
 	return err
 }
 
+func (s *stringifierPolicySession) PolicyParameters(pHash tpm2.Digest) error {
+	_, err := fmt.Fprintf(s.w, "\n%*s PolicyParameters(%#x)", s.depth*3, "", pHash)
+	return err
+}
+
 type mockSessionContext struct{}
 
 func (*mockSessionContext) Session() tpm2.SessionContext {
@@ -900,3 +1094,8 @@ func (*mockSessionContext) Save() (func() error, error) {
 }
 
 func (*mockSessionContext) Flush() {}
+
+func (s *stringifierPolicySession) unsupportedElement(typ tpm2.CommandCode) error {
+	_, err := fmt.Fprintf(s.w, "\n%*s <unsupported element (type %v)>", s.depth*3, "", typ)
+	return err
+}
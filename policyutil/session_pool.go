@@ -0,0 +1,220 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// SessionPoolParams provides parameters to [NewSessionPool].
+type SessionPoolParams struct {
+	// MaxIdlePerAlg is the maximum number of idle sessions that the pool will
+	// retain for each session digest algorithm. Sessions returned to the pool
+	// beyond this limit are flushed. The default is 1.
+	MaxIdlePerAlg int
+
+	// NewPolicySessionFn allows the function used to create a new PolicySession
+	// from a session context to be overridden. The default is NewTPMPolicySession.
+	NewPolicySessionFn NewPolicySessionFn
+}
+
+// SessionPool maintains a pool of reusable policy sessions, keyed by session digest
+// algorithm. This avoids the cost of starting a new policy session with
+// TPM2_StartAuthSession every time a policy is executed.
+//
+// Sessions that are returned to the pool are restarted with TPM2_PolicyRestart so that
+// they can be reused. Sessions that have been flushed from the TPM, either because they
+// were used without the [tpm2.AttrContinueSession] attribute or because they were
+// flushed by some other means, are evicted from the pool.
+//
+// It is safe to call methods of SessionPool from multiple goroutines. The commands that
+// the pool executes are serialized, but it is the responsibility of the caller to ensure
+// that the underlying [tpm2.TPMContext] is not used by anything else, including sessions
+// obtained from the pool, whilst a method of SessionPool is running.
+type SessionPool struct {
+	tpm              *tpm2.TPMContext
+	sessions         []tpm2.SessionContext
+	maxIdlePerAlg    int
+	newPolicySession NewPolicySessionFn
+
+	tpmMu sync.Mutex // serializes commands executed by the pool
+
+	mu     sync.Mutex
+	idle   map[tpm2.HashAlgorithmId][]tpm2.SessionContext
+	closed bool
+}
+
+// NewSessionPool returns a new pool of reusable policy sessions that uses the supplied
+// TPM context. The supplied sessions are used for the commands executed by the pool.
+func NewSessionPool(tpm *tpm2.TPMContext, params *SessionPoolParams, sessions ...tpm2.SessionContext) *SessionPool {
+	if params == nil {
+		params = new(SessionPoolParams)
+	}
+	maxIdlePerAlg := params.MaxIdlePerAlg
+	if maxIdlePerAlg <= 0 {
+		maxIdlePerAlg = 1
+	}
+	newPolicySession := params.NewPolicySessionFn
+	if newPolicySession == nil {
+		newPolicySession = NewTPMPolicySession
+	}
+
+	return &SessionPool{
+		tpm:              tpm,
+		sessions:         sessions,
+		maxIdlePerAlg:    maxIdlePerAlg,
+		newPolicySession: newPolicySession,
+		idle:             make(map[tpm2.HashAlgorithmId][]tpm2.SessionContext),
+	}
+}
+
+func (p *SessionPool) popIdle(alg tpm2.HashAlgorithmId) (tpm2.SessionContext, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, errors.New("pool is closed")
+	}
+
+	for {
+		sessions := p.idle[alg]
+		if len(sessions) == 0 {
+			return nil, nil
+		}
+		session := sessions[len(sessions)-1]
+		p.idle[alg] = sessions[:len(sessions)-1]
+		if session.Handle() == tpm2.HandleUnassigned {
+			// The session has been flushed since it was returned.
+			continue
+		}
+		return session, nil
+	}
+}
+
+// Get returns a policy session with the specified session digest algorithm, which is
+// in its initial state. A session from the pool is returned if there is one available,
+// else a new session is started.
+//
+// The returned session should normally be returned to the pool with [SessionPool.Put]
+// once it is no longer needed. It should have the [tpm2.AttrContinueSession] attribute
+// set when it is used for authorization if it is to be reused.
+func (p *SessionPool) Get(alg tpm2.HashAlgorithmId) (PolicySession, error) {
+	if !alg.IsValid() {
+		return nil, errors.New("invalid digest algorithm")
+	}
+
+	session, err := p.popIdle(alg)
+	switch {
+	case err != nil:
+		return nil, err
+	case session != nil:
+		return p.newPolicySession(p.tpm, session, p.sessions...), nil
+	}
+
+	p.tpmMu.Lock()
+	session, err = p.tpm.StartAuthSession(nil, nil, tpm2.SessionTypePolicy, nil, alg, p.sessions...)
+	p.tpmMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("cannot start policy session: %w", err)
+	}
+
+	return p.newPolicySession(p.tpm, session.WithAttrs(tpm2.AttrContinueSession), p.sessions...), nil
+}
+
+// Put returns the supplied policy session to the pool, so that it can be reused. The
+// session is restarted with TPM2_PolicyRestart and its digest is checked to ensure it
+// has been fully reset. If the session cannot be restarted because it has been flushed
+// from the TPM, it is discarded. If the session can't be reset for any other reason,
+// or there are already the maximum number of idle sessions in the pool for the
+// session's digest algorithm, the session is flushed.
+//
+// The session must not be used by the caller after calling this.
+func (p *SessionPool) Put(session PolicySession) error {
+	if session == nil {
+		return nil
+	}
+
+	sc := session.Context().Session()
+	if sc == nil || sc.Handle() == tpm2.HandleUnassigned {
+		// The session has already been flushed.
+		return nil
+	}
+
+	alg := session.HashAlg()
+
+	p.tpmMu.Lock()
+	defer p.tpmMu.Unlock()
+
+	p.mu.Lock()
+	full := p.closed || len(p.idle[alg]) >= p.maxIdlePerAlg
+	p.mu.Unlock()
+	if full {
+		return p.tpm.FlushContext(sc)
+	}
+
+	if err := p.tpm.PolicyRestart(sc, p.sessions...); err != nil {
+		if tpm2.IsTPMHandleError(err, tpm2.AnyErrorCode, tpm2.AnyCommandCode, tpm2.AnyHandleIndex) ||
+			tpm2.IsTPMWarning(err, tpm2.WarningReferenceH0, tpm2.AnyCommandCode) {
+			// The session no longer exists on the TPM.
+			return nil
+		}
+		p.tpm.FlushContext(sc)
+		return fmt.Errorf("cannot restart session: %w", err)
+	}
+
+	digest, err := p.tpm.PolicyGetDigest(sc, p.sessions...)
+	if err != nil {
+		p.tpm.FlushContext(sc)
+		return fmt.Errorf("cannot obtain session digest: %w", err)
+	}
+	if !bytes.Equal(digest, make(tpm2.Digest, alg.Size())) {
+		p.tpm.FlushContext(sc)
+		return errors.New("session digest was not reset")
+	}
+
+	p.mu.Lock()
+	full = p.closed || len(p.idle[alg]) >= p.maxIdlePerAlg
+	if !full {
+		p.idle[alg] = append(p.idle[alg], sc.IncludeAttrs(tpm2.AttrContinueSession))
+	}
+	p.mu.Unlock()
+
+	if full {
+		return p.tpm.FlushContext(sc)
+	}
+	return nil
+}
+
+// Close flushes every idle session in the pool. Any subsequent sessions returned to
+// the pool with [SessionPool.Put] are flushed, and subsequent calls to [SessionPool.Get]
+// will fail.
+func (p *SessionPool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = make(map[tpm2.HashAlgorithmId][]tpm2.SessionContext)
+	p.closed = true
+	p.mu.Unlock()
+
+	p.tpmMu.Lock()
+	defer p.tpmMu.Unlock()
+
+	var firstErr error
+	for _, sessions := range idle {
+		for _, session := range sessions {
+			if session.Handle() == tpm2.HandleUnassigned {
+				continue
+			}
+			if err := p.tpm.FlushContext(session); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
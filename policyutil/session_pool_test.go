@@ -0,0 +1,303 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type sessionPoolSuite struct {
+	testutil.TPMTest
+}
+
+var _ = Suite(&sessionPoolSuite{})
+
+func (s *sessionPoolSuite) countCommands(c *C, code tpm2.CommandCode) (n int) {
+	for _, cmd := range s.CommandLog() {
+		if cmd.GetCommandCode(c) == code {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *sessionPoolSuite) TestGetNew(c *C) {
+	pool := NewSessionPool(s.TPM, nil)
+	defer pool.Close()
+
+	session, err := pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(session.HashAlg(), Equals, tpm2.HashAlgorithmSHA256)
+	c.Check(session.Context().Session().Handle().Type(), Equals, tpm2.HandleTypePolicySession)
+	c.Check(s.countCommands(c, tpm2.CommandStartAuthSession), Equals, 1)
+}
+
+func (s *sessionPoolSuite) TestGetReused(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	pool := NewSessionPool(s.TPM, nil)
+	defer pool.Close()
+
+	session, err := pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	handle := session.Context().Session().Handle()
+
+	_, err = policy.Execute(session, nil, nil, nil)
+	c.Check(err, IsNil)
+	c.Check(pool.Put(session), IsNil)
+
+	session, err = pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(session.Context().Session().Handle(), Equals, handle)
+	c.Check(s.countCommands(c, tpm2.CommandStartAuthSession), Equals, 1)
+	c.Check(s.countCommands(c, tpm2.CommandPolicyRestart), Equals, 1)
+
+	digest, err := session.PolicyGetDigest()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, make(tpm2.Digest, 32))
+}
+
+func (s *sessionPoolSuite) TestGetDifferentAlg(c *C) {
+	pool := NewSessionPool(s.TPM, nil)
+	defer pool.Close()
+
+	session, err := pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(pool.Put(session), IsNil)
+
+	session, err = pool.Get(tpm2.HashAlgorithmSHA1)
+	c.Assert(err, IsNil)
+	c.Check(session.HashAlg(), Equals, tpm2.HashAlgorithmSHA1)
+	c.Check(s.countCommands(c, tpm2.CommandStartAuthSession), Equals, 2)
+}
+
+func (s *sessionPoolSuite) TestPutFlushedSession(c *C) {
+	pool := NewSessionPool(s.TPM, nil)
+	defer pool.Close()
+
+	session, err := pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(s.TPM.FlushContext(session.Context().Session()), IsNil)
+	c.Check(pool.Put(session), IsNil)
+
+	session, err = pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(s.countCommands(c, tpm2.CommandStartAuthSession), Equals, 2)
+	c.Check(session.Context().Session().Handle(), Not(Equals), tpm2.HandleUnassigned)
+}
+
+func (s *sessionPoolSuite) TestGetEvictsFlushedSession(c *C) {
+	pool := NewSessionPool(s.TPM, nil)
+	defer pool.Close()
+
+	session, err := pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	sc := session.Context().Session()
+	c.Check(pool.Put(session), IsNil)
+
+	// Flush the session whilst it is idle in the pool.
+	c.Check(s.TPM.FlushContext(sc), IsNil)
+
+	session, err = pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Check(s.countCommands(c, tpm2.CommandStartAuthSession), Equals, 2)
+	c.Check(session.Context().Session().Handle(), Not(Equals), tpm2.HandleUnassigned)
+}
+
+func (s *sessionPoolSuite) TestPutFull(c *C) {
+	pool := NewSessionPool(s.TPM, &SessionPoolParams{MaxIdlePerAlg: 1})
+	defer pool.Close()
+
+	session1, err := pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	session2, err := pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	handle := session2.Context().Session().Handle()
+
+	c.Check(pool.Put(session1), IsNil)
+	c.Check(pool.Put(session2), IsNil)
+	c.Check(s.TPM.DoesHandleExist(handle), internal_testutil.IsFalse)
+}
+
+func (s *sessionPoolSuite) TestClose(c *C) {
+	pool := NewSessionPool(s.TPM, nil)
+
+	session, err := pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	handle := session.Context().Session().Handle()
+	c.Check(pool.Put(session), IsNil)
+
+	c.Check(pool.Close(), IsNil)
+	c.Check(s.TPM.DoesHandleExist(handle), internal_testutil.IsFalse)
+
+	_, err = pool.Get(tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `pool is closed`)
+}
+
+func (s *sessionPoolSuite) TestGetInvalidAlg(c *C) {
+	pool := NewSessionPool(s.TPM, nil)
+	defer pool.Close()
+
+	_, err := pool.Get(tpm2.HashAlgorithmNull)
+	c.Check(err, ErrorMatches, `invalid digest algorithm`)
+}
+
+func (s *sessionPoolSuite) benchmarkExecute(c *C, pool *SessionPool) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	s.ForgetCommands()
+	c.ResetTimer()
+
+	for i := 0; i < c.N; i++ {
+		var session PolicySession
+		if pool != nil {
+			session, err = pool.Get(tpm2.HashAlgorithmSHA256)
+			c.Assert(err, IsNil)
+		} else {
+			sc, err := s.TPM.StartAuthSession(nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+			c.Assert(err, IsNil)
+			session = NewTPMPolicySession(s.TPM, sc)
+		}
+
+		_, err = policy.Execute(session, nil, nil, nil)
+		c.Assert(err, IsNil)
+
+		if pool != nil {
+			c.Assert(pool.Put(session), IsNil)
+		} else {
+			c.Assert(s.TPM.FlushContext(session.Context().Session()), IsNil)
+		}
+	}
+
+	c.StopTimer()
+	c.Logf("%d iterations, %d TPM2_StartAuthSession commands", c.N, s.countCommands(c, tpm2.CommandStartAuthSession))
+}
+
+func (s *sessionPoolSuite) BenchmarkExecuteWithoutPool(c *C) {
+	s.benchmarkExecute(c, nil)
+}
+
+func (s *sessionPoolSuite) BenchmarkExecuteWithPool(c *C) {
+	pool := NewSessionPool(s.TPM, nil)
+	defer pool.Close()
+	s.benchmarkExecute(c, pool)
+}
+
+// mockSessionPoolTransport is a transport that implements just enough of
+// TPM2_StartAuthSession, TPM2_PolicyRestart, TPM2_PolicyGetDigest and
+// TPM2_FlushContext for SHA-256 policy sessions to exercise SessionPool
+// without a TPM.
+type mockSessionPoolTransport struct {
+	cmd        []byte
+	rsp        io.Reader
+	nextHandle tpm2.Handle
+	started    int
+	flushed    int
+}
+
+func (t *mockSessionPoolTransport) Read(data []byte) (int, error) {
+	return t.rsp.Read(data)
+}
+
+func (t *mockSessionPoolTransport) Write(data []byte) (int, error) {
+	t.cmd = append(t.cmd, data...)
+
+	var hdr tpm2.CommandHeader
+	if _, err := mu.UnmarshalFromBytes(t.cmd, &hdr); err != nil || len(t.cmd) < int(hdr.CommandSize) {
+		// Wait for the rest of the command
+		return len(data), nil
+	}
+	t.cmd = nil
+
+	var params []byte
+	switch hdr.CommandCode {
+	case tpm2.CommandStartAuthSession:
+		if t.nextHandle == 0 {
+			t.nextHandle = tpm2.HandleTypePolicySession.BaseHandle()
+		}
+		handle := t.nextHandle
+		t.nextHandle++
+		t.started++
+		params = mu.MustMarshalToBytes(handle, tpm2.Nonce(make([]byte, 32)))
+	case tpm2.CommandPolicyGetDigest:
+		params = mu.MustMarshalToBytes(make(tpm2.Digest, 32))
+	case tpm2.CommandFlushContext:
+		t.flushed++
+	case tpm2.CommandPolicyRestart:
+	default:
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	t.rsp = bytes.NewReader(mu.MustMarshalToBytes(tpm2.ResponseHeader{
+		Tag:          tpm2.TagNoSessions,
+		ResponseSize: uint32(binary.Size(tpm2.ResponseHeader{}) + len(params)),
+		ResponseCode: tpm2.ResponseSuccess,
+	}, mu.RawBytes(params)))
+	return len(data), nil
+}
+
+func (*mockSessionPoolTransport) Close() error { return nil }
+
+type sessionPoolSuiteNoTPM struct{}
+
+var _ = Suite(&sessionPoolSuiteNoTPM{})
+
+func (s *sessionPoolSuiteNoTPM) TestConcurrentGetPut(c *C) {
+	transport := new(mockSessionPoolTransport)
+	pool := NewSessionPool(tpm2.NewTPMContext(transport), &SessionPoolParams{MaxIdlePerAlg: 2})
+
+	const goroutines = 8
+	const iterations = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				session, err := pool.Get(tpm2.HashAlgorithmSHA256)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := pool.Put(session); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		c.Check(err, IsNil)
+	}
+
+	c.Check(pool.Close(), IsNil)
+
+	// Every session that was started must have been flushed, either because
+	// the pool was full when it was returned or when the pool was closed.
+	c.Check(transport.started, Equals, transport.flushed)
+	c.Check(transport.started <= goroutines*iterations, internal_testutil.IsTrue)
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type computePolicySessionSuite struct{}
+
+var _ = Suite(&computePolicySessionSuite{})
+
+func (s *computePolicySessionSuite) makeDigests(alg crypto.Hash, n int) (out tpm2.DigestList) {
+	for i := 0; i < n; i++ {
+		out = append(out, hash(alg, string(rune('a'+i))))
+	}
+	return out
+}
+
+func (s *computePolicySessionSuite) testPolicyORInvalid(c *C, pHashList tpm2.DigestList, expected string) {
+	session := NewComputePolicySession(tpm2.HashAlgorithmSHA256, nil, false)
+	c.Assert(session.PolicyCommandCode(tpm2.CommandUnseal), IsNil)
+	digest, err := session.PolicyGetDigest()
+	c.Assert(err, IsNil)
+
+	c.Check(session.PolicyOR(pHashList), ErrorMatches, expected)
+
+	// The session digest should not have been modified.
+	newDigest, err := session.PolicyGetDigest()
+	c.Check(err, IsNil)
+	c.Check(newDigest, DeepEquals, digest)
+}
+
+func (s *computePolicySessionSuite) TestPolicyORTooFewDigests(c *C) {
+	s.testPolicyORInvalid(c, s.makeDigests(crypto.SHA256, 1), `invalid number of branches`)
+}
+
+func (s *computePolicySessionSuite) TestPolicyORTooManyDigests(c *C) {
+	s.testPolicyORInvalid(c, s.makeDigests(crypto.SHA256, 9), `invalid number of branches`)
+}
+
+func (s *computePolicySessionSuite) TestPolicyORWrongDigestLength(c *C) {
+	digests := s.makeDigests(crypto.SHA256, 3)
+	digests[2] = hash(crypto.SHA1, "c")
+	s.testPolicyORInvalid(c, digests, `invalid digest length at branch 2`)
+}
+
+func (s *computePolicySessionSuite) TestPolicyORAllDigestsWrongLength(c *C) {
+	s.testPolicyORInvalid(c, s.makeDigests(crypto.SHA1, 2), `invalid digest length at branch 0`)
+}
+
+func (s *computePolicySessionSuite) TestPolicyORLimits(c *C) {
+	for _, n := range []int{2, 8} {
+		session := NewComputePolicySession(tpm2.HashAlgorithmSHA256, nil, false)
+		c.Check(session.PolicyOR(s.makeDigests(crypto.SHA256, n)), IsNil, Commentf("n = %d", n))
+	}
+}
+
+type tpmPolicySessionSuite struct {
+	testutil.TPMTest
+}
+
+func (s *tpmPolicySessionSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&tpmPolicySessionSuite{})
+
+func (s *tpmPolicySessionSuite) TestRestart(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandNVChangeAuth)
+	builder.RootBranch().PolicyAuthValue()
+	expectedDigest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := NewTPMPolicySession(s.TPM, s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256))
+
+	_, err = policy.Execute(session, nil, nil, nil)
+	c.Assert(err, IsNil)
+	digest, err := session.PolicyGetDigest()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+
+	c.Check(session.(PolicySessionRestarter).Restart(), IsNil)
+	digest, err = session.PolicyGetDigest()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, make(tpm2.Digest, 32))
+
+	_, err = policy.Execute(session, nil, nil, nil)
+	c.Assert(err, IsNil)
+	digest, err = session.PolicyGetDigest()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *tpmPolicySessionSuite) TestRestartWithTicket(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	authKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(authKey, nil)
+	expectedDigest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := NewTPMPolicySession(s.TPM, s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256))
+
+	authorizer := &mockSignedAuthorizer{
+		signAuthorization: func(sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKeyName tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+			return SignPolicySignedAuthorization(rand.Reader, &PolicySignedParams{
+				NonceTPM:   sessionNonce,
+				Expiration: -100,
+			}, authKey, policyRef, key, tpm2.HashAlgorithmSHA256)
+		},
+	}
+
+	result, err := policy.Execute(session, NewTPMPolicyResources(s.TPM, nil, &TPMPolicyResourcesParams{SignedAuthorizer: authorizer}), NewTPMHelper(s.TPM, nil), nil)
+	c.Assert(err, IsNil)
+	c.Check(result.NewTickets, internal_testutil.LenEquals, 1)
+
+	c.Check(session.(PolicySessionRestarter).Restart(), IsNil)
+	digest, err := session.PolicyGetDigest()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, make(tpm2.Digest, 32))
+
+	result, err = policy.Execute(session, nil, NewTPMHelper(s.TPM, nil), &PolicyExecuteParams{Tickets: result.NewTickets})
+	c.Assert(err, IsNil)
+	c.Check(result.NewTickets, internal_testutil.LenEquals, 0)
+	c.Check(result.InvalidTickets, internal_testutil.LenEquals, 0)
+
+	digest, err = session.PolicyGetDigest()
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
@@ -0,0 +1,265 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// SignedAuthorizations is a collection of signed authorizations for TPM2_PolicySigned
+// assertions, such as those returned from [CollectSignedAuthorizations]. It implements
+// [SignedAuthorizer] so that it can be supplied to [NewTPMPolicyResources] via
+// [TPMPolicyResourcesParams].
+type SignedAuthorizations []*PolicySignedAuthorization
+
+// SignedAuthorization implements [SignedAuthorizer.SignedAuthorization]. It returns the
+// first authorization in this collection that is associated with the specified auth key
+// and policy ref, and that is either not bound to a session or is bound to the session
+// with the specified nonce.
+func (a SignedAuthorizations) SignedAuthorization(sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+	for _, auth := range a {
+		if auth == nil || auth.AuthKey == nil {
+			continue
+		}
+		if !bytes.Equal(auth.AuthKey.Name(), authKey) || !bytes.Equal(auth.PolicyRef, policyRef) {
+			continue
+		}
+		if len(auth.NonceTPM) > 0 && !bytes.Equal(auth.NonceTPM, sessionNonce) {
+			continue
+		}
+		return auth, nil
+	}
+	return nil, fmt.Errorf("no signed authorization for key %#x and policy ref %#x", authKey, policyRef)
+}
+
+// CollectSignedAuthorizations obtains a signed authorization for every TPM2_PolicySigned
+// assertion in the branch of the supplied policy selected by the supplied path, by invoking
+// the supplied callback once for every distinct combination of auth key and policy ref. The
+// path must select a single branch. Note that TPM2_PolicySigned assertions in policies that
+// are authorized by a TPM2_PolicyAuthorize assertion are not included.
+//
+// The supplied session nonce is passed to the callback. It should be the nonce of the session
+// that the policy will be executed in, if the authorizations are to be bound to it. This may be
+// nil if the authorizations are not bound to a session.
+//
+// The callback must return an authorization for the specified auth key and policy ref. An
+// error is returned if it returns no authorization or an authorization for a different key
+// or policy ref.
+//
+// The returned authorizations can be supplied to [Policy.Execute] by converting them to
+// [SignedAuthorizations].
+func CollectSignedAuthorizations(policy *Policy, path string, sessionNonce tpm2.Nonce, sign func(authKey tpm2.Name, policyRef tpm2.Nonce, nonceTPM tpm2.Nonce) (*PolicySignedAuthorization, error)) ([]*PolicySignedAuthorization, error) {
+	if policy == nil {
+		return nil, errors.New("no policy")
+	}
+
+	_, assertions, err := policy.signedAssertions(tpm2.HashAlgorithmNull, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*PolicySignedAuthorization
+	for _, assertion := range assertions {
+		auth, err := sign(assertion.AuthName, assertion.PolicyRef, sessionNonce)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("cannot sign authorization for TPM2_PolicySigned assertion with key %#x and policy ref %#x: %w", assertion.AuthName, assertion.PolicyRef, err)
+		case auth == nil:
+			return nil, fmt.Errorf("missing signed authorization for TPM2_PolicySigned assertion with key %#x and policy ref %#x", assertion.AuthName, assertion.PolicyRef)
+		case auth.AuthKey == nil || !bytes.Equal(auth.AuthKey.Name(), assertion.AuthName) || !bytes.Equal(auth.PolicyRef, assertion.PolicyRef):
+			return nil, fmt.Errorf("signed authorization for TPM2_PolicySigned assertion with key %#x and policy ref %#x has the wrong key or policy ref", assertion.AuthName, assertion.PolicyRef)
+		}
+
+		out = append(out, auth)
+	}
+
+	return out, nil
+}
+
+// signedAssertions returns the distinct combinations of auth key and policy ref for every
+// TPM2_PolicySigned assertion in the branch of this policy selected by the supplied path,
+// along with the full path of the selected branch. The path must select a single branch.
+func (p *Policy) signedAssertions(alg tpm2.HashAlgorithmId, path string) (string, []PolicyAuthorizationDetails, error) {
+	details, err := p.Details(alg, path, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot obtain policy details: %w", err)
+	}
+	if len(details) != 1 {
+		return "", nil, fmt.Errorf("path %q selects %d branches", path, len(details))
+	}
+
+	var branchPath string
+	var out []PolicyAuthorizationDetails
+	for path, branch := range details {
+		branchPath = path
+	Loop:
+		for _, assertion := range branch.Signed {
+			for _, s := range out {
+				if bytes.Equal(s.AuthName, assertion.AuthName) && bytes.Equal(s.PolicyRef, assertion.PolicyRef) {
+					continue Loop
+				}
+			}
+			out = append(out, assertion)
+		}
+	}
+
+	return branchPath, out, nil
+}
+
+// PolicySignedRequest describes a signed authorization that is required in order to complete
+// the execution of a policy that was prepared with [Policy.PrepareExecute].
+type PolicySignedRequest struct {
+	AuthKey   tpm2.Name  // The name of the key that must sign the authorization
+	PolicyRef tpm2.Nonce // The policy ref of the TPM2_PolicySigned assertion
+	NonceTPM  tpm2.Nonce // The TPM nonce of the session that the authorization must be bound to
+}
+
+// PreparedPolicyExecution corresponds to the execution of a policy that is waiting for signed
+// authorizations, and is returned from [Policy.PrepareExecute].
+type PreparedPolicyExecution struct {
+	policy    *Policy
+	session   PolicySession
+	resources PolicyResources
+	tpm       TPMHelper
+	params    PolicyExecuteParams
+	nonceTPM  tpm2.Nonce
+	requests  []PolicySignedRequest
+}
+
+// PrepareExecute is the first phase of a 2-phase alternative to [Policy.Execute] that is useful
+// when signed authorizations for TPM2_PolicySigned assertions are created by an interactive
+// signer, such as a hardware token or a remote service. Rather than requiring every signed
+// authorization to be available up front, this returns a [PreparedPolicyExecution] that
+// describes the signed authorizations that are required, via its Requests method. Each of these
+// is bound to the supplied session. Once they have been obtained, they can be supplied to
+// [PreparedPolicyExecution.Resume] in order to execute the policy.
+//
+// The Path field of params must select a single branch - automatic branch selection is not
+// performed. Note that TPM2_PolicySigned assertions in policies that are authorized by a
+// TPM2_PolicyAuthorize assertion are not included in the returned requests, and any
+// authorizations that these require are obtained from the supplied resources during execution.
+//
+// No commands are executed by this function. The supplied session should not be used between
+// this function and the call to [PreparedPolicyExecution.Resume], as this will change its nonce.
+func (p *Policy) PrepareExecute(session PolicySession, resources PolicyResources, tpm TPMHelper, params *PolicyExecuteParams) (*PreparedPolicyExecution, error) {
+	if session == nil {
+		return nil, errors.New("no session")
+	}
+	if session.Context() == nil || session.Context().Session() == nil {
+		return nil, errors.New("no session context")
+	}
+	if params == nil {
+		params = new(PolicyExecuteParams)
+	}
+
+	if err := p.checkSessionAlg(session.HashAlg(), params.Path); err != nil {
+		return nil, err
+	}
+
+	path, assertions, err := p.signedAssertions(session.HashAlg(), params.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceTPM := session.Context().Session().State().NonceTPM
+	prepared := &PreparedPolicyExecution{
+		policy:    p,
+		session:   session,
+		resources: resources,
+		tpm:       tpm,
+		params:    *params,
+		nonceTPM:  append(tpm2.Nonce(nil), nonceTPM...),
+	}
+	prepared.params.Path = path
+
+	for _, assertion := range assertions {
+		prepared.requests = append(prepared.requests, PolicySignedRequest{
+			AuthKey:   assertion.AuthName,
+			PolicyRef: assertion.PolicyRef,
+			NonceTPM:  append(tpm2.Nonce(nil), nonceTPM...),
+		})
+	}
+
+	return prepared, nil
+}
+
+// Requests returns the signed authorizations that must be supplied to [PreparedPolicyExecution.Resume].
+func (e *PreparedPolicyExecution) Requests() []PolicySignedRequest {
+	return e.requests
+}
+
+// Resume is the second phase of a policy execution that was started with [Policy.PrepareExecute].
+// The supplied authorizations must contain an authorization for every request returned from the
+// Requests method. Each authorization must be bound to the nonce of the session and must have a
+// valid signature, else an error is returned before any commands are executed. An error is also
+// returned if the session nonce has changed since the execution was prepared.
+//
+// On success, this behaves like [Policy.Execute].
+func (e *PreparedPolicyExecution) Resume(auths []*PolicySignedAuthorization) (*PolicyExecuteResult, error) {
+	if !bytes.Equal(e.session.Context().Session().State().NonceTPM, e.nonceTPM) {
+		return nil, errors.New("the session nonce has changed since the execution was prepared")
+	}
+
+	for _, request := range e.requests {
+		auth, err := SignedAuthorizations(auths).SignedAuthorization(e.session.HashAlg(), request.NonceTPM, request.AuthKey, request.PolicyRef)
+		if err != nil {
+			return nil, fmt.Errorf("missing signed authorization for TPM2_PolicySigned assertion with key %#x and policy ref %#x", request.AuthKey, request.PolicyRef)
+		}
+		if !auth.BoundToNonce(request.NonceTPM) {
+			return nil, fmt.Errorf("signed authorization for TPM2_PolicySigned assertion with key %#x and policy ref %#x is not bound to the session", request.AuthKey, request.PolicyRef)
+		}
+		ok, err := auth.Verify()
+		if err != nil {
+			return nil, fmt.Errorf("cannot verify signed authorization for TPM2_PolicySigned assertion with key %#x and policy ref %#x: %w", request.AuthKey, request.PolicyRef, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("signed authorization for TPM2_PolicySigned assertion with key %#x and policy ref %#x has an invalid signature", request.AuthKey, request.PolicyRef)
+		}
+	}
+
+	resources := e.resources
+	if resources == nil {
+		resources = new(nullPolicyResources)
+	}
+	params := e.params
+	params.CheckSignedAuthorizationNonces = true
+
+	return e.policy.Execute(e.session, &preparedPolicyResources{PolicyResources: resources, auths: auths}, e.tpm, &params)
+}
+
+// preparedPolicyResources supplies the signed authorizations provided to
+// [PreparedPolicyExecution.Resume], falling back to the underlying resources
+// for any others.
+type preparedPolicyResources struct {
+	PolicyResources
+	auths SignedAuthorizations
+}
+
+func (r *preparedPolicyResources) SignedAuthorization(sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+	if auth, err := r.auths.SignedAuthorization(sessionAlg, sessionNonce, authKey, policyRef); err == nil {
+		return auth, nil
+	}
+	return r.PolicyResources.SignedAuthorization(sessionAlg, sessionNonce, authKey, policyRef)
+}
+
+func (r *preparedPolicyResources) ContextLoadWithError(context *tpm2.Context, policy *Policy) (ResourceContext, error) {
+	return contextLoad(r.PolicyResources, context, policy)
+}
+
+func (r *preparedPolicyResources) SignedAuthorizationTimeout(authKey tpm2.Name, policyRef tpm2.Nonce, auth *PolicySignedAuthorization, timeout tpm2.Timeout) {
+	signedAuthorizationTimeout(r.PolicyResources, authKey, policyRef, auth, timeout)
+}
+
+func (r *preparedPolicyResources) SignedAuthorizationWithRand(rand io.Reader, sessionAlg tpm2.HashAlgorithmId, sessionNonce tpm2.Nonce, authKey tpm2.Name, policyRef tpm2.Nonce) (*PolicySignedAuthorization, error) {
+	if auth, err := r.auths.SignedAuthorization(sessionAlg, sessionNonce, authKey, policyRef); err == nil {
+		return auth, nil
+	}
+	return signedAuthorizationWithRand(r.PolicyResources, rand, sessionAlg, sessionNonce, authKey, policyRef)
+}
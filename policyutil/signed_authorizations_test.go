@@ -0,0 +1,390 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package policyutil_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/objectutil"
+	. "github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+)
+
+type signedAuthorizationsKey struct {
+	key    *ecdsa.PrivateKey
+	pubKey *tpm2.Public
+}
+
+func newSignedAuthorizationsKey(c *C) *signedAuthorizationsKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	pubKey, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+	return &signedAuthorizationsKey{key: key, pubKey: pubKey}
+}
+
+type signedAuthorizationsSuiteNoTPM struct{}
+
+var _ = Suite(&signedAuthorizationsSuiteNoTPM{})
+
+func (s *signedAuthorizationsSuiteNoTPM) newSigner(c *C, keys ...*signedAuthorizationsKey) (func(tpm2.Name, tpm2.Nonce, tpm2.Nonce) (*PolicySignedAuthorization, error), *int) {
+	var n int
+	return func(authKey tpm2.Name, policyRef tpm2.Nonce, nonceTPM tpm2.Nonce) (*PolicySignedAuthorization, error) {
+		n++
+		for _, key := range keys {
+			if !bytes.Equal(key.pubKey.Name(), authKey) {
+				continue
+			}
+			return SignPolicySignedAuthorization(rand.Reader, &PolicySignedParams{NonceTPM: nonceTPM}, key.pubKey, policyRef, key.key, tpm2.HashAlgorithmSHA256)
+		}
+		return nil, nil
+	}, &n
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestCollect(c *C) {
+	key1 := newSignedAuthorizationsKey(c)
+	key2 := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(key1.pubKey, []byte("foo"))
+	builder.RootBranch().PolicySigned(key2.pubKey, nil)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	sign, n := s.newSigner(c, key1, key2)
+	auths, err := CollectSignedAuthorizations(policy, "", []byte("nonce"), sign)
+	c.Assert(err, IsNil)
+	c.Check(*n, Equals, 2)
+	c.Assert(auths, internal_testutil.LenEquals, 2)
+
+	c.Check(auths[0].AuthKey, DeepEquals, key1.pubKey)
+	c.Check(auths[0].PolicyRef, DeepEquals, tpm2.Nonce("foo"))
+	c.Check(auths[0].NonceTPM, DeepEquals, tpm2.Nonce("nonce"))
+	c.Check(auths[1].AuthKey, DeepEquals, key2.pubKey)
+	c.Check(auths[1].PolicyRef, internal_testutil.LenEquals, 0)
+
+	auth, err := SignedAuthorizations(auths).SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), key2.pubKey.Name(), nil)
+	c.Check(err, IsNil)
+	c.Check(auth, Equals, auths[1])
+	auth, err = SignedAuthorizations(auths).SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce"), key1.pubKey.Name(), []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(auth, Equals, auths[0])
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestCollectDuplicate(c *C) {
+	key := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(key.pubKey, []byte("foo"))
+	builder.RootBranch().PolicySigned(key.pubKey, []byte("foo"))
+	builder.RootBranch().PolicySigned(key.pubKey, []byte("bar"))
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	sign, n := s.newSigner(c, key)
+	auths, err := CollectSignedAuthorizations(policy, "", nil, sign)
+	c.Assert(err, IsNil)
+	c.Check(*n, Equals, 2)
+	c.Assert(auths, internal_testutil.LenEquals, 2)
+	c.Check(auths[0].PolicyRef, DeepEquals, tpm2.Nonce("foo"))
+	c.Check(auths[1].PolicyRef, DeepEquals, tpm2.Nonce("bar"))
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestCollectBranch(c *C) {
+	key1 := newSignedAuthorizationsKey(c)
+	key2 := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+	node.AddBranch("branch1").PolicySigned(key1.pubKey, nil)
+	node.AddBranch("branch2").PolicySigned(key2.pubKey, nil)
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	sign, _ := s.newSigner(c, key1, key2)
+	auths, err := CollectSignedAuthorizations(policy, "branch2", nil, sign)
+	c.Assert(err, IsNil)
+	c.Assert(auths, internal_testutil.LenEquals, 1)
+	c.Check(auths[0].AuthKey, DeepEquals, key2.pubKey)
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestCollectAmbiguousPath(c *C) {
+	key := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+	node.AddBranch("branch1").PolicySigned(key.pubKey, nil)
+	node.AddBranch("branch2").PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	sign, _ := s.newSigner(c, key)
+	_, err = CollectSignedAuthorizations(policy, "", nil, sign)
+	c.Check(err, ErrorMatches, `path "" selects 2 branches`)
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestCollectMissing(c *C) {
+	key1 := newSignedAuthorizationsKey(c)
+	key2 := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(key1.pubKey, nil)
+	builder.RootBranch().PolicySigned(key2.pubKey, []byte("foo"))
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	sign, _ := s.newSigner(c, key1)
+	_, err = CollectSignedAuthorizations(policy, "", nil, sign)
+	c.Check(err, ErrorMatches, `missing signed authorization for TPM2_PolicySigned assertion with key 0x[[:xdigit:]]{68} and policy ref 0x666f6f`)
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestCollectWrongKey(c *C) {
+	key1 := newSignedAuthorizationsKey(c)
+	key2 := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(key1.pubKey, []byte("bar"))
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	_, err = CollectSignedAuthorizations(policy, "", nil, func(authKey tpm2.Name, policyRef tpm2.Nonce, nonceTPM tpm2.Nonce) (*PolicySignedAuthorization, error) {
+		return SignPolicySignedAuthorization(rand.Reader, nil, key2.pubKey, policyRef, key2.key, tpm2.HashAlgorithmSHA256)
+	})
+	c.Check(err, ErrorMatches, `signed authorization for TPM2_PolicySigned assertion with key 0x[[:xdigit:]]{68} and policy ref 0x626172 has the wrong key or policy ref`)
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestCollectSignError(c *C) {
+	key := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(key.pubKey, []byte("bar"))
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	_, err = CollectSignedAuthorizations(policy, "", nil, func(authKey tpm2.Name, policyRef tpm2.Nonce, nonceTPM tpm2.Nonce) (*PolicySignedAuthorization, error) {
+		return nil, errors.New("some error")
+	})
+	c.Check(err, ErrorMatches, `cannot sign authorization for TPM2_PolicySigned assertion with key 0x[[:xdigit:]]{68} and policy ref 0x626172: some error`)
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestSignedAuthorizationWrongNonce(c *C) {
+	key := newSignedAuthorizationsKey(c)
+
+	auth, err := SignPolicySignedAuthorization(rand.Reader, &PolicySignedParams{NonceTPM: []byte("nonce1")}, key.pubKey, []byte("bar"), key.key, tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+
+	_, err = SignedAuthorizations{auth}.SignedAuthorization(tpm2.HashAlgorithmSHA256, []byte("nonce2"), key.pubKey.Name(), []byte("bar"))
+	c.Check(err, ErrorMatches, `no signed authorization for key 0x[[:xdigit:]]{68} and policy ref 0x626172`)
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestPreparedPolicyResourcesContextLoadWithError(c *C) {
+	resources := NewPreparedPolicyResources(&contextLoadPolicyResources{
+		contextLoadFn: func(context *tpm2.Context, policy *Policy) (ResourceContext, error) {
+			return nil, errors.New("some error")
+		},
+	}, nil)
+
+	// The optional ErrorContextLoader interface of the underlying resources
+	// is forwarded.
+	loader, ok := resources.(ErrorContextLoader)
+	c.Assert(ok, internal_testutil.IsTrue)
+
+	_, err := loader.ContextLoadWithError(new(tpm2.Context), nil)
+	c.Check(err, ErrorMatches, `some error`)
+}
+
+type signedAuthorizationsSuite struct {
+	testutil.TPMTest
+}
+
+func (s *signedAuthorizationsSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&signedAuthorizationsSuite{})
+
+func (s *signedAuthorizationsSuite) TestExecute(c *C) {
+	key1 := newSignedAuthorizationsKey(c)
+	key2 := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(key1.pubKey, []byte("foo"))
+	builder.RootBranch().PolicySigned(key2.pubKey, []byte("bar"))
+	expectedDigest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	auths, err := CollectSignedAuthorizations(policy, "", session.State().NonceTPM, func(authKey tpm2.Name, policyRef tpm2.Nonce, nonceTPM tpm2.Nonce) (*PolicySignedAuthorization, error) {
+		for _, key := range []*signedAuthorizationsKey{key1, key2} {
+			if bytes.Equal(key.pubKey.Name(), authKey) {
+				return SignPolicySignedAuthorization(rand.Reader, &PolicySignedParams{NonceTPM: nonceTPM}, key.pubKey, policyRef, key.key, tpm2.HashAlgorithmSHA256)
+			}
+		}
+		return nil, nil
+	})
+	c.Assert(err, IsNil)
+
+	resources := NewTPMPolicyResources(s.TPM, nil, &TPMPolicyResourcesParams{SignedAuthorizer: SignedAuthorizations(auths)})
+	_, err = policy.Execute(NewTPMPolicySession(s.TPM, session), resources, NewTPMHelper(s.TPM, nil), nil)
+	c.Check(err, IsNil)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *signedAuthorizationsSuiteNoTPM) TestPrepareExecuteNoSession(c *C) {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	_, err = policy.PrepareExecute(nil, nil, nil, nil)
+	c.Check(err, ErrorMatches, `no session`)
+}
+
+func (s *signedAuthorizationsSuite) sign(auths *[]*PolicySignedAuthorization, key *signedAuthorizationsKey, request PolicySignedRequest) error {
+	auth, err := SignPolicySignedAuthorization(rand.Reader, &PolicySignedParams{NonceTPM: request.NonceTPM}, key.pubKey, request.PolicyRef, key.key, tpm2.HashAlgorithmSHA256)
+	if err != nil {
+		return err
+	}
+	*auths = append(*auths, auth)
+	return nil
+}
+
+func (s *signedAuthorizationsSuite) TestPrepareExecute(c *C) {
+	key1 := newSignedAuthorizationsKey(c)
+	key2 := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+	b1 := node.AddBranch("branch1")
+	b1.PolicySigned(key1.pubKey, []byte("foo"))
+	b1.PolicySigned(key2.pubKey, []byte("bar"))
+	node.AddBranch("branch2").PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	s.ForgetCommands()
+
+	prepared, err := policy.PrepareExecute(NewTPMPolicySession(s.TPM, session), nil, NewTPMHelper(s.TPM, nil), &PolicyExecuteParams{Path: "branch1"})
+	c.Assert(err, IsNil)
+	c.Check(s.CommandLog(), internal_testutil.LenEquals, 0)
+
+	requests := prepared.Requests()
+	c.Assert(requests, internal_testutil.LenEquals, 2)
+	c.Check(requests[0].AuthKey, DeepEquals, key1.pubKey.Name())
+	c.Check(requests[0].PolicyRef, DeepEquals, tpm2.Nonce("foo"))
+	c.Check(requests[0].NonceTPM, DeepEquals, session.State().NonceTPM)
+	c.Check(requests[1].AuthKey, DeepEquals, key2.pubKey.Name())
+	c.Check(requests[1].PolicyRef, DeepEquals, tpm2.Nonce("bar"))
+	c.Check(requests[1].NonceTPM, DeepEquals, session.State().NonceTPM)
+
+	var auths []*PolicySignedAuthorization
+	c.Assert(s.sign(&auths, key2, requests[1]), IsNil)
+	c.Assert(s.sign(&auths, key1, requests[0]), IsNil)
+
+	result, err := prepared.Resume(auths)
+	c.Assert(err, IsNil)
+	c.Check(result.Path, Equals, "branch1")
+
+	var n int
+	for _, cmd := range s.CommandLog() {
+		if cmd.GetCommandCode(c) == tpm2.CommandPolicySigned {
+			n++
+		}
+	}
+	c.Check(n, Equals, 2)
+
+	digest, err := s.TPM.PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, s.computeBranchDigest(c, key1, key2))
+}
+
+func (s *signedAuthorizationsSuite) computeBranchDigest(c *C, key1, key2 *signedAuthorizationsKey) tpm2.Digest {
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(key1.pubKey, []byte("foo"))
+	builder.RootBranch().PolicySigned(key2.pubKey, []byte("bar"))
+	digest, _, err := builder.Policy()
+	c.Assert(err, IsNil)
+	return digest
+}
+
+func (s *signedAuthorizationsSuite) TestPrepareExecuteAmbiguousPath(c *C) {
+	key := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	node := builder.RootBranch().AddBranchNode()
+	node.AddBranch("branch1").PolicySigned(key.pubKey, nil)
+	node.AddBranch("branch2").PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	_, err = policy.PrepareExecute(NewTPMPolicySession(s.TPM, session), nil, NewTPMHelper(s.TPM, nil), nil)
+	c.Check(err, ErrorMatches, `path "" selects 2 branches`)
+}
+
+func (s *signedAuthorizationsSuite) testResumeInvalid(c *C, auth func(*signedAuthorizationsKey, PolicySignedRequest) *PolicySignedAuthorization, expectedErr string) {
+	key := newSignedAuthorizationsKey(c)
+
+	builder := NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicySigned(key.pubKey, []byte("foo"))
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+
+	prepared, err := policy.PrepareExecute(NewTPMPolicySession(s.TPM, session), nil, NewTPMHelper(s.TPM, nil), nil)
+	c.Assert(err, IsNil)
+	requests := prepared.Requests()
+	c.Assert(requests, internal_testutil.LenEquals, 1)
+
+	var auths []*PolicySignedAuthorization
+	if a := auth(key, requests[0]); a != nil {
+		auths = append(auths, a)
+	}
+
+	_, err = prepared.Resume(auths)
+	c.Check(err, ErrorMatches, expectedErr)
+
+	for _, cmd := range s.CommandLog() {
+		c.Check(cmd.GetCommandCode(c), Not(Equals), tpm2.CommandPolicySigned)
+	}
+}
+
+func (s *signedAuthorizationsSuite) TestResumeMissing(c *C) {
+	s.testResumeInvalid(c, func(*signedAuthorizationsKey, PolicySignedRequest) *PolicySignedAuthorization {
+		return nil
+	}, `missing signed authorization for TPM2_PolicySigned assertion with key 0x[[:xdigit:]]{68} and policy ref 0x666f6f`)
+}
+
+func (s *signedAuthorizationsSuite) TestResumeUnbound(c *C) {
+	s.testResumeInvalid(c, func(key *signedAuthorizationsKey, request PolicySignedRequest) *PolicySignedAuthorization {
+		auth, err := SignPolicySignedAuthorization(rand.Reader, nil, key.pubKey, request.PolicyRef, key.key, tpm2.HashAlgorithmSHA256)
+		c.Assert(err, IsNil)
+		return auth
+	}, `signed authorization for TPM2_PolicySigned assertion with key 0x[[:xdigit:]]{68} and policy ref 0x666f6f is not bound to the session`)
+}
+
+func (s *signedAuthorizationsSuite) TestResumeInvalidSignature(c *C) {
+	s.testResumeInvalid(c, func(key *signedAuthorizationsKey, request PolicySignedRequest) *PolicySignedAuthorization {
+		auth, err := SignPolicySignedAuthorization(rand.Reader, &PolicySignedParams{NonceTPM: request.NonceTPM}, key.pubKey, request.PolicyRef, key.key, tpm2.HashAlgorithmSHA256)
+		c.Assert(err, IsNil)
+		auth.Expiration = -100
+		return auth
+	}, `signed authorization for TPM2_PolicySigned assertion with key 0x[[:xdigit:]]{68} and policy ref 0x666f6f has an invalid signature`)
+}
@@ -54,6 +54,15 @@ type TPMHelper interface {
 	GetPermanentHandleAuthPolicy(handle tpm2.Handle) (tpm2.TaggedHash, error)
 }
 
+// TPMPropertyReader is an optional interface that can be implemented by a [TPMHelper]
+// in order to provide access to TPM properties. It is used by [Policy.Execute] when
+// PolicyExecuteParams.LimitResourceUsage is set. The TPMHelper returned from
+// [NewTPMHelper] implements this.
+type TPMPropertyReader interface {
+	// GetCapabilityTPMProperty returns the value of the specified TPM property.
+	GetCapabilityTPMProperty(property tpm2.Property) (uint32, error)
+}
+
 type onlineTpmHelper struct {
 	newPolicySession NewPolicySessionFn
 	tpm              *tpm2.TPMContext
@@ -140,6 +149,10 @@ func (h *onlineTpmHelper) GetPermanentHandleAuthPolicy(handle tpm2.Handle) (tpm2
 	return h.tpm.GetCapabilityAuthPolicy(handle, h.sessions...)
 }
 
+func (h *onlineTpmHelper) GetCapabilityTPMProperty(property tpm2.Property) (uint32, error) {
+	return h.tpm.GetCapabilityTPMProperty(property, h.sessions...)
+}
+
 type nullTpmHelper struct{}
 
 func (*nullTpmHelper) StartAuthSession(sessionType tpm2.SessionType, alg tpm2.HashAlgorithmId) (SessionContext, PolicySession, error) {
@@ -177,3 +190,7 @@ func (*nullTpmHelper) NVReadPublic(handle tpm2.HandleContext) (*tpm2.NVPublic, e
 func (*nullTpmHelper) GetPermanentHandleAuthPolicy(handle tpm2.Handle) (tpm2.TaggedHash, error) {
 	return tpm2.MakeTaggedHash(tpm2.HashAlgorithmNull, nil), errors.New("no TPMHelper")
 }
+
+func (*nullTpmHelper) GetCapabilityTPMProperty(property tpm2.Property) (uint32, error) {
+	return 0, errors.New("no TPMHelper")
+}
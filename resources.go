@@ -13,6 +13,7 @@ import (
 	"io"
 	"reflect"
 
+	internal_crypt "github.com/canonical/go-tpm2/internal/crypt"
 	"github.com/canonical/go-tpm2/mu"
 )
 
@@ -42,12 +43,73 @@ type SessionContextParams struct {
 // SessionContextState corresponds to the state of a session.
 type SessionContextState struct {
 	NonceTPM       Nonce // The most recent TPM nonce value
+	NonceCaller    Nonce `tpm2:"ignore"` // The most recent caller nonce value. This is not serialized.
 	IsAudit        bool  // Whether the session is currently an audit session
 	IsExclusive    bool  // Whether the session is currently an exclusive audit session
 	NeedsPassword  bool  // Whether a policy session includes the TPM2_PolicyPassword assertion
 	NeedsAuthValue bool  // Whether a policy session includes the TPM2_PolicyAuthValue assertion
 }
 
+// SessionState contains the non-secret parameters and state of a session, and is returned
+// from [SessionContextStateExporter.ExportState]. It is intended for diagnostics and for storing in a
+// caller defined format in order to provide hints for re-establishing a session, and never
+// contains the session key.
+type SessionState struct {
+	Handle      Handle          // The session handle
+	Type        SessionType     // The session type
+	HashAlg     HashAlgorithmId // The session's digest algorithm
+	IsBound     bool            // Whether the session is bound
+	BoundEntity Name            // The bound entity
+	Symmetric   SymDef          // The session's symmetric algorithm
+
+	// HasSessionKey indicates whether the session has a session key, which is the case
+	// for salted sessions and sessions started with a bind entity.
+	HasSessionKey bool
+
+	// IsSalted indicates whether the session is salted. This is only valid if
+	// InitialNonceTPM is set.
+	IsSalted bool
+
+	// InitialNonceTPM is the nonceTPM that was returned when the session was started. This
+	// is nil if the session context was created from a serialized context, which doesn't
+	// retain it.
+	InitialNonceTPM Nonce
+
+	// InitialNonceCaller is the nonceCaller that was sent when the session was started.
+	// This is nil if the session context was created from a serialized context, which
+	// doesn't retain it.
+	InitialNonceCaller Nonce
+
+	NonceTPM       Nonce // The most recent TPM nonce value
+	NonceCaller    Nonce // The most recent caller nonce value
+	IsAudit        bool  // Whether the session is currently an audit session
+	IsExclusive    bool  // Whether the session is currently an exclusive audit session
+	NeedsPassword  bool  // Whether a policy session includes the TPM2_PolicyPassword assertion
+	NeedsAuthValue bool  // Whether a policy session includes the TPM2_PolicyAuthValue assertion
+}
+
+// ComputeSessionKey re-derives the session key from this state and the supplied
+// authorization value of the entity that the session was bound to when it was started
+// (the bind argument of [TPMContext.StartAuthSession]). This returns nil if the session
+// doesn't have a session key. An error is returned if the session is salted, because the
+// salt is secret and isn't retained, or if the initial nonces aren't available.
+func (s *SessionState) ComputeSessionKey(authValue []byte) ([]byte, error) {
+	if !s.HasSessionKey {
+		return nil, nil
+	}
+	if len(s.InitialNonceTPM) == 0 || len(s.InitialNonceCaller) == 0 {
+		return nil, errors.New("initial nonces are not available")
+	}
+	if s.IsSalted {
+		return nil, errors.New("cannot compute the session key for a salted session")
+	}
+	if !s.HashAlg.Available() {
+		return nil, fmt.Errorf("unsupported digest algorithm or algorithm not linked in to binary (%v)", s.HashAlg)
+	}
+
+	return internal_crypt.KDFa(s.HashAlg.GetHash(), trimAuthValue(authValue), []byte(SessionKey), s.InitialNonceTPM, s.InitialNonceCaller, s.HashAlg.Size()*8), nil
+}
+
 // SessionContext is a HandleContext that corresponds to a session on the TPM.
 type SessionContext interface {
 	HandleContext
@@ -84,6 +146,31 @@ type SessionContext interface {
 	ExcludeAttrs(attrs SessionAttributes) SessionContext
 }
 
+// SessionContextNonces is an optional interface that is implemented by the [SessionContext]
+// implementation in this package, and provides read-only access to the caller nonce of a
+// session. Copies of both the caller and TPM nonces are also available from
+// [SessionContextStateExporter.ExportState].
+type SessionContextNonces interface {
+	// NonceCaller returns a copy of the most recent caller nonce sent to the TPM for this
+	// session. A new caller nonce is generated for every command that the session is used
+	// with. This will return nil if the session hasn't been used for a command since this
+	// context was created, or if the context was created via NewLimitedHandleContext or
+	// HandleContext.Dispose was called.
+	NonceCaller() Nonce
+}
+
+// SessionContextStateExporter is an optional interface that is implemented by the
+// [SessionContext] implementation in this package in order to export the non-secret
+// state of a session.
+type SessionContextStateExporter interface {
+	// ExportState returns the non-secret parameters and state of this session. The
+	// session key is never exported, but the returned state can be used to re-derive it
+	// for unsalted sessions given the authorization value of the bind entity (see
+	// [SessionState.ComputeSessionKey]). This will return an error if the context was
+	// created via NewLimitedHandleContext or HandleContext.Dispose was called.
+	ExportState() (*SessionState, error)
+}
+
 // ResourceContext is a HandleContext that corresponds to a non-session entity on the TPM.
 type ResourceContext interface {
 	HandleContext
@@ -118,9 +205,19 @@ type NVIndexContext interface {
 	SetAttr(a NVAttributes)
 }
 
+// sessionContextInitialState contains the parameters that a session was started with,
+// which are required to re-derive the session key.
+type sessionContextInitialState struct {
+	sessionType SessionType
+	isSalted    bool
+	nonceTPM    Nonce
+	nonceCaller Nonce
+}
+
 type sessionContextData struct {
-	Params SessionContextParams
-	State  SessionContextState
+	Params  SessionContextParams
+	State   SessionContextState
+	Initial *sessionContextInitialState `tpm2:"ignore"` // This is not serialized.
 }
 
 type handleContextU struct {
@@ -587,6 +684,53 @@ func (r *sessionContext) NonceTPM() Nonce {
 	return state.NonceTPM
 }
 
+func (r *sessionContext) NonceCaller() Nonce {
+	state := r.State()
+	if state == nil || state.NonceCaller == nil {
+		return nil
+	}
+	return append(Nonce{}, state.NonceCaller...)
+}
+
+func (r *sessionContext) ExportState() (*SessionState, error) {
+	d := r.Data()
+	if d == nil {
+		return nil, errors.New("no session data")
+	}
+
+	state := &SessionState{
+		Handle:         r.Handle(),
+		HashAlg:        d.Params.HashAlg,
+		IsBound:        d.Params.IsBound,
+		BoundEntity:    append(Name(nil), d.Params.BoundEntity...),
+		Symmetric:      d.Params.Symmetric,
+		HasSessionKey:  len(d.Params.SessionKey) > 0,
+		NonceTPM:       append(Nonce(nil), d.State.NonceTPM...),
+		NonceCaller:    r.NonceCaller(),
+		IsAudit:        d.State.IsAudit,
+		IsExclusive:    d.State.IsExclusive,
+		NeedsPassword:  d.State.NeedsPassword,
+		NeedsAuthValue: d.State.NeedsAuthValue,
+	}
+
+	switch {
+	case d.Initial != nil:
+		state.Type = d.Initial.sessionType
+		state.IsSalted = d.Initial.isSalted
+		state.InitialNonceTPM = append(Nonce(nil), d.Initial.nonceTPM...)
+		state.InitialNonceCaller = append(Nonce(nil), d.Initial.nonceCaller...)
+	case r.Handle().Type() == HandleTypePolicySession:
+		// This could also be a trial session.
+		state.Type = SessionTypePolicy
+	case r.Handle().Type() == HandleTypeHMACSession:
+		state.Type = SessionTypeHMAC
+	default:
+		return nil, errors.New("not a HMAC or policy session")
+	}
+
+	return state, nil
+}
+
 func (r *sessionContext) IsAudit() bool {
 	state := r.State()
 	if state == nil {
@@ -724,6 +868,45 @@ func (t *TPMContext) CreateResourceContextFromTPM(handle Handle, sessions ...Ses
 	return t.NewResourceContext(handle, sessions...)
 }
 
+// ResourceContexts creates and returns a new ResourceContext for every resource on the TPM with
+// the type indicated by the most-significant byte of the handleType parameter, which must
+// correspond to NV indices, transient objects or persistent objects. The handles are obtained
+// using [TPMContext.GetCapabilityHandles], which will re-execute the TPM2_GetCapability command
+// until all of the handles have been returned, and each context is created using
+// [TPMContext.NewResourceContext].
+//
+// Resources that become unavailable between retrieving the list of handles and creating the
+// corresponding context are skipped. Any other error is returned.
+//
+// If any sessions are supplied, they are used for every command executed by this function, and
+// should have the [AttrContinueSession] attribute defined.
+func (t *TPMContext) ResourceContexts(handleType Handle, sessions ...SessionContext) ([]ResourceContext, error) {
+	switch handleType.Type() {
+	case HandleTypeNVIndex, HandleTypeTransient, HandleTypePersistent:
+	default:
+		return nil, errors.New("invalid handle type")
+	}
+
+	handles, err := t.GetCapabilityHandles(handleType.Type().BaseHandle(), CapabilityMaxProperties, sessions...)
+	if err != nil {
+		return nil, err
+	}
+
+	var rcs []ResourceContext
+	for _, handle := range handles {
+		rc, err := t.NewResourceContext(handle, sessions...)
+		switch {
+		case IsResourceUnavailableError(err, handle):
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("cannot create context for handle %v: %w", handle, err)
+		}
+		rcs = append(rcs, rc)
+	}
+
+	return rcs, nil
+}
+
 // NewHandleContext creates a new HandleContext for the specified handle. The returned
 // HandleContext cannot be type asserted to [ResourceContext] or [SessionContext] and can
 // only be used in commands that don't use sessions, such as [TPMContext.FlushContext],
@@ -788,6 +971,32 @@ func (t *TPMContext) GetPermanentContext(handle Handle) ResourceContext {
 	}
 }
 
+// RefreshPermanentContext clears the cached authorization value of the ResourceContext for the
+// specified permanent handle or PCR handle, so that it can be set again by calling
+// [ResourceContext].SetAuthValue. The ResourceContext is shared by every caller of
+// [TPMContext.GetPermanentContext] for the same handle, so this affects all previously returned
+// instances.
+//
+// This function will panic if handle does not correspond to a permanent or PCR handle.
+//
+// The authorization value of a hierarchy is updated automatically when it is changed with
+// [TPMContext.HierarchyChangeAuth] or [TPMContext.Clear] via this TPMContext. If it is changed
+// outside of this TPMContext (eg, by another process), the cached value will be stale and this
+// function should be called before setting the new value. HMAC sessions that were bound to the
+// hierarchy with the old authorization value can continue to be used after the new value is set,
+// as the value will no longer match the session's bound entity and will be included in the HMAC
+// key when the session is used to authorize the hierarchy.
+func (t *TPMContext) RefreshPermanentContext(handle Handle) {
+	switch handle.Type() {
+	case HandleTypePermanent, HandleTypePCR:
+		if rc, exists := t.permanentResources[handle]; exists {
+			rc.SetAuthValue(nil)
+		}
+	default:
+		panic("invalid handle type")
+	}
+}
+
 // OwnerHandleContext returns the ResouceContext corresponding to the owner hiearchy.
 func (t *TPMContext) OwnerHandleContext() ResourceContext {
 	return t.GetPermanentContext(HandleOwner)
@@ -104,6 +104,29 @@ func (s *resourcesSuite) TestNewResourceContextErrorsForWrongType(c *C) {
 	c.Check(err, ErrorMatches, `invalid handle type`)
 }
 
+func (s *resourcesSuite) TestResourceContextsPersistent(c *C) {
+	rc1 := s.CreateStoragePrimaryKeyRSA(c)
+	rc1 = s.EvictControl(c, HandleOwner, rc1, s.NextAvailableHandle(c, 0x81000008))
+	rc2 := s.CreatePrimary(c, HandleOwner, testutil.NewRSAStorageKeyTemplate())
+	rc2 = s.EvictControl(c, HandleOwner, rc2, s.NextAvailableHandle(c, rc1.Handle()+1))
+
+	rcs, err := s.TPM.ResourceContexts(HandleTypePersistent.BaseHandle())
+	c.Assert(err, IsNil)
+
+	found := make(map[Handle]Name)
+	for _, rc := range rcs {
+		c.Check(rc.Handle().Type(), Equals, HandleTypePersistent)
+		found[rc.Handle()] = rc.Name()
+	}
+	c.Check(found[rc1.Handle()], DeepEquals, rc1.Name())
+	c.Check(found[rc2.Handle()], DeepEquals, rc2.Name())
+}
+
+func (s *resourcesSuite) TestResourceContextsErrorsForWrongType(c *C) {
+	_, err := s.TPM.ResourceContexts(HandleTypePermanent.BaseHandle())
+	c.Check(err, ErrorMatches, `invalid handle type`)
+}
+
 func (s *resourcesSuite) testNewHandleContext(c *C, handle Handle) {
 	hc := NewHandleContext(handle)
 	c.Assert(hc, NotNil)
@@ -391,3 +414,40 @@ func (s *resourcesSuite) TestResourceContextGetAuthWithTrailingZeroes(c *C) {
 	rc.SetAuthValue([]byte("foo\x00bar\x00\x00"))
 	c.Check(rc.AuthValue(), DeepEquals, []byte("foo\x00bar"))
 }
+
+func (s *resourcesSuite) TestRefreshPermanentContext(c *C) {
+	s.HierarchyChangeAuth(c, HandleOwner, []byte("1234"))
+	owner := s.TPM.OwnerHandleContext()
+	c.Check(owner.AuthValue(), DeepEquals, []byte("1234"))
+
+	session := s.StartAuthSession(c, nil, owner, SessionTypeHMAC, nil, HashAlgorithmSHA256)
+
+	// Change the owner auth value outside of s.TPM.
+	external := NewTPMContext(s.TCTI)
+	external.OwnerHandleContext().SetAuthValue([]byte("1234"))
+	c.Assert(external.HierarchyChangeAuth(external.OwnerHandleContext(), []byte("5678"), nil), IsNil)
+	c.Check(owner.AuthValue(), DeepEquals, []byte("1234"))
+
+	s.TPM.RefreshPermanentContext(HandleOwner)
+	c.Check(owner.AuthValue(), internal_testutil.LenEquals, 0)
+	c.Check(s.TPM.OwnerHandleContext().AuthValue(), internal_testutil.LenEquals, 0)
+	owner.SetAuthValue([]byte("5678"))
+
+	object, _, _, _, _, err := s.TPM.CreatePrimary(owner, nil, testutil.NewRSAStorageKeyTemplate(), nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(s.TPM.FlushContext(object), IsNil)
+
+	object, _, _, _, _, err = s.TPM.CreatePrimary(owner, nil, testutil.NewRSAStorageKeyTemplate(), nil, nil, session)
+	c.Assert(err, IsNil)
+	c.Check(s.TPM.FlushContext(object), IsNil)
+}
+
+func (s *resourcesSuite) TestRefreshPermanentContextNotCached(c *C) {
+	tpm := NewTPMContext(s.TCTI)
+	tpm.RefreshPermanentContext(HandleEndorsement)
+	c.Check(tpm.EndorsementHandleContext().AuthValue(), internal_testutil.LenEquals, 0)
+}
+
+func (s *resourcesSuite) TestRefreshPermanentContextInvalidHandle(c *C) {
+	c.Check(func() { s.TPM.RefreshPermanentContext(0x80000000) }, PanicMatches, `invalid handle type`)
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	internal_crypt "github.com/canonical/go-tpm2/internal/crypt"
+)
+
+// DefaultTPMSeededReaderReseedInterval is the default number of bytes that a reader
+// returned from [NewTPMSeededReader] generates before it is reseeded from the TPM.
+const DefaultTPMSeededReaderReseedInterval = 1 << 20
+
+type tpmSeededReader struct {
+	tpm            *TPMContext
+	reseedInterval uint64
+
+	mu        sync.Mutex
+	drbg      *internal_crypt.CTRDRBG
+	generated uint64
+}
+
+func (r *tpmSeededReader) seed() error {
+	entropy, err := r.tpm.GetRandomBytes(internal_crypt.CTRDRBGSeedLen)
+	if err != nil {
+		return fmt.Errorf("cannot obtain entropy from TPM: %w", err)
+	}
+
+	switch {
+	case r.drbg == nil:
+		r.drbg, err = internal_crypt.NewCTRDRBG(entropy)
+	default:
+		err = r.drbg.Reseed(entropy)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.generated = 0
+	return nil
+}
+
+func (r *tpmSeededReader) Read(data []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for len(data) > 0 {
+		if r.drbg == nil || r.generated >= r.reseedInterval {
+			if err := r.seed(); err != nil {
+				return n, err
+			}
+		}
+
+		sz := len(data)
+		if sz > internal_crypt.CTRDRBGMaxRequestLen {
+			sz = internal_crypt.CTRDRBGMaxRequestLen
+		}
+		if r.reseedInterval > 0 && uint64(sz) > r.reseedInterval-r.generated {
+			sz = int(r.reseedInterval - r.generated)
+		}
+
+		if err := r.drbg.Generate(data[:sz]); err != nil {
+			return n, err
+		}
+		r.generated += uint64(sz)
+		n += sz
+		data = data[sz:]
+	}
+
+	return n, nil
+}
+
+// NewTPMSeededReader returns a new reader of random bytes that are generated by a software
+// CTR_DRBG using AES-256, as described in NIST SP800-90A. The DRBG is seeded from the
+// TPM's random number generator using [TPMContext.GetRandomBytes] the first time that the
+// reader is used, and is reseeded from the TPM after every
+// [DefaultTPMSeededReaderReseedInterval] bytes.
+//
+// This is intended for applications that require a large amount of randomness, where
+// obtaining all of it directly from the TPM would be slow.
+//
+// Note that the seed is not protected by parameter encryption. The returned reader is safe
+// for concurrent use, but the TPMContext must not be used concurrently by other goroutines.
+func NewTPMSeededReader(tpm *TPMContext) io.Reader {
+	return NewTPMSeededReaderWithReseedInterval(tpm, DefaultTPMSeededReaderReseedInterval)
+}
+
+// NewTPMSeededReaderWithReseedInterval is a version of [NewTPMSeededReader] that reseeds
+// the DRBG after the specified number of bytes have been generated. A reseed interval of
+// zero causes the DRBG to be reseeded before every request for random bytes.
+func NewTPMSeededReaderWithReseedInterval(tpm *TPMContext, reseedInterval uint64) io.Reader {
+	return &tpmSeededReader{
+		tpm:            tpm,
+		reseedInterval: reseedInterval,
+	}
+}
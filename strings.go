@@ -263,6 +263,8 @@ func (c CommandCode) String() string {
 		return "TPM_CC_EventSequenceComplete"
 	case CommandHashSequenceStart:
 		return "TPM_CC_HashSequenceStart"
+	case CommandPolicyPhysicalPresence:
+		return "TPM_CC_PolicyPhysicalPresence"
 	case CommandPolicyDuplicationSelect:
 		return "TPM_CC_PolicyDuplicationSelect"
 	case CommandPolicyGetDigest:
@@ -281,6 +283,8 @@ func (c CommandCode) String() string {
 		return "TPM_CC_CreateLoaded"
 	case CommandPolicyAuthorizeNV:
 		return "TPM_CC_PolicyAuthorizeNV"
+	case CommandPolicyParameters:
+		return "TPM_CC_PolicyParameters"
 	default:
 		return fmt.Sprintf("0x%08x", uint32(c))
 	}
@@ -758,6 +762,34 @@ func (o ArithmeticOp) Format(s fmt.State, f rune) {
 	}
 }
 
+func (t NVType) String() string {
+	switch t {
+	case NVTypeOrdinary:
+		return "TPM_NT_ORDINARY"
+	case NVTypeCounter:
+		return "TPM_NT_COUNTER"
+	case NVTypeBits:
+		return "TPM_NT_BITS"
+	case NVTypeExtend:
+		return "TPM_NT_EXTEND"
+	case NVTypePinFail:
+		return "TPM_NT_PIN_FAIL"
+	case NVTypePinPass:
+		return "TPM_NT_PIN_PASS"
+	default:
+		return fmt.Sprintf("0x%x", uint32(t))
+	}
+}
+
+func (t NVType) Format(s fmt.State, f rune) {
+	switch f {
+	case 's', 'v':
+		fmt.Fprintf(s, "%s", t.String())
+	default:
+		fmt.Fprintf(s, makeDefaultFormatter(s, f), uint32(t))
+	}
+}
+
 var (
 	errorCodeDescriptions = map[ErrorCode]string{
 		ErrorInitialize:      "TPM not initialized by TPM2_Startup or already initialized",
@@ -137,7 +137,10 @@ var commandInfoMap = map[tpm2.CommandCode]commandInfo{
 	tpm2.CommandPolicyGetDigest:            commandInfo{0, 1, false, false},
 	tpm2.CommandTestParms:                  commandInfo{0, 0, false, false},
 	tpm2.CommandPolicyPassword:             commandInfo{0, 1, false, false},
+	tpm2.CommandPolicyPhysicalPresence:     commandInfo{0, 1, false, false},
 	tpm2.CommandPolicyNvWritten:            commandInfo{0, 1, false, false},
+	tpm2.CommandPolicyTemplate:             commandInfo{0, 1, false, false},
+	tpm2.CommandPolicyParameters:           commandInfo{0, 1, false, false},
 	tpm2.CommandCreateLoaded:               commandInfo{1, 1, true, false},
 }
 
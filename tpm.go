@@ -6,9 +6,11 @@ package tpm2
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"time"
 
 	"github.com/canonical/go-tpm2/mu"
@@ -23,12 +25,17 @@ type execMultipleHelperAction interface {
 	run(sessions ...SessionContext) error
 }
 
-func execMultipleHelper(action execMultipleHelperAction, sessions ...SessionContext) error {
-	// Ensure all sessions have the AttrContinueSession attribute
+// execMultipleHelper runs the supplied action until it indicates that it has completed. By
+// default, the AttrContinueSession attribute is added to all sessions for every iteration
+// except the last one. If noAutoContinue is true, the supplied sessions are used as-is for
+// every iteration, and an error is returned if more than one iteration is required and any
+// session doesn't have the AttrContinueSession attribute.
+func execMultipleHelper(action execMultipleHelperAction, noAutoContinue bool, sessions ...SessionContext) error {
 	sessionsOrig := make([]SessionContext, len(sessions))
 	copy(sessionsOrig, sessions)
 
 	hasPolicySession := false
+	noContinueIndex := -1
 
 	for i := range sessions {
 		if sessions[i] == nil {
@@ -39,6 +46,14 @@ func execMultipleHelper(action execMultipleHelperAction, sessions ...SessionCont
 			hasPolicySession = true
 		}
 
+		if noAutoContinue {
+			if sessions[i].Attrs()&AttrContinueSession == 0 && noContinueIndex < 0 {
+				noContinueIndex = i
+			}
+			continue
+		}
+
+		// Ensure all sessions have the AttrContinueSession attribute
 		sessions[i] = sessions[i].IncludeAttrs(AttrContinueSession)
 	}
 
@@ -46,6 +61,10 @@ func execMultipleHelper(action execMultipleHelperAction, sessions ...SessionCont
 		if hasPolicySession {
 			return errors.New("cannot use a policy session for authorization")
 		}
+		if noContinueIndex >= 0 {
+			return fmt.Errorf("session at index %d does not have the AttrContinueSession attribute, "+
+				"which is required because the operation requires more than one command", noContinueIndex)
+		}
 
 		if err := action.run(sessions...); err != nil {
 			return err
@@ -73,6 +92,49 @@ func isSessionAllowed(commandCode CommandCode) bool {
 	}
 }
 
+// nvUserRolePolicyAttr returns the attribute that a NV index must have in order for it to be
+// authorized with a policy session, if the handle at the specified index for the specified
+// command requires authorization with the user role, and the authorization handle may be the
+// NV index itself. The name of the attribute is also returned.
+func nvUserRolePolicyAttr(commandCode CommandCode, index int) (attr NVAttributes, attrName string, ok bool) {
+	switch {
+	case commandCode == CommandNVWrite && index == 0,
+		commandCode == CommandNVIncrement && index == 0,
+		commandCode == CommandNVExtend && index == 0,
+		commandCode == CommandNVSetBits && index == 0,
+		commandCode == CommandNVWriteLock && index == 0:
+		return AttrNVPolicyWrite, "TPMA_NV_POLICY_WRITE", true
+	case commandCode == CommandNVRead && index == 0,
+		commandCode == CommandNVReadLock && index == 0,
+		commandCode == CommandPolicyNV && index == 0,
+		commandCode == CommandNVCertify && index == 1:
+		return AttrNVPolicyRead, "TPMA_NV_POLICYREAD", true
+	default:
+		return 0, "", false
+	}
+}
+
+// checkPolicySessionForResource checks whether a policy session can be used to authorize
+// the supplied resource at the specified handle index in the specified command. This
+// can only detect cases where the answer doesn't depend on state that is private to the
+// TPM, such as the auth policy of a hierarchy or PCR.
+func checkPolicySessionForResource(commandCode CommandCode, index int, resource HandleContext) error {
+	attr, attrName, ok := nvUserRolePolicyAttr(commandCode, index)
+	if !ok {
+		return nil
+	}
+
+	nv, ok := resource.(*nvIndexContext)
+	if !ok || nv.Data.NV == nil {
+		return nil
+	}
+	if nv.Data.NV.Attrs&attr != 0 {
+		return nil
+	}
+
+	return fmt.Errorf("cannot use a policy session to authorize NV index %v with the user role for command %s: the index does not have the %s attribute", nv.Handle(), commandCode, attrName)
+}
+
 type execContextDispatcher interface {
 	RunCommand(commandCode CommandCode, cHandles HandleList, cAuthArea []AuthCommand, cpBytes []byte, rHandle *Handle) (rpBytes []byte, rAuthArea []AuthResponse, err error)
 }
@@ -97,6 +159,10 @@ type execContext struct {
 	dispatcher           execContextDispatcher
 	lastExclusiveSession SessionContext
 	pendingResponse      *rspContext
+	rand                 io.Reader
+
+	checkPolicySessions bool
+	noAutoContinue      bool
 }
 
 func (e *execContext) processResponseAuth(r *rspContext) (err error) {
@@ -151,11 +217,18 @@ func (e *execContext) RunCommand(c *cmdContext, responseHandle *Handle) (*rspCon
 	var handles HandleList
 	var handleNames []Name
 	sessionParams := newSessionParams()
+	sessionParams.Rand = e.rand
 
-	for _, h := range c.Handles {
+	for i, h := range c.Handles {
 		handles = append(handles, h.handle.Handle())
 		handleNames = append(handleNames, h.handle.Name())
 
+		if e.checkPolicySessions && h.session != nil && h.session.Handle().Type() == HandleTypePolicySession {
+			if err := checkPolicySessionForResource(c.CommandCode, i, h.handle); err != nil {
+				return nil, err
+			}
+		}
+
 		if h.session != nil {
 			if err := sessionParams.AppendSessionForResource(h.session, h.handle.(ResourceContext)); err != nil {
 				return nil, fmt.Errorf("cannot process HandleContext for command %s at index %d: %v", c.CommandCode, len(handles), err)
@@ -202,6 +275,33 @@ type tpmDeviceProperties struct {
 	maxBufferSize    uint16
 	minPcrSelectSize uint8
 	maxNVBufferSize  uint16
+	manufacturer     uint32
+
+	defaulted []DefaultedProperty
+}
+
+const (
+	// defaultMaxBufferSize is the value of TPM_PT_INPUT_BUFFER to use if the TPM
+	// doesn't report it. This is the minimum size of MAX_DIGEST_BUFFER permitted by
+	// the PC Client Platform TPM Profile.
+	defaultMaxBufferSize = 1024
+
+	// defaultMaxNVBufferSize is the value of TPM_PT_NV_BUFFER_MAX to use if the TPM
+	// doesn't report it. This is deliberately conservative - it only affects how NV
+	// reads and writes are split across multiple commands.
+	defaultMaxNVBufferSize = 512
+
+	// defaultPCRSelectSize is the value of TPM_PT_PCR_SELECT_MIN to use if the TPM
+	// doesn't report it or TPM_PT_PCR_COUNT. This corresponds to the 24 PCRs required
+	// by the PC Client Platform TPM Profile.
+	defaultPCRSelectSize = 3
+)
+
+// DefaultedProperty describes a property used internally by [TPMContext] that the TPM
+// did not report, and the default value that is used in its place.
+type DefaultedProperty struct {
+	Property Property
+	Value    uint32
 }
 
 // TODO: Implement commands from the following sections of part 3 of the TPM library spec:
@@ -273,7 +373,10 @@ type TPMContext struct {
 	transport          Transport
 	permanentResources map[Handle]*permanentContext
 	properties         *tpmDeviceProperties
+	allocatedPCRs      PCRSelectionList
 	execContext        execContext
+	nvPublicCache      map[Handle]*nvPublicCacheEntry
+	cacheNVPublic      bool
 }
 
 // Close calls Close on the transmission interface.
@@ -289,8 +392,13 @@ func (t *TPMContext) Close() error {
 // supplying a properly serialized command packet, which can be created with
 // [MarshalCommandPacket].
 //
-// If successful, this function will return the response packet. No checking is performed on this
-// response packet. An error will only be returned if the transmission interface returns an error.
+// If successful, this function will return the response packet. The response is read from the
+// transmission interface until the number of bytes indicated by the responseSize field of the
+// response header have been received, so a response that is delivered over several reads will
+// be returned as a single packet. If the responseSize field is smaller than the size of the
+// response header, only the header is returned. No other checking is performed on this
+// response packet. An error will only be returned if the transmission interface returns an
+// error, or if it returns fewer bytes than indicated by the response header.
 //
 // Most users will want to use one of the many convenience functions provided by TPMContext
 // instead, or [TPMContext.StartCommand] if one doesn't already exist.
@@ -299,12 +407,29 @@ func (t *TPMContext) RunCommandBytes(packet CommandPacket) (ResponsePacket, erro
 		return nil, &TransportError{"write", err}
 	}
 
-	resp, err := io.ReadAll(t.transport)
-	if err != nil {
+	resp := make([]byte, binary.Size(ResponseHeader{}))
+	if _, err := io.ReadFull(t.transport, resp); err != nil {
 		return nil, &TransportError{"read", err}
 	}
 
-	return ResponsePacket(resp), nil
+	var hdr ResponseHeader
+	if _, err := mu.UnmarshalFromBytes(resp, &hdr); err != nil {
+		return nil, &TransportError{"read", err}
+	}
+
+	// Copy the rest of the response rather than allocating it based on the header, so that a
+	// bogus responseSize doesn't result in a large allocation.
+	buf := bytes.NewBuffer(resp)
+	if hdr.ResponseSize > uint32(len(resp)) {
+		if _, err := io.CopyN(buf, t.transport, int64(hdr.ResponseSize)-int64(len(resp))); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, &TransportError{"read", err}
+		}
+	}
+
+	return ResponsePacket(buf.Bytes()), nil
 }
 
 // RunCommand is a low-level interface for executing a command. The caller supplies the command
@@ -341,15 +466,34 @@ func (t *TPMContext) RunCommand(commandCode CommandCode, cHandles HandleList, cA
 	}
 
 	if err := DecodeResponseCode(commandCode, rc); err != nil {
-		if _, isInvalidRc := err.(InvalidResponseCodeError); isInvalidRc {
+		switch e := err.(type) {
+		case InvalidResponseCodeError:
 			return nil, nil, &InvalidResponseError{commandCode, err}
+		case *TPMVendorError:
+			e.Manufacturer = t.vendorErrorManufacturer()
 		}
 		return nil, nil, err
 	}
 
+	switch commandCode {
+	case CommandPCRAllocate, CommandStartup:
+		// These may change the PCR allocation.
+		t.allocatedPCRs = nil
+	}
+
 	return rpBytes, rAuthArea, nil
 }
 
+// vendorErrorManufacturer returns the value of the TPM_PT_MANUFACTURER property for
+// decoding vendor errors. This doesn't execute any commands, and it returns zero if the
+// properties haven't been initialized by [TPMContext.InitProperties].
+func (t *TPMContext) vendorErrorManufacturer() uint32 {
+	if t.properties == nil {
+		return 0
+	}
+	return t.properties.manufacturer
+}
+
 // StartCommand is the high-level function for beginning the process of executing a command. It
 // returns a CommandContext that can be used to assemble a command, properly serialize a command
 // packet and then submit the packet for execution via [TPMContext.RunCommand].
@@ -387,6 +531,60 @@ func (t *TPMContext) SetCommandTimeout(timeout time.Duration) error {
 	return ErrTimeoutNotSupported
 }
 
+// SetRandReader sets the source of randomness used by this context for generating caller
+// nonces for sessions, and for generating and encrypting salts when starting salted sessions.
+// The default is crypto/rand.Reader, which can be restored by supplying nil. This should
+// only be changed from the default for testing, as deterministic caller nonces and salts
+// undermine the security of sessions.
+func (t *TPMContext) SetRandReader(rand io.Reader) {
+	t.execContext.rand = rand
+}
+
+// SetCheckPolicySessions enables or disables additional checks on the use of policy sessions
+// for authorization, which are disabled by default. When enabled, commands will fail with an
+// error before being submitted to the TPM if a policy session is supplied to authorize a
+// resource with a role where this isn't permitted.
+//
+// The checks are only able to detect cases that don't depend on state that is private to the
+// TPM. Currently, this is limited to NV indices that require authorization with the user role,
+// where a policy session is only permitted if the index has the [AttrNVPolicyRead] attribute
+// (for commands that read from the index) or the [AttrNVPolicyWrite] attribute (for commands
+// that write to the index). It doesn't detect cases where permanent resources or PCRs are
+// authorized with a policy session without an auth policy being set.
+func (t *TPMContext) SetCheckPolicySessions(enable bool) {
+	t.execContext.checkPolicySessions = enable
+}
+
+// SetCacheNVPublic enables or disables caching of the results of [TPMContext.NVReadPublic], which
+// is disabled by default. Disabling it discards any cached results.
+//
+// The cache is only invalidated by functions on this TPMContext that modify or remove NV indices,
+// so it must not be enabled if other users of the TPM might modify or undefine indices whilst
+// this context is in use. It also shouldn't be enabled where NVReadPublic is used to check that an
+// index still exists or to revalidate a name that was obtained previously, because the cached
+// result would be returned without querying the TPM.
+func (t *TPMContext) SetCacheNVPublic(enable bool) {
+	t.cacheNVPublic = enable
+	if !enable {
+		t.invalidateAllNVPublic()
+	}
+}
+
+// SetAutoContinueSessions enables or disables the automatic addition of the
+// [AttrContinueSession] attribute to sessions supplied to functions that may need to execute
+// more than one command to complete an operation, such as [TPMContext.NVRead],
+// [TPMContext.NVWrite] and [TPMContext.SequenceExecute]. This is enabled by default, and
+// ensures that sessions aren't flushed before the last command is executed, with the final
+// command being executed with the sessions' original attributes.
+//
+// When disabled, the supplied sessions are used with their exact attributes for every command.
+// If an operation requires more than one command and any of the supplied sessions doesn't have
+// the AttrContinueSession attribute set, an error will be returned before any command is
+// executed rather than the session being flushed part way through the operation.
+func (t *TPMContext) SetAutoContinueSessions(enable bool) {
+	t.execContext.noAutoContinue = !enable
+}
+
 // Transport returns the underlying transmission channel for this context.
 func (t *TPMContext) Transport() Transport {
 	return t.transport
@@ -397,28 +595,113 @@ func (t *TPMContext) Transport() Transport {
 // properties when they are used for the first time, but this function is provided so that the
 // command can be audited, and so the exclusivity of an audit session can be preserved.
 //
+// Some TPM implementations don't report all of the required properties. In this case, the
+// following conservative defaults are used in place of the missing properties, and the
+// properties that have been defaulted can be obtained using [TPMContext.DefaultedProperties]:
+//   - TPM_PT_INPUT_BUFFER defaults to 1024 bytes, which is the minimum permitted by the PC
+//     Client Platform TPM Profile.
+//   - TPM_PT_NV_BUFFER_MAX defaults to 512 bytes.
+//   - TPM_PT_PCR_SELECT_MIN defaults to the size required to select all of the PCRs indicated
+//     by TPM_PT_PCR_COUNT, or 3 bytes (24 PCRs) if that is also missing.
+//
+// An error is still returned if the TPM2_GetCapability commands fail, or if the TPM reports a
+// property with a value that is out of range.
+//
+// The TPM_PT_MANUFACTURER property is also obtained so that descriptions registered with
+// [RegisterVendorError] can be included in vendor errors returned from commands executed
+// after this. It is zero if the TPM doesn't report it.
+//
 // Any sessions supplied should have the [AttrContinueSession] attribute set.
 func (t *TPMContext) InitProperties(sessions ...SessionContext) error {
-	var err error
 	var properties tpmDeviceProperties
 
-	properties.maxBufferSize, err = t.GetMaxBufferSize(sessions...)
+	maxBufferSize, err := t.initProperty(&properties, PropertyInputBuffer, math.MaxUint16, func() (uint32, error) {
+		return defaultMaxBufferSize, nil
+	}, sessions...)
 	if err != nil {
 		return fmt.Errorf("cannot obtain TPM_PT_BUFFER_MAX property: %w", err)
 	}
-	properties.maxNVBufferSize, err = t.GetNVMaxBufferSize(sessions...)
+	properties.maxBufferSize = uint16(maxBufferSize)
+
+	maxNVBufferSize, err := t.initProperty(&properties, PropertyNVBufferMax, math.MaxUint16, func() (uint32, error) {
+		return defaultMaxNVBufferSize, nil
+	}, sessions...)
 	if err != nil {
 		return fmt.Errorf("cannot obtain TPM_PT_NV_BUFFER_MAX property: %w", err)
 	}
-	properties.minPcrSelectSize, err = t.GetMinPCRSelectSize(sessions...)
+	properties.maxNVBufferSize = uint16(maxNVBufferSize)
+
+	minPcrSelectSize, err := t.initProperty(&properties, PropertyPCRSelectMin, math.MaxUint8, func() (uint32, error) {
+		count, exists, err := t.getTPMProperty(PropertyPCRCount, sessions...)
+		switch {
+		case err != nil:
+			return 0, err
+		case !exists || count == 0 || count > math.MaxUint8*8:
+			return defaultPCRSelectSize, nil
+		default:
+			return (count + 7) / 8, nil
+		}
+	}, sessions...)
 	if err != nil {
 		return fmt.Errorf("cannot obtain TPM_PT_PCR_SELECT_MIN property: %w", err)
 	}
+	properties.minPcrSelectSize = uint8(minPcrSelectSize)
+
+	manufacturer, _, err := t.getTPMProperty(PropertyManufacturer, sessions...)
+	if err != nil {
+		return fmt.Errorf("cannot obtain TPM_PT_MANUFACTURER property: %w", err)
+	}
+	properties.manufacturer = manufacturer
 
 	t.properties = &properties
 	return nil
 }
 
+// getTPMProperty returns the value of the specified property, and whether it exists.
+func (t *TPMContext) getTPMProperty(property Property, sessions ...SessionContext) (value uint32, exists bool, err error) {
+	props, err := t.GetCapabilityTPMProperties(property, 1, sessions...)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(props) == 0 || props[0].Property != property {
+		return 0, false, nil
+	}
+	return props[0].Value, true, nil
+}
+
+// initProperty returns the value of the specified property. If the TPM doesn't report it,
+// the value returned from the supplied function is used instead, and the property is
+// recorded as being defaulted.
+func (t *TPMContext) initProperty(properties *tpmDeviceProperties, property Property, max uint32, defaultValue func() (uint32, error), sessions ...SessionContext) (uint32, error) {
+	value, exists, err := t.getTPMProperty(property, sessions...)
+	switch {
+	case err != nil:
+		return 0, err
+	case exists && value > max:
+		return 0, &InvalidResponseError{CommandGetCapability, errors.New("value out of range")}
+	case exists:
+		return value, nil
+	}
+
+	value, err = defaultValue()
+	if err != nil {
+		return 0, err
+	}
+	properties.defaulted = append(properties.defaulted, DefaultedProperty{Property: property, Value: value})
+	return value, nil
+}
+
+// DefaultedProperties returns the properties used internally by this context that the TPM
+// did not report when they were initialized by [TPMContext.InitProperties], along with the
+// default values that are being used instead. This returns nil if the properties haven't
+// been initialized yet, or if the TPM reported all of them.
+func (t *TPMContext) DefaultedProperties() []DefaultedProperty {
+	if t.properties == nil {
+		return nil
+	}
+	return t.properties.defaulted
+}
+
 func (t *TPMContext) initPropertiesIfNeeded() error {
 	if t.properties != nil {
 		return nil
@@ -0,0 +1,485 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// mockPropertiesTransport is a transport that implements TPM2_GetCapability for
+// TPM properties using the supplied properties, and TPM2_PCR_Read.
+type mockPropertiesTransport struct {
+	properties map[Property]uint32
+	failCap    bool
+	rc         ResponseCode // the response code for other commands
+
+	pcrsPerRead       int      // the maximum number of PCRs returned by each TPM2_PCR_Read, if not zero
+	pcrUpdateCounters []uint32 // the pcrUpdateCounter returned by each TPM2_PCR_Read, the last one repeating
+	pcrReads          int      // the number of TPM2_PCR_Read commands executed
+
+	cmd []byte
+	rsp io.Reader
+}
+
+func (t *mockPropertiesTransport) Read(data []byte) (int, error) {
+	for {
+		n, err := t.rsp.Read(data)
+		if err == io.EOF {
+			t.rsp = nil
+			err = nil
+			if n == 0 {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+func (t *mockPropertiesTransport) makeResponse(rc ResponseCode, params ...interface{}) {
+	rpBytes := mu.MustMarshalToBytes(params...)
+	buf := new(bytes.Buffer)
+	mu.MustMarshalToWriter(buf, ResponseHeader{
+		Tag:          TagNoSessions,
+		ResponseSize: uint32(binary.Size(ResponseHeader{}) + len(rpBytes)),
+		ResponseCode: rc}, mu.RawBytes(rpBytes))
+	t.rsp = buf
+}
+
+func (t *mockPropertiesTransport) Write(data []byte) (int, error) {
+	t.cmd = append(t.cmd, data...)
+
+	var hdr CommandHeader
+	n, err := mu.UnmarshalFromBytes(t.cmd, &hdr)
+	if err != nil || len(t.cmd) < int(hdr.CommandSize) {
+		// Wait for the rest of the command
+		return len(data), nil
+	}
+	cpBytes := t.cmd[n:hdr.CommandSize]
+	t.cmd = nil
+
+	switch hdr.CommandCode {
+	case CommandGetCapability:
+		if t.failCap {
+			t.makeResponse(0x101) // TPM_RC_FAILURE
+			break
+		}
+
+		var capability Capability
+		var first, count uint32
+		if _, err := mu.UnmarshalFromBytes(cpBytes, &capability, &first, &count); err != nil {
+			return 0, err
+		}
+		if capability != CapabilityTPMProperties {
+			t.makeResponse(0x101) // TPM_RC_FAILURE
+			break
+		}
+
+		var props TaggedTPMPropertyList
+		for p, v := range t.properties {
+			if p >= Property(first) {
+				props = append(props, TaggedProperty{Property: p, Value: v})
+			}
+		}
+		sort.Slice(props, func(i, j int) bool { return props[i].Property < props[j].Property })
+		if len(props) > int(count) {
+			props = props[:count]
+		}
+		t.makeResponse(ResponseSuccess, false, &CapabilityData{
+			Capability: CapabilityTPMProperties,
+			Data:       &CapabilitiesU{TPMProperties: props}})
+	case CommandPCRRead:
+		var pcrs PCRSelectionList
+		if _, err := mu.UnmarshalFromBytes(cpBytes, &pcrs); err != nil {
+			return 0, err
+		}
+		var pcrsOut PCRSelectionList
+		var digests DigestList
+		for _, s := range pcrs {
+			selection := PCRSelection{Hash: s.Hash, SizeOfSelect: s.SizeOfSelect}
+			for _, pcr := range s.Select {
+				if t.pcrsPerRead > 0 && len(digests) >= t.pcrsPerRead {
+					break
+				}
+				selection.Select = append(selection.Select, pcr)
+				digests = append(digests, make(Digest, s.Hash.Size()))
+			}
+			pcrsOut = append(pcrsOut, selection)
+		}
+
+		counter := uint32(1)
+		if len(t.pcrUpdateCounters) > 0 {
+			i := t.pcrReads
+			if i >= len(t.pcrUpdateCounters) {
+				i = len(t.pcrUpdateCounters) - 1
+			}
+			counter = t.pcrUpdateCounters[i]
+		}
+		t.pcrReads++
+
+		t.makeResponse(ResponseSuccess, counter, pcrsOut, digests)
+	default:
+		rc := t.rc
+		if rc == ResponseSuccess {
+			rc = 0x143 // TPM_RC_COMMAND_CODE
+		}
+		t.makeResponse(rc)
+	}
+
+	return len(data), nil
+}
+
+func (t *mockPropertiesTransport) Close() error {
+	return nil
+}
+
+type tpmPropertiesSuite struct{}
+
+var _ = Suite(&tpmPropertiesSuite{})
+
+func (s *tpmPropertiesSuite) TestInitPropertiesAll(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{properties: map[Property]uint32{
+		PropertyInputBuffer:  1024,
+		PropertyPCRCount:     24,
+		PropertyPCRSelectMin: 3,
+		PropertyNVBufferMax:  2048}})
+	c.Check(tpm.InitProperties(), IsNil)
+	c.Check(tpm.DefaultedProperties(), IsNil)
+}
+
+func (s *tpmPropertiesSuite) TestInitPropertiesMissingNVBufferMax(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{properties: map[Property]uint32{
+		PropertyInputBuffer:  1024,
+		PropertyPCRCount:     24,
+		PropertyPCRSelectMin: 3}})
+	c.Check(tpm.InitProperties(), IsNil)
+	c.Check(tpm.DefaultedProperties(), DeepEquals, []DefaultedProperty{{Property: PropertyNVBufferMax, Value: 512}})
+
+	// Check that the context is still usable for commands that don't use NV.
+	updateCounter, values, err := tpm.PCRRead(PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{7}}})
+	c.Check(err, IsNil)
+	c.Check(updateCounter, Equals, uint32(1))
+	c.Check(values, DeepEquals, PCRValues{HashAlgorithmSHA256: {7: make(Digest, 32)}})
+}
+
+func (s *tpmPropertiesSuite) TestInitPropertiesMissingAll(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{})
+	c.Check(tpm.InitProperties(), IsNil)
+	c.Check(tpm.DefaultedProperties(), DeepEquals, []DefaultedProperty{
+		{Property: PropertyInputBuffer, Value: 1024},
+		{Property: PropertyNVBufferMax, Value: 512},
+		{Property: PropertyPCRSelectMin, Value: 3}})
+}
+
+func (s *tpmPropertiesSuite) TestInitPropertiesPCRSelectMinFromPCRCount(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{properties: map[Property]uint32{
+		PropertyInputBuffer: 1024,
+		PropertyPCRCount:    16,
+		PropertyNVBufferMax: 2048}})
+	c.Check(tpm.InitProperties(), IsNil)
+	c.Check(tpm.DefaultedProperties(), DeepEquals, []DefaultedProperty{{Property: PropertyPCRSelectMin, Value: 2}})
+}
+
+func (s *tpmPropertiesSuite) TestInitPropertiesOutOfRange(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{properties: map[Property]uint32{
+		PropertyInputBuffer: 0x10000}})
+	c.Check(tpm.InitProperties(), ErrorMatches, `cannot obtain TPM_PT_BUFFER_MAX property: TPM returned an invalid response for command TPM_CC_GetCapability: value out of range`)
+}
+
+func (s *tpmPropertiesSuite) TestInitPropertiesGetCapabilityFails(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{failCap: true})
+	err := tpm.InitProperties()
+	c.Check(err, ErrorMatches, `cannot obtain TPM_PT_BUFFER_MAX property: TPM returned an error whilst executing command TPM_CC_GetCapability: TPM_RC_FAILURE \(commands not being accepted because of a TPM failure\)`)
+	c.Check(tpm.DefaultedProperties(), IsNil)
+}
+
+type tpmCheckPolicySessionsSuite struct{}
+
+var _ = Suite(&tpmCheckPolicySessionsSuite{})
+
+func (s *tpmCheckPolicySessionsSuite) newNVIndex(c *C, attrs NVAttributes) ResourceContext {
+	index, err := NewNVIndexResourceContextFromPub(&NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(attrs | AttrNVAuthRead | AttrNVAuthWrite | AttrNVWritten),
+		Size:    8})
+	c.Assert(err, IsNil)
+	return index
+}
+
+func (s *tpmCheckPolicySessionsSuite) newSession(handle Handle) SessionContext {
+	return &mockSessionContext{
+		handle: handle,
+		data:   SessionContextData{Params: SessionContextParams{HashAlg: HashAlgorithmSHA256}}}
+}
+
+func (s *tpmCheckPolicySessionsSuite) TestNVReadPolicyNotPermitted(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{})
+	tpm.SetCheckPolicySessions(true)
+
+	index := s.newNVIndex(c, AttrNVPolicyWrite)
+	_, err := tpm.NVRead(index, index, 8, 0, s.newSession(0x03000000))
+	c.Check(err, ErrorMatches, `cannot use a policy session to authorize NV index 0x01800000 with the user role for command TPM_CC_NV_Read: the index does not have the TPMA_NV_POLICYREAD attribute`)
+}
+
+func (s *tpmCheckPolicySessionsSuite) TestNVWritePolicyNotPermitted(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{})
+	tpm.SetCheckPolicySessions(true)
+
+	index := s.newNVIndex(c, AttrNVPolicyRead)
+	err := tpm.NVWrite(index, index, []byte("foo"), 0, s.newSession(0x03000000))
+	c.Check(err, ErrorMatches, `cannot use a policy session to authorize NV index 0x01800000 with the user role for command TPM_CC_NV_Write: the index does not have the TPMA_NV_POLICY_WRITE attribute`)
+}
+
+func (s *tpmCheckPolicySessionsSuite) TestNVReadPolicyPermitted(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{})
+	tpm.SetCheckPolicySessions(true)
+
+	// The check passes, so the command is submitted to the TPM.
+	index := s.newNVIndex(c, AttrNVPolicyRead)
+	_, err := tpm.NVRead(index, index, 8, 0, s.newSession(0x03000000))
+	c.Check(IsTPMError(err, ErrorCommandCode, CommandNVRead), internal_testutil.IsTrue)
+}
+
+func (s *tpmCheckPolicySessionsSuite) TestNVReadHMACSession(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{})
+	tpm.SetCheckPolicySessions(true)
+
+	index := s.newNVIndex(c, 0)
+	_, err := tpm.NVRead(index, index, 8, 0, s.newSession(0x02000000))
+	c.Check(IsTPMError(err, ErrorCommandCode, CommandNVRead), internal_testutil.IsTrue)
+}
+
+func (s *tpmCheckPolicySessionsSuite) TestNVReadPolicyNotCheckedByDefault(c *C) {
+	tpm := NewTPMContext(&mockPropertiesTransport{})
+
+	index := s.newNVIndex(c, 0)
+	_, err := tpm.NVRead(index, index, 8, 0, s.newSession(0x03000000))
+	c.Check(IsTPMError(err, ErrorCommandCode, CommandNVRead), internal_testutil.IsTrue)
+}
+
+type tpmAutoContinueSessionsSuite struct{}
+
+var _ = Suite(&tpmAutoContinueSessionsSuite{})
+
+func (s *tpmAutoContinueSessionsSuite) newTPM(c *C) *TPMContext {
+	tpm := NewTPMContext(&mockPropertiesTransport{properties: map[Property]uint32{
+		PropertyInputBuffer:  1024,
+		PropertyPCRCount:     24,
+		PropertyPCRSelectMin: 3,
+		PropertyNVBufferMax:  16}})
+	c.Assert(tpm.InitProperties(), IsNil)
+	return tpm
+}
+
+func (s *tpmAutoContinueSessionsSuite) newIndex(c *C) ResourceContext {
+	index, err := NewNVIndexResourceContextFromPub(&NVPublic{
+		Index:   0x01800000,
+		NameAlg: HashAlgorithmSHA256,
+		Attrs:   NVTypeOrdinary.WithAttrs(AttrNVAuthRead | AttrNVAuthWrite | AttrNVWritten),
+		Size:    64})
+	c.Assert(err, IsNil)
+	return index
+}
+
+func (s *tpmAutoContinueSessionsSuite) newSession(attrs SessionAttributes) SessionContext {
+	return &mockSessionContext{
+		handle: 0x02000000,
+		data:   SessionContextData{Params: SessionContextParams{HashAlg: HashAlgorithmSHA256}},
+		attrs:  attrs}
+}
+
+func (s *tpmAutoContinueSessionsSuite) TestDefault(c *C) {
+	tpm := s.newTPM(c)
+	index := s.newIndex(c)
+
+	// The command is submitted to the TPM.
+	_, err := tpm.NVRead(index, index, 64, 0, s.newSession(0))
+	c.Check(IsTPMError(err, ErrorCommandCode, CommandNVRead), internal_testutil.IsTrue)
+}
+
+func (s *tpmAutoContinueSessionsSuite) TestDisabledNoContinueSession(c *C) {
+	tpm := s.newTPM(c)
+	tpm.SetAutoContinueSessions(false)
+	index := s.newIndex(c)
+
+	_, err := tpm.NVRead(index, index, 64, 0, s.newSession(0))
+	c.Check(err, ErrorMatches, `session at index 0 does not have the AttrContinueSession attribute, which is required because the operation requires more than one command`)
+
+	err = tpm.NVWrite(index, index, make([]byte, 64), 0, nil, s.newSession(AttrContinueSession), s.newSession(AttrAudit))
+	c.Check(err, ErrorMatches, `session at index 2 does not have the AttrContinueSession attribute, which is required because the operation requires more than one command`)
+}
+
+func (s *tpmAutoContinueSessionsSuite) TestDisabledContinueSession(c *C) {
+	tpm := s.newTPM(c)
+	tpm.SetAutoContinueSessions(false)
+	index := s.newIndex(c)
+
+	_, err := tpm.NVRead(index, index, 64, 0, s.newSession(AttrContinueSession))
+	c.Check(IsTPMError(err, ErrorCommandCode, CommandNVRead), internal_testutil.IsTrue)
+}
+
+func (s *tpmAutoContinueSessionsSuite) TestDisabledSingleCommand(c *C) {
+	tpm := s.newTPM(c)
+	tpm.SetAutoContinueSessions(false)
+	index := s.newIndex(c)
+
+	// A session without AttrContinueSession is fine if only one command is required.
+	_, err := tpm.NVRead(index, index, 16, 0, s.newSession(0))
+	c.Check(IsTPMError(err, ErrorCommandCode, CommandNVRead), internal_testutil.IsTrue)
+}
+
+type tpmVendorErrorSuite struct{}
+
+var _ = Suite(&tpmVendorErrorSuite{})
+
+func (s *tpmVendorErrorSuite) TestVendorError(c *C) {
+	RegisterVendorError(0x54455354, 0x0000057e, "some other vendor error")
+	defer UnregisterVendorError(0x54455354, 0x0000057e)
+
+	tpm := NewTPMContext(&mockPropertiesTransport{
+		properties: map[Property]uint32{PropertyManufacturer: 0x54455354},
+		rc:         0x0000057e})
+	c.Assert(tpm.InitProperties(), IsNil)
+	_, err := tpm.GetRandom(8)
+	c.Check(err, ErrorMatches, `TPM returned a vendor defined error whilst executing command TPM_CC_GetRandom: 0x0000057e \(some other vendor error\)`)
+
+	var e *TPMVendorError
+	c.Assert(err, internal_testutil.ErrorAs, &e)
+	c.Check(e, DeepEquals, &TPMVendorError{Command: CommandGetRandom, Code: 0x0000057e, Manufacturer: 0x54455354})
+}
+
+func (s *tpmVendorErrorSuite) TestVendorErrorUnregistered(c *C) {
+	RegisterVendorError(0x54455354, 0x0000057e, "some other vendor error")
+	defer UnregisterVendorError(0x54455354, 0x0000057e)
+
+	tpm := NewTPMContext(&mockPropertiesTransport{
+		properties: map[Property]uint32{PropertyManufacturer: 0x54455354},
+		rc:         0x0000057d})
+	c.Assert(tpm.InitProperties(), IsNil)
+	_, err := tpm.GetRandom(8)
+	c.Check(err, ErrorMatches, `TPM returned a vendor defined error whilst executing command TPM_CC_GetRandom: 0x0000057d`)
+}
+
+func (s *tpmVendorErrorSuite) TestVendorErrorPropertiesNotInitialized(c *C) {
+	RegisterVendorError(0x54455354, 0x0000057e, "some other vendor error")
+	defer UnregisterVendorError(0x54455354, 0x0000057e)
+
+	// The manufacturer is only obtained by InitProperties, so it is unknown here.
+	tpm := NewTPMContext(&mockPropertiesTransport{
+		failCap: true,
+		rc:      0x0000057e})
+	_, err := tpm.GetRandom(8)
+	c.Check(err, ErrorMatches, `TPM returned a vendor defined error whilst executing command TPM_CC_GetRandom: 0x0000057e`)
+
+	var e *TPMVendorError
+	c.Assert(err, internal_testutil.ErrorAs, &e)
+	c.Check(e, DeepEquals, &TPMVendorError{Command: CommandGetRandom, Code: 0x0000057e})
+}
+
+// fragmentingTransport is a transport that returns a response as a sequence of
+// fragments, one per read. It never returns io.EOF at the end of a response, so
+// reading beyond the end of a response returns an error.
+type fragmentingTransport struct {
+	cmd       []byte
+	fragments [][]byte
+	eof       bool // return io.EOF rather than an error when there are no more fragments
+}
+
+func (t *fragmentingTransport) Read(data []byte) (int, error) {
+	if len(t.fragments) == 0 {
+		if t.eof {
+			return 0, io.EOF
+		}
+		return 0, errors.New("read beyond end of response")
+	}
+	n := copy(data, t.fragments[0])
+	t.fragments[0] = t.fragments[0][n:]
+	if len(t.fragments[0]) == 0 {
+		t.fragments = t.fragments[1:]
+	}
+	return n, nil
+}
+
+func (t *fragmentingTransport) Write(data []byte) (int, error) {
+	t.cmd = append(t.cmd, data...)
+	return len(data), nil
+}
+
+func (t *fragmentingTransport) Close() error {
+	return nil
+}
+
+type tpmRunCommandBytesSuite struct{}
+
+var _ = Suite(&tpmRunCommandBytesSuite{})
+
+func (s *tpmRunCommandBytesSuite) TestRunCommandBytes(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "8001000000140000000000080102030405060708")
+	transport := &fragmentingTransport{fragments: [][]byte{rsp}}
+	tpm := NewTPMContext(transport)
+
+	cmd := internal_testutil.DecodeHexString(c, "80010000000c0000017b0008")
+	packet, err := tpm.RunCommandBytes(cmd)
+	c.Check(err, IsNil)
+	c.Check(packet, DeepEquals, ResponsePacket(rsp))
+	c.Check(transport.cmd, DeepEquals, cmd)
+}
+
+func (s *tpmRunCommandBytesSuite) TestRunCommandBytesFragmentedResponse(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "8001000000140000000000080102030405060708")
+	transport := &fragmentingTransport{fragments: [][]byte{rsp[:3], rsp[3:7], rsp[7:12], rsp[12:]}}
+	tpm := NewTPMContext(transport)
+
+	packet, err := tpm.RunCommandBytes(internal_testutil.DecodeHexString(c, "80010000000c0000017b0008"))
+	c.Check(err, IsNil)
+	c.Check(packet, DeepEquals, ResponsePacket(rsp))
+	c.Check(transport.fragments, internal_testutil.LenEquals, 0)
+
+	rc, rpBytes, _, err := packet.Unmarshal(nil)
+	c.Check(err, IsNil)
+	c.Check(rc, Equals, ResponseSuccess)
+	c.Check(rpBytes, DeepEquals, rsp[10:])
+}
+
+func (s *tpmRunCommandBytesSuite) TestRunCommandBytesTruncatedHeader(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "8001000000140000000000080102030405060708")
+	transport := &fragmentingTransport{fragments: [][]byte{rsp[:3], rsp[3:7]}, eof: true}
+	tpm := NewTPMContext(transport)
+
+	_, err := tpm.RunCommandBytes(internal_testutil.DecodeHexString(c, "80010000000c0000017b0008"))
+	c.Check(err, ErrorMatches, `cannot complete read operation on Transport: unexpected EOF`)
+
+	var e *TransportError
+	c.Check(err, internal_testutil.ErrorAs, &e)
+}
+
+func (s *tpmRunCommandBytesSuite) TestRunCommandBytesTruncated(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "8001000000140000000000080102030405060708")
+	transport := &fragmentingTransport{fragments: [][]byte{rsp[:12], rsp[12:16]}, eof: true}
+	tpm := NewTPMContext(transport)
+
+	_, err := tpm.RunCommandBytes(internal_testutil.DecodeHexString(c, "80010000000c0000017b0008"))
+	c.Check(err, ErrorMatches, `cannot complete read operation on Transport: unexpected EOF`)
+}
+
+func (s *tpmRunCommandBytesSuite) TestRunCommandBytesInvalidResponseSize(c *C) {
+	rsp := internal_testutil.DecodeHexString(c, "80010000000400000000")
+	transport := &fragmentingTransport{fragments: [][]byte{rsp}}
+	tpm := NewTPMContext(transport)
+
+	packet, err := tpm.RunCommandBytes(internal_testutil.DecodeHexString(c, "80010000000c0000017b0008"))
+	c.Check(err, IsNil)
+	c.Check(packet, DeepEquals, ResponsePacket(rsp))
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+/*
+Package transportutil contains helpers for wrapping a [tpm2.Transport].
+*/
+package transportutil
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/canonical/go-tpm2"
+	internal_transportutil "github.com/canonical/go-tpm2/internal/transportutil"
+)
+
+// CommandNotAllowedError is returned from the Write method of a transport created by
+// [NewFilteringTransport] when a command is not permitted by the filter. The command is
+// not forwarded to the underlying transport. When a command is executed with a
+// [tpm2.TPMContext], this will be wrapped in a *[tpm2.TransportError].
+type CommandNotAllowedError struct {
+	CommandCode tpm2.CommandCode
+}
+
+func (e *CommandNotAllowedError) Error() string {
+	return fmt.Sprintf("command %v is not allowed by the transport filter", e.CommandCode)
+}
+
+type filteringTransport struct {
+	transport tpm2.Transport
+	allowed   func(code tpm2.CommandCode) bool
+	w         io.Writer
+}
+
+// NewFilteringTransport returns a new transport that only forwards commands to the supplied
+// transport if the supplied function returns true for their command code, which is useful for
+// restricting which commands can be executed via a [tpm2.TPMContext]. Commands that are not
+// allowed are not forwarded, and the Write method of the returned transport returns a
+// *[CommandNotAllowedError] error instead. If allowed is nil, no commands are forwarded.
+//
+// Commands are buffered until they are complete before the command code is checked, so
+// partial writes of a command are never forwarded.
+func NewFilteringTransport(transport tpm2.Transport, allowed func(code tpm2.CommandCode) bool) tpm2.Transport {
+	if allowed == nil {
+		allowed = func(tpm2.CommandCode) bool { return false }
+	}
+	t := &filteringTransport{
+		transport: transport,
+		allowed:   allowed,
+	}
+	t.w = internal_transportutil.BufferCommands(&commandFilter{t: t}, math.MaxUint32)
+	return t
+}
+
+func (t *filteringTransport) Read(data []byte) (int, error) {
+	return t.transport.Read(data)
+}
+
+func (t *filteringTransport) Write(data []byte) (int, error) {
+	return t.w.Write(data)
+}
+
+func (t *filteringTransport) Close() error {
+	return t.transport.Close()
+}
+
+// commandFilter receives complete commands from a filteringTransport and only
+// forwards the ones that are allowed.
+type commandFilter struct {
+	t *filteringTransport
+}
+
+func (f *commandFilter) Write(data []byte) (int, error) {
+	code, err := tpm2.CommandPacket(data).GetCommandCode()
+	if err != nil {
+		return 0, err
+	}
+	if !f.t.allowed(code) {
+		return 0, &CommandNotAllowedError{CommandCode: code}
+	}
+	return f.t.transport.Write(data)
+}
@@ -0,0 +1,156 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package transportutil_test
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	. "github.com/canonical/go-tpm2/transportutil"
+)
+
+// mockTransport records the commands written to it and responds to
+// each one with a successful TPM2_GetRandom response.
+type mockTransport struct {
+	commands []tpm2.CommandPacket
+	rsp      *bytes.Reader
+	closed   bool
+}
+
+func (t *mockTransport) Read(data []byte) (int, error) {
+	return t.rsp.Read(data)
+}
+
+func (t *mockTransport) Write(data []byte) (int, error) {
+	t.commands = append(t.commands, append(tpm2.CommandPacket(nil), data...))
+
+	params := mu.MustMarshalToBytes(tpm2.Digest{1, 2, 3, 4})
+	t.rsp = bytes.NewReader(mu.MustMarshalToBytes(tpm2.ResponseHeader{
+		Tag:          tpm2.TagNoSessions,
+		ResponseSize: uint32(binary.Size(tpm2.ResponseHeader{}) + len(params)),
+		ResponseCode: tpm2.ResponseSuccess,
+	}, mu.RawBytes(params)))
+	return len(data), nil
+}
+
+func (t *mockTransport) Close() error {
+	t.closed = true
+	return nil
+}
+
+type filterSuite struct{}
+
+var _ = Suite(&filterSuite{})
+
+func allowGetRandom(code tpm2.CommandCode) bool {
+	return code == tpm2.CommandGetRandom
+}
+
+func (s *filterSuite) TestAllowed(c *C) {
+	inner := new(mockTransport)
+	tpm := tpm2.NewTPMContext(NewFilteringTransport(inner, allowGetRandom))
+
+	b, err := tpm.GetRandom(4)
+	c.Check(err, IsNil)
+	c.Check(b, DeepEquals, tpm2.Digest{1, 2, 3, 4})
+
+	c.Assert(inner.commands, internal_testutil.LenEquals, 1)
+	code, err := inner.commands[0].GetCommandCode()
+	c.Check(err, IsNil)
+	c.Check(code, Equals, tpm2.CommandGetRandom)
+}
+
+func (s *filterSuite) TestNotAllowed(c *C) {
+	inner := new(mockTransport)
+	tpm := tpm2.NewTPMContext(NewFilteringTransport(inner, allowGetRandom))
+
+	err := tpm.Clear(tpm.LockoutHandleContext(), nil)
+	c.Check(err, ErrorMatches, `cannot complete write operation on Transport: command TPM_CC_Clear is not allowed by the transport filter`)
+
+	var te *tpm2.TransportError
+	c.Check(err, internal_testutil.ErrorAs, &te)
+	var e *CommandNotAllowedError
+	c.Assert(err, internal_testutil.ErrorAs, &e)
+	c.Check(e.CommandCode, Equals, tpm2.CommandClear)
+
+	// The command never reached the inner transport.
+	c.Check(inner.commands, internal_testutil.LenEquals, 0)
+
+	// Subsequent allowed commands still work.
+	_, err = tpm.GetRandom(4)
+	c.Check(err, IsNil)
+	c.Check(inner.commands, internal_testutil.LenEquals, 1)
+}
+
+func (s *filterSuite) TestPartialWrites(c *C) {
+	inner := new(mockTransport)
+	transport := NewFilteringTransport(inner, allowGetRandom)
+
+	cmd := tpm2.MustMarshalCommandPacket(tpm2.CommandGetRandom, nil, nil, mu.MustMarshalToBytes(uint16(4)))
+	for i := 0; i < len(cmd); i += 3 {
+		end := i + 3
+		if end > len(cmd) {
+			end = len(cmd)
+		}
+		n, err := transport.Write(cmd[i:end])
+		c.Check(err, IsNil)
+		c.Check(n, Equals, end-i)
+		if end < len(cmd) {
+			c.Check(inner.commands, internal_testutil.LenEquals, 0)
+		}
+	}
+
+	c.Assert(inner.commands, internal_testutil.LenEquals, 1)
+	c.Check(inner.commands[0], DeepEquals, cmd)
+}
+
+func (s *filterSuite) TestPartialWritesNotAllowed(c *C) {
+	inner := new(mockTransport)
+	transport := NewFilteringTransport(inner, allowGetRandom)
+
+	cmd := tpm2.MustMarshalCommandPacket(tpm2.CommandStirRandom, nil, nil, mu.MustMarshalToBytes(tpm2.SensitiveData("foo")))
+	_, err := transport.Write(cmd[:5])
+	c.Check(err, IsNil)
+	_, err = transport.Write(cmd[5:])
+	c.Check(err, ErrorMatches, `command TPM_CC_StirRandom is not allowed by the transport filter`)
+	c.Check(inner.commands, internal_testutil.LenEquals, 0)
+}
+
+func (s *filterSuite) TestNilAllowed(c *C) {
+	inner := new(mockTransport)
+	tpm := tpm2.NewTPMContext(NewFilteringTransport(inner, nil))
+
+	_, err := tpm.GetRandom(4)
+	c.Check(err, ErrorMatches, `cannot complete write operation on Transport: command TPM_CC_GetRandom is not allowed by the transport filter`)
+	c.Check(inner.commands, internal_testutil.LenEquals, 0)
+}
+
+func (s *filterSuite) TestInvalidCommandSize(c *C) {
+	inner := new(mockTransport)
+	transport := NewFilteringTransport(inner, allowGetRandom)
+
+	_, err := transport.Write(internal_testutil.DecodeHexString(c, "800100000008000001440000"))
+	c.Check(err, ErrorMatches, `invalid command size \(8 bytes\)`)
+	c.Check(inner.commands, internal_testutil.LenEquals, 0)
+
+	// A subsequent valid command is still forwarded.
+	cmd := tpm2.MustMarshalCommandPacket(tpm2.CommandGetRandom, nil, nil, mu.MustMarshalToBytes(uint16(4)))
+	_, err = transport.Write(cmd)
+	c.Check(err, IsNil)
+	c.Assert(inner.commands, internal_testutil.LenEquals, 1)
+	c.Check(inner.commands[0], DeepEquals, cmd)
+}
+
+func (s *filterSuite) TestClose(c *C) {
+	inner := new(mockTransport)
+	transport := NewFilteringTransport(inner, allowGetRandom)
+	c.Check(transport.Close(), IsNil)
+	c.Check(inner.closed, internal_testutil.IsTrue)
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package transportutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/canonical/go-tpm2"
+	internal_transportutil "github.com/canonical/go-tpm2/internal/transportutil"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// streamMaxCommandSize is the default maximum size of a command sent by a transport
+// returned from NewStreamTransport.
+const streamMaxCommandSize = 4096
+
+type streamTransport struct {
+	rw  io.ReadWriter
+	w   io.Writer
+	rsp *bytes.Reader
+}
+
+type streamTransportOptions struct {
+	maxCommandSize uint32
+}
+
+// StreamTransportOption is an option that can be supplied to [NewStreamTransport].
+type StreamTransportOption func(*streamTransportOptions)
+
+// WithMaxCommandSize sets the maximum size of a command that can be sent by a transport
+// returned from [NewStreamTransport].
+func WithMaxCommandSize(size uint32) StreamTransportOption {
+	return func(opts *streamTransportOptions) {
+		opts.maxCommandSize = size
+	}
+}
+
+// NewStreamTransport returns a new transport that sends commands to and receives responses
+// from the supplied stream, which is useful for tunneling TPM commands over a connection such
+// as a SSH channel or a custom RPC mechanism.
+//
+// Commands are buffered until they are complete and then written to the stream in a single
+// write. Commands larger than 4096 bytes are rejected by default, and this limit can be changed
+// with [WithMaxCommandSize]. Responses are framed using the responseSize field of the response
+// header, and exactly this number of bytes is read from the stream for each response, so that
+// multiple commands can be sent over the same stream. If the stream implements [io.Closer], it
+// is closed when the returned transport is closed.
+func NewStreamTransport(rw io.ReadWriter, options ...StreamTransportOption) tpm2.Transport {
+	opts := streamTransportOptions{maxCommandSize: streamMaxCommandSize}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return &streamTransport{
+		rw: rw,
+		w:  internal_transportutil.BufferCommands(rw, opts.maxCommandSize),
+	}
+}
+
+func (t *streamTransport) readNextResponse() error {
+	hdrSize := binary.Size(tpm2.ResponseHeader{})
+	buf := new(bytes.Buffer)
+	if _, err := io.CopyN(buf, t.rw, int64(hdrSize)); err != nil {
+		if err == io.EOF && buf.Len() > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	var hdr tpm2.ResponseHeader
+	if _, err := mu.UnmarshalFromBytes(buf.Bytes(), &hdr); err != nil {
+		return fmt.Errorf("cannot decode response header: %w", err)
+	}
+	if hdr.ResponseSize < uint32(hdrSize) {
+		return fmt.Errorf("invalid response size (%d bytes)", hdr.ResponseSize)
+	}
+
+	// Copy the rest of the response rather than allocating it based on the header, so that a
+	// bogus responseSize doesn't result in a large allocation.
+	if _, err := io.CopyN(buf, t.rw, int64(hdr.ResponseSize)-int64(hdrSize)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	t.rsp = bytes.NewReader(buf.Bytes())
+	return nil
+}
+
+func (t *streamTransport) Read(data []byte) (n int, err error) {
+	if t.rsp == nil || t.rsp.Len() == 0 {
+		if err := t.readNextResponse(); err != nil {
+			return 0, err
+		}
+	}
+	return t.rsp.Read(data)
+}
+
+func (t *streamTransport) Write(data []byte) (int, error) {
+	return t.w.Write(data)
+}
+
+func (t *streamTransport) Close() error {
+	closer, ok := t.rw.(io.Closer)
+	if !ok {
+		return nil
+	}
+	return closer.Close()
+}
@@ -0,0 +1,229 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package transportutil_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	. "github.com/canonical/go-tpm2/transportutil"
+)
+
+type streamSuite struct{}
+
+var _ = Suite(&streamSuite{})
+
+// runLoopbackResponder reads TPM2_GetRandom commands from the supplied connection until
+// it is closed, and responds to each one with the requested number of bytes, each set to
+// the 1-based index of the command. If chunkSize is greater than zero, responses are
+// written to the connection in chunks of this size rather than via a transport.
+func (s *streamSuite) runLoopbackResponder(conn net.Conn, chunkSize int) <-chan error {
+	done := make(chan error, 1)
+
+	go func() {
+		defer conn.Close()
+
+		// Commands and responses share the same header layout, so a stream transport
+		// can be used to read whole commands from the other side of the connection.
+		transport := NewStreamTransport(conn)
+		for i := 1; ; i++ {
+			cmd := make([]byte, binary.Size(tpm2.CommandHeader{}))
+			if _, err := io.ReadFull(transport, cmd); err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				done <- err
+				return
+			}
+			var hdr tpm2.CommandHeader
+			if _, err := mu.UnmarshalFromBytes(cmd, &hdr); err != nil {
+				done <- err
+				return
+			}
+			buf := bytes.NewBuffer(cmd)
+			if _, err := io.CopyN(buf, transport, int64(hdr.CommandSize)-int64(len(cmd))); err != nil {
+				done <- err
+				return
+			}
+
+			var bytesRequested uint16
+			if _, err := mu.UnmarshalFromBytes(buf.Bytes()[len(cmd):], &bytesRequested); err != nil {
+				done <- err
+				return
+			}
+
+			params := mu.MustMarshalToBytes(tpm2.Digest(bytes.Repeat([]byte{byte(i)}, int(bytesRequested))))
+			rsp := mu.MustMarshalToBytes(tpm2.ResponseHeader{
+				Tag:          tpm2.TagNoSessions,
+				ResponseSize: uint32(binary.Size(tpm2.ResponseHeader{}) + len(params)),
+				ResponseCode: tpm2.ResponseSuccess,
+			}, mu.RawBytes(params))
+
+			if chunkSize <= 0 {
+				if _, err := transport.Write(rsp); err != nil {
+					done <- err
+					return
+				}
+				continue
+			}
+			for len(rsp) > 0 {
+				sz := chunkSize
+				if sz > len(rsp) {
+					sz = len(rsp)
+				}
+				if _, err := conn.Write(rsp[:sz]); err != nil {
+					done <- err
+					return
+				}
+				rsp = rsp[sz:]
+			}
+		}
+	}()
+
+	return done
+}
+
+func (s *streamSuite) testStreamTransport(c *C, chunkSize int) {
+	client, server := net.Pipe()
+	done := s.runLoopbackResponder(server, chunkSize)
+
+	tpm := tpm2.NewTPMContext(NewStreamTransport(client))
+
+	randomBytes, err := tpm.GetRandom(4)
+	c.Check(err, IsNil)
+	c.Check(randomBytes, DeepEquals, tpm2.Digest{1, 1, 1, 1})
+
+	randomBytes, err = tpm.GetRandom(8)
+	c.Check(err, IsNil)
+	c.Check(randomBytes, DeepEquals, tpm2.Digest{2, 2, 2, 2, 2, 2, 2, 2})
+
+	randomBytes, err = tpm.GetRandom(2)
+	c.Check(err, IsNil)
+	c.Check(randomBytes, DeepEquals, tpm2.Digest{3, 3})
+
+	c.Check(tpm.Close(), IsNil)
+	c.Check(<-done, IsNil)
+}
+
+func (s *streamSuite) TestStreamTransport(c *C) {
+	s.testStreamTransport(c, 0)
+}
+
+func (s *streamSuite) TestStreamTransportFragmentedResponses(c *C) {
+	s.testStreamTransport(c, 3)
+}
+
+func (s *streamSuite) TestStreamTransportReadsExactlyOneResponse(c *C) {
+	var rsp []byte
+	for i := 1; i <= 2; i++ {
+		params := mu.MustMarshalToBytes(tpm2.Digest{byte(i), byte(i)})
+		rsp = append(rsp, mu.MustMarshalToBytes(tpm2.ResponseHeader{
+			Tag:          tpm2.TagNoSessions,
+			ResponseSize: uint32(binary.Size(tpm2.ResponseHeader{}) + len(params)),
+			ResponseCode: tpm2.ResponseSuccess,
+		}, mu.RawBytes(params))...)
+	}
+
+	// Both responses are available immediately, but the transport should return
+	// only the first one before the next read.
+	stream := &struct {
+		io.Reader
+		io.Writer
+	}{bytes.NewReader(rsp), io.Discard}
+	transport := NewStreamTransport(stream)
+
+	buf := make([]byte, 100)
+	n, err := transport.Read(buf)
+	c.Check(err, IsNil)
+	c.Check(buf[:n], DeepEquals, rsp[:len(rsp)/2])
+
+	n, err = transport.Read(buf)
+	c.Check(err, IsNil)
+	c.Check(buf[:n], DeepEquals, rsp[len(rsp)/2:])
+
+	_, err = transport.Read(buf)
+	c.Check(err, Equals, io.EOF)
+}
+
+func (s *streamSuite) TestStreamTransportTruncatedResponse(c *C) {
+	rsp := mu.MustMarshalToBytes(tpm2.ResponseHeader{
+		Tag:          tpm2.TagNoSessions,
+		ResponseSize: 20,
+		ResponseCode: tpm2.ResponseSuccess,
+	}, mu.RawBytes([]byte{1, 2, 3}))
+
+	stream := &struct {
+		io.Reader
+		io.Writer
+	}{bytes.NewReader(rsp), io.Discard}
+	transport := NewStreamTransport(stream)
+
+	_, err := transport.Read(make([]byte, 100))
+	c.Check(err, Equals, io.ErrUnexpectedEOF)
+}
+
+func (s *streamSuite) TestStreamTransportBuffersCommands(c *C) {
+	w := new(mockWriter)
+	stream := &struct {
+		io.Reader
+		io.Writer
+	}{bytes.NewReader(nil), w}
+	transport := NewStreamTransport(stream)
+
+	cmd := mu.MustMarshalToBytes(tpm2.CommandHeader{
+		Tag:         tpm2.TagNoSessions,
+		CommandSize: 12,
+		CommandCode: tpm2.CommandGetRandom,
+	}, uint16(4))
+
+	for _, b := range cmd {
+		_, err := transport.Write([]byte{b})
+		c.Check(err, IsNil)
+	}
+	c.Check(w.writes, DeepEquals, [][]byte{cmd})
+}
+
+func (s *streamSuite) TestStreamTransportCommandTooLarge(c *C) {
+	w := new(mockWriter)
+	stream := &struct {
+		io.Reader
+		io.Writer
+	}{bytes.NewReader(nil), w}
+	transport := NewStreamTransport(stream)
+
+	cmd := tpm2.MustMarshalCommandPacket(tpm2.CommandStirRandom, nil, nil, mu.MustMarshalToBytes(mu.RawBytes(make([]byte, 4096))))
+	_, err := transport.Write(cmd)
+	c.Check(err, ErrorMatches, `invalid command size \(4106 bytes\)`)
+	c.Check(w.writes, HasLen, 0)
+}
+
+func (s *streamSuite) TestStreamTransportWithMaxCommandSize(c *C) {
+	w := new(mockWriter)
+	stream := &struct {
+		io.Reader
+		io.Writer
+	}{bytes.NewReader(nil), w}
+	transport := NewStreamTransport(stream, WithMaxCommandSize(8192))
+
+	cmd := tpm2.MustMarshalCommandPacket(tpm2.CommandStirRandom, nil, nil, mu.MustMarshalToBytes(mu.RawBytes(make([]byte, 4096))))
+	_, err := transport.Write(cmd)
+	c.Check(err, IsNil)
+	c.Check(w.writes, DeepEquals, [][]byte{cmd})
+}
+
+type mockWriter struct {
+	writes [][]byte
+}
+
+func (w *mockWriter) Write(data []byte) (int, error) {
+	w.writes = append(w.writes, append([]byte(nil), data...))
+	return len(data), nil
+}
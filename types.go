@@ -5,6 +5,7 @@
 package tpm2
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -169,6 +170,48 @@ func (v PCRValues) SetValue(alg HashAlgorithmId, pcr int, digest Digest) error {
 	return nil
 }
 
+// SplitByBank splits this set of PCR values into a separate set of PCR values for each PCR
+// bank, keyed by the algorithm of the bank. Each returned set of PCR values is a copy, so
+// modifying it doesn't modify this set. Banks that contain no values are omitted. Use
+// [PCRValues.Merge] to combine the returned values again. To iterate over the banks in a
+// canonical order, use the list of banks returned from [PCRSelectionList.Banks] for the
+// selection returned from [PCRValues.SelectionList].
+func (v PCRValues) SplitByBank() map[HashAlgorithmId]PCRValues {
+	out := make(map[HashAlgorithmId]PCRValues)
+	for alg, bank := range v {
+		if len(bank) == 0 {
+			continue
+		}
+		values := PCRValues{alg: make(map[int]Digest)}
+		for pcr, digest := range bank {
+			values[alg][pcr] = append(Digest(nil), digest...)
+		}
+		out[alg] = values
+	}
+	return out
+}
+
+// Merge returns a new set of PCR values that contains both the values in this set and the
+// values in r. This will return an error if both sets contain a different value for the same
+// PCR.
+func (v PCRValues) Merge(r PCRValues) (out PCRValues, err error) {
+	out = make(PCRValues)
+	for _, src := range []PCRValues{v, r} {
+		for alg, bank := range src {
+			if _, ok := out[alg]; !ok {
+				out[alg] = make(map[int]Digest)
+			}
+			for pcr, digest := range bank {
+				if existing, ok := out[alg][pcr]; ok && !bytes.Equal(existing, digest) {
+					return nil, fmt.Errorf("conflicting values for PCR %d in bank %v", pcr, alg)
+				}
+				out[alg][pcr] = append(Digest(nil), digest...)
+			}
+		}
+	}
+	return out, nil
+}
+
 // PublicTemplate exists to allow a type to be marshalled to the
 // Template type.
 type PublicTemplate interface {
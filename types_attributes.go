@@ -4,6 +4,11 @@
 
 package tpm2
 
+import (
+	"fmt"
+	"strings"
+)
+
 // This file contains types defined in section 8 (Attributes) in
 // part 2 of the library spec.
 
@@ -39,6 +44,106 @@ const (
 	AttrSign                 ObjectAttributes = 1 << 18 // sign
 )
 
+// Decode returns a structured representation of these attributes.
+func (a ObjectAttributes) Decode() ObjectAttributesInfo {
+	return ObjectAttributesInfo{
+		FixedTPM:             a&AttrFixedTPM != 0,
+		StClear:              a&AttrStClear != 0,
+		FixedParent:          a&AttrFixedParent != 0,
+		SensitiveDataOrigin:  a&AttrSensitiveDataOrigin != 0,
+		UserWithAuth:         a&AttrUserWithAuth != 0,
+		AdminWithPolicy:      a&AttrAdminWithPolicy != 0,
+		NoDA:                 a&AttrNoDA != 0,
+		EncryptedDuplication: a&AttrEncryptedDuplication != 0,
+		Restricted:           a&AttrRestricted != 0,
+		Decrypt:              a&AttrDecrypt != 0,
+		Sign:                 a&AttrSign != 0,
+		Reserved:             a & objectAttributesReserved,
+	}
+}
+
+const objectAttributesReserved ObjectAttributes = ^(AttrFixedTPM | AttrStClear | AttrFixedParent | AttrSensitiveDataOrigin |
+	AttrUserWithAuth | AttrAdminWithPolicy | AttrNoDA | AttrEncryptedDuplication | AttrRestricted | AttrDecrypt | AttrSign)
+
+var objectAttributesInfoStrings = []struct {
+	attr ObjectAttributes
+	str  string
+}{
+	{AttrFixedTPM, "TPMA_OBJECT_FIXEDTPM"},
+	{AttrStClear, "TPMA_OBJECT_STCLEAR"},
+	{AttrFixedParent, "TPMA_OBJECT_FIXEDPARENT"},
+	{AttrSensitiveDataOrigin, "TPMA_OBJECT_SENSITIVEDATAORIGIN"},
+	{AttrUserWithAuth, "TPMA_OBJECT_USERWITHAUTH"},
+	{AttrAdminWithPolicy, "TPMA_OBJECT_ADMINWITHPOLICY"},
+	{AttrNoDA, "TPMA_OBJECT_NODA"},
+	{AttrEncryptedDuplication, "TPMA_OBJECT_ENCRYPTEDDUPLICATION"},
+	{AttrRestricted, "TPMA_OBJECT_RESTRICTED"},
+	{AttrDecrypt, "TPMA_OBJECT_DECRYPT"},
+	{AttrSign, "TPMA_OBJECT_SIGN_ENCRYPT"},
+}
+
+// ObjectAttributesInfo is a structured representation of [ObjectAttributes], which
+// makes it easier to reason about the attributes of an object. It is returned from
+// [ObjectAttributes.Decode], and can be converted back with [ObjectAttributesInfo.Encode].
+type ObjectAttributesInfo struct {
+	FixedTPM             bool // TPMA_OBJECT_FIXEDTPM
+	StClear              bool // TPMA_OBJECT_STCLEAR
+	FixedParent          bool // TPMA_OBJECT_FIXEDPARENT
+	SensitiveDataOrigin  bool // TPMA_OBJECT_SENSITIVEDATAORIGIN
+	UserWithAuth         bool // TPMA_OBJECT_USERWITHAUTH
+	AdminWithPolicy      bool // TPMA_OBJECT_ADMINWITHPOLICY
+	NoDA                 bool // TPMA_OBJECT_NODA
+	EncryptedDuplication bool // TPMA_OBJECT_ENCRYPTEDDUPLICATION
+	Restricted           bool // TPMA_OBJECT_RESTRICTED
+	Decrypt              bool // TPMA_OBJECT_DECRYPT
+	Sign                 bool // TPMA_OBJECT_SIGN_ENCRYPT
+
+	Reserved ObjectAttributes // Any reserved bits that are set, preserved for round-trip fidelity
+}
+
+// Encode returns the packed [ObjectAttributes] representation of this structure.
+func (i ObjectAttributesInfo) Encode() ObjectAttributes {
+	attrs := i.Reserved & objectAttributesReserved
+	for _, a := range []struct {
+		set  bool
+		attr ObjectAttributes
+	}{
+		{i.FixedTPM, AttrFixedTPM},
+		{i.StClear, AttrStClear},
+		{i.FixedParent, AttrFixedParent},
+		{i.SensitiveDataOrigin, AttrSensitiveDataOrigin},
+		{i.UserWithAuth, AttrUserWithAuth},
+		{i.AdminWithPolicy, AttrAdminWithPolicy},
+		{i.NoDA, AttrNoDA},
+		{i.EncryptedDuplication, AttrEncryptedDuplication},
+		{i.Restricted, AttrRestricted},
+		{i.Decrypt, AttrDecrypt},
+		{i.Sign, AttrSign},
+	} {
+		if a.set {
+			attrs |= a.attr
+		}
+	}
+	return attrs
+}
+
+// String returns a string representation of these attributes, consisting of the name
+// of each attribute that is set, separated by '|'.
+func (i ObjectAttributesInfo) String() string {
+	attrs := i.Encode()
+
+	var components []string
+	for _, s := range objectAttributesInfoStrings {
+		if attrs&s.attr != 0 {
+			components = append(components, s.str)
+		}
+	}
+	if i.Reserved&objectAttributesReserved != 0 {
+		components = append(components, fmt.Sprintf("0x%08x", uint32(i.Reserved&objectAttributesReserved)))
+	}
+	return strings.Join(components, "|")
+}
+
 // SessionAttributes corresponds to the TPMA_SESSION type, and represents
 // the attributes for a session.
 type SessionAttributes uint8
@@ -0,0 +1,88 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/objectutil"
+)
+
+type objectAttributesSuite struct{}
+
+var _ = Suite(&objectAttributesSuite{})
+
+func (s *objectAttributesSuite) TestDecodeStorageKeyTemplate(c *C) {
+	info := objectutil.NewRSAStorageKeyTemplate().Attrs.Decode()
+	c.Check(info, DeepEquals, ObjectAttributesInfo{
+		FixedTPM:            true,
+		FixedParent:         true,
+		SensitiveDataOrigin: true,
+		UserWithAuth:        true,
+		Restricted:          true,
+		Decrypt:             true})
+}
+
+func (s *objectAttributesSuite) TestDecodeAll(c *C) {
+	info := ObjectAttributes(0x00070cf6).Decode()
+	c.Check(info, DeepEquals, ObjectAttributesInfo{
+		FixedTPM:             true,
+		StClear:              true,
+		FixedParent:          true,
+		SensitiveDataOrigin:  true,
+		UserWithAuth:         true,
+		AdminWithPolicy:      true,
+		NoDA:                 true,
+		EncryptedDuplication: true,
+		Restricted:           true,
+		Decrypt:              true,
+		Sign:                 true})
+}
+
+func (s *objectAttributesSuite) TestDecodeReserved(c *C) {
+	info := (AttrSign | (1 << 3) | (1 << 19)).Decode()
+	c.Check(info, DeepEquals, ObjectAttributesInfo{
+		Sign:     true,
+		Reserved: (1 << 3) | (1 << 19)})
+}
+
+func (s *objectAttributesSuite) TestRoundTrip(c *C) {
+	for _, attrs := range []ObjectAttributes{
+		0,
+		objectutil.NewRSAStorageKeyTemplate().Attrs,
+		AttrFixedTPM | AttrFixedParent | AttrSensitiveDataOrigin | AttrUserWithAuth | AttrSign,
+		AttrStClear | AttrAdminWithPolicy | AttrEncryptedDuplication | AttrDecrypt,
+		0xffffffff,
+	} {
+		c.Check(attrs.Decode().Encode(), Equals, attrs, Commentf("%#08x", uint32(attrs)))
+	}
+}
+
+func (s *objectAttributesSuite) TestEncode(c *C) {
+	info := ObjectAttributesInfo{
+		UserWithAuth: true,
+		Sign:         true}
+	c.Check(info.Encode(), Equals, AttrUserWithAuth|AttrSign)
+}
+
+func (s *objectAttributesSuite) TestEncodeIgnoresNonReservedBits(c *C) {
+	info := ObjectAttributesInfo{Reserved: AttrDecrypt}
+	c.Check(info.Encode(), Equals, ObjectAttributes(0))
+}
+
+func (s *objectAttributesSuite) TestString(c *C) {
+	info := objectutil.NewRSAStorageKeyTemplate().Attrs.Decode()
+	c.Check(info.String(), Equals, "TPMA_OBJECT_FIXEDTPM|TPMA_OBJECT_FIXEDPARENT|TPMA_OBJECT_SENSITIVEDATAORIGIN|TPMA_OBJECT_USERWITHAUTH|TPMA_OBJECT_RESTRICTED|TPMA_OBJECT_DECRYPT")
+}
+
+func (s *objectAttributesSuite) TestStringReserved(c *C) {
+	info := (AttrSign | (1 << 8)).Decode()
+	c.Check(info.String(), Equals, "TPMA_OBJECT_SIGN_ENCRYPT|0x00000100")
+}
+
+func (s *objectAttributesSuite) TestStringNoAttrs(c *C) {
+	c.Check(ObjectAttributesInfo{}.String(), Equals, "")
+}
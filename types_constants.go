@@ -180,6 +180,7 @@ const (
 	CommandNVCertify                  CommandCode = 0x00000184 // TPM_CC_NV_Certify
 	CommandEventSequenceComplete      CommandCode = 0x00000185 // TPM_CC_EventSequenceComplete
 	CommandHashSequenceStart          CommandCode = 0x00000186 // TPM_CC_HashSequenceStart
+	CommandPolicyPhysicalPresence     CommandCode = 0x00000187 // TPM_CC_PolicyPhysicalPresence
 	CommandPolicyDuplicationSelect    CommandCode = 0x00000188 // TPM_CC_PolicyDuplicationSelect
 	CommandPolicyGetDigest            CommandCode = 0x00000189 // TPM_CC_PolicyGetDigest
 	CommandTestParms                  CommandCode = 0x0000018A // TPM_CC_TestParms
@@ -189,6 +190,7 @@ const (
 	CommandPolicyTemplate             CommandCode = 0x00000190 // TPM_CC_PolicyTemplate
 	CommandCreateLoaded               CommandCode = 0x00000191 // TPM_CC_CreateLoaded
 	CommandPolicyAuthorizeNV          CommandCode = 0x00000192 // TPM_CC_PolicyAuthorizeNV
+	CommandPolicyParameters           CommandCode = 0x0000019C // TPM_CC_PolicyParameters
 )
 
 // ResponseCode corresponds to the TPM_RC type.
@@ -59,6 +59,48 @@ func (a HashAlgorithmId) HashFunc() crypto.Hash {
 	return a.GetHash()
 }
 
+// CryptoHash returns the equivalent crypto.Hash value for this algorithm. The
+// returned boolean is false if there is no equivalent crypto.Hash or if it is
+// not linked into the current binary, in which case the returned value must not
+// be used. This is the inverse of [HashAlgorithmFromCrypto].
+func (a HashAlgorithmId) CryptoHash() (crypto.Hash, bool) {
+	h := a.GetHash()
+	if h == 0 || !h.Available() {
+		return 0, false
+	}
+	return h, true
+}
+
+// HashAlgorithmFromCrypto returns the TPM digest algorithm that is equivalent to
+// the supplied crypto.Hash value. The returned boolean is false if there is no
+// equivalent TPM digest algorithm or if the supplied algorithm is not linked into
+// the current binary, in which case the returned value must not be used. This is
+// the inverse of [HashAlgorithmId.CryptoHash].
+func HashAlgorithmFromCrypto(h crypto.Hash) (HashAlgorithmId, bool) {
+	if !h.Available() {
+		return HashAlgorithmNull, false
+	}
+
+	switch h {
+	case crypto.SHA1:
+		return HashAlgorithmSHA1, true
+	case crypto.SHA256:
+		return HashAlgorithmSHA256, true
+	case crypto.SHA384:
+		return HashAlgorithmSHA384, true
+	case crypto.SHA512:
+		return HashAlgorithmSHA512, true
+	case crypto.SHA3_256:
+		return HashAlgorithmSHA3_256, true
+	case crypto.SHA3_384:
+		return HashAlgorithmSHA3_384, true
+	case crypto.SHA3_512:
+		return HashAlgorithmSHA3_512, true
+	default:
+		return HashAlgorithmNull, false
+	}
+}
+
 // IsValid determines if the digest algorithm is valid. This
 // should be checked by code that deserializes an algorithm before
 // calling Size if it does not want to panic.
@@ -0,0 +1,81 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package tpm2_test
+
+import (
+	"crypto"
+	"crypto/aes"
+
+	. "gopkg.in/check.v1"
+
+	. "github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+)
+
+type typesInterfaceSuite struct{}
+
+var _ = Suite(&typesInterfaceSuite{})
+
+func (s *typesInterfaceSuite) TestHashAlgorithmCryptoMapping(c *C) {
+	for _, data := range []struct {
+		alg HashAlgorithmId
+		h   crypto.Hash
+	}{
+		{alg: HashAlgorithmSHA1, h: crypto.SHA1},
+		{alg: HashAlgorithmSHA256, h: crypto.SHA256},
+		{alg: HashAlgorithmSHA384, h: crypto.SHA384},
+		{alg: HashAlgorithmSHA512, h: crypto.SHA512},
+		{alg: HashAlgorithmSHA3_256, h: crypto.SHA3_256},
+		{alg: HashAlgorithmSHA3_384, h: crypto.SHA3_384},
+		{alg: HashAlgorithmSHA3_512, h: crypto.SHA3_512},
+	} {
+		comment := Commentf("%v", data.alg)
+
+		h, ok := data.alg.CryptoHash()
+		alg, ok2 := HashAlgorithmFromCrypto(data.h)
+		if !data.h.Available() {
+			// The algorithm isn't linked into this binary.
+			c.Check(ok, internal_testutil.IsFalse, comment)
+			c.Check(h, Equals, crypto.Hash(0), comment)
+			c.Check(ok2, internal_testutil.IsFalse, comment)
+			c.Check(alg, Equals, HashAlgorithmNull, comment)
+			continue
+		}
+
+		c.Check(ok, internal_testutil.IsTrue, comment)
+		c.Check(h, Equals, data.h, comment)
+		c.Check(ok2, internal_testutil.IsTrue, comment)
+		c.Check(alg, Equals, data.alg, comment)
+		c.Check(h.Size(), Equals, data.alg.Size(), comment)
+	}
+}
+
+func (s *typesInterfaceSuite) TestHashAlgorithmCryptoHashUnsupported(c *C) {
+	for _, alg := range []HashAlgorithmId{HashAlgorithmNull, HashAlgorithmSM3_256, HashAlgorithmId(AlgorithmRSA), 0} {
+		h, ok := alg.CryptoHash()
+		c.Check(ok, internal_testutil.IsFalse, Commentf("%v", alg))
+		c.Check(h, Equals, crypto.Hash(0), Commentf("%v", alg))
+	}
+}
+
+func (s *typesInterfaceSuite) TestHashAlgorithmFromCryptoUnsupported(c *C) {
+	for _, h := range []crypto.Hash{0, crypto.MD5, crypto.SHA224, crypto.SHA512_256, crypto.BLAKE2b_256} {
+		alg, ok := HashAlgorithmFromCrypto(h)
+		c.Check(ok, internal_testutil.IsFalse, Commentf("%v", h))
+		c.Check(alg, Equals, HashAlgorithmNull, Commentf("%v", h))
+	}
+}
+
+func (s *typesInterfaceSuite) TestRegisterCipherNilRemovesRegistration(c *C) {
+	c.Assert(SymAlgorithmCamellia.Available(), internal_testutil.IsFalse)
+
+	RegisterCipher(SymAlgorithmCamellia, aes.NewCipher)
+	c.Check(SymAlgorithmCamellia.Available(), internal_testutil.IsTrue)
+
+	RegisterCipher(SymAlgorithmCamellia, nil)
+	c.Check(SymAlgorithmCamellia.Available(), internal_testutil.IsFalse)
+	_, err := SymAlgorithmCamellia.NewCipher(make([]byte, 16))
+	c.Check(err, ErrorMatches, `unavailable cipher TPM_ALG_CAMELLIA`)
+}
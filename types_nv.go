@@ -7,6 +7,7 @@ package tpm2
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/canonical/go-tpm2/mu"
 )
@@ -76,6 +77,149 @@ const (
 	AttrNVReadStClear    NVAttributes = 1 << 31 // TPMA_NV_READ_STCLEAR
 )
 
+// Decode returns a structured representation of these attributes.
+func (a NVAttributes) Decode() NVAttributesInfo {
+	return NVAttributesInfo{
+		Type:           a.Type(),
+		PPWrite:        a&AttrNVPPWrite != 0,
+		OwnerWrite:     a&AttrNVOwnerWrite != 0,
+		AuthWrite:      a&AttrNVAuthWrite != 0,
+		PolicyWrite:    a&AttrNVPolicyWrite != 0,
+		PolicyDelete:   a&AttrNVPolicyDelete != 0,
+		WriteLocked:    a&AttrNVWriteLocked != 0,
+		WriteAll:       a&AttrNVWriteAll != 0,
+		WriteDefine:    a&AttrNVWriteDefine != 0,
+		WriteStClear:   a&AttrNVWriteStClear != 0,
+		GlobalLock:     a&AttrNVGlobalLock != 0,
+		PPRead:         a&AttrNVPPRead != 0,
+		OwnerRead:      a&AttrNVOwnerRead != 0,
+		AuthRead:       a&AttrNVAuthRead != 0,
+		PolicyRead:     a&AttrNVPolicyRead != 0,
+		NoDA:           a&AttrNVNoDA != 0,
+		Orderly:        a&AttrNVOrderly != 0,
+		ClearStClear:   a&AttrNVClearStClear != 0,
+		ReadLocked:     a&AttrNVReadLocked != 0,
+		Written:        a&AttrNVWritten != 0,
+		PlatformCreate: a&AttrNVPlatformCreate != 0,
+		ReadStClear:    a&AttrNVReadStClear != 0,
+		Reserved:       a & nvAttributesReserved,
+	}
+}
+
+const nvAttributesReserved NVAttributes = (1 << 8) | (1 << 9) | (1 << 20) | (1 << 21) | (1 << 22) | (1 << 23) | (1 << 24)
+
+var nvAttributesInfoStrings = []struct {
+	attr NVAttributes
+	str  string
+}{
+	{AttrNVPPWrite, "TPMA_NV_PPWRITE"},
+	{AttrNVOwnerWrite, "TPMA_NV_OWNERWRITE"},
+	{AttrNVAuthWrite, "TPMA_NV_AUTHWRITE"},
+	{AttrNVPolicyWrite, "TPMA_NV_POLICY_WRITE"},
+	{AttrNVPolicyDelete, "TPMA_NV_POLICY_DELETE"},
+	{AttrNVWriteLocked, "TPMA_NV_WRITELOCKED"},
+	{AttrNVWriteAll, "TPMA_NV_WRITEALL"},
+	{AttrNVWriteDefine, "TPMA_NV_WRITEDEFINE"},
+	{AttrNVWriteStClear, "TPMA_NV_WRITE_STCLEAR"},
+	{AttrNVGlobalLock, "TPMA_NV_GLOBALLOCK"},
+	{AttrNVPPRead, "TPMA_NV_PPREAD"},
+	{AttrNVOwnerRead, "TPMA_NV_OWNERREAD"},
+	{AttrNVAuthRead, "TPMA_NV_AUTHREAD"},
+	{AttrNVPolicyRead, "TPMA_NV_POLICYREAD"},
+	{AttrNVNoDA, "TPMA_NV_NO_DA"},
+	{AttrNVOrderly, "TPMA_NV_ORDERLY"},
+	{AttrNVClearStClear, "TPMA_NV_CLEAR_STCLEAR"},
+	{AttrNVReadLocked, "TPMA_NV_READLOCKED"},
+	{AttrNVWritten, "TPMA_NV_WRITTEN"},
+	{AttrNVPlatformCreate, "TPMA_NV_PLATFORMCREATE"},
+	{AttrNVReadStClear, "TPMA_NV_READ_STCLEAR"},
+}
+
+// NVAttributesInfo is a structured representation of [NVAttributes], which makes it
+// easier to reason about the attributes of a NV index. It is returned from
+// [NVAttributes.Decode], and can be converted back with [NVAttributesInfo.Encode].
+type NVAttributesInfo struct {
+	Type NVType // The type of the index
+
+	PPWrite        bool // TPMA_NV_PPWRITE
+	OwnerWrite     bool // TPMA_NV_OWNERWRITE
+	AuthWrite      bool // TPMA_NV_AUTHWRITE
+	PolicyWrite    bool // TPMA_NV_POLICY_WRITE
+	PolicyDelete   bool // TPMA_NV_POLICY_DELETE
+	WriteLocked    bool // TPMA_NV_WRITELOCKED
+	WriteAll       bool // TPMA_NV_WRITEALL
+	WriteDefine    bool // TPMA_NV_WRITEDEFINE
+	WriteStClear   bool // TPMA_NV_WRITE_STCLEAR
+	GlobalLock     bool // TPMA_NV_GLOBALLOCK
+	PPRead         bool // TPMA_NV_PPREAD
+	OwnerRead      bool // TPMA_NV_OWNERREAD
+	AuthRead       bool // TPMA_NV_AUTHREAD
+	PolicyRead     bool // TPMA_NV_POLICYREAD
+	NoDA           bool // TPMA_NV_NO_DA
+	Orderly        bool // TPMA_NV_ORDERLY
+	ClearStClear   bool // TPMA_NV_CLEAR_STCLEAR
+	ReadLocked     bool // TPMA_NV_READLOCKED
+	Written        bool // TPMA_NV_WRITTEN
+	PlatformCreate bool // TPMA_NV_PLATFORMCREATE
+	ReadStClear    bool // TPMA_NV_READ_STCLEAR
+
+	Reserved NVAttributes // Any reserved bits that are set, preserved for round-trip fidelity
+}
+
+// Encode returns the packed [NVAttributes] representation of this structure,
+// including the type.
+func (i NVAttributesInfo) Encode() NVAttributes {
+	attrs := i.Type.WithAttrs(i.Reserved & nvAttributesReserved)
+	for _, a := range []struct {
+		set  bool
+		attr NVAttributes
+	}{
+		{i.PPWrite, AttrNVPPWrite},
+		{i.OwnerWrite, AttrNVOwnerWrite},
+		{i.AuthWrite, AttrNVAuthWrite},
+		{i.PolicyWrite, AttrNVPolicyWrite},
+		{i.PolicyDelete, AttrNVPolicyDelete},
+		{i.WriteLocked, AttrNVWriteLocked},
+		{i.WriteAll, AttrNVWriteAll},
+		{i.WriteDefine, AttrNVWriteDefine},
+		{i.WriteStClear, AttrNVWriteStClear},
+		{i.GlobalLock, AttrNVGlobalLock},
+		{i.PPRead, AttrNVPPRead},
+		{i.OwnerRead, AttrNVOwnerRead},
+		{i.AuthRead, AttrNVAuthRead},
+		{i.PolicyRead, AttrNVPolicyRead},
+		{i.NoDA, AttrNVNoDA},
+		{i.Orderly, AttrNVOrderly},
+		{i.ClearStClear, AttrNVClearStClear},
+		{i.ReadLocked, AttrNVReadLocked},
+		{i.Written, AttrNVWritten},
+		{i.PlatformCreate, AttrNVPlatformCreate},
+		{i.ReadStClear, AttrNVReadStClear},
+	} {
+		if a.set {
+			attrs |= a.attr
+		}
+	}
+	return attrs
+}
+
+// String returns a string representation of these attributes, consisting of the type
+// followed by the name of each attribute that is set, separated by '|'.
+func (i NVAttributesInfo) String() string {
+	attrs := i.Encode()
+
+	components := []string{i.Type.String()}
+	for _, s := range nvAttributesInfoStrings {
+		if attrs&s.attr != 0 {
+			components = append(components, s.str)
+		}
+	}
+	if i.Reserved&nvAttributesReserved != 0 {
+		components = append(components, fmt.Sprintf("0x%08x", uint32(i.Reserved&nvAttributesReserved)))
+	}
+	return strings.Join(components, "|")
+}
+
 // NVPublic corresponds to the TPMS_NV_PUBLIC type, which describes a NV index.
 type NVPublic struct {
 	Index      Handle          // Handle of the NV index
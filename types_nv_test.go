@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"testing"
 
+	. "gopkg.in/check.v1"
+
 	. "github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/testutil"
 )
@@ -36,3 +38,112 @@ func TestNVPublicName(t *testing.T) {
 		t.Errorf("NVPublic.Name() returned an unexpected name")
 	}
 }
+
+type nvAttributesSuite struct{}
+
+var _ = Suite(&nvAttributesSuite{})
+
+func (s *nvAttributesSuite) TestDecodeOrdinary(c *C) {
+	info := NVTypeOrdinary.WithAttrs(AttrNVAuthRead | AttrNVAuthWrite | AttrNVWritten).Decode()
+	c.Check(info, DeepEquals, NVAttributesInfo{
+		Type:      NVTypeOrdinary,
+		AuthRead:  true,
+		AuthWrite: true,
+		Written:   true})
+}
+
+func (s *nvAttributesSuite) TestDecodeCounter(c *C) {
+	info := NVTypeCounter.WithAttrs(AttrNVOwnerRead | AttrNVOwnerWrite | AttrNVNoDA).Decode()
+	c.Check(info, DeepEquals, NVAttributesInfo{
+		Type:       NVTypeCounter,
+		OwnerRead:  true,
+		OwnerWrite: true,
+		NoDA:       true})
+}
+
+func (s *nvAttributesSuite) TestDecodeTypeOnly(c *C) {
+	for _, t := range []NVType{NVTypeOrdinary, NVTypeCounter, NVTypeBits, NVTypeExtend, NVTypePinFail, NVTypePinPass} {
+		info := t.WithAttrs(0).Decode()
+		c.Check(info, DeepEquals, NVAttributesInfo{Type: t})
+	}
+}
+
+func (s *nvAttributesSuite) TestDecodeAllAttrs(c *C) {
+	info := NVTypePinPass.WithAttrs(0xfe0ffc0f).Decode()
+	c.Check(info, DeepEquals, NVAttributesInfo{
+		Type:           NVTypePinPass,
+		PPWrite:        true,
+		OwnerWrite:     true,
+		AuthWrite:      true,
+		PolicyWrite:    true,
+		PolicyDelete:   true,
+		WriteLocked:    true,
+		WriteAll:       true,
+		WriteDefine:    true,
+		WriteStClear:   true,
+		GlobalLock:     true,
+		PPRead:         true,
+		OwnerRead:      true,
+		AuthRead:       true,
+		PolicyRead:     true,
+		NoDA:           true,
+		Orderly:        true,
+		ClearStClear:   true,
+		ReadLocked:     true,
+		Written:        true,
+		PlatformCreate: true,
+		ReadStClear:    true})
+}
+
+func (s *nvAttributesSuite) TestDecodeReserved(c *C) {
+	info := NVTypeOrdinary.WithAttrs(AttrNVAuthRead | (1 << 9) | (1 << 22)).Decode()
+	c.Check(info, DeepEquals, NVAttributesInfo{
+		Type:     NVTypeOrdinary,
+		AuthRead: true,
+		Reserved: (1 << 9) | (1 << 22)})
+}
+
+func (s *nvAttributesSuite) TestRoundTrip(c *C) {
+	for _, attrs := range []NVAttributes{
+		0,
+		NVTypeOrdinary.WithAttrs(AttrNVAuthRead | AttrNVAuthWrite | AttrNVWritten),
+		NVTypeCounter.WithAttrs(AttrNVOwnerRead | AttrNVOwnerWrite | AttrNVNoDA),
+		NVTypeBits.WithAttrs(AttrNVPolicyRead | AttrNVPolicyWrite | AttrNVReadStClear),
+		NVTypeExtend.WithAttrs(AttrNVPPRead | AttrNVPPWrite | AttrNVPlatformCreate | AttrNVOrderly),
+		NVTypePinFail.WithAttrs(AttrNVWriteLocked | AttrNVReadLocked | AttrNVGlobalLock),
+		0xffffffff,
+	} {
+		c.Check(attrs.Decode().Encode(), Equals, attrs, Commentf("%#08x", uint32(attrs)))
+	}
+}
+
+func (s *nvAttributesSuite) TestEncode(c *C) {
+	info := NVAttributesInfo{
+		Type:       NVTypeBits,
+		OwnerRead:  true,
+		OwnerWrite: true}
+	attrs := info.Encode()
+	c.Check(attrs, Equals, NVTypeBits.WithAttrs(AttrNVOwnerRead|AttrNVOwnerWrite))
+	c.Check(attrs.Type(), Equals, NVTypeBits)
+}
+
+func (s *nvAttributesSuite) TestEncodeIgnoresNonReservedBits(c *C) {
+	info := NVAttributesInfo{
+		Type:     NVTypeOrdinary,
+		Reserved: AttrNVAuthRead}
+	c.Check(info.Encode(), Equals, NVAttributes(0))
+}
+
+func (s *nvAttributesSuite) TestString(c *C) {
+	info := NVTypeCounter.WithAttrs(AttrNVAuthRead | AttrNVAuthWrite | AttrNVWritten).Decode()
+	c.Check(info.String(), Equals, "TPM_NT_COUNTER|TPMA_NV_AUTHWRITE|TPMA_NV_AUTHREAD|TPMA_NV_WRITTEN")
+}
+
+func (s *nvAttributesSuite) TestStringReserved(c *C) {
+	info := NVTypeOrdinary.WithAttrs(AttrNVOwnerRead | (1 << 8)).Decode()
+	c.Check(info.String(), Equals, "TPM_NT_ORDINARY|TPMA_NV_OWNERREAD|0x00000100")
+}
+
+func (s *nvAttributesSuite) TestStringNoAttrs(c *C) {
+	c.Check(NVAttributesInfo{Type: NVTypeExtend}.String(), Equals, "TPM_NT_EXTEND")
+}
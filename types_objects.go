@@ -9,6 +9,7 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"errors"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -177,6 +178,9 @@ type Public struct {
 
 // ComputeName computes the name of this object
 func (p *Public) ComputeName() (Name, error) {
+	if p == nil {
+		return nil, errors.New("no public area")
+	}
 	if !p.NameAlg.Available() {
 		return nil, fmt.Errorf("unsupported name algorithm or algorithm not linked into binary: %v", p.NameAlg)
 	}
@@ -145,3 +145,13 @@ func TestPublicName(t *testing.T) {
 		t.Errorf("Public.Name() returned an unexpected name")
 	}
 }
+
+func TestPublicNameNil(t *testing.T) {
+	var pub *Public
+	if _, err := pub.ComputeName(); err == nil || err.Error() != "no public area" {
+		t.Errorf("ComputeName returned an unexpected error: %v", err)
+	}
+	if pub.Name().Type() != NameTypeInvalid {
+		t.Errorf("Name returned an unexpected name")
+	}
+}
@@ -795,6 +795,24 @@ func (l PCRSelectionList) MustRemove(r PCRSelectionList) (out PCRSelectionList)
 	return out
 }
 
+// Banks returns the PCR banks that are referenced by this list of PCR selections, in
+// order of ascending algorithm ID, which is the same order as [PCRSelectionList.Sort].
+// Each bank appears once, even if it is referenced by more than one selection. A bank is
+// included even if its selection selects no PCRs.
+func (l PCRSelectionList) Banks() []HashAlgorithmId {
+	var out []HashAlgorithmId
+	seen := make(map[HashAlgorithmId]bool)
+	for _, s := range l {
+		if seen[s.Hash] {
+			continue
+		}
+		seen[s.Hash] = true
+		out = append(out, s.Hash)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
 // IsEmpty returns true if the list of PCR selections selects no PCRs.
 func (l PCRSelectionList) IsEmpty() bool {
 	for _, s := range l {
@@ -906,6 +924,42 @@ type TimeInfo struct {
 	ClockInfo ClockInfo // Clock information
 }
 
+// TimeInfoField identifies a field of the [TimeInfo] structure.
+type TimeInfoField int
+
+const (
+	TimeInfoFieldTime         TimeInfoField = iota // TimeInfo.Time
+	TimeInfoFieldClock                             // TimeInfo.ClockInfo.Clock
+	TimeInfoFieldResetCount                        // TimeInfo.ClockInfo.ResetCount
+	TimeInfoFieldRestartCount                      // TimeInfo.ClockInfo.RestartCount
+	TimeInfoFieldSafe                              // TimeInfo.ClockInfo.Safe
+)
+
+// PolicyCounterTimerOperand returns the operandB and offset arguments for
+// [TPMContext.PolicyCounterTimer] that can be used to compare the specified field of the
+// TPM's TPMS_TIME_INFO structure against the value of the same field in this structure.
+// This will panic if field is invalid.
+func (i *TimeInfo) PolicyCounterTimerOperand(field TimeInfoField) (operandB Operand, offset uint16) {
+	var size int
+	switch field {
+	case TimeInfoFieldTime:
+		offset, size = 0, 8
+	case TimeInfoFieldClock:
+		offset, size = 8, 8
+	case TimeInfoFieldResetCount:
+		offset, size = 16, 4
+	case TimeInfoFieldRestartCount:
+		offset, size = 20, 4
+	case TimeInfoFieldSafe:
+		offset, size = 24, 1
+	default:
+		panic("invalid field")
+	}
+
+	b := mu.MustMarshalToBytes(i)
+	return Operand(b[offset : int(offset)+size]), offset
+}
+
 // 10.12 Attestation Structures
 
 // TimeAttestInfo corresponds to the TPMS_TIME_ATTEST_INFO type, and is returned by
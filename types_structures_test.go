@@ -30,6 +30,27 @@ func (s *typesStructuresSuite) TestMakeHandleNameEndorsement(c *C) {
 	c.Check(name, DeepEquals, Name(internal_testutil.DecodeHexString(c, "4000000b")))
 }
 
+func (s *typesStructuresSuite) TestMakeHandleNameNull(c *C) {
+	name := MakeHandleName(HandleNull)
+	c.Check(name, DeepEquals, Name(internal_testutil.DecodeHexString(c, "40000007")))
+}
+
+func (s *typesStructuresSuite) TestMakeHandleNamePCR(c *C) {
+	name := MakeHandleName(16)
+	c.Check(name, DeepEquals, Name(internal_testutil.DecodeHexString(c, "00000010")))
+	c.Check(name.Type(), Equals, NameTypeHandle)
+	c.Check(name.Handle(), Equals, Handle(16))
+}
+
+func (s *typesStructuresSuite) TestMakeHandleNameSession(c *C) {
+	name := MakeHandleName(0x03000001)
+	c.Check(name, DeepEquals, Name(internal_testutil.DecodeHexString(c, "03000001")))
+}
+
+func (s *typesStructuresSuite) TestMakeHandleNameInvalid(c *C) {
+	c.Check(func() { MakeHandleName(0x81000001) }, PanicMatches, `invalid handle type`)
+}
+
 func (s *typesStructuresSuite) TestNameTypeNone(c *C) {
 	var name Name
 	c.Check(name.Type(), Equals, NameTypeNone)
@@ -310,6 +331,21 @@ func (s *typesStructuresSuite) TestPCRSelectionListSort(c *C) {
 	c.Check(sorted, DeepEquals, expected)
 }
 
+func (s *typesStructuresSuite) TestPCRSelectionListBanks(c *C) {
+	pcrs := PCRSelectionList{
+		{Hash: HashAlgorithmSHA384, Select: []int{5, 3, 8}},
+		{Hash: HashAlgorithmSHA256, Select: []int{1, 2, 0}},
+		{Hash: HashAlgorithmSHA1, Select: []int{8, 3, 7, 4}},
+		{Hash: HashAlgorithmSHA256, Select: []int{4}},
+		{Hash: HashAlgorithmSHA512},
+	}
+	c.Check(pcrs.Banks(), DeepEquals, []HashAlgorithmId{HashAlgorithmSHA1, HashAlgorithmSHA256, HashAlgorithmSHA384, HashAlgorithmSHA512})
+}
+
+func (s *typesStructuresSuite) TestPCRSelectionListBanksEmpty(c *C) {
+	c.Check(PCRSelectionList{}.Banks(), internal_testutil.LenEquals, 0)
+}
+
 func (s *typesStructuresSuite) TestPCRSelectionListMerge1(c *C) {
 	x := PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{0, 2, 1}}}
 	y := PCRSelectionList{{Hash: HashAlgorithmSHA256, Select: []int{5, 1, 3}}}
@@ -596,3 +632,36 @@ func (s *typesStructuresSuite) TestTaggedHashListBuilderError(c *C) {
 	_, err := builder.Finish()
 	c.Check(err, ErrorMatches, "encountered error on digest 1: invalid digest size")
 }
+
+func (s *typesStructuresSuite) TestTimeInfoPolicyCounterTimerOperand(c *C) {
+	info := &TimeInfo{
+		Time: 0x0102030405060708,
+		ClockInfo: ClockInfo{
+			Clock:        0x1112131415161718,
+			ResetCount:   0x21222324,
+			RestartCount: 0x31323334,
+			Safe:         true}}
+
+	for _, data := range []struct {
+		field    TimeInfoField
+		operandB Operand
+		offset   uint16
+	}{
+		{field: TimeInfoFieldTime, operandB: Operand{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, offset: 0},
+		{field: TimeInfoFieldClock, operandB: Operand{0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18}, offset: 8},
+		{field: TimeInfoFieldResetCount, operandB: Operand{0x21, 0x22, 0x23, 0x24}, offset: 16},
+		{field: TimeInfoFieldRestartCount, operandB: Operand{0x31, 0x32, 0x33, 0x34}, offset: 20},
+		{field: TimeInfoFieldSafe, operandB: Operand{0x01}, offset: 24},
+	} {
+		operandB, offset := info.PolicyCounterTimerOperand(data.field)
+		c.Check(operandB, DeepEquals, data.operandB, Commentf("field %d", data.field))
+		c.Check(offset, Equals, data.offset, Commentf("field %d", data.field))
+	}
+}
+
+func (s *typesStructuresSuite) TestTimeInfoPolicyCounterTimerOperandNotSafe(c *C) {
+	info := &TimeInfo{ClockInfo: ClockInfo{Safe: false}}
+	operandB, offset := info.PolicyCounterTimerOperand(TimeInfoFieldSafe)
+	c.Check(operandB, DeepEquals, Operand{0x00})
+	c.Check(offset, Equals, uint16(24))
+}
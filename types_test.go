@@ -88,3 +88,88 @@ func (s *typesSuite) TestUnmarshalPCRValuesInvalidDigestSize(c *C) {
 	_, err := mu.UnmarshalFromBytes(b, &values)
 	c.Check(err, ErrorMatches, "cannot unmarshal argument 0 whilst processing element of type tpm2.PCRValues: invalid digest size")
 }
+
+func (s *typesSuite) newMultiBankPCRValues(c *C) PCRValues {
+	values := make(PCRValues)
+	c.Assert(values.SetValue(HashAlgorithmSHA256, 7, internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865")), IsNil)
+	c.Assert(values.SetValue(HashAlgorithmSHA1, 4, internal_testutil.DecodeHexString(c, "7448d8798a4380162d4b56f9b452e2f6f9e24e7a")), IsNil)
+	c.Assert(values.SetValue(HashAlgorithmSHA256, 4, internal_testutil.DecodeHexString(c, "53c234e5e8472b6ac51c1ae1cab3fe06fad053beb8ebfd8977b010655bfdd3c3")), IsNil)
+	return values
+}
+
+func (s *typesSuite) TestPCRValuesSplitByBank(c *C) {
+	values := s.newMultiBankPCRValues(c)
+
+	banks := values.SplitByBank()
+	c.Check(banks, DeepEquals, map[HashAlgorithmId]PCRValues{
+		HashAlgorithmSHA1: {
+			HashAlgorithmSHA1: {4: internal_testutil.DecodeHexString(c, "7448d8798a4380162d4b56f9b452e2f6f9e24e7a")},
+		},
+		HashAlgorithmSHA256: {
+			HashAlgorithmSHA256: {
+				4: internal_testutil.DecodeHexString(c, "53c234e5e8472b6ac51c1ae1cab3fe06fad053beb8ebfd8977b010655bfdd3c3"),
+				7: internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865"),
+			},
+		},
+	})
+
+	// The returned values are copies.
+	banks[HashAlgorithmSHA1][HashAlgorithmSHA1][4][0] ^= 0xff
+	c.Check(values, DeepEquals, s.newMultiBankPCRValues(c))
+}
+
+func (s *typesSuite) TestPCRValuesSplitByBankOmitsEmpty(c *C) {
+	values := PCRValues{
+		HashAlgorithmSHA1:   {},
+		HashAlgorithmSHA256: {7: internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865")},
+	}
+	banks := values.SplitByBank()
+	c.Check(banks, internal_testutil.LenEquals, 1)
+	_, ok := banks[HashAlgorithmSHA256]
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
+func (s *typesSuite) TestPCRValuesSplitAndMergeRoundTrip(c *C) {
+	values := s.newMultiBankPCRValues(c)
+
+	pcrs, err := values.SelectionList()
+	c.Assert(err, IsNil)
+
+	split := values.SplitByBank()
+	merged := make(PCRValues)
+	for _, alg := range pcrs.Banks() {
+		merged, err = merged.Merge(split[alg])
+		c.Assert(err, IsNil)
+	}
+	c.Check(merged, DeepEquals, values)
+
+	b1, err := mu.MarshalToBytes(values)
+	c.Check(err, IsNil)
+	b2, err := mu.MarshalToBytes(merged)
+	c.Check(err, IsNil)
+	c.Check(b2, DeepEquals, b1)
+}
+
+func (s *typesSuite) TestPCRValuesMerge(c *C) {
+	x := PCRValues{HashAlgorithmSHA256: {7: internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865")}}
+	y := PCRValues{
+		HashAlgorithmSHA256: {
+			4: internal_testutil.DecodeHexString(c, "53c234e5e8472b6ac51c1ae1cab3fe06fad053beb8ebfd8977b010655bfdd3c3"),
+			7: internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865"),
+		},
+		HashAlgorithmSHA1: {4: internal_testutil.DecodeHexString(c, "7448d8798a4380162d4b56f9b452e2f6f9e24e7a")},
+	}
+
+	merged, err := x.Merge(y)
+	c.Check(err, IsNil)
+	c.Check(merged, DeepEquals, s.newMultiBankPCRValues(c))
+	c.Check(x, internal_testutil.LenEquals, 1)
+}
+
+func (s *typesSuite) TestPCRValuesMergeConflict(c *C) {
+	x := PCRValues{HashAlgorithmSHA256: {7: internal_testutil.DecodeHexString(c, "4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865")}}
+	y := PCRValues{HashAlgorithmSHA256: {7: internal_testutil.DecodeHexString(c, "53c234e5e8472b6ac51c1ae1cab3fe06fad053beb8ebfd8977b010655bfdd3c3")}}
+
+	_, err := x.Merge(y)
+	c.Check(err, ErrorMatches, `conflicting values for PCR 7 in bank TPM_ALG_SHA256`)
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// AuditedCommand contains the command and response parameter digests for a command
+// that was executed with an audit session.
+type AuditedCommand struct {
+	CpHash tpm2.Digest // The command parameter digest
+	RpHash tpm2.Digest // The response parameter digest
+}
+
+// ComputeAuditDigest computes the session audit digest for the supplied sequence of
+// commands, using the specified digest algorithm, which must be the algorithm of the
+// audit session. The digest starts as a zero digest and is extended with the cpHash
+// and rpHash of each command in turn, as described in part 1 of the TPM 2.0 Library
+// Specification. If the audit session was started or reset with the first of the
+// supplied commands, the result can be compared with the session digest returned from
+// [tpm2.TPMContext.GetSessionAuditDigest] to verify the audit session independently.
+//
+// The cpHash and rpHash of each command must be computed with the specified digest
+// algorithm.
+func ComputeAuditDigest(hashAlg tpm2.HashAlgorithmId, commands []AuditedCommand) (tpm2.Digest, error) {
+	if !hashAlg.Available() {
+		return nil, errors.New("algorithm is not available")
+	}
+
+	digest := make(tpm2.Digest, hashAlg.Size())
+	for i, cmd := range commands {
+		if len(cmd.CpHash) != hashAlg.Size() {
+			return nil, fmt.Errorf("invalid cpHash length for command %d", i)
+		}
+		if len(cmd.RpHash) != hashAlg.Size() {
+			return nil, fmt.Errorf("invalid rpHash length for command %d", i)
+		}
+
+		h := hashAlg.NewHash()
+		h.Write(digest)
+		h.Write(cmd.CpHash)
+		h.Write(cmd.RpHash)
+		digest = h.Sum(nil)
+	}
+
+	return digest, nil
+}
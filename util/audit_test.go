@@ -0,0 +1,108 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util_test
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+	. "github.com/canonical/go-tpm2/util"
+)
+
+type auditSuiteNoTPM struct{}
+
+var _ = Suite(&auditSuiteNoTPM{})
+
+func (s *auditSuiteNoTPM) TestComputeAuditDigest(c *C) {
+	digest, err := ComputeAuditDigest(tpm2.HashAlgorithmSHA256, []AuditedCommand{
+		{CpHash: bytes.Repeat([]byte{0x11}, 32), RpHash: bytes.Repeat([]byte{0x22}, 32)},
+		{CpHash: bytes.Repeat([]byte{0x33}, 32), RpHash: bytes.Repeat([]byte{0x44}, 32)},
+	})
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "7c66284c8801cfd6f1d22b37d93947e9436fe94f7ed81356f6286d0e99ffef1e")))
+}
+
+func (s *auditSuiteNoTPM) TestComputeAuditDigestSHA1(c *C) {
+	digest, err := ComputeAuditDigest(tpm2.HashAlgorithmSHA1, []AuditedCommand{
+		{CpHash: bytes.Repeat([]byte{0x11}, 20), RpHash: bytes.Repeat([]byte{0x22}, 20)},
+	})
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, tpm2.Digest(internal_testutil.DecodeHexString(c, "85673a5eaf7ea7aede135434de5871d86fbaaa8f")))
+}
+
+func (s *auditSuiteNoTPM) TestComputeAuditDigestNoCommands(c *C) {
+	digest, err := ComputeAuditDigest(tpm2.HashAlgorithmSHA256, nil)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, make(tpm2.Digest, 32))
+}
+
+func (s *auditSuiteNoTPM) TestComputeAuditDigestInvalidCpHash(c *C) {
+	_, err := ComputeAuditDigest(tpm2.HashAlgorithmSHA256, []AuditedCommand{
+		{CpHash: make([]byte, 32), RpHash: make([]byte, 32)},
+		{CpHash: make([]byte, 20), RpHash: make([]byte, 32)},
+	})
+	c.Check(err, ErrorMatches, `invalid cpHash length for command 1`)
+}
+
+func (s *auditSuiteNoTPM) TestComputeAuditDigestInvalidRpHash(c *C) {
+	_, err := ComputeAuditDigest(tpm2.HashAlgorithmSHA256, []AuditedCommand{
+		{CpHash: make([]byte, 32), RpHash: make([]byte, 20)},
+	})
+	c.Check(err, ErrorMatches, `invalid rpHash length for command 0`)
+}
+
+func (s *auditSuiteNoTPM) TestComputeAuditDigestUnavailableAlgorithm(c *C) {
+	_, err := ComputeAuditDigest(tpm2.HashAlgorithmNull, nil)
+	c.Check(err, ErrorMatches, `algorithm is not available`)
+}
+
+type auditSuite struct {
+	testutil.TPMTest
+}
+
+func (s *auditSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureEndorsementHierarchy
+}
+
+var _ = Suite(&auditSuite{})
+
+func (s *auditSuite) TestComputeAuditDigest(c *C) {
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypeHMAC, nil, tpm2.HashAlgorithmSHA256).WithAttrs(tpm2.AttrContinueSession | tpm2.AttrAudit)
+
+	s.ForgetCommands()
+
+	_, err := s.TPM.GetRandom(16, session)
+	c.Assert(err, IsNil)
+	_, err = s.TPM.ReadClock(session)
+	c.Assert(err, IsNil)
+
+	var commands []AuditedCommand
+	for _, cmd := range s.CommandLog() {
+		c.Assert(cmd.CmdHandles, internal_testutil.LenEquals, 0)
+
+		cpHash, err := policyutil.ComputeCpHash(tpm2.HashAlgorithmSHA256, cmd.CmdCode, nil, mu.Raw(cmd.CpBytes))
+		c.Assert(err, IsNil)
+
+		h := tpm2.HashAlgorithmSHA256.NewHash()
+		mu.MustMarshalToWriter(h, cmd.RspCode, cmd.CmdCode, mu.Raw(cmd.RpBytes))
+
+		commands = append(commands, AuditedCommand{CpHash: cpHash, RpHash: h.Sum(nil)})
+	}
+	c.Assert(commands, internal_testutil.LenEquals, 2)
+
+	digest, err := ComputeAuditDigest(tpm2.HashAlgorithmSHA256, commands)
+	c.Check(err, IsNil)
+
+	auditInfo, _, err := s.TPM.GetSessionAuditDigest(s.TPM.EndorsementHandleContext(), nil, session, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(auditInfo.Attested.SessionAudit, NotNil)
+	c.Check(auditInfo.Attested.SessionAudit.SessionDigest, DeepEquals, digest)
+}
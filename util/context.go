@@ -0,0 +1,68 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+// ValidateContextBlob performs some basic sanity checks on the cleartext parts of the supplied
+// saved context, which is useful before passing a context obtained from untrusted storage to
+// [tpm2.TPMContext.ContextLoad]. It checks that:
+//   - the saved handle corresponds to a HMAC or policy session, or is one of the handles used
+//     by the TPM for saved transient objects (0x80000000, 0x80000001 or 0x80000002).
+//   - the hierarchy is one of the owner, endorsement, platform or null hierarchies.
+//   - the blob contains an integrity digest with the size of a known digest algorithm,
+//     followed by a non-empty encrypted portion.
+//
+// This does not verify the integrity of the context, which can only be done by the TPM, so
+// a context that passes these checks might still be rejected by [tpm2.TPMContext.ContextLoad].
+func ValidateContextBlob(c *tpm2.Context) error {
+	if c == nil {
+		return errors.New("no context")
+	}
+
+	switch c.SavedHandle.Type() {
+	case tpm2.HandleTypeHMACSession, tpm2.HandleTypePolicySession:
+		// ok
+	case tpm2.HandleTypeTransient:
+		switch c.SavedHandle {
+		case 0x80000000, 0x80000001, 0x80000002:
+			// ok
+		default:
+			return fmt.Errorf("invalid saved handle %v", c.SavedHandle)
+		}
+	default:
+		return fmt.Errorf("invalid saved handle %v", c.SavedHandle)
+	}
+
+	switch c.Hierarchy {
+	case tpm2.HandleOwner, tpm2.HandleEndorsement, tpm2.HandlePlatform, tpm2.HandleNull:
+		// ok
+	default:
+		return fmt.Errorf("invalid hierarchy %v", c.Hierarchy)
+	}
+
+	if len(c.Blob) < binary.Size(uint16(0)) {
+		return errors.New("blob is too short to contain an integrity digest")
+	}
+	integritySize := int(binary.BigEndian.Uint16(c.Blob))
+	switch integritySize {
+	case 20, 32, 48, 64:
+		// ok
+	default:
+		return fmt.Errorf("invalid integrity digest size %d", integritySize)
+	}
+	encryptedSize := len(c.Blob) - binary.Size(uint16(0)) - integritySize
+	if encryptedSize <= 0 {
+		return errors.New("blob is too short to contain any encrypted data")
+	}
+
+	return nil
+}
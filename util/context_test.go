@@ -0,0 +1,121 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/testutil"
+	. "github.com/canonical/go-tpm2/util"
+)
+
+type contextSuiteNoTPM struct{}
+
+var _ = Suite(&contextSuiteNoTPM{})
+
+func (s *contextSuiteNoTPM) newContext() *tpm2.Context {
+	blob := append([]byte{0x00, 0x20}, make([]byte, 32)...)
+	blob = append(blob, make([]byte, 64)...)
+	return &tpm2.Context{
+		Sequence:    5,
+		SavedHandle: 0x80000000,
+		Hierarchy:   tpm2.HandleOwner,
+		Blob:        blob}
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlob(c *C) {
+	c.Check(ValidateContextBlob(s.newContext()), IsNil)
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlobSession(c *C) {
+	context := s.newContext()
+	context.SavedHandle = 0x02000001
+	context.Hierarchy = tpm2.HandleNull
+	c.Check(ValidateContextBlob(context), IsNil)
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlobNil(c *C) {
+	c.Check(ValidateContextBlob(nil), ErrorMatches, `no context`)
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlobZeroSequence(c *C) {
+	context := s.newContext()
+	context.Sequence = 0
+	c.Check(ValidateContextBlob(context), IsNil)
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlobInvalidTransientHandle(c *C) {
+	context := s.newContext()
+	context.SavedHandle = 0x80000010
+	c.Check(ValidateContextBlob(context), ErrorMatches, `invalid saved handle 0x80000010`)
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlobInvalidHandleType(c *C) {
+	context := s.newContext()
+	context.SavedHandle = 0x81000001
+	c.Check(ValidateContextBlob(context), ErrorMatches, `invalid saved handle 0x81000001`)
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlobInvalidHierarchy(c *C) {
+	context := s.newContext()
+	context.Hierarchy = tpm2.HandleLockout
+	c.Check(ValidateContextBlob(context), ErrorMatches, `invalid hierarchy TPM_RH_LOCKOUT`)
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlobEmpty(c *C) {
+	context := s.newContext()
+	context.Blob = nil
+	c.Check(ValidateContextBlob(context), ErrorMatches, `blob is too short to contain an integrity digest`)
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlobInvalidIntegritySize(c *C) {
+	context := s.newContext()
+	context.Blob[1] = 0x21
+	c.Check(ValidateContextBlob(context), ErrorMatches, `invalid integrity digest size 33`)
+}
+
+func (s *contextSuiteNoTPM) TestValidateContextBlobTruncated(c *C) {
+	context := s.newContext()
+	context.Blob = context.Blob[:34]
+	c.Check(ValidateContextBlob(context), ErrorMatches, `blob is too short to contain any encrypted data`)
+}
+
+type contextSuite struct {
+	testutil.TPMTest
+}
+
+func (s *contextSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&contextSuite{})
+
+func (s *contextSuite) TestValidateContextBlobObject(c *C) {
+	object := s.CreateStoragePrimaryKeyRSA(c)
+
+	context, err := s.TPM.ContextSave(object)
+	c.Assert(err, IsNil)
+	c.Check(ValidateContextBlob(context), IsNil)
+}
+
+func (s *contextSuite) TestValidateContextBlobSession(c *C) {
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypeHMAC, nil, tpm2.HashAlgorithmSHA256)
+
+	context, err := s.TPM.ContextSave(session)
+	c.Assert(err, IsNil)
+	c.Check(ValidateContextBlob(context), IsNil)
+}
+
+func (s *contextSuite) TestValidateContextBlobCorrupted(c *C) {
+	object := s.CreateStoragePrimaryKeyRSA(c)
+
+	context, err := s.TPM.ContextSave(object)
+	c.Assert(err, IsNil)
+
+	// Corrupt the size of the integrity digest.
+	context.Blob[0] ^= 0xff
+	c.Check(ValidateContextBlob(context), ErrorMatches, `invalid integrity digest size [[:digit:]]+`)
+}
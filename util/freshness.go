@@ -0,0 +1,136 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+const freshnessNonceSize = 32
+
+var (
+	// ErrTPMResetSinceFreshnessToken is returned from FreshnessToken.VerifyAgainst
+	// if the TPM has been reset (ie, the host has rebooted) since the token was
+	// created. This is a legitimate event that invalidates the token.
+	ErrTPMResetSinceFreshnessToken = errors.New("the TPM has been reset since the freshness token was created")
+
+	// ErrTPMRestartSinceFreshnessToken is returned from FreshnessToken.VerifyAgainst
+	// if the TPM has been restarted or resumed (ie, the host has resumed from a
+	// suspend) since the token was created. This is a legitimate event that
+	// invalidates the token.
+	ErrTPMRestartSinceFreshnessToken = errors.New("the TPM has been restarted since the freshness token was created")
+)
+
+// FreshnessTokenError is returned from FreshnessToken.VerifyAgainst if the supplied
+// attestation is inconsistent with the token in a way that can't be explained by a
+// legitimate event, such as a TPM reset or restart.
+type FreshnessTokenError struct {
+	msg string
+}
+
+func (e *FreshnessTokenError) Error() string {
+	return "inconsistent attestation: " + e.msg
+}
+
+// FreshnessToken is used as part of a challenge-response freshness scheme that
+// can be checked against a subsequent attestation obtained from the TPM with
+// [tpm2.TPMContext.GetTime]. It can be serialized with
+// [github.com/canonical/go-tpm2/mu].
+type FreshnessToken struct {
+	Nonce tpm2.Data     // A random nonce, which should be supplied as the qualifying data to TPM2_GetTime
+	Time  tpm2.TimeInfo // The time information read from the TPM when the token was created
+}
+
+// NewFreshnessToken creates a new freshness token from the current time information
+// read from the TPM and a random nonce.
+//
+// The nonce should be supplied as the qualifyingData argument to
+// [tpm2.TPMContext.GetTime] when obtaining the attestation that is going to be checked
+// with [FreshnessToken.VerifyAgainst].
+func NewFreshnessToken(tpm *tpm2.TPMContext) (*FreshnessToken, error) {
+	nonce := make(tpm2.Data, freshnessNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot obtain nonce: %w", err)
+	}
+
+	time, err := tpm.ReadClock()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read clock: %w", err)
+	}
+
+	return &FreshnessToken{
+		Nonce: nonce,
+		Time:  *time,
+	}, nil
+}
+
+// VerifyAgainst checks that the supplied attestation, which should be obtained from
+// [tpm2.TPMContext.GetTime] with the nonce associated with this token supplied as the
+// qualifying data, is consistent with this token. Note that this does not verify the
+// signature of the attestation, which the caller must do separately.
+//
+// The reset and restart counts are only meaningful if the attestation is signed by a
+// key in the endorsement or platform hierarchy, as the TPM obfuscates these for keys
+// in other hierarchies.
+//
+// If the TPM has been reset since this token was created, a
+// [ErrTPMResetSinceFreshnessToken] error is returned. If the TPM has been restarted
+// or resumed since this token was created, a [ErrTPMRestartSinceFreshnessToken] error
+// is returned. If the attestation is inconsistent with this token in any other way,
+// such as the clock having gone backwards, the reset count or restart count having
+// decreased, or the nonce not matching, a *[FreshnessTokenError] error is returned.
+func (t *FreshnessToken) VerifyAgainst(attest *tpm2.Attest) error {
+	if attest == nil {
+		return errors.New("no attestation")
+	}
+	if attest.Magic != tpm2.TPMGeneratedValue {
+		return &FreshnessTokenError{"not generated by a TPM"}
+	}
+	if attest.Type != tpm2.TagAttestTime || attest.Attested == nil || attest.Attested.Time == nil {
+		return &FreshnessTokenError{"not a time attestation"}
+	}
+	if !bytes.Equal(attest.ExtraData, t.Nonce) {
+		return &FreshnessTokenError{"nonce mismatch"}
+	}
+
+	clockInfo := attest.ClockInfo
+	timeInfo := attest.Attested.Time.Time
+	if timeInfo.ClockInfo != clockInfo {
+		return &FreshnessTokenError{"clock info in attested time info doesn't match clock info in attestation"}
+	}
+
+	switch {
+	case clockInfo.ResetCount < t.Time.ClockInfo.ResetCount:
+		return &FreshnessTokenError{"reset count has decreased"}
+	case clockInfo.ResetCount > t.Time.ClockInfo.ResetCount:
+		// The clock value may legitimately go backwards across a TPM reset if
+		// the previous shutdown wasn't orderly, so don't check it here.
+		return ErrTPMResetSinceFreshnessToken
+	}
+
+	switch {
+	case clockInfo.RestartCount < t.Time.ClockInfo.RestartCount:
+		return &FreshnessTokenError{"restart count has decreased without a TPM reset"}
+	case clockInfo.RestartCount > t.Time.ClockInfo.RestartCount:
+		if clockInfo.Clock < t.Time.ClockInfo.Clock {
+			return &FreshnessTokenError{"clock has gone backwards"}
+		}
+		return ErrTPMRestartSinceFreshnessToken
+	}
+
+	if clockInfo.Clock < t.Time.ClockInfo.Clock {
+		return &FreshnessTokenError{"clock has gone backwards"}
+	}
+	if timeInfo.Time < t.Time.Time {
+		return &FreshnessTokenError{"time has gone backwards without a TPM reset or restart"}
+	}
+
+	return nil
+}
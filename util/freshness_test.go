@@ -0,0 +1,160 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/testutil"
+	. "github.com/canonical/go-tpm2/util"
+)
+
+type freshnessSuiteNoTPM struct{}
+
+var _ = Suite(&freshnessSuiteNoTPM{})
+
+func (s *freshnessSuiteNoTPM) newToken() *FreshnessToken {
+	return &FreshnessToken{
+		Nonce: []byte("0123456789abcdef0123456789abcdef"),
+		Time: tpm2.TimeInfo{
+			Time: 10000,
+			ClockInfo: tpm2.ClockInfo{
+				Clock:        500000,
+				ResetCount:   5,
+				RestartCount: 2,
+				Safe:         true}}}
+}
+
+func (s *freshnessSuiteNoTPM) newAttest(nonce tpm2.Data, time tpm2.TimeInfo) *tpm2.Attest {
+	return &tpm2.Attest{
+		Magic:     tpm2.TPMGeneratedValue,
+		Type:      tpm2.TagAttestTime,
+		ExtraData: nonce,
+		ClockInfo: time.ClockInfo,
+		Attested: &tpm2.AttestU{
+			Time: &tpm2.TimeAttestInfo{Time: time}}}
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstGood(c *C) {
+	token := s.newToken()
+	time := token.Time
+	time.Time += 2000
+	time.ClockInfo.Clock += 2000
+	c.Check(token.VerifyAgainst(s.newAttest(token.Nonce, time)), IsNil)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstNonceMismatch(c *C) {
+	token := s.newToken()
+	time := token.Time
+	time.Time += 2000
+	time.ClockInfo.Clock += 2000
+	err := token.VerifyAgainst(s.newAttest([]byte("foo"), time))
+	c.Check(err, ErrorMatches, `inconsistent attestation: nonce mismatch`)
+	var e *FreshnessTokenError
+	c.Check(err, internal_testutil.ErrorAs, &e)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstWrongType(c *C) {
+	token := s.newToken()
+	attest := s.newAttest(token.Nonce, token.Time)
+	attest.Type = tpm2.TagAttestQuote
+	c.Check(token.VerifyAgainst(attest), ErrorMatches, `inconsistent attestation: not a time attestation`)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstInvalidMagic(c *C) {
+	token := s.newToken()
+	attest := s.newAttest(token.Nonce, token.Time)
+	attest.Magic = 0
+	c.Check(token.VerifyAgainst(attest), ErrorMatches, `inconsistent attestation: not generated by a TPM`)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstClockBackwards(c *C) {
+	token := s.newToken()
+	time := token.Time
+	time.Time += 2000
+	time.ClockInfo.Clock -= 1
+	c.Check(token.VerifyAgainst(s.newAttest(token.Nonce, time)), ErrorMatches, `inconsistent attestation: clock has gone backwards`)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstTimeBackwards(c *C) {
+	token := s.newToken()
+	time := token.Time
+	time.Time -= 1
+	time.ClockInfo.Clock += 2000
+	c.Check(token.VerifyAgainst(s.newAttest(token.Nonce, time)), ErrorMatches, `inconsistent attestation: time has gone backwards without a TPM reset or restart`)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstReset(c *C) {
+	token := s.newToken()
+	time := tpm2.TimeInfo{
+		Time: 100,
+		ClockInfo: tpm2.ClockInfo{
+			Clock:        490000,
+			ResetCount:   6,
+			RestartCount: 0,
+			Safe:         false}}
+	c.Check(token.VerifyAgainst(s.newAttest(token.Nonce, time)), Equals, ErrTPMResetSinceFreshnessToken)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstResetCountDecreased(c *C) {
+	token := s.newToken()
+	time := token.Time
+	time.Time += 2000
+	time.ClockInfo.Clock += 2000
+	time.ClockInfo.ResetCount -= 1
+	c.Check(token.VerifyAgainst(s.newAttest(token.Nonce, time)), ErrorMatches, `inconsistent attestation: reset count has decreased`)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstRestart(c *C) {
+	token := s.newToken()
+	time := token.Time
+	time.Time = 100
+	time.ClockInfo.Clock += 2000
+	time.ClockInfo.RestartCount += 1
+	c.Check(token.VerifyAgainst(s.newAttest(token.Nonce, time)), Equals, ErrTPMRestartSinceFreshnessToken)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstRestartCountDecreased(c *C) {
+	token := s.newToken()
+	time := token.Time
+	time.Time += 2000
+	time.ClockInfo.Clock += 2000
+	time.ClockInfo.RestartCount -= 1
+	c.Check(token.VerifyAgainst(s.newAttest(token.Nonce, time)), ErrorMatches, `inconsistent attestation: restart count has decreased without a TPM reset`)
+}
+
+func (s *freshnessSuiteNoTPM) TestVerifyAgainstInconsistentClockInfo(c *C) {
+	token := s.newToken()
+	time := token.Time
+	time.Time += 2000
+	time.ClockInfo.Clock += 2000
+	attest := s.newAttest(token.Nonce, time)
+	attest.ClockInfo.Clock += 1
+	c.Check(token.VerifyAgainst(attest), ErrorMatches, `inconsistent attestation: clock info in attested time info doesn't match clock info in attestation`)
+}
+
+type freshnessSuite struct {
+	testutil.TPMTest
+}
+
+func (s *freshnessSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureEndorsementHierarchy
+}
+
+var _ = Suite(&freshnessSuite{})
+
+func (s *freshnessSuite) TestNewFreshnessTokenAndVerify(c *C) {
+	token, err := NewFreshnessToken(s.TPM)
+	c.Assert(err, IsNil)
+	c.Check(token.Nonce, internal_testutil.LenEquals, 32)
+
+	key := s.CreatePrimary(c, tpm2.HandleEndorsement, testutil.NewRestrictedRSASigningKeyTemplate(nil))
+	attest, _, err := s.TPM.GetTime(s.TPM.EndorsementHandleContext(), key, token.Nonce, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(token.VerifyAgainst(attest), IsNil)
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+// decodeKeyFilePublic decodes the public area at the start of the supplied data, which
+// may be either a TPM2B_PUBLIC or a TPMT_PUBLIC structure, and returns the remaining data.
+func decodeKeyFilePublic(data []byte) (*tpm2.Public, []byte, error) {
+	// Try a TPM2B_PUBLIC first, which is what tpm2_create -u emits. The size field
+	// is never a valid object type, so there's no ambiguity as long as the size field
+	// matches the size of the enclosed structure.
+	if len(data) >= binary.Size(uint16(0)) {
+		size := int(binary.BigEndian.Uint16(data))
+		if size > 0 && len(data) >= size+2 {
+			var pub tpm2.Public
+			if n, err := mu.UnmarshalFromBytes(data[2:size+2], &pub); err == nil && n == size {
+				return &pub, data[size+2:], nil
+			}
+		}
+	}
+
+	// Fall back to a TPMT_PUBLIC, which is what some other tools emit.
+	var pub tpm2.Public
+	n, err := mu.UnmarshalFromBytes(data, &pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &pub, data[n:], nil
+}
+
+// LoadKeyFile decodes the supplied key file, which consists of a public area followed
+// by a private area, as emitted by tools such as tpm2-tools (by concatenating the files
+// written by the -u and -r options of tpm2_create) and go-tpm. The returned public and
+// private areas are suitable for passing to [tpm2.TPMContext.Load] or for use with
+// policyutil.TransientResource. The name of the object is also returned.
+//
+// The public area can either be a TPM2B_PUBLIC or a TPMT_PUBLIC structure. The private
+// area can either be a TPM2B_PRIVATE structure or the contents of one, in which case it
+// must extend to the end of the supplied data.
+func LoadKeyFile(data []byte) (public *tpm2.Public, private tpm2.Private, name tpm2.Name, err error) {
+	public, rest, err := decodeKeyFilePublic(data)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cannot decode public area: %w", err)
+	}
+	name, err = public.ComputeName()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cannot compute name: %w", err)
+	}
+
+	switch {
+	case len(rest) == 0:
+		return nil, nil, nil, errors.New("no private area")
+	case len(rest) >= 2 && int(binary.BigEndian.Uint16(rest)) == len(rest)-2:
+		// TPM2B_PRIVATE
+		private = rest[2:]
+	default:
+		// The contents of a TPM2B_PRIVATE without the size field.
+		private = rest
+	}
+
+	return public, append(tpm2.Private{}, private...), name, nil
+}
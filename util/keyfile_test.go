@@ -0,0 +1,155 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/testutil"
+	. "github.com/canonical/go-tpm2/util"
+)
+
+type keyFileSuiteNoTPM struct{}
+
+var _ = Suite(&keyFileSuiteNoTPM{})
+
+func (s *keyFileSuiteNoTPM) newPublic() *tpm2.Public {
+	return objectutil.NewSealedObjectTemplate(objectutil.WithAuthPolicy(make(tpm2.Digest, 32)))
+}
+
+func (s *keyFileSuiteNoTPM) privateData() tpm2.Private {
+	// The contents of a TPM2B_PRIVATE start with the integrity HMAC.
+	return append(mu.MustMarshalToBytes(make(tpm2.Digest, 32)), bytes.Repeat([]byte{0xa5}, 64)...)
+}
+
+type testLoadKeyFileData struct {
+	data            []byte
+	expectedPublic  *tpm2.Public
+	expectedPrivate tpm2.Private
+}
+
+func (s *keyFileSuiteNoTPM) testLoadKeyFile(c *C, data *testLoadKeyFileData) {
+	public, private, name, err := LoadKeyFile(data.data)
+	c.Assert(err, IsNil)
+	c.Check(public, testutil.TPMValueDeepEquals, data.expectedPublic)
+	c.Check(private, DeepEquals, data.expectedPrivate)
+	c.Check(name, DeepEquals, data.expectedPublic.Name())
+}
+
+func (s *keyFileSuiteNoTPM) TestLoadKeyFileSizedPublicSizedPrivate(c *C) {
+	// This is the format produced by concatenating the files created by
+	// tpm2_create -u and -r.
+	pub := s.newPublic()
+	priv := s.privateData()
+	s.testLoadKeyFile(c, &testLoadKeyFileData{
+		data:            mu.MustMarshalToBytes(mu.Sized(pub), priv),
+		expectedPublic:  pub,
+		expectedPrivate: priv})
+}
+
+func (s *keyFileSuiteNoTPM) TestLoadKeyFilePublicSizedPrivate(c *C) {
+	pub := s.newPublic()
+	priv := s.privateData()
+	s.testLoadKeyFile(c, &testLoadKeyFileData{
+		data:            mu.MustMarshalToBytes(pub, priv),
+		expectedPublic:  pub,
+		expectedPrivate: priv})
+}
+
+func (s *keyFileSuiteNoTPM) TestLoadKeyFileSizedPublicRawPrivate(c *C) {
+	pub := s.newPublic()
+	priv := s.privateData()
+	s.testLoadKeyFile(c, &testLoadKeyFileData{
+		data:            mu.MustMarshalToBytes(mu.Sized(pub), mu.RawBytes(priv)),
+		expectedPublic:  pub,
+		expectedPrivate: priv})
+}
+
+func (s *keyFileSuiteNoTPM) TestLoadKeyFilePublicRawPrivate(c *C) {
+	pub := s.newPublic()
+	priv := s.privateData()
+	s.testLoadKeyFile(c, &testLoadKeyFileData{
+		data:            mu.MustMarshalToBytes(pub, mu.RawBytes(priv)),
+		expectedPublic:  pub,
+		expectedPrivate: priv})
+}
+
+func (s *keyFileSuiteNoTPM) TestLoadKeyFileNoPrivate(c *C) {
+	_, _, _, err := LoadKeyFile(mu.MustMarshalToBytes(mu.Sized(s.newPublic())))
+	c.Check(err, ErrorMatches, `no private area`)
+}
+
+func (s *keyFileSuiteNoTPM) TestLoadKeyFileInvalidPublic(c *C) {
+	_, _, _, err := LoadKeyFile([]byte{0x00, 0x04, 0x00, 0x08, 0x00, 0x0b})
+	c.Check(err, ErrorMatches, `cannot decode public area: cannot unmarshal argument 0 whilst processing element of type tpm2.ObjectAttributes: unexpected EOF
+
+=== BEGIN STACK ===
+... tpm2.Public field Attrs
+=== END STACK ===
+`)
+}
+
+func (s *keyFileSuiteNoTPM) TestLoadKeyFileTPM2ToolsLayout(c *C) {
+	// testdata/sealed.pub and testdata/sealed.priv are NOT captured from tpm2-tools.
+	// They were constructed by hand to have the layout of the files written by
+	// "tpm2_create -u sealed.pub -r sealed.priv -i-" for a sealed object with the
+	// default tpm2-tools attributes (fixedtpm|fixedparent|userwithauth), and the
+	// private area is not a valid encrypted blob. They should be replaced with files
+	// written by tpm2-tools, along with the version of tpm2-tools that was used.
+	pubData, err := os.ReadFile(filepath.Join("testdata", "sealed.pub"))
+	c.Assert(err, IsNil)
+	privData, err := os.ReadFile(filepath.Join("testdata", "sealed.priv"))
+	c.Assert(err, IsNil)
+
+	public, private, name, err := LoadKeyFile(append(pubData, privData...))
+	c.Assert(err, IsNil)
+	c.Check(public.Type, Equals, tpm2.ObjectTypeKeyedHash)
+	c.Check(public.NameAlg, Equals, tpm2.HashAlgorithmSHA256)
+	c.Check(public.Attrs, Equals, tpm2.AttrFixedTPM|tpm2.AttrFixedParent|tpm2.AttrUserWithAuth)
+	c.Check(public.Params.KeyedHashDetail.Scheme.Scheme, Equals, tpm2.KeyedHashSchemeNull)
+	c.Check(private, DeepEquals, tpm2.Private(privData[2:]))
+	c.Check(name, DeepEquals, tpm2.Name(internal_testutil.DecodeHexString(c, "000b928e62b2f3c5d5f91c683cfa4cc346c8ebd82310cc06d0d40c26f058ae977cdc")))
+}
+
+type keyFileSuite struct {
+	testutil.TPMTest
+}
+
+func (s *keyFileSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&keyFileSuite{})
+
+func (s *keyFileSuite) TestLoadKeyFileAndLoad(c *C) {
+	parent := s.CreateStoragePrimaryKeyRSA(c)
+
+	sensitive := &tpm2.SensitiveCreate{Data: []byte("secret")}
+	priv, pub, _, _, _, err := s.TPM.Create(parent, sensitive, objectutil.NewSealedObjectTemplate(), nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	// Lay the object out in the same way as the files produced by tpm2_create.
+	data := mu.MustMarshalToBytes(mu.Sized(pub), priv)
+
+	public, private, name, err := LoadKeyFile(data)
+	c.Assert(err, IsNil)
+	c.Check(name, DeepEquals, pub.Name())
+
+	object, err := s.TPM.Load(parent, private, public, nil)
+	c.Assert(err, IsNil)
+	c.Check(object.Name(), DeepEquals, name)
+
+	recovered, err := s.TPM.Unseal(object, nil)
+	c.Check(err, IsNil)
+	c.Check(recovered, DeepEquals, tpm2.SensitiveData("secret"))
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/policyutil"
+)
+
+// VerifyNVPolicy determines whether the supplied NV index contains the digest of the
+// expected policy for the specified algorithm, in the form used by TPM2_PolicyAuthorizeNV
+// (a TPMT_HA structure). If the expected policy doesn't already have a digest for the
+// specified algorithm, one is computed without modifying the supplied policy.
+//
+// The index is read using the authorization required by its attributes - the index
+// itself is used if it has the [tpm2.AttrNVAuthRead] or [tpm2.AttrNVPolicyRead]
+// attributes, else the owner or platform hierarchy is used if it has the
+// [tpm2.AttrNVOwnerRead] or [tpm2.AttrNVPPRead] attributes. The auth session is used for
+// authorization of whichever of these is selected.
+//
+// This returns false if the index was read successfully but its contents don't match
+// the expected policy digest, including if the index doesn't contain a valid TPMT_HA
+// structure. An error is returned if the index can't be read.
+func VerifyNVPolicy(tpm *tpm2.TPMContext, nvIndex tpm2.ResourceContext, expected *policyutil.Policy, alg tpm2.HashAlgorithmId, auth tpm2.SessionContext) (bool, error) {
+	if expected == nil {
+		return false, errors.New("no expected policy")
+	}
+
+	expectedDigest, err := expected.Digest(alg)
+	switch {
+	case errors.Is(err, policyutil.ErrMissingDigest):
+		var policy *policyutil.Policy
+		if err := mu.CopyValue(&policy, expected); err != nil {
+			return false, fmt.Errorf("cannot make temporary copy of expected policy: %w", err)
+		}
+		expectedDigest, err = policy.AddDigest(alg)
+		if err != nil {
+			return false, fmt.Errorf("cannot compute expected policy digest: %w", err)
+		}
+	case err != nil:
+		return false, fmt.Errorf("cannot obtain expected policy digest: %w", err)
+	}
+
+	pub, _, err := tpm.NVReadPublic(nvIndex)
+	if err != nil {
+		return false, fmt.Errorf("cannot read public area of index: %w", err)
+	}
+
+	var authContext tpm2.ResourceContext
+	switch {
+	case pub.Attrs&(tpm2.AttrNVAuthRead|tpm2.AttrNVPolicyRead) != 0:
+		authContext = nvIndex
+	case pub.Attrs&tpm2.AttrNVOwnerRead != 0:
+		authContext = tpm.OwnerHandleContext()
+	case pub.Attrs&tpm2.AttrNVPPRead != 0:
+		authContext = tpm.PlatformHandleContext()
+	default:
+		return false, errors.New("invalid index read auth mode")
+	}
+
+	data, err := tpm.NVRead(authContext, nvIndex, pub.Size, 0, auth)
+	if err != nil {
+		return false, fmt.Errorf("cannot read index: %w", err)
+	}
+
+	var digest tpm2.TaggedHash
+	n, err := mu.UnmarshalFromBytes(data, &digest)
+	if err != nil || n != len(data) {
+		// The index doesn't contain a valid TPMT_HA.
+		return false, nil
+	}
+
+	return digest.HashAlg == alg && bytes.Equal(digest.Digest(), expectedDigest), nil
+}
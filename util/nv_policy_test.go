@@ -0,0 +1,156 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+	. "github.com/canonical/go-tpm2/util"
+)
+
+type nvPolicySuite struct {
+	testutil.TPMTest
+}
+
+func (s *nvPolicySuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy | testutil.TPMFeatureNV
+}
+
+var _ = Suite(&nvPolicySuite{})
+
+func (s *nvPolicySuite) newPolicy(c *C, code tpm2.CommandCode) (tpm2.Digest, *policyutil.Policy) {
+	builder := policyutil.NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyCommandCode(code)
+	digest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+	return digest, policy
+}
+
+type testVerifyNVPolicyData struct {
+	attrs    tpm2.NVAttributes
+	contents []byte
+	expected *policyutil.Policy
+	alg      tpm2.HashAlgorithmId
+	auth     tpm2.SessionContext
+
+	matches bool
+}
+
+func (s *nvPolicySuite) testVerifyNVPolicy(c *C, data *testVerifyNVPolicyData) {
+	index := s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVOwnerWrite | data.attrs | tpm2.AttrNVNoDA),
+		Size:    uint16(len(data.contents))})
+	c.Assert(s.TPM.NVWrite(s.TPM.OwnerHandleContext(), index, data.contents, 0, nil), IsNil)
+
+	matches, err := VerifyNVPolicy(s.TPM, index, data.expected, data.alg, data.auth)
+	c.Check(err, IsNil)
+	c.Check(matches, Equals, data.matches)
+}
+
+func (s *nvPolicySuite) TestVerifyNVPolicyMatchAuthRead(c *C) {
+	digest, policy := s.newPolicy(c, tpm2.CommandUnseal)
+	s.testVerifyNVPolicy(c, &testVerifyNVPolicyData{
+		attrs:    tpm2.AttrNVAuthRead,
+		contents: mu.MustMarshalToBytes(tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA256, digest)),
+		expected: policy,
+		alg:      tpm2.HashAlgorithmSHA256,
+		matches:  true})
+}
+
+func (s *nvPolicySuite) TestVerifyNVPolicyMatchOwnerRead(c *C) {
+	digest, policy := s.newPolicy(c, tpm2.CommandUnseal)
+	s.testVerifyNVPolicy(c, &testVerifyNVPolicyData{
+		attrs:    tpm2.AttrNVOwnerRead,
+		contents: mu.MustMarshalToBytes(tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA256, digest)),
+		expected: policy,
+		alg:      tpm2.HashAlgorithmSHA256,
+		matches:  true})
+	c.Check(s.LastCommand(c).CmdHandles[0], Equals, tpm2.HandleOwner)
+}
+
+func (s *nvPolicySuite) TestVerifyNVPolicyMatchWithSession(c *C) {
+	digest, policy := s.newPolicy(c, tpm2.CommandUnseal)
+	s.testVerifyNVPolicy(c, &testVerifyNVPolicyData{
+		attrs:    tpm2.AttrNVAuthRead,
+		contents: mu.MustMarshalToBytes(tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA256, digest)),
+		expected: policy,
+		alg:      tpm2.HashAlgorithmSHA256,
+		auth:     s.StartAuthSession(c, nil, nil, tpm2.SessionTypeHMAC, nil, tpm2.HashAlgorithmSHA256),
+		matches:  true})
+}
+
+func (s *nvPolicySuite) TestVerifyNVPolicyMatchComputesDigest(c *C) {
+	_, policy := s.newPolicy(c, tpm2.CommandUnseal)
+
+	builder := policyutil.NewPolicyBuilder(tpm2.HashAlgorithmSHA1)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	digest, err := builder.Digest()
+	c.Assert(err, IsNil)
+
+	s.testVerifyNVPolicy(c, &testVerifyNVPolicyData{
+		attrs:    tpm2.AttrNVAuthRead,
+		contents: mu.MustMarshalToBytes(tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA1, digest)),
+		expected: policy,
+		alg:      tpm2.HashAlgorithmSHA1,
+		matches:  true})
+
+	// The supplied policy should not have been modified.
+	_, err = policy.Digest(tpm2.HashAlgorithmSHA1)
+	c.Check(err, Equals, policyutil.ErrMissingDigest)
+}
+
+func (s *nvPolicySuite) TestVerifyNVPolicyMismatch(c *C) {
+	digest, _ := s.newPolicy(c, tpm2.CommandNVRead)
+	_, policy := s.newPolicy(c, tpm2.CommandUnseal)
+	s.testVerifyNVPolicy(c, &testVerifyNVPolicyData{
+		attrs:    tpm2.AttrNVAuthRead,
+		contents: mu.MustMarshalToBytes(tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA256, digest)),
+		expected: policy,
+		alg:      tpm2.HashAlgorithmSHA256,
+		matches:  false})
+}
+
+func (s *nvPolicySuite) TestVerifyNVPolicyMismatchAlg(c *C) {
+	digest, policy := s.newPolicy(c, tpm2.CommandUnseal)
+	s.testVerifyNVPolicy(c, &testVerifyNVPolicyData{
+		attrs:    tpm2.AttrNVAuthRead,
+		contents: mu.MustMarshalToBytes(tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA256, digest)),
+		expected: policy,
+		alg:      tpm2.HashAlgorithmSHA1,
+		matches:  false})
+}
+
+func (s *nvPolicySuite) TestVerifyNVPolicyMismatchInvalidContents(c *C) {
+	_, policy := s.newPolicy(c, tpm2.CommandUnseal)
+	s.testVerifyNVPolicy(c, &testVerifyNVPolicyData{
+		attrs:    tpm2.AttrNVAuthRead,
+		contents: []byte{0xff, 0xff, 0x00, 0x00},
+		expected: policy,
+		alg:      tpm2.HashAlgorithmSHA256,
+		matches:  false})
+}
+
+func (s *nvPolicySuite) TestVerifyNVPolicyReadError(c *C) {
+	_, policy := s.newPolicy(c, tpm2.CommandUnseal)
+
+	index := s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   s.NextAvailableHandle(c, 0x0181f000),
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVNoDA),
+		Size:    34})
+
+	// The index hasn't been written.
+	matches, err := VerifyNVPolicy(s.TPM, index, policy, tpm2.HashAlgorithmSHA256, nil)
+	c.Check(err, ErrorMatches, `cannot read index: TPM returned an error whilst executing command TPM_CC_NV_Read: TPM_RC_NV_UNINITIALIZED \(.*\)`)
+	c.Check(tpm2.IsTPMError(err, tpm2.ErrorNVUninitialized, tpm2.CommandNVRead), internal_testutil.IsTrue)
+	c.Check(matches, internal_testutil.IsFalse)
+}
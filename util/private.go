@@ -0,0 +1,202 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/canonical/go-tpm2"
+	internal_util "github.com/canonical/go-tpm2/internal/util"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+var (
+	// ErrPrivateWrongParent is returned from PrivateMatchesPublic if the integrity
+	// check of the private area fails. This indicates that the private area is
+	// protected by a different parent, or that it has been modified.
+	ErrPrivateWrongParent = errors.New("private area is not protected by the supplied parent")
+
+	// ErrPrivateCorrupt is returned from PrivateMatchesPublic if the private area
+	// cannot be decoded.
+	ErrPrivateCorrupt = errors.New("private area is corrupt")
+
+	// ErrPublicPrivateMismatch is returned from PrivateMatchesPublic if the private
+	// area is valid but is not consistent with the supplied public area.
+	ErrPublicPrivateMismatch = errors.New("private area does not correspond to the public area")
+)
+
+func parentSymmetricAlg(parent *tpm2.Public) (*tpm2.SymDefObject, error) {
+	if !parent.IsStorageParent() {
+		return nil, errors.New("parent is not a storage parent")
+	}
+	if parent.Params == nil {
+		return nil, errors.New("parent has no parameters")
+	}
+	switch parent.Type {
+	case tpm2.ObjectTypeRSA:
+		if parent.Params.RSADetail == nil {
+			return nil, errors.New("parent has no RSA parameters")
+		}
+		return &parent.Params.RSADetail.Symmetric, nil
+	case tpm2.ObjectTypeECC:
+		if parent.Params.ECCDetail == nil {
+			return nil, errors.New("parent has no ECC parameters")
+		}
+		return &parent.Params.ECCDetail.Symmetric, nil
+	default:
+		if parent.Params.SymDetail == nil {
+			return nil, errors.New("parent has no symmetric parameters")
+		}
+		return &parent.Params.SymDetail.Sym, nil
+	}
+}
+
+func checkSensitiveMatchesPublic(public *tpm2.Public, sensitive *tpm2.Sensitive) error {
+	if sensitive.Type != public.Type {
+		return fmt.Errorf("mismatched types (public: %v, private: %v)", public.Type, sensitive.Type)
+	}
+	if len(sensitive.AuthValue) > public.NameAlg.Size() {
+		return errors.New("auth value is larger than the name algorithm digest size")
+	}
+	if public.IsStorageParent() && len(sensitive.SeedValue) != public.NameAlg.Size() {
+		return errors.New("invalid seed size for storage parent")
+	}
+	if public.Unique == nil {
+		return errors.New("public area has no unique field")
+	}
+	if sensitive.Sensitive == nil {
+		return errors.New("sensitive area has no sensitive data")
+	}
+
+	switch public.Type {
+	case tpm2.ObjectTypeRSA:
+		n := new(big.Int).SetBytes(public.Unique.RSA)
+		p := new(big.Int).SetBytes(sensitive.Sensitive.RSA)
+		if p.Cmp(big.NewInt(1)) <= 0 || p.Cmp(n) >= 0 || new(big.Int).Mod(n, p).Sign() != 0 {
+			return errors.New("private prime is not a factor of the public modulus")
+		}
+	case tpm2.ObjectTypeECC:
+		if public.Unique.ECC == nil {
+			return errors.New("public area has no ECC point")
+		}
+		curve := public.Params.ECCDetail.CurveID.GoCurve()
+		x, y := curve.ScalarBaseMult(sensitive.Sensitive.ECC)
+		if x.Cmp(new(big.Int).SetBytes(public.Unique.ECC.X)) != 0 || y.Cmp(new(big.Int).SetBytes(public.Unique.ECC.Y)) != 0 {
+			return errors.New("private scalar does not correspond to the public point")
+		}
+	case tpm2.ObjectTypeKeyedHash, tpm2.ObjectTypeSymCipher:
+		var data, unique []byte
+		if public.Type == tpm2.ObjectTypeKeyedHash {
+			data = sensitive.Sensitive.Bits
+			unique = public.Unique.KeyedHash
+		} else {
+			data = sensitive.Sensitive.Sym
+			unique = public.Unique.Sym
+		}
+		h := public.NameAlg.NewHash()
+		h.Write(sensitive.SeedValue)
+		h.Write(data)
+		if !bytes.Equal(h.Sum(nil), unique) {
+			return errors.New("digest of the sensitive data does not match the unique field")
+		}
+	}
+
+	return nil
+}
+
+// PrivateMatchesPublic determines whether the supplied private area corresponds to the
+// supplied public area, without having to load the object into the TPM. This is useful
+// for validating stored key blobs before attempting to load them with
+// [tpm2.TPMContext.Load], which is expensive and modifies TPM state.
+//
+// The private area is unwrapped using the name algorithm and symmetric algorithm of the
+// supplied parent, and the supplied parent seed, which is part of the parent's sensitive
+// area and will only be known for parents that were created outside of the TPM or that can
+// be duplicated. The name is the name of the object that the private area is associated
+// with. If it is nil, the name is computed from the supplied public area.
+//
+// On success, the type, auth value, seed and type specific sensitive data are checked for
+// consistency with the public area and nil is returned.
+//
+// If the supplied name does not match the public area or the unwrapped private area is
+// inconsistent with it, an error that wraps [ErrPublicPrivateMismatch] is returned. If the
+// integrity check of the private area fails, an error that wraps [ErrPrivateWrongParent] is
+// returned. As the name is covered by the integrity check, this may also indicate that the
+// private area belongs to a different object with the same parent. If the private area cannot
+// be decoded, an error that wraps [ErrPrivateCorrupt] is returned.
+func PrivateMatchesPublic(parent *tpm2.Public, parentSeed []byte, public *tpm2.Public, private tpm2.Private, name tpm2.Name) error {
+	if parent == nil {
+		return errors.New("no parent")
+	}
+	if public == nil {
+		return errors.New("no public area")
+	}
+	if !parent.NameAlg.Available() {
+		return fmt.Errorf("parent name algorithm %v is not available", parent.NameAlg)
+	}
+	symmetricAlg, err := parentSymmetricAlg(parent)
+	if err != nil {
+		return err
+	}
+	if !symmetricAlg.Algorithm.Available() {
+		return fmt.Errorf("parent symmetric algorithm %v is not available", symmetricAlg.Algorithm)
+	}
+
+	if !public.NameAlg.Available() {
+		return fmt.Errorf("name algorithm %v is not available", public.NameAlg)
+	}
+	if public.Params == nil {
+		return errors.New("public area has no parameters")
+	}
+	switch public.Type {
+	case tpm2.ObjectTypeRSA, tpm2.ObjectTypeKeyedHash, tpm2.ObjectTypeSymCipher:
+	case tpm2.ObjectTypeECC:
+		if public.Params.ECCDetail == nil {
+			return errors.New("public area has no ECC parameters")
+		}
+		if public.Params.ECCDetail.CurveID.GoCurve() == nil {
+			return fmt.Errorf("unsupported curve %v", public.Params.ECCDetail.CurveID)
+		}
+	default:
+		return fmt.Errorf("unsupported object type %v", public.Type)
+	}
+
+	publicName, err := public.ComputeName()
+	if err != nil {
+		return fmt.Errorf("cannot compute name of public area: %w", err)
+	}
+	switch {
+	case name == nil:
+		name = publicName
+	case !bytes.Equal(name, publicName):
+		return fmt.Errorf("%w: name does not match the public area", ErrPublicPrivateMismatch)
+	}
+
+	data, err := internal_util.UnwrapOuter(parent.NameAlg, symmetricAlg, name, parentSeed, true, private)
+	switch {
+	case errors.Is(err, internal_util.ErrInvalidIntegrity):
+		return ErrPrivateWrongParent
+	case err != nil:
+		return fmt.Errorf("%w: cannot unwrap outer wrapper: %v", ErrPrivateCorrupt, err)
+	}
+
+	var sensitive *tpm2.Sensitive
+	n, err := mu.UnmarshalFromBytes(data, mu.Sized(&sensitive))
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: cannot unmarshal sensitive area: %v", ErrPrivateCorrupt, err)
+	case n != len(data):
+		return fmt.Errorf("%w: trailing bytes after sensitive area", ErrPrivateCorrupt)
+	}
+
+	if err := checkSensitiveMatchesPublic(public, sensitive); err != nil {
+		return fmt.Errorf("%w: %v", ErrPublicPrivateMismatch, err)
+	}
+
+	return nil
+}
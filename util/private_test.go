@@ -0,0 +1,277 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/testutil"
+	. "github.com/canonical/go-tpm2/util"
+)
+
+type privateSuite struct {
+	parent     *tpm2.Public
+	parentSeed []byte
+}
+
+func (s *privateSuite) SetUpTest(c *C) {
+	s.parent = objectutil.NewRSAStorageKeyTemplate()
+	s.parentSeed = make([]byte, 32)
+	rand.Read(s.parentSeed)
+}
+
+var _ = Suite(&privateSuite{})
+
+func (s *privateSuite) wrap(c *C, sensitive *tpm2.Sensitive, name tpm2.Name, seed []byte) tpm2.Private {
+	private, err := testutil.SensitiveToPrivate(sensitive, name, s.parent.NameAlg, &s.parent.Params.RSADetail.Symmetric, seed)
+	c.Assert(err, IsNil)
+	return private
+}
+
+func (s *privateSuite) newSealedObject(c *C, data string) (*tpm2.Public, *tpm2.Sensitive) {
+	pub, sensitive, err := objectutil.NewSealedObject(rand.Reader, []byte(data), nil)
+	c.Assert(err, IsNil)
+	return pub, sensitive
+}
+
+func (s *privateSuite) TestSealedObject(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+	c.Check(PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil), IsNil)
+	c.Check(PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, pub.Name()), IsNil)
+}
+
+func (s *privateSuite) TestSymmetricKey(c *C) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	pub, sensitive, err := objectutil.NewSymmetricKey(rand.Reader, objectutil.UsageEncrypt, key, nil)
+	c.Assert(err, IsNil)
+
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+	c.Check(PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil), IsNil)
+}
+
+func (s *privateSuite) TestRSAKey(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewRSAPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	sensitive := &tpm2.Sensitive{
+		Type:      tpm2.ObjectTypeRSA,
+		Sensitive: &tpm2.SensitiveCompositeU{RSA: key.Primes[0].Bytes()}}
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+	c.Check(PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil), IsNil)
+}
+
+func (s *privateSuite) TestECCKey(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	sensitive := &tpm2.Sensitive{
+		Type:      tpm2.ObjectTypeECC,
+		Sensitive: &tpm2.SensitiveCompositeU{ECC: key.D.Bytes()}}
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+	c.Check(PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil), IsNil)
+}
+
+func (s *privateSuite) TestWrongParent(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+
+	seed := make([]byte, 32)
+	rand.Read(seed)
+	private := s.wrap(c, sensitive, pub.Name(), seed)
+
+	err := PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil)
+	c.Check(err, Equals, ErrPrivateWrongParent)
+}
+
+func (s *privateSuite) TestCorruptTruncated(c *C) {
+	err := PrivateMatchesPublic(s.parent, s.parentSeed, objectutil.NewSealedObjectTemplate(), tpm2.Private{0x00, 0x20, 0x01}, nil)
+	c.Check(err, ErrorMatches, `private area is corrupt: cannot unwrap outer wrapper: cannot unmarshal integrity digest: .*`)
+	c.Check(err, internal_testutil.ErrorIs, ErrPrivateCorrupt)
+}
+
+func (s *privateSuite) TestCorruptSensitive(c *C) {
+	pub, _ := s.newSealedObject(c, "foo")
+
+	// Wrap something that isn't a valid sensitive area with the correct
+	// parent, so that it passes the integrity check.
+	private, err := testutil.ProduceOuterWrap(s.parent.NameAlg, &s.parent.Params.RSADetail.Symmetric, pub.Name(), s.parentSeed, true, []byte{0x00, 0x10, 0x00})
+	c.Assert(err, IsNil)
+
+	err = PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil)
+	c.Check(err, ErrorMatches, `(?s)private area is corrupt: cannot unmarshal sensitive area: .*`)
+	c.Check(err, internal_testutil.ErrorIs, ErrPrivateCorrupt)
+}
+
+func (s *privateSuite) TestMismatchSensitiveData(c *C) {
+	pub, _ := s.newSealedObject(c, "foo")
+	_, sensitive := s.newSealedObject(c, "bar")
+
+	// Wrap the sensitive area from a different object with the name of the
+	// public area, so that it passes the integrity check.
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	err := PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil)
+	c.Check(err, ErrorMatches, `private area does not correspond to the public area: digest of the sensitive data does not match the unique field`)
+	c.Check(err, internal_testutil.ErrorIs, ErrPublicPrivateMismatch)
+}
+
+func (s *privateSuite) TestMismatchType(c *C) {
+	pub, _ := s.newSealedObject(c, "foo")
+	sensitive := &tpm2.Sensitive{
+		Type:      tpm2.ObjectTypeSymCipher,
+		Sensitive: &tpm2.SensitiveCompositeU{Sym: make(tpm2.SymKey, 16)}}
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	err := PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil)
+	c.Check(err, ErrorMatches, `private area does not correspond to the public area: mismatched types \(public: TPM_ALG_KEYEDHASH, private: TPM_ALG_SYMCIPHER\)`)
+	c.Check(err, internal_testutil.ErrorIs, ErrPublicPrivateMismatch)
+}
+
+func (s *privateSuite) TestMismatchRSAKey(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewRSAPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	sensitive := &tpm2.Sensitive{
+		Type:      tpm2.ObjectTypeRSA,
+		Sensitive: &tpm2.SensitiveCompositeU{RSA: new(big.Int).Add(key.Primes[0], big.NewInt(2)).Bytes()}}
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	err = PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil)
+	c.Check(err, ErrorMatches, `private area does not correspond to the public area: private prime is not a factor of the public modulus`)
+	c.Check(err, internal_testutil.ErrorIs, ErrPublicPrivateMismatch)
+}
+
+func (s *privateSuite) TestMismatchECCKey(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	sensitive := &tpm2.Sensitive{
+		Type:      tpm2.ObjectTypeECC,
+		Sensitive: &tpm2.SensitiveCompositeU{ECC: otherKey.D.Bytes()}}
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	err = PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil)
+	c.Check(err, ErrorMatches, `private area does not correspond to the public area: private scalar does not correspond to the public point`)
+	c.Check(err, internal_testutil.ErrorIs, ErrPublicPrivateMismatch)
+}
+
+func (s *privateSuite) TestMismatchName(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+	other, _ := s.newSealedObject(c, "bar")
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	err := PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, other.Name())
+	c.Check(err, ErrorMatches, `private area does not correspond to the public area: name does not match the public area`)
+	c.Check(err, internal_testutil.ErrorIs, ErrPublicPrivateMismatch)
+}
+
+func (s *privateSuite) TestInvalidParent(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	err := PrivateMatchesPublic(objectutil.NewRSAKeyTemplate(objectutil.UsageSign), s.parentSeed, pub, private, nil)
+	c.Check(err, ErrorMatches, `parent is not a storage parent`)
+}
+
+func (s *privateSuite) TestParentNoParams(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	s.parent.Params = nil
+	c.Check(PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil), ErrorMatches, `parent has no parameters`)
+}
+
+func (s *privateSuite) TestParentNoRSAParams(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	s.parent.Params.RSADetail = nil
+	c.Check(PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil), ErrorMatches, `parent has no RSA parameters`)
+}
+
+func (s *privateSuite) TestParentNoECCParams(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	parent := objectutil.NewECCStorageKeyTemplate()
+	parent.Params.ECCDetail = nil
+	c.Check(PrivateMatchesPublic(parent, s.parentSeed, pub, private, nil), ErrorMatches, `parent has no ECC parameters`)
+}
+
+func (s *privateSuite) TestParentNoSymmetricParams(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	parent := objectutil.NewSymmetricStorageKeyTemplate()
+	parent.Params.SymDetail = nil
+	c.Check(PrivateMatchesPublic(parent, s.parentSeed, pub, private, nil), ErrorMatches, `parent has no symmetric parameters`)
+}
+
+func (s *privateSuite) TestPublicNoParams(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	pub.Params = nil
+	c.Check(PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil), ErrorMatches, `public area has no parameters`)
+}
+
+func (s *privateSuite) TestPublicNoUnique(c *C) {
+	pub, sensitive := s.newSealedObject(c, "foo")
+	pub.Unique = nil
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	err := PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil)
+	c.Check(err, ErrorMatches, `private area does not correspond to the public area: public area has no unique field`)
+	c.Check(err, internal_testutil.ErrorIs, ErrPublicPrivateMismatch)
+}
+
+func (s *privateSuite) TestPublicNoECCParams(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	pub.Params.ECCDetail = nil
+	c.Check(PrivateMatchesPublic(s.parent, s.parentSeed, pub, nil, nil), ErrorMatches, `public area has no ECC parameters`)
+}
+
+func (s *privateSuite) TestPublicNoECCPoint(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	pub, err := objectutil.NewECCPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	pub.Unique.ECC = nil
+
+	sensitive := &tpm2.Sensitive{
+		Type:      tpm2.ObjectTypeECC,
+		Sensitive: &tpm2.SensitiveCompositeU{ECC: key.D.Bytes()}}
+	private := s.wrap(c, sensitive, pub.Name(), s.parentSeed)
+
+	err = PrivateMatchesPublic(s.parent, s.parentSeed, pub, private, nil)
+	c.Check(err, ErrorMatches, `private area does not correspond to the public area: public area has no ECC point`)
+	c.Check(err, internal_testutil.ErrorIs, ErrPublicPrivateMismatch)
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/policyutil"
+)
+
+// SealedObject bundles everything that is required to load and unseal a sealed object that
+// was created by [ProvisionSealedObject]. It can be serialized with the mu package.
+type SealedObject struct {
+	// Policy is the authorization policy for the sealed object. It contains a digest for
+	// the name algorithm of the sealed object, and can be passed to
+	// [policyutil.Policy.Execute] in order to authorize use of the object.
+	Policy *policyutil.Policy
+
+	// Public is the public area of the sealed object.
+	Public *tpm2.Public
+
+	// Private is the private area of the sealed object.
+	Private tpm2.Private
+}
+
+// ProvisionSealedObject seals the supplied data to the supplied authorization policy by
+// creating a sealed object that is protected by the supplied storage parent. The digest of
+// the policy for the specified name algorithm is computed if it has not been computed
+// already, and is installed as the authorization policy of the sealed object. The sealed
+// object has an empty auth value and can only be authorized with a policy session for both
+// the user and admin roles.
+//
+// The parentAuth session is used for authorization of the parent. On success, a bundle
+// containing the policy, the public area and the private area of the new object is returned.
+// The object can be loaded with [tpm2.TPMContext.Load] and unsealed with
+// [tpm2.TPMContext.Unseal] using a policy session that has been satisfied by executing the
+// returned policy. As computing the policy digest may update the supplied policy, the
+// returned bundle should be persisted in place of the supplied policy.
+func ProvisionSealedObject(tpm *tpm2.TPMContext, parent tpm2.ResourceContext, data []byte, policy *policyutil.Policy, nameAlg tpm2.HashAlgorithmId, parentAuth tpm2.SessionContext) (*SealedObject, error) {
+	if policy == nil {
+		return nil, errors.New("no policy")
+	}
+
+	digest, err := policy.Digest(nameAlg)
+	switch {
+	case errors.Is(err, policyutil.ErrMissingDigest):
+		digest, err = policy.AddDigest(nameAlg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compute policy digest: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("cannot obtain policy digest: %w", err)
+	}
+
+	template := objectutil.NewSealedObjectTemplate(
+		objectutil.WithNameAlg(nameAlg),
+		objectutil.WithUserAuthMode(objectutil.RequirePolicy),
+		objectutil.WithAdminAuthMode(objectutil.RequirePolicy),
+		objectutil.WithAuthPolicy(digest),
+	)
+	sensitive := &tpm2.SensitiveCreate{Data: data}
+
+	priv, pub, _, _, _, err := tpm.Create(parent, sensitive, template, nil, nil, parentAuth)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create sealed object: %w", err)
+	}
+
+	return &SealedObject{
+		Policy:  policy,
+		Public:  pub,
+		Private: priv,
+	}, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under the LGPLv3 with static-linking exception.
+// See LICENCE file for details.
+
+package util_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/go-tpm2"
+	internal_testutil "github.com/canonical/go-tpm2/internal/testutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/objectutil"
+	"github.com/canonical/go-tpm2/policyutil"
+	"github.com/canonical/go-tpm2/testutil"
+	. "github.com/canonical/go-tpm2/util"
+)
+
+type sealedSuiteNoTPM struct{}
+
+var _ = Suite(&sealedSuiteNoTPM{})
+
+func (s *sealedSuiteNoTPM) TestSealedObjectSerialization(c *C) {
+	builder := policyutil.NewPolicyBuilder(tpm2.HashAlgorithmSHA256)
+	builder.RootBranch().PolicyAuthValue()
+	digest, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	obj := &SealedObject{
+		Policy:  policy,
+		Public:  objectutil.NewSealedObjectTemplate(objectutil.WithAuthPolicy(digest)),
+		Private: tpm2.Private{1, 2, 3, 4},
+	}
+
+	b, err := mu.MarshalToBytes(obj)
+	c.Assert(err, IsNil)
+
+	var recovered *SealedObject
+	_, err = mu.UnmarshalFromBytes(b, &recovered)
+	c.Assert(err, IsNil)
+	c.Check(mu.DeepEqual(recovered, obj), internal_testutil.IsTrue)
+}
+
+type sealedSuite struct {
+	testutil.TPMTest
+}
+
+func (s *sealedSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = testutil.TPMFeatureOwnerHierarchy
+}
+
+var _ = Suite(&sealedSuite{})
+
+type testProvisionSealedObjectData struct {
+	builderAlg tpm2.HashAlgorithmId
+	nameAlg    tpm2.HashAlgorithmId
+}
+
+func (s *sealedSuite) testProvisionSealedObject(c *C, data *testProvisionSealedObjectData) {
+	parent := s.CreateStoragePrimaryKeyRSA(c)
+
+	builder := policyutil.NewPolicyBuilder(data.builderAlg)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	builder.RootBranch().PolicyAuthValue()
+	_, policy, err := builder.Policy()
+	c.Assert(err, IsNil)
+
+	builder = policyutil.NewPolicyBuilder(data.nameAlg)
+	builder.RootBranch().PolicyCommandCode(tpm2.CommandUnseal)
+	builder.RootBranch().PolicyAuthValue()
+	expectedDigest, err := builder.Digest()
+	c.Assert(err, IsNil)
+
+	obj, err := ProvisionSealedObject(s.TPM, parent, []byte("secret"), policy, data.nameAlg, nil)
+	c.Assert(err, IsNil)
+	c.Check(obj.Policy, Equals, policy)
+	c.Check(obj.Public.NameAlg, Equals, data.nameAlg)
+	c.Check(obj.Public.AuthPolicy, DeepEquals, expectedDigest)
+	c.Check(obj.Public.Attrs&(tpm2.AttrUserWithAuth|tpm2.AttrAdminWithPolicy), Equals, tpm2.AttrAdminWithPolicy)
+
+	// Round-trip the bundle through its serialized form.
+	b, err := mu.MarshalToBytes(obj)
+	c.Assert(err, IsNil)
+	var recovered *SealedObject
+	_, err = mu.UnmarshalFromBytes(b, &recovered)
+	c.Assert(err, IsNil)
+
+	object, err := s.TPM.Load(parent, recovered.Private, recovered.Public, nil)
+	c.Assert(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, data.nameAlg)
+	_, err = recovered.Policy.Execute(policyutil.NewTPMPolicySession(s.TPM, session), nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	unsealed, err := s.TPM.Unseal(object, session)
+	c.Check(err, IsNil)
+	c.Check(unsealed, DeepEquals, tpm2.SensitiveData("secret"))
+}
+
+func (s *sealedSuite) TestProvisionSealedObject(c *C) {
+	s.testProvisionSealedObject(c, &testProvisionSealedObjectData{
+		builderAlg: tpm2.HashAlgorithmSHA256,
+		nameAlg:    tpm2.HashAlgorithmSHA256,
+	})
+}
+
+func (s *sealedSuite) TestProvisionSealedObjectSHA1(c *C) {
+	s.testProvisionSealedObject(c, &testProvisionSealedObjectData{
+		builderAlg: tpm2.HashAlgorithmSHA1,
+		nameAlg:    tpm2.HashAlgorithmSHA1,
+	})
+}
+
+func (s *sealedSuite) TestProvisionSealedObjectComputesDigest(c *C) {
+	// The policy doesn't have a digest for the name algorithm of the sealed
+	// object, so one should be computed.
+	s.testProvisionSealedObject(c, &testProvisionSealedObjectData{
+		builderAlg: tpm2.HashAlgorithmSHA1,
+		nameAlg:    tpm2.HashAlgorithmSHA256,
+	})
+}
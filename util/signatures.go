@@ -7,11 +7,13 @@ package util
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/cryptutil"
@@ -81,6 +83,87 @@ func VerifySignature(key crypto.PublicKey, digest []byte, signature *tpm2.Signat
 	return cryptutil.VerifySignature(key, digest, signature)
 }
 
+// SignatureVerifyOptions provides options for [VerifySignatureWithOptions] and
+// [VerifyAttestationSignatureWithOptions].
+type SignatureVerifyOptions struct {
+	// RequireLowS indicates that ECDSA signatures should only be accepted if the S value is
+	// in the lower half of the order of the curve. Signatures created by a TPM may not meet
+	// this requirement unless they are normalized with [NormalizeECDSASignature].
+	RequireLowS bool
+}
+
+// isHighS indicates whether the supplied S value is in the upper half of the order of the
+// supplied curve.
+func isHighS(curve elliptic.Curve, s *big.Int) bool {
+	halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.Cmp(halfOrder) > 0
+}
+
+// NormalizeECDSASignature returns a copy of the supplied ECDSA signature with the S value
+// normalized to the lower half of the order of the supplied curve, which should be the curve
+// of the key that created the signature. Some verifiers reject signatures with a S value in
+// the upper half of the curve order. As both (R, S) and (R, N-S) are valid signatures for the
+// same digest and key, the returned signature remains valid for standard verifiers.
+//
+// If the supplied signature is not an ECDSA signature, or the S value is already in the lower
+// half of the curve order, an unmodified copy will be returned. An error will be returned if
+// no signature or curve is supplied, or if the signature is an ECDSA signature that is
+// missing its ECDSA part.
+func NormalizeECDSASignature(sig *tpm2.Signature, curve elliptic.Curve) (*tpm2.Signature, error) {
+	if sig == nil {
+		return nil, errors.New("no signature")
+	}
+	if curve == nil {
+		return nil, errors.New("no curve")
+	}
+
+	if sig.SigAlg == tpm2.SigSchemeAlgECDSA && (sig.Signature == nil || sig.Signature.ECDSA == nil) {
+		return nil, errors.New("invalid ECDSA signature")
+	}
+
+	var out *tpm2.Signature
+	if err := mu.CopyValue(&out, sig); err != nil {
+		return nil, fmt.Errorf("cannot copy signature: %w", err)
+	}
+	if out.SigAlg != tpm2.SigSchemeAlgECDSA {
+		return out, nil
+	}
+
+	sigS := new(big.Int).SetBytes(out.Signature.ECDSA.SignatureS)
+	if !isHighS(curve, sigS) {
+		return out, nil
+	}
+
+	sigS.Sub(curve.Params().N, sigS)
+	size := len(out.Signature.ECDSA.SignatureS)
+	if byteSize := (curve.Params().BitSize + 7) / 8; byteSize > size {
+		size = byteSize
+	}
+	out.Signature.ECDSA.SignatureS = sigS.FillBytes(make([]byte, size))
+	return out, nil
+}
+
+// VerifySignatureWithOptions verifies a signature created by a TPM using the supplied public
+// key, applying the supplied options. Note that only RSA-SSA, RSA-PSS, ECDSA and HMAC signatures
+// are supported.
+//
+// In order to verify a HMAC signature, the supplied public key should be a byte slice containing
+// the HMAC key.
+func VerifySignatureWithOptions(key crypto.PublicKey, digest []byte, signature *tpm2.Signature, opts *SignatureVerifyOptions) (ok bool, err error) {
+	if opts == nil {
+		opts = new(SignatureVerifyOptions)
+	}
+	if opts.RequireLowS && signature != nil && signature.SigAlg == tpm2.SigSchemeAlgECDSA {
+		if signature.Signature == nil || signature.Signature.ECDSA == nil {
+			return false, errors.New("invalid ECDSA signature")
+		}
+		if k, isECC := key.(*ecdsa.PublicKey); isECC && isHighS(k.Curve, new(big.Int).SetBytes(signature.Signature.ECDSA.SignatureS)) {
+			return false, nil
+		}
+	}
+	return VerifySignature(key, digest, signature)
+}
+
 // SignPolicyAuthorization creates a signed authorization using the supplied key and signature
 // scheme. The signed authorization can be used in a TPM2_PolicySigned assertion using the
 // [tpm2.TPMContext.PolicySigned] function. The authorizing party can apply contraints on how the
@@ -159,6 +242,16 @@ func PolicyAuthorize(key crypto.PrivateKey, scheme *tpm2.SigScheme, approvedPoli
 // In order to verify a HMAC signature, the supplied public key should be a byte slice containing
 // the HMAC key.
 func VerifyAttestationSignature(key crypto.PublicKey, attest *tpm2.Attest, signature *tpm2.Signature) (ok bool, err error) {
+	return VerifyAttestationSignatureWithOptions(key, attest, signature, nil)
+}
+
+// VerifyAttestationSignatureWithOptions verifies the signature for the supplied attestation
+// structure as generated by one of the TPM's attestation commands, applying the supplied
+// options. Note that only RSA-SSA, RSA-PSS, ECDSA and HMAC signatures are supported.
+//
+// In order to verify a HMAC signature, the supplied public key should be a byte slice containing
+// the HMAC key.
+func VerifyAttestationSignatureWithOptions(key crypto.PublicKey, attest *tpm2.Attest, signature *tpm2.Signature, opts *SignatureVerifyOptions) (ok bool, err error) {
 	if !signature.SigAlg.IsValid() {
 		return false, errors.New("invalid signature algorithm")
 	}
@@ -172,5 +265,5 @@ func VerifyAttestationSignature(key crypto.PublicKey, attest *tpm2.Attest, signa
 		return false, fmt.Errorf("cannot marshal attestation structure: %w", err)
 	}
 
-	return VerifySignature(key, h.Sum(nil), signature)
+	return VerifySignatureWithOptions(key, h.Sum(nil), signature, opts)
 }
@@ -11,6 +11,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"io"
+	"math/big"
 
 	. "gopkg.in/check.v1"
 
@@ -21,6 +22,136 @@ import (
 	. "github.com/canonical/go-tpm2/util"
 )
 
+type signaturesSuiteNoTPM struct{}
+
+var _ = Suite(&signaturesSuiteNoTPM{})
+
+// signECDSA creates a ECDSA signature for the supplied digest, with a S value in the upper
+// half of the curve order if highS is true and the lower half if it is false.
+func (s *signaturesSuiteNoTPM) signECDSA(c *C, key *ecdsa.PrivateKey, digest []byte, highS bool) *tpm2.Signature {
+	r, sigS, err := ecdsa.Sign(rand.Reader, key, digest)
+	c.Assert(err, IsNil)
+
+	halfOrder := new(big.Int).Rsh(key.Curve.Params().N, 1)
+	if (sigS.Cmp(halfOrder) > 0) != highS {
+		sigS.Sub(key.Curve.Params().N, sigS)
+	}
+
+	return &tpm2.Signature{
+		SigAlg: tpm2.SigSchemeAlgECDSA,
+		Signature: &tpm2.SignatureU{
+			ECDSA: &tpm2.SignatureECDSA{
+				Hash:       tpm2.HashAlgorithmSHA256,
+				SignatureR: r.Bytes(),
+				SignatureS: sigS.Bytes()}}}
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSASignatureHighS(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	h := crypto.SHA256.New()
+	io.WriteString(h, "foo")
+	digest := h.Sum(nil)
+
+	sig := s.signECDSA(c, key, digest, true)
+	orig := sig.Signature.ECDSA.SignatureS
+
+	ok, err := VerifySignatureWithOptions(&key.PublicKey, digest, sig, &SignatureVerifyOptions{RequireLowS: true})
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsFalse)
+
+	normalized, err := NormalizeECDSASignature(sig, elliptic.P256())
+	c.Assert(err, IsNil)
+	c.Check(sig.Signature.ECDSA.SignatureS, DeepEquals, orig)
+	c.Check(normalized.Signature.ECDSA.SignatureR, DeepEquals, sig.Signature.ECDSA.SignatureR)
+	c.Check(normalized.Signature.ECDSA.SignatureS, internal_testutil.LenEquals, 32)
+
+	halfOrder := new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+	c.Check(new(big.Int).SetBytes(normalized.Signature.ECDSA.SignatureS).Cmp(halfOrder) <= 0, internal_testutil.IsTrue)
+
+	c.Check(ecdsa.Verify(&key.PublicKey, digest,
+		new(big.Int).SetBytes(normalized.Signature.ECDSA.SignatureR),
+		new(big.Int).SetBytes(normalized.Signature.ECDSA.SignatureS)), internal_testutil.IsTrue)
+
+	ok, err = VerifySignatureWithOptions(&key.PublicKey, digest, normalized, &SignatureVerifyOptions{RequireLowS: true})
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSASignatureLowS(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	h := crypto.SHA256.New()
+	io.WriteString(h, "bar")
+	digest := h.Sum(nil)
+
+	sig := s.signECDSA(c, key, digest, false)
+
+	normalized, err := NormalizeECDSASignature(sig, elliptic.P256())
+	c.Assert(err, IsNil)
+	c.Check(normalized, DeepEquals, sig)
+	c.Check(normalized, Not(Equals), sig)
+
+	ok, err := VerifySignatureWithOptions(&key.PublicKey, digest, normalized, &SignatureVerifyOptions{RequireLowS: true})
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSASignatureNotECDSA(c *C) {
+	hmac := tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA256, make(tpm2.Digest, 32))
+	sig := &tpm2.Signature{
+		SigAlg:    tpm2.SigSchemeAlgHMAC,
+		Signature: &tpm2.SignatureU{HMAC: &hmac}}
+	normalized, err := NormalizeECDSASignature(sig, elliptic.P256())
+	c.Assert(err, IsNil)
+	c.Check(normalized, DeepEquals, sig)
+	c.Check(normalized, Not(Equals), sig)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSASignatureNoSignature(c *C) {
+	_, err := NormalizeECDSASignature(nil, elliptic.P256())
+	c.Check(err, ErrorMatches, `no signature`)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSASignatureNoCurve(c *C) {
+	hmac := tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA256, make(tpm2.Digest, 32))
+	sig := &tpm2.Signature{
+		SigAlg:    tpm2.SigSchemeAlgHMAC,
+		Signature: &tpm2.SignatureU{HMAC: &hmac}}
+	_, err := NormalizeECDSASignature(sig, nil)
+	c.Check(err, ErrorMatches, `no curve`)
+}
+
+func (s *signaturesSuiteNoTPM) TestNormalizeECDSASignatureMissingECDSA(c *C) {
+	sig := &tpm2.Signature{SigAlg: tpm2.SigSchemeAlgECDSA}
+	_, err := NormalizeECDSASignature(sig, elliptic.P256())
+	c.Check(err, ErrorMatches, `invalid ECDSA signature`)
+}
+
+func (s *signaturesSuiteNoTPM) TestVerifySignatureWithOptionsMissingECDSA(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	sig := &tpm2.Signature{SigAlg: tpm2.SigSchemeAlgECDSA}
+	_, err = VerifySignatureWithOptions(&key.PublicKey, make([]byte, 32), sig, &SignatureVerifyOptions{RequireLowS: true})
+	c.Check(err, ErrorMatches, `invalid ECDSA signature`)
+}
+
+func (s *signaturesSuiteNoTPM) TestVerifySignatureWithOptionsAcceptsHighSByDefault(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	h := crypto.SHA256.New()
+	io.WriteString(h, "foo")
+	digest := h.Sum(nil)
+
+	ok, err := VerifySignatureWithOptions(&key.PublicKey, digest, s.signECDSA(c, key, digest, true), nil)
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+}
+
 type signaturesSuite struct {
 	testutil.TPMTest
 }
@@ -254,6 +385,43 @@ func (s *signaturesSuite) TestVerifyECDSA(c *C) {
 	c.Check(ok, internal_testutil.IsTrue)
 }
 
+func (s *signaturesSuite) TestNormalizeECDSASignature(c *C) {
+	key := s.CreatePrimary(c, tpm2.HandleOwner, testutil.NewECCKeyTemplate(objectutil.UsageSign, nil))
+
+	h := crypto.SHA256.New()
+	io.WriteString(h, "foo")
+	digest := h.Sum(nil)
+
+	scheme := tpm2.SigScheme{
+		Scheme: tpm2.SigSchemeAlgECDSA,
+		Details: &tpm2.SigSchemeU{
+			ECDSA: &tpm2.SigSchemeECDSA{
+				HashAlg: tpm2.HashAlgorithmSHA256}}}
+	sig, err := s.TPM.Sign(key, digest, &scheme, nil, nil)
+	c.Assert(err, IsNil)
+
+	pub, _, _, err := s.TPM.ReadPublic(key)
+	c.Assert(err, IsNil)
+	pubKey, ok := pub.Public().(*ecdsa.PublicKey)
+	c.Assert(ok, internal_testutil.IsTrue)
+
+	normalized, err := NormalizeECDSASignature(sig, pubKey.Curve)
+	c.Assert(err, IsNil)
+	c.Check(ecdsa.Verify(pubKey, digest,
+		new(big.Int).SetBytes(normalized.Signature.ECDSA.SignatureR),
+		new(big.Int).SetBytes(normalized.Signature.ECDSA.SignatureS)), internal_testutil.IsTrue)
+
+	ok, err = VerifySignatureWithOptions(pubKey, digest, normalized, &SignatureVerifyOptions{RequireLowS: true})
+	c.Check(err, IsNil)
+	c.Check(ok, internal_testutil.IsTrue)
+
+	// The TPM should also accept the normalized signature.
+	loaded, err := s.TPM.LoadExternal(nil, pub, tpm2.HandleOwner)
+	c.Assert(err, IsNil)
+	_, err = s.TPM.VerifySignature(loaded, digest, normalized)
+	c.Check(err, IsNil)
+}
+
 func (s *signaturesSuite) TestVerifyECDSAInvalid(c *C) {
 	key := s.CreatePrimary(c, tpm2.HandleOwner, testutil.NewECCKeyTemplate(objectutil.UsageSign, nil))
 